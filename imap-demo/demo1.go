@@ -91,7 +91,7 @@ func main() {
 	set.AddNum(cmd.Data[0].SearchResults()...)
 
 	ReportOK(c.Fetch(set, "FLAGS", "INTERNALDATE", "RFC822.SIZE", "BODY[]"))
-	ReportOK(c.UIDStore(set, "+FLAGS.SILENT", imap.NewFlagSet(`\Deleted`)))
+	ReportOK(c.UIDStore(set, "+FLAGS.SILENT", imap.NewFlagSet(imap.FlagDeleted)))
 	ReportOK(c.Expunge(nil))
 	ReportOK(c.UIDSearch("SUBJECT", c.Quote("GoIMAP")))
 
@@ -0,0 +1,103 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// appendAbort is sent after the padded literal of a canceled APPEND command. It
+// makes the command syntactically invalid, causing the server to reject it
+// with a BAD response instead of saving the message.
+const appendAbort = " )"
+
+// errAppendCanceled is returned by appendWriter when the context is done.
+var errAppendCanceled = errors.New("imap: append canceled")
+
+// AppendContext is like Append, but it reports the upload progress and can be
+// canceled. If progress is not nil, it is called periodically with the number
+// of message bytes sent so far and the total message size. The command is
+// synchronous.
+//
+// The server expects the full message once the literal size has been sent, so
+// the only way to abort the upload without closing the connection is to send
+// the remaining bytes anyway. When ctx is done while the message is being
+// sent, the rest of the message is replaced with spaces and followed by
+// invalid command text, which causes the server to reject the command without
+// saving the message. AppendContext waits for the command completion and
+// returns ctx.Err(), leaving the connection usable for other commands.
+func (c *Client) AppendContext(ctx context.Context, mbox string, flags FlagSet, idate *time.Time, msg Literal, progress func(n, total int64)) (cmd *Command, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	l := &appendLiteral{Literal: msg, ctx: ctx, progress: progress}
+	if cmd, err = Wait(c.Append(mbox, flags, idate, l)); l.canceled {
+		if _, ok := err.(ResponseError); ok || err == nil {
+			err = ctx.Err()
+		}
+	}
+	return
+}
+
+// appendLiteral wraps the message literal of AppendContext.
+type appendLiteral struct {
+	Literal
+	ctx      context.Context
+	progress func(n, total int64)
+	canceled bool
+}
+
+func (l *appendLiteral) WriteTo(w io.Writer) (n int64, err error) {
+	aw := &appendWriter{w: w, l: l, total: int64(l.Info().Len)}
+	aw.chunk = chunkSize(aw.total)
+	if _, err = l.Literal.WriteTo(aw); err == errAppendCanceled {
+		l.canceled = true
+		pad := bytes.Repeat([]byte{' '}, aw.chunk)
+		for err = nil; aw.n < aw.total && err == nil; {
+			if rem := aw.total - aw.n; rem < int64(aw.chunk) {
+				pad = pad[:rem]
+			}
+			var nn int
+			nn, err = w.Write(pad)
+			aw.n += int64(nn)
+		}
+		if err == nil {
+			_, err = io.WriteString(w, appendAbort)
+		}
+	}
+	return aw.n, err
+}
+
+// appendWriter splits literal data into chunks, checking for cancellation and
+// reporting progress after each one.
+type appendWriter struct {
+	w        io.Writer
+	l        *appendLiteral
+	n, total int64
+	chunk    int
+}
+
+func (aw *appendWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 && err == nil {
+		if aw.l.ctx.Err() != nil {
+			return n, errAppendCanceled
+		}
+		b := p
+		if len(b) > aw.chunk {
+			b = b[:aw.chunk]
+		}
+		var nn int
+		nn, err = aw.w.Write(b)
+		n, aw.n, p = n+nn, aw.n+int64(nn), p[nn:]
+		if aw.l.progress != nil {
+			aw.l.progress(aw.n, aw.total)
+		}
+	}
+	return
+}
@@ -0,0 +1,176 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFileName is the maximum length of a file name returned by
+// SanitizeFileName, in bytes.
+const maxFileName = 200
+
+// Attachments returns all parts of the message that should be presented as
+// attachments: parts with an "attachment" disposition and parts with a file
+// name that are not inline text of the main body (see TextParts). An
+// encapsulated message (message/rfc822) is returned as a single attachment,
+// without its own parts.
+func Attachments(root MessagePart) (parts []*BodyPart) {
+	plain, html := TextParts(root)
+	walk(root, func(_ string, part MessagePart) error {
+		p, ok := part.(*BodyPart)
+		if !ok {
+			return nil
+		} else if p != plain && p != html && (p.Disposition == "attachment" ||
+			p.FileName() != "" || p.Body != nil) {
+			parts = append(parts, p)
+		}
+		if p.Body != nil {
+			return SkipPart
+		}
+		return nil
+	})
+	return
+}
+
+// SanitizeFileName returns a version of name that is safe to use as the name of
+// a file in a local directory. Path separators and other characters that are
+// reserved on common file systems are replaced with underscores, control
+// characters are removed, leading and trailing dots and spaces are trimmed,
+// and long names are shortened while keeping the extension. An empty result is
+// replaced with "attachment".
+func SanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7F || r == utf8.RuneError:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, ". ")
+	if len(name) > maxFileName {
+		ext := filepath.Ext(name)
+		if len(ext) > maxFileName/4 {
+			ext = ""
+		}
+		base := name[:maxFileName-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = strings.TrimRight(base, ". ") + ext
+	}
+	if name == "" {
+		return "attachment"
+	}
+	return name
+}
+
+// Attachment is a downloaded attachment returned by Session.FetchAttachments.
+type Attachment struct {
+	Part     *BodyPart // Attachment part
+	FileName string    // Sanitized file name
+	Data     io.Reader // Contents with the transfer encoding removed
+}
+
+// FetchAttachments downloads all attachment parts of the message with the
+// specified UID (see Attachments) using one FETCH command for the body
+// structure and another for the parts. The contents are returned in memory,
+// with the content transfer encoding removed. The file name of each attachment
+// is decoded and sanitized. Parts without a file name are named after their
+// section (e.g. "attachment-2.1" or "message-3.eml" for encapsulated messages).
+// UIDs are used regardless of s.UID. ErrNoSection is returned if the message
+// does not exist.
+func (s *Session) FetchAttachments(uid uint32) ([]*Attachment, error) {
+	c := s.Client
+	seq := NewSeqSetNums([]uint32{uid})
+	cmd, err := Wait(c.UIDFetch(seq, "BODYSTRUCTURE"))
+	if err != nil {
+		return nil, err
+	}
+	msg := cmd.MessagesByUID()[uid]
+	if msg == nil {
+		return nil, ErrNoSection
+	}
+	root, _ := msg.BodyStructure()
+	parts := Attachments(root)
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	items := make([]string, len(parts))
+	for i, p := range parts {
+		items[i] = BodySection(p.Section).String()
+	}
+	if cmd, err = Wait(c.UIDFetch(seq, items...)); err != nil {
+		return nil, err
+	} else if msg = cmd.MessagesByUID()[uid]; msg == nil {
+		return nil, ErrNoSection
+	}
+	atts := make([]*Attachment, len(parts))
+	for i, p := range parts {
+		r, err := p.DecodeTransfer(bytes.NewReader(msg.Section(BodySection(p.Section))))
+		if err != nil {
+			return nil, err
+		}
+		atts[i] = &Attachment{Part: p, FileName: attachmentName(p), Data: r}
+	}
+	return atts, nil
+}
+
+// SaveAttachments downloads all attachments of the message with the specified
+// UID (see FetchAttachments) and writes them to files in dir, which must exist.
+// Existing files are never overwritten; a number is added to the name instead
+// (e.g. "report (1).pdf"). The paths of the created files are returned, even
+// if an error is encountered.
+func (s *Session) SaveAttachments(uid uint32, dir string) (paths []string, err error) {
+	atts, err := s.FetchAttachments(uid)
+	for _, a := range atts {
+		if err != nil {
+			break
+		}
+		var f *os.File
+		if f, err = createUnique(dir, a.FileName); err == nil {
+			paths = append(paths, f.Name())
+			if _, err = io.Copy(f, a.Data); err == nil {
+				err = f.Close()
+			} else {
+				f.Close()
+			}
+		}
+	}
+	return
+}
+
+// attachmentName returns the sanitized file name of an attachment part.
+func attachmentName(p *BodyPart) string {
+	if name := p.FileName(); name != "" {
+		return SanitizeFileName(name)
+	} else if p.Body != nil {
+		return SanitizeFileName("message-" + p.Section + ".eml")
+	}
+	return SanitizeFileName("attachment-" + p.Section)
+}
+
+// createUnique creates a new file in dir, adding a number to the name if a file
+// with the same name already exists.
+func createUnique(dir, name string) (*os.File, error) {
+	ext := filepath.Ext(name)
+	base := name[:len(name)-len(ext)]
+	for n := 0; ; n++ {
+		path := filepath.Join(dir, name)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if !os.IsExist(err) || n >= 1000 {
+			return f, err
+		}
+		name = base + " (" + strconv.Itoa(n+1) + ")" + ext
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	text := &BodyPart{Section: "1", Type: "text", Subtype: "plain"}
+	pdf := &BodyPart{Section: "2", Type: "application", Subtype: "pdf",
+		Disposition: "attachment", DispParams: map[string]string{"filename": "a.pdf"}}
+	img := &BodyPart{Section: "3", Type: "image", Subtype: "png", Disposition: "inline",
+		Params: map[string]string{"name": "logo.png"}}
+	msg := &BodyPart{Section: "4", Type: "message", Subtype: "rfc822",
+		Body: &BodyPart{Section: "4.1", Type: "text", Subtype: "plain",
+			Disposition: "attachment", DispParams: map[string]string{"filename": "x.txt"}}}
+	root := &Multipart{Subtype: "mixed", Parts: []MessagePart{text, pdf, img, msg}}
+	if out := Attachments(root); !reflect.DeepEqual(out, []*BodyPart{pdf, img, msg}) {
+		t.Errorf("Attachments() unexpected result %v", out)
+	}
+	if out := Attachments(text); out != nil {
+		t.Errorf("Attachments() expected nil; got %v", out)
+	}
+
+	params := []struct {
+		in  map[string]string
+		out string
+	}{
+		{map[string]string{"filename": "=?utf-8?q?Caf=C3=A9?=.txt"}, "Café.txt"},
+		{map[string]string{"filename*": "utf-8''Caf%C3%A9.txt"}, "Café.txt"},
+		{map[string]string{"filename*": "iso-8859-1'fr'Caf%E9.txt"}, "Café.txt"},
+		{map[string]string{"filename*0*": "utf-8''Caf%C3%A9", "filename*1": " 100%.txt"}, "Café 100%.txt"},
+		{map[string]string{"filename*0": "long", "filename*1": "name.txt", "filename": "x"}, "longname.txt"},
+		{map[string]string{"filename*": "x-unknown''a%20b"}, "a b"},
+	}
+	for _, test := range params {
+		p := &BodyPart{DispParams: test.in}
+		if out := p.FileName(); out != test.out {
+			t.Errorf("FileName(%v) expected %q; got %q", test.in, test.out, out)
+		}
+	}
+
+	long := strings.Repeat("é", 150) + ".pdf"
+	names := []struct{ in, out string }{
+		{"report.pdf", "report.pdf"},
+		{"../../etc/passwd", "_.._etc_passwd"},
+		{`C:\Windows\evil.exe`, "C__Windows_evil.exe"},
+		{"a\x00b\r\nc", "abc"},
+		{" .hidden. ", "hidden"},
+		{"..", "attachment"},
+		{"", "attachment"},
+		{long, strings.Repeat("é", 98) + ".pdf"},
+	}
+	for _, test := range names {
+		if out := SanitizeFileName(test.in); out != test.out {
+			t.Errorf("SanitizeFileName(%q) expected %q; got %q", test.in, test.out, out)
+		}
+	}
+}
+
+func TestSessionSaveAttachments(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+	dir := T.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0666); err != nil {
+		T.Fatal(err)
+	}
+
+	go t.script(
+		`C: A1 UID FETCH 5 (BODYSTRUCTURE)`+CRLF,
+		`S: * 1 FETCH (UID 5 BODYSTRUCTURE (`+
+			`("TEXT" "PLAIN" ("CHARSET" "UTF-8") NIL NIL "7BIT" 5 1 NIL NIL NIL NIL)`+
+			`("TEXT" "PLAIN" ("CHARSET" "UTF-8") NIL NIL "BASE64" 8 1 NIL ("ATTACHMENT" ("FILENAME" "a.txt")) NIL NIL)`+
+			`("APPLICATION" "OCTET-STREAM" NIL NIL NIL "QUOTED-PRINTABLE" 5 NIL ("ATTACHMENT" ("FILENAME*" "utf-8''..%2Fb.bin")) NIL NIL)`+
+			` "MIXED" ("BOUNDARY" "x") NIL NIL NIL))`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID FETCH 5 (BODY.PEEK[2] BODY.PEEK[3])`+CRLF,
+		`S: * 1 FETCH (UID 5 BODY[2] "aGVsbG8=" BODY[3] "a=3Db")`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+	)
+	paths, err := S.SaveAttachments(5, dir)
+	t.join("FETCH", err)
+	want := []string{filepath.Join(dir, "a (1).txt"), filepath.Join(dir, "_b.bin")}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("SaveAttachments() expected %q; got %q", want, paths)
+	}
+	for i, data := range []string{"hello", "a=b"} {
+		if b, err := os.ReadFile(paths[i]); err != nil || string(b) != data {
+			t.Errorf("SaveAttachments() expected %q in %s; got %q (%v)", data, paths[i], b, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fetchMacros are the FETCH macros expanded by FetchBatcher, which cannot be
+// combined with other data items.
+var fetchMacros = map[string][]string{
+	"FAST": {"FLAGS", "INTERNALDATE", "RFC822.SIZE"},
+	"ALL":  {"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE"},
+	"FULL": {"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODY"},
+}
+
+// FetchBatcher coalesces small FETCH requests that are issued by multiple
+// goroutines within a short time window into a single FETCH command. Requests
+// for the same data items are combined into one command for the union of their
+// message sets, and the returned messages are distributed to the callers whose
+// sets contain them. Requests for different data items are never combined, so
+// the server does not send unrequested data or change the state of other
+// messages (e.g. BODY[] sets the \Seen flag).
+// This reduces the number of round trips when many independent parts of an
+// application request data for a few messages each (e.g. rendering the rows of
+// a message list).
+//
+// The Client is used by the batcher from a background goroutine when the window
+// expires, so the application must not use the Client directly while any
+// requests are pending.
+type FetchBatcher struct {
+	c      *Client
+	uid    bool
+	window time.Duration
+
+	mu      sync.Mutex // Protects pending and timer
+	pending []*fetchRequest
+	timer   Timer
+	run     sync.Mutex // Serializes Flush calls
+}
+
+// fetchRequest is a single FetchBatcher.Fetch call waiting for results.
+type fetchRequest struct {
+	seq   *SeqSet
+	items []string
+	done  chan struct{}
+	msgs  []*MessageInfo
+	err   error
+}
+
+// NewFetchBatcher returns a batcher that issues UID FETCH commands if uid is
+// true, or FETCH commands otherwise. Each command is sent once window has
+// elapsed since the first pending request was received.
+func NewFetchBatcher(c *Client, uid bool, window time.Duration) *FetchBatcher {
+	return &FetchBatcher{c: c, uid: uid, window: window}
+}
+
+// Fetch adds a request for the specified messages and data items to the
+// current batch and blocks until the batch is completed. The messages in seq
+// are returned in the order received. The macros FAST, ALL, and FULL are
+// expanded, so requests for a macro and for its items are combined. The
+// MessageInfo values may be shared with other callers and must not be
+// modified. Dynamic sets (e.g. "1:*") are sent in a separate command within the
+// same batch. If the command fails, all of its callers receive the error.
+func (b *FetchBatcher) Fetch(seq *SeqSet, items ...string) ([]*MessageInfo, error) {
+	req := &fetchRequest{seq: seq, items: items, done: make(chan struct{})}
+	b.mu.Lock()
+	b.pending = append(b.pending, req)
+	if b.timer == nil {
+		b.timer = b.c.clock().AfterFunc(b.window, b.Flush)
+	}
+	b.mu.Unlock()
+	<-req.done
+	return req.msgs, req.err
+}
+
+// Flush sends all pending requests immediately without waiting for the window
+// to expire.
+func (b *FetchBatcher) Flush() {
+	b.run.Lock()
+	defer b.run.Unlock()
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	var keys []string
+	groups := make(map[string][]*fetchRequest)
+	for _, req := range batch {
+		if req.seq.Dynamic() {
+			b.fetch([]*fetchRequest{req})
+			continue
+		}
+		key := itemsKey(req.items)
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], req)
+	}
+	for _, key := range keys {
+		b.fetch(groups[key])
+	}
+}
+
+// itemsKey returns a string that identifies the set of data items, with the
+// macros expanded.
+func itemsKey(items []string) string {
+	var all []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		expanded, ok := fetchMacros[toUpper(item)]
+		if !ok {
+			expanded = []string{item}
+		}
+		for _, item := range expanded {
+			if key := toUpper(item); !seen[key] {
+				seen[key] = true
+				all = append(all, key)
+			}
+		}
+	}
+	sort.Strings(all)
+	return strings.Join(all, " ")
+}
+
+// fetch executes one FETCH command for the requests, which have the same data
+// items, and distributes the results.
+func (b *FetchBatcher) fetch(reqs []*fetchRequest) {
+	seq := new(SeqSet)
+	var items []string
+	seen := make(map[string]bool)
+	for _, req := range reqs {
+		seq.AddSet(req.seq)
+		for _, item := range req.items {
+			expanded, ok := fetchMacros[toUpper(item)]
+			if !ok {
+				expanded = []string{item}
+			}
+			for _, item := range expanded {
+				if key := toUpper(item); !seen[key] {
+					seen[key] = true
+					items = append(items, item)
+				}
+			}
+		}
+	}
+	fetch := b.c.Fetch
+	if b.uid {
+		fetch = b.c.UIDFetch
+	}
+	cmd, err := Wait(fetch(seq, items...))
+	var msgs []*MessageInfo
+	if err == nil {
+		msgs = cmd.Messages()
+	}
+	for _, req := range reqs {
+		if req.err = err; err == nil {
+			for _, msg := range msgs {
+				if len(reqs) == 1 || b.match(req.seq, msg) {
+					req.msgs = append(req.msgs, msg)
+				}
+			}
+		}
+		close(req.done)
+	}
+}
+
+// match returns true if msg belongs to the request for seq.
+func (b *FetchBatcher) match(seq *SeqSet, msg *MessageInfo) bool {
+	if b.uid {
+		return seq.Contains(msg.UID)
+	}
+	return seq.Contains(msg.Seq)
+}
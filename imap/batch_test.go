@@ -0,0 +1,69 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFetchBatcher(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	b := NewFetchBatcher(C, true, time.Hour)
+
+	type result struct {
+		uids []uint32
+		err  error
+	}
+	fetch := func(set string, items ...string) <-chan result {
+		ch := make(chan result, 1)
+		n := len(b.pending)
+		go func() {
+			msgs, err := b.Fetch(newSeqSet(set), items...)
+			var uids []uint32
+			for _, msg := range msgs {
+				uids = append(uids, msg.UID)
+			}
+			ch <- result{uids, err}
+		}()
+		for {
+			b.mu.Lock()
+			queued := len(b.pending) > n
+			b.mu.Unlock()
+			if queued {
+				return ch
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	r1 := fetch("1:2", "FLAGS")
+	r2 := fetch("5", "fast", "ENVELOPE")
+	r3 := fetch("2", "flags")
+	r4 := fetch("7", "ENVELOPE", "FLAGS", "RFC822.SIZE", "INTERNALDATE")
+
+	// Only requests for the same items are combined
+	go t.script(
+		`C: A1 UID FETCH 1:2 (FLAGS)`+CRLF,
+		`S: * 1 FETCH (UID 1 FLAGS ())`+CRLF,
+		`S: * 2 FETCH (UID 2 FLAGS (\Seen))`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID FETCH 5,7 (FLAGS INTERNALDATE RFC822.SIZE ENVELOPE)`+CRLF,
+		`S: * 3 FETCH (UID 5 FLAGS ())`+CRLF,
+		`S: * 4 FETCH (UID 7 FLAGS ())`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+	)
+	b.Flush()
+	want := [][]uint32{{1, 2}, {5}, {2}, {7}}
+	for i, ch := range []<-chan result{r1, r2, r3, r4} {
+		r := <-ch
+		if r.err != nil || !reflect.DeepEqual(r.uids, want[i]) {
+			t.Errorf("Fetch() #%d expected %v; got %v (%v)", i+1, want[i], r.uids, r.err)
+		}
+	}
+	t.join("UID FETCH", nil)
+}
@@ -0,0 +1,214 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"sort"
+)
+
+func init() {
+	// Allow Envelope, BodyPart, and Multipart values (including the
+	// MessagePart interface fields) to be encoded with encoding/gob.
+	gob.Register(&BodyPart{})
+	gob.Register(&Multipart{})
+}
+
+// ErrBadEncoding is returned by UnmarshalBinary when the input is not a valid
+// binary encoding of the value.
+var ErrBadEncoding = errors.New("imap: bad binary encoding")
+
+// Binary encoding format version.
+const binVersion = 1
+
+// Binary encoding field type tags.
+const (
+	binNil = iota
+	binAtom
+	binQuoted
+	binNumber
+	binList
+	binBytes
+	binLiteral
+	binLiteral8
+)
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface. It encodes
+// the message sequence number and all attributes in a compact format that is
+// suitable for large local caches. The Literal values in Attrs are written in
+// full. MessageInfo values are also encoded in this format by encoding/gob.
+func (msg *MessageInfo) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 256)
+	b = append(b, binVersion)
+	b = binary.AppendUvarint(b, uint64(msg.Seq))
+	b = binary.AppendUvarint(b, uint64(len(msg.Attrs)))
+	keys := make([]string, 0, len(msg.Attrs))
+	for k := range msg.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b = appendBinString(b, k)
+		var err error
+		if b, err = appendBinField(b, msg.Attrs[k]); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. The
+// UID, Flags, InternalDate, and Size fields are extracted from the decoded
+// attributes. Literals are restored as in-memory literals.
+func (msg *MessageInfo) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 || b[0] != binVersion {
+		return ErrBadEncoding
+	}
+	d := binDecoder(b[1:])
+	seq := d.uvarint()
+	n := d.uvarint()
+	if n > uint64(len(d)) {
+		return ErrBadEncoding
+	}
+	kv := make(FieldMap, n)
+	for ; n > 0 && d != nil; n-- {
+		k := string(d.bytes())
+		kv[k] = d.field(0)
+	}
+	if d == nil || len(d) != 0 || seq > 0xFFFFFFFF {
+		return ErrBadEncoding
+	}
+	*msg = *newMessageInfo(uint32(seq), kv)
+	return nil
+}
+
+// appendBinField appends the binary encoding of f to b.
+func appendBinField(b []byte, f Field) ([]byte, error) {
+	switch v := f.(type) {
+	case nil:
+		b = append(b, binNil)
+	case string:
+		if Quoted(v) {
+			b = append(b, binQuoted)
+		} else {
+			b = append(b, binAtom)
+		}
+		b = appendBinString(b, v)
+	case uint32:
+		b = append(b, binNumber)
+		b = binary.AppendUvarint(b, uint64(v))
+	case []Field:
+		b = append(b, binList)
+		b = binary.AppendUvarint(b, uint64(len(v)))
+		for _, f := range v {
+			var err error
+			if b, err = appendBinField(b, f); err != nil {
+				return nil, err
+			}
+		}
+	case []byte:
+		b = append(b, binBytes)
+		b = appendBinBytes(b, v)
+	case Literal:
+		if v.Info().Bin {
+			b = append(b, binLiteral8)
+		} else {
+			b = append(b, binLiteral)
+		}
+		data := AsBytes(v)
+		if uint32(len(data)) != v.Info().Len {
+			return nil, ErrBadEncoding
+		}
+		b = appendBinBytes(b, data)
+	default:
+		return nil, ErrBadEncoding
+	}
+	return b, nil
+}
+
+// appendBinString appends a length-prefixed string to b.
+func appendBinString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// appendBinBytes appends a length-prefixed byte slice to b. Unlike
+// appendBinString, it does not copy large literals through a temporary string.
+func appendBinBytes(b, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// binDecoder decodes values written by appendBinField. It is set to nil when
+// an error is encountered.
+type binDecoder []byte
+
+// maxBinDepth limits the nesting of decoded lists.
+const maxBinDepth = 64
+
+func (d *binDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(*d)
+	if n <= 0 {
+		*d = nil
+		return 0
+	}
+	*d = (*d)[n:]
+	return v
+}
+
+func (d *binDecoder) bytes() []byte {
+	n := d.uvarint()
+	if n > uint64(len(*d)) {
+		*d = nil
+		return nil
+	}
+	b := (*d)[:n:n]
+	*d = (*d)[n:]
+	return b
+}
+
+func (d *binDecoder) field(depth int) Field {
+	if len(*d) == 0 || depth > maxBinDepth {
+		*d = nil
+		return nil
+	}
+	tag := (*d)[0]
+	*d = (*d)[1:]
+	switch tag {
+	case binNil:
+		return nil
+	case binAtom, binQuoted:
+		return string(d.bytes())
+	case binNumber:
+		if v := d.uvarint(); v <= 0xFFFFFFFF {
+			return uint32(v)
+		}
+		*d = nil
+		return nil
+	case binList:
+		n := d.uvarint()
+		if n > uint64(len(*d)) {
+			*d = nil
+			return nil
+		}
+		list := make([]Field, n)
+		for i := range list {
+			if list[i] = d.field(depth + 1); *d == nil {
+				return nil
+			}
+		}
+		return list
+	case binBytes:
+		return append([]byte(nil), d.bytes()...)
+	case binLiteral:
+		return NewLiteral(append([]byte(nil), d.bytes()...))
+	case binLiteral8:
+		return NewLiteral8(append([]byte(nil), d.bytes()...))
+	}
+	*d = nil
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+)
+
+func TestMessageInfoBinary(t *testing.T) {
+	in := newMessageInfo(12, FieldMap{
+		"UID":          uint32(4827313),
+		"FLAGS":        []Field{`\Seen`, `$Forwarded`},
+		"INTERNALDATE": `"17-Jul-1996 02:44:25 -0700"`,
+		"RFC822.SIZE":  uint32(4286),
+		"ENVELOPE": []Field{`"Wed, 17 Jul 1996 02:23:25 -0700 (PDT)"`, `"Subject"`,
+			[]Field{addr("Terry Gray", "gray", "cac.washington.edu")}, nil, nil, nil, nil, nil, nil, `"<id@host>"`},
+		"BODY[HEADER]": lit("Subject: x\r\n\r\n"),
+		"BINARY[1]":    lit8("\x00\xFF"),
+		"BODY[TEXT]":   lit(""),
+		"X-BYTES":      []byte("raw"),
+	})
+	b, err := in.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() unexpected error; %v", err)
+	}
+	out := new(MessageInfo)
+	if err = out.UnmarshalBinary(b); err != nil {
+		t.Fatalf("UnmarshalBinary() unexpected error; %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("UnmarshalBinary() expected\n%v; got\n%v", in, out)
+	}
+	if b2, _ := out.MarshalBinary(); !bytes.Equal(b, b2) {
+		t.Errorf("MarshalBinary() output is not deterministic")
+	}
+
+	for i := range b {
+		if err := new(MessageInfo).UnmarshalBinary(b[:i]); err == nil {
+			t.Errorf("UnmarshalBinary(b[:%d]) expected an error", i)
+		}
+	}
+	if err := new(MessageInfo).UnmarshalBinary(append(b, 0)); err != ErrBadEncoding {
+		t.Errorf("UnmarshalBinary() expected ErrBadEncoding; got %v", err)
+	}
+	if _, err := (&MessageInfo{Attrs: FieldMap{"X": 1}}).MarshalBinary(); err == nil {
+		t.Errorf("MarshalBinary() expected an error for int field")
+	}
+
+	var buf bytes.Buffer
+	type cache struct {
+		Msg  *MessageInfo
+		Env  *Envelope
+		Body MessagePart
+	}
+	c := cache{in, AsEnvelope(in.Attrs["ENVELOPE"]), &Multipart{Subtype: "mixed", Parts: []MessagePart{
+		&BodyPart{Section: "1", Type: "message", Subtype: "rfc822", Body: &BodyPart{Section: "1.1", Type: "text", Subtype: "plain"}},
+	}}}
+	if err := gob.NewEncoder(&buf).Encode(&c); err != nil {
+		t.Fatalf("gob.Encode() unexpected error; %v", err)
+	}
+	var c2 cache
+	if err := gob.NewDecoder(&buf).Decode(&c2); err != nil {
+		t.Fatalf("gob.Decode() unexpected error; %v", err)
+	}
+	c.Env.Date, c2.Env.Date = c.Env.Date.UTC(), c2.Env.Date.UTC()
+	if !reflect.DeepEqual(c2, c) {
+		t.Errorf("gob.Decode() expected\n%#v; got\n%#v", c, c2)
+	}
+}
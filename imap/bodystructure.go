@@ -0,0 +1,728 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime/quotedprintable"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MessagePart represents a single node in the MIME structure of a message, as
+// returned in the BODY and BODYSTRUCTURE FETCH data items. The concrete type is
+// either *BodyPart or *Multipart.
+type MessagePart interface {
+	// MIMEType returns the lower-case media type and subtype of the part
+	// (e.g. "text/plain" or "multipart/mixed").
+	MIMEType() string
+
+	// Walk calls fn for the part and all of its descendants in depth-first
+	// order (see WalkFunc).
+	Walk(fn WalkFunc) error
+
+	// FindBySection returns the part with the specified part specifier or nil
+	// if there is no such part.
+	FindBySection(section string) MessagePart
+
+	// FilterByType returns all non-multipart parts whose media type matches
+	// mimeType (see MatchType).
+	FilterByType(mimeType string) []*BodyPart
+}
+
+// WalkFunc is the type of function called by MessagePart.Walk for each visited
+// part. Parts are visited in the order in which they appear in the message,
+// with each multipart or message/rfc822 part visited before its children. If
+// fn returns SkipPart, the children of the current part are not visited.
+// Walking stops at the first other non-nil error, which is returned by Walk.
+type WalkFunc func(section string, part MessagePart) error
+
+// SkipPart is returned by a WalkFunc to skip the children of the current part.
+var SkipPart = errors.New("imap: skip part")
+
+// BodyPart represents a non-multipart body, as described in RFC 3501 section
+// 7.4.2 (body-type-1part ABNF rule). All media types, subtypes, encodings,
+// dispositions, and parameter names are converted to lower case. The extension
+// data fields (MD5 and later) are only set in BODYSTRUCTURE responses.
+type BodyPart struct {
+	Section     string            `json:"section,omitempty"`     // Part specifier for BODY[<section>] (e.g. "1.2")
+	Type        string            `json:"type,omitempty"`        // Media type (e.g. "text")
+	Subtype     string            `json:"subtype,omitempty"`     // Media subtype (e.g. "plain")
+	Params      map[string]string `json:"params,omitempty"`      // Content-Type parameters (e.g. "charset")
+	ID          string            `json:"id,omitempty"`          // Content-ID
+	Description string            `json:"description,omitempty"` // Content-Description
+	Encoding    string            `json:"encoding,omitempty"`    // Content-Transfer-Encoding (e.g. "base64")
+	Size        uint32            `json:"size,omitempty"`        // Body size in octets (encoded)
+	Lines       uint32            `json:"lines,omitempty"`       // Body size in text lines (text/* and message/rfc822)
+	Envelope    *Envelope         `json:"envelope,omitempty"`    // Encapsulated message envelope (message/rfc822)
+	Body        MessagePart       `json:"body,omitempty"`        // Encapsulated message body (message/rfc822)
+	MD5         string            `json:"md5,omitempty"`         // Content-MD5
+	Disposition string            `json:"disposition,omitempty"` // Content-Disposition type (e.g. "attachment")
+	DispParams  map[string]string `json:"dispParams,omitempty"`  // Content-Disposition parameters
+	Language    []string          `json:"language,omitempty"`    // Content-Language
+	Location    string            `json:"location,omitempty"`    // Content-Location
+}
+
+// Multipart represents a multipart body, as described in RFC 3501 section
+// 7.4.2 (body-type-mpart ABNF rule). The section of a multipart body contained
+// in a message/rfc822 part is the same as that of the enclosing part. The
+// section of the top-level multipart body is empty.
+type Multipart struct {
+	Section     string            `json:"section,omitempty"`     // Part specifier (empty for the top level)
+	Subtype     string            `json:"subtype,omitempty"`     // Media subtype (e.g. "mixed")
+	Parts       []MessagePart     `json:"parts,omitempty"`       // Child parts in their original order
+	Params      map[string]string `json:"params,omitempty"`      // Content-Type parameters (e.g. "boundary")
+	Disposition string            `json:"disposition,omitempty"` // Content-Disposition type
+	DispParams  map[string]string `json:"dispParams,omitempty"`  // Content-Disposition parameters
+	Language    []string          `json:"language,omitempty"`    // Content-Language
+	Location    string            `json:"location,omitempty"`    // Content-Location
+}
+
+// MIMEType returns the media type and subtype (e.g. "text/plain").
+func (p *BodyPart) MIMEType() string {
+	return p.Type + "/" + p.Subtype
+}
+
+// MIMEType returns "multipart/" followed by the subtype.
+func (m *Multipart) MIMEType() string {
+	return "multipart/" + m.Subtype
+}
+
+// Walk calls fn for p and, if p is a message/rfc822 part, its encapsulated body.
+func (p *BodyPart) Walk(fn WalkFunc) error {
+	return walk(p, fn)
+}
+
+// Walk calls fn for m and all of its descendants.
+func (m *Multipart) Walk(fn WalkFunc) error {
+	return walk(m, fn)
+}
+
+// FindBySection returns the part with the specified part specifier.
+func (p *BodyPart) FindBySection(section string) MessagePart {
+	return findBySection(p, section)
+}
+
+// FindBySection returns the part with the specified part specifier. The
+// top-level multipart body is returned for an empty section.
+func (m *Multipart) FindBySection(section string) MessagePart {
+	return findBySection(m, section)
+}
+
+// FilterByType returns all non-multipart parts matching mimeType.
+func (p *BodyPart) FilterByType(mimeType string) []*BodyPart {
+	return filterByType(p, mimeType)
+}
+
+// FilterByType returns all non-multipart parts matching mimeType.
+func (m *Multipart) FilterByType(mimeType string) []*BodyPart {
+	return filterByType(m, mimeType)
+}
+
+// MatchType returns true if the part's media type matches mimeType, which may
+// be a full type ("text/plain"), a type with a wildcard subtype ("text/*"), or
+// just the type ("text"). The wildcards "*" and "*/*" match all types. The
+// comparison is case-insensitive.
+func MatchType(part MessagePart, mimeType string) bool {
+	mimeType = toLower(mimeType)
+	typ := part.MIMEType()
+	if mimeType == "*" || mimeType == "*/*" {
+		return true
+	} else if i := strings.IndexByte(mimeType, '/'); i < 0 || mimeType[i+1:] == "*" {
+		if i >= 0 {
+			mimeType = mimeType[:i]
+		}
+		return strings.HasPrefix(typ, mimeType) && typ[len(mimeType)] == '/'
+	}
+	return typ == mimeType
+}
+
+// walk implements depth-first traversal of the body structure tree.
+func walk(part MessagePart, fn WalkFunc) error {
+	var section string
+	switch v := part.(type) {
+	case *BodyPart:
+		section = v.Section
+	case *Multipart:
+		section = v.Section
+	}
+	if err := fn(section, part); err != nil {
+		if err == SkipPart {
+			err = nil
+		}
+		return err
+	}
+	switch v := part.(type) {
+	case *BodyPart:
+		if v.Body != nil {
+			return walk(v.Body, fn)
+		}
+	case *Multipart:
+		for _, child := range v.Parts {
+			if err := walk(child, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// errFound stops the traversal when the requested part is found.
+var errFound = errors.New("imap: part found")
+
+func findBySection(root MessagePart, section string) (found MessagePart) {
+	walk(root, func(s string, part MessagePart) error {
+		if s == section {
+			found = part
+			return errFound
+		} else if s != "" && !strings.HasPrefix(section, s+".") {
+			return SkipPart
+		}
+		return nil
+	})
+	return
+}
+
+func filterByType(root MessagePart, mimeType string) (parts []*BodyPart) {
+	walk(root, func(_ string, part MessagePart) error {
+		if p, ok := part.(*BodyPart); ok && MatchType(p, mimeType) {
+			parts = append(parts, p)
+		}
+		return nil
+	})
+	return
+}
+
+// TextParts returns the preferred text/plain and text/html parts that make up
+// the main body of a message. Attachments and the contents of encapsulated
+// messages (message/rfc822) are ignored. In a multipart/alternative body, the
+// last matching alternative is preferred, as required by RFC 2046. Only the
+// root (first) part of a multipart/related body is considered. Either return
+// value may be nil if the message does not contain a part of that type. Use
+// the Section field of each part to fetch its contents.
+func TextParts(root MessagePart) (plain, html *BodyPart) {
+	switch v := root.(type) {
+	case *BodyPart:
+		if v.Type != "text" || v.Disposition == "attachment" {
+			break
+		} else if v.Subtype == "plain" {
+			plain = v
+		} else if v.Subtype == "html" {
+			html = v
+		}
+	case *Multipart:
+		switch v.Subtype {
+		case "alternative":
+			for i := len(v.Parts) - 1; i >= 0 && (plain == nil || html == nil); i-- {
+				p, h := TextParts(v.Parts[i])
+				if plain == nil {
+					plain = p
+				}
+				if html == nil {
+					html = h
+				}
+			}
+		case "related":
+			if len(v.Parts) > 0 {
+				plain, html = TextParts(v.Parts[0])
+			}
+		default:
+			for _, part := range v.Parts {
+				p, h := TextParts(part)
+				if plain == nil {
+					plain = p
+				}
+				if html == nil {
+					html = h
+				}
+				if plain != nil || html != nil {
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
+// ContentIDMap maps Content-ID values, without the angle brackets, to the
+// parts that they identify.
+type ContentIDMap map[string]*BodyPart
+
+// InlineParts returns all non-multipart parts that have a Content-ID, which
+// are typically images and other resources referenced from an HTML body via
+// "cid:" URLs (RFC 2392). Parts of encapsulated messages (message/rfc822) are
+// not included, because their identifiers belong to a different message.
+func InlineParts(root MessagePart) ContentIDMap {
+	m := make(ContentIDMap)
+	walk(root, func(_ string, part MessagePart) error {
+		p, ok := part.(*BodyPart)
+		if !ok {
+			return nil
+		}
+		if ids := ParseMessageIDs(p.ID); len(ids) > 0 {
+			if _, dup := m[ids[0]]; !dup {
+				m[ids[0]] = p
+			}
+		}
+		if p.Body != nil {
+			return SkipPart
+		}
+		return nil
+	})
+	return m
+}
+
+// Lookup returns the part referenced by a "cid:" URL or a Content-ID with or
+// without the angle brackets. Nil is returned if there is no such part.
+func (m ContentIDMap) Lookup(cid string) *BodyPart {
+	if len(cid) > 4 && toLower(cid[:4]) == "cid:" {
+		if s, err := url.PathUnescape(cid[4:]); err == nil {
+			cid = s
+		} else {
+			cid = cid[4:]
+		}
+	}
+	if ids := ParseMessageIDs(cid); len(ids) > 0 {
+		return m[ids[0]]
+	}
+	return nil
+}
+
+// IsSigned returns true if m is a multipart/signed body (RFC 1847), such as a
+// PGP/MIME (RFC 3156) or S/MIME (RFC 5751) signed message.
+func (m *Multipart) IsSigned() bool {
+	return m.Subtype == "signed"
+}
+
+// IsEncrypted returns true if m is a multipart/encrypted body (RFC 1847), such
+// as a PGP/MIME encrypted message.
+func (m *Multipart) IsEncrypted() bool {
+	return m.Subtype == "encrypted"
+}
+
+// Protocol returns the lower-case value of the protocol parameter, which
+// identifies the signature or encryption scheme of a multipart/signed or
+// multipart/encrypted body (e.g. "application/pgp-signature").
+func (m *Multipart) Protocol() string {
+	return toLower(m.Params["protocol"])
+}
+
+// SignedParts returns the signed content and the detached signature of a
+// multipart/signed body. The signature must be verified against the exact
+// content bytes, which should be fetched using BODY.PEEK[<section>.MIME] and
+// BODY.PEEK[<section>] for the content section. Nil values are returned if m
+// is not a valid multipart/signed body.
+func (m *Multipart) SignedParts() (content MessagePart, signature *BodyPart) {
+	if !m.IsSigned() || len(m.Parts) != 2 {
+		return nil, nil
+	}
+	if sig, ok := m.Parts[1].(*BodyPart); ok {
+		return m.Parts[0], sig
+	}
+	return nil, nil
+}
+
+// EncryptedParts returns the control information and the encrypted payload of
+// a multipart/encrypted body. For PGP/MIME, the control part has the type
+// application/pgp-encrypted and the payload is application/octet-stream. Nil
+// values are returned if m is not a valid multipart/encrypted body.
+func (m *Multipart) EncryptedParts() (control, payload *BodyPart) {
+	if !m.IsEncrypted() || len(m.Parts) != 2 {
+		return nil, nil
+	}
+	control, _ = m.Parts[0].(*BodyPart)
+	payload, _ = m.Parts[1].(*BodyPart)
+	if control == nil || payload == nil {
+		return nil, nil
+	}
+	return
+}
+
+// IsPKCS7 returns true if p is an S/MIME application/pkcs7-mime part, which
+// contains enveloped (encrypted) or opaque-signed data. See SMIMEType.
+func (p *BodyPart) IsPKCS7() bool {
+	return p.Type == "application" &&
+		(p.Subtype == "pkcs7-mime" || p.Subtype == "x-pkcs7-mime")
+}
+
+// SMIMEType returns the lower-case value of the smime-type parameter of an
+// application/pkcs7-mime part (e.g. "enveloped-data" or "signed-data").
+func (p *BodyPart) SMIMEType() string {
+	return toLower(p.Params["smime-type"])
+}
+
+// SecureParts returns all signed and encrypted structures in the message, in
+// the order in which they appear. Each element is either a *Multipart for
+// which IsSigned or IsEncrypted returns true, or a *BodyPart for which IsPKCS7
+// returns true. Encapsulated messages (message/rfc822) are searched as well.
+func SecureParts(root MessagePart) (parts []MessagePart) {
+	walk(root, func(_ string, part MessagePart) error {
+		switch v := part.(type) {
+		case *Multipart:
+			if v.IsSigned() || v.IsEncrypted() {
+				parts = append(parts, v)
+			}
+		case *BodyPart:
+			if v.IsPKCS7() {
+				parts = append(parts, v)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// CalendarParts returns all iCalendar (RFC 5545) parts in the message, such as
+// meeting invitations and replies. This includes text/calendar and
+// application/ics parts, as well as generic attachments with an ".ics" file
+// name. Encapsulated messages (message/rfc822) are not searched.
+func CalendarParts(root MessagePart) (parts []*BodyPart) {
+	walk(root, func(_ string, part MessagePart) error {
+		p, ok := part.(*BodyPart)
+		if !ok {
+			return nil
+		} else if p.IsCalendar() {
+			parts = append(parts, p)
+		} else if p.Body != nil {
+			return SkipPart
+		}
+		return nil
+	})
+	return
+}
+
+// IsCalendar returns true if p contains iCalendar data.
+func (p *BodyPart) IsCalendar() bool {
+	switch p.MIMEType() {
+	case "text/calendar", "application/ics", "text/x-vcalendar":
+		return true
+	case "application/octet-stream":
+		return strings.HasSuffix(toLower(p.FileName()), ".ics")
+	}
+	return false
+}
+
+// CalendarMethod returns the upper-case iTIP method from the Content-Type
+// parameters of a text/calendar part (e.g. "REQUEST", "REPLY", or "CANCEL").
+// An empty string is returned if the method is not specified.
+func (p *BodyPart) CalendarMethod() string {
+	return toUpper(strings.TrimSpace(p.Params["method"]))
+}
+
+// AsBodyStructure returns the value of a BODY or BODYSTRUCTURE data item. The
+// Section fields are assigned according to the part numbering rules in RFC
+// 3501 section 6.4.5. Nil is returned if f does not contain a valid body
+// structure or if the parts are nested more than MaxListDepth levels deep.
+func AsBodyStructure(f Field) MessagePart {
+	return parseBody(f, "", 0)
+}
+
+// AsBody returns the value of a non-extensible BODY data item. It is identical
+// to AsBodyStructure, except that extension data (MD5, Disposition, Language,
+// Location, and multipart Params) is always cleared, even if the server
+// included it.
+func AsBody(f Field) MessagePart {
+	root := AsBodyStructure(f)
+	if root != nil {
+		walk(root, func(_ string, part MessagePart) error {
+			switch v := part.(type) {
+			case *BodyPart:
+				v.MD5, v.Disposition, v.DispParams = "", "", nil
+				v.Language, v.Location = nil, ""
+			case *Multipart:
+				v.Params, v.Disposition, v.DispParams = nil, "", nil
+				v.Language, v.Location = nil, ""
+			}
+			return nil
+		})
+	}
+	return root
+}
+
+// BodyStructure returns the MIME structure of the message from the
+// BODYSTRUCTURE attribute or, if that is not available, from the BODY
+// attribute. The extended return value is true if BODYSTRUCTURE was used, in
+// which case the extension data fields are valid. Nil is returned if neither
+// attribute is available. Like Envelope, the structure is parsed on the first
+// call and shared by subsequent calls.
+func (msg *MessageInfo) BodyStructure() (root MessagePart, extended bool) {
+	p := msg.parsed
+	if p == nil {
+		return msg.parseBodyStructure()
+	}
+	p.bodyOnce.Do(func() { p.body, p.extended = msg.parseBodyStructure() })
+	return p.body, p.extended
+}
+
+// parseBodyStructure implements BodyStructure without caching.
+func (msg *MessageInfo) parseBodyStructure() (MessagePart, bool) {
+	if f, ok := msg.Attrs["BODYSTRUCTURE"]; ok {
+		return AsBodyStructure(f), true
+	}
+	return AsBody(msg.Attrs["BODY"]), false
+}
+
+// parseBody returns the body structure at the given section. The section of a
+// top-level non-multipart body is "1".
+func parseBody(f Field, section string, depth int) MessagePart {
+	list, ok := f.([]Field)
+	if !ok || len(list) < 2 || depth >= MaxListDepth {
+		return nil
+	} else if _, ok = list[0].([]Field); ok {
+		if m := parseMultipart(list, section, depth); m != nil {
+			return m
+		}
+		return nil
+	} else if section == "" {
+		section = "1"
+	}
+	if p := parseBodyPart(list, section, depth); p != nil {
+		return p
+	}
+	return nil
+}
+
+// parseMultipart returns a multipart body structure (ABNF: body-type-mpart).
+func parseMultipart(list []Field, section string, depth int) *Multipart {
+	m := &Multipart{Section: section}
+	i := 0
+	for ; i < len(list); i++ {
+		if _, ok := list[i].([]Field); !ok {
+			break
+		}
+		part := parseBody(list[i], subsection(section, i+1), depth+1)
+		if part == nil {
+			return nil
+		}
+		m.Parts = append(m.Parts, part)
+	}
+	if i == len(list) || TypeOf(list[i])&(Atom|QuotedString|LiteralString) == 0 {
+		return nil
+	}
+	m.Subtype = toLower(AsString(list[i]))
+
+	// Extension data
+	ext := list[i+1:]
+	if len(ext) > 0 {
+		m.Params = asParams(ext[0])
+	}
+	if len(ext) > 1 {
+		m.Disposition, m.DispParams = asDisposition(ext[1])
+	}
+	if len(ext) > 2 {
+		m.Language = asLanguage(ext[2])
+	}
+	if len(ext) > 3 {
+		m.Location = AsString(ext[3])
+	}
+	return m
+}
+
+// parseBodyPart returns a non-multipart body structure (ABNF: body-type-1part).
+func parseBodyPart(list []Field, section string, depth int) *BodyPart {
+	if len(list) < 7 || TypeOf(list[6]) != Number {
+		return nil
+	}
+	p := &BodyPart{
+		Section:     section,
+		Type:        toLower(AsString(list[0])),
+		Subtype:     toLower(AsString(list[1])),
+		Params:      asParams(list[2]),
+		ID:          AsString(list[3]),
+		Description: AsString(list[4]),
+		Encoding:    toLower(AsString(list[5])),
+		Size:        AsNumber(list[6]),
+	}
+	ext := list[7:]
+	switch {
+	case p.Type == "message" && p.Subtype == "rfc822" && len(ext) >= 3:
+		p.Envelope = AsEnvelope(ext[0])
+		p.Body = parseBody(ext[1], section, depth+1)
+		if b, ok := p.Body.(*BodyPart); ok {
+			b.Section = subsection(section, 1)
+		}
+		p.Lines = AsNumber(ext[2])
+		ext = ext[3:]
+	case p.Type == "text" && len(ext) >= 1:
+		p.Lines = AsNumber(ext[0])
+		ext = ext[1:]
+	}
+
+	// Extension data
+	if len(ext) > 0 {
+		p.MD5 = AsString(ext[0])
+	}
+	if len(ext) > 1 {
+		p.Disposition, p.DispParams = asDisposition(ext[1])
+	}
+	if len(ext) > 2 {
+		p.Language = asLanguage(ext[2])
+	}
+	if len(ext) > 3 {
+		p.Location = AsString(ext[3])
+	}
+	return p
+}
+
+// subsection returns the part specifier of the n-th child of section.
+func subsection(section string, n int) string {
+	if section == "" {
+		return strconv.Itoa(n)
+	}
+	return section + "." + strconv.Itoa(n)
+}
+
+// asParams returns the value of a parameter list (ABNF: body-fld-param). Names
+// are converted to lower case. Nil is returned for NIL and invalid lists.
+func asParams(f Field) map[string]string {
+	list, ok := f.([]Field)
+	if !ok || len(list)&1 == 1 {
+		return nil
+	}
+	v := make(map[string]string, len(list)/2)
+	for i := 0; i < len(list); i += 2 {
+		v[toLower(AsString(list[i]))] = AsString(list[i+1])
+	}
+	return v
+}
+
+// asDisposition returns the value of a disposition field (ABNF: body-fld-dsp).
+func asDisposition(f Field) (typ string, params map[string]string) {
+	if list, ok := f.([]Field); ok && len(list) == 2 {
+		typ, params = toLower(AsString(list[0])), asParams(list[1])
+	}
+	return
+}
+
+// asLanguage returns the value of a language field (ABNF: body-fld-lang).
+func asLanguage(f Field) []string {
+	switch v := f.(type) {
+	case nil:
+		return nil
+	case []Field:
+		lang := make([]string, 0, len(v))
+		for _, f := range v {
+			lang = append(lang, AsString(f))
+		}
+		return lang
+	}
+	if s := AsString(f); s != "" {
+		return []string{s}
+	}
+	return nil
+}
+
+// Charset returns the value of the charset parameter converted to lower case.
+// The default value for text parts is "us-ascii". An empty string is returned
+// for other media types that do not specify a charset.
+func (p *BodyPart) Charset() string {
+	if cs := toLower(p.Params["charset"]); cs != "" {
+		return cs
+	} else if p.Type == "text" {
+		return "us-ascii"
+	}
+	return ""
+}
+
+// FileName returns the decoded file name of the part from the filename
+// parameter of the Content-Disposition header or, if that is not set, from the
+// name parameter of the Content-Type header. Both RFC 2231 parameter value
+// encoding (including continuations) and RFC 2047 encoded-words are decoded.
+func (p *BodyPart) FileName() string {
+	name := paramValue(p.DispParams, "filename")
+	if name == "" {
+		name = paramValue(p.Params, "name")
+	}
+	return DecodeHeader(name)
+}
+
+// paramValue returns the value of the named parameter, decoding RFC 2231
+// extended values ("name*") and joining continuations ("name*0", "name*1*",
+// etc.). The undecoded value is returned if the charset is not supported.
+func paramValue(params map[string]string, name string) string {
+	if v, ok := params[name+"*"]; ok {
+		charset, v := split2231(v)
+		return decode2231(charset, v)
+	}
+	_, plain := params[name+"*0"]
+	_, ext := params[name+"*0*"]
+	if !plain && !ext {
+		return params[name]
+	}
+	var b strings.Builder
+	charset := ""
+	for i := 0; ; i++ {
+		k := name + "*" + strconv.Itoa(i)
+		if v, ok := params[k+"*"]; ok {
+			if i == 0 {
+				charset, v = split2231(v)
+			}
+			b.WriteString(v)
+		} else if v, ok := params[k]; ok {
+			b.WriteString(url.PathEscape(v))
+		} else {
+			break
+		}
+	}
+	return decode2231(charset, b.String())
+}
+
+// split2231 separates the charset from an RFC 2231 extended parameter value in
+// the format charset'language'percent-encoded-value.
+func split2231(v string) (charset, value string) {
+	if parts := strings.SplitN(v, "'", 3); len(parts) == 3 {
+		return parts[0], parts[2]
+	}
+	return "", v
+}
+
+// decode2231 decodes a percent-encoded value and converts it from charset to
+// UTF-8.
+func decode2231(charset, v string) string {
+	raw, err := url.PathUnescape(v)
+	if err != nil {
+		return v
+	}
+	r, err := charsetReader(charset, strings.NewReader(raw))
+	if err != nil {
+		return raw
+	}
+	if b, err := io.ReadAll(r); err == nil {
+		return string(b)
+	}
+	return raw
+}
+
+// Decode returns a reader that removes the content transfer encoding from the
+// raw part data in r (e.g. the contents of BODY[1.2]) and, for text parts,
+// converts it from the declared charset to UTF-8. See CharsetReader for
+// information about supported charsets. An error is returned if the encoding
+// or charset is not supported.
+func (p *BodyPart) Decode(r io.Reader) (io.Reader, error) {
+	r, err := p.DecodeTransfer(r)
+	if err != nil || p.Type != "text" {
+		return r, err
+	}
+	return charsetReader(p.Charset(), r)
+}
+
+// DecodeTransfer returns a reader that only removes the content transfer
+// encoding from the raw part data in r. Unlike Decode, the charset of text
+// parts is not converted, which preserves the original bytes of attachments.
+func (p *BodyPart) DecodeTransfer(r io.Reader) (io.Reader, error) {
+	switch p.Encoding {
+	case "", "7bit", "8bit", "binary":
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	default:
+		return nil, NotAvailableError("encoding " + p.Encoding)
+	}
+	return r, nil
+}
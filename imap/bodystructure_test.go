@@ -0,0 +1,465 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBodyStructure(t *testing.T) {
+	text := []Field{`"TEXT"`, `"PLAIN"`, []Field{`"CHARSET"`, `"US-ASCII"`}, nil, nil, `"7BIT"`, uint32(1152), uint32(23)}
+	file := []Field{`"TEXT"`, `"PLAIN"`, []Field{`"CHARSET"`, `"US-ASCII"`, `"NAME"`, `"cc.diff"`},
+		`"<960723163407.20117h@cac.washington.edu>"`, `"Compiler diff"`, `"BASE64"`, uint32(4554), uint32(73)}
+	tests := []struct {
+		in  Field
+		out MessagePart
+	}{
+		{nil, nil},
+		{[]Field{`"TEXT"`}, nil},
+		{[]Field{`"TEXT"`, `"PLAIN"`, nil, nil, nil, `"7BIT"`}, nil},
+		{text, &BodyPart{
+			Section:  "1",
+			Type:     "text",
+			Subtype:  "plain",
+			Params:   map[string]string{"charset": "US-ASCII"},
+			Encoding: "7bit",
+			Size:     1152,
+			Lines:    23,
+		}},
+		{[]Field{text, file, `"MIXED"`}, &Multipart{
+			Subtype: "mixed",
+			Parts: []MessagePart{
+				&BodyPart{
+					Section:  "1",
+					Type:     "text",
+					Subtype:  "plain",
+					Params:   map[string]string{"charset": "US-ASCII"},
+					Encoding: "7bit",
+					Size:     1152,
+					Lines:    23,
+				},
+				&BodyPart{
+					Section:     "2",
+					Type:        "text",
+					Subtype:     "plain",
+					Params:      map[string]string{"charset": "US-ASCII", "name": "cc.diff"},
+					ID:          "<960723163407.20117h@cac.washington.edu>",
+					Description: "Compiler diff",
+					Encoding:    "base64",
+					Size:        4554,
+					Lines:       73,
+				},
+			},
+		}},
+		{[]Field{
+			[]Field{`"TEXT"`, `"HTML"`, nil, nil, nil, `"QUOTED-PRINTABLE"`, uint32(10), uint32(1),
+				nil, []Field{`"INLINE"`, nil}, `"en"`},
+			[]Field{`"MESSAGE"`, `"RFC822"`, nil, nil, nil, `"7BIT"`, uint32(500),
+				[]Field{nil, `"Fwd"`, nil, nil, nil, nil, nil, nil, nil, nil},
+				[]Field{
+					[]Field{`"TEXT"`, `"PLAIN"`, nil, nil, nil, `"7BIT"`, uint32(5), uint32(1)},
+					[]Field{`"APPLICATION"`, `"PDF"`, []Field{`"NAME"`, `"a.pdf"`}, nil, nil, `"BASE64"`, uint32(100)},
+					`"MIXED"`,
+				},
+				uint32(20), nil, []Field{`"ATTACHMENT"`, []Field{`"FILENAME"`, `"fwd.eml"`}}},
+			`"ALTERNATIVE"`, []Field{`"BOUNDARY"`, `"xyz"`}, nil, []Field{`"en"`, `"de"`}, `"http://example.com/"`,
+		}, &Multipart{
+			Subtype: "alternative",
+			Parts: []MessagePart{
+				&BodyPart{
+					Section:     "1",
+					Type:        "text",
+					Subtype:     "html",
+					Encoding:    "quoted-printable",
+					Size:        10,
+					Lines:       1,
+					Disposition: "inline",
+					Language:    []string{"en"},
+				},
+				&BodyPart{
+					Section:  "2",
+					Type:     "message",
+					Subtype:  "rfc822",
+					Encoding: "7bit",
+					Size:     500,
+					Envelope: &Envelope{Subject: "Fwd"},
+					Body: &Multipart{
+						Section: "2",
+						Subtype: "mixed",
+						Parts: []MessagePart{
+							&BodyPart{Section: "2.1", Type: "text", Subtype: "plain", Encoding: "7bit", Size: 5, Lines: 1},
+							&BodyPart{Section: "2.2", Type: "application", Subtype: "pdf",
+								Params: map[string]string{"name": "a.pdf"}, Encoding: "base64", Size: 100},
+						},
+					},
+					Lines:       20,
+					Disposition: "attachment",
+					DispParams:  map[string]string{"filename": "fwd.eml"},
+				},
+			},
+			Params:   map[string]string{"boundary": "xyz"},
+			Language: []string{"en", "de"},
+			Location: "http://example.com/",
+		}},
+		{[]Field{`"MESSAGE"`, `"RFC822"`, nil, nil, nil, `"7BIT"`, uint32(50),
+			[]Field{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}, text, uint32(5)},
+			&BodyPart{
+				Section:  "1",
+				Type:     "message",
+				Subtype:  "rfc822",
+				Encoding: "7bit",
+				Size:     50,
+				Envelope: &Envelope{},
+				Body: &BodyPart{
+					Section:  "1.1",
+					Type:     "text",
+					Subtype:  "plain",
+					Params:   map[string]string{"charset": "US-ASCII"},
+					Encoding: "7bit",
+					Size:     1152,
+					Lines:    23,
+				},
+				Lines: 5,
+			}},
+	}
+	for _, test := range tests {
+		out := AsBodyStructure(test.in)
+		if !reflect.DeepEqual(out, test.out) {
+			t.Errorf("AsBodyStructure(%v) expected\n%#v; got\n%#v", test.in, test.out, out)
+		}
+	}
+}
+
+func TestBodyPartDecode(t *testing.T) {
+	tests := []struct {
+		part *BodyPart
+		in   string
+		out  string
+	}{
+		{&BodyPart{Type: "text", Encoding: "7bit"}, "hello", "hello"},
+		{&BodyPart{Type: "image", Encoding: "base64"}, "AAEC/w==", "\x00\x01\x02\xff"},
+		{&BodyPart{Type: "text", Encoding: "base64",
+			Params: map[string]string{"charset": "UTF-8"}}, "0J/RgNC40LLQtdGC", "Привет"},
+		{&BodyPart{Type: "text", Encoding: "quoted-printable",
+			Params: map[string]string{"charset": "iso-8859-1"}}, "Andr=E9 =\r\nPirard", "André Pirard"},
+		{&BodyPart{Type: "application", Encoding: "quoted-printable",
+			Params: map[string]string{"charset": "iso-8859-1"}}, "Andr=E9", "Andr\xe9"},
+	}
+	for _, test := range tests {
+		r, err := test.part.Decode(strings.NewReader(test.in))
+		if err != nil {
+			t.Errorf("Decode(%+q) unexpected error; %v", test.in, err)
+			continue
+		}
+		if out, err := ioutil.ReadAll(r); err != nil {
+			t.Errorf("Decode(%+q) unexpected error; %v", test.in, err)
+		} else if string(out) != test.out {
+			t.Errorf("Decode(%+q) expected %+q; got %+q", test.in, test.out, out)
+		}
+	}
+
+	bad := []*BodyPart{
+		{Type: "text", Encoding: "x-uuencode"},
+		{Type: "text", Params: map[string]string{"charset": "x-unknown"}},
+	}
+	for _, p := range bad {
+		if _, err := p.Decode(strings.NewReader("")); err == nil {
+			t.Errorf("Decode(%#v) expected an error", p)
+		}
+	}
+}
+
+func TestBodyStructureWalk(t *testing.T) {
+	root := AsBodyStructure([]Field{
+		[]Field{`"TEXT"`, `"PLAIN"`, nil, nil, nil, `"7BIT"`, uint32(5), uint32(1)},
+		[]Field{`"MESSAGE"`, `"RFC822"`, nil, nil, nil, `"7BIT"`, uint32(50),
+			[]Field{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil},
+			[]Field{
+				[]Field{`"TEXT"`, `"HTML"`, nil, nil, nil, `"7BIT"`, uint32(5), uint32(1)},
+				[]Field{`"IMAGE"`, `"PNG"`, nil, nil, nil, `"BASE64"`, uint32(10)},
+				`"RELATED"`,
+			},
+			uint32(5)},
+		[]Field{`"IMAGE"`, `"JPEG"`, nil, nil, nil, `"BASE64"`, uint32(10)},
+		`"MIXED"`,
+	})
+	if root == nil {
+		t.Fatalf("AsBodyStructure() returned nil")
+	}
+
+	var visited []string
+	root.Walk(func(section string, part MessagePart) error {
+		visited = append(visited, section+" "+part.MIMEType())
+		return nil
+	})
+	want := []string{
+		" multipart/mixed",
+		"1 text/plain",
+		"2 message/rfc822",
+		"2 multipart/related",
+		"2.1 text/html",
+		"2.2 image/png",
+		"3 image/jpeg",
+	}
+	if !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk() expected\n%q; got\n%q", want, visited)
+	}
+
+	visited = nil
+	root.Walk(func(section string, part MessagePart) error {
+		visited = append(visited, section)
+		if part.MIMEType() == "message/rfc822" {
+			return SkipPart
+		}
+		return nil
+	})
+	if want := []string{"", "1", "2", "3"}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Walk(SkipPart) expected %q; got %q", want, visited)
+	}
+
+	sections := map[string]string{
+		"":    "multipart/mixed",
+		"1":   "text/plain",
+		"2":   "message/rfc822",
+		"2.2": "image/png",
+		"3":   "image/jpeg",
+		"4":   "",
+		"2.3": "",
+	}
+	for section, typ := range sections {
+		part := root.FindBySection(section)
+		if part == nil && typ != "" {
+			t.Errorf("FindBySection(%q) expected %s; got nil", section, typ)
+		} else if part != nil && part.MIMEType() != typ {
+			t.Errorf("FindBySection(%q) expected %q; got %s", section, typ, part.MIMEType())
+		}
+	}
+
+	types := map[string][]string{
+		"image":      {"2.2", "3"},
+		"IMAGE/*":    {"2.2", "3"},
+		"image/png":  {"2.2"},
+		"text/html":  {"2.1"},
+		"*":          {"1", "2", "2.1", "2.2", "3"},
+		"multipart":  nil,
+		"applicatio": nil,
+	}
+	for typ, want := range types {
+		var out []string
+		for _, p := range root.FilterByType(typ) {
+			out = append(out, p.Section)
+		}
+		if !reflect.DeepEqual(out, want) {
+			t.Errorf("FilterByType(%q) expected %q; got %q", typ, want, out)
+		}
+	}
+}
+
+func TestTextParts(t *testing.T) {
+	part := func(section, typ, subtype, disp string) *BodyPart {
+		return &BodyPart{Section: section, Type: typ, Subtype: subtype, Disposition: disp}
+	}
+	tests := []struct {
+		in          MessagePart
+		plain, html string
+	}{
+		{part("1", "text", "plain", ""), "1", ""},
+		{part("1", "text", "html", "inline"), "", "1"},
+		{part("1", "text", "plain", "attachment"), "", ""},
+		{part("1", "image", "png", ""), "", ""},
+		{&Multipart{Subtype: "alternative", Parts: []MessagePart{
+			part("1", "text", "plain", ""),
+			part("2", "text", "html", ""),
+		}}, "1", "2"},
+		{&Multipart{Subtype: "alternative", Parts: []MessagePart{
+			part("1", "text", "plain", ""),
+			part("2", "text", "plain", ""),
+		}}, "2", ""},
+		{&Multipart{Subtype: "mixed", Parts: []MessagePart{
+			&Multipart{Section: "1", Subtype: "alternative", Parts: []MessagePart{
+				part("1.1", "text", "plain", ""),
+				&Multipart{Section: "1.2", Subtype: "related", Parts: []MessagePart{
+					part("1.2.1", "text", "html", ""),
+					part("1.2.2", "text", "html", ""),
+				}},
+			}},
+			part("2", "text", "plain", ""),
+			part("3", "text", "html", "attachment"),
+		}}, "1.1", "1.2.1"},
+		{&Multipart{Subtype: "mixed", Parts: []MessagePart{
+			part("1", "text", "plain", "attachment"),
+			&BodyPart{Section: "2", Type: "message", Subtype: "rfc822",
+				Body: part("2.1", "text", "plain", "")},
+			part("3", "text", "html", ""),
+			part("4", "text", "plain", ""),
+		}}, "", "3"},
+	}
+	for i, test := range tests {
+		plain, html := TextParts(test.in)
+		if (plain == nil && test.plain != "") || (plain != nil && plain.Section != test.plain) {
+			t.Errorf("TextParts(%d) expected plain %q; got %#v", i, test.plain, plain)
+		}
+		if (html == nil && test.html != "") || (html != nil && html.Section != test.html) {
+			t.Errorf("TextParts(%d) expected html %q; got %#v", i, test.html, html)
+		}
+	}
+}
+
+func TestInlineParts(t *testing.T) {
+	img := &BodyPart{Section: "1.2", Type: "image", Subtype: "png", ID: "<img1@example.com>"}
+	dup := &BodyPart{Section: "1.3", Type: "image", Subtype: "png", ID: "<img1@example.com>"}
+	att := &BodyPart{Section: "2", Type: "image", Subtype: "gif", ID: " <a b@example.com> ", Disposition: "attachment"}
+	root := &Multipart{Subtype: "mixed", Parts: []MessagePart{
+		&Multipart{Section: "1", Subtype: "related", Parts: []MessagePart{
+			&BodyPart{Section: "1.1", Type: "text", Subtype: "html"},
+			img, dup,
+		}},
+		att,
+		&BodyPart{Section: "3", Type: "message", Subtype: "rfc822",
+			Body: &BodyPart{Section: "3.1", Type: "image", Subtype: "png", ID: "<fwd@example.com>"}},
+	}}
+	m := InlineParts(root)
+	want := ContentIDMap{"img1@example.com": img, "ab@example.com": att}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("InlineParts() expected\n%v; got\n%v", want, m)
+	}
+	lookup := map[string]*BodyPart{
+		"cid:img1@example.com":   img,
+		"CID:img1%40example.com": img,
+		"<img1@example.com>":     img,
+		"img1@example.com":       img,
+		"cid:ab@example.com":     att,
+		"cid:fwd@example.com":    nil,
+		"":                       nil,
+	}
+	for in, out := range lookup {
+		if p := m.Lookup(in); p != out {
+			t.Errorf("Lookup(%+q) expected %v; got %v", in, out, p)
+		}
+	}
+}
+
+func TestSecureParts(t *testing.T) {
+	text := &BodyPart{Section: "1", Type: "text", Subtype: "plain"}
+	sig := &BodyPart{Section: "2", Type: "application", Subtype: "pgp-signature"}
+	signed := &Multipart{Subtype: "signed", Parts: []MessagePart{text, sig},
+		Params: map[string]string{"protocol": "application/PGP-Signature", "micalg": "pgp-sha256"}}
+	if content, s := signed.SignedParts(); content != text || s != sig {
+		t.Errorf("SignedParts() expected %v, %v; got %v, %v", text, sig, content, s)
+	}
+	if p := signed.Protocol(); p != "application/pgp-signature" {
+		t.Errorf("Protocol() expected application/pgp-signature; got %q", p)
+	}
+	if c, p := signed.EncryptedParts(); c != nil || p != nil {
+		t.Errorf("EncryptedParts() expected nil; got %v, %v", c, p)
+	}
+
+	ctl := &BodyPart{Section: "1.1", Type: "application", Subtype: "pgp-encrypted"}
+	data := &BodyPart{Section: "1.2", Type: "application", Subtype: "octet-stream"}
+	encrypted := &Multipart{Section: "1", Subtype: "encrypted", Parts: []MessagePart{ctl, data}}
+	if c, p := encrypted.EncryptedParts(); c != ctl || p != data {
+		t.Errorf("EncryptedParts() expected %v, %v; got %v, %v", ctl, data, c, p)
+	}
+	bad := &Multipart{Subtype: "signed", Parts: []MessagePart{text}}
+	if c, s := bad.SignedParts(); c != nil || s != nil {
+		t.Errorf("SignedParts() expected nil; got %v, %v", c, s)
+	}
+
+	p7 := &BodyPart{Section: "2", Type: "application", Subtype: "x-pkcs7-mime",
+		Params: map[string]string{"smime-type": "Enveloped-Data"}}
+	if !p7.IsPKCS7() || p7.SMIMEType() != "enveloped-data" {
+		t.Errorf("IsPKCS7() or SMIMEType() failed for %v", p7)
+	}
+	root := &Multipart{Subtype: "mixed", Parts: []MessagePart{encrypted, p7}}
+	if out := SecureParts(root); !reflect.DeepEqual(out, []MessagePart{encrypted, p7}) {
+		t.Errorf("SecureParts() expected [%v %v]; got %v", encrypted, p7, out)
+	}
+	if out := SecureParts(text); out != nil {
+		t.Errorf("SecureParts() expected nil; got %v", out)
+	}
+}
+
+func TestCalendarParts(t *testing.T) {
+	invite := &BodyPart{Section: "1.2", Type: "text", Subtype: "calendar",
+		Params: map[string]string{"charset": "utf-8", "method": "request"}}
+	ics := &BodyPart{Section: "2", Type: "application", Subtype: "octet-stream",
+		DispParams: map[string]string{"filename": "=?utf-8?q?Meeting?=.ICS"}}
+	root := &Multipart{Subtype: "mixed", Parts: []MessagePart{
+		&Multipart{Section: "1", Subtype: "alternative", Parts: []MessagePart{
+			&BodyPart{Section: "1.1", Type: "text", Subtype: "plain"},
+			invite,
+		}},
+		ics,
+		&BodyPart{Section: "3", Type: "application", Subtype: "octet-stream",
+			Params: map[string]string{"name": "data.bin"}},
+		&BodyPart{Section: "4", Type: "message", Subtype: "rfc822",
+			Body: &BodyPart{Section: "4.1", Type: "text", Subtype: "calendar"}},
+	}}
+	if out := CalendarParts(root); !reflect.DeepEqual(out, []*BodyPart{invite, ics}) {
+		t.Errorf("CalendarParts() expected [%v %v]; got %v", invite, ics, out)
+	}
+	if m := invite.CalendarMethod(); m != "REQUEST" {
+		t.Errorf("CalendarMethod() expected REQUEST; got %q", m)
+	}
+	if m := ics.CalendarMethod(); m != "" {
+		t.Errorf("CalendarMethod() expected \"\"; got %q", m)
+	}
+	if name := ics.FileName(); name != "Meeting.ICS" {
+		t.Errorf("FileName() expected Meeting.ICS; got %q", name)
+	}
+}
+
+func TestBodyVsBodyStructure(t *testing.T) {
+	text := []Field{`"TEXT"`, `"PLAIN"`, []Field{`"CHARSET"`, `"UTF-8"`}, nil, nil, `"7BIT"`, uint32(10), uint32(1),
+		`"md5"`, []Field{`"INLINE"`, nil}, `"en"`, `"loc"`}
+	mpart := []Field{text, `"MIXED"`, []Field{`"BOUNDARY"`, `"x"`}, nil, nil, nil}
+
+	msg := &MessageInfo{Attrs: FieldMap{"BODY": mpart}}
+	root, ext := msg.BodyStructure()
+	want := &Multipart{Subtype: "mixed", Parts: []MessagePart{&BodyPart{
+		Section: "1", Type: "text", Subtype: "plain", Params: map[string]string{"charset": "UTF-8"},
+		Encoding: "7bit", Size: 10, Lines: 1,
+	}}}
+	if ext || !reflect.DeepEqual(root, MessagePart(want)) {
+		t.Errorf("BodyStructure() expected\n%#v, false; got\n%#v, %v", want, root, ext)
+	}
+
+	msg.Attrs["BODYSTRUCTURE"] = mpart
+	root, ext = msg.BodyStructure()
+	want.Params = map[string]string{"boundary": "x"}
+	p := want.Parts[0].(*BodyPart)
+	p.MD5, p.Disposition, p.Language, p.Location = "md5", "inline", []string{"en"}, "loc"
+	if !ext || !reflect.DeepEqual(root, MessagePart(want)) {
+		t.Errorf("BodyStructure() expected\n%#v, true; got\n%#v, %v", want, root, ext)
+	}
+
+	if root, ext := (&MessageInfo{}).BodyStructure(); root != nil || ext {
+		t.Errorf("BodyStructure() expected nil, false; got %v, %v", root, ext)
+	}
+}
+
+func TestParsedAttrsCache(t *testing.T) {
+	text := []Field{`"TEXT"`, `"PLAIN"`, nil, nil, nil, `"7BIT"`, uint32(10), uint32(1)}
+	env := []Field{`"Mon, 7 Feb 1994 21:52:25 -0800"`, `"Hi"`, nil, nil, nil, nil, nil, nil, nil, `"<id@x>"`}
+	msg := newMessageInfo(1, FieldMap{"ENVELOPE": env, "BODYSTRUCTURE": text})
+	if msg.parsed == nil {
+		t.Fatalf("newMessageInfo() did not create the parsed attribute cache")
+	}
+	e1, e2 := msg.Envelope(), msg.Envelope()
+	if e1 == nil || e1.Subject != "Hi" || e1 != e2 {
+		t.Errorf("Envelope() expected the same cached value; got %p, %p", e1, e2)
+	}
+	r1, ext := msg.BodyStructure()
+	r2, _ := msg.BodyStructure()
+	if r1 == nil || !ext || r1 != r2 {
+		t.Errorf("BodyStructure() expected the same cached value; got %p, %p", r1, r2)
+	}
+	if msg := newMessageInfo(1, FieldMap{"UID": uint32(1)}); msg.parsed != nil {
+		t.Errorf("newMessageInfo() created an unnecessary cache")
+	}
+}
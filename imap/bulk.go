@@ -0,0 +1,150 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "sync"
+
+// bulkItems are the data items requested by FetchOrdered by default.
+var bulkItems = []string{"BODY.PEEK[]"}
+
+// FetchOrdered downloads the messages with the specified UIDs concurrently over
+// multiple connections and passes them to f in the order of uids. Each client
+// runs in its own goroutine and requests one message at a time using UID FETCH
+// with the given data items (the full message, BODY.PEEK[], by default), which
+// hides the network latency on slow links. The clients must be connections to
+// the same account with the same mailbox selected, and must not be used by
+// other goroutines until FetchOrdered returns.
+//
+// At most buffer messages (twice the number of clients if buffer <= 0) are
+// being downloaded or waiting to be delivered at any time, which limits memory
+// use when one message takes longer than the others. Messages that no longer
+// exist are skipped. If f or a command returns an error, no new commands are
+// issued and the error is returned after the commands in progress are
+// completed. f is called from the goroutine that called FetchOrdered.
+func FetchOrdered(clients []*Client, uids []uint32, buffer int, f func(msg *MessageInfo) error, items ...string) error {
+	if len(clients) == 0 || len(uids) == 0 {
+		return nil
+	} else if buffer <= 0 {
+		buffer = 2 * len(clients)
+	}
+	if len(items) == 0 {
+		items = bulkItems
+	}
+	o := &orderedFetch{
+		uids:   uids,
+		items:  items,
+		msgs:   make([]*MessageInfo, len(uids)),
+		done:   make([]bool, len(uids)),
+		tokens: make(chan struct{}, buffer),
+		stop:   make(chan struct{}),
+	}
+	o.cond = sync.NewCond(&o.mu)
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			o.run(c)
+		}(c)
+	}
+	err := o.deliver(f)
+	wg.Wait()
+	return err
+}
+
+// orderedFetch holds the state of FetchOrdered. Each message must acquire a
+// token before it is requested, and the token is released after the message is
+// delivered. Since the messages are requested in order, the messages holding
+// the tokens always include the next one to be delivered.
+type orderedFetch struct {
+	uids  []uint32
+	items []string
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	next int            // Index of the next message to request
+	msgs []*MessageInfo // Received messages waiting for delivery
+	done []bool         // Completed requests
+	err  error          // First error
+
+	tokens chan struct{}
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// fail saves the first error and stops all goroutines. o.mu must be held.
+func (o *orderedFetch) fail(err error) {
+	if o.err == nil {
+		o.err = err
+	}
+	o.once.Do(func() { close(o.stop) })
+	o.cond.Broadcast()
+}
+
+// run requests messages using c until all messages are requested or an error
+// occurs.
+func (o *orderedFetch) run(c *Client) {
+	for {
+		select {
+		case o.tokens <- struct{}{}:
+		case <-o.stop:
+			return
+		}
+		o.mu.Lock()
+		if o.next >= len(o.uids) || o.err != nil {
+			o.mu.Unlock()
+			<-o.tokens
+			return
+		}
+		i := o.next
+		o.next++
+		o.mu.Unlock()
+
+		uid := o.uids[i]
+		cmd, err := Wait(c.UIDFetch(NewSeqSetNums([]uint32{uid}), o.items...))
+		o.mu.Lock()
+		if err != nil {
+			o.fail(err)
+			o.mu.Unlock()
+			return
+		}
+		for _, msg := range cmd.Messages() {
+			if msg.UID == uid {
+				o.msgs[i] = msg
+			}
+		}
+		o.done[i] = true
+		o.cond.Broadcast()
+		o.mu.Unlock()
+	}
+}
+
+// deliver passes the messages to f in order as they become available. After an
+// error, the messages preceding the failed one are still delivered.
+func (o *orderedFetch) deliver(f func(msg *MessageInfo) error) error {
+	for i := range o.uids {
+		o.mu.Lock()
+		for !o.done[i] && o.err == nil {
+			o.cond.Wait()
+		}
+		msg, err := o.msgs[i], o.err
+		if !o.done[i] {
+			o.mu.Unlock()
+			return err
+		}
+		o.msgs[i] = nil
+		o.mu.Unlock()
+		<-o.tokens
+		if msg != nil {
+			if err = f(msg); err != nil {
+				o.mu.Lock()
+				o.fail(err)
+				o.mu.Unlock()
+				return err
+			}
+		}
+	}
+	return nil
+}
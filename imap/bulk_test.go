@@ -0,0 +1,55 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFetchOrdered(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+
+	go t.script(
+		`C: A1 UID FETCH 3 (BODY.PEEK[])`+CRLF,
+		`S: * 2 FETCH (UID 3 BODY[] {1}`+CRLF,
+		`S: c)`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID FETCH 9 (BODY.PEEK[])`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+		`C: A3 UID FETCH 1 (BODY.PEEK[])`+CRLF,
+		`S: * 1 FETCH (UID 1 BODY[] {1}`+CRLF,
+		`S: a)`+CRLF,
+		`S: A3 OK FETCH completed`+CRLF,
+	)
+	var got []string
+	err := FetchOrdered([]*Client{C}, []uint32{3, 9, 1}, 1, func(msg *MessageInfo) error {
+		got = append(got, AsString(msg.Attrs["BODY[]"]))
+		return nil
+	})
+	t.join("UID FETCH", err)
+	if !reflect.DeepEqual(got, []string{"c", "a"}) {
+		t.Errorf("FetchOrdered() expected [c a]; got %q", got)
+	}
+
+	go t.script(
+		`C: A4 UID FETCH 4 (FLAGS)`+CRLF,
+		`S: * 3 FETCH (UID 4 FLAGS ())`+CRLF,
+		`S: A4 OK FETCH completed`+CRLF,
+		`C: A5 UID FETCH 5 (FLAGS)`+CRLF,
+		`S: A5 NO Server error`+CRLF,
+	)
+	var uids []uint32
+	err = FetchOrdered([]*Client{C}, []uint32{4, 5, 6}, 1, func(msg *MessageInfo) error {
+		uids = append(uids, msg.UID)
+		return nil
+	}, "FLAGS")
+	t.join("UID FETCH", nil)
+	if _, ok := err.(ResponseError); !ok || !reflect.DeepEqual(uids, []uint32{4}) {
+		t.Errorf("FetchOrdered() unexpected result %v, %v", uids, err)
+	}
+}
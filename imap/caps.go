@@ -0,0 +1,145 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Caps is a set of server capabilities. The names are stored in upper case, so
+// the set may also be indexed directly (e.g. c.Caps["MOVE"]). Capabilities with
+// parameters, such as "AUTH=PLAIN" or "APPENDLIMIT=35651584", are stored as a
+// single name that includes the value.
+type Caps map[string]bool
+
+// Has returns true if the set contains the named capability. The name is case-
+// insensitive.
+func (caps Caps) Has(name string) bool {
+	return caps[toUpper(name)]
+}
+
+// Require returns NotAvailableError for the first capability in names that is
+// not in the set, or nil if all of them are present.
+func (caps Caps) Require(names ...string) error {
+	for _, name := range names {
+		if !caps.Has(name) {
+			return NotAvailableError(toUpper(name))
+		}
+	}
+	return nil
+}
+
+// Auth returns a sorted list of the SASL mechanisms advertised with the AUTH=
+// capability (e.g. "PLAIN").
+func (caps Caps) Auth() []string {
+	return caps.list("AUTH=")
+}
+
+// Values returns a sorted list of the values of a capability that may be
+// advertised more than once with different parameters. For example,
+// Values("THREAD") returns ["ORDEREDSUBJECT" "REFERENCES"] if the server
+// advertises THREAD=ORDEREDSUBJECT and THREAD=REFERENCES.
+func (caps Caps) Values(name string) []string {
+	return caps.list(toUpper(name) + "=")
+}
+
+// Uint returns the numeric value of a capability parameter, such as the message
+// size limit advertised with APPENDLIMIT=<n> (RFC 7889). The second return
+// value is false if the capability is not present or its value is not a
+// number. Note that a plain APPENDLIMIT capability without a value means that
+// the limit is set per mailbox.
+func (caps Caps) Uint(name string) (uint64, bool) {
+	for _, v := range caps.Values(name) {
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// Copy returns a copy of the set.
+func (caps Caps) Copy() Caps {
+	cp := make(Caps, len(caps))
+	for v := range caps {
+		cp[v] = true
+	}
+	return cp
+}
+
+// String returns a sorted, space-separated list of capabilities.
+func (caps Caps) String() string {
+	return strings.Join(caps.list(""), " ")
+}
+
+// list returns a sorted list of capabilities that share a common prefix. The
+// prefix is stripped from the returned strings.
+func (caps Caps) list(prefix string) []string {
+	v := make([]string, 0, len(caps))
+	for name := range caps {
+		if strings.HasPrefix(name, prefix) {
+			v = append(v, name[len(prefix):])
+		}
+	}
+	sort.Strings(v)
+	return v
+}
+
+// equal returns true if caps and other contain the same capabilities.
+func (caps Caps) equal(other Caps) bool {
+	if len(caps) != len(other) {
+		return false
+	}
+	for v := range caps {
+		if !other[v] {
+			return false
+		}
+	}
+	return true
+}
+
+// CapsHandler is a function that is called when the server capabilities
+// change. It receives a copy of the new set.
+type CapsHandler func(caps Caps)
+
+// SetCapsHandler installs a handler that is called whenever c.Caps changes,
+// such as after STARTTLS, authentication, or an unsolicited CAPABILITY
+// response. It is not called if the server reports the same capabilities
+// again. The same restrictions apply as for SetHandler. A nil handler removes
+// the existing one. The previous handler is returned.
+func (c *Client) SetCapsHandler(h CapsHandler) CapsHandler {
+	prev := c.capsHandler
+	c.capsHandler = h
+	return prev
+}
+
+// DisableCaps hides the named capabilities from c.Caps, now and whenever the
+// capabilities are refreshed, which prevents the client and the Session helpers
+// from using extensions that a particular server implements incorrectly. For
+// example, DisableCaps("COMPRESS=DEFLATE", "QRESYNC"). Calling DisableCaps
+// without any arguments re-enables all capabilities the next time they are
+// received.
+func (c *Client) DisableCaps(names ...string) {
+	if len(names) == 0 {
+		c.capsMask = nil
+		return
+	}
+	if c.capsMask == nil {
+		c.capsMask = make(map[string]bool)
+	}
+	changed := false
+	for _, name := range names {
+		name = toUpper(name)
+		c.capsMask[name] = true
+		if c.Caps[name] {
+			delete(c.Caps, name)
+			changed = true
+		}
+	}
+	if changed && c.capsHandler != nil {
+		c.capsHandler(c.Caps.Copy())
+	}
+}
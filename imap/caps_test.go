@@ -0,0 +1,60 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCaps(t *testing.T) {
+	caps := Caps{"IMAP4REV1": true, "MOVE": true, "AUTH=PLAIN": true,
+		"AUTH=XOAUTH2": true, "THREAD=REFERENCES": true,
+		"THREAD=ORDEREDSUBJECT": true, "APPENDLIMIT=35651584": true}
+	if !caps.Has("move") || caps.Has("IDLE") {
+		t.Errorf("Has() returned incorrect results")
+	}
+	if err := caps.Require("MOVE", "idle"); err != NotAvailableError("IDLE") {
+		t.Errorf("Require() expected NotAvailableError(IDLE); got %v", err)
+	}
+	if err := caps.Require("MOVE", "imap4rev1"); err != nil {
+		t.Errorf("Require() unexpected error; %v", err)
+	}
+	if v := caps.Auth(); !reflect.DeepEqual(v, []string{"PLAIN", "XOAUTH2"}) {
+		t.Errorf("Auth() expected [PLAIN XOAUTH2]; got %v", v)
+	}
+	if v := caps.Values("thread"); !reflect.DeepEqual(v, []string{"ORDEREDSUBJECT", "REFERENCES"}) {
+		t.Errorf("Values(THREAD) expected [ORDEREDSUBJECT REFERENCES]; got %v", v)
+	}
+	if n, ok := caps.Uint("APPENDLIMIT"); n != 35651584 || !ok {
+		t.Errorf("Uint(APPENDLIMIT) expected 35651584; got %d, %v", n, ok)
+	}
+	if _, ok := caps.Uint("THREAD"); ok {
+		t.Errorf("Uint(THREAD) expected false")
+	}
+}
+
+func TestClientCapsHandler(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 COMPRESS=DEFLATE] Test server ready`+CRLF)
+	var got []string
+	C.SetCapsHandler(func(caps Caps) { got = append(got, caps.String()) })
+	C.DisableCaps("compress=deflate")
+	t.checkCaps("IMAP4rev1")
+
+	go t.script(
+		`C: A1 NOOP`+CRLF,
+		`S: * CAPABILITY IMAP4rev1 COMPRESS=DEFLATE`+CRLF,
+		`S: * CAPABILITY IMAP4rev1 COMPRESS=DEFLATE IDLE`+CRLF,
+		`S: A1 OK NOOP completed`+CRLF,
+	)
+	_, err := Wait(C.Noop())
+	t.join("NOOP", err)
+	t.checkCaps("IMAP4rev1", "IDLE")
+
+	want := []string{"IMAP4REV1", "IDLE IMAP4REV1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CapsHandler expected %q; got %q", want, got)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"unicode/utf8"
+)
+
+// CharsetReader, if non-nil, is used to convert text from charsets other than
+// UTF-8, US-ASCII, and ISO-8859-1 to UTF-8. It is called with a lower-case
+// charset name and must return a reader that converts input to UTF-8. This
+// allows an application to provide additional charsets (e.g. from the
+// golang.org/x/text packages) without adding dependencies to this package. The
+// function is used for message text and RFC 2047 encoded-words. It is a package
+// variable, not a Client option, because it is used by functions that do not
+// have a Client, such as DecodeHeader and BodyPart.Decode. It should be set
+// once during program initialization and must not be changed while it may be
+// in use by other goroutines.
+var CharsetReader func(charset string, input io.Reader) (io.Reader, error)
+
+// charsetReader returns a reader that converts input from the specified
+// charset to UTF-8.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch charset = toLower(charset); charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	case "iso-8859-1", "latin1", "l1":
+		return &latin1Reader{r: bufio.NewReader(input)}, nil
+	}
+	if CharsetReader != nil {
+		return CharsetReader(charset, input)
+	}
+	return nil, NotAvailableError("charset " + charset)
+}
+
+// encodeCharset converts UTF-8 text in b to the specified charset. Charsets
+// other than UTF-8, US-ASCII, and ISO-8859-1 require c.CharsetEncoder.
+func (c *Client) encodeCharset(charset string, b []byte) ([]byte, error) {
+	switch charset = toLower(charset); charset {
+	case "utf-8", "utf8":
+		return b, nil
+	case "us-ascii", "ascii":
+		for _, c := range b {
+			if c >= char {
+				return nil, errCharsetRange
+			}
+		}
+		return b, nil
+	case "iso-8859-1", "latin1", "l1":
+		out := make([]byte, 0, len(b))
+		for _, r := range string(b) {
+			if r > 0xFF || r == utf8.RuneError {
+				return nil, errCharsetRange
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	}
+	if c.CharsetEncoder != nil {
+		return c.CharsetEncoder(charset, b)
+	}
+	return nil, NotAvailableError("charset " + charset)
+}
+
+// errCharsetRange is returned by encodeCharset when the text contains
+// characters that cannot be represented in the target charset.
+var errCharsetRange = errors.New("imap: text cannot be represented in charset")
+
+// latin1Reader converts ISO-8859-1 input to UTF-8.
+type latin1Reader struct {
+	r   *bufio.Reader
+	buf [utf8.UTFMax]byte
+	out []byte
+}
+
+func (l *latin1Reader) Read(p []byte) (n int, err error) {
+	for n < len(p) {
+		if len(l.out) == 0 {
+			var c byte
+			if c, err = l.r.ReadByte(); err != nil {
+				break
+			}
+			l.out = l.buf[:utf8.EncodeRune(l.buf[:], rune(c))]
+		}
+		m := copy(p[n:], l.out)
+		l.out = l.out[m:]
+		n += m
+	}
+	if n > 0 {
+		err = nil
+	}
+	return
+}
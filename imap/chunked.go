@@ -0,0 +1,93 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"io"
+	"time"
+)
+
+// DefaultChunkSize is the default number of octets requested by each partial
+// FETCH command of a ChunkedFetch.
+const DefaultChunkSize = 1 << 20
+
+// ChunkedFetch downloads a large message section using a sequence of partial
+// FETCH commands (BODY.PEEK[<section>]<<offset>.<count>>), as described in RFC
+// 3501 section 6.4.5. Each chunk is written to the destination only after it
+// has been received in full, and Offset is advanced past it, so Offset always
+// marks the end of the verified data. Failed chunks are retried. If the
+// connection is lost, Run may be called again with a new Client (and the same
+// mailbox selected) to resume the download from Offset.
+type ChunkedFetch struct {
+	UID        uint32        // Message UID
+	Section    SectionSpec   // Section to fetch (Partial, Offset, and Count are ignored)
+	ChunkSize  uint32        // Octets requested per command
+	Retries    int           // Number of times to retry each failed chunk
+	RetryDelay time.Duration // Delay before each retry
+	Offset     uint32        // Octets received and written so far
+	Done       bool          // Set when the end of the section is reached
+}
+
+// NewChunkedFetch returns a ChunkedFetch for the specified section of the
+// message with the given UID, using DefaultChunkSize and up to 3 retries. The
+// entire message is fetched if spec is nil.
+func NewChunkedFetch(uid uint32, spec *SectionSpec) *ChunkedFetch {
+	f := &ChunkedFetch{UID: uid, ChunkSize: DefaultChunkSize, Retries: 3,
+		RetryDelay: time.Second}
+	if spec != nil {
+		f.Section = *spec
+	}
+	return f
+}
+
+// Run fetches the remaining chunks of the section and writes them to w until
+// the server returns a chunk that is shorter than ChunkSize. A chunk that fails
+// with a command error (e.g. a NO response or a timeout) is retried up to
+// f.Retries times. Errors returned by w, ErrNoSection (the message does not
+// exist), and errors after the Client is closed are returned immediately. Run
+// returns nil without sending any commands if f.Done is already set.
+func (f *ChunkedFetch) Run(c *Client, w io.Writer) (err error) {
+	for !f.Done {
+		for try := 0; ; try++ {
+			var retry bool
+			if retry, err = f.next(c, w); err == nil {
+				break
+			} else if !retry || try >= f.Retries || c.State() == Closed {
+				return
+			}
+			c.clock().Sleep(f.RetryDelay)
+		}
+	}
+	return
+}
+
+// next fetches and writes the chunk starting at f.Offset. The retry flag is set
+// if the command failed.
+func (f *ChunkedFetch) next(c *Client, w io.Writer) (retry bool, err error) {
+	spec := f.Section
+	spec.Peek, spec.Partial, spec.Offset, spec.Count = true, true, f.Offset, f.ChunkSize
+	if spec.Count == 0 {
+		spec.Count = DefaultChunkSize
+	}
+	seq := NewSeqSetNums([]uint32{f.UID})
+	cmd, err := Wait(c.UIDFetch(seq, spec.String()))
+	if err != nil {
+		return true, err
+	}
+	msg := cmd.MessagesByUID()[f.UID]
+	if msg == nil {
+		return false, ErrNoSection
+	}
+	// A NIL or empty value indicates that Offset is at the end of the section
+	b := AsBytes(spec.Value(msg))
+	if len(b) > 0 {
+		if _, err = w.Write(b); err != nil {
+			return false, err
+		}
+		f.Offset += uint32(len(b))
+	}
+	f.Done = uint32(len(b)) < spec.Count
+	return false, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestChunkedFetch(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+
+	f := NewChunkedFetch(42, BodySection("1"))
+	f.ChunkSize, f.RetryDelay = 4, 0
+
+	go t.script(
+		`C: A1 UID FETCH 42 (BODY.PEEK[1]<0.4>)`+CRLF,
+		`S: * 3 FETCH (UID 42 BODY[1]<0> {4}`+CRLF,
+		`S: hell)`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID FETCH 42 (BODY.PEEK[1]<4.4>)`+CRLF,
+		`S: A2 NO Temporary failure`+CRLF,
+		`C: A3 UID FETCH 42 (BODY.PEEK[1]<4.4>)`+CRLF,
+		`S: * 3 FETCH (UID 42 BODY[1]<4> {4}`+CRLF,
+		`S: o wo)`+CRLF,
+		`S: A3 OK FETCH completed`+CRLF,
+		`C: A4 UID FETCH 42 (BODY.PEEK[1]<8.4>)`+CRLF,
+		`S: * 3 FETCH (UID 42 BODY[1]<8> {3}`+CRLF,
+		`S: rld)`+CRLF,
+		`S: A4 OK FETCH completed`+CRLF,
+	)
+	var buf bytes.Buffer
+	t.join("FETCH", f.Run(C, &buf))
+	if buf.String() != "hello world" || f.Offset != 11 || !f.Done {
+		t.Errorf("Run() unexpected result %q (Offset=%d Done=%v)", buf.String(), f.Offset, f.Done)
+	}
+
+	// Resume at the end of a section with a length that is a multiple of
+	// ChunkSize.
+	f = NewChunkedFetch(7, nil)
+	f.ChunkSize, f.Offset, f.Retries = 4, 4, 0
+	go t.script(
+		`C: A5 UID FETCH 7 (BODY.PEEK[]<4.4>)`+CRLF,
+		`S: * 1 FETCH (UID 7 BODY[]<4> "")`+CRLF,
+		`S: A5 OK FETCH completed`+CRLF,
+	)
+	buf.Reset()
+	t.join("FETCH", f.Run(C, &buf))
+	if buf.Len() != 0 || f.Offset != 4 || !f.Done {
+		t.Errorf("Run() unexpected result %q (Offset=%d Done=%v)", buf.String(), f.Offset, f.Done)
+	}
+
+	f = NewChunkedFetch(9, nil)
+	go t.script(
+		`C: A6 UID FETCH 9 (BODY.PEEK[]<0.1048576>)`+CRLF,
+		`S: A6 OK FETCH completed`+CRLF,
+	)
+	err := f.Run(C, &buf)
+	t.join("FETCH", nil)
+	if err != ErrNoSection || f.Done {
+		t.Errorf("Run() expected ErrNoSection; got %v", err)
+	}
+}
@@ -10,8 +10,6 @@ import (
 	"io"
 	"net"
 	"runtime/debug"
-	"sort"
-	"strings"
 	"sync"
 	"time"
 )
@@ -63,24 +61,96 @@ type Client struct {
 	// Set of current server capabilities. It is updated automatically anytime
 	// new capabilities are received, which could be in a data response or a
 	// status response code.
-	Caps map[string]bool
+	Caps Caps
+
+	// Set of extensions enabled by the ENABLE command (RFC 5161). It is
+	// updated automatically when the server sends an ENABLED response.
+	Enabled map[string]bool
 
 	// Status of the selected mailbox. It is set to nil unless the Client is in
 	// the Selected state. The fields are updated automatically as the server
 	// sends solicited and unsolicited status updates.
 	Mailbox *MailboxStatus
 
+	// Mapping between sequence numbers and UIDs in the selected mailbox. It is
+	// set to nil unless the Client is in the Selected state, and is updated
+	// automatically by EXISTS, EXPUNGE, and FETCH responses (see UIDMap).
+	UIDs *UIDMap
+
 	// Execution parameters of known commands. Client.Send will return an error
 	// if an attempt is made to execute a command whose name does not appear in
 	// this map. The server may not support all commands known to the client.
 	CommandConfig map[string]*CommandConfig
 
+	// Write coalescing mode. If true, Client.Send leaves commands in the send
+	// buffer instead of flushing them to the server immediately. The buffer is
+	// flushed when it fills up, when the Client starts receiving responses
+	// (e.g. in Command.Result), or when Client.Flush is called. This allows
+	// hundreds of pipelined commands to be sent in a few TCP segments instead
+	// of one per command.
+	CoalesceWrites bool
+
+	// Compact SEARCH result mode. If true, the numbers in SEARCH responses are
+	// decoded directly into the []uint32 returned by Response.SearchResults,
+	// and rsp.Fields only contains the SEARCH label and any fields following
+	// the numbers. This avoids allocating a Field for each number, which
+	// reduces the memory and time needed to receive results that contain
+	// millions of messages. It must not be changed while commands are in
+	// progress.
+	CompactSearch bool
+
+	// Charset encoder for SEARCH criteria. If non-nil, it is used by
+	// SearchCharset to convert UTF-8 text to charsets other than UTF-8,
+	// US-ASCII, and ISO-8859-1. It is called with a lower-case charset name and
+	// must return an error if b cannot be represented in that charset. This
+	// allows an application to provide additional charsets (e.g. from the
+	// golang.org/x/text packages) without adding dependencies to this package.
+	// It must not be changed while commands are in progress.
+	CharsetEncoder func(charset string, b []byte) ([]byte, error)
+
+	// Parser limits, which protect the client from malformed or malicious
+	// server responses. MaxListDepth is the maximum nesting depth of
+	// parenthesized lists (the MaxListDepth constant if zero). MaxLiteralSize
+	// is the maximum octet count of a single literal string (zero means no
+	// limit). The default MemoryReader allocates the entire literal in
+	// advance, so a large octet count could exhaust memory. Responses that
+	// exceed these limits cause a ParserError, which terminates the
+	// connection. The limits must not be changed while commands are in
+	// progress.
+	MaxListDepth   int
+	MaxLiteralSize uint32
+
+	// Profiling hooks. If true, the receiver goroutine is labeled with
+	// imap.goroutine=receiver, and the time spent in Command.Result, which
+	// includes receiving and parsing the command's responses, is labeled with
+	// imap.command=<name> and imap.mailbox=<selected mailbox> (see
+	// runtime/pprof). A runtime/trace region named "imap <name>" is also
+	// recorded for each Result call while tracing is enabled. This allows CPU
+	// and memory profiles of large syncs to be attributed to specific IMAP
+	// operations. The hooks add a small amount of overhead to each command, so
+	// they are disabled by default. It must not be changed while commands are
+	// in progress.
+	ProfileLabels bool
+
+	// Source of the current time and timers used for receive timeouts and by
+	// the Watcher, ChunkedFetch, and FetchBatcher helpers. SystemClock is used
+	// if nil. It must not be changed while commands are in progress.
+	Clock Clock
+
 	// Server host name for authentication and STARTTLS commands.
 	host string
 
+	// Callbacks for untagged responses, keyed by response label (see
+	// SetHandler).
+	handlers map[string]ResponseHandler
+
 	// Current connection state. Initially set to unknown.
 	state ConnState
 
+	// Indicator of commands that were written to the send buffer but not
+	// flushed because of CoalesceWrites.
+	unflushed bool
+
 	// Command tag generator.
 	tag tagGen
 
@@ -93,12 +163,15 @@ type Client struct {
 	// receive responses as long as it has an entry in this map.
 	cmds map[string]*Command
 
-	// Control and response channels for the receiver goroutine. A new response
-	// channel rch is created for each time-limited receive request, and is sent
-	// via cch to the receiver. The receiver sends back the output of c.next via
-	// rch. There can be at most one active receive request (rch != nil).
-	cch chan<- chan<- *response
-	rch <-chan *response
+	// Control and response channels for the receiver goroutine. Each
+	// time-limited receive request is sent via cch, and the receiver sends back
+	// the output of c.next via rch. Both channels are created once per
+	// connection, so receive requests do not allocate. There can be at most one
+	// active receive request (rpending == true), which guarantees that responses
+	// are processed in the order they are received.
+	cch      chan<- struct{}
+	rch      <-chan response
+	rpending bool
 
 	// Low-level transport for sending commands and receiving responses.
 	t *transport
@@ -107,6 +180,26 @@ type Client struct {
 	// Protection against multiple close calls.
 	closer sync.Once
 
+	// Copy of Mailbox that is safe to access from other goroutines (see
+	// SelectedMailbox). The copy is only refreshed when update changes
+	// c.Mailbox (mboxDirty) or the client state changes.
+	mboxMu    sync.RWMutex
+	mboxView  *MailboxStatus
+	mboxDirty bool
+
+	// Channel for unsolicited mailbox events (see Notifications). notifyLost
+	// is set when events are discarded after a MailboxResync event.
+	notify     chan MailboxEvent
+	notifyLost bool
+
+	// Destination of streamed SEARCH results (see SearchTo).
+	searchDest func(start, stop uint32)
+
+	// Capability change callback and the set of capabilities hidden from Caps
+	// (see SetCapsHandler and DisableCaps).
+	capsHandler CapsHandler
+	capsMask    map[string]bool
+
 	// Debug message logging.
 	*debugLog
 }
@@ -119,10 +212,11 @@ type Client struct {
 // it is the caller's responsibility to close the connection.
 func NewClient(conn net.Conn, host string, timeout time.Duration) (c *Client, err error) {
 	log := newDebugLog(DefaultLogger, DefaultLogMask)
-	cch := make(chan chan<- *response, 1)
+	cch, rch := make(chan struct{}, 1), make(chan response, 1)
 
 	c = &Client{
-		Caps:          make(map[string]bool),
+		Caps:          make(Caps),
+		Enabled:       make(map[string]bool),
 		CommandConfig: defaultCommands(),
 		host:          host,
 		state:         unknown,
@@ -138,8 +232,8 @@ func NewClient(conn net.Conn, host string, timeout time.Duration) (c *Client, er
 		c.Logln(LogConn, "Greeting error:", err)
 		return nil, err
 	}
-	c.cch = cch
-	go c.receiver(cch)
+	c.cch, c.rch = cch, rch
+	go c.receiver(cch, rch)
 	return
 }
 
@@ -153,7 +247,9 @@ func (c *Client) State() ConnState {
 
 // Send issues a new command, returning as soon as the last line is flushed from
 // the send buffer. This may involve waiting for continuation requests if
-// non-synchronizing literals (RFC 2088) are not supported by the server.
+// non-synchronizing literals (RFC 2088) are not supported by the server. If
+// CoalesceWrites is set, the last line remains in the send buffer until the next
+// flush.
 //
 // This is the raw command interface that does not encode or perform any
 // validation of the supplied fields. It should only be used for implementing
@@ -199,9 +295,12 @@ func (c *Client) Send(name string, fields ...Field) (cmd *Command, err error) {
 		}
 	}
 
-	// Flush buffer after the last line
+	// Flush buffer after the last line, unless the flush is deferred
 	if err == nil {
-		if err = c.t.Flush(); err == nil {
+		if c.CoalesceWrites {
+			c.unflushed = true
+			return
+		} else if err = c.t.Flush(); err == nil {
 			return
 		}
 	}
@@ -209,6 +308,17 @@ func (c *Client) Send(name string, fields ...Field) (cmd *Command, err error) {
 	return nil, err
 }
 
+// Flush sends all commands that are waiting in the send buffer because of
+// CoalesceWrites. It only needs to be called when the commands must reach the
+// server before the Client receives any responses.
+func (c *Client) Flush() error {
+	if !c.unflushed {
+		return nil
+	}
+	c.unflushed = false
+	return c.t.Flush()
+}
+
 // Recv receives at most one response from the server, updates the client state,
 // and delivers the response to its final destination (c.Data or one of the
 // commands in progress). io.EOF is returned once all responses have been
@@ -230,6 +340,16 @@ func (c *Client) Recv(timeout time.Duration) error {
 	return err
 }
 
+// SelectedMailbox returns a copy of the selected mailbox status, or nil if the
+// Client is not in the Selected state. Unlike c.Mailbox, it may be called from
+// any goroutine, including while another goroutine is receiving responses. The
+// copy reflects all responses received so far.
+func (c *Client) SelectedMailbox() *MailboxStatus {
+	c.mboxMu.RLock()
+	defer c.mboxMu.RUnlock()
+	return c.mboxView.Copy()
+}
+
 // SetLiteralReader installs a custom LiteralReader implementation into the
 // response receiver pipeline. It returns the previously installed LiteralReader
 // instance.
@@ -241,32 +361,53 @@ func (c *Client) SetLiteralReader(lr LiteralReader) LiteralReader {
 	return prev
 }
 
+// ResponseHandler is a callback for untagged server responses. See
+// Client.SetHandler.
+type ResponseHandler func(rsp *Response)
+
+// SetHandler installs a handler for untagged responses with the specified label
+// (e.g. "EXISTS", "EXPUNGE", "RECENT", "FETCH", or an extension response name).
+// The label "*" matches all untagged responses; it is called after the handler
+// for the specific label. Handlers are invoked as soon as each response is
+// received, after the client state (e.g. c.Mailbox) is updated, and even while
+// other commands are in progress. The response is then delivered to a command
+// or the c.Data queue as usual, where it may be released by its consumer (see
+// Response.Release), so handlers must copy any data that they need after
+// returning. Handlers are called from within Client methods that receive
+// responses, so they must not call any methods of c. A nil handler removes the
+// existing one. SetHandler returns the previously installed handler for the
+// label.
+func (c *Client) SetHandler(label string, h ResponseHandler) ResponseHandler {
+	if label != "*" {
+		label = toUpper(label)
+	}
+	prev := c.handlers[label]
+	if h == nil {
+		delete(c.handlers, label)
+	} else {
+		if c.handlers == nil {
+			c.handlers = make(map[string]ResponseHandler)
+		}
+		c.handlers[label] = h
+	}
+	return prev
+}
+
 // Quote attempts to represent v, which must be string, []byte, or fmt.Stringer,
 // as a quoted string for use with Client.Send. A literal string representation
-// is used if v cannot be quoted.
+// is used if v cannot be quoted. Nil is returned if v has an unsupported type or
+// contains NUL characters. See also AString.
 func (c *Client) Quote(v interface{}) Field {
-	var b []byte
-	var cp bool
-	switch s := v.(type) {
-	case string:
-		b = []byte(s)
-	case []byte:
-		b, cp = s, true
-	case fmt.Stringer:
-		b = []byte(s.String())
-	default:
-		return nil
-	}
-	if q := QuoteBytes(b, false); q != nil {
-		return string(q)
-	} else if cp {
-		b = append([]byte(nil), b...)
-	}
-	return NewLiteral(b)
+	return exported(encodeString(v, false))
 }
 
 // next returns the next server response obtained directly from the reader.
 func (c *Client) next() (rsp *Response, err error) {
+	c.r.compactSearch, c.r.searchDest = c.CompactSearch, c.searchDest
+	if c.r.maxDepth = c.MaxListDepth; c.r.maxDepth <= 0 {
+		c.r.maxDepth = MaxListDepth
+	}
+	c.r.maxLiteral = c.MaxLiteralSize
 	raw, err := c.r.Next()
 	if err == nil {
 		rsp, err = raw.Parse()
@@ -320,23 +461,29 @@ func (c *Client) greeting(timeout time.Duration) (err error) {
 }
 
 // receiver runs in a separate goroutine, reading a single server response for
-// each request sent on the cch channel.
-func (c *Client) receiver(cch <-chan chan<- *response) {
-	recv := func() (r *response) {
+// each request sent on the cch channel. The goroutine is labeled for profiling
+// while c.ProfileLabels is true.
+func (c *Client) receiver(cch <-chan struct{}, rch chan<- response) {
+	recv := func() (r response) {
 		defer func() {
 			if err := recover(); err != nil {
-				r = &response{nil, fmt.Errorf("imap: receiver panic: %v", err)}
+				r = response{nil, fmt.Errorf("imap: receiver panic: %v", err)}
 				c.Logf(LogGo, "Receiver panic (Tag=%s): %v\n%s", c.tag.id, err, debug.Stack())
 			}
 		}()
 		rsp, err := c.next()
-		return &response{rsp, err}
+		return response{rsp, err}
 	}
 
 	c.Logf(LogGo, "Receiver started (Tag=%s)", c.tag.id)
 	defer c.Logf(LogGo, "Receiver finished (Tag=%s)", c.tag.id)
 
-	for rch := range cch {
+	labeled := false
+	for range cch {
+		if c.ProfileLabels != labeled {
+			labeled = c.ProfileLabels
+			labelReceiver(labeled)
+		}
 		rch <- recv()
 	}
 }
@@ -345,15 +492,16 @@ func (c *Client) receiver(cch <-chan chan<- *response) {
 func (c *Client) recv(timeout time.Duration) (rsp *Response, err error) {
 	if c.state == Closed {
 		return nil, io.EOF
-	} else if c.rch == nil && (timeout < 0 || c.cch == nil) {
+	} else if err = c.Flush(); err != nil {
+		// Connection is closed below
+	} else if !c.rpending && (timeout < 0 || c.cch == nil) {
 		rsp, err = c.next()
 	} else {
-		if c.rch == nil {
-			rch := make(chan *response, 1)
-			c.cch <- rch
-			c.rch = rch
+		if !c.rpending {
+			c.cch <- struct{}{}
+			c.rpending = true
 		}
-		var r *response
+		var r response
 		if timeout < 0 {
 			r = <-c.rch
 		} else {
@@ -363,18 +511,32 @@ func (c *Client) recv(timeout time.Duration) (rsp *Response, err error) {
 				if timeout == 0 {
 					return nil, ErrTimeout
 				}
+				expired := make(chan struct{})
+				timer := c.clock().AfterFunc(timeout, func() { close(expired) })
 				select {
 				case r = <-c.rch:
-				case <-time.After(timeout):
+					timer.Stop()
+				case <-expired:
 					return nil, ErrTimeout
 				}
 			}
 		}
-		c.rch = nil
+		c.rpending = false
 		rsp, err = r.rsp, r.err
 	}
 	if err == nil {
-		c.update(rsp)
+		rsp.utf8 = c.Enabled["UTF8=ACCEPT"]
+		if c.update(rsp); c.mboxDirty {
+			c.publishMailbox()
+		}
+		if len(c.handlers) > 0 && rsp.Tag == "*" {
+			if h := c.handlers[rsp.Label]; h != nil {
+				h(rsp)
+			}
+			if h := c.handlers["*"]; h != nil {
+				h(rsp)
+			}
+		}
 	} else if rsp == nil {
 		defer c.setState(Closed)
 		if err != io.EOF {
@@ -386,11 +548,19 @@ func (c *Client) recv(timeout time.Duration) (rsp *Response, err error) {
 	return
 }
 
-// update examines server responses and updates client state as needed.
+// update examines server responses and updates client state as needed. It sets
+// c.mboxDirty if c.Mailbox was changed.
 func (c *Client) update(rsp *Response) {
 	if rsp.Label == "CAPABILITY" {
 		c.setCaps(rsp.Fields[1:])
 		return
+	} else if rsp.Label == "ENABLED" && rsp.Type == Data {
+		for _, f := range rsp.Fields[1:] {
+			if v := toUpper(AsAtom(f)); v != "" {
+				c.Enabled[v] = true
+			}
+		}
+		return
 	}
 	switch rsp.Type {
 	case Data:
@@ -402,9 +572,19 @@ func (c *Client) update(rsp *Response) {
 			c.Mailbox.Flags.Replace(rsp.Fields[1])
 		case "EXISTS":
 			c.Mailbox.Messages = rsp.Value()
+			c.UIDs.exists(c.Mailbox.Messages)
 		case "RECENT":
 			c.Mailbox.Recent = rsp.Value()
+		case "FETCH":
+			c.UIDs.fetch(rsp)
+			_, uid := fetchUID(rsp)
+			if uid == 0 || uid < c.Mailbox.UIDNext || uid == 1<<32-1 {
+				// UIDNEXT cannot be represented after the maximum UID
+				return
+			}
+			c.Mailbox.UIDNext = uid + 1
 		case "EXPUNGE":
+			c.UIDs.expunge(rsp.Value())
 			c.Mailbox.Messages--
 			if c.Mailbox.Recent > c.Mailbox.Messages {
 				c.Mailbox.Recent = c.Mailbox.Messages
@@ -412,7 +592,14 @@ func (c *Client) update(rsp *Response) {
 			if c.Mailbox.Unseen == rsp.Value() {
 				c.Mailbox.Unseen = 0
 			}
+		case "VANISHED":
+			if uids, earlier := rsp.Vanished(); uids != nil && !earlier {
+				c.vanished(uids)
+			}
+		default:
+			return
 		}
+		c.mboxDirty = true
 	case Status:
 		switch rsp.Status {
 		case BAD:
@@ -454,13 +641,61 @@ func (c *Client) update(rsp *Response) {
 			v := rsp.Value()
 			if u := c.Mailbox.UIDValidity; selected && u != v {
 				c.Logf(LogState, "Mailbox UIDVALIDITY change: %d -> %d", u, v)
+				c.UIDs = newUIDMap()
+				c.UIDs.exists(c.Mailbox.Messages)
 			}
 			c.Mailbox.UIDValidity = v
 		case "UNSEEN":
 			c.Mailbox.Unseen = rsp.Value()
 		case "UIDNOTSTICKY":
 			c.Mailbox.UIDNotSticky = true
+		case "HIGHESTMODSEQ":
+			if len(rsp.Fields) > 1 {
+				c.Mailbox.HighestModSeq = AsNumber64(rsp.Fields[1])
+			}
+		case "NOMODSEQ":
+			c.Mailbox.HighestModSeq = 0
+		default:
+			return
 		}
+		c.mboxDirty = true
+	}
+}
+
+// vanished removes the messages reported by a VANISHED response, which is sent
+// instead of EXPUNGE when QRESYNC is enabled. The UID map is reset as soon as
+// an unknown UID is found, because the positions of the remaining messages
+// cannot be determined. The work is bounded by the number of messages in the
+// map, regardless of the size of the reported ranges.
+func (c *Client) vanished(uids *SeqSet) {
+	if n := uids.Count(); n >= uint64(c.Mailbox.Messages) {
+		c.Mailbox.Messages = 0
+	} else {
+		c.Mailbox.Messages -= uint32(n)
+	}
+	if c.Mailbox.Recent > c.Mailbox.Messages {
+		c.Mailbox.Recent = c.Mailbox.Messages
+	}
+	if c.UIDs == nil {
+		return
+	}
+	reset := false
+	uids.Ranges(func(start, stop uint32) bool {
+		for uid := start; !reset; uid++ {
+			if seq := c.UIDs.Seq(uid); seq != 0 {
+				c.UIDs.expunge(seq)
+			} else {
+				reset = true
+			}
+			if uid == stop {
+				break
+			}
+		}
+		return !reset
+	})
+	if reset {
+		c.UIDs = newUIDMap()
+		c.UIDs.exists(c.Mailbox.Messages)
 	}
 }
 
@@ -477,6 +712,7 @@ func (c *Client) deliver(rsp *Response) bool {
 			}
 		}
 		c.Data = append(c.Data, rsp)
+		c.notifyEvent(rsp)
 		return true
 	} else if rsp.Type == Done {
 		if cmd := c.cmds[rsp.Tag]; cmd != nil {
@@ -567,12 +803,16 @@ func (c *Client) setState(s ConnState) {
 	if s != Selected {
 		c.Logf(LogState, "State change: %v -> %v", prev, s)
 		c.Mailbox = nil
+		c.UIDs = nil
 		if s == Closed {
 			if c.cch != nil {
 				close(c.cch)
 			}
 			c.setCaps(nil)
 			c.deliver(abort)
+			if c.notify != nil {
+				close(c.notify)
+			}
 		}
 	} else if c.debugLog.mask&LogState != 0 {
 		mb, rw := c.Mailbox.Name, "[RW]"
@@ -581,46 +821,44 @@ func (c *Client) setState(s ConnState) {
 		}
 		c.Logf(LogState, "State change: %v -> %v (%+q %s)", prev, s, mb, rw)
 	}
+	c.publishMailbox()
+}
+
+// publishMailbox updates the copy of c.Mailbox returned by SelectedMailbox.
+func (c *Client) publishMailbox() {
+	var v *MailboxStatus
+	if c.state == Selected {
+		v = c.Mailbox.Copy()
+	}
+	c.mboxMu.Lock()
+	c.mboxView = v
+	c.mboxMu.Unlock()
+	c.mboxDirty = false
 }
 
 // setCaps updates the server capability set.
 func (c *Client) setCaps(caps []Field) {
+	prev := c.Caps.Copy()
 	for v := range c.Caps {
 		delete(c.Caps, v)
 	}
 	for _, f := range caps {
-		if v := toUpper(AsAtom(f)); v != "" {
-			c.Caps[v] = true
-		} else {
+		if v := toUpper(AsAtom(f)); v == "" {
 			c.Logln(LogState, "Invalid capability:", f)
+		} else if !c.capsMask[v] {
+			c.Caps[v] = true
 		}
 	}
 	if c.debugLog.mask&LogState != 0 {
-		caps := strings.Join(c.getCaps(""), " ")
+		caps := c.Caps.String()
 		if caps == "" {
 			caps = "(none)"
 		}
 		c.Logln(LogState, "Capabilities:", caps)
 	}
-}
-
-// getCaps returns a sorted list of capabilities that share a common prefix. The
-// prefix is stripped from the returned strings.
-func (c *Client) getCaps(prefix string) []string {
-	caps := make([]string, 0, len(c.Caps))
-	if n := len(prefix); n == 0 {
-		for v := range c.Caps {
-			caps = append(caps, v)
-		}
-	} else {
-		for v := range c.Caps {
-			if strings.HasPrefix(v, prefix) {
-				caps = append(caps, v[n:])
-			}
-		}
+	if c.capsHandler != nil && !c.Caps.equal(prev) {
+		c.capsHandler(c.Caps.Copy())
 	}
-	sort.Strings(caps)
-	return caps
 }
 
 // close closes the connection without sending any additional data or updating
@@ -5,6 +5,7 @@
 package imap
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"reflect"
@@ -847,3 +848,522 @@ func TestClientQuota(T *testing.T) {
 	t.join("GETQUOTAROOT", err)
 	t.waitEOF()
 }
+
+func TestClientMailboxEncoding(T *testing.T) {
+	//defer un(setLogMask(LogAll))
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 ENABLE UTF8=ACCEPT] Test server ready`+CRLF)
+
+	// CREATE (modified UTF-7)
+	go t.script(
+		`C: A1 CREATE "Entw&APw-rfe"`+CRLF,
+		`S: A1 OK CREATE completed`+CRLF,
+	)
+	_, err := Wait(C.Create("Entwürfe"))
+	t.join("CREATE1", err)
+
+	// LIST (modified UTF-7 pattern)
+	go t.script(
+		`C: A2 LIST "" "Entw&APw-rfe/%"`+CRLF,
+		`S: * LIST () "/" "Entw&APw-rfe/Alt"`+CRLF,
+		`S: A2 OK LIST completed`+CRLF,
+	)
+	cmd, err := Wait(C.List("", "Entwürfe/%"))
+	t.join("LIST", err)
+	if name := cmd.Data[0].MailboxInfo().Name; name != "Entwürfe/Alt" {
+		t.Errorf("MailboxInfo().Name expected %+q; got %+q", "Entwürfe/Alt", name)
+	}
+
+	// ENABLE
+	go t.script(
+		`C: A3 ENABLE UTF8=ACCEPT`+CRLF,
+		`S: * ENABLED UTF8=ACCEPT`+CRLF,
+		`S: A3 OK ENABLE completed`+CRLF,
+	)
+	_, err = C.Enable("UTF8=ACCEPT")
+	t.join("ENABLE", err)
+	if !C.Enabled["UTF8=ACCEPT"] {
+		t.Fatalf("C.Enabled expected UTF8=ACCEPT; got %v", C.Enabled)
+	}
+
+	// LIST (UTF-8 names are not decoded as modified UTF-7)
+	go t.script(
+		`C: A4 LIST "" "%"`+CRLF,
+		`S: * LIST () "/" "&Jjo-"`+CRLF,
+		`S: A4 OK LIST completed`+CRLF,
+	)
+	cmd, err = Wait(C.List("", "%"))
+	t.join("LIST", err)
+	if name := cmd.Data[0].MailboxInfo().Name; name != "&Jjo-" {
+		t.Errorf("MailboxInfo().Name expected %+q; got %+q", "&Jjo-", name)
+	}
+
+	// CREATE (UTF-8)
+	go t.script(
+		`C: A5 CREATE {9}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		`C: Entwürfe`+CRLF,
+		`S: A5 OK CREATE completed`+CRLF,
+		EOF,
+	)
+	_, err = Wait(C.Create("Entwürfe"))
+	t.join("CREATE2", err)
+	t.waitEOF()
+}
+
+func TestClientSearchCharset(T *testing.T) {
+	//defer un(setLogMask(LogAll))
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+
+	// ASCII criteria (no CHARSET)
+	go t.script(
+		`C: A1 SEARCH SUBJECT "hello"`+CRLF,
+		`S: * SEARCH 1`+CRLF,
+		`S: A1 OK SEARCH completed`+CRLF,
+	)
+	_, info, err := C.SearchCharset("SUBJECT", `"hello"`)
+	t.join("SEARCH1", err)
+	if !reflect.DeepEqual(info, &SearchCharsetInfo{}) {
+		t.Errorf("SEARCH1 unexpected info %+v", info)
+	}
+
+	// UTF-8 rejected, ISO-8859-1 accepted
+	go t.script(
+		`C: A2 SEARCH CHARSET UTF-8 SUBJECT {5}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		"C: caf\xc3\xa9"+CRLF,
+		`S: A2 NO [BADCHARSET (US-ASCII ISO-8859-1)] Unsupported charset`+CRLF,
+		`C: A3 SEARCH CHARSET ISO-8859-1 SUBJECT {4}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		"C: caf\xe9"+CRLF,
+		`S: * SEARCH 2`+CRLF,
+		`S: A3 OK SEARCH completed`+CRLF,
+	)
+	cmd, info, err := C.SearchCharset("SUBJECT", AString("café"))
+	t.join("SEARCH2", err)
+	want := &SearchCharsetInfo{
+		Charset:   "ISO-8859-1",
+		Rejected:  []string{"UTF-8"},
+		Supported: []string{"US-ASCII", "ISO-8859-1"},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("SEARCH2 expected info %+v; got %+v", want, info)
+	} else if ids := cmd.Data[0].SearchResults(); !reflect.DeepEqual(ids, []uint32{2}) {
+		t.Errorf("SEARCH2 expected results [2]; got %v", ids)
+	}
+
+	// No usable charset, criteria removed
+	go t.script(
+		`C: A4 SEARCH CHARSET UTF-8 UNSEEN SUBJECT {6}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		"C: \xe6\x97\xa5\xe6\x9c\xac"+CRLF,
+		`S: A4 NO [BADCHARSET (US-ASCII)] Unsupported charset`+CRLF,
+		`C: A5 SEARCH UNSEEN`+CRLF,
+		`S: * SEARCH 3 4`+CRLF,
+		`S: A5 OK SEARCH completed`+CRLF,
+	)
+	subj := AString("日本")
+	_, info, err = C.SearchCharset("UNSEEN", "SUBJECT", subj)
+	t.join("SEARCH3", err)
+	want = &SearchCharsetInfo{
+		Rejected:  []string{"UTF-8"},
+		Supported: []string{"US-ASCII"},
+		Unapplied: []Field{"SUBJECT", subj},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("SEARCH3 expected info %+v; got %+v", want, info)
+	}
+
+	// Criteria cannot be separated
+	go t.script(
+		`C: A6 SEARCH CHARSET UTF-8 NOT SUBJECT {6}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		"C: \xe6\x97\xa5\xe6\x9c\xac"+CRLF,
+		`S: A6 NO [BADCHARSET] Unsupported charset`+CRLF,
+		EOF,
+	)
+	_, _, err = C.SearchCharset("NOT", "SUBJECT", subj)
+	if _, ok := err.(ResponseError); !ok {
+		t.Errorf("SEARCH4 expected ResponseError; got %v", err)
+	}
+	t.join("SEARCH4", nil)
+	t.waitEOF()
+}
+
+func TestClientCharsetEncoder(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.CharsetEncoder = func(charset string, b []byte) ([]byte, error) {
+		if charset != "x-test" {
+			return nil, NotAvailableError(charset)
+		}
+		return []byte(strings.ToUpper(string(b))), nil
+	}
+
+	go t.script(
+		`C: A1 SEARCH CHARSET UTF-8 SUBJECT {5}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		"C: caf\xc3\xa9"+CRLF,
+		`S: A1 NO [BADCHARSET (X-TEST)] Unsupported charset`+CRLF,
+		"C: A2 SEARCH CHARSET X-TEST SUBJECT {5}"+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		"C: CAF\xc3\x89"+CRLF,
+		`S: A2 OK SEARCH completed`+CRLF,
+	)
+	_, info, err := C.SearchCharset("SUBJECT", AString("café"))
+	t.join("SEARCH", err)
+	if info.Charset != "X-TEST" {
+		t.Errorf("SearchCharset() expected X-TEST; got %+v", info)
+	}
+}
+
+func TestClientSearchDates(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+
+	go t.script(
+		`C: A1 SEARCH SINCE 1-Feb-1994 NOT (BEFORE 7-Feb-1994)`+CRLF,
+		`S: * SEARCH`+CRLF,
+		`S: A1 OK SEARCH completed`+CRLF,
+	)
+	d1 := time.Date(1994, time.February, 1, 12, 0, 0, 0, time.UTC)
+	_, err := Wait(C.Search("SINCE", d1, "NOT", []Field{"BEFORE", d1.AddDate(0, 0, 6)}))
+	t.join("SEARCH-DATE", err)
+}
+
+func TestClientSearchCriteria(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+
+	go t.script(
+		`C: A1 SEARCH OR FROM "a@example.com" (FLAGGED SINCE 1-Feb-1994) LARGER 100`+CRLF,
+		`S: * SEARCH 5`+CRLF,
+		`S: A1 OK SEARCH completed`+CRLF,
+	)
+	d1 := time.Date(1994, time.February, 1, 12, 0, 0, 0, time.UTC)
+	sc := new(SearchCriteria).Or(
+		new(SearchCriteria).From("a@example.com"),
+		new(SearchCriteria).Flagged().Since(d1),
+	)
+	_, err := Wait(C.Search(sc, "LARGER", 100))
+	t.join("SEARCH-CRITERIA", err)
+}
+
+func TestClientSearchTo(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 ESEARCH] Test server ready`+CRLF)
+	C.setState(Selected)
+
+	var got [][2]uint32
+	f := func(start, stop uint32) { got = append(got, [2]uint32{start, stop}) }
+	go t.script(
+		`C: A1 SEARCH UNSEEN`+CRLF,
+		`S: * SEARCH 2 5 7`+CRLF,
+		`S: A1 OK SEARCH completed`+CRLF,
+	)
+	cmd, err := C.SearchTo(f, "UNSEEN")
+	t.join("SEARCH", err)
+	if len(cmd.Data) != 1 || len(cmd.Data[0].SearchResults()) != 0 {
+		t.Errorf("SearchTo() expected a SEARCH response without numbers; got %v", cmd.Data)
+	}
+
+	go t.script(
+		`C: A2 UID SEARCH RETURN (ALL COUNT) UNSEEN`+CRLF,
+		`S: * ESEARCH (TAG "A2") UID ALL 4,9:12 COUNT 5`+CRLF,
+		`S: A2 OK SEARCH completed`+CRLF,
+	)
+	_, err = C.UIDSearchTo(f, "RETURN", []Field{"ALL", "COUNT"}, "UNSEEN")
+	t.join("UID SEARCH", err)
+
+	want := [][2]uint32{{2, 2}, {5, 5}, {7, 7}, {4, 4}, {9, 12}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchTo() expected %v; got %v", want, got)
+	}
+	if rsp := C.Data[len(C.Data)-1]; rsp.Label != "ESEARCH" || len(rsp.Fields) != 5 {
+		t.Errorf("UIDSearchTo() expected ESEARCH without ALL; got %v", rsp.Fields)
+	}
+	if C.searchDest != nil {
+		t.Errorf("SearchTo() did not remove the destination")
+	}
+
+	// A pending time-limited receive is completed before the SEARCH is sent
+	if err = C.Recv(0); err != ErrTimeout {
+		t.Fatalf("Recv(0) expected ErrTimeout; got %v", err)
+	}
+	go t.script(
+		`C: A3 NOOP`+CRLF,
+		`S: A3 OK NOOP completed`+CRLF,
+		`C: A4 SEARCH ALL`+CRLF,
+		`S: * SEARCH 3`+CRLF,
+		`S: A4 OK SEARCH completed`+CRLF,
+	)
+	got = nil
+	_, err = C.SearchTo(f, "ALL")
+	t.join("SEARCH", err)
+	if want := [][2]uint32{{3, 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SearchTo() expected %v; got %v", want, got)
+	}
+
+	// Other SEARCH commands cannot be in progress
+	go t.script(
+		`C: A5 SEARCH ALL`+CRLF,
+		`S: A5 OK SEARCH completed`+CRLF,
+	)
+	cmd, err = C.Search("ALL")
+	if err == nil {
+		if _, err = C.SearchTo(f, "ALL"); err != ErrSearchInProgress {
+			t.Errorf("SearchTo() expected ErrSearchInProgress; got %v", err)
+		}
+		_, err = cmd.Result(OK)
+	}
+	t.join("SEARCH", err)
+}
+
+func TestClientHandlers(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+
+	var exists []uint32
+	var all []string
+	C.SetHandler("exists", func(rsp *Response) {
+		exists = append(exists, C.Mailbox.Messages)
+	})
+	C.SetHandler("*", func(rsp *Response) { all = append(all, rsp.Label) })
+	prev := C.SetHandler("X-CUSTOM", func(rsp *Response) {})
+	if prev != nil {
+		t.Errorf("SetHandler() expected nil previous handler")
+	}
+	if C.SetHandler("X-CUSTOM", nil) == nil {
+		t.Errorf("SetHandler() expected previous handler")
+	}
+
+	go t.script(
+		`C: A1 FETCH 1:* (FLAGS)`+CRLF,
+		`S: * 1 FETCH (FLAGS (\Seen))`+CRLF,
+		`S: * 5 EXISTS`+CRLF,
+		`S: * X-CUSTOM data`+CRLF,
+		`S: * 6 EXISTS`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+	)
+	seq, _ := NewSeqSet("1:*")
+	cmd, err := Wait(C.Fetch(seq, "FLAGS"))
+	t.join("FETCH", err)
+	if len(cmd.Data) != 1 || len(C.Data) != 4 { // Greeting + 3
+		t.Errorf("responses not delivered; len(cmd.Data) = %d, len(C.Data) = %d", len(cmd.Data), len(C.Data))
+	}
+	if want := []uint32{5, 6}; !reflect.DeepEqual(exists, want) {
+		t.Errorf("EXISTS handler expected %v; got %v", want, exists)
+	}
+	if want := []string{"FETCH", "EXISTS", "X-CUSTOM", "EXISTS"}; !reflect.DeepEqual(all, want) {
+		t.Errorf("* handler expected %v; got %v", want, all)
+	}
+}
+
+func TestClientSelectedMailbox(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	if mbox := C.SelectedMailbox(); mbox != nil {
+		t.Errorf("SelectedMailbox() expected nil; got %v", mbox)
+	}
+
+	go t.script(
+		`C: A1 SELECT "INBOX"`+CRLF,
+		`S: * FLAGS (\Answered \Seen)`+CRLF,
+		`S: * 2 EXISTS`+CRLF,
+		`S: * 1 RECENT`+CRLF,
+		`S: * OK [PERMANENTFLAGS (\Seen \*)] Limited`+CRLF,
+		`S: * OK [UIDNEXT 10] Predicted next UID`+CRLF,
+		`S: A1 OK [READ-WRITE] SELECT completed`+CRLF,
+	)
+	_, err := C.Select("INBOX", false)
+	t.join("SELECT", err)
+
+	mbox := C.SelectedMailbox()
+	if mbox == nil || mbox == C.Mailbox {
+		t.Fatalf("SelectedMailbox() expected a copy of C.Mailbox; got %v", mbox)
+	}
+	want := &MailboxStatus{
+		Name:      "INBOX",
+		ReadOnly:  false,
+		Flags:     NewFlagSet(`\Answered`, `\Seen`),
+		PermFlags: NewFlagSet(`\Seen`, `\*`),
+		Messages:  2,
+		Recent:    1,
+		UIDNext:   10,
+	}
+	if !reflect.DeepEqual(mbox, want) {
+		t.Errorf("SelectedMailbox() expected\n%#v; got\n%#v", want, mbox)
+	}
+	mbox.Flags[`\Deleted`] = true
+	if C.Mailbox.Flags[`\Deleted`] {
+		t.Errorf("SelectedMailbox() did not copy Flags")
+	}
+
+	go t.script(
+		`C: A2 NOOP`+CRLF,
+		`S: * 3 EXISTS`+CRLF,
+		`S: * 3 FETCH (UID 12 FLAGS (\Recent))`+CRLF,
+		`S: A2 OK NOOP completed`+CRLF,
+	)
+	_, err = Wait(C.Noop())
+	t.join("NOOP", err)
+
+	if mbox = C.SelectedMailbox(); mbox.Messages != 3 || mbox.UIDNext != 13 {
+		t.Errorf("SelectedMailbox() expected Messages=3 UIDNext=13; got %v", mbox)
+	}
+
+	// Responses that do not change C.Mailbox must not replace the copy
+	view := C.mboxView
+	go t.script(
+		`C: A3 NOOP`+CRLF,
+		`S: * 1 FETCH (FLAGS (\Seen))`+CRLF,
+		`S: * 2 FETCH (UID 11 FLAGS (\Seen))`+CRLF,
+		`S: * 3 FETCH (UID 4294967295 FLAGS (\Seen))`+CRLF,
+		`S: A3 OK NOOP completed`+CRLF,
+	)
+	_, err = Wait(C.Noop())
+	t.join("NOOP", err)
+
+	if C.mboxView != view {
+		t.Errorf("SelectedMailbox() copy replaced by FETCH responses")
+	}
+	if C.Mailbox.UIDNext != 13 {
+		t.Errorf("UIDNext expected 13 after the maximum UID; got %d", C.Mailbox.UIDNext)
+	}
+
+	go t.script(
+		`C: A4 CLOSE`+CRLF,
+		`S: A4 OK CLOSE completed`+CRLF,
+	)
+	_, err = C.Close(true)
+	t.join("CLOSE", err)
+
+	if mbox = C.SelectedMailbox(); mbox != nil {
+		t.Errorf("SelectedMailbox() expected nil after CLOSE; got %v", mbox)
+	}
+}
+
+func TestClientAppendReader(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+
+	go t.script(
+		`C: A1 APPEND "INBOX" {5}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		`C: hello`+CRLF,
+		`S: A1 OK APPEND completed`+CRLF,
+	)
+	_, err := Wait(C.AppendReader("INBOX", nil, nil, io.MultiReader(strings.NewReader("hello world")), 5))
+	t.join("APPEND", err)
+
+	C.setCaps([]Field{"IMAP4rev1", "LITERAL+"})
+	r := strings.NewReader("skip:message")
+	r.Seek(5, io.SeekStart)
+	go t.script(
+		`C: A2 APPEND "INBOX" (\Seen) {7+}`+CRLF,
+		`C: message`+CRLF,
+		`S: A2 OK APPEND completed`+CRLF,
+	)
+	_, err = Wait(C.AppendReader("INBOX", NewFlagSet(`\Seen`), nil, r, -1))
+	t.join("APPEND", err)
+
+	if _, err = C.AppendReader("INBOX", nil, nil, io.MultiReader(r), -1); err != ErrLiteralSize {
+		t.Errorf("AppendReader() expected ErrLiteralSize; got %v", err)
+	}
+}
+
+func TestClientAppendContext(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 LITERAL+] Test server ready`+CRLF)
+	msg := strings.Repeat("a", LiteralChunkSize+100)
+
+	var prog []int64
+	go t.script(
+		`C: A1 APPEND "INBOX" {32868+}`+CRLF,
+		`C: `+msg+CRLF,
+		`S: A1 OK APPEND completed`+CRLF,
+	)
+	_, err := C.AppendContext(context.Background(), "INBOX", nil, nil,
+		NewLiteral([]byte(msg)), func(n, total int64) {
+			if total != int64(len(msg)) {
+				t.Errorf("progress() expected total %d; got %d", len(msg), total)
+			}
+			prog = append(prog, n)
+		})
+	t.join("APPEND", err)
+	if want := []int64{int64(LiteralChunkSize), int64(LiteralChunkSize) + 100}; !reflect.DeepEqual(prog, want) {
+		t.Errorf("progress() expected %v; got %v", want, prog)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go t.script(
+		`C: A2 APPEND "INBOX" {32868+}`+CRLF,
+		`C: `+msg[:LiteralChunkSize]+strings.Repeat(" ", 100)+appendAbort+CRLF,
+		`S: A2 BAD Syntax error`+CRLF,
+	)
+	_, err = C.AppendContext(ctx, "INBOX", nil, nil,
+		NewLiteral([]byte(msg)), func(n, total int64) { cancel() })
+	t.join("APPEND", nil)
+	if err != context.Canceled {
+		t.Errorf("AppendContext() expected context.Canceled; got %v", err)
+	}
+
+	go t.script(
+		`C: A3 NOOP`+CRLF,
+		`S: A3 OK NOOP completed`+CRLF,
+	)
+	_, err = Wait(C.Noop())
+	t.join("NOOP", err)
+
+	if _, err = C.AppendContext(ctx, "INBOX", nil, nil, NewLiteral(nil), nil); err != context.Canceled {
+		t.Errorf("AppendContext() expected context.Canceled; got %v", err)
+	}
+}
+
+func TestClientCoalesceWrites(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	cc := &countConn{testConn: C.t.conn.(*testConn)}
+	C.t.bufLink.Writer = cc
+	C.CoalesceWrites = true
+
+	var cmds []*Command
+	var script []string
+	for i := 1; i <= 10; i++ {
+		cmd, err := C.Noop()
+		if err != nil {
+			t.Fatalf("C.Noop() unexpected error; %v", err)
+		}
+		cmds = append(cmds, cmd)
+		script = append(script, fmt.Sprintf("C: A%d NOOP", i)+CRLF)
+	}
+	if cc.writes != 0 {
+		t.Fatalf("C.Noop() expected no writes; got %d", cc.writes)
+	}
+	for i := 1; i <= 10; i++ {
+		script = append(script, fmt.Sprintf("S: A%d OK NOOP completed", i)+CRLF)
+	}
+	go t.script(script...)
+	for _, cmd := range cmds {
+		if _, err := cmd.Result(OK); err != nil {
+			t.Fatalf("cmd.Result(OK) unexpected error; %v", err)
+		}
+	}
+	t.join("NOOP", nil)
+	if cc.writes != 1 {
+		t.Errorf("CoalesceWrites expected 1 write; got %d", cc.writes)
+	}
+
+	// Explicit flush
+	go t.script(
+		`C: A11 NOOP`+CRLF,
+		`S: A11 OK NOOP completed`+CRLF,
+	)
+	cmd, err := C.Noop()
+	if err == nil {
+		err = C.Flush()
+	}
+	t.join("Flush", err)
+	if cc.writes != 2 {
+		t.Errorf("Flush() expected 2 writes; got %d", cc.writes)
+	}
+	if _, err = cmd.Result(OK); err != nil {
+		t.Errorf("cmd.Result(OK) unexpected error; %v", err)
+	}
+}
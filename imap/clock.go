@@ -0,0 +1,59 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "time"
+
+// Clock is the source of the current time and timers for all timer-driven
+// behavior of a Client: receive timeouts, IDLE renewal and polling in Watcher,
+// retry delays in ChunkedFetch, and the FetchBatcher window. Tests can replace
+// it with a fake clock (see mock.Clock) to fast-forward time instead of
+// sleeping. Network deadlines are set on the connection and always use the
+// system clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives the current time once d has
+	// elapsed.
+	After(d time.Duration) <-chan time.Time
+
+	// Sleep blocks until d has elapsed.
+	Sleep(d time.Duration)
+
+	// AfterFunc calls f in its own goroutine once d has elapsed. The returned
+	// Timer can be used to cancel the call.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending function call created by Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the function from being called. It returns false if the
+	// function has already been called or the timer was stopped.
+	Stop() bool
+}
+
+// SystemClock is the Clock used by a Client that does not specify its own. It
+// is implemented by the time package.
+var SystemClock Clock = systemClock{}
+
+// systemClock implements Clock with the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// clock returns c.Clock or SystemClock if c.Clock is nil.
+func (c *Client) clock() Clock {
+	if c.Clock != nil {
+		return c.Clock
+	}
+	return SystemClock
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -106,10 +107,13 @@ func (cmd *Command) InProgress() bool {
 // completion status is other than expected. ErrAborted is returned if the
 // command execution was interrupted prior to receiving a completion response.
 func (cmd *Command) Result(expect RespStatus) (rsp *Response, err error) {
-	for cmd.result == nil {
-		if err = cmd.client.Recv(block); err != nil {
-			return
-		}
+	if cmd.client.ProfileLabels && cmd.result == nil {
+		cmd.profile(func() { err = cmd.wait() })
+	} else {
+		err = cmd.wait()
+	}
+	if err != nil {
+		return
 	}
 	if rsp = cmd.result; rsp == abort {
 		rsp, err = nil, ErrAborted
@@ -119,6 +123,14 @@ func (cmd *Command) Result(expect RespStatus) (rsp *Response, err error) {
 	return
 }
 
+// wait receives responses until the command is completed.
+func (cmd *Command) wait() (err error) {
+	for cmd.result == nil && err == nil {
+		err = cmd.client.Recv(block)
+	}
+	return
+}
+
 // String returns the raw command text without CRLFs or literal data.
 func (cmd *Command) String() string {
 	return cmd.raw
@@ -172,13 +184,30 @@ func (raw *rawCommand) WriteFields(fields []Field, SP bool) error {
 		}
 		switch v := f.(type) {
 		case string:
+			if strings.ContainsAny(v, "\x00\r\n") {
+				return fmt.Errorf("imap: invalid command field %q (use AString)", v)
+			}
 			raw.WriteString(v)
+		case badArg:
+			return fmt.Errorf("imap: invalid %s %q", v.kind, v.value)
+		case Flag:
+			if !v.valid() {
+				return fmt.Errorf("imap: invalid flag %q", v)
+			}
+			raw.WriteString(string(v))
+		case FlagSet:
+			for f := range v {
+				if !f.valid() {
+					return fmt.Errorf("imap: invalid flag %q", f)
+				}
+			}
+			raw.WriteString(v.String())
 		case int, int8, int16, int32, int64:
 			raw.WriteString(strconv.FormatInt(intValue(f), 10))
 		case uint, uint8, uint16, uint32, uint64:
 			raw.WriteString(strconv.FormatUint(uintValue(f), 10))
 		case time.Time:
-			raw.WriteString(v.Format(DATETIME))
+			raw.WriteString(FormatDateTime(v))
 		case []Field:
 			raw.WriteByte('(')
 			if err := raw.WriteFields(v, false); err != nil {
@@ -202,6 +231,8 @@ func (raw *rawCommand) WriteFields(fields []Field, SP bool) error {
 			}
 			raw.WriteString("}\r\n")
 			raw.literals = append(raw.literals, v)
+		case *SeqSet:
+			v.writeTo(raw.Buffer)
 		case fmt.Stringer:
 			raw.WriteString(v.String())
 		case nil:
@@ -244,11 +275,14 @@ func ByeFilter(_ *Command, rsp *Response) bool {
 // FetchFilter accepts FETCH and STORE command responses by matching message
 // sequence numbers or UIDs, depending on the command type. UID matches are more
 // exact because there is no risk of mistaking unilateral server data (e.g. an
-// unsolicited flags update) for command data.
+// unsolicited flags update) for command data. VANISHED (EARLIER) responses,
+// which are only sent for UID FETCH commands with the VANISHED modifier (RFC
+// 7162), are also accepted by UID commands.
 func FetchFilter(cmd *Command, rsp *Response) bool {
 	msg := rsp.MessageInfo()
 	if msg == nil {
-		return false // Not a FETCH response
+		_, earlier := rsp.Vanished()
+		return earlier && cmd.uid // Not a FETCH response
 	} else if cmd.seqset == nil {
 		return true // Accept all FETCH responses if SeqSet wasn't used
 	}
@@ -285,7 +319,7 @@ func LabelFilter(labels ...string) ResponseFilter {
 var SelectFilter = LabelFilter(
 	"FLAGS", "EXISTS", "RECENT",
 	"UNSEEN", "PERMANENTFLAGS", "UIDNEXT", "UIDVALIDITY",
-	"UIDNOTSTICKY",
+	"UIDNOTSTICKY", "HIGHESTMODSEQ", "NOMODSEQ",
 )
 
 // CommandConfig specifies command execution parameters.
@@ -363,5 +397,23 @@ func defaultCommands() map[string]*CommandConfig {
 
 		// RFC 5161
 		"ENABLE": &CommandConfig{States: all, Filter: LabelFilter("ENABLED")},
+
+		// RFC 5256
+		"THREAD":     &CommandConfig{States: sel, Filter: NameFilter},
+		"UID THREAD": &CommandConfig{States: sel, Filter: NameFilter},
+
+		// RFC 5465
+		"NOTIFY": &CommandConfig{States: auth},
+
+		// RFC 6851
+		"MOVE":     &CommandConfig{States: sel, Filter: LabelFilter("COPYUID")},
+		"UID MOVE": &CommandConfig{States: sel, Filter: LabelFilter("COPYUID")},
+
+		// RFC 8508
+		"REPLACE":     &CommandConfig{States: sel, Filter: LabelFilter("APPENDUID")},
+		"UID REPLACE": &CommandConfig{States: sel, Filter: LabelFilter("APPENDUID")},
+
+		// Gmail and others (deprecated by RFC 6154)
+		"XLIST": &CommandConfig{States: auth, Filter: NameFilter},
 	}
 }
@@ -103,3 +103,26 @@ func TestCommand(t *testing.T) {
 		}
 	}
 }
+
+func TestCommandInvalidFields(t *testing.T) {
+	tests := [][]Field{
+		{"INBOX\r\nA002 DELETE INBOX"},
+		{"a\x00b"},
+		{Flag(`\Seen) (\Deleted`)},
+		{Flag(`\*`)},
+		{Flag("")},
+		{NewFlagSet(`\Seen`, "bad flag")},
+		{encodeString("a\x00b", false)},
+	}
+	c := &Client{
+		Caps:          make(map[string]bool),
+		CommandConfig: defaultCommands(),
+		debugLog:      newDebugLog(nil, LogNone),
+	}
+	for _, fields := range tests {
+		cmd := newCommand(c, "STORE")
+		if _, err := cmd.build("A001", fields); err == nil {
+			t.Errorf("build(%q) expected error", fields)
+		}
+	}
+}
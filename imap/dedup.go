@@ -0,0 +1,108 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DuplicateGroup is a set of messages that are considered to be copies of the
+// same message.
+type DuplicateGroup struct {
+	Key  string  // Message-ID or "sha256:<digest>" of the header
+	Keep uint32  // UID of the message to keep (the lowest one)
+	Dups *SeqSet // UIDs of the other copies, which may be deleted
+}
+
+// dupDigestFields are the header fields that identify a message without a
+// Message-ID. Trace fields, such as Received, are excluded because they differ
+// between copies of a message that was delivered more than once.
+var dupDigestFields = []string{"From", "To", "Cc", "Subject", "Date"}
+
+// FindDuplicates finds duplicate messages among the specified UIDs in the
+// selected mailbox (all messages if uids is nil). Messages are matched by their
+// Message-ID header. Messages without one are matched by a SHA-256 digest of
+// their From, To, Cc, Subject, and Date header fields, which are only fetched
+// for those messages. Messages with neither are ignored. If matchSize or
+// matchDate is true, the copies must also have the same RFC822.SIZE or
+// INTERNALDATE, respectively. Only groups with more than one message are
+// returned, sorted by the UID to keep. The messages are not modified; pass the
+// Dups sets to DeleteMessages to remove them. UIDs are used regardless of
+// s.UID.
+func (s *Session) FindDuplicates(uids *SeqSet, matchSize, matchDate bool) ([]*DuplicateGroup, error) {
+	c := s.Client
+	if c.Mailbox == nil {
+		return nil, ErrNotAllowed
+	} else if uids == nil {
+		uids, _ = NewSeqSet("1:*")
+	}
+	spec := HeaderSection("Message-ID")
+	items := []string{"UID", spec.String()}
+	if matchSize {
+		items = append(items, "RFC822.SIZE")
+	}
+	if matchDate {
+		items = append(items, "INTERNALDATE")
+	}
+	cmd, err := Wait(c.UIDFetch(uids, items...))
+	if err != nil {
+		return nil, err
+	}
+	msgs := cmd.MessagesByUID()
+	keys := make(map[uint32]string, len(msgs))
+	noID := new(SeqSet)
+	for uid, msg := range msgs {
+		if ids := ParseMessageIDs(AsHeader(spec.Value(msg)).Get("Message-ID")); len(ids) > 0 {
+			keys[uid] = "<" + ids[0] + ">"
+		} else {
+			noID.AddNum(uid)
+		}
+	}
+	if !noID.Empty() {
+		hdrs, err := s.FetchHeaders(noID, dupDigestFields...)
+		if err != nil {
+			return nil, err
+		}
+		noID.Nums(func(uid uint32) bool {
+			if hdrs[uid] == nil {
+				return true
+			}
+			h := sha256.New()
+			for _, name := range dupDigestFields {
+				h.Write([]byte(name + ":"))
+				for _, v := range hdrs[uid][name] {
+					h.Write([]byte(strings.Join(strings.Fields(v), " ") + "\n"))
+				}
+			}
+			keys[uid] = "sha256:" + hex.EncodeToString(h.Sum(nil))
+			return true
+		})
+	}
+	groups := make(map[string][]uint32)
+	for uid, key := range keys {
+		msg := msgs[uid]
+		if matchSize {
+			key += "\x00" + strconv.FormatUint(uint64(msg.Size), 10)
+		}
+		if matchDate {
+			key += "\x00" + strconv.FormatInt(msg.InternalDate.Unix(), 10)
+		}
+		groups[key] = append(groups[key], uid)
+	}
+	var dups []*DuplicateGroup
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		sort.Slice(g, func(i, j int) bool { return g[i] < g[j] })
+		dups = append(dups, &DuplicateGroup{keys[g[0]], g[0], NewSeqSetNums(g[1:])})
+	}
+	sort.Slice(dups, func(i, j int) bool { return dups[i].Keep < dups[j].Keep })
+	return dups, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSessionFindDuplicates(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 UID FETCH 1:* (UID BODY.PEEK[HEADER.FIELDS (Message-ID)] RFC822.SIZE)`+CRLF,
+		`S: * 1 FETCH (UID 1 RFC822.SIZE 100 BODY[HEADER.FIELDS (MESSAGE-ID)] {31}`+CRLF,
+		`S: Message-ID: <a@example.com>`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 2 FETCH (UID 2 RFC822.SIZE 100 BODY[HEADER.FIELDS (MESSAGE-ID)] {31}`+CRLF,
+		`S: Message-ID: <b@example.com>`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 3 FETCH (UID 3 RFC822.SIZE 100 BODY[HEADER.FIELDS (MESSAGE-ID)] {33}`+CRLF,
+		`S: Message-ID: < a@example.com >`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 4 FETCH (UID 4 RFC822.SIZE 50 BODY[HEADER.FIELDS (MESSAGE-ID)] {2}`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 5 FETCH (UID 5 RFC822.SIZE 50 BODY[HEADER.FIELDS (MESSAGE-ID)] {2}`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 6 FETCH (UID 6 RFC822.SIZE 50 BODY[HEADER.FIELDS (MESSAGE-ID)] {2}`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 7 FETCH (UID 7 RFC822.SIZE 200 BODY[HEADER.FIELDS (MESSAGE-ID)] {31}`+CRLF,
+		`S: Message-ID: <b@example.com>`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID FETCH 4:6 (BODY.PEEK[HEADER.FIELDS (From To Cc Subject Date)])`+CRLF,
+		`S: * 4 FETCH (UID 4 BODY[HEADER.FIELDS (FROM TO CC SUBJECT DATE)] {36}`+CRLF,
+		`S: From: x@example.com`+CRLF,
+		`S: Subject: Hi`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 5 FETCH (UID 5 BODY[HEADER.FIELDS (FROM TO CC SUBJECT DATE)] {37}`+CRLF,
+		`S: From: x@example.com`+CRLF,
+		`S: Subject:  Hi`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 6 FETCH (UID 6 BODY[HEADER.FIELDS (FROM TO CC SUBJECT DATE)] {2}`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+	)
+	dups, err := S.FindDuplicates(nil, true, false)
+	t.join("FETCH", err)
+	if len(dups) != 2 {
+		t.Fatalf("FindDuplicates() expected 2 groups; got %d", len(dups))
+	}
+	if d := dups[0]; d.Key != "<a@example.com>" || d.Keep != 1 || d.Dups.String() != "3" {
+		t.Errorf("FindDuplicates() unexpected group %+v", d)
+	}
+	if d := dups[1]; !strings.HasPrefix(d.Key, "sha256:") || d.Keep != 4 || d.Dups.String() != "5" {
+		t.Errorf("FindDuplicates() unexpected group %+v", d)
+	}
+}
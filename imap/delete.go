@@ -0,0 +1,85 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "errors"
+
+// DeletePolicy specifies how Session.DeleteMessages removes messages.
+type DeletePolicy uint8
+
+// Message deletion policies. DeleteTrash|DeleteExpunge moves messages to the
+// Trash mailbox, unless they are already in Trash or there is no Trash
+// mailbox, in which case they are expunged. This is the behavior of most
+// desktop clients.
+const (
+	DeleteTrash   = DeletePolicy(1 << iota) // Move messages to the Trash mailbox
+	DeleteExpunge                           // Mark messages as deleted and expunge them
+	DeleteDefault = DeleteTrash | DeleteExpunge
+)
+
+var deletePolicies = []enumName{
+	{uint32(DeleteTrash), "DeleteTrash"},
+	{uint32(DeleteExpunge), "DeleteExpunge"},
+}
+
+func (v DeletePolicy) String() string   { return enumString(uint32(v), deletePolicies, false) }
+func (v DeletePolicy) GoString() string { return enumString(uint32(v), deletePolicies, true) }
+
+// ErrNoTrash is returned by Session.DeleteMessages if the DeleteTrash policy is
+// used without DeleteExpunge and the Trash mailbox cannot be found.
+var ErrNoTrash = errors.New("imap: trash mailbox not found")
+
+// DeleteMessages removes the messages with the specified UIDs from the selected
+// mailbox according to policy. UIDs are used regardless of s.UID. The Trash
+// mailbox is taken from s.Trash or, if that is empty, detected with LIST and
+// ResolveSpecialUse and saved in s.Trash. Messages are moved to Trash with
+// MoveMessages. Otherwise, they are marked as deleted and expunged with UID
+// EXPUNGE. Servers without UIDPLUS cannot expunge individual messages, so the
+// messages are only marked as deleted and will be removed by the next EXPUNGE
+// or CLOSE. Deleting messages from the Trash mailbox with the DeleteTrash
+// policy alone does nothing.
+func (s *Session) DeleteMessages(uids *SeqSet, policy DeletePolicy) error {
+	c := s.Client
+	if c.Mailbox == nil {
+		return ErrNotAllowed
+	}
+	if policy&DeleteTrash != 0 {
+		trash, err := s.findTrash()
+		if err != nil {
+			return err
+		} else if trash != "" && trash != c.Mailbox.Name {
+			_, _, err = s.MoveMessages(uids, trash)
+			return err
+		} else if policy&DeleteExpunge == 0 {
+			if trash == "" {
+				return ErrNoTrash
+			}
+			return nil
+		}
+	}
+	us := &Session{Client: c, UID: true}
+	if _, err := us.Store(&StoreRequest{uids, StoreAdd, []Flag{FlagDeleted}, true}); err != nil {
+		return err
+	} else if c.Caps["UIDPLUS"] {
+		_, err = us.ExpungeUIDs(uids)
+		return err
+	}
+	return nil
+}
+
+// findTrash returns the name of the Trash mailbox or "" if the server does not
+// have one.
+func (s *Session) findTrash() (string, error) {
+	if s.Trash == "" {
+		list, err := s.List("", "*")
+		if err != nil {
+			return "", err
+		}
+		if m, ok := ResolveSpecialUse(list)[AttrTrash]; ok {
+			s.Trash = m.Mailbox.Name
+		}
+	}
+	return s.Trash, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "testing"
+
+func TestSessionDeleteMessages(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 MOVE UIDPLUS] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	// Move to detected Trash
+	go t.script(
+		`C: A1 LIST "" "*"`+CRLF,
+		`S: * LIST (\HasNoChildren) "/" INBOX`+CRLF,
+		`S: * LIST (\HasNoChildren) "/" "Deleted Items"`+CRLF,
+		`S: A1 OK LIST completed`+CRLF,
+		`C: A2 UID MOVE 3 "Deleted Items"`+CRLF,
+		`S: * 1 EXPUNGE`+CRLF,
+		`S: A2 OK MOVE completed`+CRLF,
+	)
+	t.join("DELETE", S.DeleteMessages(newSeqSet("3"), DeleteDefault))
+	if S.Trash != "Deleted Items" {
+		t.Errorf("DeleteMessages() expected Trash %q; got %q", "Deleted Items", S.Trash)
+	}
+
+	// Expunge only
+	go t.script(
+		`C: A3 UID STORE 4 +FLAGS.SILENT (\Deleted)`+CRLF,
+		`S: A3 OK STORE completed`+CRLF,
+		`C: A4 UID EXPUNGE 4`+CRLF,
+		`S: * 1 EXPUNGE`+CRLF,
+		`S: A4 OK EXPUNGE completed`+CRLF,
+	)
+	t.join("DELETE", S.DeleteMessages(newSeqSet("4"), DeleteExpunge))
+
+	// Already in Trash
+	C.Mailbox = newMailboxStatus("Deleted Items")
+	go t.script(
+		`C: A5 UID STORE 5 +FLAGS.SILENT (\Deleted)`+CRLF,
+		`S: A5 OK STORE completed`+CRLF,
+		`C: A6 UID EXPUNGE 5`+CRLF,
+		`S: A6 OK EXPUNGE completed`+CRLF,
+	)
+	t.join("DELETE", S.DeleteMessages(newSeqSet("5"), DeleteDefault))
+	if err := S.DeleteMessages(newSeqSet("5"), DeleteTrash); err != nil {
+		t.Errorf("DeleteMessages() unexpected error; %v", err)
+	}
+
+	// No Trash mailbox
+	C.Mailbox = newMailboxStatus("INBOX")
+	S.Trash = ""
+	go t.script(
+		`C: A7 LIST "" "*"`+CRLF,
+		`S: * LIST () "/" INBOX`+CRLF,
+		`S: A7 OK LIST completed`+CRLF,
+	)
+	err := S.DeleteMessages(newSeqSet("6"), DeleteTrash)
+	t.join("DELETE", nil)
+	if err != ErrNoTrash {
+		t.Errorf("DeleteMessages() expected ErrNoTrash; got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "strconv"
+
+// SyncState is the mailbox state that an offline client saves after each
+// SyncMailbox call and passes to the next one.
+type SyncState struct {
+	UIDValidity   uint32  // UIDVALIDITY of the mailbox
+	HighestModSeq uint64  // HIGHESTMODSEQ as of the last sync (0 = unknown)
+	UIDs          *SeqSet // UIDs of the messages known to the client
+}
+
+// SyncResult contains the changes found by SyncMailbox.
+type SyncResult struct {
+	State   *SyncState     // New state to save for the next sync
+	Reset   bool           // UIDVALIDITY changed, all known messages are invalid
+	Added   []*MessageInfo // Messages that were not known to the client
+	Changed []*MessageInfo // Known messages that were modified
+	Removed *SeqSet        // UIDs of known messages that no longer exist
+}
+
+// SyncMailbox selects a mailbox and determines which messages were added,
+// changed, and removed since the state was saved. The UID, FLAGS, and the
+// specified data items are fetched for the added and changed messages. A nil
+// state performs the initial sync, which returns all messages as added.
+//
+// The number of messages that are transferred depends on the server. With
+// QRESYNC (RFC 7162), which is enabled automatically if the client is in the
+// Authenticated state, a single UID FETCH command with the CHANGEDSINCE and
+// VANISHED modifiers returns all changes, and nothing is fetched if the
+// HIGHESTMODSEQ did not change. With CONDSTORE, which is enabled by the SELECT
+// command, only the changed messages are fetched, and the removed messages are
+// found with a UID SEARCH command.
+// Otherwise, UID and FLAGS are fetched for all messages. If the UIDVALIDITY
+// changed, Reset is set, all known UIDs are reported as removed, and all
+// messages are fetched again.
+func (s *Session) SyncMailbox(mbox string, state *SyncState, items ...string) (*SyncResult, error) {
+	c := s.Client
+	if c.Caps["QRESYNC"] && !c.Enabled["QRESYNC"] && c.State() == Auth {
+		if _, err := c.Enable("QRESYNC"); err != nil {
+			return nil, err
+		}
+	}
+	var params []Field
+	if c.Caps["CONDSTORE"] && !c.Enabled["CONDSTORE"] && !c.Enabled["QRESYNC"] {
+		params = append(params, "CONDSTORE")
+	}
+	sel, err := Wait(c.doSelect(mbox, false, params...))
+	if err == nil {
+		_, err = sel.Result(OK)
+	}
+	if err != nil {
+		return nil, err
+	}
+	mb := c.Mailbox
+
+	known, modseq := new(SeqSet), uint64(0)
+	res := &SyncResult{Removed: new(SeqSet)}
+	if state != nil && state.UIDs != nil {
+		known.AddSet(state.UIDs)
+	}
+	if state != nil && state.UIDValidity != mb.UIDValidity {
+		res.Reset = state.UIDValidity != 0
+		res.Removed, known = known, new(SeqSet)
+	} else if state != nil && mb.HighestModSeq != 0 {
+		modseq = state.HighestModSeq
+	}
+	res.State = &SyncState{UIDValidity: mb.UIDValidity, HighestModSeq: mb.HighestModSeq}
+
+	// Fetch the changes
+	var cmd *Command
+	all, _ := NewSeqSet("1:*")
+	f := append([]Field{"UID", "FLAGS"}, stringsToFields(items)...)
+	qresync := c.Enabled["QRESYNC"] && modseq > 0 && !known.Empty()
+	switch {
+	case mb.Messages == 0:
+		res.Removed.AddSet(known)
+		known.Clear()
+	case qresync && modseq == mb.HighestModSeq:
+		// Nothing changed
+	case qresync:
+		mod := []Field{"CHANGEDSINCE", strconv.FormatUint(modseq, 10), "VANISHED"}
+		cmd, err = Wait(c.Send("UID FETCH", all, f, mod))
+	case modseq > 0:
+		mod := []Field{"CHANGEDSINCE", strconv.FormatUint(modseq, 10)}
+		if cmd, err = Wait(c.Send("UID FETCH", all, f, mod)); err == nil && !known.Empty() {
+			var uids []uint32
+			if uids, err = s.uidSearch(known); err == nil {
+				res.Removed.AddSet(known.Subtract(NewSeqSetNums(uids)))
+			}
+		}
+	default:
+		cmd, err = Wait(c.Send("UID FETCH", all, f))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Classify the fetched messages
+	seen := new(SeqSet)
+	var uids []uint32
+	if cmd != nil {
+		for _, rsp := range cmd.Data {
+			if vanished, earlier := rsp.Vanished(); earlier {
+				res.Removed.AddSet(known.Intersect(vanished))
+			}
+		}
+		for _, msg := range cmd.Messages() {
+			if msg.UID == 0 {
+				continue
+			} else if known.Contains(msg.UID) {
+				res.Changed = append(res.Changed, msg)
+			} else {
+				res.Added = append(res.Added, msg)
+			}
+			uids = append(uids, msg.UID)
+		}
+		seen = NewSeqSetNums(uids)
+		if modseq == 0 {
+			res.Removed.AddSet(known.Subtract(seen))
+		}
+	}
+	res.State.UIDs = known.Subtract(res.Removed).Union(seen)
+	return res, nil
+}
+
+// uidSearch returns the UIDs that still exist in the selected mailbox. The
+// result includes all UIDs in uids, but may also include others. If the set is
+// longer than MaxStoreSetLen, the range from its first to last UID is searched
+// instead, which keeps the command under server line length limits.
+func (s *Session) uidSearch(uids *SeqSet) ([]uint32, error) {
+	if set := uids.set; len(set) > 0 && len(uids.String()) > MaxStoreSetLen {
+		uids = new(SeqSet)
+		uids.AddRange(set[0].start, set[len(set)-1].stop)
+	}
+	us := &Session{Client: s.Client, UID: true}
+	return us.Search("UID", uids)
+}
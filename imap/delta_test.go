@@ -0,0 +1,169 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+// syncUIDs returns the UIDs of the messages in a SyncResult.
+func syncUIDs(msgs []*MessageInfo) (uids []uint32) {
+	for _, msg := range msgs {
+		uids = append(uids, msg.UID)
+	}
+	return
+}
+
+func TestSessionSyncMailboxQRESYNC(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 CONDSTORE QRESYNC] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	state := &SyncState{UIDValidity: 7, HighestModSeq: 100, UIDs: newSeqSet("1:5")}
+	go t.script(
+		`C: A1 ENABLE QRESYNC`+CRLF,
+		`S: * ENABLED QRESYNC`+CRLF,
+		`S: A1 OK Enabled`+CRLF,
+		`C: A2 SELECT "INBOX"`+CRLF,
+		`S: * 5 EXISTS`+CRLF,
+		`S: * OK [UIDVALIDITY 7] UIDs valid`+CRLF,
+		`S: * OK [HIGHESTMODSEQ 120] Highest`+CRLF,
+		`S: A2 OK [READ-WRITE] INBOX selected`+CRLF,
+		`C: A3 UID FETCH 1:* (UID FLAGS) (CHANGEDSINCE 100 VANISHED)`+CRLF,
+		`S: * VANISHED (EARLIER) 2:3,9`+CRLF,
+		`S: * 2 FETCH (UID 4 FLAGS (\Seen) MODSEQ (110))`+CRLF,
+		`S: * 4 FETCH (UID 6 FLAGS () MODSEQ (115))`+CRLF,
+		`S: A3 OK FETCH completed`+CRLF,
+	)
+	res, err := S.SyncMailbox("INBOX", state)
+	t.join("SyncMailbox", err)
+
+	if res.Reset || res.Removed.String() != "2:3" {
+		t.Errorf("SyncMailbox() expected removed 2:3; got %v (reset=%v)", res.Removed, res.Reset)
+	}
+	if uids := syncUIDs(res.Changed); !reflect.DeepEqual(uids, []uint32{4}) {
+		t.Errorf("SyncMailbox() expected changed [4]; got %v", uids)
+	}
+	if uids := syncUIDs(res.Added); !reflect.DeepEqual(uids, []uint32{6}) {
+		t.Errorf("SyncMailbox() expected added [6]; got %v", uids)
+	}
+	if s := res.State; s.UIDValidity != 7 || s.HighestModSeq != 120 || s.UIDs.String() != "1,4:6" {
+		t.Errorf("SyncMailbox() unexpected state %+v", s)
+	}
+
+	// No changes since the last sync
+	go t.script(
+		`C: A4 SELECT "INBOX"`+CRLF,
+		`S: * 4 EXISTS`+CRLF,
+		`S: * OK [UIDVALIDITY 7] UIDs valid`+CRLF,
+		`S: * OK [HIGHESTMODSEQ 120] Highest`+CRLF,
+		`S: A4 OK [READ-WRITE] INBOX selected`+CRLF,
+	)
+	res, err = S.SyncMailbox("INBOX", res.State)
+	t.join("SyncMailbox", err)
+	if len(res.Added)+len(res.Changed) != 0 || !res.Removed.Empty() || res.State.UIDs.String() != "1,4:6" {
+		t.Errorf("SyncMailbox() expected no changes; got %+v", res)
+	}
+
+	// Unsolicited VANISHED responses update the mailbox
+	C.UIDs.setUID(1, 1)
+	C.UIDs.setUID(2, 4)
+	rsp := &Response{Type: Data, Label: "VANISHED", Fields: []Field{"VANISHED", "4"}}
+	C.update(rsp)
+	if C.Mailbox.Messages != 3 || C.UIDs.Len() != 3 || C.UIDs.UID(1) != 1 || C.UIDs.Seq(4) != 0 {
+		t.Errorf("VANISHED expected 3 messages; got %d (%d)", C.Mailbox.Messages, C.UIDs.Len())
+	}
+
+	// Huge ranges stop at the first unknown UID
+	rsp = &Response{Type: Data, Label: "VANISHED", Fields: []Field{"VANISHED", "1:4294967295"}}
+	C.update(rsp)
+	if C.Mailbox.Messages != 0 || C.UIDs.Len() != 0 {
+		t.Errorf("VANISHED expected 0 messages; got %d (%d)", C.Mailbox.Messages, C.UIDs.Len())
+	}
+}
+
+func TestSessionSyncMailboxCONDSTORE(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 CONDSTORE] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	state := &SyncState{UIDValidity: 7, HighestModSeq: 100, UIDs: newSeqSet("1:3")}
+	go t.script(
+		`C: A1 SELECT "INBOX" (CONDSTORE)`+CRLF,
+		`S: * 3 EXISTS`+CRLF,
+		`S: * OK [UIDVALIDITY 7] UIDs valid`+CRLF,
+		`S: * OK [HIGHESTMODSEQ 130] Highest`+CRLF,
+		`S: A1 OK [READ-WRITE] INBOX selected`+CRLF,
+		`C: A2 UID FETCH 1:* (UID FLAGS ENVELOPE) (CHANGEDSINCE 100)`+CRLF,
+		`S: * 1 FETCH (UID 1 FLAGS (\Seen) ENVELOPE (NIL "Hi" NIL NIL NIL NIL NIL NIL NIL NIL))`+CRLF,
+		`S: * 3 FETCH (UID 5 FLAGS () ENVELOPE (NIL "New" NIL NIL NIL NIL NIL NIL NIL NIL))`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+		`C: A3 UID SEARCH UID 1:3`+CRLF,
+		`S: * SEARCH 1 3`+CRLF,
+		`S: A3 OK SEARCH completed`+CRLF,
+	)
+	res, err := S.SyncMailbox("INBOX", state, "ENVELOPE")
+	t.join("SyncMailbox", err)
+
+	if res.Removed.String() != "2" || len(res.Changed) != 1 || len(res.Added) != 1 {
+		t.Fatalf("SyncMailbox() unexpected result %+v", res)
+	}
+	if env := res.Added[0].Envelope(); env == nil || env.Subject != "New" {
+		t.Errorf("SyncMailbox() expected envelope of the added message; got %v", env)
+	}
+	if s := res.State; s.HighestModSeq != 130 || s.UIDs.String() != "1,3,5" {
+		t.Errorf("SyncMailbox() unexpected state %+v", s)
+	}
+
+	// Long UID sets are searched as a single range
+	defer func(n int) { MaxStoreSetLen = n }(MaxStoreSetLen)
+	MaxStoreSetLen = 3
+	go t.script(
+		`C: A4 SELECT "INBOX" (CONDSTORE)`+CRLF,
+		`S: * 3 EXISTS`+CRLF,
+		`S: * OK [UIDVALIDITY 7] UIDs valid`+CRLF,
+		`S: * OK [HIGHESTMODSEQ 140] Highest`+CRLF,
+		`S: A4 OK [READ-WRITE] INBOX selected`+CRLF,
+		`C: A5 UID FETCH 1:* (UID FLAGS) (CHANGEDSINCE 130)`+CRLF,
+		`S: A5 OK FETCH completed`+CRLF,
+		`C: A6 UID SEARCH UID 1:5`+CRLF,
+		`S: * SEARCH 1 2 5`+CRLF,
+		`S: A6 OK SEARCH completed`+CRLF,
+	)
+	res, err = S.SyncMailbox("INBOX", res.State)
+	t.join("SyncMailbox", err)
+	if res.Removed.String() != "3" || res.State.UIDs.String() != "1,5" {
+		t.Errorf("SyncMailbox() expected removed 3; got %v (state %v)", res.Removed, res.State.UIDs)
+	}
+}
+
+func TestSessionSyncMailboxReset(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	state := &SyncState{UIDValidity: 7, HighestModSeq: 100, UIDs: newSeqSet("1:3")}
+	go t.script(
+		`C: A1 SELECT "INBOX"`+CRLF,
+		`S: * 2 EXISTS`+CRLF,
+		`S: * OK [UIDVALIDITY 8] UIDs valid`+CRLF,
+		`S: * OK [NOMODSEQ] No mod-sequences`+CRLF,
+		`S: A1 OK [READ-WRITE] INBOX selected`+CRLF,
+		`C: A2 UID FETCH 1:* (UID FLAGS)`+CRLF,
+		`S: * 1 FETCH (UID 1 FLAGS ())`+CRLF,
+		`S: * 2 FETCH (UID 2 FLAGS ())`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+	)
+	res, err := S.SyncMailbox("INBOX", state)
+	t.join("SyncMailbox", err)
+
+	if !res.Reset || res.Removed.String() != "1:3" || len(res.Changed) != 0 {
+		t.Errorf("SyncMailbox() expected reset; got %+v", res)
+	}
+	if uids := syncUIDs(res.Added); !reflect.DeepEqual(uids, []uint32{1, 2}) {
+		t.Errorf("SyncMailbox() expected added [1 2]; got %v", uids)
+	}
+	if s := res.State; s.UIDValidity != 8 || s.HighestModSeq != 0 || s.UIDs.String() != "1:2" {
+		t.Errorf("SyncMailbox() unexpected state %+v", s)
+	}
+}
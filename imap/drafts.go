@@ -0,0 +1,117 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoDrafts is returned by Session.SaveDraft and Session.UpdateDraft if no
+// mailbox is specified and the Drafts mailbox cannot be found.
+var ErrNoDrafts = errors.New("imap: drafts mailbox not found")
+
+// Replace atomically replaces the message with sequence number seq in the
+// selected mailbox with a new one, which is appended to mbox (RFC 8508). The old
+// message is expunged. Flags and internal date arguments are optional and may be
+// set to nil. The server must advertise the REPLACE capability.
+func (c *Client) Replace(seq uint32, mbox string, flags FlagSet, idate *time.Time, msg Literal) (cmd *Command, err error) {
+	return c.replace("REPLACE", seq, mbox, flags, idate, msg)
+}
+
+// UIDReplace is identical to Replace, but the uid argument is interpreted as a
+// unique identifier instead of a message sequence number.
+func (c *Client) UIDReplace(uid uint32, mbox string, flags FlagSet, idate *time.Time, msg Literal) (cmd *Command, err error) {
+	return c.replace("UID REPLACE", uid, mbox, flags, idate, msg)
+}
+
+// replace implements Replace and UIDReplace.
+func (c *Client) replace(name string, seq uint32, mbox string, flags FlagSet, idate *time.Time, msg Literal) (*Command, error) {
+	if !c.Caps["REPLACE"] {
+		return nil, NotAvailableError("REPLACE")
+	}
+	f := []Field{seq, c.encodeMailbox(mbox)}
+	if flags != nil {
+		f = append(f, flags)
+	}
+	if idate != nil {
+		f = append(f, *idate)
+	}
+	return c.Send(name, append(f, msg)...)
+}
+
+// SaveDraft appends a new draft message with the \Draft flag to mbox and
+// returns its UID, if the server supports UIDPLUS. If mbox is empty, the Drafts
+// mailbox is taken from s.Drafts or, if that is also empty, detected with LIST
+// and ResolveSpecialUse and saved in s.Drafts.
+func (s *Session) SaveDraft(mbox string, msg []byte) (*AppendResult, error) {
+	mbox, err := s.draftsMailbox(mbox)
+	if err != nil {
+		return nil, err
+	}
+	return s.Append(&AppendRequest{Mailbox: mbox, Flags: []Flag{FlagDraft}, Message: msg})
+}
+
+// UpdateDraft replaces the draft with the specified UID in the selected mailbox
+// with a new version, which is saved to mbox (see SaveDraft), and returns the
+// UID of the new message, if the server supports UIDPLUS. UID REPLACE is used
+// if the server supports it. Otherwise, the new version is appended first,
+// then the old one is deleted with DeleteMessages using the DeleteExpunge
+// policy, which leaves it marked as deleted on servers without UIDPLUS. The
+// old draft is not deleted if the new one cannot be saved.
+func (s *Session) UpdateDraft(old uint32, mbox string, msg []byte) (*AppendResult, error) {
+	c := s.Client
+	if c.Mailbox == nil {
+		return nil, ErrNotAllowed
+	}
+	mbox, err := s.draftsMailbox(mbox)
+	if err != nil {
+		return nil, err
+	}
+	if c.Caps["REPLACE"] {
+		cmd, err := Wait(c.UIDReplace(old, mbox, NewFlagSet(FlagDraft), nil, NewLiteral(msg)))
+		if err != nil {
+			return nil, err
+		}
+		return appendResult(cmd), nil
+	}
+	res, err := s.SaveDraft(mbox, msg)
+	if err != nil {
+		return nil, err
+	}
+	return res, s.DeleteMessages(NewSeqSetNums([]uint32{old}), DeleteExpunge)
+}
+
+// draftsMailbox returns mbox or, if it is empty, the name of the Drafts
+// mailbox.
+func (s *Session) draftsMailbox(mbox string) (string, error) {
+	if mbox != "" {
+		return mbox, nil
+	} else if s.Drafts == "" {
+		list, err := s.List("", "*")
+		if err != nil {
+			return "", err
+		}
+		m, ok := ResolveSpecialUse(list)[AttrDrafts]
+		if !ok {
+			return "", ErrNoDrafts
+		}
+		s.Drafts = m.Mailbox.Name
+	}
+	return s.Drafts, nil
+}
+
+// appendResult extracts the APPENDUID response code from the data or
+// completion response of an APPEND or REPLACE command.
+func appendResult(cmd *Command) *AppendResult {
+	res := new(AppendResult)
+	for _, rsp := range append(cmd.Data, cmd.result) {
+		if rsp.Label == "APPENDUID" && len(rsp.Fields) == 3 {
+			res.UIDValidity = AsNumber(rsp.Fields[1])
+			res.UID = AsNumber(rsp.Fields[2])
+		}
+	}
+	return res
+}
@@ -0,0 +1,69 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSessionDrafts(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 UIDPLUS] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 LIST "" "*"`+CRLF,
+		`S: * LIST () "/" "INBOX"`+CRLF,
+		`S: * LIST (\Drafts) "/" "Entwürfe"`+CRLF,
+		`S: A1 OK LIST completed`+CRLF,
+		`C: A2 APPEND "Entw&APw-rfe" (\Draft) {4}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		`C: v1`+CRLF,
+		`C: `+CRLF,
+		`S: A2 OK [APPENDUID 7 20] APPEND completed`+CRLF,
+	)
+	res, err := S.SaveDraft("", []byte("v1\r\n"))
+	t.join("APPEND", err)
+	if !reflect.DeepEqual(res, &AppendResult{7, 20}) || S.Drafts != "Entwürfe" {
+		t.Errorf("SaveDraft() unexpected result %+v (%q)", res, S.Drafts)
+	}
+
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("Drafts")
+	go t.script(
+		`C: A3 APPEND "Drafts" (\Draft) {4}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		`C: v2`+CRLF,
+		`C: `+CRLF,
+		`S: A3 OK [APPENDUID 7 21] APPEND completed`+CRLF,
+		`C: A4 UID STORE 20 +FLAGS.SILENT (\Deleted)`+CRLF,
+		`S: A4 OK STORE completed`+CRLF,
+		`C: A5 UID EXPUNGE 20`+CRLF,
+		`S: * 3 EXPUNGE`+CRLF,
+		`S: A5 OK EXPUNGE completed`+CRLF,
+	)
+	res, err = S.UpdateDraft(20, "Drafts", []byte("v2\r\n"))
+	t.join("UID EXPUNGE", err)
+	if !reflect.DeepEqual(res, &AppendResult{7, 21}) {
+		t.Errorf("UpdateDraft() unexpected result %+v", res)
+	}
+
+	C.Caps["REPLACE"] = true
+	S.Drafts = "Drafts"
+	go t.script(
+		`C: A6 UID REPLACE 21 "Drafts" (\Draft) {4}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		`C: v3`+CRLF,
+		`C: `+CRLF,
+		`S: * OK [APPENDUID 7 22] Replacement message saved`+CRLF,
+		`S: * 3 EXPUNGE`+CRLF,
+		`S: A6 OK REPLACE completed`+CRLF,
+	)
+	res, err = S.UpdateDraft(21, "", []byte("v3\r\n"))
+	t.join("UID REPLACE", err)
+	if !reflect.DeepEqual(res, &AppendResult{7, 22}) {
+		t.Errorf("UpdateDraft(REPLACE) unexpected result %+v", res)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// ErrNoRecipients is returned by ParseDeliveryStatus when the delivery status
+// does not contain any per-recipient fields.
+var ErrNoRecipients = errors.New("imap: missing DSN per-recipient fields")
+
+// DeliveryStatus represents the contents of a message/delivery-status part of
+// a delivery status notification (DSN), as described in RFC 3464.
+type DeliveryStatus struct {
+	ReportingMTA    string               // Reporting-MTA (without the type)
+	ArrivalDate     time.Time            // Arrival-Date (zero if missing)
+	OriginalEnvelID string               // Original-Envelope-Id
+	Fields          textproto.MIMEHeader // All per-message fields
+	Recipients      []*RecipientStatus   // Per-recipient fields
+}
+
+// RecipientStatus contains the delivery status of a single recipient. The type
+// prefix (e.g. "rfc822;") is removed from the recipient addresses, MTA names,
+// and diagnostic codes.
+type RecipientStatus struct {
+	FinalRecipient    string               // Final-Recipient
+	OriginalRecipient string               // Original-Recipient
+	Action            string               // Action (e.g. "failed" or "delayed")
+	Status            string               // Status code (e.g. "5.1.1")
+	RemoteMTA         string               // Remote-MTA
+	DiagnosticCode    string               // Diagnostic-Code
+	LastAttemptDate   time.Time            // Last-Attempt-Date (zero if missing)
+	Fields            textproto.MIMEHeader // All per-recipient fields
+}
+
+// Failed returns true if the action is "failed" or the status code indicates
+// a permanent failure.
+func (rs *RecipientStatus) Failed() bool {
+	return rs.Action == "failed" || strings.HasPrefix(rs.Status, "5.")
+}
+
+// DeliveryStatusPart returns the message/delivery-status part of a
+// multipart/report DSN. Nil is returned if the message is not a DSN. RFC 6533
+// message/global-delivery-status parts are also recognized.
+func DeliveryStatusPart(root MessagePart) *BodyPart {
+	m, ok := root.(*Multipart)
+	if !ok || m.Subtype != "report" {
+		return nil
+	}
+	for _, part := range m.Parts {
+		if p, ok := part.(*BodyPart); ok && p.Type == "message" &&
+			(p.Subtype == "delivery-status" || p.Subtype == "global-delivery-status") {
+			return p
+		}
+	}
+	return nil
+}
+
+// ParseDeliveryStatus parses the contents of a message/delivery-status part.
+// The contents must first be decoded with BodyPart.Decode if a content
+// transfer encoding was applied.
+func ParseDeliveryStatus(r io.Reader) (*DeliveryStatus, error) {
+	tr := textproto.NewReader(bufio.NewReader(r))
+	var groups []textproto.MIMEHeader
+	for {
+		h, err := tr.ReadMIMEHeader()
+		if len(h) > 0 {
+			groups = append(groups, h)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(groups) < 2 {
+		return nil, ErrNoRecipients
+	}
+	h := groups[0]
+	ds := &DeliveryStatus{
+		ReportingMTA:    dsnValue(h.Get("Reporting-Mta")),
+		ArrivalDate:     parseMsgTime(h.Get("Arrival-Date")),
+		OriginalEnvelID: h.Get("Original-Envelope-Id"),
+		Fields:          h,
+		Recipients:      make([]*RecipientStatus, 0, len(groups)-1),
+	}
+	for _, h = range groups[1:] {
+		ds.Recipients = append(ds.Recipients, &RecipientStatus{
+			FinalRecipient:    dsnValue(h.Get("Final-Recipient")),
+			OriginalRecipient: dsnValue(h.Get("Original-Recipient")),
+			Action:            toLower(strings.TrimSpace(h.Get("Action"))),
+			Status:            dsnStatus(h.Get("Status")),
+			RemoteMTA:         dsnValue(h.Get("Remote-Mta")),
+			DiagnosticCode:    dsnValue(h.Get("Diagnostic-Code")),
+			LastAttemptDate:   parseMsgTime(h.Get("Last-Attempt-Date")),
+			Fields:            h,
+		})
+	}
+	return ds, nil
+}
+
+// dsnValue removes the type prefix from a typed DSN field value (e.g.
+// "rfc822; user@example.com").
+func dsnValue(v string) string {
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
+
+// dsnStatus returns the status code without any trailing comment.
+func dsnStatus(v string) string {
+	if f := strings.Fields(v); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
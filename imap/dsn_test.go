@@ -0,0 +1,87 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeliveryStatus(t *testing.T) {
+	in := "Reporting-MTA: dns; mx.example.com\r\n" +
+		"Arrival-Date: Tue, 1 Jan 2013 10:00:00 +0000\r\n" +
+		"\r\n" +
+		"Final-Recipient: rfc822; bob@example.org\r\n" +
+		"Original-Recipient: rfc822;Bob@Example.org\r\n" +
+		"Action: Failed\r\n" +
+		"Status: 5.1.1 (user unknown)\r\n" +
+		"Remote-MTA: dns; mx.example.org\r\n" +
+		"Diagnostic-Code: smtp; 550 5.1.1 No such\r\n" +
+		" user\r\n" +
+		"\r\n\r\n" +
+		"Final-Recipient: rfc822; carol@example.net\r\n" +
+		"Action: delayed\r\n" +
+		"Status: 4.4.7\r\n" +
+		"Last-Attempt-Date: Tue, 1 Jan 2013 12:00:00 +0000"
+
+	ds, err := ParseDeliveryStatus(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseDeliveryStatus() unexpected error; %v", err)
+	}
+	if ds.ReportingMTA != "mx.example.com" {
+		t.Errorf("ReportingMTA expected mx.example.com; got %q", ds.ReportingMTA)
+	}
+	if want := time.Date(2013, time.January, 1, 10, 0, 0, 0, time.UTC); !ds.ArrivalDate.Equal(want) {
+		t.Errorf("ArrivalDate expected %v; got %v", want, ds.ArrivalDate)
+	}
+	if len(ds.Recipients) != 2 {
+		t.Fatalf("expected 2 recipients; got %d", len(ds.Recipients))
+	}
+
+	rs := ds.Recipients[0]
+	want := RecipientStatus{
+		FinalRecipient:    "bob@example.org",
+		OriginalRecipient: "Bob@Example.org",
+		Action:            "failed",
+		Status:            "5.1.1",
+		RemoteMTA:         "mx.example.org",
+		DiagnosticCode:    "550 5.1.1 No such user",
+	}
+	rs.Fields = nil
+	if !reflect.DeepEqual(*rs, want) {
+		t.Errorf("Recipients[0] expected\n%#v; got\n%#v", want, *rs)
+	}
+	if !rs.Failed() {
+		t.Errorf("Recipients[0].Failed() expected true")
+	}
+
+	rs = ds.Recipients[1]
+	if rs.FinalRecipient != "carol@example.net" || rs.Status != "4.4.7" || rs.Failed() {
+		t.Errorf("Recipients[1] unexpected value %#v", rs)
+	}
+	if want := time.Date(2013, time.January, 1, 12, 0, 0, 0, time.UTC); !rs.LastAttemptDate.Equal(want) {
+		t.Errorf("LastAttemptDate expected %v; got %v", want, rs.LastAttemptDate)
+	}
+
+	if _, err := ParseDeliveryStatus(strings.NewReader("Reporting-MTA: dns; x\r\n\r\n")); err != ErrNoRecipients {
+		t.Errorf("ParseDeliveryStatus() expected ErrNoRecipients; got %v", err)
+	}
+
+	status := &BodyPart{Section: "2", Type: "message", Subtype: "delivery-status"}
+	root := &Multipart{Subtype: "report", Parts: []MessagePart{
+		&BodyPart{Section: "1", Type: "text", Subtype: "plain"},
+		status,
+		&BodyPart{Section: "3", Type: "message", Subtype: "rfc822"},
+	}}
+	if p := DeliveryStatusPart(root); p != status {
+		t.Errorf("DeliveryStatusPart() expected %v; got %v", status, p)
+	}
+	root.Subtype = "mixed"
+	if p := DeliveryStatusPart(root); p != nil {
+		t.Errorf("DeliveryStatusPart() expected nil; got %v", p)
+	}
+}
@@ -131,6 +131,83 @@ var logMasks = []enumName{
 func (v LogMask) String() string   { return enumString(uint32(v), logMasks, false) }
 func (v LogMask) GoString() string { return enumString(uint32(v), logMasks, true) }
 
+// MailboxAttr represents the known mailbox attributes returned in a LIST or LSUB
+// response, including the child info (RFC 3348, RFC 5258) and special-use (RFC
+// 6154) attributes. Unknown attributes are only available as Flags.
+type MailboxAttr uint32
+
+// Mailbox attributes.
+const (
+	AttrNoinferiors   = MailboxAttr(1 << iota) // \Noinferiors
+	AttrNoselect                               // \Noselect
+	AttrMarked                                 // \Marked
+	AttrUnmarked                               // \Unmarked
+	AttrNonExistent                            // \NonExistent
+	AttrSubscribed                             // \Subscribed
+	AttrRemote                                 // \Remote
+	AttrHasChildren                            // \HasChildren
+	AttrHasNoChildren                          // \HasNoChildren
+	AttrAll                                    // \All (special-use)
+	AttrArchive                                // \Archive (special-use)
+	AttrDrafts                                 // \Drafts (special-use)
+	AttrFlagged                                // \Flagged (special-use)
+	AttrJunk                                   // \Junk (special-use)
+	AttrSent                                   // \Sent (special-use)
+	AttrTrash                                  // \Trash (special-use)
+	AttrImportant                              // \Important (special-use, RFC 8457)
+
+	// AttrSpecialUse is a mask of all special-use attributes.
+	AttrSpecialUse = AttrAll | AttrArchive | AttrDrafts | AttrFlagged |
+		AttrJunk | AttrSent | AttrTrash | AttrImportant
+)
+
+var mailboxAttrs = []enumName{
+	{uint32(AttrNoinferiors), "AttrNoinferiors"},
+	{uint32(AttrNoselect), "AttrNoselect"},
+	{uint32(AttrMarked), "AttrMarked"},
+	{uint32(AttrUnmarked), "AttrUnmarked"},
+	{uint32(AttrNonExistent), "AttrNonExistent"},
+	{uint32(AttrSubscribed), "AttrSubscribed"},
+	{uint32(AttrRemote), "AttrRemote"},
+	{uint32(AttrHasChildren), "AttrHasChildren"},
+	{uint32(AttrHasNoChildren), "AttrHasNoChildren"},
+	{uint32(AttrAll), "AttrAll"},
+	{uint32(AttrArchive), "AttrArchive"},
+	{uint32(AttrDrafts), "AttrDrafts"},
+	{uint32(AttrFlagged), "AttrFlagged"},
+	{uint32(AttrJunk), "AttrJunk"},
+	{uint32(AttrSent), "AttrSent"},
+	{uint32(AttrTrash), "AttrTrash"},
+	{uint32(AttrImportant), "AttrImportant"},
+}
+
+func (v MailboxAttr) String() string   { return enumString(uint32(v), mailboxAttrs, false) }
+func (v MailboxAttr) GoString() string { return enumString(uint32(v), mailboxAttrs, true) }
+
+// SpecialUseConfidence indicates how a SpecialUseMatch was determined.
+type SpecialUseConfidence uint8
+
+// Special-use resolution confidence levels, from lowest to highest.
+const (
+	GuessNested = SpecialUseConfidence(1 + iota) // Known name in a nested mailbox
+	GuessName                                    // Known name in a top-level mailbox
+	GuessAttr                                    // SPECIAL-USE or XLIST attribute
+)
+
+var specialUseConfidences = []enumName{
+	{uint32(GuessNested), "GuessNested"},
+	{uint32(GuessName), "GuessName"},
+	{uint32(GuessAttr), "GuessAttr"},
+}
+
+func (v SpecialUseConfidence) String() string {
+	return enumString(uint32(v), specialUseConfidences, false)
+}
+
+func (v SpecialUseConfidence) GoString() string {
+	return enumString(uint32(v), specialUseConfidences, true)
+}
+
 // enumName associates an enum value with its name for printing.
 type enumName struct {
 	v uint32
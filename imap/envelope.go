@@ -0,0 +1,455 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date-time formats accepted in the Date field of a message envelope. The
+// server returns the original header value, which frequently deviates from the
+// RFC 5322 date-time syntax. The formats are tried in order after
+// mail.ParseDate fails.
+var msgTimeFormats = []string{
+	"Mon, _2 Jan 2006 15:04:05 -0700",
+	"Mon, _2 Jan 2006 15:04:05 MST",
+	"Mon, _2 Jan 2006 15:04:05 -0700 (MST)",
+	"Mon, _2 Jan 2006 15:04 -0700",
+	"_2 Jan 2006 15:04:05 -0700",
+	"_2 Jan 2006 15:04:05 MST",
+	"_2 Jan 2006 15:04:05 -0700 (MST)",
+	"_2 Jan 2006 15:04 -0700",
+	"Mon, _2 Jan 06 15:04:05 -0700",
+	"Mon Jan _2 15:04:05 2006",
+	"Mon Jan _2 15:04:05 MST 2006",
+}
+
+// Envelope represents the envelope structure of a message, as described in RFC
+// 3501 section 7.4.2 (ENVELOPE FETCH data item). Subject and display names are
+// decoded from RFC 2047 encoded-word format when possible.
+type Envelope struct {
+	Date      time.Time  `json:"date"`                // Parsed Date header (zero if missing or invalid)
+	Subject   string     `json:"subject,omitempty"`   // Decoded Subject header
+	From      []*Address `json:"from,omitempty"`      // From header
+	Sender    []*Address `json:"sender,omitempty"`    // Sender header (defaults to From)
+	ReplyTo   []*Address `json:"replyTo,omitempty"`   // Reply-To header (defaults to From)
+	To        []*Address `json:"to,omitempty"`        // To header
+	Cc        []*Address `json:"cc,omitempty"`        // Cc header
+	Bcc       []*Address `json:"bcc,omitempty"`       // Bcc header
+	InReplyTo string     `json:"inReplyTo,omitempty"` // Raw In-Reply-To header
+	MessageID string     `json:"messageId,omitempty"` // Raw Message-ID header
+}
+
+// AsEnvelope returns the value of an ENVELOPE data item. Nil is returned if
+// TypeOf(f) != List or the list does not contain exactly 10 fields.
+func AsEnvelope(f Field) *Envelope {
+	list, ok := f.([]Field)
+	if !ok || len(list) != 10 {
+		return nil
+	}
+	return &Envelope{
+		Date:      parseMsgTime(AsString(list[0])),
+		Subject:   DecodeHeader(AsString(list[1])),
+		From:      AsAddressList(list[2]),
+		Sender:    AsAddressList(list[3]),
+		ReplyTo:   AsAddressList(list[4]),
+		To:        AsAddressList(list[5]),
+		Cc:        AsAddressList(list[6]),
+		Bcc:       AsAddressList(list[7]),
+		InReplyTo: AsString(list[8]),
+		MessageID: AsString(list[9]),
+	}
+}
+
+// InReplyToIDs returns the message identifiers from the In-Reply-To field with
+// the angle brackets removed.
+func (e *Envelope) InReplyToIDs() []string {
+	return ParseMessageIDs(e.InReplyTo)
+}
+
+// FetchReferences is the FETCH data item for retrieving the References header
+// of a message without setting the \Seen flag. See MessageInfo.References.
+const FetchReferences = "BODY.PEEK[HEADER.FIELDS (REFERENCES)]"
+
+// References returns the message identifiers from the References header, which
+// must be requested with the FetchReferences data item. Nil is returned if the
+// header is not available.
+func (msg *MessageInfo) References() []string {
+	hdr := AsHeader(msg.Attrs["BODY[HEADER.FIELDS (REFERENCES)]"])
+	return ParseMessageIDs(strings.Join(hdr["References"], " "))
+}
+
+// ParseMessageIDs extracts message identifiers from the value of a Message-ID,
+// In-Reply-To, or References header. The angle brackets and any whitespace
+// inside of them (from header folding) are removed. Values that do not use
+// angle brackets at all are split on whitespace and commas.
+func ParseMessageIDs(s string) []string {
+	var ids []string
+	if strings.IndexByte(s, '<') < 0 {
+		if f := strings.FieldsFunc(s, isIDSep); len(f) > 0 {
+			ids = f
+		}
+		return ids
+	}
+	for {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			break
+		}
+		s = s[i+1:]
+		j := strings.IndexByte(s, '>')
+		if j < 0 {
+			break
+		}
+		if id := strings.Join(strings.Fields(s[:j]), ""); id != "" {
+			ids = append(ids, id)
+		}
+		s = s[j+1:]
+	}
+	return ids
+}
+
+// isIDSep returns true for characters that separate message identifiers that
+// are not enclosed in angle brackets.
+func isIDSep(c rune) bool {
+	return c == ' ' || c == '\t' || c == ',' || c == '\r' || c == '\n'
+}
+
+// Address represents a single address structure in a message envelope. Group
+// syntax markers are not represented by this type (see AsAddressList).
+type Address struct {
+	Name    string `json:"name,omitempty"`    // Decoded display name (phrase)
+	Route   string `json:"route,omitempty"`   // Source route (obsolete at-domain-list)
+	Mailbox string `json:"mailbox,omitempty"` // Local part
+	Host    string `json:"host,omitempty"`    // Domain name
+}
+
+// AsAddressList returns the value of an envelope address list. RFC 822 group
+// syntax markers are skipped, so the members of all groups are returned as a
+// flat list. Nil is returned if TypeOf(f) != List or if one of the list
+// entries is not a valid address structure.
+func AsAddressList(f Field) []*Address {
+	list, ok := f.([]Field)
+	if !ok {
+		return nil
+	}
+	v := make([]*Address, 0, len(list))
+	for _, f := range list {
+		a, ok := f.([]Field)
+		if !ok || len(a) != 4 {
+			return nil
+		} else if a[3] == nil {
+			continue // Start or end of group
+		}
+		v = append(v, &Address{
+			Name:    DecodeHeader(AsString(a[0])),
+			Route:   AsString(a[1]),
+			Mailbox: AsString(a[2]),
+			Host:    AsString(a[3]),
+		})
+	}
+	return v
+}
+
+// NewAddress converts a net/mail address into an envelope Address. The Route
+// field is always empty.
+func NewAddress(addr *mail.Address) *Address {
+	a := &Address{Name: addr.Name}
+	a.Mailbox, a.Host = splitAddr(addr.Address)
+	return a
+}
+
+// NewAddressList converts a list of net/mail addresses into envelope Addresses.
+func NewAddressList(list []*mail.Address) []*Address {
+	v := make([]*Address, len(list))
+	for i, addr := range list {
+		v[i] = NewAddress(addr)
+	}
+	return v
+}
+
+// MailAddressList converts a list of envelope Addresses into net/mail
+// addresses, which can be used with the standard library mail APIs.
+func MailAddressList(list []*Address) []*mail.Address {
+	v := make([]*mail.Address, len(list))
+	for i, a := range list {
+		v[i] = a.MailAddress()
+	}
+	return v
+}
+
+// Address returns the addr-spec ("mailbox@host") form of the address. The
+// host is omitted if it is empty.
+func (a *Address) Address() string {
+	if a.Host == "" {
+		return a.Mailbox
+	}
+	return a.Mailbox + "@" + a.Host
+}
+
+// MailAddress converts the address into a net/mail address.
+func (a *Address) MailAddress() *mail.Address {
+	return &mail.Address{Name: a.Name, Address: a.Address()}
+}
+
+// String returns the address in RFC 5322 format. The display name is quoted
+// or encoded as an RFC 2047 encoded-word, if necessary.
+func (a *Address) String() string {
+	return a.MailAddress().String()
+}
+
+// splitAddr splits addr-spec at the last '@' into the local part and domain.
+func splitAddr(addr string) (mailbox, host string) {
+	if i := strings.LastIndex(addr, "@"); i >= 0 {
+		return addr[:i], addr[i+1:]
+	}
+	return addr, ""
+}
+
+// parseMsgTime parses the Date field of a message envelope. The zero value of
+// time.Time is returned if s cannot be parsed.
+func parseMsgTime(s string) time.Time {
+	t, _, _ := ParseMessageDate(s)
+	return t
+}
+
+// ExtraDateFormats contains additional time.Parse layouts that are tried by
+// ParseMessageDate after the standard formats fail, but before the tolerant
+// parser. Applications can use it to recognize formats produced by specific
+// broken mailers. It is a package variable, not a Client option, because
+// ParseMessageDate is also used by decoders that do not have a Client, such as
+// AsEnvelope and ParseDeliveryStatus. It should be set once during program
+// initialization and must not be modified while it may be in use by other
+// goroutines.
+var ExtraDateFormats []string
+
+// ErrBadDate is returned by ParseMessageDate when the date cannot be parsed.
+var ErrBadDate = errors.New("imap: unrecognized message date format")
+
+// ParseMessageDate parses the value of a message Date header (or the date in an
+// ENVELOPE). Values that comply with RFC 5322 are parsed by mail.ParseDate.
+// Common deviations are handled by trying msgTimeFormats and ExtraDateFormats,
+// and then by a tolerant parser that accepts missing or incorrect weekday names,
+// single-digit hours, missing seconds, extra whitespace, comments, and time zone
+// offsets such as "GMT+0800" or "+08:00". The lossy flag is set when the
+// returned time is a best-effort guess, which happens when the time zone is
+// missing or unrecognized (UTC is assumed) or the time of day is missing.
+func ParseMessageDate(s string) (t time.Time, lossy bool, err error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return time.Time{}, false, ErrBadDate
+	}
+	if t, err = mail.ParseDate(s); err == nil {
+		t, lossy = fixZone(t)
+		return
+	}
+	for _, formats := range [][]string{msgTimeFormats, ExtraDateFormats} {
+		for _, layout := range formats {
+			if t, err = time.Parse(layout, s); err == nil {
+				t, lossy = fixZone(t)
+				return
+			}
+		}
+	}
+	return parseDateTolerant(s)
+}
+
+// fixZone corrects the offset of a time that was parsed with a time zone name.
+// The time package assigns a zero offset to unknown zone names. The offset is
+// set from dateZones if the name is recognized. Otherwise, lossy is true.
+func fixZone(t time.Time) (time.Time, bool) {
+	name, off := t.Zone()
+	if off != 0 || name == "" || name == "UTC" {
+		return t, false
+	}
+	h, ok := dateZones[toUpper(name)]
+	if !ok {
+		return t.In(time.UTC), true
+	} else if h != 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(),
+			t.Second(), t.Nanosecond(), time.FixedZone(name, h*60*60))
+	}
+	return t, false
+}
+
+// dateZones maps obsolete RFC 5322 time zone names to their UTC offsets in
+// hours.
+var dateZones = map[string]int{
+	"UT": 0, "UTC": 0, "GMT": 0, "Z": 0,
+	"EST": -5, "EDT": -4, "CST": -6, "CDT": -5,
+	"MST": -7, "MDT": -6, "PST": -8, "PDT": -7,
+}
+
+// parseDateTolerant implements the tolerant part of ParseMessageDate. The date
+// is split into tokens, which are classified by their contents rather than by
+// their position.
+func parseDateTolerant(s string) (t time.Time, lossy bool, err error) {
+	var (
+		year, day, hour, min, sec = -1, -1, -1, 0, 0
+		month                     time.Month
+		zone                      *time.Location
+	)
+	var toks []string
+	for _, tok := range strings.Fields(stripComments(strings.Replace(s, ",", " ", -1))) {
+		if c := tok[0]; '0' <= c && c <= '9' && strings.IndexByte(tok, '-') > 0 &&
+			strings.IndexByte(tok, ':') < 0 {
+			toks = append(toks, strings.Split(tok, "-")...) // dd-Mon-yyyy
+		} else {
+			toks = append(toks, tok)
+		}
+	}
+	for _, tok := range toks {
+		if tok == "" {
+			return time.Time{}, false, ErrBadDate
+		}
+		upper := toUpper(tok)
+		switch c := tok[0]; {
+		case strings.IndexByte(tok, ':') > 0 && hour < 0 && '0' <= c && c <= '9':
+			f := strings.Split(tok, ":")
+			if len(f) > 3 {
+				return time.Time{}, false, ErrBadDate
+			}
+			v := make([]int, 3)
+			for i, p := range f {
+				if v[i], err = strconv.Atoi(p); err != nil || v[i] < 0 || len(p) > 2 {
+					return time.Time{}, false, ErrBadDate
+				}
+			}
+			if hour, min, sec = v[0], v[1], v[2]; hour > 23 || min > 59 || sec > 60 {
+				return time.Time{}, false, ErrBadDate
+			}
+		case c == '+' || c == '-':
+			if zone = parseZoneOffset(tok); zone == nil {
+				return time.Time{}, false, ErrBadDate
+			}
+		case '0' <= c && c <= '9':
+			n, err := strconv.Atoi(tok)
+			if err != nil {
+				return time.Time{}, false, ErrBadDate
+			}
+			switch {
+			case day < 0 && len(tok) <= 2 && 1 <= n && n <= 31:
+				day = n
+			case year < 0 && len(tok) == 4:
+				year = n
+			case year < 0 && len(tok) == 2 && day > 0:
+				if year = 1900 + n; n < 50 {
+					year += 100
+				}
+			default:
+				return time.Time{}, false, ErrBadDate
+			}
+		case len(tok) >= 3 && monthIndex(upper[:3]) > 0 && month == 0 && isAlpha(tok):
+			month = time.Month(monthIndex(upper[:3]))
+		case len(tok) >= 3 && weekdayIndex(upper[:3]) >= 0 && isAlpha(tok):
+			// Weekday names are redundant and frequently wrong
+		case zone == nil:
+			if zone = parseNamedZone(upper); zone == nil {
+				lossy = true // Unknown time zone name
+			}
+		}
+	}
+	if year < 0 || month == 0 || day < 0 {
+		return time.Time{}, false, ErrBadDate
+	}
+	if hour < 0 {
+		hour, lossy = 0, true
+	}
+	if zone == nil {
+		zone, lossy = time.UTC, true
+	}
+	t = time.Date(year, month, day, hour, min, sec, 0, zone)
+	if t.Day() != day {
+		return time.Time{}, false, ErrBadDate
+	}
+	return t, lossy, nil
+}
+
+// parseNamedZone parses a time zone name, which may be followed by an offset
+// (e.g. "GMT+0800" or "UTC-5"). Nil is returned if the name is not recognized.
+func parseNamedZone(s string) *time.Location {
+	name := s
+	if i := strings.IndexAny(s, "+-"); i > 0 {
+		name = s[:i]
+		if _, ok := dateZones[name]; !ok || dateZones[name] != 0 {
+			return nil
+		}
+		return parseZoneOffset(s[i:])
+	}
+	if h, ok := dateZones[name]; ok {
+		return time.FixedZone(name, h*60*60)
+	}
+	return nil
+}
+
+// parseZoneOffset parses a numeric time zone offset in one of the "+hhmm",
+// "+hh:mm", "+hh", or "+h" formats. Nil is returned if s is not valid.
+func parseZoneOffset(s string) *time.Location {
+	sign, v := 1, strings.Replace(s[1:], ":", "", 1)
+	if s[0] == '-' {
+		sign = -1
+	}
+	if len(v) == 0 || len(v) > 4 || len(v) == 3 && strings.IndexByte(s, ':') > 0 {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil
+	}
+	h, m := n, 0
+	if len(v) > 2 {
+		h, m = n/100, n%100
+	}
+	if h > 14 || m > 59 {
+		return nil
+	}
+	return time.FixedZone("", sign*(h*60+m)*60)
+}
+
+// stripComments removes parenthesized comments from s.
+func stripComments(s string) string {
+	for {
+		i := strings.IndexByte(s, '(')
+		if i < 0 {
+			return s
+		}
+		j := strings.IndexByte(s[i:], ')')
+		if j < 0 {
+			return s[:i]
+		}
+		s = s[:i] + " " + s[i+j+1:]
+	}
+}
+
+// monthIndex returns the month number (1-12) for an upper-case three-letter
+// month abbreviation or 0 if the name is not recognized.
+func monthIndex(s string) int {
+	if i := strings.Index("JANFEBMARAPRMAYJUNJULAUGSEPOCTNOVDEC", s); i%3 == 0 {
+		return i/3 + 1
+	}
+	return 0
+}
+
+// weekdayIndex returns the weekday number (0-6) for an upper-case three-letter
+// weekday abbreviation or -1 if the name is not recognized.
+func weekdayIndex(s string) int {
+	if i := strings.Index("SUNMONTUEWEDTHUFRISAT", s); i%3 == 0 {
+		return i / 3
+	}
+	return -1
+}
+
+// isAlpha returns true if s contains only ASCII letters.
+func isAlpha(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i] | 0x20; c < 'a' || 'z' < c {
+			return false
+		}
+	}
+	return true
+}
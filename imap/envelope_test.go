@@ -0,0 +1,207 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"net/mail"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var PDT = time.FixedZone("PDT", -7*60*60)
+
+func addr(name, mailbox, host string) []Field {
+	var f [4]Field
+	if name != "" {
+		f[0] = Quote(name, false)
+	}
+	if mailbox != "" {
+		f[2] = Quote(mailbox, false)
+	}
+	if host != "" {
+		f[3] = Quote(host, false)
+	}
+	return f[:]
+}
+
+func TestEnvelope(t *testing.T) {
+	gray := addr("Terry Gray", "gray", "cac.washington.edu")
+	tests := []struct {
+		in  Field
+		out *Envelope
+	}{
+		{nil, nil},
+		{[]Field{}, nil},
+		{[]Field{nil, nil, nil, nil, nil, nil, nil, nil, nil}, nil},
+		{[]Field{nil, nil, nil, nil, nil, nil, nil, nil, nil, nil},
+			&Envelope{}},
+		{[]Field{
+			`"Wed, 17 Jul 1996 02:23:25 -0700 (PDT)"`,
+			`"IMAP4rev1 WG mtg summary and minutes"`,
+			[]Field{gray}, []Field{gray}, []Field{gray},
+			[]Field{addr("", "imap", "cac.washington.edu")},
+			[]Field{addr("", "minutes", "CNRI.Reston.VA.US"), addr("John Klensin", "KLENSIN", "MIT.EDU")},
+			nil, nil,
+			`"<B27397-0100000@cac.washington.edu>"`},
+			&Envelope{
+				Date:    time.Date(1996, time.July, 17, 2, 23, 25, 0, PDT),
+				Subject: "IMAP4rev1 WG mtg summary and minutes",
+				From:    []*Address{{"Terry Gray", "", "gray", "cac.washington.edu"}},
+				Sender:  []*Address{{"Terry Gray", "", "gray", "cac.washington.edu"}},
+				ReplyTo: []*Address{{"Terry Gray", "", "gray", "cac.washington.edu"}},
+				To:      []*Address{{"", "", "imap", "cac.washington.edu"}},
+				Cc: []*Address{
+					{"", "", "minutes", "CNRI.Reston.VA.US"},
+					{"John Klensin", "", "KLENSIN", "MIT.EDU"}},
+				MessageID: "<B27397-0100000@cac.washington.edu>"}},
+		{[]Field{
+			`"Tue, 1 Jan 2013 00:00:00 GMT"`,
+			`"=?UTF-8?B?0J/RgNC40LLQtdGC?="`,
+			[]Field{addr("=?ISO-8859-1?Q?Andr=E9?= Pirard", "PIRARD", "vm1.ulg.ac.be")},
+			nil, nil,
+			[]Field{addr("", "group", ""), addr("", "a", "example.com"), addr("", "", "")},
+			nil, nil,
+			`"<x@example.com>"`, nil},
+			&Envelope{
+				Date:      time.Date(2013, time.January, 1, 0, 0, 0, 0, time.FixedZone("GMT", 0)),
+				Subject:   "Привет",
+				From:      []*Address{{"André Pirard", "", "PIRARD", "vm1.ulg.ac.be"}},
+				To:        []*Address{{"", "", "a", "example.com"}},
+				InReplyTo: "<x@example.com>"}},
+	}
+	for _, test := range tests {
+		out := AsEnvelope(test.in)
+		if out != nil && test.out != nil && out.Date.Equal(test.out.Date) {
+			out.Date = test.out.Date
+		}
+		if !reflect.DeepEqual(out, test.out) {
+			t.Errorf("AsEnvelope(%v) expected\n%#v; got\n%#v", test.in, test.out, out)
+		}
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		in   *Address
+		addr string
+		str  string
+	}{
+		{&Address{Mailbox: "gray", Host: "example.com"},
+			"gray@example.com", "<gray@example.com>"},
+		{&Address{Name: "Terry Gray", Mailbox: "gray", Host: "example.com"},
+			"gray@example.com", `"Terry Gray" <gray@example.com>`},
+		{&Address{Name: `Gray, "T"`, Mailbox: "gray", Host: "example.com"},
+			"gray@example.com", `"Gray, \"T\"" <gray@example.com>`},
+		{&Address{Name: "André", Mailbox: "andre", Host: "example.com"},
+			"andre@example.com", "=?utf-8?q?Andr=C3=A9?= <andre@example.com>"},
+	}
+	for _, test := range tests {
+		if addr := test.in.Address(); addr != test.addr {
+			t.Errorf("Address(%#v) expected %q; got %q", test.in, test.addr, addr)
+		}
+		if str := test.in.String(); str != test.str {
+			t.Errorf("String(%#v) expected %q; got %q", test.in, test.str, str)
+		}
+		ma, err := mail.ParseAddress(test.in.String())
+		if err != nil {
+			t.Errorf("ParseAddress(%q) unexpected error; %v", test.in, err)
+		} else if a := NewAddress(ma); !reflect.DeepEqual(a, test.in) {
+			t.Errorf("NewAddress(%#v) expected\n%#v; got\n%#v", ma, test.in, a)
+		}
+	}
+
+	in := []*Address{{"A", "", "a", "example.com"}, {"", "", "b", "example.org"}}
+	out := MailAddressList(in)
+	if want := []*mail.Address{{Name: "A", Address: "a@example.com"}, {Address: "b@example.org"}}; !reflect.DeepEqual(out, want) {
+		t.Errorf("MailAddressList() expected %v; got %v", want, out)
+	}
+	if v := NewAddressList(out); !reflect.DeepEqual(v, in) {
+		t.Errorf("NewAddressList() expected %v; got %v", in, v)
+	}
+}
+
+func TestMessageIDs(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []string
+	}{
+		{``, nil},
+		{`<>`, nil},
+		{`<a@b>`, []string{"a@b"}},
+		{` <a@b>  <c@d>`, []string{"a@b", "c@d"}},
+		{"<a@b>\r\n\t<c@d> (comment)", []string{"a@b", "c@d"}},
+		{"<a@\r\n b>", []string{"a@b"}},
+		{`Your message of "x" <a@b>`, []string{"a@b"}},
+		{`a@b, c@d`, []string{"a@b", "c@d"}},
+		{`<a@b`, nil},
+	}
+	for _, test := range tests {
+		if out := ParseMessageIDs(test.in); !reflect.DeepEqual(out, test.out) {
+			t.Errorf("ParseMessageIDs(%+q) expected %q; got %q", test.in, test.out, out)
+		}
+	}
+
+	env := &Envelope{InReplyTo: "<x@example.com>"}
+	if out := env.InReplyToIDs(); !reflect.DeepEqual(out, []string{"x@example.com"}) {
+		t.Errorf("InReplyToIDs() expected [x@example.com]; got %q", out)
+	}
+
+	msg := &MessageInfo{Attrs: FieldMap{
+		"BODY[HEADER.FIELDS (REFERENCES)]": lit("References: <a@b>\r\n <c@d>\r\n\r\n"),
+	}}
+	if out := msg.References(); !reflect.DeepEqual(out, []string{"a@b", "c@d"}) {
+		t.Errorf("References() expected [a@b c@d]; got %q", out)
+	}
+	if out := (&MessageInfo{}).References(); out != nil {
+		t.Errorf("References() expected nil; got %q", out)
+	}
+}
+
+func TestParseMessageDate(t *testing.T) {
+	CST := time.FixedZone("", 8*60*60)
+	tests := []struct {
+		in    string
+		out   time.Time
+		lossy bool
+	}{
+		{"Mon, 17 Jul 1996 02:44:25 -0700", time.Date(1996, time.July, 17, 2, 44, 25, 0, PDT), false},
+		{"Fri, 17 Jul 1996 02:44:25 -0700", time.Date(1996, time.July, 17, 2, 44, 25, 0, PDT), false},
+		{"Wed,  17 Jul  1996 2:44:25 -0700", time.Date(1996, time.July, 17, 2, 44, 25, 0, PDT), false},
+		{"17 Jul 1996 2:44 -0700", time.Date(1996, time.July, 17, 2, 44, 0, 0, PDT), false},
+		{"Wed, 17 Jul 1996 02:44:25 GMT+0800", time.Date(1996, time.July, 17, 2, 44, 25, 0, CST), false},
+		{"Wed, 17 Jul 1996 02:44:25 UTC+8", time.Date(1996, time.July, 17, 2, 44, 25, 0, CST), false},
+		{"Wed, 17 Jul 1996 02:44:25 +08:00", time.Date(1996, time.July, 17, 2, 44, 25, 0, CST), false},
+		{"Wednesday, July 17, 1996 02:44:25 PDT", time.Date(1996, time.July, 17, 2, 44, 25, 0, PDT), false},
+		{"Wed Jul 17 02:44:25 1996", time.Date(1996, time.July, 17, 2, 44, 25, 0, time.UTC), false},
+		{"17-Jul-1996 02:44:25 -0700", time.Date(1996, time.July, 17, 2, 44, 25, 0, PDT), false},
+		{"17 Jul 1996 02:44:25 (Pacific Daylight Time) -0700", time.Date(1996, time.July, 17, 2, 44, 25, 0, PDT), false},
+		{"17 Jul 96 02:44:25 -0700", time.Date(1996, time.July, 17, 2, 44, 25, 0, PDT), false},
+		{"Wed, 17 Jul 13 2:44:25 GMT-0700", time.Date(2013, time.July, 17, 2, 44, 25, 0, PDT), false},
+		{"Mon, 17 Jul 1996 02:44:25 PDT", time.Date(1996, time.July, 17, 2, 44, 25, 0, PDT), false},
+		{"17 Jul 1996 02:44:25", time.Date(1996, time.July, 17, 2, 44, 25, 0, time.UTC), true},
+		{"17 Jul 1996 02:44:25 XYZ", time.Date(1996, time.July, 17, 2, 44, 25, 0, time.UTC), true},
+		{"17 Jul 1996", time.Date(1996, time.July, 17, 0, 0, 0, 0, time.UTC), true},
+	}
+	for _, test := range tests {
+		out, lossy, err := ParseMessageDate(test.in)
+		if err != nil || !out.Equal(test.out) || lossy != test.lossy {
+			t.Errorf("ParseMessageDate(%q) expected %v (%v); got %v (%v, %v)",
+				test.in, test.out, test.lossy, out, lossy, err)
+		}
+	}
+	for _, in := range []string{"", "yesterday", "31 Feb 1996 02:44:25 +0000", "17 Jul 1996 25:00:00 +0000", "17 Jul 1996 02:44:25 +99"} {
+		if out, _, err := ParseMessageDate(in); err == nil {
+			t.Errorf("ParseMessageDate(%q) expected error; got %v", in, out)
+		}
+	}
+
+	defer func() { ExtraDateFormats = nil }()
+	ExtraDateFormats = []string{"2006/01/02 15:04"}
+	if out, lossy, err := ParseMessageDate("1996/07/17 02:44"); err != nil || lossy ||
+		!out.Equal(time.Date(1996, time.July, 17, 2, 44, 0, 0, time.UTC)) {
+		t.Errorf("ParseMessageDate() with ExtraDateFormats unexpected result %v (%v, %v)", out, lossy, err)
+	}
+}
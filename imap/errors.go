@@ -0,0 +1,104 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"io"
+	"net"
+)
+
+// Command failure classes. A ResponseError matches these targets with
+// errors.Is according to its completion status and response code, so callers
+// do not need to inspect the response text. For example:
+//
+//	if _, err := Wait(c.Select("Archive", false)); errors.Is(err, ErrMailboxNotFound) {
+//		...
+//	}
+var (
+	ErrNo  = errors.New("imap: command failed (NO)")
+	ErrBad = errors.New("imap: command rejected (BAD)")
+
+	ErrMailboxNotFound = errors.New("imap: mailbox not found")
+	ErrMailboxExists   = errors.New("imap: mailbox already exists")
+	ErrOverQuota       = errors.New("imap: quota exceeded")
+	ErrReadOnly        = errors.New("imap: mailbox is read-only")
+	ErrAuthFailed      = errors.New("imap: authentication failed")
+	ErrNoPermission    = errors.New("imap: permission denied")
+	ErrInUse           = errors.New("imap: resource in use")
+	ErrLimit           = errors.New("imap: server limit exceeded")
+)
+
+// respCodeErrors maps response codes (RFC 3501, RFC 5530, and RFC 9208) to the
+// errors matched by ResponseError.Is.
+var respCodeErrors = map[string]error{
+	"NONEXISTENT":          ErrMailboxNotFound,
+	"TRYCREATE":            ErrMailboxNotFound,
+	"ALREADYEXISTS":        ErrMailboxExists,
+	"OVERQUOTA":            ErrOverQuota,
+	"LIMIT":                ErrLimit,
+	"READ-ONLY":            ErrReadOnly,
+	"AUTHENTICATIONFAILED": ErrAuthFailed,
+	"AUTHORIZATIONFAILED":  ErrAuthFailed,
+	"EXPIRED":              ErrAuthFailed,
+	"NOPERM":               ErrNoPermission,
+	"INUSE":                ErrInUse,
+}
+
+// Is reports whether the error matches target. ErrNo and ErrBad match command
+// completions with the corresponding status. The other command failure errors
+// match NO or BAD completions with the corresponding response code (e.g.
+// [NONEXISTENT] or [TRYCREATE] for ErrMailboxNotFound).
+func (rsp ResponseError) Is(target error) bool {
+	if rsp.Response == nil || rsp.Status&(NO|BAD) == 0 {
+		return false
+	}
+	switch target {
+	case ErrNo:
+		return rsp.Status == NO
+	case ErrBad:
+		return rsp.Status == BAD
+	}
+	err, ok := respCodeErrors[rsp.Code()]
+	return ok && err == target
+}
+
+// Code returns the response code of the failed command (e.g. "NONEXISTENT"),
+// or an empty string if the response does not have one.
+func (rsp ResponseError) Code() string {
+	if rsp.Response == nil || rsp.Type != Status && rsp.Type != Done {
+		return ""
+	}
+	return rsp.Label
+}
+
+// Text returns the human-readable text of the server response, which may be
+// presented to the user.
+func (rsp ResponseError) Text() string {
+	if rsp.Response == nil {
+		return ""
+	}
+	return rsp.Info
+}
+
+// IsConnError returns true if err is a connection-level failure, as opposed to
+// a command that was completed by the server with a NO or BAD status (see
+// ResponseError). Such errors include the end of the stream (io.EOF), network
+// errors, protocol errors (ParserError), and commands aborted by a break in the
+// connection (ErrAborted). The client is usually closed after these errors and
+// the connection must be reestablished. ErrTimeout is not a connection error,
+// because an expired Client.Recv timeout leaves the connection usable.
+func IsConnError(err error) bool {
+	var neterr net.Error
+	var perr *ParserError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, ErrAborted):
+		return true
+	}
+	return errors.As(err, &neterr) || errors.As(err, &perr)
+}
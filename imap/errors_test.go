@@ -0,0 +1,76 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestResponseErrorIs(t *testing.T) {
+	tests := []struct {
+		rsp *Response
+		is  []error
+		not []error
+	}{
+		{&Response{Type: Done, Status: NO, Label: "NONEXISTENT", Info: "Unknown mailbox"},
+			[]error{ErrNo, ErrMailboxNotFound}, []error{ErrBad, ErrMailboxExists}},
+		{&Response{Type: Done, Status: NO, Label: "TRYCREATE", Info: "Mailbox does not exist"},
+			[]error{ErrNo, ErrMailboxNotFound}, []error{ErrOverQuota}},
+		{&Response{Type: Done, Status: NO, Label: "OVERQUOTA", Info: "Quota exceeded"},
+			[]error{ErrNo, ErrOverQuota}, []error{ErrLimit}},
+		{&Response{Type: Done, Status: BAD, Label: "READ-ONLY", Info: "Mailbox is read-only"},
+			[]error{ErrBad, ErrReadOnly}, []error{ErrNo}},
+		{&Response{Type: Done, Status: NO, Info: "Server error"},
+			[]error{ErrNo}, []error{ErrBad, ErrMailboxNotFound}},
+		{&Response{Type: Done, Status: OK, Label: "READ-ONLY", Info: "Done"},
+			nil, []error{ErrNo, ErrReadOnly}},
+	}
+	for _, test := range tests {
+		rsp := test.rsp
+		rerr := ResponseError{rsp, "unexpected completion status"}
+		if rerr.Code() != rsp.Label || rerr.Text() != rsp.Info {
+			t.Errorf("%q: Code()/Text() = %q/%q", rsp.Info, rerr.Code(), rerr.Text())
+		}
+		wrapped := fmt.Errorf("select: %w", rerr)
+		for _, target := range test.is {
+			if !errors.Is(wrapped, target) {
+				t.Errorf("%q: expected errors.Is(%v)", rsp.Info, target)
+			}
+		}
+		for _, target := range test.not {
+			if errors.Is(wrapped, target) {
+				t.Errorf("%q: unexpected errors.Is(%v)", rsp.Info, target)
+			}
+		}
+		var as ResponseError
+		if !errors.As(wrapped, &as) || as.Response != rsp {
+			t.Errorf("%q: errors.As failed", rsp.Info)
+		}
+	}
+}
+
+func TestIsConnError(t *testing.T) {
+	tests := []struct {
+		err  error
+		conn bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{ErrAborted, true},
+		{ErrTimeout, false},
+		{fmt.Errorf("fetch: %w", io.ErrUnexpectedEOF), true},
+		{&ParserError{Info: "bad line"}, true},
+		{ResponseError{&Response{Type: Done, Status: NO}, ""}, false},
+		{ErrNotAllowed, false},
+	}
+	for _, test := range tests {
+		if v := IsConnError(test.err); v != test.conn {
+			t.Errorf("IsConnError(%v) expected %v; got %v", test.err, test.conn, v)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrNoSection is returned by Client.FetchTo if the server did not return the
+// requested message section.
+var ErrNoSection = errors.New("imap: message section not received")
+
+// Messages returns the message attributes from all FETCH responses in
+// cmd.Data, in the order in which the messages were first received. Servers
+// may send multiple FETCH responses for the same message (e.g. an unsolicited
+// FLAGS update followed by the requested data), in which case the attributes
+// of all such responses are merged into a single MessageInfo, with later
+// values taking precedence.
+func (cmd *Command) Messages() []*MessageInfo {
+	var msgs []*MessageInfo
+	index := make(map[uint32]int)
+	for _, rsp := range cmd.Data {
+		msg := rsp.MessageInfo()
+		if msg == nil {
+			continue
+		}
+		if i, ok := index[msg.Seq]; ok {
+			msgs[i] = mergeMessageInfo(msgs[i], msg)
+		} else {
+			index[msg.Seq] = len(msgs)
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// MessagesByUID returns the message attributes from all FETCH responses in
+// cmd.Data keyed by UID. The UID data item is always included in the responses
+// to UID FETCH. Messages without a UID are omitted.
+func (cmd *Command) MessagesByUID() map[uint32]*MessageInfo {
+	msgs := cmd.Messages()
+	byUID := make(map[uint32]*MessageInfo, len(msgs))
+	for _, msg := range msgs {
+		if msg.UID != 0 {
+			byUID[msg.UID] = msg
+		}
+	}
+	return byUID
+}
+
+// mergeMessageInfo returns a new MessageInfo containing the attributes of a and
+// b. The original values are not modified.
+func mergeMessageInfo(a, b *MessageInfo) *MessageInfo {
+	kv := make(FieldMap, len(a.Attrs)+len(b.Attrs))
+	for k, f := range a.Attrs {
+		kv[k] = f
+	}
+	for k, f := range b.Attrs {
+		kv[k] = f
+	}
+	return newMessageInfo(b.Seq, kv)
+}
+
+// Envelope returns the value of the ENVELOPE attribute or nil if the attribute
+// is not available. The attribute is parsed on the first call, and the same
+// value is returned by subsequent calls, so it must not be modified.
+func (msg *MessageInfo) Envelope() *Envelope {
+	p := msg.parsed
+	if p == nil {
+		return AsEnvelope(msg.Attrs["ENVELOPE"])
+	}
+	p.envOnce.Do(func() { p.env = AsEnvelope(msg.Attrs["ENVELOPE"]) })
+	return p.env
+}
+
+// Section returns the contents of a BODY[<section>] attribute or nil if the
+// attribute is not available. See SectionSpec.Value.
+func (msg *MessageInfo) Section(spec *SectionSpec) []byte {
+	return AsBytes(spec.Value(msg))
+}
+
+// FetchTo fetches the specified section of the message with the given UID (see
+// SectionSpec.Text for the section syntax; "" fetches the entire message) and
+// copies it to w as the data is received from the server. This allows large
+// messages and attachments to be saved without buffering them in memory. The
+// \Seen flag is not set. If progress is not nil, it is called after each write
+// with the number of bytes copied so far and the total size of the section.
+//
+// A StreamReader is installed for the duration of the command. Other literals
+// are passed to the Dest function of the previous LiteralReader, if it was also
+// a StreamReader, or saved to memory. The command is returned with ErrNoSection
+// if the message does not exist or the server did not return the section, or
+// with the first error returned by w.
+func (c *Client) FetchTo(uid uint32, section string, w io.Writer, progress func(n, total int64)) (cmd *Command, err error) {
+	key := []byte("BODY[" + toUpper(section) + "]")
+	var dst *progressWriter
+	prev := c.SetLiteralReader(nil)
+	sr := &StreamReader{Dest: func(prefix []byte, i LiteralInfo) io.Writer {
+		if dst == nil && isSectionPrefix(prefix, key) {
+			dst = &progressWriter{w: w, total: int64(i.Len), progress: progress}
+			return dst
+		} else if psr, ok := prev.(*StreamReader); ok && psr.Dest != nil {
+			return psr.Dest(prefix, i)
+		}
+		return nil
+	}}
+	c.SetLiteralReader(sr)
+	defer c.SetLiteralReader(prev)
+
+	seq := NewSeqSetNums([]uint32{uid})
+	if cmd, err = Wait(c.UIDFetch(seq, "BODY.PEEK["+section+"]")); err == nil {
+		if dst == nil {
+			err = ErrNoSection
+		} else {
+			err = dst.err
+		}
+	}
+	return
+}
+
+// isSectionPrefix returns true if the last FETCH data item in prefix, which
+// precedes a literal, is the body section key (e.g. "BODY[1.2]").
+func isSectionPrefix(prefix, key []byte) bool {
+	prefix = bytes.ToUpper(prefix)
+	i := bytes.LastIndex(prefix, []byte("BODY["))
+	return i >= 0 && bytes.HasPrefix(prefix[i:], key)
+}
+
+// progressWriter reports the progress of FetchTo.
+type progressWriter struct {
+	w        io.Writer
+	n, total int64
+	progress func(n, total int64)
+	err      error
+}
+
+func (pw *progressWriter) Write(p []byte) (n int, err error) {
+	n, err = pw.w.Write(p)
+	if pw.n += int64(n); pw.progress != nil {
+		pw.progress(pw.n, pw.total)
+	}
+	if err != nil && pw.err == nil {
+		pw.err = err
+	}
+	return
+}
@@ -0,0 +1,93 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func fetchRsp(seq uint32, attrs ...Field) *Response {
+	return &Response{Tag: "*", Type: Data, Label: "FETCH", Fields: []Field{seq, "FETCH", attrs}}
+}
+
+func TestCommandMessages(t *testing.T) {
+	cmd := &Command{Data: []*Response{
+		fetchRsp(2, "UID", uint32(20), "FLAGS", []Field{`\Seen`}),
+		fetchRsp(1, "UID", uint32(10), "RFC822.SIZE", uint32(100),
+			"ENVELOPE", []Field{nil, `"Hi"`, nil, nil, nil, nil, nil, nil, nil, nil}),
+		{Tag: "*", Type: Data, Label: "EXISTS", Fields: []Field{uint32(3), "EXISTS"}},
+		fetchRsp(2, "FLAGS", []Field{`\Seen`, `\Flagged`}, "BODY[1]", lit("hello")),
+		fetchRsp(3, "FLAGS", []Field{}),
+	}}
+	msgs := cmd.Messages()
+	if len(msgs) != 3 {
+		t.Fatalf("Messages() expected 3 messages; got %d", len(msgs))
+	}
+	if seqs := []uint32{msgs[0].Seq, msgs[1].Seq, msgs[2].Seq}; !reflect.DeepEqual(seqs, []uint32{2, 1, 3}) {
+		t.Errorf("Messages() expected order [2 1 3]; got %v", seqs)
+	}
+	m := msgs[0]
+	if m.UID != 20 || !m.Flags.Has(FlagFlagged) || string(m.Section(BodySection("1"))) != "hello" {
+		t.Errorf("Messages() incorrect merge result %v", m.Attrs)
+	}
+	if env := msgs[1].Envelope(); env == nil || env.Subject != "Hi" || msgs[1].Size != 100 {
+		t.Errorf("Envelope() unexpected value %v", env)
+	}
+	if env := m.Envelope(); env != nil {
+		t.Errorf("Envelope() expected nil; got %v", env)
+	}
+
+	byUID := cmd.MessagesByUID()
+	if len(byUID) != 2 || byUID[10].Seq != 1 || byUID[20].Seq != 2 {
+		t.Errorf("MessagesByUID() unexpected result %v", byUID)
+	}
+}
+
+func TestClientFetchTo(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+
+	go t.script(
+		`C: A1 UID FETCH 42 (BODY.PEEK[])`+CRLF,
+		`S: * 3 FETCH (UID 42 BODY[] {11}`+CRLF,
+		`S: hello world)`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+	)
+	var buf bytes.Buffer
+	var n, total int64
+	_, err := C.FetchTo(42, "", &buf, func(nn, tt int64) { n, total = nn, tt })
+	t.join("FETCH", err)
+	if buf.String() != "hello world" || n != 11 || total != 11 {
+		t.Errorf("FetchTo() unexpected result %q (%d/%d)", buf.String(), n, total)
+	}
+	if _, ok := C.r.LiteralReader.(MemoryReader); !ok {
+		t.Errorf("FetchTo() did not restore LiteralReader; got %T", C.r.LiteralReader)
+	}
+
+	go t.script(
+		`C: A2 UID FETCH 7 (BODY.PEEK[1.mime])`+CRLF,
+		`S: * 1 FETCH (BODY[1.MIME] {4}`+CRLF,
+		`S: abcd)`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+	)
+	buf.Reset()
+	_, err = C.FetchTo(7, "1.mime", &buf, nil)
+	t.join("FETCH", err)
+	if buf.String() != "abcd" {
+		t.Errorf("FetchTo() expected %q; got %q", "abcd", buf.String())
+	}
+
+	go t.script(
+		`C: A3 UID FETCH 9 (BODY.PEEK[])`+CRLF,
+		`S: A3 OK FETCH completed`+CRLF,
+	)
+	if _, err = C.FetchTo(9, "", &buf, nil); err != ErrNoSection {
+		t.Errorf("FetchTo() expected ErrNoSection; got %v", err)
+	}
+	t.join("FETCH", nil)
+}
@@ -0,0 +1,106 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoFetchItems is returned by NewFetchItems if no data items are specified.
+var ErrNoFetchItems = errors.New("imap: no FETCH data items")
+
+// FetchItems is a list of FETCH data items that is validated and serialized
+// once by NewFetchItems. It can be passed to any number of FETCH commands (see
+// Client.FetchWith) without repeating that work, which matters in sync loops
+// that issue thousands of commands with the same items. A FetchItems value is
+// immutable and may be shared by multiple goroutines and clients.
+type FetchItems struct {
+	items []string
+	text  string // Serialized list, including the parentheses
+}
+
+// NewFetchItems validates the data items and returns them in precompiled form.
+// Each item must be a valid FETCH attribute (e.g. "FLAGS" or
+// "BODY.PEEK[HEADER.FIELDS (FROM TO)]") with balanced brackets and no control
+// characters. The ALL, FAST, and FULL macros cannot be combined with other
+// items.
+func NewFetchItems(items ...string) (*FetchItems, error) {
+	if len(items) == 0 {
+		return nil, ErrNoFetchItems
+	}
+	for _, item := range items {
+		if !validFetchItem(item) {
+			return nil, fmt.Errorf("imap: invalid FETCH data item %q", item)
+		} else if _, ok := fetchMacros[toUpper(item)]; ok && len(items) > 1 {
+			return nil, fmt.Errorf("imap: FETCH macro %q cannot be combined with other items", item)
+		}
+	}
+	fi := &FetchItems{items: append([]string(nil), items...)}
+	fi.text = "(" + strings.Join(fi.items, " ") + ")"
+	return fi, nil
+}
+
+// mustFetchItems is like NewFetchItems, but panics if the items are invalid.
+// It is used to initialize package variables.
+func mustFetchItems(items ...string) *FetchItems {
+	fi, err := NewFetchItems(items...)
+	if err != nil {
+		panic(err)
+	}
+	return fi
+}
+
+// Items returns a copy of the data items.
+func (fi *FetchItems) Items() []string {
+	return append([]string(nil), fi.items...)
+}
+
+// String returns the serialized list of data items, as sent to the server.
+func (fi *FetchItems) String() string {
+	return fi.text
+}
+
+// validFetchItem returns true if item is a non-empty FETCH attribute without
+// control characters, in which spaces, brackets, and parentheses only appear
+// within balanced section and partial specifiers.
+func validFetchItem(item string) bool {
+	var brackets, parens int
+	for i := 0; i < len(item); i++ {
+		switch c := item[i]; {
+		case c < ' ' || c == 0x7f:
+			return false
+		case c == '[':
+			brackets++
+		case c == ']':
+			if brackets--; brackets < 0 || parens > 0 {
+				return false
+			}
+		case c == '(':
+			if brackets == 0 {
+				return false
+			}
+			parens++
+		case c == ')':
+			if parens--; parens < 0 {
+				return false
+			}
+		case c == ' ' && brackets == 0:
+			return false
+		}
+	}
+	return item != "" && brackets == 0 && parens == 0
+}
+
+// FetchWith is identical to Fetch, but the data items are precompiled.
+func (c *Client) FetchWith(seq *SeqSet, items *FetchItems) (cmd *Command, err error) {
+	return c.Send("FETCH", seq, items)
+}
+
+// UIDFetchWith is identical to UIDFetch, but the data items are precompiled.
+func (c *Client) UIDFetchWith(seq *SeqSet, items *FetchItems) (cmd *Command, err error) {
+	return c.Send("UID FETCH", seq, items)
+}
@@ -0,0 +1,69 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewFetchItems(t *testing.T) {
+	tests := []struct {
+		in  []string
+		out string
+	}{
+		{[]string{"FLAGS"}, "(FLAGS)"},
+		{[]string{"UID", "BODY.PEEK[HEADER.FIELDS (FROM TO)]", "BODY[]<0.100>"},
+			"(UID BODY.PEEK[HEADER.FIELDS (FROM TO)] BODY[]<0.100>)"},
+		{[]string{"all"}, "(all)"},
+		{nil, ""},
+		{[]string{""}, ""},
+		{[]string{"FLAGS UID"}, ""},
+		{[]string{"BODY[HEADER"}, ""},
+		{[]string{"BODY[(FROM])"}, ""},
+		{[]string{"FLAGS\r\n"}, ""},
+		{[]string{"FAST", "UID"}, ""},
+	}
+	for _, test := range tests {
+		fi, err := NewFetchItems(test.in...)
+		if test.out == "" {
+			if err == nil {
+				t.Errorf("NewFetchItems(%q) expected error; got %q", test.in, fi)
+			}
+		} else if err != nil {
+			t.Errorf("NewFetchItems(%q) unexpected error; %v", test.in, err)
+		} else if fi.String() != test.out || !reflect.DeepEqual(fi.Items(), test.in) {
+			t.Errorf("NewFetchItems(%q) expected %q; got %q", test.in, test.out, fi)
+		}
+	}
+}
+
+func TestClientFetchWith(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+
+	fi, err := NewFetchItems("UID", "FLAGS")
+	if err != nil {
+		t.Fatalf("NewFetchItems() unexpected error; %v", err)
+	}
+	go t.script(
+		`C: A1 FETCH 1:2 (UID FLAGS)`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID FETCH 5 (UID FLAGS)`+CRLF,
+		`S: * 3 FETCH (UID 5 FLAGS (\Seen))`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+	)
+	_, err = Wait(C.FetchWith(newSeqSet("1:2"), fi))
+	if err == nil {
+		var cmd *Command
+		if cmd, err = Wait(C.UIDFetchWith(newSeqSet("5"), fi)); err == nil {
+			if msgs := cmd.Messages(); len(msgs) != 1 || msgs[0].UID != 5 {
+				t.Errorf("UIDFetchWith() unexpected messages %v", msgs)
+			}
+		}
+	}
+	t.join("FETCH", err)
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,6 +16,9 @@ import (
 // Date-time format used by INTERNALDATE.
 const DATETIME = `"_2-Jan-2006 15:04:05 -0700"`
 
+// Date format used by SEARCH criteria.
+const SEARCHDATE = "2-Jan-2006"
+
 // Field represents a single data item in a command or response. Fields are
 // separated from one another by a single space. Field slices represent
 // parenthesized lists.
@@ -24,11 +28,11 @@ type Field interface{}
 // QuotedString, LiteralString, List, Bytes, and NIL. Zero is returned for
 // unknown data types.
 func TypeOf(f Field) FieldType {
-	switch f.(type) {
+	switch v := f.(type) {
 	case string:
-		if Quoted(f) {
+		if quoted(v) {
 			return QuotedString
-		} else if len(f.(string)) > 0 {
+		} else if len(v) > 0 {
 			return Atom
 		}
 	case uint32:
@@ -48,7 +52,7 @@ func TypeOf(f Field) FieldType {
 // AsAtom returns the value of an atom field. An empty string is returned if
 // TypeOf(f) != Atom.
 func AsAtom(f Field) string {
-	if v, ok := f.(string); ok && !Quoted(f) {
+	if v, ok := f.(string); ok && !quoted(v) {
 		return v
 	}
 	return ""
@@ -61,20 +65,53 @@ func AsNumber(f Field) uint32 {
 	return v
 }
 
+// AsNumber64 returns the value of a 64-bit numeric field, such as a MODSEQ or
+// X-GM-MSGID value. Numbers that do not fit in 32 bits are received as atoms,
+// which are converted if they contain only decimal digits. Zero is returned
+// for all other fields.
+func AsNumber64(f Field) uint64 {
+	switch v := f.(type) {
+	case uint32:
+		return uint64(v)
+	case string:
+		if !quoted(v) {
+			n, _ := strconv.ParseUint(v, 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
 // AsString returns the value of an astring (string or atom) field. Quoted
 // strings are decoded to their original representation. An empty string is
 // returned if TypeOf(f)&(Atom|QuotedString|LiteralString) == 0 or the string is
 // invalid.
 func AsString(f Field) string {
-	if v, ok := f.(string); ok {
-		if Quoted(f) {
-			v, _ = Unquote(v)
+	s, _ := AsNString(f)
+	return s
+}
+
+// AsNString returns the value of an nstring (string or NIL) field. Unlike
+// AsString, it distinguishes a NIL value, for which ok is false, from an empty
+// string (e.g. a message without a Subject header from one with an empty
+// subject). The value of ok is also false if f is not a string.
+func AsNString(f Field) (s string, ok bool) {
+	switch v := f.(type) {
+	case string:
+		if quoted(v) {
+			s, _ = unquoteString(v)
+			return s, true
 		}
-		return v
-	} else if _, ok = f.(Literal); ok {
-		return string(AsBytes(f))
+		return v, v != ""
+	case Literal:
+		return string(AsBytes(f)), true
 	}
-	return ""
+	return "", false
+}
+
+// IsNil returns true if f represents the NIL atom.
+func IsNil(f Field) bool {
+	return f == nil
 }
 
 // AsBytes returns the value of a data field. Nil is returned if
@@ -84,7 +121,7 @@ func AsBytes(f Field) []byte {
 	case []byte:
 		return v
 	case string:
-		if Quoted(f) {
+		if quoted(v) {
 			b, _ := unquote([]byte(v))
 			return b
 		}
@@ -101,6 +138,15 @@ func AsBytes(f Field) []byte {
 	return nil
 }
 
+// IsBinary returns true if f is a literal string that was received in the RFC
+// 3516 literal8 format (e.g. the value of a BINARY[<section>] data item). Such
+// strings may contain NUL and other octets that are not permitted in regular
+// literals.
+func IsBinary(f Field) bool {
+	l, ok := f.(Literal)
+	return ok && l.Info().Bin
+}
+
 // AsList returns the value of a parenthesized list. Nil is returned if
 // TypeOf(f) != List.
 func AsList(f Field) []Field {
@@ -119,9 +165,36 @@ func AsDateTime(f Field) time.Time {
 	return time.Time{}
 }
 
+// ParseDateTime parses a date-time string in the format used by INTERNALDATE
+// (e.g. "17-Jul-1996 02:44:25 -0700"). The surrounding double quotes are
+// optional. A single-digit day may be preceded by a space or written without
+// one, as permitted by the date-day-fixed ABNF rule.
+func ParseDateTime(s string) (time.Time, error) {
+	if !Quoted(s) {
+		s = `"` + s + `"`
+	}
+	return time.Parse(DATETIME, s)
+}
+
+// FormatDateTime returns t as a quoted date-time string in the format used by
+// INTERNALDATE and the APPEND command. The time zone offset of t is preserved.
+func FormatDateTime(t time.Time) string {
+	return t.Format(DATETIME)
+}
+
+// FormatSearchDate returns the date of t in the format used by SEARCH date
+// criteria (e.g. "17-Jul-1996"). The time and time zone are ignored by the
+// server, so the date is taken from the location of t. Time values that follow
+// date search keys (e.g. SINCE) are converted automatically by Client.Search.
+func FormatSearchDate(t time.Time) string {
+	return t.Format(SEARCHDATE)
+}
+
 // AsMailbox returns the value of a mailbox name field. All valid atoms and
 // strings encoded as quoted UTF-8 or modified UTF-7 are decoded appropriately.
 // The special case-insensitive name "INBOX" is always converted to upper case.
+// The Response decoders do not use modified UTF-7 for responses received after
+// UTF8=ACCEPT is enabled, since the server then sends UTF-8 names instead.
 func AsMailbox(f Field) string {
 	v := AsString(f)
 	if len(v) == 5 && toUpper(v) == "INBOX" {
@@ -174,13 +247,47 @@ func (fm FieldMap) String() string {
 	return "(" + strings.Join(v, " ") + ")"
 }
 
+// Flag is a message flag, mailbox flag, or mailbox attribute. System flags
+// begin with a backslash and are normalized to title case by the response
+// parser (e.g. `\Seen`). Flags without a backslash are user-defined keywords.
+type Flag string
+
+// System flags defined in RFC 3501. FlagRecent cannot be changed by the client
+// and FlagWildcard only appears in PERMANENTFLAGS responses to indicate that
+// new keywords may be created.
+const (
+	FlagSeen     Flag = `\Seen`
+	FlagAnswered Flag = `\Answered`
+	FlagFlagged  Flag = `\Flagged`
+	FlagDeleted  Flag = `\Deleted`
+	FlagDraft    Flag = `\Draft`
+	FlagRecent   Flag = `\Recent`
+	FlagWildcard Flag = `\*`
+)
+
+// IsKeyword returns true if f is a user-defined keyword rather than a system
+// flag.
+func (f Flag) IsKeyword() bool {
+	return f != "" && f[0] != '\\'
+}
+
+// valid returns true if f can be sent in a command. System flags must consist
+// of a backslash followed by an atom and keywords must be atoms.
+func (f Flag) valid() bool {
+	if f != "" && f[0] == '\\' {
+		f = f[1:]
+	}
+	return isAtom(string(f))
+}
+
 // FlagSet represents the flags enabled for a single mailbox or message. The map
 // values are always set to true; a flag must be deleted from the map to
-// indicate that it is not enabled.
-type FlagSet map[string]bool
+// indicate that it is not enabled. A FlagSet may be used as the value of a
+// STORE command or as the flags argument of APPEND.
+type FlagSet map[Flag]bool
 
 // NewFlagSet returns a new flag set with the specified flags enabled.
-func NewFlagSet(flags ...string) FlagSet {
+func NewFlagSet(flags ...Flag) FlagSet {
 	fs := make(FlagSet, len(flags))
 	for _, v := range flags {
 		fs[v] = true
@@ -200,7 +307,7 @@ func AsFlagSet(f Field) FlagSet {
 	v := make(FlagSet, len(list))
 	for _, f := range list {
 		if s := AsAtom(f); s != "" {
-			v[s] = true
+			v[Flag(s)] = true
 		} else {
 			return nil
 		}
@@ -208,6 +315,37 @@ func AsFlagSet(f Field) FlagSet {
 	return v
 }
 
+// Has returns true if flag f is enabled.
+func (fs FlagSet) Has(f Flag) bool {
+	return fs[f]
+}
+
+// Add enables the specified flags. It panics if fs is nil.
+func (fs FlagSet) Add(flags ...Flag) {
+	for _, f := range flags {
+		fs[f] = true
+	}
+}
+
+// Remove disables the specified flags.
+func (fs FlagSet) Remove(flags ...Flag) {
+	for _, f := range flags {
+		delete(fs, f)
+	}
+}
+
+// Keywords returns a sorted list of the user-defined keywords in the set.
+func (fs FlagSet) Keywords() []Flag {
+	var v []Flag
+	for f := range fs {
+		if f.IsKeyword() {
+			v = append(v, f)
+		}
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+	return v
+}
+
 // Replace removes all existing flags from the set and inserts new ones.
 func (fs FlagSet) Replace(f Field) {
 	if list, ok := f.([]Field); ok {
@@ -216,7 +354,7 @@ func (fs FlagSet) Replace(f Field) {
 		}
 		for _, f := range list {
 			if v := AsAtom(f); v != "" {
-				fs[v] = true
+				fs[Flag(v)] = true
 			}
 		}
 	}
@@ -228,7 +366,7 @@ func (fs FlagSet) String() string {
 	}
 	v, i := make([]string, len(fs)), 0
 	for k := range fs {
-		v[i] = k
+		v[i] = string(k)
 		i++
 	}
 	sort.Strings(v)
@@ -0,0 +1,116 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package imap
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// FieldTypeError is returned by As and AsSlice when a field cannot be converted
+// to the requested type.
+type FieldTypeError struct {
+	Field Field  // Original field value
+	Type  string // Requested Go type
+}
+
+func (err *FieldTypeError) Error() string {
+	return fmt.Sprintf("imap: cannot convert %v field %v to %s",
+		TypeOf(err.Field), err.Field, err.Type)
+}
+
+// As converts field f to type T. The following types are supported:
+//
+//	string     - Atom, QuotedString, or LiteralString (see AsString)
+//	uint32     - Number
+//	[]byte     - QuotedString, LiteralString, or Bytes (see AsBytes)
+//	[]Field    - List
+//	Literal    - LiteralString
+//	FieldMap   - List of key/value pairs (see AsFieldMap)
+//	FlagSet    - List of atoms (see AsFlagSet)
+//	Flag       - Atom
+//	time.Time  - QuotedString in the DATETIME format
+//	*Envelope  - ENVELOPE data item
+//	*Address   - Address structure
+//	Field      - Any field (no conversion)
+//
+// For any other type, f is converted using a type assertion. Unlike the AsX
+// functions, which return the zero value for fields of the wrong type, As
+// returns a *FieldTypeError, so NIL and other unexpected values can be
+// detected.
+func As[T any](f Field) (v T, err error) {
+	ok := true
+	switch p := any(&v).(type) {
+	case *string:
+		if ok = TypeOf(f)&(Atom|QuotedString|LiteralString) != 0; ok {
+			*p = AsString(f)
+		}
+	case *uint32:
+		*p, ok = f.(uint32)
+	case *[]byte:
+		if ok = TypeOf(f)&(QuotedString|LiteralString|Bytes) != 0; ok {
+			*p = AsBytes(f)
+		}
+	case *[]Field:
+		*p, ok = f.([]Field)
+	case *Literal:
+		*p, ok = f.(Literal)
+	case *FieldMap:
+		*p = AsFieldMap(f)
+		ok = *p != nil
+	case *FlagSet:
+		*p = AsFlagSet(f)
+		ok = *p != nil
+	case *Flag:
+		*p = Flag(AsAtom(f))
+		ok = *p != ""
+	case *time.Time:
+		*p = AsDateTime(f)
+		ok = !p.IsZero()
+	case **Envelope:
+		*p = AsEnvelope(f)
+		ok = *p != nil
+	case **Address:
+		if list := AsAddressList([]Field{f}); len(list) == 1 {
+			*p = list[0]
+		} else {
+			ok = false
+		}
+	case *Field:
+		*p = f
+	default:
+		v, ok = f.(T)
+	}
+	if !ok {
+		var zero T
+		return zero, &FieldTypeError{f, reflect.TypeOf(&v).Elem().String()}
+	}
+	return
+}
+
+// AsSlice converts a parenthesized list into a slice of type T by calling As
+// for each element. An error is returned if f is not a list or if any of its
+// elements cannot be converted. NIL is converted to a nil slice.
+func AsSlice[T any](f Field) ([]T, error) {
+	if f == nil {
+		return nil, nil
+	}
+	list, ok := f.([]Field)
+	if !ok {
+		return nil, &FieldTypeError{f, reflect.TypeOf([]T(nil)).String()}
+	}
+	v := make([]T, len(list))
+	for i, f := range list {
+		var err error
+		if v[i], err = As[T](f); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
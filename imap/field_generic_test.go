@@ -0,0 +1,62 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAs(t *testing.T) {
+	check := func(name string, in Field, out interface{}, err error, ok bool) {
+		if ok && err != nil {
+			t.Errorf("%s(%v) unexpected error; %v", name, in, err)
+		} else if !ok && err == nil {
+			t.Errorf("%s(%v) expected an error; got %v", name, in, out)
+		} else if _, isType := err.(*FieldTypeError); err != nil && !isType {
+			t.Errorf("%s(%v) expected *FieldTypeError; got %T", name, in, err)
+		}
+	}
+
+	s, err := As[string](`"hello"`)
+	check("As[string]", `"hello"`, s, err, s == "hello")
+	s, err = As[string](nil)
+	check("As[string]", nil, s, err, false)
+	n, err := As[uint32](uint32(42))
+	check("As[uint32]", uint32(42), n, err, n == 42)
+	n, err = As[uint32](`"42"`)
+	check("As[uint32]", `"42"`, n, err, false)
+	b, err := As[[]byte](lit("data"))
+	check("As[[]byte]", lit("data"), b, err, string(b) == "data")
+	fs, err := As[FlagSet]([]Field{`\Seen`})
+	check("As[FlagSet]", `(\Seen)`, fs, err, fs.Has(FlagSeen))
+	fl, err := As[Flag](`\Deleted`)
+	check("As[Flag]", `\Deleted`, fl, err, fl == FlagDeleted)
+	tm, err := As[time.Time](`"17-Jul-1996 02:44:25 -0700"`)
+	check("As[time.Time]", "date", tm, err, tm.Equal(time.Date(1996, time.July, 17, 2, 44, 25, 0, MST)))
+	tm, err = As[time.Time](`"bad date"`)
+	check("As[time.Time]", `"bad date"`, tm, err, false)
+	a, err := As[*Address](addr("A", "a", "example.com"))
+	check("As[*Address]", "addr", a, err, reflect.DeepEqual(a, &Address{"A", "", "a", "example.com"}))
+	f, err := As[Field](nil)
+	check("As[Field]", nil, f, err, f == nil)
+
+	nums, err := AsSlice[uint32]([]Field{uint32(1), uint32(2)})
+	check("AsSlice[uint32]", "(1 2)", nums, err, reflect.DeepEqual(nums, []uint32{1, 2}))
+	nums, err = AsSlice[uint32]([]Field{uint32(1), "x"})
+	check("AsSlice[uint32]", "(1 x)", nums, err, false)
+	nums, err = AsSlice[uint32](nil)
+	check("AsSlice[uint32]", nil, nums, err, nums == nil)
+	strs, err := AsSlice[string](`"x"`)
+	check("AsSlice[string]", `"x"`, strs, err, false)
+
+	if _, err := As[uint32]("ATOM"); err == nil || err.Error() != "imap: cannot convert Atom field ATOM to uint32" {
+		t.Errorf("As[uint32] unexpected error message: %v", err)
+	}
+}
@@ -222,3 +222,136 @@ func TestField(t *testing.T) {
 		t.Errorf("AsBytes took the slow path for *literal")
 	}
 }
+
+func TestDateTime(t *testing.T) {
+	tests := []struct {
+		in  string
+		out time.Time
+		fmt string
+	}{
+		{`17-Jul-1996 02:44:25 -0700`, time.Date(1996, time.July, 17, 2, 44, 25, 0, MST), `"17-Jul-1996 02:44:25 -0700"`},
+		{`"17-Jul-1996 02:44:25 -0700"`, time.Date(1996, time.July, 17, 2, 44, 25, 0, MST), `"17-Jul-1996 02:44:25 -0700"`},
+		{` 7-Jul-1996 02:44:25 -0700`, time.Date(1996, time.July, 7, 2, 44, 25, 0, MST), `" 7-Jul-1996 02:44:25 -0700"`},
+		{`"7-Jul-1996 02:44:25 -0700"`, time.Date(1996, time.July, 7, 2, 44, 25, 0, MST), `" 7-Jul-1996 02:44:25 -0700"`},
+		{`"07-Jul-1996 02:44:25 -0700"`, time.Date(1996, time.July, 7, 2, 44, 25, 0, MST), `" 7-Jul-1996 02:44:25 -0700"`},
+		{`"07-Jul-1996 02:44:25 +0130"`, time.Date(1996, time.July, 7, 2, 44, 25, 0, time.FixedZone("", 90*60)), `" 7-Jul-1996 02:44:25 +0130"`},
+	}
+	for _, test := range tests {
+		out, err := ParseDateTime(test.in)
+		if err != nil || !out.Equal(test.out) {
+			t.Errorf("ParseDateTime(%+q) expected %v; got %v (%v)", test.in, test.out, out, err)
+		}
+		if s := FormatDateTime(test.out); s != test.fmt {
+			t.Errorf("FormatDateTime(%v) expected %+q; got %+q", test.out, test.fmt, s)
+		}
+	}
+	for _, in := range []string{``, `""`, `17-Jul-1996`, `*"17-Jul-1996 02:44:25 -0700"`, `17-Jul-1996 02:44:25`} {
+		if out, err := ParseDateTime(in); err == nil {
+			t.Errorf("ParseDateTime(%+q) expected error; got %v", in, out)
+		}
+	}
+	for _, test := range []struct {
+		in  time.Time
+		out string
+	}{
+		{time.Date(1996, time.July, 17, 2, 44, 25, 0, MST), "17-Jul-1996"},
+		{time.Date(1996, time.July, 7, 23, 0, 0, 0, MST), "7-Jul-1996"},
+		{time.Date(2013, time.January, 1, 0, 0, 0, 0, time.UTC), "1-Jan-2013"},
+	} {
+		if s := FormatSearchDate(test.in); s != test.out {
+			t.Errorf("FormatSearchDate(%v) expected %+q; got %+q", test.in, test.out, s)
+		}
+	}
+}
+
+func TestFlagSet(t *testing.T) {
+	fs := NewFlagSet(FlagSeen, "$Forwarded")
+	if !fs.Has(FlagSeen) || fs.Has(FlagDeleted) {
+		t.Errorf("Has() unexpected result for %v", fs)
+	}
+	fs.Add(FlagDeleted, "NonJunk")
+	fs.Remove(FlagSeen, FlagDraft)
+	if s := fs.String(); s != `($Forwarded NonJunk \Deleted)` {
+		t.Errorf("String() expected ($Forwarded NonJunk \\Deleted); got %s", s)
+	}
+	if kw := fs.Keywords(); !reflect.DeepEqual(kw, []Flag{"$Forwarded", "NonJunk"}) {
+		t.Errorf("Keywords() expected [$Forwarded NonJunk]; got %v", kw)
+	}
+	if FlagRecent.IsKeyword() || !Flag("Junk").IsKeyword() || Flag("").IsKeyword() {
+		t.Errorf("IsKeyword() unexpected result")
+	}
+	if fs := AsFlagSet([]Field{`\Answered`, `Junk`}); !reflect.DeepEqual(fs, NewFlagSet(FlagAnswered, "Junk")) {
+		t.Errorf("AsFlagSet() unexpected result %v", fs)
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		in  Field
+		out bool
+	}{
+		{nil, false},
+		{"atom", false},
+		{[]byte("\x00"), false},
+		{lit("\x00"), false},
+		{lit8("\x00"), true},
+	}
+	for _, test := range tests {
+		if out := IsBinary(test.in); out != test.out {
+			t.Errorf("IsBinary(%v) expected %v; got %v", test.in, test.out, out)
+		}
+	}
+}
+
+func TestNString(t *testing.T) {
+	tests := []struct {
+		in  Field
+		s   string
+		ok  bool
+		nil bool
+	}{
+		{nil, "", false, true},
+		{`""`, "", true, false},
+		{`"x"`, "x", true, false},
+		{"ATOM", "ATOM", true, false},
+		{lit(""), "", true, false},
+		{uint32(0), "", false, false},
+		{[]Field{}, "", false, false},
+	}
+	for _, test := range tests {
+		if s, ok := AsNString(test.in); s != test.s || ok != test.ok {
+			t.Errorf("AsNString(%v) expected %q, %v; got %q, %v", test.in, test.s, test.ok, s, ok)
+		}
+		if isNil := IsNil(test.in); isNil != test.nil {
+			t.Errorf("IsNil(%v) expected %v; got %v", test.in, test.nil, isNil)
+		}
+	}
+}
+
+func TestFieldConversionAllocs(t *testing.T) {
+	fields := []Field{`"Subject line"`, `*"Beschreibung ü"`, "ATOM", uint32(1 << 20)}
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, f := range fields {
+			AsString(f)
+			AsNString(f)
+			AsNumber(f)
+			TypeOf(f)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Field conversion expected 0 allocations; got %v", allocs)
+	}
+	if s := AsString(`"a \"b\" \\ c"`); s != `a "b" \ c` {
+		t.Errorf("AsString() expected %q; got %q", `a "b" \ c`, s)
+	}
+	if s, ok := Unquote("\"bad\xff\""); s != "" || ok {
+		t.Errorf("Unquote() expected invalid UTF-8 to fail; got %q, %v", s, ok)
+	}
+}
+
+func BenchmarkAsString(b *testing.B) {
+	f := Field(`"Re: Quarterly report for the sales department"`)
+	for i := 0; i < b.N; i++ {
+		AsString(f)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FlagDelta is a change that converts the flags of a group of messages from
+// their current state to the desired one.
+type FlagDelta struct {
+	UIDs   *SeqSet // Affected messages
+	Add    []Flag  // Flags to add, sorted
+	Remove []Flag  // Flags to remove, sorted
+}
+
+// DiffFlags compares the desired flags of each message in want with its current
+// flags in have, both keyed by UID, and returns the changes needed to make them
+// equal. Messages with identical changes are grouped into a single FlagDelta,
+// so each delta can be applied with one or two STORE commands. Messages that
+// are missing from either map are ignored, as is the \Recent flag, which
+// cannot be changed by the client. The deltas are sorted by their first UID.
+func DiffFlags(want, have map[uint32]FlagSet) []*FlagDelta {
+	groups := make(map[string]*FlagDelta)
+	var deltas []*FlagDelta
+	uids := make([]uint32, 0, len(want))
+	for uid := range want {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	for _, uid := range uids {
+		cur, ok := have[uid]
+		if !ok {
+			continue
+		}
+		add, rem := flagDiff(want[uid], cur), flagDiff(cur, want[uid])
+		if len(add) == 0 && len(rem) == 0 {
+			continue
+		}
+		key := flagKey(add) + "\x00" + flagKey(rem)
+		d := groups[key]
+		if d == nil {
+			d = &FlagDelta{UIDs: new(SeqSet), Add: add, Remove: rem}
+			groups[key] = d
+			deltas = append(deltas, d)
+		}
+		d.UIDs.AddNum(uid)
+	}
+	return deltas
+}
+
+// SyncFlags makes the flags of the messages in the selected mailbox equal to
+// want, which is keyed by UID. The current flags are fetched with UID FETCH and
+// compared using DiffFlags, then each delta is applied with silent UID STORE
+// commands (see StoreBatch). The applied deltas are returned.
+//
+// If have contains the server flags as of the mod-sequence modseq (e.g. from a
+// previous SyncFlags call) and the server supports CONDSTORE (RFC 7162), only
+// the flags of the messages changed since then are fetched using the
+// CHANGEDSINCE modifier. In that case, have is updated with the fetched flags
+// and the applied changes. Otherwise, the flags of all messages in want are
+// fetched and have is not used, so it may be nil. UIDs are used regardless of
+// s.UID.
+func (s *Session) SyncFlags(want, have map[uint32]FlagSet, modseq uint64) ([]*FlagDelta, error) {
+	c := s.Client
+	uids := new(SeqSet)
+	for uid := range want {
+		uids.AddNum(uid)
+	}
+	if uids.Empty() {
+		return nil, nil
+	}
+	items := []Field{"UID", "FLAGS"}
+	var cmd *Command
+	var err error
+	if have != nil && modseq > 0 && (c.Caps["CONDSTORE"] || c.Caps["QRESYNC"]) {
+		mod := []Field{"CHANGEDSINCE", strconv.FormatUint(modseq, 10)}
+		cmd, err = Wait(c.Send("UID FETCH", uids, items, mod))
+	} else {
+		have = make(map[uint32]FlagSet, len(want))
+		cmd, err = Wait(c.Send("UID FETCH", uids, items))
+	}
+	if err != nil {
+		return nil, err
+	}
+	for uid, msg := range cmd.MessagesByUID() {
+		if msg.Flags != nil {
+			have[uid] = msg.Flags
+		}
+	}
+	deltas := DiffFlags(want, have)
+	return deltas, s.applyFlags(deltas, have)
+}
+
+// EnsureFlags makes sure that the messages with the specified UIDs have all of
+// the flags in want and none of the flags in unwanted. The current flags are
+// fetched first and STORE commands are only issued for the messages that need
+// to be changed, which avoids increasing their mod-sequences and sending
+// needless updates to other clients. The UIDs of the changed messages are
+// returned. UIDs are used regardless of s.UID.
+func (s *Session) EnsureFlags(uids *SeqSet, want, unwanted []Flag) (*SeqSet, error) {
+	changed := new(SeqSet)
+	if uids.Empty() || len(want)+len(unwanted) == 0 {
+		return changed, nil
+	}
+	cmd, err := Wait(s.Client.UIDFetch(uids, "UID", "FLAGS"))
+	if err != nil {
+		return changed, err
+	}
+	have := make(map[uint32]FlagSet)
+	target := make(map[uint32]FlagSet)
+	for uid, msg := range cmd.MessagesByUID() {
+		if msg.Flags == nil {
+			continue
+		}
+		fs := NewFlagSet()
+		for f := range msg.Flags {
+			fs[f] = true
+		}
+		fs.Add(want...)
+		fs.Remove(unwanted...)
+		have[uid], target[uid] = msg.Flags, fs
+	}
+	deltas := DiffFlags(target, have)
+	for _, d := range deltas {
+		changed.AddSet(d.UIDs)
+	}
+	return changed, s.applyFlags(deltas, have)
+}
+
+// applyFlags applies the deltas with silent UID STORE commands and updates the
+// flags in have to match.
+func (s *Session) applyFlags(deltas []*FlagDelta, have map[uint32]FlagSet) (err error) {
+	us := &Session{Client: s.Client, UID: true}
+	for _, d := range deltas {
+		if len(d.Add) > 0 {
+			if _, err = us.StoreBatch(&StoreRequest{d.UIDs, StoreAdd, d.Add, true}); err != nil {
+				return
+			}
+		}
+		if len(d.Remove) > 0 {
+			if _, err = us.StoreBatch(&StoreRequest{d.UIDs, StoreRemove, d.Remove, true}); err != nil {
+				return
+			}
+		}
+		d.UIDs.Nums(func(uid uint32) bool {
+			if fs := have[uid]; fs != nil {
+				fs.Add(d.Add...)
+				fs.Remove(d.Remove...)
+			}
+			return true
+		})
+	}
+	return
+}
+
+// flagDiff returns the sorted flags in a that are not in b, excluding \Recent.
+func flagDiff(a, b FlagSet) (v []Flag) {
+	for f := range a {
+		if !b[f] && f != FlagRecent {
+			v = append(v, f)
+		}
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+	return
+}
+
+// flagKey returns a string that identifies a sorted list of flags.
+func flagKey(flags []Flag) string {
+	s := make([]string, len(flags))
+	for i, f := range flags {
+		s[i] = string(f)
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,128 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffFlags(t *testing.T) {
+	want := map[uint32]FlagSet{
+		1: NewFlagSet(FlagSeen),
+		2: NewFlagSet(FlagSeen),
+		3: NewFlagSet(FlagSeen, FlagFlagged),
+		4: NewFlagSet(),
+		5: NewFlagSet(FlagSeen),
+		6: NewFlagSet(FlagSeen),
+	}
+	have := map[uint32]FlagSet{
+		1: NewFlagSet(),
+		2: NewFlagSet(FlagRecent),
+		3: NewFlagSet(FlagSeen, FlagFlagged),
+		4: NewFlagSet(FlagSeen, "$Junk"),
+		5: NewFlagSet(FlagDraft),
+		7: NewFlagSet(),
+	}
+	var out []string
+	for _, d := range DiffFlags(want, have) {
+		out = append(out, d.UIDs.String()+" +"+flagKey(d.Add)+" -"+flagKey(d.Remove))
+	}
+	exp := []string{
+		`1:2 +\Seen -`,
+		`4 + -$Junk \Seen`,
+		`5 +\Seen -\Draft`,
+	}
+	if !reflect.DeepEqual(out, exp) {
+		t.Errorf("DiffFlags() expected %q; got %q", exp, out)
+	}
+}
+
+func TestSessionSyncFlags(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 CONDSTORE] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	want := map[uint32]FlagSet{
+		1: NewFlagSet(FlagSeen),
+		2: NewFlagSet(FlagSeen),
+		3: NewFlagSet(FlagFlagged),
+	}
+	go t.script(
+		`C: A1 UID FETCH 1:3 (UID FLAGS)`+CRLF,
+		`S: * 1 FETCH (UID 1 FLAGS ())`+CRLF,
+		`S: * 2 FETCH (UID 2 FLAGS (\Recent))`+CRLF,
+		`S: * 3 FETCH (UID 3 FLAGS (\Seen))`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID STORE 1:2 +FLAGS.SILENT (\Seen)`+CRLF,
+		`S: A2 OK STORE completed`+CRLF,
+		`C: A3 UID STORE 3 +FLAGS.SILENT (\Flagged)`+CRLF,
+		`S: A3 OK STORE completed`+CRLF,
+		`C: A4 UID STORE 3 -FLAGS.SILENT (\Seen)`+CRLF,
+		`S: A4 OK STORE completed`+CRLF,
+	)
+	deltas, err := S.SyncFlags(want, nil, 0)
+	t.join("UID STORE", err)
+	if len(deltas) != 2 {
+		t.Errorf("SyncFlags() expected 2 deltas; got %d", len(deltas))
+	}
+
+	have := map[uint32]FlagSet{
+		1: NewFlagSet(FlagSeen),
+		2: NewFlagSet(FlagSeen),
+		3: NewFlagSet(FlagFlagged),
+	}
+	go t.script(
+		`C: A5 UID FETCH 1:3 (UID FLAGS) (CHANGEDSINCE 100)`+CRLF,
+		`S: * 2 FETCH (UID 2 FLAGS () MODSEQ (105))`+CRLF,
+		`S: A5 OK FETCH completed`+CRLF,
+		`C: A6 UID STORE 2 +FLAGS.SILENT (\Seen)`+CRLF,
+		`S: A6 OK STORE completed`+CRLF,
+	)
+	deltas, err = S.SyncFlags(want, have, 100)
+	t.join("UID STORE", err)
+	if len(deltas) != 1 || !reflect.DeepEqual(have, want) {
+		t.Errorf("SyncFlags(CHANGEDSINCE) unexpected result %v, %v", deltas, have)
+	}
+}
+
+func TestSessionEnsureFlags(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 UID FETCH 1:4 (UID FLAGS)`+CRLF,
+		`S: * 1 FETCH (UID 1 FLAGS (\Seen))`+CRLF,
+		`S: * 2 FETCH (UID 2 FLAGS ())`+CRLF,
+		`S: * 3 FETCH (UID 3 FLAGS ($Junk))`+CRLF,
+		`S: * 4 FETCH (UID 4 FLAGS (\Answered))`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID STORE 2,4 +FLAGS.SILENT (\Seen)`+CRLF,
+		`S: A2 OK STORE completed`+CRLF,
+		`C: A3 UID STORE 3 +FLAGS.SILENT (\Seen)`+CRLF,
+		`S: A3 OK STORE completed`+CRLF,
+		`C: A4 UID STORE 3 -FLAGS.SILENT ($Junk)`+CRLF,
+		`S: A4 OK STORE completed`+CRLF,
+	)
+	changed, err := S.EnsureFlags(newSeqSet("1:4"), []Flag{FlagSeen}, []Flag{"$Junk"})
+	t.join("UID STORE", err)
+	if changed.String() != "2:4" {
+		t.Errorf("EnsureFlags() expected 2:4; got %v", changed)
+	}
+
+	go t.script(
+		`C: A5 UID FETCH 1 (UID FLAGS)`+CRLF,
+		`S: * 1 FETCH (UID 1 FLAGS (\Seen))`+CRLF,
+		`S: A5 OK FETCH completed`+CRLF,
+	)
+	changed, err = S.EnsureFlags(newSeqSet("1"), []Flag{FlagSeen}, nil)
+	t.join("UID FETCH", err)
+	if !changed.Empty() {
+		t.Errorf("EnsureFlags() expected no changes; got %v", changed)
+	}
+}
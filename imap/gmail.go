@@ -0,0 +1,185 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// ErrNoAllMail is returned by Session.FetchGmailThread if the All Mail
+// mailbox cannot be found.
+var ErrNoAllMail = errors.New("imap: all mail mailbox not found")
+
+// gmailThreadItems are the data items fetched by Session.FetchGmailThread if
+// none are specified.
+var gmailThreadItems = []string{"FLAGS", "INTERNALDATE", "RFC822.SIZE",
+	"ENVELOPE", "X-GM-MSGID", "X-GM-THRID", "X-GM-LABELS"}
+
+// FetchGmailThread returns all messages in the Gmail conversation of the
+// message with the specified UID, ordered by INTERNALDATE and UID. The thread
+// ID (X-GM-THRID) of the message is fetched first, then the messages of the
+// thread are found with UID SEARCH and retrieved with UID FETCH using the
+// given data items (flags, envelope, and Gmail attributes by default). UIDs
+// are used regardless of s.UID. ErrNoSection is returned if the message does
+// not exist. The server must advertise the X-GM-EXT-1 capability.
+//
+// By default, only the selected mailbox is searched. If allMail is true, the
+// thread is looked up in the All Mail mailbox (see AttrAll), which also
+// contains sent and archived messages. All Mail is examined (opened read-only)
+// for the search and the original mailbox is selected again before returning,
+// so the returned UIDs refer to All Mail and any pending changes in the
+// original mailbox are reported again by the new SELECT.
+func (s *Session) FetchGmailThread(uid uint32, allMail bool, items ...string) (msgs []*MessageInfo, err error) {
+	c := s.Client
+	if !c.Caps["X-GM-EXT-1"] {
+		return nil, NotAvailableError("X-GM-EXT-1")
+	}
+	us := &Session{Client: c, UID: true}
+	if msgs, err = us.Fetch(NewSeqSetNums([]uint32{uid}), "X-GM-THRID"); err != nil {
+		return nil, err
+	}
+	var thrid uint64
+	for _, msg := range msgs {
+		if msg.UID == uid {
+			thrid = msg.GmailThreadID
+		}
+	}
+	if thrid == 0 {
+		return nil, ErrNoSection
+	}
+	if allMail && c.Mailbox != nil {
+		var list []*MailboxInfo
+		if list, err = s.List("", "*"); err != nil {
+			return nil, err
+		}
+		m, ok := ResolveSpecialUse(list)[AttrAll]
+		if !ok {
+			return nil, ErrNoAllMail
+		}
+		if orig := *c.Mailbox; m.Mailbox.Name != orig.Name {
+			if _, err = s.Select(m.Mailbox.Name, true); err != nil {
+				return nil, err
+			}
+			defer func() {
+				if _, serr := s.Select(orig.Name, orig.ReadOnly); err == nil {
+					err = serr
+				}
+			}()
+		}
+	}
+	return us.gmailThread(thrid, items)
+}
+
+// gmailThread fetches the messages of the Gmail thread thrid from the selected
+// mailbox.
+func (s *Session) gmailThread(thrid uint64, items []string) ([]*MessageInfo, error) {
+	uids, err := s.Search("X-GM-THRID", strconv.FormatUint(thrid, 10))
+	if err != nil || len(uids) == 0 {
+		return nil, err
+	}
+	if len(items) == 0 {
+		items = gmailThreadItems
+	}
+	msgs, err := s.Fetch(NewSeqSetNums(uids), items...)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		a, b := msgs[i], msgs[j]
+		if !a.InternalDate.Equal(b.InternalDate) {
+			return a.InternalDate.Before(b.InternalDate)
+		}
+		return a.UID < b.UID
+	})
+	return msgs, nil
+}
+
+// EnsureLabels makes sure that the messages with the specified UIDs have all of
+// the Gmail labels in want and none of the labels in unwanted. Like
+// EnsureFlags, the current labels (X-GM-LABELS) are fetched first and STORE
+// commands are only issued for the messages that need to be changed, grouped by
+// identical changes. The UIDs of the changed messages are returned. UIDs are
+// used regardless of s.UID. The server must advertise the X-GM-EXT-1
+// capability.
+func (s *Session) EnsureLabels(uids *SeqSet, want, unwanted []string) (*SeqSet, error) {
+	c := s.Client
+	changed := new(SeqSet)
+	if !c.Caps["X-GM-EXT-1"] {
+		return changed, NotAvailableError("X-GM-EXT-1")
+	} else if uids.Empty() || len(want)+len(unwanted) == 0 {
+		return changed, nil
+	}
+	cmd, err := Wait(c.UIDFetch(uids, "UID", "X-GM-LABELS"))
+	if err != nil {
+		return changed, err
+	}
+	// Labels are diffed as flags to reuse the grouping logic of DiffFlags
+	have := make(map[uint32]FlagSet)
+	target := make(map[uint32]FlagSet)
+	for uid, msg := range cmd.MessagesByUID() {
+		if _, ok := msg.Attrs["X-GM-LABELS"]; !ok {
+			continue
+		}
+		cur, fs := NewFlagSet(), NewFlagSet()
+		for _, label := range msg.GmailLabels {
+			label = c.decodeLabel(label)
+			cur[Flag(label)], fs[Flag(label)] = true, true
+		}
+		for _, label := range want {
+			fs[Flag(label)] = true
+		}
+		for _, label := range unwanted {
+			delete(fs, Flag(label))
+		}
+		have[uid], target[uid] = cur, fs
+	}
+	for _, d := range DiffFlags(target, have) {
+		for _, op := range []struct {
+			item   string
+			labels []Flag
+		}{{"+X-GM-LABELS.SILENT", d.Add}, {"-X-GM-LABELS.SILENT", d.Remove}} {
+			if len(op.labels) == 0 {
+				continue
+			}
+			labels := make([]Field, len(op.labels))
+			for i, label := range op.labels {
+				labels[i] = c.encodeLabel(string(label))
+			}
+			for _, seq := range d.UIDs.Split(MaxStoreSetLen) {
+				if _, err = Wait(c.UIDStore(seq, op.item, labels)); err != nil {
+					return changed, err
+				}
+			}
+		}
+		changed.AddSet(d.UIDs)
+	}
+	return changed, nil
+}
+
+// encodeLabel encodes a label as a STORE argument. Like mailbox names, labels
+// are sent in modified UTF-7 unless UTF8=ACCEPT is enabled. System labels (e.g.
+// \Important) are sent as flags, because Gmail treats quoted names as user
+// labels.
+func (c *Client) encodeLabel(label string) Field {
+	if len(label) > 1 && label[0] == '\\' && isAtom(label[1:]) {
+		return label
+	} else if !c.Enabled["UTF8=ACCEPT"] {
+		label = UTF7Encode(label)
+	}
+	return encodeString(label, true)
+}
+
+// decodeLabel is the reverse of encodeLabel for labels returned in
+// X-GM-LABELS. Labels that are not valid modified UTF-7 are returned as is.
+func (c *Client) decodeLabel(label string) string {
+	if !c.Enabled["UTF8=ACCEPT"] {
+		if s, err := UTF7Decode(label); err == nil {
+			return s
+		}
+	}
+	return label
+}
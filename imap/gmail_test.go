@@ -0,0 +1,128 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSessionFetchGmailThread(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 X-GM-EXT-1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 UID FETCH 5 (X-GM-THRID)`+CRLF,
+		`S: * 2 FETCH (UID 5 X-GM-THRID 1266894439832287888)`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID SEARCH X-GM-THRID 1266894439832287888`+CRLF,
+		`S: * SEARCH 5 3`+CRLF,
+		`S: A2 OK SEARCH completed`+CRLF,
+		`C: A3 UID FETCH 3,5 (FLAGS INTERNALDATE RFC822.SIZE ENVELOPE X-GM-MSGID X-GM-THRID X-GM-LABELS)`+CRLF,
+		`S: * 1 FETCH (UID 3 INTERNALDATE "02-Jan-2024 10:00:00 +0000" X-GM-THRID 1266894439832287888)`+CRLF,
+		`S: * 2 FETCH (UID 5 INTERNALDATE "01-Jan-2024 10:00:00 +0000" X-GM-THRID 1266894439832287888)`+CRLF,
+		`S: A3 OK FETCH completed`+CRLF,
+	)
+	msgs, err := S.FetchGmailThread(5, false)
+	t.join("UID FETCH", err)
+	var uids []uint32
+	for _, msg := range msgs {
+		uids = append(uids, msg.UID)
+	}
+	if want := []uint32{5, 3}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("FetchGmailThread() expected UIDs %v; got %v", want, uids)
+	}
+
+	go t.script(
+		`C: A4 UID FETCH 5 (X-GM-THRID)`+CRLF,
+		`S: * 2 FETCH (UID 5 X-GM-THRID 42)`+CRLF,
+		`S: A4 OK FETCH completed`+CRLF,
+		`C: A5 LIST "" "*"`+CRLF,
+		`S: * LIST (\HasNoChildren) "/" "INBOX"`+CRLF,
+		`S: * LIST (\HasNoChildren \All) "/" "[Gmail]/All Mail"`+CRLF,
+		`S: A5 OK LIST completed`+CRLF,
+		`C: A6 EXAMINE "[Gmail]/All Mail"`+CRLF,
+		`S: * 10 EXISTS`+CRLF,
+		`S: A6 OK [READ-ONLY] EXAMINE completed`+CRLF,
+		`C: A7 UID SEARCH X-GM-THRID 42`+CRLF,
+		`S: * SEARCH 7 9`+CRLF,
+		`S: A7 OK SEARCH completed`+CRLF,
+		`C: A8 UID FETCH 7,9 (FLAGS)`+CRLF,
+		`S: * 3 FETCH (UID 7 FLAGS (\Seen))`+CRLF,
+		`S: * 5 FETCH (UID 9 FLAGS ())`+CRLF,
+		`S: A8 OK FETCH completed`+CRLF,
+		`C: A9 SELECT "INBOX"`+CRLF,
+		`S: * 2 EXISTS`+CRLF,
+		`S: A9 OK [READ-WRITE] SELECT completed`+CRLF,
+	)
+	msgs, err = S.FetchGmailThread(5, true, "FLAGS")
+	t.join("SELECT", err)
+	if len(msgs) != 2 || msgs[0].UID != 7 || msgs[1].UID != 9 {
+		t.Errorf("FetchGmailThread(allMail) unexpected messages %v", msgs)
+	}
+	if C.Mailbox == nil || C.Mailbox.Name != "INBOX" || C.Mailbox.ReadOnly {
+		t.Errorf("FetchGmailThread(allMail) did not restore INBOX; got %v", C.Mailbox)
+	}
+
+	delete(C.Caps, "X-GM-EXT-1")
+	if _, err = S.FetchGmailThread(5, false); err != NotAvailableError("X-GM-EXT-1") {
+		t.Errorf("FetchGmailThread() expected NotAvailableError; got %v", err)
+	}
+}
+
+func TestSessionEnsureLabels(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 X-GM-EXT-1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 UID FETCH 7:9 (UID X-GM-LABELS)`+CRLF,
+		`S: * 1 FETCH (UID 7 X-GM-LABELS (Work))`+CRLF,
+		`S: * 2 FETCH (UID 8 X-GM-LABELS ("\\Inbox"))`+CRLF,
+		`S: * 3 FETCH (UID 9 X-GM-LABELS ("\\Inbox" "My Label"))`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+		`C: A2 UID STORE 8:9 +X-GM-LABELS.SILENT (Work)`+CRLF,
+		`S: A2 OK STORE completed`+CRLF,
+		`C: A3 UID STORE 8:9 -X-GM-LABELS.SILENT (\Inbox)`+CRLF,
+		`S: A3 OK STORE completed`+CRLF,
+	)
+	changed, err := S.EnsureLabels(newSeqSet("7:9"), []string{"Work"}, []string{`\Inbox`})
+	t.join("UID STORE", err)
+	if changed.String() != "8:9" {
+		t.Errorf("EnsureLabels() expected 8:9; got %v", changed)
+	}
+
+	go t.script(
+		`C: A4 UID FETCH 7 (UID X-GM-LABELS)`+CRLF,
+		`S: * 1 FETCH (UID 7 X-GM-LABELS (Work))`+CRLF,
+		`S: A4 OK FETCH completed`+CRLF,
+		`C: A5 UID STORE 7 +X-GM-LABELS.SILENT ("My Label" \Important)`+CRLF,
+		`S: A5 OK STORE completed`+CRLF,
+	)
+	changed, err = S.EnsureLabels(newSeqSet("7"), []string{`\Important`, "My Label"}, nil)
+	t.join("UID STORE", err)
+	if changed.String() != "7" {
+		t.Errorf("EnsureLabels() expected 7; got %v", changed)
+	}
+
+	// Non-ASCII labels are compared and sent in modified UTF-7
+	go t.script(
+		`C: A6 UID FETCH 7 (UID X-GM-LABELS)`+CRLF,
+		`S: * 1 FETCH (UID 7 X-GM-LABELS ("&AMk-t&AOk-"))`+CRLF,
+		`S: A6 OK FETCH completed`+CRLF,
+		`C: A7 UID STORE 7 +X-GM-LABELS.SILENT ("&AMk-t&AOk- 2")`+CRLF,
+		`S: A7 OK STORE completed`+CRLF,
+		`C: A8 UID STORE 7 -X-GM-LABELS.SILENT (&AMk-t&AOk-)`+CRLF,
+		`S: A8 OK STORE completed`+CRLF,
+	)
+	changed, err = S.EnsureLabels(newSeqSet("7"), []string{"Été 2"}, []string{"Été"})
+	t.join("UID STORE", err)
+	if changed.String() != "7" {
+		t.Errorf("EnsureLabels() expected 7; got %v", changed)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// ErrBadHeader is returned by FormatMessage for header field names that are not
+// valid in RFC 5322 and values with line breaks that do not start a folded line.
+var ErrBadHeader = errors.New("imap: invalid message header field")
+
+// headerDec decodes RFC 2047 encoded-words in header values.
+var headerDec = mime.WordDecoder{CharsetReader: charsetReader}
+
+// AsHeader returns the message header contained in a RFC822.HEADER,
+// BODY[HEADER], BODY[HEADER.FIELDS (...)], or BODY[<part>.MIME] data item.
+// Folded header lines are joined, but encoded-words are not decoded (see
+// DecodeHeader), because doing so may change the meaning of structured fields
+// such as address lists. Nil is returned if f does not contain a valid header.
+func AsHeader(f Field) textproto.MIMEHeader {
+	b := AsBytes(f)
+	if len(b) == 0 {
+		return nil
+	}
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(b)))
+	hdr, err := r.ReadMIMEHeader()
+	if err != nil && err != io.EOF || len(hdr) == 0 {
+		return nil
+	}
+	return hdr
+}
+
+// AsMailHeader returns the message header contained in f as a mail.Header,
+// which provides methods for parsing dates and address lists. Nil is returned
+// if f does not contain a valid header.
+func AsMailHeader(f Field) mail.Header {
+	if hdr := AsHeader(f); hdr != nil {
+		return mail.Header(hdr)
+	}
+	return nil
+}
+
+// Header returns all header fields contained in the RFC822.HEADER,
+// BODY[HEADER], and BODY[HEADER.FIELDS (...)] attributes of the message. Part
+// headers (BODY[<part>.HEADER] or BODY[<part>.MIME]) are not included. Nil is
+// returned if none of these attributes are available.
+func (msg *MessageInfo) Header() textproto.MIMEHeader {
+	var hdr textproto.MIMEHeader
+	for name, f := range msg.Attrs {
+		if name != "RFC822.HEADER" && name != "BODY[HEADER]" &&
+			!strings.HasPrefix(name, "BODY[HEADER.FIELDS") {
+			continue
+		}
+		for k, v := range AsHeader(f) {
+			if hdr == nil {
+				hdr = make(textproto.MIMEHeader)
+			}
+			hdr[k] = append(hdr[k], v...)
+		}
+	}
+	return hdr
+}
+
+// DecodeHeader decodes all RFC 2047 encoded-words in s. The original string is
+// returned if s cannot be decoded. Charsets other than UTF-8, US-ASCII, and
+// ISO-8859-1 require CharsetReader.
+func DecodeHeader(s string) string {
+	if strings.Contains(s, "=?") {
+		if d, err := headerDec.DecodeHeader(s); err == nil {
+			return d
+		}
+	}
+	return s
+}
+
+// FormatMessage serializes a message header and body in RFC 5322 format, as
+// required by APPEND. Header fields are written in sorted order, with multiple
+// values of the same field on separate lines. All line endings in the header
+// and body are converted to CRLF. Body may be nil for a message without a body.
+// ErrBadHeader is returned if a field name is invalid or a line break in a value
+// is not followed by a space or tab, which would start a new header field.
+func FormatMessage(h mail.Header, body io.Reader) ([]byte, error) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b []byte
+	for _, k := range keys {
+		if !isFieldName(k) {
+			return nil, ErrBadHeader
+		}
+		for _, v := range h[k] {
+			v = strings.TrimRight(v, "\r\n")
+			if !isFieldValue(v) {
+				return nil, ErrBadHeader
+			}
+			b = append(b, k...)
+			b = append(b, ": "...)
+			b = appendCRLF(b, []byte(v))
+			b = append(b, crlf...)
+		}
+	}
+	b = append(b, crlf...)
+	if body != nil {
+		text, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		b = appendCRLF(b, text)
+	}
+	return b, nil
+}
+
+// isFieldName returns true if k is a valid RFC 5322 header field name, which
+// consists of printable US-ASCII characters other than colon.
+func isFieldName(k string) bool {
+	for i := 0; i < len(k); i++ {
+		if c := k[i]; c <= ' ' || c == ':' || c >= 0x7F {
+			return false
+		}
+	}
+	return len(k) > 0
+}
+
+// isFieldValue returns true if every line break in v is followed by a space or
+// tab, so that the value cannot be split into additional header fields.
+func isFieldValue(v string) bool {
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case cr:
+			if i+1 < len(v) && v[i+1] == lf {
+				i++
+			}
+			fallthrough
+		case lf:
+			if i+1 == len(v) || (v[i+1] != ' ' && v[i+1] != '\t') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// appendCRLF appends src to dst, converting bare CR and LF characters to CRLF.
+func appendCRLF(dst, src []byte) []byte {
+	for i := 0; i < len(src); i++ {
+		switch c := src[i]; c {
+		case cr:
+			if i+1 < len(src) && src[i+1] == lf {
+				i++
+			}
+			fallthrough
+		case lf:
+			dst = append(dst, crlf...)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,92 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"net/mail"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		in  Field
+		out textproto.MIMEHeader
+	}{
+		{nil, nil},
+		{lit(""), nil},
+		{lit("\r\n"), nil},
+		{lit("Subject: Hello\r\n\r\n"), textproto.MIMEHeader{"Subject": {"Hello"}}},
+		{lit("subject: =?utf-8?q?Caf=C3=A9?=\r\n world\r\nX-A: 1\r\nx-a: 2\r\n\r\n"),
+			textproto.MIMEHeader{"Subject": {"=?utf-8?q?Caf=C3=A9?= world"}, "X-A": {"1", "2"}}},
+		{lit("To: a@example.com"), textproto.MIMEHeader{"To": {"a@example.com"}}},
+		{`"Subject: x"`, textproto.MIMEHeader{"Subject": {"x"}}},
+	}
+	for _, test := range tests {
+		if out := AsHeader(test.in); !reflect.DeepEqual(out, test.out) {
+			t.Errorf("AsHeader(%v) expected\n%v; got\n%v", test.in, test.out, out)
+		}
+	}
+
+	if s := DecodeHeader("=?utf-8?q?Caf=C3=A9?= world"); s != "Café world" {
+		t.Errorf("DecodeHeader() expected \"Café world\"; got %q", s)
+	}
+
+	hdr := AsMailHeader(lit("From: =?iso-8859-1?q?Andr=E9?= <andre@example.com>\r\n\r\n"))
+	if list, err := hdr.AddressList("From"); err != nil || len(list) != 1 || list[0].Name != "André" {
+		t.Errorf("AddressList() unexpected result %v; %v", list, err)
+	}
+
+	msg := &MessageInfo{Attrs: FieldMap{
+		"BODY[HEADER.FIELDS (SUBJECT)]": lit("Subject: Hi\r\n\r\n"),
+		"BODY[HEADER.FIELDS (TO)]":      lit("To: a@b\r\n\r\n"),
+		"BODY[1.MIME]":                  lit("Content-Type: text/plain\r\n\r\n"),
+	}}
+	want := textproto.MIMEHeader{"Subject": {"Hi"}, "To": {"a@b"}}
+	if out := msg.Header(); !reflect.DeepEqual(out, want) {
+		t.Errorf("Header() expected\n%v; got\n%v", want, out)
+	}
+	if out := (&MessageInfo{}).Header(); out != nil {
+		t.Errorf("Header() expected nil; got %v", out)
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	msg, err := mail.ReadMessage(strings.NewReader(
+		"Subject: Hi\nTo: a@example.com\nX-A: 1\nX-A: 2\n\nline 1\nline 2\r\nline 3\r"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := FormatMessage(msg.Header, msg.Body)
+	want := "Subject: Hi\r\nTo: a@example.com\r\nX-A: 1\r\nX-A: 2\r\n\r\n" +
+		"line 1\r\nline 2\r\nline 3\r\n"
+	if err != nil || string(b) != want {
+		t.Errorf("FormatMessage() expected %q; got %q (%v)", want, b, err)
+	}
+	if b, _ = FormatMessage(mail.Header{"Subject": {"Hi"}}, nil); string(b) != "Subject: Hi\r\n\r\n" {
+		t.Errorf("FormatMessage() unexpected result %q", b)
+	}
+
+	// Folded values are allowed, but values and names that would inject
+	// additional header fields are not
+	if b, err = FormatMessage(mail.Header{"Subject": {"a\n b\r\n\tc"}}, nil); err != nil ||
+		string(b) != "Subject: a\r\n b\r\n\tc\r\n\r\n" {
+		t.Errorf("FormatMessage() unexpected result %q (%v)", b, err)
+	}
+	for _, h := range []mail.Header{
+		{"Subject": {"Hi\nBcc: x@example.com"}},
+		{"Subject": {"Hi\rBcc: x@example.com"}},
+		{"Subject": {"Hi\n\n body"}},
+		{"Bcc: x@example.com\r\nSubject": {"Hi"}},
+		{"Sub ject": {"Hi"}},
+		{"": {"Hi"}},
+	} {
+		if _, err = FormatMessage(h, nil); err != ErrBadHeader {
+			t.Errorf("FormatMessage(%q) expected ErrBadHeader; got %v", h, err)
+		}
+	}
+}
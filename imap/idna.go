@@ -0,0 +1,292 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Normalize, if non-nil, is used to normalize Unicode text before IDNA
+// conversion and address comparison. It should return the NFC form of s (e.g.
+// using golang.org/x/text/unicode/norm). Without it, strings that differ only
+// in their composition are considered to be different. It is a package variable,
+// not a Client option, because DomainToASCII and Address.Equal do not have a
+// Client. It should be set once during program initialization.
+var Normalize func(s string) string
+
+// ErrBadDomain is returned when a domain name cannot be converted between the
+// Unicode and ASCII (IDNA) forms.
+var ErrBadDomain = errors.New("imap: invalid internationalized domain name")
+
+// acePrefix identifies IDNA labels that are encoded with Punycode.
+const acePrefix = "xn--"
+
+// DomainToASCII converts a domain name containing U-labels (e.g. "münchen.de")
+// to its ASCII form, in which each non-ASCII label is encoded with Punycode
+// (e.g. "xn--mnchen-3ya.de"), as described in RFC 5891. Labels are converted to
+// lower case. Full IDNA2008 validation is not performed.
+func DomainToASCII(domain string) (string, error) {
+	labels := splitDomain(domain)
+	for i, label := range labels {
+		if isASCII(label) {
+			labels[i] = toLower(label)
+			continue
+		}
+		label = strings.ToLower(normalizeNFC(label))
+		enc, err := punyEncode(label)
+		if err != nil {
+			return "", err
+		} else if len(enc)+len(acePrefix) > 63 {
+			return "", ErrBadDomain
+		}
+		labels[i] = acePrefix + enc
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// DomainToUnicode converts a domain name containing Punycode-encoded A-labels
+// (e.g. "xn--mnchen-3ya.de") to its Unicode form (e.g. "münchen.de"). Other
+// labels are converted to lower case.
+func DomainToUnicode(domain string) (string, error) {
+	labels := splitDomain(domain)
+	for i, label := range labels {
+		label = toLower(label)
+		if len(label) > len(acePrefix) && label[:len(acePrefix)] == acePrefix {
+			dec, err := punyDecode(label[len(acePrefix):])
+			if err != nil {
+				return "", err
+			}
+			label = dec
+		}
+		labels[i] = label
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// IsInternational returns true if the address contains a UTF-8 local part or
+// domain name, which requires the SMTPUTF8 and UTF8=ACCEPT extensions (RFC 6530)
+// to be sent unmodified. A domain name in the ASCII (A-label) form does not
+// make the address international.
+func (a *Address) IsInternational() bool {
+	return !isASCII(a.Mailbox) || !isASCII(a.Host)
+}
+
+// ASCIIHost returns the domain name of the address in ASCII form. See
+// DomainToASCII.
+func (a *Address) ASCIIHost() (string, error) {
+	return DomainToASCII(a.Host)
+}
+
+// UnicodeHost returns the domain name of the address in Unicode form. The
+// original host is returned if it contains invalid A-labels. See
+// DomainToUnicode.
+func (a *Address) UnicodeHost() string {
+	if host, err := DomainToUnicode(a.Host); err == nil {
+		return host
+	}
+	return a.Host
+}
+
+// Equal returns true if a and b refer to the same mailbox. Domain names are
+// compared without regard to case or to the use of A-labels vs U-labels. The
+// local parts are compared exactly, after normalization (see Normalize). The
+// display names and routes are ignored.
+func (a *Address) Equal(b *Address) bool {
+	if normalizeNFC(a.Mailbox) != normalizeNFC(b.Mailbox) {
+		return false
+	}
+	ah, aerr := DomainToASCII(a.Host)
+	bh, berr := DomainToASCII(b.Host)
+	if aerr != nil || berr != nil {
+		return strings.EqualFold(a.Host, b.Host)
+	}
+	return ah == bh
+}
+
+// splitDomain splits a domain name into labels. The IDNA label separators
+// (U+3002, U+FF0E, and U+FF61) are recognized in addition to '.'.
+func splitDomain(domain string) []string {
+	return strings.FieldsFunc(domain, func(r rune) bool {
+		return r == '.' || r == '。' || r == '．' || r == '｡'
+	})
+}
+
+// normalizeNFC calls Normalize, if set.
+func normalizeNFC(s string) string {
+	if Normalize != nil && !isASCII(s) {
+		return Normalize(s)
+	}
+	return s
+}
+
+// isASCII returns true if s contains only 7-bit characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Punycode parameters (RFC 3492 section 5).
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+	punyMaxInt      = 1<<31 - 1
+)
+
+// punyEncode encodes a Unicode label with Punycode (without the ACE prefix).
+func punyEncode(s string) (string, error) {
+	in := []rune(s)
+	out := make([]byte, 0, len(s)+8)
+	for _, r := range in {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		} else if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return "", ErrBadDomain
+		}
+	}
+	b := len(out)
+	if b > 0 {
+		out = append(out, '-')
+	}
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for h := b; h < len(in); {
+		m := rune(punyMaxInt)
+		for _, r := range in {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (punyMaxInt-delta)/(h+1) {
+			return "", ErrBadDomain
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+		for _, r := range in {
+			if r < n {
+				delta++
+			} else if r == n {
+				q := delta
+				for k := punyBase; ; k += punyBase {
+					t := punyThreshold(k, bias)
+					if q < t {
+						break
+					}
+					out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+					q = (q - t) / (punyBase - t)
+				}
+				out = append(out, punyDigit(q))
+				bias = punyAdapt(delta, h+1, h == b)
+				delta = 0
+				h++
+			}
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
+
+// punyDecode decodes a Punycode label (without the ACE prefix).
+func punyDecode(s string) (string, error) {
+	var out []rune
+	pos := 0
+	if b := strings.LastIndexByte(s, '-'); b >= 0 {
+		if !isASCII(s[:b]) {
+			return "", ErrBadDomain
+		}
+		out = []rune(s[:b])
+		pos = b + 1
+	}
+	n, i, bias := rune(punyInitialN), 0, punyInitialBias
+	for pos < len(s) {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(s) {
+				return "", ErrBadDomain
+			}
+			d := punyValue(s[pos])
+			pos++
+			if d < 0 || d > (punyMaxInt-i)/w {
+				return "", ErrBadDomain
+			}
+			i += d * w
+			t := punyThreshold(k, bias)
+			if d < t {
+				break
+			}
+			w *= punyBase - t
+		}
+		bias = punyAdapt(i-oldi, len(out)+1, oldi == 0)
+		n += rune(i / (len(out) + 1))
+		i %= len(out) + 1
+		if n > unicode.MaxRune || !unicode.IsPrint(n) {
+			return "", ErrBadDomain
+		}
+		out = append(out, 0)
+		copy(out[i+1:], out[i:])
+		out[i] = n
+		i++
+	}
+	return string(out), nil
+}
+
+// punyThreshold returns the threshold for digit position k.
+func punyThreshold(k, bias int) int {
+	if k <= bias+punyTMin {
+		return punyTMin
+	} else if k >= bias+punyTMax {
+		return punyTMax
+	}
+	return k - bias
+}
+
+// punyAdapt is the bias adaptation function (RFC 3492 section 6.1).
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+// punyDigit returns the basic code point for digit d.
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+// punyValue returns the digit value of basic code point c or -1 if c is not a
+// valid digit.
+func punyValue(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c-'0') + 26
+	case 'a' <= c && c <= 'z':
+		return int(c - 'a')
+	case 'A' <= c && c <= 'Z':
+		return int(c - 'A')
+	}
+	return -1
+}
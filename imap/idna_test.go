@@ -0,0 +1,72 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIDNA(t *testing.T) {
+	tests := []struct {
+		unicode, ascii string
+	}{
+		{"example.com", "example.com"},
+		{"münchen.de", "xn--mnchen-3ya.de"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"例え.テスト", "xn--r8jz45g.xn--zckzah"},
+		{"ليهمابتكلموشعربي؟", "xn--egbpdaj6bu4bxfgehfvwxn"},
+		{"他们为什么不说中文", "xn--ihqwcrb4cv8a8dqg056pqjye"},
+	}
+	for _, test := range tests {
+		if out, err := DomainToASCII(test.unicode); out != test.ascii || err != nil {
+			t.Errorf("DomainToASCII(%q) expected %q; got %q (%v)", test.unicode, test.ascii, out, err)
+		}
+		if out, err := DomainToUnicode(test.ascii); out != test.unicode || err != nil {
+			t.Errorf("DomainToUnicode(%q) expected %q; got %q (%v)", test.ascii, test.unicode, out, err)
+		}
+	}
+	if out, err := DomainToASCII("MÜNCHEN。DE"); out != "xn--mnchen-3ya.de" || err != nil {
+		t.Errorf("DomainToASCII() expected case folding; got %q (%v)", out, err)
+	}
+	for _, in := range []string{"xn--a.com", "xn--mnchen-3y$.de", "xn--ü-3ya.de"} {
+		if out, err := DomainToUnicode(in); err == nil {
+			t.Errorf("DomainToUnicode(%q) expected error; got %q", in, out)
+		}
+	}
+}
+
+func TestAddressEAI(t *testing.T) {
+	a := &Address{Mailbox: "jürgen", Host: "München.de"}
+	b := &Address{Mailbox: "jürgen", Host: "XN--MNCHEN-3YA.DE"}
+	c := &Address{Mailbox: "Jürgen", Host: "xn--mnchen-3ya.de"}
+	if !a.Equal(b) || !b.Equal(a) {
+		t.Errorf("Equal(%v, %v) expected true", a, b)
+	}
+	if a.Equal(c) {
+		t.Errorf("Equal(%v, %v) expected false", a, c)
+	}
+	if !a.IsInternational() || !b.IsInternational() ||
+		(&Address{Mailbox: "user", Host: "xn--mnchen-3ya.de"}).IsInternational() {
+		t.Errorf("IsInternational() unexpected result")
+	}
+	if h, err := a.ASCIIHost(); h != "xn--mnchen-3ya.de" || err != nil {
+		t.Errorf("ASCIIHost() unexpected result %q (%v)", h, err)
+	}
+	if h := b.UnicodeHost(); h != "münchen.de" {
+		t.Errorf("UnicodeHost() unexpected result %q", h)
+	}
+
+	// Combining diaeresis
+	d := &Address{Mailbox: "jürgen", Host: "münchen.de"}
+	if a.Equal(d) {
+		t.Errorf("Equal() expected false without Normalize")
+	}
+	defer func() { Normalize = nil }()
+	Normalize = func(s string) string { return strings.Replace(s, "ü", "ü", -1) }
+	if !a.Equal(d) {
+		t.Errorf("Equal() expected true with Normalize")
+	}
+}
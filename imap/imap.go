@@ -7,6 +7,7 @@ package imap
 import (
 	"crypto/tls"
 	"io"
+	"math"
 	"net"
 	"time"
 )
@@ -126,7 +127,7 @@ func (c *Client) StartTLS(config *tls.Config) (cmd *Command, err error) {
 		return nil, ErrEncryptionActive
 	}
 	if cmd, err = Wait(c.Send("STARTTLS")); err == nil {
-		if c.rch != nil {
+		if c.rpending {
 			// Should never happen
 			panic("imap: receiver is active, cannot perform TLS handshake")
 		}
@@ -142,7 +143,7 @@ func (c *Client) StartTLS(config *tls.Config) (cmd *Command, err error) {
 //
 // This command is synchronous.
 func (c *Client) Auth(a SASL) (cmd *Command, err error) {
-	info := ServerInfo{c.host, c.t.Encrypted(), c.getCaps("AUTH=")}
+	info := ServerInfo{c.host, c.t.Encrypted(), c.Caps.Auth()}
 	mech, cr, err := a.Start(&info)
 	if err != nil {
 		return
@@ -203,7 +204,7 @@ func (c *Client) Login(username, password string) (cmd *Command, err error) {
 	if c.Caps["LOGINDISABLED"] {
 		return nil, NotAvailableError("LOGIN")
 	}
-	cmd, err = Wait(c.Send("LOGIN", c.Quote(username), c.Quote(password)))
+	cmd, err = Wait(c.Send("LOGIN", encodeString(username, false), encodeString(password, false)))
 	if err == nil {
 		c.setState(Auth)
 		if cmd.result.Label != "CAPABILITY" {
@@ -230,29 +231,29 @@ func (c *Client) Select(mbox string, readonly bool) (cmd *Command, err error) {
 
 // Create creates a new mailbox on the server.
 func (c *Client) Create(mbox string) (cmd *Command, err error) {
-	return c.Send("CREATE", c.Quote(UTF7Encode(mbox)))
+	return c.Send("CREATE", c.encodeMailbox(mbox))
 }
 
 // Delete permanently removes a mailbox and all of its contents from the server.
 func (c *Client) Delete(mbox string) (cmd *Command, err error) {
-	return c.Send("DELETE", c.Quote(UTF7Encode(mbox)))
+	return c.Send("DELETE", c.encodeMailbox(mbox))
 }
 
 // Rename changes the name of a mailbox.
 func (c *Client) Rename(old, new string) (cmd *Command, err error) {
-	return c.Send("RENAME", c.Quote(UTF7Encode(old)), c.Quote(UTF7Encode(new)))
+	return c.Send("RENAME", c.encodeMailbox(old), c.encodeMailbox(new))
 }
 
 // Subscribe adds the specified mailbox name to the server's set of "active" or
 // "subscribed" mailboxes as returned by the LSUB command.
 func (c *Client) Subscribe(mbox string) (cmd *Command, err error) {
-	return c.Send("SUBSCRIBE", c.Quote(UTF7Encode(mbox)))
+	return c.Send("SUBSCRIBE", c.encodeMailbox(mbox))
 }
 
 // Unsubscribe removes the specified mailbox name from the server's set of
 // "active" or "subscribed" mailboxes as returned by the LSUB command.
 func (c *Client) Unsubscribe(mbox string) (cmd *Command, err error) {
-	return c.Send("UNSUBSCRIBE", c.Quote(UTF7Encode(mbox)))
+	return c.Send("UNSUBSCRIBE", c.encodeMailbox(mbox))
 }
 
 // List returns a subset of mailbox names from the complete set of all names
@@ -261,13 +262,13 @@ func (c *Client) Unsubscribe(mbox string) (cmd *Command, err error) {
 // See RFC 3501 sections 6.3.8 and 7.2.2, and RFC 2683 for detailed information
 // about the LIST and LSUB commands.
 func (c *Client) List(ref, mbox string) (cmd *Command, err error) {
-	return c.Send("LIST", c.Quote(ref), c.Quote(mbox))
+	return c.Send("LIST", c.encodeMailbox(ref), c.encodeMailbox(mbox))
 }
 
 // LSub returns a subset of mailbox names from the set of names that the user
 // has declared as being "active" or "subscribed".
 func (c *Client) LSub(ref, mbox string) (cmd *Command, err error) {
-	return c.Send("LSUB", c.Quote(ref), c.Quote(mbox))
+	return c.Send("LSUB", c.encodeMailbox(ref), c.encodeMailbox(mbox))
 }
 
 // Status requests the status of the indicated mailbox. The currently defined
@@ -280,14 +281,14 @@ func (c *Client) Status(mbox string, items ...string) (cmd *Command, err error)
 	} else {
 		f = stringsToFields(items)
 	}
-	return c.Send("STATUS", c.Quote(UTF7Encode(mbox)), f)
+	return c.Send("STATUS", c.encodeMailbox(mbox), f)
 }
 
 // Append appends the literal argument as a new message to the end of the
 // specified destination mailbox. Flags and internal date arguments are optional
 // and may be set to nil.
 func (c *Client) Append(mbox string, flags FlagSet, idate *time.Time, msg Literal) (cmd *Command, err error) {
-	f := []Field{c.Quote(UTF7Encode(mbox)), nil, nil, nil}[:1]
+	f := []Field{c.encodeMailbox(mbox), nil, nil, nil}[:1]
 	if flags != nil {
 		f = append(f, flags)
 	}
@@ -297,6 +298,30 @@ func (c *Client) Append(mbox string, flags FlagSet, idate *time.Time, msg Litera
 	return c.Send("APPEND", append(f, msg)...)
 }
 
+// AppendReader appends a new message containing size bytes read from r to the
+// end of the specified destination mailbox. The message is streamed to the
+// server without buffering it in memory. Non-synchronizing literals (RFC 2088
+// LITERAL+) are used if the server supports them. If size is negative, r must
+// implement io.Seeker, and the message consists of the remainder of r (see
+// NewSeekerLiteral). Flags and internal date arguments are optional and may be
+// set to nil.
+func (c *Client) AppendReader(mbox string, flags FlagSet, idate *time.Time, r io.Reader, size int64) (cmd *Command, err error) {
+	var msg Literal
+	if size < 0 {
+		rs, ok := r.(io.ReadSeeker)
+		if !ok {
+			return nil, ErrLiteralSize
+		} else if msg, err = NewSeekerLiteral(rs); err != nil {
+			return nil, err
+		}
+	} else if size > math.MaxUint32 {
+		return nil, ErrLiteralSize
+	} else {
+		msg = NewReaderLiteral(r, uint32(size))
+	}
+	return c.Append(mbox, flags, idate, msg)
+}
+
 // Check requests a checkpoint of the currently selected mailbox. A checkpoint
 // is an implementation detail of the server and may be equivalent to a NOOP.
 func (c *Client) Check() (cmd *Command, err error) {
@@ -347,10 +372,14 @@ func (c *Client) Expunge(uids *SeqSet) (cmd *Command, err error) {
 
 // Search searches the mailbox for messages that match the given searching
 // criteria. See RFC 3501 section 6.4.4 for a list of all valid search keys. It
-// is the caller's responsibility to quote strings when necessary. All strings
-// must use UTF-8 encoding.
+// is the caller's responsibility to quote strings when necessary (see
+// AString). Date keys (e.g. SINCE) may be followed by time.Time values, which
+// are converted using FormatSearchDate. All strings must use UTF-8 encoding.
+// The UTF-8 charset is specified only if the criteria contain non-ASCII
+// strings. Use SearchCharset to handle servers that do not support UTF-8. A
+// *SearchCriteria may be passed to build the criteria without manual quoting.
 func (c *Client) Search(spec ...Field) (cmd *Command, err error) {
-	return c.Send("SEARCH", append([]Field{"CHARSET", "UTF-8"}, spec...)...)
+	return c.Send("SEARCH", searchSpec(spec)...)
 }
 
 // Fetch retrieves data associated with the specified message(s) in the mailbox.
@@ -368,13 +397,23 @@ func (c *Client) Store(seq *SeqSet, item string, value Field) (cmd *Command, err
 // Copy copies the specified message(s) to the end of the specified destination
 // mailbox.
 func (c *Client) Copy(seq *SeqSet, mbox string) (cmd *Command, err error) {
-	return c.Send("COPY", seq, c.Quote(UTF7Encode(mbox)))
+	return c.Send("COPY", seq, c.encodeMailbox(mbox))
+}
+
+// Move moves the specified message(s) to the end of the specified destination
+// mailbox. The messages are expunged from the currently selected mailbox. See
+// RFC 6851 for additional information.
+func (c *Client) Move(seq *SeqSet, mbox string) (cmd *Command, err error) {
+	if !c.Caps["MOVE"] {
+		return nil, NotAvailableError("MOVE")
+	}
+	return c.Send("MOVE", seq, c.encodeMailbox(mbox))
 }
 
 // UIDSearch is identical to Search, but the numbers returned in the response
 // are unique identifiers instead of message sequence numbers.
 func (c *Client) UIDSearch(spec ...Field) (cmd *Command, err error) {
-	return c.Send("UID SEARCH", append([]Field{"CHARSET", "UTF-8"}, spec...)...)
+	return c.Send("UID SEARCH", searchSpec(spec)...)
 }
 
 // UIDFetch is identical to Fetch, but the seq argument is interpreted as
@@ -392,7 +431,16 @@ func (c *Client) UIDStore(seq *SeqSet, item string, value Field) (cmd *Command,
 // UIDCopy is identical to Copy, but the seq argument is interpreted as
 // containing unique identifiers instead of message sequence numbers.
 func (c *Client) UIDCopy(seq *SeqSet, mbox string) (cmd *Command, err error) {
-	return c.Send("UID COPY", seq, c.Quote(UTF7Encode(mbox)))
+	return c.Send("UID COPY", seq, c.encodeMailbox(mbox))
+}
+
+// UIDMove is identical to Move, but the seq argument is interpreted as
+// containing unique identifiers instead of message sequence numbers.
+func (c *Client) UIDMove(seq *SeqSet, mbox string) (cmd *Command, err error) {
+	if !c.Caps["MOVE"] {
+		return nil, NotAvailableError("MOVE")
+	}
+	return c.Send("UID MOVE", seq, c.encodeMailbox(mbox))
 }
 
 // SetQuota changes the resource limits of the specified quota root. See RFC
@@ -405,7 +453,7 @@ func (c *Client) SetQuota(root string, quota ...*Quota) (cmd *Command, err error
 	for _, q := range quota {
 		f = append(f, q.Resource, q.Limit)
 	}
-	return c.Send("SETQUOTA", c.Quote(root), f)
+	return c.Send("SETQUOTA", encodeString(root, false), f)
 }
 
 // GetQuota returns the quota root's resource usage and limits. See RFC 2087 for
@@ -414,7 +462,7 @@ func (c *Client) GetQuota(root string, quota ...*Quota) (cmd *Command, err error
 	if !c.Caps["QUOTA"] {
 		return nil, NotAvailableError("QUOTA")
 	}
-	return c.Send("GETQUOTA", c.Quote(root))
+	return c.Send("GETQUOTA", encodeString(root, false))
 }
 
 // GetQuotaRoot returns the list of quota roots for the specified mailbox, and
@@ -424,7 +472,7 @@ func (c *Client) GetQuotaRoot(mbox string) (cmd *Command, err error) {
 	if !c.Caps["QUOTA"] {
 		return nil, NotAvailableError("QUOTA")
 	}
-	return c.Send("GETQUOTAROOT", c.Quote(UTF7Encode(mbox)))
+	return c.Send("GETQUOTAROOT", c.encodeMailbox(mbox))
 }
 
 // Idle places the client into an idle state where the server is free to send
@@ -472,7 +520,7 @@ func (c *Client) ID(info ...string) (cmd *Command, err error) {
 	}
 	f := make([]Field, len(info))
 	for i, v := range info {
-		f[i] = c.Quote(v)
+		f[i] = encodeString(v, false)
 	}
 	return c.Send("ID", f)
 }
@@ -499,35 +547,59 @@ func (c *Client) CompressDeflate(level int) (cmd *Command, err error) {
 //
 // This command is synchronous.
 func (c *Client) Enable(caps ...string) (cmd *Command, err error) {
-	return Wait(c.Send("ENABLE", stringsToFields(caps)))
+	return Wait(c.Send("ENABLE", stringsToFields(caps)...))
 }
 
 // doSelect opens the specified mailbox, returning an error if the command
-// completion status is other than OK or NO.
-func (c *Client) doSelect(mbox string, readonly bool) (cmd *Command, err error) {
+// completion status is other than OK or NO. Optional select parameters (e.g.
+// CONDSTORE) are sent as a parenthesized list after the mailbox name.
+func (c *Client) doSelect(mbox string, readonly bool, params ...Field) (cmd *Command, err error) {
 	name := "SELECT"
 	if readonly {
 		name = "EXAMINE"
 	}
-	if cmd, err = c.Send(name, c.Quote(UTF7Encode(mbox))); err == nil {
-		prev := c.Mailbox
+	f := []Field{c.encodeMailbox(mbox)}
+	if len(params) > 0 {
+		f = append(f, params)
+	}
+	if cmd, err = c.Send(name, f...); err == nil {
+		prev, prevUIDs := c.Mailbox, c.UIDs
 		c.setState(Auth)
-		c.Mailbox = newMailboxStatus(mbox)
+		c.Mailbox, c.UIDs = newMailboxStatus(mbox), newUIDMap()
 
 		var rsp *Response
 		if rsp, err = cmd.Result(OK | NO); err == nil {
 			if rsp.Status == OK {
 				c.setState(Selected)
 			} else {
-				c.Mailbox = nil
+				c.Mailbox, c.UIDs = nil, nil
 			}
-		} else if c.Mailbox = prev; prev != nil && c.state == Auth {
+		} else if c.Mailbox, c.UIDs = prev, prevUIDs; prev != nil && c.state == Auth {
 			c.setState(Selected)
 		}
 	}
 	return
 }
 
+// encodeMailbox returns the mailbox name (or LIST pattern) encoded for use as a
+// command argument. Modified UTF-7 is used unless the server has enabled the
+// UTF8=ACCEPT extension (RFC 6855), in which case the name is sent as UTF-8.
+func (c *Client) encodeMailbox(name string) Field {
+	if c.Enabled["UTF8=ACCEPT"] {
+		return encodeString(name, false)
+	}
+	return encodeString(EncodeMailboxName(name), false)
+}
+
+// searchSpec prepends CHARSET UTF-8 to the search criteria if they contain
+// non-ASCII strings and converts search dates (see searchDates).
+func searchSpec(spec []Field) []Field {
+	if spec = searchDates(spec); hasNonASCII(spec) {
+		return append([]Field{"CHARSET", "UTF-8"}, spec...)
+	}
+	return spec
+}
+
 // stringsToFields converts []string to []Field.
 func stringsToFields(s []string) []Field {
 	f := make([]Field, len(s))
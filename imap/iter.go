@@ -0,0 +1,130 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package imap
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+// iterTick is the maximum duration of each receive operation performed by the
+// iterators, which limits the delay between the cancellation of the context
+// and the iterator returning.
+var iterTick = time.Second
+
+// FetchIter issues a FETCH command and returns an iterator over the messages
+// as their responses arrive, without waiting for the command to complete or
+// accumulating the responses in the Command. If the loop is exited early, the
+// remaining responses are received and discarded before the iterator returns,
+// which keeps the connection usable. If ctx is done, ctx.Err() is yielded and
+// the command is left in progress. A command error is yielded with a nil
+// message after all messages. Other server data is delivered as usual.
+func (c *Client) FetchIter(ctx context.Context, seq *SeqSet, items ...string) iter.Seq2[*MessageInfo, error] {
+	return fetchIter(ctx, c.Fetch, seq, items)
+}
+
+// UIDFetchIter is identical to FetchIter, except that it uses UID FETCH.
+func (c *Client) UIDFetchIter(ctx context.Context, seq *SeqSet, items ...string) iter.Seq2[*MessageInfo, error] {
+	return fetchIter(ctx, c.UIDFetch, seq, items)
+}
+
+// SearchIter issues a SEARCH command and returns an iterator over the matching
+// message sequence numbers. See FetchIter for a description of early exit and
+// error handling. The SEARCH responses are released after their numbers are
+// yielded (see Response.Release). Setting c.CompactSearch reduces the memory
+// needed for very large results, and SearchTo receives them without holding an
+// entire response in memory.
+func (c *Client) SearchIter(ctx context.Context, spec ...Field) iter.Seq2[uint32, error] {
+	return searchIter(ctx, c.Search, spec)
+}
+
+// UIDSearchIter is identical to SearchIter, except that it uses UID SEARCH and
+// yields UIDs.
+func (c *Client) UIDSearchIter(ctx context.Context, spec ...Field) iter.Seq2[uint32, error] {
+	return searchIter(ctx, c.UIDSearch, spec)
+}
+
+// fetchIter implements FetchIter and UIDFetchIter.
+func fetchIter(ctx context.Context, fetch func(*SeqSet, ...string) (*Command, error), seq *SeqSet, items []string) iter.Seq2[*MessageInfo, error] {
+	return func(yield func(*MessageInfo, error) bool) {
+		cmd, err := fetch(seq, items...)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		stopped := false
+		err = iterCommand(ctx, cmd, func(rsp *Response) bool {
+			if msg := rsp.MessageInfo(); msg != nil {
+				stopped = !yield(msg, nil)
+			}
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(nil, err)
+		}
+	}
+}
+
+// searchIter implements SearchIter and UIDSearchIter.
+func searchIter(ctx context.Context, search func(...Field) (*Command, error), spec []Field) iter.Seq2[uint32, error] {
+	return func(yield func(uint32, error) bool) {
+		cmd, err := search(spec...)
+		if err != nil {
+			yield(0, err)
+			return
+		}
+		stopped := false
+		err = iterCommand(ctx, cmd, func(rsp *Response) bool {
+			for _, n := range rsp.SearchResults() {
+				if !yield(n, nil) {
+					stopped = true
+					break
+				}
+			}
+			rsp.Release()
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(0, err)
+		}
+	}
+}
+
+// iterCommand receives the responses of cmd until it is completed, passing
+// each new response in cmd.Data to f and removing it from cmd.Data. Once f
+// returns false, all remaining responses are released and the completion
+// status is ignored.
+func iterCommand(ctx context.Context, cmd *Command, f func(rsp *Response) bool) error {
+	active := true
+	for {
+		for active && len(cmd.Data) > 0 {
+			rsp := cmd.Data[0]
+			cmd.Data = cmd.Data[1:]
+			active = f(rsp)
+		}
+		if !active {
+			for _, rsp := range cmd.Data {
+				rsp.Release()
+			}
+			cmd.Data = nil
+		}
+		if !cmd.InProgress() {
+			break
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := cmd.client.Recv(iterTick); err != nil && err != ErrTimeout {
+			return err
+		}
+	}
+	if _, err := cmd.Result(OK); err != nil && active {
+		return err
+	}
+	return nil
+}
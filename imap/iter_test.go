@@ -0,0 +1,98 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.23
+// +build go1.23
+
+package imap
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestClientIterators(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	ctx := context.Background()
+
+	go t.script(
+		`C: A1 UID FETCH 1:* (FLAGS)`+CRLF,
+		`S: * 1 FETCH (UID 1 FLAGS ())`+CRLF,
+		`S: * 2 FETCH (UID 4 FLAGS ())`+CRLF,
+		`S: * 3 FETCH (UID 9 FLAGS ())`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+	)
+	var uids []uint32
+	for msg, err := range C.UIDFetchIter(ctx, newSeqSet("1:*"), "FLAGS") {
+		if err != nil {
+			t.Fatalf("UIDFetchIter() unexpected error; %v", err)
+		}
+		uids = append(uids, msg.UID)
+	}
+	t.join("FETCH", nil)
+	if want := []uint32{1, 4, 9}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("UIDFetchIter() expected %v; got %v", want, uids)
+	}
+
+	// Early exit drains the remaining responses
+	go t.script(
+		`C: A2 FETCH 1:3 (FLAGS)`+CRLF,
+		`S: * 1 FETCH (FLAGS ())`+CRLF,
+		`S: * 2 FETCH (FLAGS ())`+CRLF,
+		`S: * 3 FETCH (FLAGS ())`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+		`C: A3 SEARCH UNSEEN`+CRLF,
+		`S: * SEARCH 2 5 7`+CRLF,
+		`S: A3 OK SEARCH completed`+CRLF,
+	)
+	n := 0
+	for range C.FetchIter(ctx, newSeqSet("1:3"), "FLAGS") {
+		if n++; n == 1 {
+			break
+		}
+	}
+	var seqs []uint32
+	for seq, err := range C.SearchIter(ctx, "UNSEEN") {
+		if err != nil {
+			t.Fatalf("SearchIter() unexpected error; %v", err)
+		}
+		seqs = append(seqs, seq)
+	}
+	t.join("SEARCH", nil)
+	if n != 1 || !reflect.DeepEqual(seqs, []uint32{2, 5, 7}) {
+		t.Errorf("SearchIter() expected [2 5 7] after 1 message; got %v after %d", seqs, n)
+	}
+
+	// Command error
+	go t.script(
+		`C: A4 UID SEARCH BAD`+CRLF,
+		`S: A4 BAD Syntax error`+CRLF,
+	)
+	var errs []error
+	for _, err := range C.UIDSearchIter(ctx, "BAD") {
+		errs = append(errs, err)
+	}
+	t.join("SEARCH", nil)
+	if len(errs) != 1 || errs[0] == nil {
+		t.Errorf("UIDSearchIter() expected one error; got %v", errs)
+	}
+
+	// Canceled context
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	go t.script(
+		`C: A5 FETCH 1 (FLAGS)`+CRLF,
+	)
+	errs = nil
+	for _, err := range C.FetchIter(cctx, newSeqSet("1"), "FLAGS") {
+		errs = append(errs, err)
+	}
+	t.join("FETCH", nil)
+	if len(errs) != 1 || errs[0] != context.Canceled {
+		t.Errorf("FetchIter() expected context.Canceled; got %v", errs)
+	}
+}
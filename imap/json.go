@@ -0,0 +1,133 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JSON discriminator values for the concrete MessagePart types. The "kind" key
+// is added to every encoded part, allowing UnmarshalMessagePart to restore the
+// original type. Address values use the default encoding.
+const (
+	jsonBodyPart  = "body"
+	jsonMultipart = "multipart"
+)
+
+// MarshalJSON encodes p as a JSON object with a "kind" key set to "body".
+func (p *BodyPart) MarshalJSON() ([]byte, error) {
+	type bodyPart BodyPart
+	return json.Marshal(struct {
+		Kind string `json:"kind"`
+		*bodyPart
+	}{jsonBodyPart, (*bodyPart)(p)})
+}
+
+// UnmarshalJSON decodes a JSON object created by MarshalJSON.
+func (p *BodyPart) UnmarshalJSON(b []byte) error {
+	type bodyPart BodyPart
+	v := struct {
+		Kind string          `json:"kind"`
+		Body json.RawMessage `json:"body"`
+		*bodyPart
+	}{bodyPart: (*bodyPart)(p)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	} else if v.Kind != jsonBodyPart {
+		return fmt.Errorf("imap: invalid BodyPart kind %q", v.Kind)
+	}
+	var err error
+	if len(v.Body) > 0 && string(v.Body) != "null" {
+		p.Body, err = UnmarshalMessagePart(v.Body)
+	}
+	return err
+}
+
+// MarshalJSON encodes m as a JSON object with a "kind" key set to "multipart".
+func (m *Multipart) MarshalJSON() ([]byte, error) {
+	type multipart Multipart
+	return json.Marshal(struct {
+		Kind string `json:"kind"`
+		*multipart
+	}{jsonMultipart, (*multipart)(m)})
+}
+
+// UnmarshalJSON decodes a JSON object created by MarshalJSON.
+func (m *Multipart) UnmarshalJSON(b []byte) error {
+	type multipart Multipart
+	v := struct {
+		Kind  string            `json:"kind"`
+		Parts []json.RawMessage `json:"parts"`
+		*multipart
+	}{multipart: (*multipart)(m)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	} else if v.Kind != jsonMultipart {
+		return fmt.Errorf("imap: invalid Multipart kind %q", v.Kind)
+	}
+	m.Parts = nil
+	if v.Parts != nil {
+		m.Parts = make([]MessagePart, len(v.Parts))
+		for i, b := range v.Parts {
+			part, err := UnmarshalMessagePart(b)
+			if err != nil {
+				return err
+			}
+			m.Parts[i] = part
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes e as a JSON object with the "date" key omitted if the date
+// is zero. Envelope values are decoded with the default encoding.
+func (e *Envelope) MarshalJSON() ([]byte, error) {
+	type envelope Envelope
+	v := struct {
+		Date *time.Time `json:"date,omitempty"`
+		*envelope
+	}{envelope: (*envelope)(e)}
+	if !e.Date.IsZero() {
+		v.Date = &e.Date
+	}
+	// HTML characters are escaped by the caller's encoder, if necessary
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(b.Bytes(), "\n"), nil
+}
+
+// UnmarshalMessagePart decodes a body structure that was encoded with
+// json.Marshal. The concrete type of the returned part (*BodyPart or
+// *Multipart) is determined by the "kind" key.
+func UnmarshalMessagePart(b []byte) (MessagePart, error) {
+	var v struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	switch v.Kind {
+	case jsonBodyPart:
+		p := new(BodyPart)
+		if err := json.Unmarshal(b, p); err != nil {
+			return nil, err
+		}
+		return p, nil
+	case jsonMultipart:
+		m := new(Multipart)
+		if err := json.Unmarshal(b, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("imap: invalid MessagePart kind %q", v.Kind)
+}
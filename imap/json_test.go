@@ -0,0 +1,94 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSON(t *testing.T) {
+	root := &Multipart{
+		Subtype: "mixed",
+		Params:  map[string]string{"boundary": "xyz"},
+		Parts: []MessagePart{
+			&BodyPart{Section: "1", Type: "text", Subtype: "plain", Encoding: "7bit", Size: 5, Lines: 1},
+			&BodyPart{
+				Section:  "2",
+				Type:     "message",
+				Subtype:  "rfc822",
+				Encoding: "7bit",
+				Size:     500,
+				Envelope: &Envelope{
+					Date:      time.Date(2013, time.January, 1, 0, 0, 0, 0, time.UTC),
+					Subject:   "Fwd",
+					From:      []*Address{{"A", "", "a", "example.com"}},
+					MessageID: "<x@example.com>",
+				},
+				Body: &Multipart{Section: "2", Subtype: "alternative", Parts: []MessagePart{
+					&BodyPart{Section: "2.1", Type: "text", Subtype: "plain"},
+					&BodyPart{Section: "2.2", Type: "text", Subtype: "html"},
+				}},
+				Lines:       20,
+				Disposition: "attachment",
+				DispParams:  map[string]string{"filename": "fwd.eml"},
+			},
+		},
+	}
+	b, err := json.Marshal(root)
+	if err != nil {
+		t.Fatalf("json.Marshal() unexpected error; %v", err)
+	}
+	if s := string(b); !strings.HasPrefix(s, `{"kind":"multipart","subtype":"mixed","parts":[{"kind":"body","section":"1",`) {
+		t.Errorf("json.Marshal() unexpected encoding:\n%s", s)
+	}
+	out, err := UnmarshalMessagePart(b)
+	if err != nil {
+		t.Fatalf("UnmarshalMessagePart() unexpected error; %v", err)
+	}
+	if !reflect.DeepEqual(out, MessagePart(root)) {
+		t.Errorf("UnmarshalMessagePart() expected\n%#v; got\n%#v", root, out)
+	}
+
+	env := new(Envelope)
+	if b, err = json.Marshal(env); err != nil || string(b) != "{}" {
+		t.Errorf("json.Marshal(&Envelope{}) expected {}; got %s (%v)", b, err)
+	}
+
+	bad := []string{
+		`{}`,
+		`{"kind":"other"}`,
+		`{"kind":"body","body":{"kind":"x"}}`,
+		`{"kind":"multipart","parts":[{"kind":"multipart","parts":[1]}]}`,
+	}
+	for _, in := range bad {
+		if _, err := UnmarshalMessagePart([]byte(in)); err == nil {
+			t.Errorf("UnmarshalMessagePart(%s) expected an error", in)
+		}
+	}
+	var p BodyPart
+	if err := json.Unmarshal([]byte(`{"kind":"multipart"}`), &p); err == nil {
+		t.Errorf("json.Unmarshal(BodyPart) expected an error")
+	}
+}
+
+func TestEnvelopeJSON(t *testing.T) {
+	env := &Envelope{Subject: "x"}
+	if b, err := json.Marshal(env); err != nil || string(b) != `{"subject":"x"}` {
+		t.Errorf("json.Marshal() unexpected encoding %s (%v)", b, err)
+	}
+	env.Date = time.Date(2013, time.January, 1, 0, 0, 0, 0, time.UTC)
+	b, err := json.Marshal(env)
+	if err != nil || string(b) != `{"date":"2013-01-01T00:00:00Z","subject":"x"}` {
+		t.Errorf("json.Marshal() unexpected encoding %s (%v)", b, err)
+	}
+	out := new(Envelope)
+	if err = json.Unmarshal(b, out); err != nil || !reflect.DeepEqual(out, env) {
+		t.Errorf("json.Unmarshal() expected %+v; got %+v (%v)", env, out, err)
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Errors returned by Session.CreateAll. ErrNoHierarchy indicates that the path
+// has multiple components, but the server does not support a mailbox
+// hierarchy.
+var (
+	ErrEmptyPath   = errors.New("imap: empty mailbox path")
+	ErrNoHierarchy = errors.New("imap: mailbox hierarchy not supported")
+)
+
+// MailboxNode is a single mailbox in a MailboxTree.
+type MailboxNode struct {
+	Name     string         // Last component of the mailbox name
+	Path     string         // Full mailbox name
+	Delim    string         // Hierarchy delimiter ("" for flat names)
+	Info     *MailboxInfo   // LIST response (nil for implied parents)
+	Parent   *MailboxNode   // Parent mailbox (nil for top-level mailboxes)
+	Children []*MailboxNode // Child mailboxes
+}
+
+// Selectable returns true if the mailbox was returned by LIST and can be
+// selected (i.e. it does not have the \Noselect or \NonExistent attributes).
+func (n *MailboxNode) Selectable() bool {
+	return n.Info != nil && n.Info.Attr&(AttrNoselect|AttrNonExistent) == 0
+}
+
+// Depth returns the number of ancestors of n. Top-level mailboxes have depth 0.
+func (n *MailboxNode) Depth() (d int) {
+	for p := n.Parent; p != nil; p = p.Parent {
+		d++
+	}
+	return
+}
+
+// MailboxTree assembles the results of LIST or LSUB commands into a hierarchy.
+// Each mailbox name is split using the delimiter of its own LIST response, so
+// namespaces with different delimiters may be combined in one tree. Parents
+// that are implied by a mailbox name, but were not returned by the server (e.g.
+// when listing with the "%" wildcard), are created with a nil Info field. The
+// name INBOX is case-insensitive and is always stored in upper case.
+type MailboxTree struct {
+	Roots []*MailboxNode // Top-level mailboxes
+
+	nodes map[string]*MailboxNode // Index of all nodes by path
+}
+
+// NewMailboxTree returns a new MailboxTree containing the specified mailboxes.
+// The tree is sorted using the default order (see MailboxTree.Sort).
+func NewMailboxTree(list []*MailboxInfo) *MailboxTree {
+	t := &MailboxTree{nodes: make(map[string]*MailboxNode)}
+	for _, info := range list {
+		t.Add(info)
+	}
+	t.Sort(nil)
+	return t
+}
+
+// Add inserts a mailbox into the tree, creating any missing parents, and
+// returns its node. If the mailbox already exists, its Info field is replaced.
+// New nodes are appended to the end of their parent's children.
+func (t *MailboxTree) Add(info *MailboxInfo) *MailboxNode {
+	if t.nodes == nil {
+		t.nodes = make(map[string]*MailboxNode)
+	}
+	var parent *MailboxNode
+	parts := SplitMailboxPath(info.Name, info.Delim)
+	for i := range parts {
+		path := JoinMailboxPath(info.Delim, parts[:i+1]...)
+		n := t.nodes[path]
+		if n == nil {
+			n = &MailboxNode{Name: parts[i], Path: path, Delim: info.Delim, Parent: parent}
+			if parent == nil {
+				t.Roots = append(t.Roots, n)
+			} else {
+				parent.Children = append(parent.Children, n)
+			}
+			t.nodes[path] = n
+		}
+		parent = n
+	}
+	if parent != nil {
+		parent.Info = info
+	}
+	return parent
+}
+
+// Find returns the node of the mailbox with the specified full name or nil if
+// the mailbox is not in the tree.
+func (t *MailboxTree) Find(path string) *MailboxNode {
+	if n := t.nodes[path]; n != nil || len(path) < 5 || toUpper(path[:5]) != "INBOX" {
+		return n
+	}
+	if inbox := t.nodes["INBOX"]; inbox != nil && (len(path) == 5 ||
+		(inbox.Delim != "" && strings.HasPrefix(path[5:], inbox.Delim))) {
+		return t.nodes["INBOX"+path[5:]]
+	}
+	return nil
+}
+
+// Walk calls f for each node in depth-first order, parents before children.
+// Children of a node are skipped if f returns false for that node.
+func (t *MailboxTree) Walk(f func(n *MailboxNode) bool) {
+	var walk func([]*MailboxNode)
+	walk = func(nodes []*MailboxNode) {
+		for _, n := range nodes {
+			if f(n) {
+				walk(n.Children)
+			}
+		}
+	}
+	walk(t.Roots)
+}
+
+// Sort orders the children of each node using the less function. If less is
+// nil, INBOX is placed first and the remaining mailboxes are ordered by Name
+// without regard to case.
+func (t *MailboxTree) Sort(less func(a, b *MailboxNode) bool) {
+	if less == nil {
+		less = defaultMailboxLess
+	}
+	var sortNodes func([]*MailboxNode)
+	sortNodes = func(nodes []*MailboxNode) {
+		sort.SliceStable(nodes, func(i, j int) bool { return less(nodes[i], nodes[j]) })
+		for _, n := range nodes {
+			sortNodes(n.Children)
+		}
+	}
+	sortNodes(t.Roots)
+}
+
+// defaultMailboxLess implements the default MailboxTree sort order.
+func defaultMailboxLess(a, b *MailboxNode) bool {
+	if ai, bi := a.Path == "INBOX", b.Path == "INBOX"; ai || bi {
+		return ai && !bi
+	}
+	if x, y := strings.ToLower(a.Name), strings.ToLower(b.Name); x != y {
+		return x < y
+	}
+	return a.Name < b.Name
+}
+
+// SplitMailboxPath splits a mailbox name into its hierarchy components. The name
+// is returned as a single component if delim is empty. A top-level INBOX
+// component is converted to upper case.
+func SplitMailboxPath(name, delim string) []string {
+	if name == "" {
+		return nil
+	}
+	var parts []string
+	if delim == "" {
+		parts = []string{name}
+	} else {
+		parts = strings.Split(name, delim)
+	}
+	if toUpper(parts[0]) == "INBOX" {
+		parts[0] = "INBOX"
+	}
+	return parts
+}
+
+// JoinMailboxPath combines mailbox name components using the hierarchy
+// delimiter. It is the inverse of SplitMailboxPath.
+func JoinMailboxPath(delim string, parts ...string) string {
+	return strings.Join(parts, delim)
+}
+
+// CreateAll creates the mailbox with the specified path and any missing parent
+// mailboxes, like "mkdir -p". Path components are separated by "/", which is
+// replaced with the hierarchy delimiter returned by LIST "" "". Empty
+// components are ignored. A CREATE command that fails with the ALREADYEXISTS
+// response code (RFC 5530), or for a mailbox that is returned by LIST, is not
+// an error. The mailboxes that were created are returned in order from the top
+// of the hierarchy, even if an error is encountered. If subscribe is true, each
+// created mailbox is also added to the subscription list.
+func (s *Session) CreateAll(path string, subscribe bool) (created []string, err error) {
+	parts := strings.FieldsFunc(path, func(r rune) bool { return r == '/' })
+	if len(parts) == 0 {
+		return nil, ErrEmptyPath
+	}
+	list, err := s.List("", "")
+	if err != nil {
+		return nil, err
+	}
+	delim := ""
+	if len(list) > 0 {
+		delim = list[0].Delim
+	}
+	if delim == "" && len(parts) > 1 {
+		return nil, ErrNoHierarchy
+	}
+	for i := range parts {
+		mbox := JoinMailboxPath(delim, parts[:i+1]...)
+		var ok bool
+		if ok, err = s.create(mbox); err != nil {
+			break
+		} else if ok {
+			created = append(created, mbox)
+			if subscribe {
+				if _, err = Wait(s.Client.Subscribe(mbox)); err != nil {
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
+// create creates a mailbox and returns false if it already exists.
+func (s *Session) create(mbox string) (bool, error) {
+	_, err := Wait(s.Client.Create(mbox))
+	rsp, ok := err.(ResponseError)
+	if !ok || rsp.Status != NO {
+		return err == nil, err
+	} else if rsp.Label == "ALREADYEXISTS" {
+		return false, nil
+	}
+	if list, lerr := s.List("", mbox); lerr == nil {
+		want := SplitMailboxPath(mbox, "")[0]
+		for _, info := range list {
+			if SplitMailboxPath(info.Name, "")[0] == want {
+				return false, nil
+			}
+		}
+	}
+	return false, err
+}
+
+// MailboxResult is the outcome of the operation on one mailbox performed by
+// Session.DeleteRecursive or Session.RenameRecursive.
+type MailboxResult struct {
+	Mailbox string // Mailbox name (old name for renames)
+	NewName string // New mailbox name (renames only)
+	Err     error  // Operation error (nil on success)
+}
+
+// DeleteRecursive deletes a mailbox and all of its inferior mailboxes, which
+// are found with LIST. The inferiors are deleted first, starting with the
+// deepest ones, since many servers refuse to delete a mailbox that has
+// inferiors. A failure does not stop the deletion of the other mailboxes. The
+// result of each DELETE command is returned, with mbox last, along with the
+// first error encountered.
+func (s *Session) DeleteRecursive(mbox string) (results []*MailboxResult, err error) {
+	delim, names, err := s.inferiors(mbox)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return strings.Count(names[i], delim) > strings.Count(names[j], delim)
+	})
+	for _, name := range append(names, mbox) {
+		r := &MailboxResult{Mailbox: name}
+		if _, r.Err = Wait(s.Client.Delete(name)); r.Err != nil && err == nil {
+			err = r.Err
+		}
+		results = append(results, r)
+	}
+	return
+}
+
+// RenameRecursive renames a mailbox and all of its inferior mailboxes. RFC 3501
+// requires RENAME to move the inferiors along with the mailbox, but not all
+// servers do so. After the mailbox itself is renamed, any inferiors that are
+// still found under the old name with LIST are renamed individually, parents
+// first. The result for mbox is returned first, followed by the results for
+// its inferiors. Inferiors that were moved by the server are reported as
+// successful. The first error encountered is also returned. If mbox cannot be
+// renamed, its inferiors are left alone.
+func (s *Session) RenameRecursive(mbox, newName string) (results []*MailboxResult, err error) {
+	delim, names, err := s.inferiors(mbox)
+	if err != nil {
+		return nil, err
+	}
+	r := &MailboxResult{Mailbox: mbox, NewName: newName}
+	results = append(results, r)
+	if _, r.Err = Wait(s.Client.Rename(mbox, newName)); r.Err != nil || len(names) == 0 {
+		return results, r.Err
+	}
+	prefix := mbox + delim
+	var renamed []*MailboxResult
+	done := make(map[string]*MailboxResult)
+	for {
+		rest, lerr := s.listBelow(prefix)
+		if lerr != nil {
+			return append(results, renamed...), lerr
+		}
+		var next string
+		for _, name := range rest {
+			if done[name] == nil && (next == "" ||
+				strings.Count(name, delim) < strings.Count(next, delim)) {
+				next = name
+			}
+		}
+		if next == "" {
+			break
+		}
+		r := &MailboxResult{Mailbox: next, NewName: newName + next[len(mbox):]}
+		if _, r.Err = Wait(s.Client.Rename(r.Mailbox, r.NewName)); r.Err != nil && err == nil {
+			err = r.Err
+		}
+		renamed, done[next] = append(renamed, r), r
+	}
+	for _, name := range names {
+		if done[name] == nil {
+			results = append(results, &MailboxResult{Mailbox: name, NewName: newName + name[len(mbox):]})
+		}
+	}
+	return append(results, renamed...), err
+}
+
+// inferiors returns the hierarchy delimiter of mbox and the names of all
+// existing mailboxes below it.
+func (s *Session) inferiors(mbox string) (delim string, names []string, err error) {
+	list, err := s.List("", mbox)
+	if err != nil || len(list) == 0 {
+		return "", nil, err
+	} else if delim = list[0].Delim; delim == "" {
+		return
+	}
+	names, err = s.listBelow(mbox + delim)
+	return
+}
+
+// listBelow returns the names of all existing mailboxes whose names start with
+// prefix, in the order returned by LIST.
+func (s *Session) listBelow(prefix string) (names []string, err error) {
+	list, err := s.List("", prefix+"*")
+	for _, info := range list {
+		if strings.HasPrefix(info.Name, prefix) && info.Attr&AttrNonExistent == 0 {
+			names = append(names, info.Name)
+		}
+	}
+	return
+}
@@ -0,0 +1,237 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMailboxTree(t *testing.T) {
+	list := []*MailboxInfo{
+		{Attrs: NewFlagSet(), Delim: "/", Name: "Work/Reports/2024"},
+		{Attrs: NewFlagSet(), Delim: "/", Name: "archive"},
+		{Attrs: NewFlagSet(`\Noselect`), Attr: AttrNoselect, Delim: "/", Name: "Work"},
+		{Attrs: NewFlagSet(), Delim: "/", Name: "inbox"},
+		{Attrs: NewFlagSet(), Delim: "/", Name: "INBOX/Lists"},
+		{Attrs: NewFlagSet(), Delim: ".", Name: "Public.Shared"},
+		{Attrs: NewFlagSet(), Delim: "", Name: "Flat/Name"},
+	}
+	tree := NewMailboxTree(list)
+
+	var out []string
+	tree.Walk(func(n *MailboxNode) bool {
+		out = append(out, strings.Repeat("  ", n.Depth())+n.Name)
+		return true
+	})
+	want := []string{
+		"INBOX",
+		"  Lists",
+		"archive",
+		"Flat/Name",
+		"Public",
+		"  Shared",
+		"Work",
+		"  Reports",
+		"    2024",
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("Walk() expected\n%v; got\n%v", want, out)
+	}
+
+	if n := tree.Find("Work/Reports/2024"); n == nil || n.Info != list[0] || n.Parent.Path != "Work/Reports" {
+		t.Errorf("Find(Work/Reports/2024) unexpected node %+v", n)
+	}
+	if n := tree.Find("Work/Reports"); n == nil || n.Info != nil || n.Selectable() {
+		t.Errorf("Find(Work/Reports) expected implied parent; got %+v", n)
+	}
+	if n := tree.Find("Work"); n == nil || n.Info != list[2] || n.Selectable() {
+		t.Errorf("Find(Work) expected non-selectable mailbox; got %+v", n)
+	}
+	if n := tree.Find("Inbox/Lists"); n == nil || n.Info != list[4] || !n.Selectable() {
+		t.Errorf("Find(Inbox/Lists) unexpected node %+v", n)
+	}
+	if n := tree.Find("inboxLists"); n != nil {
+		t.Errorf("Find(inboxLists) expected nil; got %+v", n)
+	}
+
+	tree.Sort(func(a, b *MailboxNode) bool { return a.Name > b.Name })
+	var names []string
+	for _, n := range tree.Roots {
+		names = append(names, n.Name)
+	}
+	if want := []string{"archive", "Work", "Public", "INBOX", "Flat/Name"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Sort() expected %q; got %q", want, names)
+	}
+}
+
+func TestMailboxPath(t *testing.T) {
+	tests := []struct {
+		name, delim string
+		parts       []string
+	}{
+		{"", "/", nil},
+		{"INBOX", "/", []string{"INBOX"}},
+		{"Inbox.Sub.Folder", ".", []string{"INBOX", "Sub", "Folder"}},
+		{"Work/Inbox", "/", []string{"Work", "Inbox"}},
+		{"a/b", "", []string{"a/b"}},
+	}
+	for _, test := range tests {
+		parts := SplitMailboxPath(test.name, test.delim)
+		if !reflect.DeepEqual(parts, test.parts) {
+			t.Errorf("SplitMailboxPath(%q, %q) expected %q; got %q", test.name, test.delim, test.parts, parts)
+		} else if name := JoinMailboxPath(test.delim, parts...); !strings.EqualFold(name, test.name) {
+			t.Errorf("JoinMailboxPath(%q, %q) expected %q; got %q", test.delim, parts, test.name, name)
+		}
+	}
+}
+
+func TestSessionCreateAll(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 LIST "" ""`+CRLF,
+		`S: * LIST (\Noselect) "." ""`+CRLF,
+		`S: A1 OK LIST completed`+CRLF,
+		`C: A2 CREATE "Work"`+CRLF,
+		`S: A2 NO [ALREADYEXISTS] Mailbox exists`+CRLF,
+		`C: A3 CREATE "Work.Reports"`+CRLF,
+		`S: A3 NO Cannot create mailbox`+CRLF,
+		`C: A4 LIST "" "Work.Reports"`+CRLF,
+		`S: * LIST () "." "Work.Reports"`+CRLF,
+		`S: A4 OK LIST completed`+CRLF,
+		`C: A5 CREATE "Work.Reports.2024"`+CRLF,
+		`S: A5 OK CREATE completed`+CRLF,
+		`C: A6 SUBSCRIBE "Work.Reports.2024"`+CRLF,
+		`S: A6 OK SUBSCRIBE completed`+CRLF,
+	)
+	created, err := S.CreateAll("Work/Reports//2024/", true)
+	t.join("CREATE", err)
+	if want := []string{"Work.Reports.2024"}; !reflect.DeepEqual(created, want) {
+		t.Errorf("CreateAll() expected %v; got %v", want, created)
+	}
+
+	go t.script(
+		`C: A7 LIST "" ""`+CRLF,
+		`S: * LIST (\Noselect) "/" ""`+CRLF,
+		`S: A7 OK LIST completed`+CRLF,
+		`C: A8 CREATE "Shared"`+CRLF,
+		`S: A8 NO [NOPERM] Permission denied`+CRLF,
+		`C: A9 LIST "" "Shared"`+CRLF,
+		`S: A9 OK LIST completed`+CRLF,
+	)
+	created, err = S.CreateAll("Shared/Team", false)
+	t.join("LIST", nil)
+	if rsp, ok := err.(ResponseError); !ok || rsp.Label != "NOPERM" || created != nil {
+		t.Errorf("CreateAll() expected NOPERM error; got %v, %v", created, err)
+	}
+	if _, err = S.CreateAll("/", false); err != ErrEmptyPath {
+		t.Errorf("CreateAll() expected ErrEmptyPath; got %v", err)
+	}
+}
+
+func TestSessionDeleteRecursive(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 LIST "" "Work"`+CRLF,
+		`S: * LIST (\HasChildren) "/" "Work"`+CRLF,
+		`S: A1 OK LIST completed`+CRLF,
+		`C: A2 LIST "" "Work/*"`+CRLF,
+		`S: * LIST (\HasChildren) "/" "Work/A"`+CRLF,
+		`S: * LIST () "/" "Work/A/1"`+CRLF,
+		`S: * LIST () "/" "Work/B"`+CRLF,
+		`S: A2 OK LIST completed`+CRLF,
+		`C: A3 DELETE "Work/A/1"`+CRLF,
+		`S: A3 OK DELETE completed`+CRLF,
+		`C: A4 DELETE "Work/A"`+CRLF,
+		`S: A4 OK DELETE completed`+CRLF,
+		`C: A5 DELETE "Work/B"`+CRLF,
+		`S: A5 NO [INUSE] Mailbox in use`+CRLF,
+		`C: A6 DELETE "Work"`+CRLF,
+		`S: A6 NO [HASCHILDREN] Mailbox has children`+CRLF,
+	)
+	results, err := S.DeleteRecursive("Work")
+	t.join("DELETE", nil)
+	if rsp, ok := err.(ResponseError); !ok || rsp.Label != "INUSE" {
+		t.Errorf("DeleteRecursive() expected INUSE error; got %v", err)
+	}
+	var out []string
+	for _, r := range results {
+		out = append(out, r.Mailbox+" "+strconv.FormatBool(r.Err == nil))
+	}
+	want := []string{"Work/A/1 true", "Work/A true", "Work/B false", "Work false"}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("DeleteRecursive() expected %v; got %v", want, out)
+	}
+}
+
+func TestSessionRenameRecursive(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	S := NewSession(C)
+	format := func(results []*MailboxResult) (out []string) {
+		for _, r := range results {
+			out = append(out, r.Mailbox+" -> "+r.NewName)
+			if r.Err != nil {
+				out = append(out, r.Err.Error())
+			}
+		}
+		return
+	}
+
+	go t.script(
+		`C: A1 LIST "" "Old"`+CRLF,
+		`S: * LIST (\HasChildren) "/" "Old"`+CRLF,
+		`S: A1 OK LIST completed`+CRLF,
+		`C: A2 LIST "" "Old/*"`+CRLF,
+		`S: * LIST (\HasChildren) "/" "Old/A"`+CRLF,
+		`S: * LIST () "/" "Old/A/1"`+CRLF,
+		`S: A2 OK LIST completed`+CRLF,
+		`C: A3 RENAME "Old" "New"`+CRLF,
+		`S: A3 OK RENAME completed`+CRLF,
+		`C: A4 LIST "" "Old/*"`+CRLF,
+		`S: * LIST () "/" "Old/A/1"`+CRLF,
+		`S: * LIST (\HasChildren) "/" "Old/A"`+CRLF,
+		`S: A4 OK LIST completed`+CRLF,
+		`C: A5 RENAME "Old/A" "New/A"`+CRLF,
+		`S: A5 OK RENAME completed`+CRLF,
+		`C: A6 LIST "" "Old/*"`+CRLF,
+		`S: * LIST () "/" "Old/A/1"`+CRLF,
+		`S: A6 OK LIST completed`+CRLF,
+		`C: A7 RENAME "Old/A/1" "New/A/1"`+CRLF,
+		`S: A7 OK RENAME completed`+CRLF,
+		`C: A8 LIST "" "Old/*"`+CRLF,
+		`S: A8 OK LIST completed`+CRLF,
+	)
+	results, err := S.RenameRecursive("Old", "New")
+	t.join("RENAME", err)
+	want := []string{"Old -> New", "Old/A -> New/A", "Old/A/1 -> New/A/1"}
+	if out := format(results); !reflect.DeepEqual(out, want) {
+		t.Errorf("RenameRecursive() expected %v; got %v", want, out)
+	}
+
+	go t.script(
+		`C: A9 LIST "" "X"`+CRLF,
+		`S: * LIST (\HasChildren) "." "X"`+CRLF,
+		`S: A9 OK LIST completed`+CRLF,
+		`C: A10 LIST "" "X.*"`+CRLF,
+		`S: * LIST () "." "X.a"`+CRLF,
+		`S: A10 OK LIST completed`+CRLF,
+		`C: A11 RENAME "X" "Y"`+CRLF,
+		`S: A11 OK RENAME completed`+CRLF,
+		`C: A12 LIST "" "X.*"`+CRLF,
+		`S: A12 OK LIST completed`+CRLF,
+	)
+	results, err = S.RenameRecursive("X", "Y")
+	t.join("RENAME", err)
+	want = []string{"X -> Y", "X.a -> Y.a"}
+	if out := format(results); !reflect.DeepEqual(out, want) {
+		t.Errorf("RenameRecursive() expected %v; got %v", want, out)
+	}
+}
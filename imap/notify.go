@@ -0,0 +1,108 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+// notifyBuffer is the capacity of the channel returned by Client.Notifications.
+const notifyBuffer = 64
+
+// MailboxEventType identifies the change reported by a MailboxEvent.
+type MailboxEventType uint8
+
+// Mailbox event types.
+const (
+	MailboxExists  = MailboxEventType(1 << iota) // Number of messages changed (EXISTS)
+	MailboxExpunge                               // Message was expunged (EXPUNGE)
+	MailboxFlags                                 // Message flags changed (FETCH)
+	MailboxResync                                // Events were discarded
+)
+
+var mailboxEventTypes = []enumName{
+	{uint32(MailboxExists), "MailboxExists"},
+	{uint32(MailboxExpunge), "MailboxExpunge"},
+	{uint32(MailboxFlags), "MailboxFlags"},
+	{uint32(MailboxResync), "MailboxResync"},
+}
+
+func (v MailboxEventType) String() string   { return enumString(uint32(v), mailboxEventTypes, false) }
+func (v MailboxEventType) GoString() string { return enumString(uint32(v), mailboxEventTypes, true) }
+
+// MailboxEvent is an unsolicited change in the selected mailbox, as reported by
+// Client.Notifications.
+type MailboxEvent struct {
+	Type     MailboxEventType // Type of change
+	Mailbox  string           // Selected mailbox name
+	Messages uint32           // Number of messages after the change
+	Seq      uint32           // Message sequence number (0 for MailboxExists)
+	UID      uint32           // Message UID (0 if unknown)
+	Flags    FlagSet          // New message flags (MailboxFlags only)
+}
+
+// Notifications returns a channel that receives an event for each unsolicited
+// EXISTS, EXPUNGE, and FETCH (with FLAGS) response about the selected mailbox.
+// These are the responses that are not part of any command in progress, which
+// the server sends while the client is idling (see Idle) or along with the
+// results of other commands (e.g. NOOP). The responses are still added to
+// c.Data as usual. Events are generated only while responses are being received
+// by Client methods, such as Recv or Command.Result.
+//
+// The channel is created by the first call, which, like other Client methods,
+// must not be made concurrently with receiving responses. The channel itself may
+// be read from any goroutine. It has a buffer of 64 events. Events are discarded
+// when the buffer is full, so that a slow reader never blocks the Client. The
+// last slot is reserved for a MailboxResync event, which replaces the discarded
+// events. The reader must then refresh its view of the mailbox (e.g. with NOOP
+// and a FETCH of the flags and UIDs). The channel is closed when the connection
+// is closed.
+func (c *Client) Notifications() <-chan MailboxEvent {
+	if c.notify == nil {
+		c.notify = make(chan MailboxEvent, notifyBuffer)
+		if c.state == Closed {
+			close(c.notify)
+		}
+	}
+	return c.notify
+}
+
+// notifyEvent sends the event for an unsolicited response, if any, to the
+// Notifications channel.
+func (c *Client) notifyEvent(rsp *Response) {
+	if c.notify == nil || c.state != Selected || rsp.Type != Data || c.Mailbox == nil {
+		return
+	}
+	ev := MailboxEvent{Mailbox: c.Mailbox.Name, Messages: c.Mailbox.Messages}
+	switch rsp.Label {
+	case "EXISTS":
+		ev.Type = MailboxExists
+	case "EXPUNGE":
+		ev.Type, ev.Seq = MailboxExpunge, rsp.Value()
+		if c.UIDs != nil {
+			ev.UID = c.UIDs.expunged
+		}
+	case "FETCH":
+		info := rsp.MessageInfo()
+		if info == nil || info.Attrs["FLAGS"] == nil {
+			return
+		}
+		ev.Type, ev.Seq, ev.UID, ev.Flags = MailboxFlags, info.Seq, info.UID, info.Flags
+		if ev.UID == 0 && c.UIDs != nil {
+			ev.UID = c.UIDs.UID(ev.Seq)
+		}
+	default:
+		return
+	}
+	// Only this goroutine sends events, so the buffer cannot fill up between
+	// the length check and the send.
+	switch n := len(c.notify); {
+	case n < cap(c.notify)-1:
+		c.notify <- ev
+		c.notifyLost = false
+	case n == cap(c.notify)-1 && !c.notifyLost:
+		c.notify <- MailboxEvent{Type: MailboxResync, Mailbox: ev.Mailbox, Messages: ev.Messages}
+		c.notifyLost = true
+		fallthrough
+	default:
+		c.Logf(LogState, "Notification dropped: %v", ev.Type)
+	}
+}
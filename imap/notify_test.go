@@ -0,0 +1,83 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClientNotifications(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	events := C.Notifications()
+
+	go t.script(
+		`C: A1 SELECT "INBOX"`+CRLF,
+		`S: * 2 EXISTS`+CRLF,
+		`S: A1 OK [READ-WRITE] INBOX selected.`+CRLF,
+		`C: A2 UID STORE 6 +FLAGS (\Flagged)`+CRLF,
+		`S: * 2 FETCH (UID 6 FLAGS (\Flagged))`+CRLF,
+		`S: A2 OK STORE completed`+CRLF,
+		`C: A3 NOOP`+CRLF,
+		`S: * 1 FETCH (UID 5)`+CRLF,
+		`S: * 3 EXISTS`+CRLF,
+		`S: * 1 EXPUNGE`+CRLF,
+		`S: * 1 FETCH (FLAGS (\Seen))`+CRLF,
+		`S: A3 OK NOOP completed`+CRLF,
+	)
+	_, err := C.Select("INBOX", false)
+	if err == nil {
+		_, err = Wait(C.UIDStore(newSeqSet("6"), "+FLAGS", NewFlagSet(`\Flagged`)))
+	}
+	if err == nil {
+		_, err = Wait(C.Noop())
+	}
+	t.join("NOOP", err)
+
+	want := []MailboxEvent{
+		{Type: MailboxExists, Mailbox: "INBOX", Messages: 3},
+		{Type: MailboxExpunge, Mailbox: "INBOX", Messages: 2, Seq: 1, UID: 5},
+		{Type: MailboxFlags, Mailbox: "INBOX", Messages: 2, Seq: 1, UID: 6, Flags: NewFlagSet(`\Seen`)},
+	}
+	var got []MailboxEvent
+	for len(events) > 0 {
+		got = append(got, <-events)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Notifications() expected\n%v; got\n%v", want, got)
+	}
+	if C.Notifications() != events {
+		t.Errorf("Notifications() returned a different channel")
+	}
+}
+
+func TestClientNotificationsResync(T *testing.T) {
+	C, _ := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	events := C.Notifications()
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+
+	exists := &Response{Type: Data, Label: "EXISTS"}
+	for i := 0; i < notifyBuffer+5; i++ {
+		C.notifyEvent(exists)
+	}
+	if len(events) != notifyBuffer {
+		T.Fatalf("Notifications() expected %d events; got %d", notifyBuffer, len(events))
+	}
+	for i := 0; i < notifyBuffer-1; i++ {
+		if ev := <-events; ev.Type != MailboxExists {
+			T.Fatalf("Notifications() expected MailboxExists; got %v", ev.Type)
+		}
+	}
+
+	// The discarded events are replaced by one MailboxResync event
+	if ev := <-events; ev.Type != MailboxResync || len(events) != 0 {
+		T.Errorf("Notifications() expected only MailboxResync; got %v (%d)", ev.Type, len(events))
+	}
+	C.notifyEvent(exists)
+	if ev := <-events; ev.Type != MailboxExists {
+		T.Errorf("Notifications() expected MailboxExists; got %v", ev.Type)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+// Pager splits an ordered list of UIDs, such as the results of a SEARCH or SORT
+// command, into fixed-size windows that can be retrieved with successive FETCH
+// commands. The order of the list is preserved: window 0 contains the first
+// size UIDs, window 1 the next size UIDs, and so on.
+type Pager struct {
+	uids []uint32
+	size int
+}
+
+// NewPager returns a pager over uids with windows of up to size UIDs (at least
+// 1). The slice is not copied and must not be modified while the pager is in
+// use.
+func NewPager(uids []uint32, size int) *Pager {
+	if size <= 0 {
+		size = 1
+	}
+	return &Pager{uids, size}
+}
+
+// Reverse returns a pager over the UIDs in reverse order, which can be used to
+// display the newest messages first when the list is in ascending order. The
+// windows of the new pager are aligned to the end of the original list, so the
+// first window is always full.
+func (p *Pager) Reverse() *Pager {
+	rev := make([]uint32, len(p.uids))
+	for i, uid := range p.uids {
+		rev[len(rev)-1-i] = uid
+	}
+	return &Pager{rev, p.size}
+}
+
+// Len returns the total number of UIDs.
+func (p *Pager) Len() int {
+	return len(p.uids)
+}
+
+// Windows returns the number of windows.
+func (p *Pager) Windows() int {
+	return (len(p.uids) + p.size - 1) / p.size
+}
+
+// Window returns the UIDs in window i in list order. Nil is returned if i is
+// out of range.
+func (p *Pager) Window(i int) []uint32 {
+	if i < 0 || i >= p.Windows() {
+		return nil
+	}
+	j := i * p.size
+	k := j + p.size
+	if k > len(p.uids) {
+		k = len(p.uids)
+	}
+	return p.uids[j:k:k]
+}
+
+// Set returns the UIDs in window i as a sequence set for a UID FETCH command.
+// Since a set is unordered, Session.Fetch results must be reordered using
+// Window (see Pager.Fetch). Nil is returned if i is out of range.
+func (p *Pager) Set(i int) *SeqSet {
+	if w := p.Window(i); w != nil {
+		return NewSeqSetNums(w)
+	}
+	return nil
+}
+
+// Fetch retrieves the messages in window i with UID FETCH and returns them in
+// list order. Messages that were not returned by the server (e.g. because they
+// were expunged) are omitted. UIDs are used regardless of s.UID. Nil is
+// returned if i is out of range.
+func (p *Pager) Fetch(s *Session, i int, items ...string) ([]*MessageInfo, error) {
+	w := p.Window(i)
+	if w == nil {
+		return nil, nil
+	}
+	cmd, err := Wait(s.Client.UIDFetch(NewSeqSetNums(w), items...))
+	if err != nil {
+		return nil, err
+	}
+	byUID := cmd.MessagesByUID()
+	msgs := make([]*MessageInfo, 0, len(w))
+	for _, uid := range w {
+		if msg := byUID[uid]; msg != nil {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPager(t *testing.T) {
+	p := NewPager([]uint32{9, 3, 7, 1, 5}, 2)
+	if p.Len() != 5 || p.Windows() != 3 {
+		t.Errorf("Len()/Windows() expected 5/3; got %d/%d", p.Len(), p.Windows())
+	}
+	want := [][]uint32{{9, 3}, {7, 1}, {5}, nil}
+	for i, w := range want {
+		if v := p.Window(i); !reflect.DeepEqual(v, w) {
+			t.Errorf("Window(%d) expected %v; got %v", i, w, v)
+		}
+	}
+	if s := p.Set(0); s.String() != "3,9" {
+		t.Errorf("Set(0) expected 3,9; got %v", s)
+	}
+	if p.Set(-1) != nil {
+		t.Errorf("Set(-1) expected nil")
+	}
+	r := p.Reverse()
+	want = [][]uint32{{5, 1}, {7, 3}, {9}}
+	for i, w := range want {
+		if v := r.Window(i); !reflect.DeepEqual(v, w) {
+			t.Errorf("Reverse().Window(%d) expected %v; got %v", i, w, v)
+		}
+	}
+	if e := NewPager(nil, 0); e.Windows() != 0 || e.Window(0) != nil {
+		t.Errorf("empty pager returned a window")
+	}
+}
+
+func TestPagerFetch(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	p := NewPager([]uint32{9, 3, 7, 1, 5}, 3)
+	go t.script(
+		`C: A1 UID FETCH 3,7,9 (FLAGS)`+CRLF,
+		`S: * 1 FETCH (UID 3 FLAGS ())`+CRLF,
+		`S: * 4 FETCH (UID 9 FLAGS (\Seen))`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+	)
+	msgs, err := p.Fetch(S, 0, "FLAGS")
+	t.join("FETCH", err)
+	var uids []uint32
+	for _, msg := range msgs {
+		uids = append(uids, msg.UID)
+	}
+	if !reflect.DeepEqual(uids, []uint32{9, 3}) {
+		t.Errorf("Fetch() expected [9 3]; got %v", uids)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"io"
+	"math/bits"
+	"sync"
+)
+
+// Size classes of the literal buffer pool. Buffers are allocated in powers of
+// two between 1<<minPoolBits and 1<<maxPoolBits bytes. Larger literals are
+// allocated directly and are not returned to the pool.
+const (
+	minPoolBits = 12 // 4 KB
+	maxPoolBits = 24 // 16 MB
+)
+
+// literalPool contains reusable literal buffers, indexed by size class.
+var literalPool [maxPoolBits - minPoolBits + 1]sync.Pool
+
+// poolClass returns the size class for a buffer of n bytes, or -1 if n is too
+// large to be pooled.
+func poolClass(n uint32) int {
+	c := bits.Len32(n - 1)
+	if n <= 1 || c < minPoolBits {
+		return 0
+	} else if c > maxPoolBits {
+		return -1
+	}
+	return c - minPoolBits
+}
+
+// getBuffer returns a buffer of length n from the pool, or a new one if the pool
+// is empty.
+func getBuffer(n uint32) ([]byte, bool) {
+	c := poolClass(n)
+	if c < 0 {
+		return make([]byte, n), false
+	} else if b, ok := literalPool[c].Get().(*[]byte); ok {
+		return (*b)[:n], true
+	}
+	return make([]byte, n, 1<<uint(c+minPoolBits)), true
+}
+
+// putBuffer returns b to the pool.
+func putBuffer(b []byte) {
+	if c := poolClass(uint32(cap(b))); c >= 0 && cap(b) == 1<<uint(c+minPoolBits) {
+		b = b[:0]
+		literalPool[c].Put(&b)
+	}
+}
+
+// PoolReader implements the LiteralReader interface by reading incoming
+// literals into buffers that are obtained from a shared pool. Unlike
+// MemoryReader, which allocates a new buffer for every literal, PoolReader
+// allows the memory used by large FETCH responses to be reused once the
+// application is done with the data. Literals are read directly from the
+// connection buffer into their final location, and AsBytes returns the pooled
+// buffer without copying. Use Client.SetLiteralReader to install it.
+//
+// The buffers are only reused if they are released with ReleaseLiteral or
+// Response.ReleaseLiterals. Unreleased buffers are reclaimed by the garbage
+// collector as usual.
+type PoolReader struct{}
+
+func (PoolReader) ReadLiteral(r io.Reader, i LiteralInfo) (Literal, error) {
+	if i.Len == 0 {
+		return &literal{info: i}, nil
+	}
+	b, pool := getBuffer(i.Len)
+	n, err := io.ReadFull(r, b)
+	return &literal{data: b[:n], info: i, pool: pool}, err
+}
+
+// ReleaseLiteral returns the buffer of a literal that was received by
+// PoolReader to the pool. The literal becomes empty, and any slices returned
+// by AsBytes for it must no longer be used. The temporary files of literals
+// received by SpillReader are removed. Other fields are ignored.
+func ReleaseLiteral(f Field) {
+	switch l := f.(type) {
+	case *literal:
+		if l.pool {
+			putBuffer(l.data)
+			l.data, l.pool = nil, false
+		}
+	case *FileLiteral:
+		l.Close()
+	}
+}
+
+// ReleaseLiterals releases all literals in the response (see ReleaseLiteral).
+// It should be called after the response and any MessageInfo values decoded
+// from it are no longer needed.
+func (rsp *Response) ReleaseLiterals() {
+	for _, l := range rsp.Literals {
+		ReleaseLiteral(l)
+	}
+}
+
+// fieldsCap is the capacity of new Field slices. Most lists are short, so this
+// avoids growing the slice several times.
+const fieldsCap = 8
+
+// Pools of Response structs and Field slices created by the response parser.
+var (
+	responsePool sync.Pool
+	fieldsPool   sync.Pool
+)
+
+// newResponse returns an empty Response from the pool.
+func newResponse() *Response {
+	if rsp, ok := responsePool.Get().(*Response); ok {
+		return rsp
+	}
+	return new(Response)
+}
+
+// getFields returns an empty Field slice from the pool.
+func getFields() []Field {
+	if p, ok := fieldsPool.Get().(*[]Field); ok {
+		return *p
+	}
+	return make([]Field, 0, fieldsCap)
+}
+
+// putFields returns f and all nested lists to the pool.
+func putFields(f []Field) {
+	for i, v := range f {
+		if list, ok := v.([]Field); ok {
+			putFields(list)
+		}
+		f[i] = nil
+	}
+	if cap(f) >= fieldsCap && cap(f) <= 4*fieldsCap {
+		f = f[:0]
+		fieldsPool.Put(&f)
+	}
+}
+
+// Release returns the response and its Fields, including all nested lists, to
+// an internal pool for reuse by future responses, which reduces garbage
+// collection overhead in applications that process a large number of
+// responses (e.g. by consuming c.Data or cmd.Data). Release is optional;
+// responses that are not released are garbage collected as usual.
+//
+// The caller must own the response: it must have been removed from c.Data or
+// cmd.Data, and no other references to it may remain. After Release returns,
+// the response and all values obtained from it, including Fields, MessageInfo
+// attributes, and other decoded values, must no longer be used. Literals are
+// not released (see ReleaseLiterals).
+func (rsp *Response) Release() {
+	if rsp == nil || rsp == abort {
+		return
+	}
+	putFields(rsp.Fields)
+	*rsp = Response{}
+	responsePool.Put(rsp)
+}
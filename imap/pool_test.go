@@ -0,0 +1,94 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPoolClass(t *testing.T) {
+	tests := []struct {
+		n     uint32
+		class int
+	}{
+		{1, 0},
+		{100, 0},
+		{4096, 0},
+		{4097, 1},
+		{8192, 1},
+		{1 << 24, maxPoolBits - minPoolBits},
+		{1<<24 + 1, -1},
+	}
+	for _, test := range tests {
+		if c := poolClass(test.n); c != test.class {
+			t.Errorf("poolClass(%d) expected %d; got %d", test.n, test.class, c)
+		}
+	}
+}
+
+func TestPoolReader(t *testing.T) {
+	data := strings.Repeat("0123456789", 1000)
+	l, err := PoolReader{}.ReadLiteral(strings.NewReader(data+"extra"), LiteralInfo{Len: 10000})
+	if err != nil {
+		t.Fatalf("ReadLiteral() unexpected error; %v", err)
+	}
+	b := AsBytes(l)
+	if string(b) != data || cap(b) != 16384 {
+		t.Fatalf("ReadLiteral() unexpected data (len=%d cap=%d)", len(b), cap(b))
+	}
+	var buf bytes.Buffer
+	if n, err := l.WriteTo(&buf); n != 10000 || err != nil || buf.String() != data {
+		t.Errorf("WriteTo() unexpected result %d, %v", n, err)
+	}
+
+	rsp := &Response{Literals: []Literal{l, NewLiteral([]byte("keep"))}}
+	rsp.ReleaseLiterals()
+	if AsBytes(l) != nil {
+		t.Errorf("AsBytes() returned data after release")
+	}
+	if s := AsString(rsp.Literals[1]); s != "keep" {
+		t.Errorf("ReleaseLiterals() modified a regular literal: %q", s)
+	}
+	ReleaseLiteral(l) // No-op
+
+	l, err = PoolReader{}.ReadLiteral(strings.NewReader("ab"), LiteralInfo{Len: 3})
+	if err == nil || AsString(l) != "ab" {
+		t.Errorf("ReadLiteral() expected short read error; got %q, %v", AsString(l), err)
+	}
+	if l, err = (PoolReader{}).ReadLiteral(strings.NewReader(""), LiteralInfo{}); l == nil || err != nil {
+		t.Errorf("ReadLiteral() unexpected empty literal result %v, %v", l, err)
+	}
+}
+
+func TestResponseRelease(t *testing.T) {
+	c, s := newTestConn(1024)
+	C := newTransport(c, nil)
+	r := newReader(C, MemoryReader{}, "A")
+
+	for i := 0; i < 3; i++ {
+		C.clear()
+		s.Write([]byte(`* 1 FETCH (UID 7 FLAGS (\Seen))` + CRLF))
+		raw, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next() unexpected error; %v", err)
+		}
+		rsp, err := raw.Parse()
+		if err != nil {
+			t.Fatalf("Parse() unexpected error; %v", err)
+		}
+		msg := rsp.MessageInfo()
+		if rsp.Order != int64(i+1) || msg == nil || msg.UID != 7 || !msg.Flags[FlagSeen] {
+			t.Fatalf("Parse() unexpected response %v", rsp)
+		}
+		rsp.Release()
+		if rsp.Fields != nil || rsp.Decoded != nil || rsp.Tag != "" {
+			t.Errorf("Release() did not reset the response")
+		}
+	}
+	abort.Release()
+	(*Response)(nil).Release()
+}
@@ -0,0 +1,44 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// Profiler label keys.
+const (
+	labelGoroutine = "imap.goroutine"
+	labelCommand   = "imap.command"
+	labelMailbox   = "imap.mailbox"
+)
+
+// labelReceiver adds or removes the label that identifies the current goroutine
+// as a Client receiver.
+func labelReceiver(on bool) {
+	ctx := context.Background()
+	if on {
+		ctx = pprof.WithLabels(ctx, pprof.Labels(labelGoroutine, "receiver"))
+	}
+	pprof.SetGoroutineLabels(ctx)
+}
+
+// profile calls f with profiler labels and a trace region that identify cmd.
+func (cmd *Command) profile(f func()) {
+	name, mbox := cmd.Name(true), ""
+	if m := cmd.client.Mailbox; m != nil {
+		mbox = m.Name
+	}
+	labels := pprof.Labels(labelCommand, name, labelMailbox, mbox)
+	pprof.Do(context.Background(), labels, func(ctx context.Context) {
+		if trace.IsEnabled() {
+			trace.WithRegion(ctx, "imap "+name, f)
+		} else {
+			f()
+		}
+	})
+}
@@ -0,0 +1,31 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"runtime/trace"
+	"testing"
+)
+
+func TestProfileLabels(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.ProfileLabels = true
+
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("trace.Start() failed; %v", err)
+	}
+	go t.script(
+		`C: A1 NOOP`+CRLF,
+		`S: A1 OK NOOP completed`+CRLF,
+	)
+	_, err := Wait(C.Noop())
+	trace.Stop()
+	t.join("NOOP", err)
+	if !bytes.Contains(buf.Bytes(), []byte("imap NOOP")) {
+		t.Errorf("trace does not contain the %q region", "imap NOOP")
+	}
+}
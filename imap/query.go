@@ -0,0 +1,344 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryError is returned by ParseQuery when the query syntax is invalid.
+type QueryError struct {
+	Info   string // Short message explaining the problem
+	Query  string // Original query
+	Offset int    // Byte offset of the problem, starting at 0
+}
+
+func (err *QueryError) Error() string {
+	return fmt.Sprintf("imap: %s at offset %d of query %q",
+		err.Info, err.Offset, err.Query)
+}
+
+// queryDateFormats are the date formats accepted by date query terms.
+var queryDateFormats = []string{"2006-01-02", "2006/01/02", "2-Jan-2006"}
+
+// queryFlags maps the values of "is:" query terms to SearchCriteria keys.
+var queryFlags = map[string]func(*SearchCriteria) *SearchCriteria{
+	"answered":   (*SearchCriteria).Answered,
+	"replied":    (*SearchCriteria).Answered,
+	"unanswered": (*SearchCriteria).Unanswered,
+	"deleted":    (*SearchCriteria).Deleted,
+	"undeleted":  (*SearchCriteria).Undeleted,
+	"draft":      (*SearchCriteria).Draft,
+	"undraft":    (*SearchCriteria).Undraft,
+	"flagged":    (*SearchCriteria).Flagged,
+	"starred":    (*SearchCriteria).Flagged,
+	"unflagged":  (*SearchCriteria).Unflagged,
+	"unstarred":  (*SearchCriteria).Unflagged,
+	"seen":       (*SearchCriteria).Seen,
+	"read":       (*SearchCriteria).Seen,
+	"unseen":     (*SearchCriteria).Unseen,
+	"unread":     (*SearchCriteria).Unseen,
+	"new":        (*SearchCriteria).New,
+	"old":        (*SearchCriteria).Old,
+	"recent":     (*SearchCriteria).Recent,
+}
+
+// ParseQuery compiles a human-friendly search query into SearchCriteria. The
+// query is a sequence of terms, all of which must match. A term is either a
+// word or quoted phrase, which is matched against the entire message (TEXT),
+// or a key:value pair, where the value may also be quoted. The supported keys
+// are:
+//
+//	from, to, cc, bcc, subject, body, text   string search
+//	since (after), before, on                internal date (YYYY-MM-DD)
+//	sentsince, sentbefore, senton            Date header (YYYY-MM-DD)
+//	larger, smaller                          size with optional K, M, or G suffix
+//	is                                       seen (read), unseen (unread),
+//	                                         flagged (starred), unflagged,
+//	                                         answered (replied), unanswered,
+//	                                         deleted, undeleted, draft, undraft,
+//	                                         new, old, recent
+//	has                                      attachment
+//	keyword                                  keyword flag
+//	uid                                      UID set (e.g. 1:100)
+//
+// A term prefixed with "-" is negated, terms may be grouped with parentheses,
+// and "OR" (upper case) between two terms matches either of them. Words with
+// an unknown key (e.g. "http://example.com") are treated as plain text. Since
+// IMAP cannot search for attachments directly, has:attachment matches
+// multipart/mixed messages. Example:
+//
+//	from:alice subject:"q2 report" since:2024-01-01 has:attachment
+func ParseQuery(q string) (*SearchCriteria, error) {
+	p := &queryParser{q: q}
+	sc, err := p.parseAnd()
+	if err == nil && p.pos < len(q) {
+		err = p.error("unmatched ')'")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// GmailRaw adds a Gmail X-GM-RAW key, which passes q to Gmail's own search
+// engine unmodified. The server must advertise the X-GM-EXT-1 capability.
+func (sc *SearchCriteria) GmailRaw(q string) *SearchCriteria {
+	return sc.addString("X-GM-RAW", q)
+}
+
+// QueryCriteria compiles a search query for c. If the server supports Gmail
+// extensions (X-GM-EXT-1), the query is passed through unmodified using
+// X-GM-RAW, which supports the full Gmail search syntax. Otherwise, the query
+// is compiled by ParseQuery.
+func (c *Client) QueryCriteria(q string) (*SearchCriteria, error) {
+	if c.Caps["X-GM-EXT-1"] {
+		return new(SearchCriteria).GmailRaw(q), nil
+	}
+	return ParseQuery(q)
+}
+
+// queryParser implements ParseQuery.
+type queryParser struct {
+	q   string // Query string
+	pos int    // Current offset in q
+}
+
+// error returns a QueryError for the current offset.
+func (p *queryParser) error(info string) error {
+	return &QueryError{info, p.q, p.pos}
+}
+
+// skipSpace advances the parser past any white space and returns false if the
+// end of the query was reached.
+func (p *queryParser) skipSpace() bool {
+	for p.pos < len(p.q) && (p.q[p.pos] == ' ' || p.q[p.pos] == '\t') {
+		p.pos++
+	}
+	return p.pos < len(p.q)
+}
+
+// parseAnd parses a sequence of terms until the end of the query or a closing
+// parenthesis.
+func (p *queryParser) parseAnd() (*SearchCriteria, error) {
+	sc := new(SearchCriteria)
+	for p.skipSpace() && p.q[p.pos] != ')' {
+		term, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		sc.And(term)
+	}
+	return sc, nil
+}
+
+// parseOr parses a term, which may be the first operand of one or more OR
+// operators.
+func (p *queryParser) parseOr() (*SearchCriteria, error) {
+	sc, err := p.parseUnary()
+	for err == nil {
+		start := p.pos
+		if !p.skipSpace() || !strings.HasPrefix(p.q[p.pos:], "OR") ||
+			(p.pos+2 < len(p.q) && !strings.ContainsRune(" \t(-\"", rune(p.q[p.pos+2]))) {
+			p.pos = start
+			break
+		}
+		p.pos += 2
+		if !p.skipSpace() {
+			return nil, p.error("missing OR operand")
+		}
+		var rhs *SearchCriteria
+		if rhs, err = p.parseUnary(); err == nil {
+			sc = new(SearchCriteria).Or(sc, rhs)
+		}
+	}
+	return sc, err
+}
+
+// parseUnary parses a single term, which may be negated or parenthesized.
+func (p *queryParser) parseUnary() (*SearchCriteria, error) {
+	p.skipSpace()
+	switch {
+	case p.pos >= len(p.q):
+		return nil, p.error("missing term")
+	case p.q[p.pos] == '-':
+		p.pos++
+		sc, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return new(SearchCriteria).Not(sc), nil
+	case p.q[p.pos] == '(':
+		start := p.pos
+		p.pos++
+		sc, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		} else if p.pos >= len(p.q) {
+			p.pos = start
+			return nil, p.error("unmatched '('")
+		} else if len(sc.keys) == 0 {
+			return nil, p.error("empty group")
+		}
+		p.pos++
+		return sc, nil
+	}
+	return p.parseTerm()
+}
+
+// parseTerm parses a word, quoted phrase, or key:value pair.
+func (p *queryParser) parseTerm() (*SearchCriteria, error) {
+	if p.q[p.pos] == '"' {
+		text, err := p.parseQuoted()
+		if err != nil {
+			return nil, err
+		}
+		return new(SearchCriteria).Text(text), nil
+	}
+	start := p.pos
+	word := p.parseWord()
+	i := strings.IndexByte(word, ':')
+	if i <= 0 || !queryKeys[strings.ToLower(word[:i])] {
+		return new(SearchCriteria).Text(word), nil
+	}
+	key, value := strings.ToLower(word[:i]), word[i+1:]
+	if p.pos = start + i + 1; p.pos < len(p.q) && p.q[p.pos] == '"' {
+		var err error
+		if value, err = p.parseQuoted(); err != nil {
+			return nil, err
+		}
+	} else {
+		p.pos += len(value)
+	}
+	if value == "" {
+		p.pos = start + i + 1
+		return nil, p.error("missing value for " + key)
+	}
+	sc, info := queryTerm(key, value)
+	if info != "" {
+		p.pos = start + i + 1
+		return nil, p.error(info)
+	}
+	return sc, nil
+}
+
+// parseWord returns the next sequence of characters up to white space or a
+// parenthesis.
+func (p *queryParser) parseWord() string {
+	start := p.pos
+	for ; p.pos < len(p.q); p.pos++ {
+		if c := p.q[p.pos]; c == ' ' || c == '\t' || c == '(' || c == ')' {
+			break
+		}
+	}
+	return p.q[start:p.pos]
+}
+
+// parseQuoted returns the contents of the quoted string at the current offset.
+// Backslash escapes the next character.
+func (p *queryParser) parseQuoted() (string, error) {
+	start := p.pos
+	var b []byte
+	for p.pos++; p.pos < len(p.q); p.pos++ {
+		switch c := p.q[p.pos]; c {
+		case '"':
+			p.pos++
+			return string(b), nil
+		case '\\':
+			if p.pos++; p.pos == len(p.q) {
+				break
+			}
+			b = append(b, p.q[p.pos])
+		default:
+			b = append(b, c)
+		}
+	}
+	p.pos = start
+	return "", p.error("unterminated quoted string")
+}
+
+// queryKeys identifies the keys supported by ParseQuery.
+var queryKeys = map[string]bool{
+	"from": true, "to": true, "cc": true, "bcc": true, "subject": true,
+	"body": true, "text": true, "keyword": true, "since": true, "after": true,
+	"before": true, "on": true, "sentsince": true, "sentbefore": true,
+	"senton": true, "larger": true, "smaller": true, "is": true, "has": true,
+	"uid": true,
+}
+
+// queryTerm returns the criteria for a key:value query term. A non-empty info
+// string is returned if the value is invalid.
+func queryTerm(key, v string) (*SearchCriteria, string) {
+	sc := new(SearchCriteria)
+	switch key {
+	case "from":
+		return sc.From(v), ""
+	case "to":
+		return sc.To(v), ""
+	case "cc":
+		return sc.Cc(v), ""
+	case "bcc":
+		return sc.Bcc(v), ""
+	case "subject":
+		return sc.Subject(v), ""
+	case "body":
+		return sc.Body(v), ""
+	case "text":
+		return sc.Text(v), ""
+	case "keyword":
+		if !isAtom(v) {
+			return nil, "invalid keyword " + strconv.Quote(v)
+		}
+		return sc.Keyword(v), ""
+	case "since", "after", "before", "on", "sentsince", "sentbefore", "senton":
+		for _, layout := range queryDateFormats {
+			if t, err := time.Parse(layout, v); err == nil {
+				if key == "after" {
+					key = "since"
+				}
+				return sc.addDate(toUpper(key), t), ""
+			}
+		}
+		return nil, "invalid date " + strconv.Quote(v)
+	case "larger", "smaller":
+		num, mul := v, uint64(1)
+		switch v[len(v)-1] {
+		case 'k', 'K':
+			mul = 1 << 10
+		case 'm', 'M':
+			mul = 1 << 20
+		case 'g', 'G':
+			mul = 1 << 30
+		}
+		if mul > 1 {
+			num = v[:len(v)-1]
+		}
+		n, err := strconv.ParseUint(num, 10, 32)
+		if err != nil || n*mul > 1<<32-1 {
+			return nil, "invalid size " + strconv.Quote(v)
+		}
+		return sc.add(toUpper(key), uint32(n*mul)), ""
+	case "is":
+		if add := queryFlags[strings.ToLower(v)]; add != nil {
+			return add(sc), ""
+		}
+		return nil, "unknown flag " + strconv.Quote(v)
+	case "has":
+		if strings.ToLower(v) == "attachment" {
+			return sc.Header("Content-Type", "multipart/mixed"), ""
+		}
+		return nil, "unknown has: value " + strconv.Quote(v)
+	case "uid":
+		uids, err := NewSeqSet(v)
+		if err != nil {
+			return nil, "invalid UID set " + strconv.Quote(v)
+		}
+		return sc.UID(uids), ""
+	}
+	return nil, "unknown key " + strconv.Quote(key)
+}
@@ -0,0 +1,67 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "testing"
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{``, `ALL`},
+		{`hello`, `TEXT "hello"`},
+		{`"hello world"`, `TEXT "hello world"`},
+		{`from:alice subject:"q2 report" since:2024-01-01 has:attachment`,
+			`FROM "alice" SUBJECT "q2 report" SINCE 1-Jan-2024 HEADER Content-Type "multipart/mixed"`},
+		{`From:bob@example.com after:2024/03/05 before:5-Apr-2024`,
+			`FROM "bob@example.com" SINCE 5-Mar-2024 BEFORE 5-Apr-2024`},
+		{`is:unread -is:starred`, `UNSEEN NOT FLAGGED`},
+		{`larger:10K smaller:2m`, `LARGER 10240 SMALLER 2097152`},
+		{`uid:1:100 keyword:$Junk`, `UID 1:100 KEYWORD $Junk`},
+		{`from:a OR from:b`, `OR FROM "a" FROM "b"`},
+		{`from:a OR from:b OR to:c`, `OR OR FROM "a" FROM "b" TO "c"`},
+		{`-(from:a is:seen) ORANGE`, `NOT (FROM "a" SEEN) TEXT "ORANGE"`},
+		{`(is:flagged OR is:draft) subject:"say \"hi\""`,
+			`OR FLAGGED DRAFT SUBJECT "say \"hi\""`},
+		{`http://example.com`, `TEXT "http://example.com"`},
+	}
+	for _, test := range tests {
+		sc, err := ParseQuery(test.in)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) unexpected error; %v", test.in, err)
+		} else if out := sc.String(); out != test.out {
+			t.Errorf("ParseQuery(%q) expected %q; got %q", test.in, test.out, out)
+		}
+	}
+
+	errors := []struct {
+		in     string
+		offset int
+	}{
+		{`subject:"q2 report`, 8},
+		{`(from:a`, 0},
+		{`from:a)`, 6},
+		{`()`, 1},
+		{`from:a OR`, 9},
+		{`since:yesterday`, 6},
+		{`larger:5T`, 7},
+		{`is:important`, 3},
+		{`from:`, 5},
+		{`keyword:"a b"`, 8},
+	}
+	for _, test := range errors {
+		_, err := ParseQuery(test.in)
+		if qe, ok := err.(*QueryError); !ok {
+			t.Errorf("ParseQuery(%q) expected QueryError; got %v", test.in, err)
+		} else if qe.Offset != test.offset {
+			t.Errorf("ParseQuery(%q) expected offset %d; got %d (%v)", test.in, test.offset, qe.Offset, err)
+		}
+	}
+
+	raw := new(SearchCriteria).GmailRaw(`has:attachment in:inbox`).String()
+	if want := `X-GM-RAW "has:attachment in:inbox"`; raw != want {
+		t.Errorf("GmailRaw expected %q; got %q", want, raw)
+	}
+}
@@ -5,6 +5,7 @@
 package imap
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
@@ -31,11 +32,19 @@ func (err *ParserError) Error() string {
 		err.Info, err.Offset, line, ellipsis)
 }
 
+// MaxListDepth is the default maximum nesting depth of parenthesized lists in
+// server responses (see Client.MaxListDepth). It is also the maximum nesting
+// depth of parts accepted by AsBodyStructure. Responses that exceed the limit
+// cause a ParserError, which terminates the connection.
+const MaxListDepth = 64
+
 // readerInput is the interface for reading all parts of a response. This
 // interface is implemented by transport.
 type readerInput interface {
 	io.Reader
 	ReadLine() (line []byte, err error)
+	ReadPart() (part []byte, err error)
+	EndLine(line []byte, err error) ([]byte, error)
 }
 
 // reader creates rawResponse structs and provides additional lines and literals
@@ -46,6 +55,13 @@ type reader struct {
 
 	tagid []byte // Tag prefix expected in command completion responses ([A-Z]+)
 	order int64  // Response order counter
+
+	compactSearch bool   // Decode SEARCH results directly (see Client.CompactSearch)
+	maxDepth      int    // Maximum list nesting depth (see Client.MaxListDepth)
+	maxLiteral    uint32 // Maximum literal size (see Client.MaxLiteralSize)
+
+	// Destination of streamed SEARCH results (see Client.SearchTo)
+	searchDest func(start, stop uint32)
 }
 
 // rawResponse is an intermediate response form used to construct full Response
@@ -58,8 +74,9 @@ type rawResponse struct {
 	*Response
 	*reader
 
-	line []byte // Full response line without literals or CRLFs
-	tail []byte // Unconsumed line ending (parser state)
+	line  []byte // Full response line without literals or CRLFs
+	tail  []byte // Unconsumed line ending (parser state)
+	depth int    // Current list nesting depth
 }
 
 // newReader returns a reader configured to accept tagged responses beginning
@@ -73,7 +90,49 @@ func newReader(in readerInput, lr LiteralReader, tagid string) *reader {
 			panic("imap: bad tagid format")
 		}
 	}
-	return &reader{in, lr, []byte(tagid), 0}
+	return &reader{readerInput: in, LiteralReader: lr, tagid: []byte(tagid),
+		maxDepth: MaxListDepth}
+}
+
+// ReadResponses parses server responses from r until io.EOF and calls f for
+// each one. It allows tools and tests, such as fuzzers, to decode captured or
+// generated data without a Client. Command completion responses must use tags
+// that begin with tagid ("A" if empty), and literals are read by lr
+// (MemoryReader if nil). Reading stops at the first parser or protocol error,
+// which is returned, or when f returns a non-nil error. Input that ends in the
+// middle of a response causes io.ErrUnexpectedEOF.
+func ReadResponses(r io.Reader, tagid string, lr LiteralReader, f func(rsp *Response) error) error {
+	if tagid == "" {
+		tagid = "A"
+	}
+	if lr == nil {
+		lr = MemoryReader{}
+	}
+	lnk := &ioLink{Reader: r}
+	t := &transport{
+		buf:     bufio.NewReadWriter(bufio.NewReaderSize(lnk, bufferSize(ReadBufferSize)), nil),
+		bufLink: lnk,
+	}
+	rd := newReader(t, lr, tagid)
+	for {
+		raw, err := rd.Next()
+		if err == nil {
+			var rsp *Response
+			if rsp, err = raw.Parse(); err == nil {
+				if err = f(rsp); err == nil {
+					continue
+				}
+				return err
+			}
+		}
+		if err == io.EOF {
+			if raw == nil {
+				return nil
+			}
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
 }
 
 // Next returns the next unparsed server response, or any data read prior to an
@@ -81,13 +140,19 @@ func newReader(in readerInput, lr LiteralReader, tagid string) *reader {
 // terminated because the client and server are no longer synchronized.
 func (r *reader) Next() (raw *rawResponse, err error) {
 	raw = &rawResponse{reader: r}
-	if raw.line, err = r.ReadLine(); err != nil {
+	if r.searchDest != nil {
+		raw.line, err = r.readSearch()
+	} else {
+		raw.line, err = r.ReadLine()
+	}
+	if err != nil {
 		if len(raw.line) == 0 {
 			raw = nil
 		}
 	} else if tag := r.tag(raw.line); tag != "" {
 		r.order++
-		raw.Response = &Response{Order: r.order, Raw: raw.line, Tag: tag}
+		raw.Response = newResponse()
+		raw.Order, raw.Raw, raw.Tag = r.order, raw.line, tag
 		raw.tail = raw.line[len(tag)+1:]
 	} else {
 		err = &ProtocolError{"bad response tag", raw.line}
@@ -98,7 +163,12 @@ func (r *reader) Next() (raw *rawResponse, err error) {
 // More returns the next literal string and reads one more line from the server.
 func (r *reader) More(raw *rawResponse, i LiteralInfo) (l Literal, err error) {
 	src := io.LimitedReader{R: r, N: int64(i.Len)}
-	if l, err = r.ReadLiteral(&src, i); l != nil {
+	if sr, ok := r.LiteralReader.(*StreamReader); ok {
+		l, err = sr.readLiteral(raw.line[:raw.pos()], &src, i)
+	} else {
+		l, err = r.ReadLiteral(&src, i)
+	}
+	if l != nil {
 		raw.Literals = append(raw.Literals, l)
 		if err == nil {
 			var line []byte
@@ -152,7 +222,11 @@ func (raw *rawResponse) Parse() (rsp *Response, err error) {
 			err = raw.parseStatus()
 		} else if err == errNotStatus {
 			rsp.Type = Data
-			rsp.Fields, err = raw.parseFields(nul)
+			if raw.compactSearch && isSearchLabel(raw.tail) {
+				err = raw.parseSearch()
+			} else {
+				rsp.Fields, err = raw.parseFields(nul)
+			}
 			if len(rsp.Fields) == 0 && err == nil {
 				err = raw.error("empty data response", 0)
 			}
@@ -308,12 +382,21 @@ func (raw *rawResponse) parseFields(stop byte) (fields []Field, err error) {
 		case LiteralString:
 			f, err = raw.parseLiteralString()
 		case List:
+			if raw.depth >= raw.maxDepth {
+				err = raw.error("list nesting limit exceeded", 0)
+				break
+			}
 			raw.tail = raw.tail[1:]
+			raw.depth++
 			f, err = raw.parseFields(')')
+			raw.depth--
 		default:
 			f, err = raw.parseAtom(raw.Type == Data && stop != ']')
 		}
 		if err == nil || f != nil {
+			if fields == nil {
+				fields = getFields()
+			}
 			fields = append(fields, f)
 		}
 		// Delimiter
@@ -342,6 +425,198 @@ func (raw *rawResponse) parseFields(stop byte) (fields []Field, err error) {
 	return
 }
 
+// isSearchLabel returns true if tail begins with the SEARCH label.
+func isSearchLabel(tail []byte) bool {
+	const label = "SEARCH"
+	return len(tail) >= len(label) && string(tail[:len(label)]) == label &&
+		(len(tail) == len(label) || tail[len(label)] == ' ')
+}
+
+// parseSearch decodes the numbers of a SEARCH response into a []uint32, which
+// is stored in rsp.Decoded (see Response.SearchResults), without creating a
+// Field for each one. Only the label and any fields that follow the numbers
+// (e.g. the MODSEQ list of RFC 7162) are stored in rsp.Fields. For results
+// containing millions of messages, this uses a fraction of the memory and time
+// required by parseFields.
+func (raw *rawResponse) parseSearch() (err error) {
+	raw.Label = "SEARCH"
+	raw.tail = raw.tail[len(raw.Label):]
+	var nums []uint32
+	for len(raw.tail) > 1 && raw.tail[0] == ' ' {
+		i := 1
+		for i < len(raw.tail) && raw.tail[i] != ' ' {
+			i++
+		}
+		n, ok := parseNumber(raw.tail[1:i])
+		if !ok {
+			break
+		}
+		nums = append(nums, n)
+		raw.tail = raw.tail[i:]
+	}
+	raw.Fields = append(getFields(), raw.Label)
+	if len(raw.tail) > 0 {
+		// Trailing space is allowed, as in parseFields
+		raw.tail = raw.tail[1:]
+		var more []Field
+		more, err = raw.parseFields(nul)
+		raw.Fields = append(raw.Fields, more...)
+	}
+	raw.Decoded = nums
+	return
+}
+
+// readSearch reads the next line like ReadLine, but the numbers of SEARCH
+// responses and the ALL sequence set of ESEARCH responses (RFC 4731) are passed
+// to r.searchDest as they are received. The rest of the line is returned for
+// parsing as usual. Such responses are not limited by the receive buffer size.
+func (r *reader) readSearch() (line []byte, err error) {
+	part, err := r.ReadPart()
+	s := newSearchStream(part, r.searchDest)
+	if s == nil {
+		return r.EndLine(part, err)
+	}
+	part, cr := part[len(s.line):], false
+	for {
+		switch {
+		case err == bufio.ErrBufferFull:
+			if cr {
+				s.write([]byte{'\r'})
+			}
+			if cr = part[len(part)-1] == '\r'; cr {
+				part = part[:len(part)-1]
+			}
+			s.write(part)
+		case err != nil:
+			return s.line, err
+		case cr && len(part) == 1:
+			s.end()
+		case cr || len(part) < 2 || part[len(part)-2] != '\r':
+			return s.line, &ProtocolError{"bad line ending", s.line}
+		default:
+			s.write(part[:len(part)-2])
+			s.end()
+		}
+		if s.err != nil {
+			return s.line, s.err
+		} else if err == nil {
+			return r.EndLine(append(s.line, '\r', '\n'), nil)
+		}
+		part, err = r.ReadPart()
+	}
+}
+
+// searchStream decodes a SEARCH or ESEARCH response for reader.readSearch. The
+// line is split into tokens at spaces, and only the tokens that are not passed
+// to dest are saved in line.
+type searchStream struct {
+	dest    func(start, stop uint32)
+	esearch bool
+	state   int    // searchPrefix, searchNums, or searchDone
+	line    []byte // Response text that was not streamed
+	tok     []byte // Current token or sequence set element
+	open    bool   // A token was started by a space
+	err     error
+}
+
+// searchStream states.
+const (
+	searchPrefix = iota // ESEARCH return data before ALL
+	searchNums          // SEARCH numbers or ESEARCH ALL sequence set
+	searchDone          // Remaining fields
+)
+
+// newSearchStream returns a new searchStream if part begins with a SEARCH or
+// ESEARCH response label, or nil otherwise.
+func newSearchStream(part []byte, dest func(start, stop uint32)) *searchStream {
+	for _, label := range []string{"* SEARCH", "* ESEARCH"} {
+		if n := len(label); len(part) > n && string(part[:n]) == label &&
+			(part[n] == ' ' || part[n] == '\r') {
+			s := &searchStream{dest: dest, esearch: label[2] == 'E'}
+			if s.line = []byte(label); !s.esearch {
+				s.state = searchNums
+			}
+			return s
+		}
+	}
+	return nil
+}
+
+// write processes the next part of the response text.
+func (s *searchStream) write(p []byte) {
+	for _, c := range p {
+		if s.err != nil {
+			return
+		}
+		switch {
+		case c == ' ':
+			if s.open {
+				s.token()
+			}
+			s.open, s.tok = true, s.tok[:0]
+		case c == ',' && s.state == searchNums && s.esearch:
+			s.element()
+			s.tok = s.tok[:0]
+		case !s.open:
+			s.line = append(s.line, c)
+		default:
+			s.tok = append(s.tok, c)
+		}
+		if len(s.line)+len(s.tok) > bufferSize(ReadBufferSize) {
+			s.err = &ProtocolError{"line too long", s.line}
+		}
+	}
+}
+
+// end processes the last token at the end of the line.
+func (s *searchStream) end() {
+	if s.open && s.err == nil {
+		s.token()
+	}
+	if s.state == searchNums && s.esearch && s.err == nil {
+		s.err = &ProtocolError{"missing ESEARCH ALL set", s.line}
+	}
+}
+
+// token processes a complete token.
+func (s *searchStream) token() {
+	switch s.state {
+	case searchPrefix:
+		if bytes.EqualFold(s.tok, []byte("ALL")) {
+			s.state = searchNums
+			return
+		}
+	case searchNums:
+		if s.esearch {
+			s.element()
+			s.state = searchDone
+			return
+		} else if n, ok := parseNumber(s.tok); ok {
+			s.dest(n, n)
+			return
+		}
+		s.state = searchDone
+	}
+	s.line = append(append(s.line, ' '), s.tok...)
+}
+
+// element passes one element of the ESEARCH ALL sequence set to dest.
+func (s *searchStream) element() {
+	start, stop := s.tok, s.tok
+	if i := bytes.IndexByte(s.tok, ':'); i >= 0 {
+		start, stop = s.tok[:i], s.tok[i+1:]
+	}
+	a, ok1 := parseNumber(start)
+	b, ok2 := parseNumber(stop)
+	if !ok1 || !ok2 || a == 0 || b == 0 {
+		s.err = &ProtocolError{"bad ESEARCH ALL set", append(s.line, s.tok...)}
+		return
+	} else if a > b {
+		a, b = b, a
+	}
+	s.dest(a, b)
+}
+
 // next returns the type of the next response field. The default type is Atom,
 // which includes atoms, numbers, and NILs.
 func (raw *rawResponse) next() FieldType {
@@ -415,6 +690,9 @@ func (raw *rawResponse) parseLiteralString() (f Field, err error) {
 	if err != nil {
 		err = raw.error("bad literal octet count", start)
 		return
+	} else if raw.maxLiteral > 0 && oc > uint64(raw.maxLiteral) {
+		err = raw.error("literal size limit exceeded", start)
+		return
 	}
 	info.Len = uint32(oc)
 	if f, err = raw.More(raw, info); err == nil {
@@ -491,23 +769,83 @@ func (raw *rawResponse) parseAtom(astring bool) (f Field, err error) {
 
 	// Take whatever was found, let parseFields report delimiter errors
 	atom := raw.tail[:n]
-	if norm := normalize(atom); flag {
-		f = norm
-	} else if norm != "NIL" {
-		if c := norm[0]; '0' <= c && c <= '9' {
-			if ui, err := strconv.ParseUint(norm, 10, 32); err == nil {
-				f = uint32(ui)
-			}
+	raw.tail = raw.tail[n:]
+	if v, ok := internedAtoms[string(atom)]; ok {
+		// Fast path: common atom in normalized form, no allocations
+		if v != nil && !flag && raw.Label == "" {
+			raw.Label = v.(string)
 		}
-		if f == nil {
-			if raw.Label == "" {
-				raw.Label = norm
-			}
-			f = string(atom)
+		return v, nil
+	} else if flag {
+		return normalize(atom), nil
+	} else if c := atom[0]; '0' <= c && c <= '9' {
+		if ui, ok := parseNumber(atom); ok {
+			return ui, nil
+		}
+	} else if len(atom) == 3 && bytes.EqualFold(atom, []byte("NIL")) {
+		return
+	}
+	if raw.Label == "" {
+		raw.Label = normalize(atom)
+	}
+	return string(atom), nil
+}
+
+// internedAtoms maps frequently received atoms to their normalized form (see
+// normalize), stored as Field values. parseAtom returns the shared value
+// instead of allocating a new string and interface when the received atom
+// matches a key exactly, which is the usual case for flags, data item names,
+// and response labels. Keys other than flags must already be normalized,
+// because their original form is returned. NIL maps to nil.
+var internedAtoms = make(map[string]Field)
+
+func init() {
+	for _, s := range []string{
+		// Flags and mailbox attributes, as usually sent by servers
+		`\Answered`, `\Flagged`, `\Deleted`, `\Seen`, `\Draft`, `\Recent`,
+		`\*`, `\Noinferiors`, `\NoInferiors`, `\Noselect`, `\NoSelect`,
+		`\Marked`, `\Unmarked`, `\HasChildren`, `\HasNoChildren`,
+		`\NonExistent`, `\Subscribed`, `\Remote`, `\All`, `\Archive`,
+		`\Drafts`, `\Junk`, `\Sent`, `\Trash`, `\Important`,
+
+		// Responses and response codes
+		"OK", "NO", "BAD", "BYE", "PREAUTH", "CAPABILITY", "LIST",
+		"LSUB", "STATUS", "SEARCH", "ESEARCH", "FLAGS", "EXISTS", "RECENT",
+		"EXPUNGE", "FETCH", "VANISHED", "ENABLED", "ALERT", "PERMANENTFLAGS",
+		"READ-ONLY", "READ-WRITE", "TRYCREATE", "UIDNEXT", "UIDVALIDITY",
+		"UNSEEN", "HIGHESTMODSEQ", "NOMODSEQ", "APPENDUID", "COPYUID",
+		"CLOSED", "MESSAGES", "UIDNOTSTICKY", "EARLIER", "ALL", "MIN", "MAX",
+		"COUNT",
+
+		// FETCH data items
+		"UID", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE", "BODY",
+		"BODYSTRUCTURE", "RFC822", "RFC822.HEADER", "RFC822.TEXT", "MODSEQ",
+		"BINARY.SIZE", "X-GM-MSGID", "X-GM-THRID", "X-GM-LABELS",
+		"EMAILID", "THREADID", "SAVEDATE", "PREVIEW",
+
+		// Body structure values
+		"TEXT", "PLAIN", "HTML", "MULTIPART", "MIXED", "ALTERNATIVE",
+		"RELATED", "APPLICATION", "IMAGE", "MESSAGE", "CHARSET", "NAME",
+		"BOUNDARY", "ATTACHMENT", "INLINE", "FILENAME",
+	} {
+		internedAtoms[s] = normalize([]byte(s))
+	}
+	internedAtoms["NIL"] = nil
+}
+
+// parseNumber converts a string of decimal digits to a uint32 without
+// allocating memory. The second return value is false if the atom contains
+// other characters or if the value does not fit in 32 bits.
+func parseNumber(atom []byte) (uint32, bool) {
+	var v uint64
+	for _, c := range atom {
+		if c < '0' || c > '9' {
+			return 0, false
+		} else if v = v*10 + uint64(c-'0'); v > 0xFFFFFFFF {
+			return 0, false
 		}
 	}
-	raw.tail = raw.tail[n:]
-	return
+	return uint32(v), len(atom) > 0
 }
 
 // normalize returns a normalized string copy of an atom. Non-flag atoms are
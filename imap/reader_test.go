@@ -5,7 +5,13 @@
 package imap
 
 import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -333,6 +339,11 @@ func TestReaderParse(t *testing.T) {
 		{`* List () ((()) (x ())) ((y) z)`,
 			&Response{Tag: "*", Type: Data, Label: "LIST", Fields: []Field{
 				"List", []Field(nil), []Field{[]Field{[]Field(nil)}, []Field{"x", []Field(nil)}}, []Field{[]Field{"y"}, "z"}}}},
+		{`* FETCH \HasChildren \SEEN \Seen fetch Fetch 007`,
+			&Response{Tag: "*", Type: Data, Label: "FETCH", Fields: []Field{
+				"FETCH", `\Haschildren`, `\Seen`, `\Seen`, "fetch", "Fetch", uint32(7)}}},
+		{`* fetch FETCH`,
+			&Response{Tag: "*", Type: Data, Label: "FETCH", Fields: []Field{"fetch", "FETCH"}}},
 		{`* NIL_ NIL nil Nil (NIL) "NIL"`,
 			&Response{Tag: "*", Type: Data, Label: "NIL_", Fields: []Field{
 				"NIL_", nil, nil, nil, []Field{nil}, `"NIL"`}}},
@@ -511,6 +522,10 @@ func TestReaderParse(t *testing.T) {
 		{`* 12 FETCH (BODY[HEADER] {342}` + CRLF + header + `)`,
 			&Response{Tag: "*", Type: Data, Label: "FETCH", Fields: []Field{uint32(12), "FETCH", []Field{"BODY[HEADER]", lit(header)}}}},
 
+		// RFC 3516 BINARY fetch with literal8
+		{`* 12 FETCH (BINARY[1] ~{4}` + CRLF + "\x00\x01\r\n BINARY.SIZE[1] 4)",
+			&Response{Tag: "*", Type: Data, Label: "FETCH", Fields: []Field{uint32(12), "FETCH", []Field{"BINARY[1]", lit8("\x00\x01\r\n"), "BINARY.SIZE[1]", uint32(4)}}}},
+
 		// Literals in BODY[...] are handled, but are not included in Fields
 		{`* 12 FETCH (BODY[HEADER.FIELDS.NOT ({4}` + CRLF + `Date)]<0> NIL)`,
 			&Response{Tag: "*", Type: Data, Label: "FETCH", Fields: []Field{uint32(12), "FETCH", []Field{"BODY[HEADER.FIELDS.NOT ({4})]<0>", nil}}}},
@@ -557,3 +572,285 @@ func TestReaderParse(t *testing.T) {
 		}
 	}
 }
+
+func TestReaderLimits(t *testing.T) {
+	nest := func(n int) string {
+		return "* X " + strings.Repeat("(", n) + strings.Repeat(")", n)
+	}
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{nest(MaxListDepth), true},
+		{nest(MaxListDepth + 1), false},
+		{nest(500), false},
+		{"* X {2000000000}", false},
+		{"* X ~{4294967295}", false},
+	}
+	c, s := newTestConn(1024)
+	C := newTransport(c, nil)
+	r := newReader(C, MemoryReader{}, "A")
+	r.maxLiteral = 1 << 30
+
+	for _, test := range tests {
+		C.clear()
+		s.Write([]byte(test.in + CRLF))
+
+		raw, err := r.Next()
+		if raw == nil || err != nil {
+			t.Errorf("Next(%.20q) unexpected error; %v", test.in, err)
+			continue
+		}
+		if _, err = raw.Parse(); test.ok && err != nil {
+			t.Errorf("Parse(%.20q) unexpected error; %v", test.in, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("Parse(%.20q) expected error", test.in)
+		} else if _, ok := err.(*ParserError); !test.ok && !ok {
+			t.Errorf("Parse(%.20q) expected ParserError; got %v", test.in, err)
+		}
+	}
+
+	// Per-client limit
+	r.maxDepth = 2
+	C.clear()
+	s.Write([]byte(nest(3) + CRLF))
+	if raw, err := r.Next(); err != nil {
+		t.Errorf("Next() unexpected error; %v", err)
+	} else if _, err = raw.Parse(); err == nil {
+		t.Errorf("Parse() expected error for maxDepth = 2")
+	}
+
+	f := Field([]Field{`"TEXT"`, `"PLAIN"`, nil, nil, nil, `"7BIT"`, uint32(1), uint32(1)})
+	for i := 0; i < MaxListDepth; i++ {
+		f = []Field{f, `"MIXED"`}
+	}
+	if p := AsBodyStructure(f); p != nil {
+		t.Errorf("AsBodyStructure() expected nil for deeply nested parts")
+	}
+}
+
+func TestStreamReader(t *testing.T) {
+	var prefixes []string
+	var bufs []*bytes.Buffer
+	sr := &StreamReader{Dest: func(prefix []byte, i LiteralInfo) io.Writer {
+		prefixes = append(prefixes, string(prefix))
+		if !bytes.HasSuffix(prefix, []byte("BODY[] ")) {
+			return nil
+		}
+		b := new(bytes.Buffer)
+		bufs = append(bufs, b)
+		return b
+	}}
+	c, s := newTestConn(1024)
+	C := newTransport(c, nil)
+	r := newReader(C, sr, "A")
+
+	s.Write([]byte("* 1 FETCH (BODY[HEADER] {4}" + CRLF + "a\r\nb BODY[] {11}" + CRLF + "hello world)" + CRLF))
+	raw, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next() unexpected error; %v", err)
+	}
+	rsp, err := raw.Parse()
+	if err != nil {
+		t.Fatalf("Parse() unexpected error; %v", err)
+	}
+	want := []string{"* 1 FETCH (BODY[HEADER] ", "* 1 FETCH (BODY[HEADER] {4} BODY[] "}
+	if !reflect.DeepEqual(prefixes, want) {
+		t.Errorf("Dest() prefixes expected %q; got %q", want, prefixes)
+	}
+	if len(bufs) != 1 || bufs[0].String() != "hello world" {
+		t.Fatalf("expected streamed body \"hello world\"; got %v", bufs)
+	}
+	kv := AsFieldMap(rsp.Fields[2])
+	if s := AsString(kv["BODY[HEADER]"]); s != "a\r\nb" {
+		t.Errorf("BODY[HEADER] expected \"a\\r\\nb\"; got %+q", s)
+	}
+	sl, ok := kv["BODY[]"].(*StreamedLiteral)
+	if !ok || sl.Info().Len != 11 || sl.Err != nil {
+		t.Errorf("BODY[] expected *StreamedLiteral; got %#v", kv["BODY[]"])
+	} else if _, err := sl.WriteTo(ioutil.Discard); err != ErrStreamed {
+		t.Errorf("WriteTo() expected ErrStreamed; got %v", err)
+	}
+}
+
+// chunkWriter records the length of each write.
+type chunkWriter []int
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	*w = append(*w, len(p))
+	return len(p), nil
+}
+
+func TestStreamReaderChunks(t *testing.T) {
+	defer func(n int) { LiteralChunkSize = n }(LiteralChunkSize)
+	LiteralChunkSize = 4
+
+	var w chunkWriter
+	sr := &StreamReader{Dest: func(prefix []byte, i LiteralInfo) io.Writer { return &w }}
+	c, s := newTestConn(1024)
+	r := newReader(newTransport(c, nil), sr, "A")
+
+	s.Write([]byte("* 1 FETCH (BODY[] {11}" + CRLF + "hello world)" + CRLF))
+	raw, err := r.Next()
+	if err == nil {
+		_, err = raw.Parse()
+	}
+	if err != nil {
+		t.Fatalf("Next() unexpected error; %v", err)
+	}
+	if want := (chunkWriter{4, 4, 3}); !reflect.DeepEqual(w, want) {
+		t.Errorf("Dest() writes expected %v; got %v", want, w)
+	}
+}
+
+func TestReaderAtomAllocs(t *testing.T) {
+	line := []byte(`* 12 FETCH (UID 42 FLAGS (\Seen \Flagged) RFC822.SIZE 1024)`)
+	r := &reader{maxDepth: MaxListDepth}
+	allocs := testing.AllocsPerRun(100, func() {
+		raw := &rawResponse{Response: &Response{}, reader: r, line: line, tail: line[2:]}
+		raw.parseFields(nul)
+	})
+	// Field slices and their interface values, and one boxed number
+	if allocs > 8 {
+		t.Errorf("parseFields() expected at most 8 allocations; got %v", allocs)
+	}
+}
+
+func TestReaderParseSearch(t *testing.T) {
+	tests := []struct {
+		in     string
+		nums   []uint32
+		fields []Field
+	}{
+		{`* SEARCH`, nil, []Field{"SEARCH"}},
+		{`* SEARCH 2 84 882`, []uint32{2, 84, 882}, []Field{"SEARCH"}},
+		{`* SEARCH 2 84 882 `, []uint32{2, 84, 882}, []Field{"SEARCH"}},
+		{`* SEARCH 2 5 (MODSEQ 917162500)`, []uint32{2, 5}, []Field{"SEARCH", []Field{"MODSEQ", uint32(917162500)}}},
+		{`* SEARCH 4294967296 1`, nil, []Field{"SEARCH", "4294967296", uint32(1)}},
+		{`* SEARCHRES 1`, nil, []Field{"SEARCHRES", uint32(1)}},
+	}
+	c, s := newTestConn(1024)
+	C := newTransport(c, nil)
+	r := newReader(C, MemoryReader{}, "A")
+	r.compactSearch = true
+
+	for _, test := range tests {
+		C.clear()
+		s.Write([]byte(test.in + CRLF))
+		raw, err := r.Next()
+		if err != nil {
+			t.Errorf("Next(%+q) unexpected error; %v", test.in, err)
+			continue
+		}
+		rsp, err := raw.Parse()
+		if err != nil {
+			t.Errorf("Parse(%+q) unexpected error; %v", test.in, err)
+		} else if !reflect.DeepEqual(rsp.Fields, test.fields) {
+			t.Errorf("Parse(%+q) expected fields %#v; got %#v", test.in, test.fields, rsp.Fields)
+		} else if nums, _ := rsp.Decoded.([]uint32); !reflect.DeepEqual(nums, test.nums) {
+			t.Errorf("Parse(%+q) expected numbers %v; got %v", test.in, test.nums, nums)
+		}
+	}
+
+	// Large results allocate only the number slice
+	line := []byte("* SEARCH" + strings.Repeat(" 4000000000", 10000))
+	allocs := testing.AllocsPerRun(10, func() {
+		raw := &rawResponse{Response: &Response{}, reader: r, line: line, tail: line[2:]}
+		raw.parseSearch()
+	})
+	if allocs > 40 {
+		t.Errorf("parseSearch() expected at most 40 allocations; got %v", allocs)
+	}
+}
+
+func TestReaderSearchStream(t *testing.T) {
+	var nums []byte
+	var want [][2]uint32
+	for i := uint32(3); i <= 600; i += 3 {
+		nums = strconv.AppendUint(append(nums, ' '), uint64(i), 10)
+		want = append(want, [2]uint32{i, i})
+	}
+	want = append(want, [2]uint32{2, 2}, [2]uint32{10, 11}, [2]uint32{3, 4})
+	in := "* 1 EXISTS\r\n" +
+		"* SEARCH" + string(nums) + " (MODSEQ 917162500)\r\n" +
+		`* ESEARCH (TAG "A1") UID ALL 2,10:11,4:3 COUNT 5` + "\r\n" +
+		"* SEARCH\r\n" +
+		"A1 OK done\r\n"
+	fields := [][]Field{
+		{uint32(1), "EXISTS"},
+		{"SEARCH", []Field{"MODSEQ", uint32(917162500)}},
+		{"ESEARCH", []Field{"TAG", `"A1"`}, "UID", "COUNT", uint32(5)},
+		{"SEARCH"},
+		{"OK"},
+	}
+
+	// Lines longer than the buffer are split at every possible position
+	for size := 16; size <= 40; size++ {
+		var got [][2]uint32
+		r := newReader(newStringTransport(in, size), MemoryReader{}, "A")
+		r.searchDest = func(start, stop uint32) { got = append(got, [2]uint32{start, stop}) }
+		for i, want := range fields {
+			raw, err := r.Next()
+			if err != nil {
+				t.Fatalf("Next(%d) unexpected error; %v", size, err)
+			}
+			rsp, err := raw.Parse()
+			if err != nil {
+				t.Fatalf("Parse(%d) unexpected error; %v", size, err)
+			} else if rsp.Tag == "*" && !reflect.DeepEqual(rsp.Fields, want) {
+				t.Errorf("Parse(%d) response %d expected %#v; got %#v", size, i, want, rsp.Fields)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("searchDest(%d) expected %v; got %v", size, want, got)
+		}
+	}
+
+	for _, in := range []string{
+		"* SEARCH 1 2\n",
+		"* SEARCH 1 2\r",
+		"* ESEARCH ALL 1:x\r\n",
+		"* ESEARCH ALL 0\r\n",
+		"* ESEARCH UID ALL\r\n",
+	} {
+		r := newReader(newStringTransport(in, 16), MemoryReader{}, "A")
+		r.searchDest = func(start, stop uint32) {}
+		if _, err := r.Next(); err == nil {
+			t.Errorf("Next(%+q) expected an error", in)
+		}
+	}
+}
+
+// newStringTransport returns a transport that reads in with a receive buffer
+// of the specified size.
+func newStringTransport(in string, size int) *transport {
+	lnk := &ioLink{Reader: strings.NewReader(in)}
+	return &transport{
+		buf:     bufio.NewReadWriter(bufio.NewReaderSize(lnk, size), nil),
+		bufLink: lnk,
+	}
+}
+
+func TestReadResponses(t *testing.T) {
+	in := "* 2 EXISTS\r\n* LIST\r\n* 1 FETCH (BODY[] {3}\r\nabc)\r\nA1 OK done\r\n"
+	var labels []string
+	err := ReadResponses(strings.NewReader(in), "", nil, func(rsp *Response) error {
+		labels = append(labels, rsp.Label)
+		if rsp.MailboxInfo() != nil {
+			t.Errorf("MailboxInfo() expected nil for %q", rsp.Raw)
+		}
+		return nil
+	})
+	if want := []string{"EXISTS", "LIST", "FETCH", ""}; err != nil || !reflect.DeepEqual(labels, want) {
+		t.Errorf("ReadResponses() expected %q, <nil>; got %q, %v", want, labels, err)
+	}
+	for _, in := range []string{"* 1 EXISTS", "* 1 FETCH (BODY[] {3}\r\nab"} {
+		err := ReadResponses(strings.NewReader(in), "A", nil, func(*Response) error { return nil })
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("ReadResponses(%q) expected io.ErrUnexpectedEOF; got %v", in, err)
+		}
+	}
+	if err = ReadResponses(strings.NewReader("B1 OK done\r\n"), "A", nil, nil); err == nil {
+		t.Errorf("ReadResponses() expected an error for a bad tag")
+	}
+}
@@ -6,6 +6,8 @@ package imap
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -91,6 +93,10 @@ type Response struct {
 	// this field except when writing a custom decoder (see response.go for
 	// examples).
 	Decoded interface{}
+
+	// UTF8=ACCEPT was enabled when the response was received, so mailbox names
+	// are not decoded from modified UTF-7 (see mailboxName).
+	utf8 bool
 }
 
 // String returns the raw text from which this Response object was constructed.
@@ -130,27 +136,85 @@ func (rsp *Response) Challenge() []byte {
 // MailboxInfo represents the mailbox attributes returned in a LIST or LSUB
 // response.
 type MailboxInfo struct {
-	Attrs FlagSet // Mailbox attributes (e.g. `\Noinferiors`, `\Noselect`)
-	Delim string  // Hierarchy delimiter (empty string == NIL, i.e. flat name)
-	Name  string  // Mailbox name decoded to UTF-8
+	Attrs FlagSet     // Mailbox attributes (e.g. `\Noinferiors`, `\Noselect`)
+	Attr  MailboxAttr // Known attributes from Attrs
+	Delim string      // Hierarchy delimiter (empty string == NIL, i.e. flat name)
+	Name  string      // Mailbox name decoded to UTF-8
 }
 
-// MailboxInfo returns the mailbox attributes extracted from a LIST or LSUB
-// response.
+// mailboxName returns the value of a mailbox name field in rsp. Once UTF8=ACCEPT
+// is enabled, the server sends names as UTF-8 (RFC 6855), so only the special
+// name "INBOX" is converted. Otherwise, the name is decoded with AsMailbox.
+func (rsp *Response) mailboxName(f Field) string {
+	if !rsp.utf8 {
+		return AsMailbox(f)
+	}
+	v := AsString(f)
+	if len(v) == 5 && toUpper(v) == "INBOX" {
+		return "INBOX"
+	}
+	return v
+}
+
+// MailboxInfo returns the mailbox attributes extracted from a LIST, LSUB, or
+// XLIST response.
 func (rsp *Response) MailboxInfo() *MailboxInfo {
 	v, ok := rsp.Decoded.(*MailboxInfo)
 	if !ok && rsp.Decoded == nil &&
-		(rsp.Label == "LIST" || rsp.Label == "LSUB") {
+		(rsp.Label == "LIST" || rsp.Label == "LSUB" || rsp.Label == "XLIST") &&
+		len(rsp.Fields) >= 4 {
 		v = &MailboxInfo{
 			Attrs: AsFlagSet(rsp.Fields[1]),
 			Delim: AsString(rsp.Fields[2]),
-			Name:  AsMailbox(rsp.Fields[3]),
+			Name:  rsp.mailboxName(rsp.Fields[3]),
 		}
+		v.Attr = MailboxAttrs(v.Attrs)
 		rsp.Decoded = v
 	}
 	return v
 }
 
+// mailboxAttrFlags maps mailbox attribute flags, as normalized by the response
+// parser, to MailboxAttr values. Attributes used by the XLIST command are
+// mapped to their special-use equivalents.
+var mailboxAttrFlags = map[Flag]MailboxAttr{
+	`\Noinferiors`:   AttrNoinferiors,
+	`\Noselect`:      AttrNoselect,
+	`\Marked`:        AttrMarked,
+	`\Unmarked`:      AttrUnmarked,
+	`\Nonexistent`:   AttrNonExistent,
+	`\Subscribed`:    AttrSubscribed,
+	`\Remote`:        AttrRemote,
+	`\Haschildren`:   AttrHasChildren,
+	`\Hasnochildren`: AttrHasNoChildren,
+	`\All`:           AttrAll,
+	`\Archive`:       AttrArchive,
+	`\Drafts`:        AttrDrafts,
+	`\Flagged`:       AttrFlagged,
+	`\Junk`:          AttrJunk,
+	`\Sent`:          AttrSent,
+	`\Trash`:         AttrTrash,
+	`\Important`:     AttrImportant,
+
+	// XLIST equivalents
+	`\Allmail`: AttrAll,
+	`\Spam`:    AttrJunk,
+	`\Starred`: AttrFlagged,
+}
+
+// MailboxAttrs returns the known mailbox attributes in fs. Attribute names are
+// matched without regard to case.
+func MailboxAttrs(fs FlagSet) (attr MailboxAttr) {
+	for f := range fs {
+		if a, ok := mailboxAttrFlags[f]; ok {
+			attr |= a
+		} else if len(f) > 1 && f[0] == '\\' {
+			attr |= mailboxAttrFlags[Flag(normalize([]byte(f)))]
+		}
+	}
+	return
+}
+
 // MailboxStatus represents the mailbox status information returned in a STATUS
 // response. It is also used by the Client to keep an updated view of the
 // currently selected mailbox. Fields that are only set by the Client are marked
@@ -166,6 +230,8 @@ type MailboxStatus struct {
 	UIDNext      uint32  // The next unique identifier value
 	UIDValidity  uint32  // The unique identifier validity value
 	UIDNotSticky bool    // UIDPLUS extension (client-only)
+
+	HighestModSeq uint64 // CONDSTORE mod-sequence (RFC 7162), 0 if not supported
 }
 
 // newMailboxStatus returns an initialized MailboxStatus instance.
@@ -180,6 +246,27 @@ func newMailboxStatus(name string) *MailboxStatus {
 	}
 }
 
+// Copy returns a deep copy of m, or nil if m is nil.
+func (m *MailboxStatus) Copy() *MailboxStatus {
+	if m == nil {
+		return nil
+	}
+	v := *m
+	if m.Flags != nil {
+		v.Flags = NewFlagSet()
+		for f, set := range m.Flags {
+			v.Flags[f] = set
+		}
+	}
+	if m.PermFlags != nil {
+		v.PermFlags = NewFlagSet()
+		for f, set := range m.PermFlags {
+			v.PermFlags[f] = set
+		}
+	}
+	return &v
+}
+
 func (m *MailboxStatus) String() string {
 	return fmt.Sprintf("--- %+q ---\n"+
 		"ReadOnly:     %v\n"+
@@ -199,8 +286,8 @@ func (m *MailboxStatus) String() string {
 // response.
 func (rsp *Response) MailboxStatus() *MailboxStatus {
 	v, ok := rsp.Decoded.(*MailboxStatus)
-	if !ok && rsp.Decoded == nil && rsp.Label == "STATUS" {
-		v = &MailboxStatus{Name: AsMailbox(rsp.Fields[1])}
+	if !ok && rsp.Decoded == nil && rsp.Label == "STATUS" && len(rsp.Fields) >= 3 {
+		v = &MailboxStatus{Name: rsp.mailboxName(rsp.Fields[1])}
 		f := AsList(rsp.Fields[2])
 		for i := 0; i < len(f)-1; i += 2 {
 			switch n := AsNumber(f[i+1]); toUpper(AsAtom(f[i])) {
@@ -214,6 +301,8 @@ func (rsp *Response) MailboxStatus() *MailboxStatus {
 				v.UIDValidity = n
 			case "UNSEEN":
 				v.Unseen = n
+			case "HIGHESTMODSEQ":
+				v.HighestModSeq = AsNumber64(f[i+1])
 			}
 		}
 		rsp.Decoded = v
@@ -221,6 +310,31 @@ func (rsp *Response) MailboxStatus() *MailboxStatus {
 	return v
 }
 
+// Vanished returns the UIDs reported in a VANISHED response (RFC 7162). The
+// earlier flag is set for VANISHED (EARLIER) responses, which are sent for UID
+// FETCH commands with the VANISHED modifier and report messages that were
+// expunged before the command was issued. Other VANISHED responses replace
+// EXPUNGE responses once QRESYNC is enabled. Nil is returned if the response
+// is not a valid VANISHED response.
+func (rsp *Response) Vanished() (uids *SeqSet, earlier bool) {
+	if rsp.Label != "VANISHED" || rsp.Type != Data || len(rsp.Fields) < 2 {
+		return nil, false
+	}
+	f := rsp.Fields[1:]
+	if tags, ok := f[0].([]Field); ok {
+		for _, tag := range tags {
+			earlier = earlier || toUpper(AsAtom(tag)) == "EARLIER"
+		}
+		if f = f[1:]; len(f) == 0 {
+			return nil, false
+		}
+	}
+	if uids = asSeqSet(f[0]); uids == nil || uids.Dynamic() {
+		return nil, false
+	}
+	return uids, earlier
+}
+
 // SearchResults returns a slice of message sequence numbers or UIDs extracted
 // from a SEARCH response.
 func (rsp *Response) SearchResults() []uint32 {
@@ -242,7 +356,7 @@ func (rsp *Response) SearchResults() []uint32 {
 func (rsp *Response) MailboxFlags() FlagSet {
 	v, ok := rsp.Decoded.(FlagSet)
 	if !ok && rsp.Decoded == nil &&
-		(rsp.Label == "FLAGS" || rsp.Label == "PERMANENTFLAGS") {
+		(rsp.Label == "FLAGS" || rsp.Label == "PERMANENTFLAGS") && len(rsp.Fields) >= 2 {
 		v = AsFlagSet(rsp.Fields[1])
 		rsp.Decoded = v
 	}
@@ -260,26 +374,89 @@ type MessageInfo struct {
 	Flags        FlagSet   // Flags that are set for this message (optional)
 	InternalDate time.Time // Internal to the server message timestamp (optional)
 	Size         uint32    // Message size in bytes (optional)
+
+	// Extension data items, which are only set if requested and supported by
+	// the server.
+	ModSeq        uint64            // MODSEQ mod-sequence value (RFC 7162)
+	Preview       string            // PREVIEW text (RFC 8970)
+	EmailID       string            // EMAILID (RFC 8474)
+	ThreadID      string            // THREADID (RFC 8474)
+	SaveDate      time.Time         // SAVEDATE (RFC 8514)
+	GmailMsgID    uint64            // X-GM-MSGID
+	GmailThreadID uint64            // X-GM-THRID
+	GmailLabels   []string          // X-GM-LABELS
+	BinarySize    map[string]uint32 // BINARY.SIZE[<part>] values keyed by part
+
+	parsed *parsedAttrs // Cached ENVELOPE and BODY[STRUCTURE] values
+}
+
+// parsedAttrs holds the values of the ENVELOPE, BODY, and BODYSTRUCTURE
+// attributes, which are only parsed when first requested by Envelope or
+// BodyStructure. Parsing these structures is relatively expensive, so clients
+// that fetch them but only look at a few messages (or only at the envelope) do
+// not pay for the rest. The values are shared by all callers.
+type parsedAttrs struct {
+	envOnce  sync.Once
+	env      *Envelope
+	bodyOnce sync.Once
+	body     MessagePart
+	extended bool
 }
 
 // MessageInfo returns the message attributes extracted from a FETCH response.
 func (rsp *Response) MessageInfo() *MessageInfo {
 	v, ok := rsp.Decoded.(*MessageInfo)
-	if !ok && rsp.Decoded == nil && rsp.Label == "FETCH" {
-		kv := AsFieldMap(rsp.Fields[2])
-		v = &MessageInfo{
-			Attrs:        kv,
-			Seq:          AsNumber(rsp.Fields[0]),
-			UID:          AsNumber(kv["UID"]),
-			Flags:        AsFlagSet(kv["FLAGS"]),
-			InternalDate: AsDateTime(kv["INTERNALDATE"]),
-			Size:         AsNumber(kv["RFC822.SIZE"]),
-		}
+	if !ok && rsp.Decoded == nil && rsp.Label == "FETCH" && len(rsp.Fields) >= 3 {
+		v = newMessageInfo(AsNumber(rsp.Fields[0]), AsFieldMap(rsp.Fields[2]))
 		rsp.Decoded = v
 	}
 	return v
 }
 
+// newMessageInfo extracts message attributes from kv.
+func newMessageInfo(seq uint32, kv FieldMap) *MessageInfo {
+	msg := &MessageInfo{
+		Attrs:        kv,
+		Seq:          seq,
+		UID:          AsNumber(kv["UID"]),
+		Flags:        AsFlagSet(kv["FLAGS"]),
+		InternalDate: AsDateTime(kv["INTERNALDATE"]),
+		Size:         AsNumber(kv["RFC822.SIZE"]),
+
+		Preview:       AsString(kv["PREVIEW"]),
+		SaveDate:      AsDateTime(kv["SAVEDATE"]),
+		GmailMsgID:    AsNumber64(kv["X-GM-MSGID"]),
+		GmailThreadID: AsNumber64(kv["X-GM-THRID"]),
+	}
+	if v := AsList(kv["MODSEQ"]); len(v) == 1 {
+		msg.ModSeq = AsNumber64(v[0])
+	}
+	if v := AsList(kv["EMAILID"]); len(v) == 1 {
+		msg.EmailID = AsString(v[0])
+	}
+	if v := AsList(kv["THREADID"]); len(v) == 1 {
+		msg.ThreadID = AsString(v[0])
+	}
+	if kv["ENVELOPE"] != nil || kv["BODY"] != nil || kv["BODYSTRUCTURE"] != nil {
+		msg.parsed = new(parsedAttrs)
+	}
+	if v, ok := kv["X-GM-LABELS"].([]Field); ok {
+		msg.GmailLabels = make([]string, len(v))
+		for i, f := range v {
+			msg.GmailLabels[i] = AsString(f)
+		}
+	}
+	for k, f := range kv {
+		if strings.HasPrefix(k, "BINARY.SIZE[") && strings.HasSuffix(k, "]") {
+			if msg.BinarySize == nil {
+				msg.BinarySize = make(map[string]uint32)
+			}
+			msg.BinarySize[k[12:len(k)-1]] = AsNumber(f)
+		}
+	}
+	return msg
+}
+
 // Quota represents a single resource limit on a mailbox quota root returned in
 // a QUOTA response, as described in RFC 2087.
 type Quota struct {
@@ -295,7 +472,7 @@ func (rsp *Response) Quota() (root string, quota []*Quota) {
 		quota []*Quota
 	}
 	v, ok := rsp.Decoded.(*vt)
-	if !ok && rsp.Decoded == nil && rsp.Label == "QUOTA" {
+	if !ok && rsp.Decoded == nil && rsp.Label == "QUOTA" && len(rsp.Fields) >= 3 {
 		list := AsList(rsp.Fields[2])
 		if len(list)%3 != 0 {
 			return
@@ -324,8 +501,8 @@ func (rsp *Response) QuotaRoot() (mbox string, roots []string) {
 		roots []string
 	}
 	v, ok := rsp.Decoded.(*vt)
-	if !ok && rsp.Decoded == nil && rsp.Label == "QUOTAROOT" {
-		mbox = AsMailbox(rsp.Fields[1])
+	if !ok && rsp.Decoded == nil && rsp.Label == "QUOTAROOT" && len(rsp.Fields) >= 2 {
+		mbox = rsp.mailboxName(rsp.Fields[1])
 		roots = make([]string, len(rsp.Fields[2:]))
 		for i, root := range rsp.Fields[2:] {
 			roots[i] = AsString(root)
@@ -74,23 +74,33 @@ func TestResponseDecoders(t *testing.T) {
 		{`* LIST (\Noselect) "." "#foo.bar"`,
 			"MailboxInfo", &MailboxInfo{
 				Attrs: NewFlagSet(`\Noselect`),
+				Attr:  AttrNoselect,
 				Delim: ".",
 				Name:  "#foo.bar"}},
 		{`* LIST (\Noselect) "/" #foo.bar/[blurdybloop]`,
 			"MailboxInfo", &MailboxInfo{
 				Attrs: NewFlagSet(`\Noselect`),
+				Attr:  AttrNoselect,
 				Delim: "/",
 				Name:  "#foo.bar/[blurdybloop]"}},
 		{`* LIST (\NoInferiors \NoSelect) NIL {6}` + CRLF + `foobar`,
 			"MailboxInfo", &MailboxInfo{
 				Attrs: NewFlagSet(`\Noselect`, `\Noinferiors`),
+				Attr:  AttrNoselect | AttrNoinferiors,
 				Delim: "",
 				Name:  "foobar"}},
 		{`* LSUB (\noselect \marked) "/" ~peter/mail/&U,BTFw-/&ZeVnLIqe-`,
 			"MailboxInfo", &MailboxInfo{
 				Attrs: NewFlagSet(`\Noselect`, `\Marked`),
+				Attr:  AttrNoselect | AttrMarked,
 				Delim: "/",
 				Name:  "~peter/mail/\u53F0\u5317/\u65E5\u672C\u8A9E"}},
+		{`* LIST (\HasNoChildren \Sent \X-Custom) "/" Sent`,
+			"MailboxInfo", &MailboxInfo{
+				Attrs: NewFlagSet(`\Hasnochildren`, `\Sent`, `\X-custom`),
+				Attr:  AttrHasNoChildren | AttrSent,
+				Delim: "/",
+				Name:  "Sent"}},
 
 		// STATUS -> MailboxStatus
 		{`* NOT STATUS`,
@@ -180,6 +190,23 @@ func TestResponseDecoders(t *testing.T) {
 				Flags:        NewFlagSet(),
 				InternalDate: time.Date(1996, time.July, 17, 2, 44, 25, 0, MST),
 				Size:         1024}},
+		{`* 5 FETCH (UID 9 MODSEQ (12345678901) EMAILID (M6d99ac3275bb4e) THREADID NIL PREVIEW "Hello" SAVEDATE "17-Jul-1996 02:44:25 -0700")`,
+			"MessageInfo", &MessageInfo{
+				Attrs:    FieldMap{"UID": uint32(9), "MODSEQ": []Field{"12345678901"}, "EMAILID": []Field{"M6d99ac3275bb4e"}, "THREADID": nil, "PREVIEW": `"Hello"`, "SAVEDATE": `"17-Jul-1996 02:44:25 -0700"`},
+				Seq:      5,
+				UID:      9,
+				ModSeq:   12345678901,
+				Preview:  "Hello",
+				EmailID:  "M6d99ac3275bb4e",
+				SaveDate: time.Date(1996, time.July, 17, 2, 44, 25, 0, MST)}},
+		{`* 6 FETCH (X-GM-MSGID 1278455344230334865 X-GM-THRID 42 X-GM-LABELS ("\\Inbox" "My Label") BINARY.SIZE[1.2] 512)`,
+			"MessageInfo", &MessageInfo{
+				Attrs:         FieldMap{"X-GM-MSGID": "1278455344230334865", "X-GM-THRID": uint32(42), "X-GM-LABELS": []Field{`"\\Inbox"`, `"My Label"`}, "BINARY.SIZE[1.2]": uint32(512)},
+				Seq:           6,
+				GmailMsgID:    1278455344230334865,
+				GmailThreadID: 42,
+				GmailLabels:   []string{`\Inbox`, "My Label"},
+				BinarySize:    map[string]uint32{"1.2": 512}}},
 
 		// QUOTA -> (string, []*Quota)
 		{`* NOT QUOTA`,
@@ -0,0 +1,296 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "sync"
+
+// ScanMailboxes lists the mailboxes matching ref and pattern and passes each one
+// to f along with its status as soon as the status is known, which avoids
+// waiting for the entire mailbox list of a large account before any results
+// can be displayed. The MESSAGES, RECENT, UIDNEXT, UIDVALIDITY, and UNSEEN
+// items are requested if no items are specified. Mailboxes that cannot be
+// selected (\Noselect or \NonExistent) are passed to f with a nil status.
+//
+// The first client sends the LIST command. If it supports LIST-STATUS (RFC
+// 5819), the status of all mailboxes is requested with the same command, and
+// only the mailboxes missing from the response are requested separately.
+// Otherwise, STATUS commands are issued while the LIST command is still in
+// progress. Each client uses its own goroutine and keeps up to window STATUS
+// commands (8 if window <= 0) in progress at the same time. New commands are
+// not issued while f is busy and window results per client are waiting to be
+// delivered, which limits memory use when f is slower than the server. The
+// clients must be authenticated connections to the same account, and must not
+// be used by other goroutines until ScanMailboxes returns.
+//
+// Mailboxes whose STATUS command fails (e.g. because they were deleted) are
+// passed to f with a nil status, and the first such error is returned after all
+// other mailboxes are scanned. If f, the LIST command, or a connection returns
+// an error, no new commands are issued and the error is returned after the
+// commands in progress are completed. f is called from the goroutine that
+// called ScanMailboxes.
+func ScanMailboxes(clients []*Client, ref, pattern string, window int, f func(info *MailboxInfo, status *MailboxStatus) error, items ...string) error {
+	if len(clients) == 0 {
+		return nil
+	} else if window <= 0 {
+		window = statusWindow
+	}
+	if len(items) == 0 {
+		items = statusItems
+	}
+	s := &mailboxScan{
+		items:   items,
+		window:  window,
+		listing: true,
+		results: make(chan scanResult, window*len(clients)),
+		stop:    make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(c *Client, list bool) {
+			defer wg.Done()
+			s.run(c, ref, pattern, list)
+		}(c, i == 0)
+	}
+	go func() {
+		wg.Wait()
+		close(s.results)
+	}()
+	for r := range s.results {
+		if err := f(r.info, r.status); err != nil {
+			s.fail(err)
+			for range s.results {
+			}
+		}
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return s.rerr
+}
+
+// ScanMailboxes scans the mailboxes matching ref and pattern using s.Client.
+// See the ScanMailboxes function.
+func (s *Session) ScanMailboxes(ref, pattern string, f func(info *MailboxInfo, status *MailboxStatus) error, items ...string) error {
+	return ScanMailboxes([]*Client{s.Client}, ref, pattern, 0, f, items...)
+}
+
+// scanResult is one mailbox waiting to be delivered by ScanMailboxes.
+type scanResult struct {
+	info   *MailboxInfo
+	status *MailboxStatus
+}
+
+// mailboxScan holds the state of ScanMailboxes. The mailboxes received by the
+// LIST command are added to queue, from which all clients take the mailboxes
+// for their STATUS commands.
+type mailboxScan struct {
+	items  []string
+	window int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []*MailboxInfo // Mailboxes waiting for a STATUS command
+	listing bool           // LIST command in progress
+	err     error          // First fatal error
+	rerr    error          // First STATUS command error
+
+	results chan scanResult
+	stop    chan struct{}
+	once    sync.Once
+
+	// LIST command state, used only by the goroutine of the first client
+	list    *Command
+	listed  int                     // Number of list.Data responses processed
+	pending map[string]*MailboxInfo // Mailboxes waiting for LIST-STATUS data
+}
+
+// fail saves the first fatal error and stops all goroutines.
+func (s *mailboxScan) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.once.Do(func() { close(s.stop) })
+	s.cond.Broadcast()
+}
+
+// next returns the next mailbox from the queue. If wait is true, it blocks until
+// a mailbox is available or the LIST command is completed. It returns nil if
+// there is nothing to do.
+func (s *mailboxScan) next(wait bool) *MailboxInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for wait && len(s.queue) == 0 && s.listing && s.err == nil {
+		s.cond.Wait()
+	}
+	if len(s.queue) == 0 || s.err != nil {
+		return nil
+	}
+	info := s.queue[0]
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+	return info
+}
+
+// push adds mailboxes to the queue and updates the LIST command status.
+func (s *mailboxScan) push(infos []*MailboxInfo, listing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, infos...)
+	s.listing = listing
+	s.cond.Broadcast()
+}
+
+// emit delivers the results to the goroutine that called ScanMailboxes. It
+// returns false if the scan was stopped.
+func (s *mailboxScan) emit(results []scanResult) bool {
+	for _, r := range results {
+		select {
+		case s.results <- r:
+		case <-s.stop:
+			return false
+		}
+	}
+	return true
+}
+
+// run scans mailboxes using c until there is nothing left to do or the scan is
+// stopped. If list is true, c also sends the LIST command.
+func (s *mailboxScan) run(c *Client, ref, pattern string, list bool) {
+	var cmds []*Command
+	var infos []*MailboxInfo
+	defer func() {
+		if s.list != nil && list {
+			s.list.Result(OK)
+		}
+		for _, cmd := range cmds {
+			cmd.Result(OK)
+		}
+	}()
+	if list {
+		if err := s.startList(c, ref, pattern); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		for len(cmds) < s.window {
+			info := s.next(!list && len(cmds) == 0)
+			if info == nil {
+				break
+			}
+			cmd, err := c.Status(info.Name, s.items...)
+			if err != nil {
+				s.fail(err)
+				return
+			}
+			cmds, infos = append(cmds, cmd), append(infos, info)
+		}
+		if !list && len(cmds) == 0 {
+			return
+		} else if err := c.Recv(block); err != nil {
+			s.fail(err)
+			return
+		}
+		var out []scanResult
+		if list {
+			out, list = s.updateList(c)
+		}
+		for len(cmds) > 0 && !cmds[0].InProgress() {
+			r := scanResult{info: infos[0]}
+			if _, err := cmds[0].Result(OK); err != nil {
+				if !isResponseError(err) {
+					s.fail(err)
+					return
+				}
+				s.mu.Lock()
+				if s.rerr == nil {
+					s.rerr = err
+				}
+				s.mu.Unlock()
+			} else {
+				for _, rsp := range cmds[0].Data {
+					if status := rsp.MailboxStatus(); status != nil {
+						r.status = status
+					}
+				}
+			}
+			out = append(out, r)
+			cmds[0], infos[0] = nil, nil
+			cmds, infos = cmds[1:], infos[1:]
+		}
+		if !s.emit(out) {
+			return
+		}
+	}
+}
+
+// startList sends the LIST command, requesting the status of all mailboxes if
+// the server supports LIST-STATUS.
+func (s *mailboxScan) startList(c *Client, ref, pattern string) (err error) {
+	if c.Caps["LIST-STATUS"] {
+		s.pending = make(map[string]*MailboxInfo)
+		ret := []Field{"STATUS", stringsToFields(s.items)}
+		s.list, err = c.Send("LIST", c.encodeMailbox(ref), c.encodeMailbox(pattern), "RETURN", ret)
+	} else {
+		s.list, err = c.List(ref, pattern)
+	}
+	return
+}
+
+// updateList processes the LIST responses received since the last call. It
+// returns the results that are ready for delivery and whether the command is
+// still in progress. Since the STATUS responses of LIST-STATUS are not accepted
+// by the LIST command filter, they are removed from c.Data.
+func (s *mailboxScan) updateList(c *Client) (out []scanResult, listing bool) {
+	var queue []*MailboxInfo
+	for ; s.listed < len(s.list.Data); s.listed++ {
+		info := s.list.Data[s.listed].MailboxInfo()
+		if info == nil {
+			continue
+		} else if info.Attr&(AttrNoselect|AttrNonExistent) != 0 {
+			out = append(out, scanResult{info: info})
+		} else if s.pending != nil {
+			s.pending[info.Name] = info
+		} else {
+			queue = append(queue, info)
+		}
+	}
+	if len(s.pending) > 0 {
+		data := c.Data[:0]
+		for _, rsp := range c.Data {
+			if status := rsp.MailboxStatus(); status != nil && s.pending[status.Name] != nil {
+				out = append(out, scanResult{s.pending[status.Name], status})
+				delete(s.pending, status.Name)
+				continue
+			}
+			data = append(data, rsp)
+		}
+		c.Data = data
+	}
+	if s.list.InProgress() {
+		s.push(queue, true)
+		return out, true
+	} else if _, err := s.list.Result(OK); err != nil {
+		s.fail(err)
+		return out, false
+	}
+	for _, rsp := range s.list.Data {
+		if info := rsp.MailboxInfo(); info != nil && s.pending[info.Name] == info {
+			queue = append(queue, info)
+		}
+	}
+	s.pending = nil
+	s.push(queue, false)
+	return out, false
+}
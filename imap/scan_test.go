@@ -0,0 +1,150 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanMailboxes(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	var got []string
+	f := func(info *MailboxInfo, status *MailboxStatus) error {
+		if status == nil {
+			got = append(got, info.Name)
+		} else {
+			got = append(got, fmt.Sprintf("%s=%d", info.Name, status.Messages))
+		}
+		return nil
+	}
+	go t.script(
+		`C: A1 LIST "" "*"`+CRLF,
+		`S: * LIST () "/" "INBOX"`+CRLF,
+		`C: A2 STATUS "INBOX" (MESSAGES)`+CRLF,
+		`S: * LIST (\Noselect) "/" "Archive"`+CRLF,
+		`S: * LIST () "/" "Archive/2013"`+CRLF,
+		`S: A1 OK LIST completed`+CRLF,
+		`C: A3 STATUS "Archive/2013" (MESSAGES)`+CRLF,
+		`S: * STATUS "INBOX" (MESSAGES 3)`+CRLF,
+		`S: A2 OK STATUS completed`+CRLF,
+		`S: * STATUS "Archive/2013" (MESSAGES 1)`+CRLF,
+		`S: A3 OK STATUS completed`+CRLF,
+	)
+	err := S.ScanMailboxes("", "*", f, "MESSAGES")
+	t.join("LIST", err)
+	if want := []string{"Archive", "INBOX=3", "Archive/2013=1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanMailboxes() expected %q; got %q", want, got)
+	}
+
+	C.Caps["LIST-STATUS"] = true
+	C.Data = nil
+	got = nil
+	go t.script(
+		`C: A4 LIST "" "*" RETURN (STATUS (MESSAGES))`+CRLF,
+		`S: * LIST () "/" "INBOX"`+CRLF,
+		`S: * STATUS "INBOX" (MESSAGES 11)`+CRLF,
+		`S: * LIST () "/" "Sent"`+CRLF,
+		`S: A4 OK LIST completed`+CRLF,
+		`C: A5 STATUS "Sent" (MESSAGES)`+CRLF,
+		`S: A5 NO Mailbox does not exist`+CRLF,
+	)
+	err = S.ScanMailboxes("", "*", f, "MESSAGES")
+	t.join("LIST", nil)
+	if _, ok := err.(ResponseError); !ok {
+		t.Errorf("ScanMailboxes(LIST-STATUS) expected ResponseError; got %v", err)
+	}
+	if want := []string{"INBOX=11", "Sent"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanMailboxes(LIST-STATUS) expected %q; got %q", want, got)
+	}
+	if len(C.Data) != 0 {
+		t.Errorf("ScanMailboxes(LIST-STATUS) left %d unilateral responses", len(C.Data))
+	}
+}
+
+// newScanServer returns a client connected to a server with n mailboxes. The
+// responses to each command are sent after a delay of rtt to simulate network
+// latency.
+func newScanServer(b *testing.B, n int, caps string, rtt time.Duration) *Client {
+	c, s := net.Pipe()
+	type request struct {
+		line string
+		t    time.Time
+	}
+	reqs := make(chan request, 1024)
+	go func() {
+		defer close(reqs)
+		r := bufio.NewReader(s)
+		for {
+			ln, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			reqs <- request{ln, time.Now()}
+		}
+	}()
+	go func() {
+		w := bufio.NewWriter(s)
+		fmt.Fprintf(w, "* PREAUTH [CAPABILITY %s] Test server ready\r\n", caps)
+		w.Flush()
+		for req := range reqs {
+			time.Sleep(req.t.Add(rtt).Sub(time.Now()))
+			f := strings.Fields(req.line)
+			switch f[1] {
+			case "LIST":
+				status := strings.Contains(req.line, "RETURN")
+				for i := 0; i < n; i++ {
+					fmt.Fprintf(w, "* LIST () \"/\" \"Folder%d\"\r\n", i)
+					if status {
+						fmt.Fprintf(w, "* STATUS \"Folder%d\" (MESSAGES %d)\r\n", i, i)
+					}
+				}
+			case "STATUS":
+				fmt.Fprintf(w, "* STATUS %s (MESSAGES 1)\r\n", f[2])
+			}
+			fmt.Fprintf(w, "%s OK Completed\r\n", f[0])
+			w.Flush()
+		}
+	}()
+	C, err := NewClient(c, "localhost", time.Second)
+	if err != nil {
+		b.Fatalf("NewClient() unexpected error; %v", err)
+	}
+	return C
+}
+
+func benchmarkScanMailboxes(b *testing.B, clients, window int, caps string) {
+	const folders = 2000
+	cs := make([]*Client, clients)
+	for i := range cs {
+		cs[i] = newScanServer(b, folders, caps, 100*time.Microsecond)
+		defer cs[i].t.Close(false)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		err := ScanMailboxes(cs, "", "*", window, func(*MailboxInfo, *MailboxStatus) error {
+			n++
+			return nil
+		}, "MESSAGES")
+		if err != nil || n != folders {
+			b.Fatalf("ScanMailboxes() unexpected result %d, %v", n, err)
+		}
+	}
+}
+
+func BenchmarkScanMailboxesSerial(b *testing.B)    { benchmarkScanMailboxes(b, 1, 1, "IMAP4rev1") }
+func BenchmarkScanMailboxesPipelined(b *testing.B) { benchmarkScanMailboxes(b, 1, 8, "IMAP4rev1") }
+func BenchmarkScanMailboxesClients4(b *testing.B)  { benchmarkScanMailboxes(b, 4, 8, "IMAP4rev1") }
+func BenchmarkScanMailboxesListStatus(b *testing.B) {
+	benchmarkScanMailboxes(b, 1, 8, "IMAP4rev1 LIST-STATUS")
+}
@@ -0,0 +1,473 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+// ErrSearchInProgress is returned by SearchTo and UIDSearchTo if another SEARCH
+// command is in progress, because its results could not be told apart.
+var ErrSearchInProgress = errors.New("imap: another SEARCH command is in progress")
+
+// SearchCharsetInfo describes the charset negotiation performed by
+// Client.SearchCharset.
+type SearchCharsetInfo struct {
+	Charset   string   // Charset of the final command ("" if not specified)
+	Rejected  []string // Charsets rejected by the server, in the order tried
+	Supported []string // Charsets advertised in the BADCHARSET response code
+	Unapplied []Field  // Criteria omitted from the final command
+}
+
+// searchTextKeys identifies search keys that take a single string argument,
+// which is interpreted using the command charset.
+var searchTextKeys = map[string]bool{
+	"BCC": true, "BODY": true, "CC": true, "FROM": true,
+	"SUBJECT": true, "TEXT": true, "TO": true,
+}
+
+// searchDateKeys identifies search keys that take a date argument.
+var searchDateKeys = map[string]bool{
+	"BEFORE": true, "ON": true, "SINCE": true,
+	"SENTBEFORE": true, "SENTON": true, "SENTSINCE": true,
+}
+
+// searchKeyArgs is the number of arguments of search keys other than OR and
+// NOT. Keys that are not listed, including sequence sets and parenthesized
+// lists, have no arguments.
+var searchKeyArgs = map[string]int{
+	"BCC": 1, "BEFORE": 1, "BODY": 1, "CC": 1, "FROM": 1, "HEADER": 2,
+	"KEYWORD": 1, "LARGER": 1, "ON": 1, "SENTBEFORE": 1, "SENTON": 1,
+	"SENTSINCE": 1, "SINCE": 1, "SMALLER": 1, "SUBJECT": 1, "TEXT": 1,
+	"TO": 1, "UID": 1, "UNKEYWORD": 1, "OLDER": 1, "YOUNGER": 1,
+	"X-GM-RAW": 1, "X-GM-MSGID": 1, "X-GM-THRID": 1, "X-GM-LABELS": 1,
+}
+
+// searchKeyLen returns the number of fields in the first search key of spec,
+// including the operands of OR and NOT. The result is limited to len(spec).
+func searchKeyLen(spec []Field) int {
+	if len(spec) == 0 {
+		return 0
+	}
+	n := 1
+	switch key := toUpper(AsAtom(spec[0])); key {
+	case "NOT":
+		n += searchKeyLen(spec[1:])
+	case "OR":
+		n += searchKeyLen(spec[1:])
+		n += searchKeyLen(spec[n:])
+	default:
+		n += searchKeyArgs[key]
+	}
+	if n > len(spec) {
+		n = len(spec)
+	}
+	return n
+}
+
+// SearchTo is a synchronous version of Search that passes the matching message
+// numbers to f as the response line is read, instead of saving them in the
+// SEARCH responses of the command, so results containing millions of messages
+// are never held in memory at once. Each SEARCH number is passed as a range of
+// one message. If the criteria request ESEARCH results (RFC 4731), such as
+// "RETURN (ALL)", the ranges of the ALL sequence set are passed instead, and the
+// other return data (e.g. COUNT) remain in the response. The responses are not
+// limited by the receive buffer size. f is called by the goroutine that
+// receives the responses.
+//
+// All SEARCH and ESEARCH responses received during the command are passed to f,
+// so ErrSearchInProgress is returned if another SEARCH command is in progress,
+// and no other SEARCH commands may be issued until SearchTo returns. If a
+// time-limited receive (see Client.Recv) is still pending, a NOOP command is
+// completed first, so that the SEARCH response is not read by that receive.
+func (c *Client) SearchTo(f func(start, stop uint32), spec ...Field) (cmd *Command, err error) {
+	return c.searchTo(c.Search, f, spec)
+}
+
+// UIDSearchTo is identical to SearchTo, but the numbers passed to f are unique
+// identifiers instead of message sequence numbers.
+func (c *Client) UIDSearchTo(f func(start, stop uint32), spec ...Field) (cmd *Command, err error) {
+	return c.searchTo(c.UIDSearch, f, spec)
+}
+
+// searchTo implements SearchTo and UIDSearchTo.
+func (c *Client) searchTo(search func(...Field) (*Command, error), f func(start, stop uint32), spec []Field) (*Command, error) {
+	for _, cmd := range c.cmds {
+		if cmd.name == "SEARCH" {
+			return nil, ErrSearchInProgress
+		}
+	}
+	if c.rpending {
+		// The receiver copied the previous destination before it started
+		// waiting for the next response.
+		if _, err := Wait(c.Noop()); err != nil {
+			return nil, err
+		}
+	}
+	prev := c.searchDest
+	c.searchDest = f
+	defer func() { c.searchDest = prev }()
+	return Wait(search(spec...))
+}
+
+// SearchCharset is a synchronous version of Search that negotiates the charset
+// of non-ASCII search strings with the server. No charset is specified if all
+// criteria are ASCII. Otherwise, UTF-8 is tried first. If the server rejects it
+// with a BADCHARSET response code, the criteria are transcoded to each of the
+// advertised charsets (see Client.CharsetEncoder) until the server accepts one
+// of them. If none of the charsets can be used, the top-level text criteria
+// that contain non-ASCII strings (e.g. SUBJECT "...") are removed from the
+// command and returned in info.Unapplied. The caller must then apply these
+// criteria to the returned messages itself. An error is returned if the
+// criteria cannot be separated in this manner (e.g. when they are operands of
+// OR or NOT).
+//
+// The returned info describes the negotiation, even if an error is returned.
+func (c *Client) SearchCharset(spec ...Field) (cmd *Command, info *SearchCharsetInfo, err error) {
+	return c.searchCharset("SEARCH", spec)
+}
+
+// UIDSearchCharset is identical to SearchCharset, but the numbers returned in
+// the response are unique identifiers instead of message sequence numbers.
+func (c *Client) UIDSearchCharset(spec ...Field) (cmd *Command, info *SearchCharsetInfo, err error) {
+	return c.searchCharset("UID SEARCH", spec)
+}
+
+// searchCharset implements SearchCharset and UIDSearchCharset.
+func (c *Client) searchCharset(name string, spec []Field) (cmd *Command, info *SearchCharsetInfo, err error) {
+	info = new(SearchCharsetInfo)
+	if spec = searchDates(spec); !hasNonASCII(spec) {
+		cmd, err = Wait(c.Send(name, spec...))
+		return
+	}
+	info.Charset = "UTF-8"
+	enc := spec
+	for {
+		if cmd, err = c.Send(name, append([]Field{"CHARSET", info.Charset}, enc...)...); err != nil {
+			return
+		}
+		var rsp *Response
+		if rsp, err = cmd.Result(OK | NO); err != nil || rsp.Status == OK {
+			return
+		} else if rsp.Label != "BADCHARSET" {
+			_, err = cmd.Result(OK)
+			return
+		}
+		info.Rejected = append(info.Rejected, info.Charset)
+		if len(rsp.Fields) > 1 {
+			info.Supported = info.Supported[:0]
+			for _, f := range AsList(rsp.Fields[1]) {
+				info.Supported = append(info.Supported, AsString(f))
+			}
+		}
+		if info.Charset, enc = c.nextSearchCharset(info, spec); info.Charset == "" {
+			break
+		}
+	}
+	rest, unapplied := splitNonASCII(spec)
+	if unapplied == nil {
+		_, err = cmd.Result(OK)
+		return
+	} else if len(rest) == 0 {
+		rest = []Field{"ALL"}
+	}
+	info.Unapplied = unapplied
+	cmd, err = Wait(c.Send(name, rest...))
+	return
+}
+
+// nextSearchCharset returns the first supported charset that has not been
+// rejected and to which spec can be transcoded.
+func (c *Client) nextSearchCharset(info *SearchCharsetInfo, spec []Field) (string, []Field) {
+next:
+	for _, cs := range info.Supported {
+		for _, r := range info.Rejected {
+			if toUpper(r) == toUpper(cs) {
+				continue next
+			}
+		}
+		if enc, err := c.transcodeFields(cs, spec); err == nil {
+			return cs, enc
+		}
+	}
+	return "", nil
+}
+
+// transcodeFields returns a copy of spec with all non-ASCII strings converted
+// from UTF-8 to the specified charset.
+func (c *Client) transcodeFields(charset string, spec []Field) ([]Field, error) {
+	out := make([]Field, len(spec))
+	for i, f := range spec {
+		if list, ok := f.([]Field); ok {
+			var err error
+			if out[i], err = c.transcodeFields(charset, list); err != nil {
+				return nil, err
+			}
+		} else if hasNonASCII([]Field{f}) {
+			b := AsBytes(f)
+			if b == nil {
+				b = []byte(AsString(f))
+			}
+			b, err := c.encodeCharset(charset, b)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = encodeString(b, false)
+		} else {
+			out[i] = f
+		}
+	}
+	return out, nil
+}
+
+// splitNonASCII separates the top-level text criteria that contain non-ASCII
+// strings from the rest of spec. Nil is returned for unapplied if there are no
+// such criteria or if non-ASCII strings appear in any other context.
+func splitNonASCII(spec []Field) (rest, unapplied []Field) {
+	for i := 0; i < len(spec); i++ {
+		switch key := toUpper(AsAtom(spec[i])); {
+		case key == "OR" || key == "NOT":
+			n := searchKeyLen(spec[i:])
+			if hasNonASCII(spec[i : i+n]) {
+				return nil, nil
+			}
+			rest = append(rest, spec[i:i+n]...)
+			i += n - 1
+		case searchTextKeys[key] && i+1 < len(spec) && hasNonASCII(spec[i+1:i+2]):
+			unapplied = append(unapplied, spec[i:i+2]...)
+			i++
+		case key == "HEADER" && i+2 < len(spec) && hasNonASCII(spec[i+1:i+3]):
+			unapplied = append(unapplied, spec[i:i+3]...)
+			i += 2
+		case hasNonASCII(spec[i : i+1]):
+			return nil, nil
+		default:
+			rest = append(rest, spec[i])
+		}
+	}
+	return
+}
+
+// hasNonASCII returns true if any string, []byte, or literal in fields
+// contains 8-bit characters.
+func hasNonASCII(fields []Field) bool {
+	for _, f := range fields {
+		var b []byte
+		switch v := f.(type) {
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		case Literal:
+			b = AsBytes(v)
+		case []Field:
+			if hasNonASCII(v) {
+				return true
+			}
+		}
+		for _, c := range b {
+			if c >= char {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// searchDates returns a copy of spec in which time.Time values that follow
+// date search keys are converted to the SEARCH date format. Other time.Time
+// values are sent in the date-time format (see FormatDateTime). SearchCriteria
+// values are replaced with their fields.
+func searchDates(spec []Field) []Field {
+	out := make([]Field, 0, len(spec))
+	for i, f := range spec {
+		switch v := f.(type) {
+		case time.Time:
+			if i > 0 && searchDateKeys[toUpper(AsAtom(spec[i-1]))] {
+				f = FormatSearchDate(v)
+			}
+		case []Field:
+			f = searchDates(v)
+		case *SearchCriteria:
+			out = append(out, v.Fields()...)
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// SearchCriteria is a composable set of search keys for Client.Search and
+// related methods. Each method adds a key to the criteria, which are combined
+// using AND. Use Or and Not to build other expressions from existing criteria.
+// String arguments are quoted or sent as literals automatically, and dates are
+// formatted using FormatSearchDate. The zero value matches all messages. A
+// *SearchCriteria may be passed to Client.Search directly or mixed with other
+// search keys.
+//
+// Example:
+//
+//	sc := new(imap.SearchCriteria).From("alice@example.com").Since(t)
+//	sc.Or(new(imap.SearchCriteria).Flagged(), new(imap.SearchCriteria).Unseen())
+//	cmd, err := c.Search(sc)
+type SearchCriteria struct {
+	keys [][]Field // Search keys and their arguments
+}
+
+// Fields returns the criteria in the form accepted by Client.Search. The
+// result is "ALL" if no keys were added.
+func (sc *SearchCriteria) Fields() []Field {
+	if sc == nil || len(sc.keys) == 0 {
+		return []Field{"ALL"}
+	}
+	var out []Field
+	for _, key := range sc.keys {
+		out = append(out, key...)
+	}
+	return out
+}
+
+// String returns the criteria as they would appear in a SEARCH command. Literal
+// arguments are shown as {n} placeholders.
+func (sc *SearchCriteria) String() string {
+	raw := &rawCommand{Buffer: new(bytes.Buffer)}
+	if err := raw.WriteFields(sc.Fields(), false); err != nil {
+		return err.Error()
+	}
+	return string(bytes.Replace(raw.Bytes(), crlf, nil, -1))
+}
+
+// add appends a search key and returns sc.
+func (sc *SearchCriteria) add(key ...Field) *SearchCriteria {
+	sc.keys = append(sc.keys, key)
+	return sc
+}
+
+// addString appends a search key that takes a single string argument.
+func (sc *SearchCriteria) addString(key, s string) *SearchCriteria {
+	return sc.add(key, encodeString(s, false))
+}
+
+// addDate appends a search key that takes a date argument.
+func (sc *SearchCriteria) addDate(key string, t time.Time) *SearchCriteria {
+	return sc.add(key, FormatSearchDate(t))
+}
+
+// operand returns sc as a single search key, parenthesizing multiple keys.
+func (sc *SearchCriteria) operand() []Field {
+	if sc == nil || len(sc.keys) == 0 {
+		return []Field{"ALL"}
+	} else if len(sc.keys) == 1 {
+		return sc.keys[0]
+	}
+	return []Field{sc.Fields()}
+}
+
+// And adds all keys from the other criteria to sc.
+func (sc *SearchCriteria) And(other ...*SearchCriteria) *SearchCriteria {
+	for _, o := range other {
+		if o != nil {
+			sc.keys = append(sc.keys, o.keys...)
+		}
+	}
+	return sc
+}
+
+// Or adds a key that matches messages matching either a or b.
+func (sc *SearchCriteria) Or(a, b *SearchCriteria) *SearchCriteria {
+	key := append([]Field{"OR"}, a.operand()...)
+	return sc.add(append(key, b.operand()...)...)
+}
+
+// Not adds a key that matches messages not matching other.
+func (sc *SearchCriteria) Not(other *SearchCriteria) *SearchCriteria {
+	return sc.add(append([]Field{"NOT"}, other.operand()...)...)
+}
+
+// Flag keys.
+func (sc *SearchCriteria) Answered() *SearchCriteria   { return sc.add("ANSWERED") }
+func (sc *SearchCriteria) Deleted() *SearchCriteria    { return sc.add("DELETED") }
+func (sc *SearchCriteria) Draft() *SearchCriteria      { return sc.add("DRAFT") }
+func (sc *SearchCriteria) Flagged() *SearchCriteria    { return sc.add("FLAGGED") }
+func (sc *SearchCriteria) New() *SearchCriteria        { return sc.add("NEW") }
+func (sc *SearchCriteria) Old() *SearchCriteria        { return sc.add("OLD") }
+func (sc *SearchCriteria) Recent() *SearchCriteria     { return sc.add("RECENT") }
+func (sc *SearchCriteria) Seen() *SearchCriteria       { return sc.add("SEEN") }
+func (sc *SearchCriteria) Unanswered() *SearchCriteria { return sc.add("UNANSWERED") }
+func (sc *SearchCriteria) Undeleted() *SearchCriteria  { return sc.add("UNDELETED") }
+func (sc *SearchCriteria) Undraft() *SearchCriteria    { return sc.add("UNDRAFT") }
+func (sc *SearchCriteria) Unflagged() *SearchCriteria  { return sc.add("UNFLAGGED") }
+func (sc *SearchCriteria) Unseen() *SearchCriteria     { return sc.add("UNSEEN") }
+
+// Keyword adds a key that matches messages with the specified keyword flag.
+// The keyword must be an atom; otherwise, the command cannot be sent.
+func (sc *SearchCriteria) Keyword(flag string) *SearchCriteria {
+	return sc.add("KEYWORD", keywordArg(flag))
+}
+
+// Unkeyword adds a key that matches messages without the specified keyword
+// flag. The keyword must be an atom; otherwise, the command cannot be sent.
+func (sc *SearchCriteria) Unkeyword(flag string) *SearchCriteria {
+	return sc.add("UNKEYWORD", keywordArg(flag))
+}
+
+// keywordArg returns flag as a KEYWORD or UNKEYWORD argument. RFC 3501 requires
+// flag-keyword to be an atom, so other values cannot be quoted.
+func keywordArg(flag string) Field {
+	if !isAtom(flag) {
+		return badArg{"keyword", flag}
+	}
+	return flag
+}
+
+// String keys.
+func (sc *SearchCriteria) Bcc(s string) *SearchCriteria     { return sc.addString("BCC", s) }
+func (sc *SearchCriteria) Body(s string) *SearchCriteria    { return sc.addString("BODY", s) }
+func (sc *SearchCriteria) Cc(s string) *SearchCriteria      { return sc.addString("CC", s) }
+func (sc *SearchCriteria) From(s string) *SearchCriteria    { return sc.addString("FROM", s) }
+func (sc *SearchCriteria) Subject(s string) *SearchCriteria { return sc.addString("SUBJECT", s) }
+func (sc *SearchCriteria) Text(s string) *SearchCriteria    { return sc.addString("TEXT", s) }
+func (sc *SearchCriteria) To(s string) *SearchCriteria      { return sc.addString("TO", s) }
+
+// Header adds a key that matches messages with a header field that has the
+// specified name and contains value. An empty value matches all messages that
+// have the field.
+func (sc *SearchCriteria) Header(name, value string) *SearchCriteria {
+	return sc.add("HEADER", encodeString(name, true), encodeString(value, false))
+}
+
+// Date keys. The internal date is used by Before, On, and Since; the Date
+// header is used by SentBefore, SentOn, and SentSince. Only the date in t's
+// location is significant.
+func (sc *SearchCriteria) Before(t time.Time) *SearchCriteria     { return sc.addDate("BEFORE", t) }
+func (sc *SearchCriteria) On(t time.Time) *SearchCriteria         { return sc.addDate("ON", t) }
+func (sc *SearchCriteria) Since(t time.Time) *SearchCriteria      { return sc.addDate("SINCE", t) }
+func (sc *SearchCriteria) SentBefore(t time.Time) *SearchCriteria { return sc.addDate("SENTBEFORE", t) }
+func (sc *SearchCriteria) SentOn(t time.Time) *SearchCriteria     { return sc.addDate("SENTON", t) }
+func (sc *SearchCriteria) SentSince(t time.Time) *SearchCriteria  { return sc.addDate("SENTSINCE", t) }
+
+// Larger adds a key that matches messages with an RFC 822 size larger than n
+// octets.
+func (sc *SearchCriteria) Larger(n uint32) *SearchCriteria {
+	return sc.add("LARGER", n)
+}
+
+// Smaller adds a key that matches messages with an RFC 822 size smaller than n
+// octets.
+func (sc *SearchCriteria) Smaller(n uint32) *SearchCriteria {
+	return sc.add("SMALLER", n)
+}
+
+// SeqSet adds a key that matches messages with sequence numbers in seq.
+func (sc *SearchCriteria) SeqSet(seq *SeqSet) *SearchCriteria {
+	return sc.add(seq)
+}
+
+// UID adds a key that matches messages with unique identifiers in uids.
+func (sc *SearchCriteria) UID(uids *SeqSet) *SearchCriteria {
+	return sc.add("UID", uids)
+}
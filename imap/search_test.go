@@ -0,0 +1,71 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchCriteria(t *testing.T) {
+	d := time.Date(1994, time.February, 1, 12, 0, 0, 0, time.UTC)
+	uids, _ := NewSeqSet("1:100")
+	sc := func() *SearchCriteria { return new(SearchCriteria) }
+	tests := []struct {
+		in  *SearchCriteria
+		out string
+	}{
+		{nil, `ALL`},
+		{sc(), `ALL`},
+		{sc().Flagged().Unseen(), `FLAGGED UNSEEN`},
+		{sc().From("alice@example.com").Since(d), `FROM "alice@example.com" SINCE 1-Feb-1994`},
+		{sc().Subject(`say "hi"`), `SUBJECT "say \"hi\""`},
+		{sc().Subject("café"), `SUBJECT {5}`},
+		{sc().Header("X-Priority", ""), `HEADER X-Priority ""`},
+		{sc().Header("List-Id", "go"), `HEADER List-Id "go"`},
+		{sc().Larger(1024).Smaller(4096), `LARGER 1024 SMALLER 4096`},
+		{sc().UID(uids).Keyword("$Junk"), `UID 1:100 KEYWORD $Junk`},
+		{sc().Not(sc().Seen()), `NOT SEEN`},
+		{sc().Not(sc().Seen().Deleted()), `NOT (SEEN DELETED)`},
+		{sc().Or(sc().From("a"), sc().To("b")), `OR FROM "a" TO "b"`},
+		{sc().Or(sc().Flagged(), sc().Not(sc().Before(d)).Larger(10)),
+			`OR FLAGGED (NOT BEFORE 1-Feb-1994 LARGER 10)`},
+		{sc().Answered().And(sc().Draft(), nil, sc().Text("x")), `ANSWERED DRAFT TEXT "x"`},
+		{sc().Or(sc(), sc().New()), `OR ALL NEW`},
+		{sc().Keyword(`\Seen`), `imap: invalid keyword "\\Seen"`},
+		{sc().Unkeyword("a b"), `imap: invalid keyword "a b"`},
+	}
+	for _, test := range tests {
+		if out := test.in.String(); out != test.out {
+			t.Errorf("SearchCriteria expected %q; got %q", test.out, out)
+		}
+	}
+}
+
+func TestSearchSplitNonASCII(t *testing.T) {
+	subj := AString("日本")
+	tests := []struct {
+		in              []Field
+		rest, unapplied []Field
+	}{
+		{[]Field{"NOT", "SEEN", "SUBJECT", subj},
+			[]Field{"NOT", "SEEN"}, []Field{"SUBJECT", subj}},
+		{[]Field{"OR", "FROM", "a", "HEADER", "X", "y", "SUBJECT", subj},
+			[]Field{"OR", "FROM", "a", "HEADER", "X", "y"}, []Field{"SUBJECT", subj}},
+		{[]Field{"OR", "NOT", "SEEN", "1:5", "BODY", subj, "UNSEEN"},
+			[]Field{"OR", "NOT", "SEEN", "1:5", "UNSEEN"}, []Field{"BODY", subj}},
+		{[]Field{"NOT", "SUBJECT", subj}, nil, nil},
+		{[]Field{"OR", "SEEN", "SUBJECT", subj}, nil, nil},
+		{[]Field{"SEEN", []Field{"SUBJECT", subj}}, nil, nil},
+	}
+	for _, test := range tests {
+		rest, unapplied := splitNonASCII(test.in)
+		if !reflect.DeepEqual(rest, test.rest) || !reflect.DeepEqual(unapplied, test.unapplied) {
+			t.Errorf("splitNonASCII(%v) expected %v, %v; got %v, %v",
+				test.in, test.rest, test.unapplied, rest, unapplied)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Section text specifiers for SectionSpec.Text (ABNF: section-msgtext and
+// section-text).
+const (
+	SectionAll             = ""                  // Entire message or part
+	SectionHeader          = "HEADER"            // Message header
+	SectionHeaderFields    = "HEADER.FIELDS"     // Subset of the header
+	SectionHeaderFieldsNot = "HEADER.FIELDS.NOT" // Header without some fields
+	SectionText            = "TEXT"              // Message body without the header
+	SectionMIME            = "MIME"              // MIME header of a part
+)
+
+// SectionSpec describes a BODY[<section>]<<partial>> FETCH data item, as
+// described in RFC 3501 section 6.4.5. The String method returns the data item
+// for use with Client.Fetch, and Value extracts the matching attribute from a
+// FETCH response.
+type SectionSpec struct {
+	Part    string   // Part specifier (e.g. "1.2"; empty for the entire message)
+	Text    string   // Section text specifier (e.g. SectionHeader)
+	Fields  []string // Header field names for HEADER.FIELDS[.NOT]
+	Peek    bool     // Use BODY.PEEK to avoid setting the \Seen flag
+	Partial bool     // Fetch Count octets starting at Offset
+	Offset  uint32   // Partial fetch offset
+	Count   uint32   // Partial fetch octet count
+}
+
+// BodySection returns a SectionSpec that fetches the contents of the specified
+// part without setting the \Seen flag.
+func BodySection(part string) *SectionSpec {
+	return &SectionSpec{Part: part, Peek: true}
+}
+
+// HeaderSection returns a SectionSpec that fetches the specified header fields
+// of the message without setting the \Seen flag. The entire header is fetched
+// if no field names are specified.
+func HeaderSection(fields ...string) *SectionSpec {
+	if len(fields) == 0 {
+		return &SectionSpec{Text: SectionHeader, Peek: true}
+	}
+	return &SectionSpec{Text: SectionHeaderFields, Fields: fields, Peek: true}
+}
+
+// String returns the FETCH data item (e.g. "BODY.PEEK[1.HEADER]<0.100>").
+func (s *SectionSpec) String() string {
+	b := make([]byte, 0, 64)
+	if s.Peek {
+		b = append(b, "BODY.PEEK"...)
+	} else {
+		b = append(b, "BODY"...)
+	}
+	b = s.appendSection(b)
+	if s.Partial {
+		b = append(b, '<')
+		b = strconv.AppendUint(b, uint64(s.Offset), 10)
+		b = append(b, '.')
+		b = strconv.AppendUint(b, uint64(s.Count), 10)
+		b = append(b, '>')
+	}
+	return string(b)
+}
+
+// ResponseKey returns the name of the attribute in MessageInfo.Attrs that
+// contains the requested data. Only the origin octet is included for partial
+// fetches (e.g. "BODY[1.HEADER]<0>").
+func (s *SectionSpec) ResponseKey() string {
+	b := s.appendSection([]byte("BODY"))
+	if s.Partial {
+		b = append(b, '<')
+		b = strconv.AppendUint(b, uint64(s.Offset), 10)
+		b = append(b, '>')
+	}
+	return toUpper(string(b))
+}
+
+// Value returns the value of the section from the FETCH response attributes.
+// Servers may use different quoting and case for the header field names, so
+// the comparison ignores these differences. Nil is returned if the section is
+// not found.
+func (s *SectionSpec) Value(msg *MessageInfo) Field {
+	key := s.ResponseKey()
+	if f, ok := msg.Attrs[key]; ok {
+		return f
+	} else if len(s.Fields) == 0 {
+		return nil
+	}
+	key = normSectionKey(key)
+	for k, f := range msg.Attrs {
+		if strings.HasPrefix(k, "BODY[") && normSectionKey(k) == key {
+			return f
+		}
+	}
+	return nil
+}
+
+// appendSection appends "[<section>]" to b.
+func (s *SectionSpec) appendSection(b []byte) []byte {
+	b = append(b, '[')
+	b = append(b, s.Part...)
+	if s.Text != "" {
+		if s.Part != "" {
+			b = append(b, '.')
+		}
+		b = append(b, s.Text...)
+	}
+	if len(s.Fields) > 0 &&
+		(s.Text == SectionHeaderFields || s.Text == SectionHeaderFieldsNot) {
+		b = append(b, " ("...)
+		for i, name := range s.Fields {
+			if i > 0 {
+				b = append(b, ' ')
+			}
+			if isAtom(name) {
+				b = append(b, name...)
+			} else {
+				b = append(b, Quote(name, false)...)
+			}
+		}
+		b = append(b, ')')
+	}
+	return append(b, ']')
+}
+
+// normSectionKey removes quotes and extra spaces from a response key.
+func normSectionKey(k string) string {
+	return toUpper(strings.Join(strings.Fields(strings.Replace(k, `"`, "", -1)), " "))
+}
+
+// isAtom returns true if s can be sent as an atom.
+func isAtom(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= char || atomSpecials[c] || c == ']' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "testing"
+
+func TestSectionSpec(t *testing.T) {
+	tests := []struct {
+		in  *SectionSpec
+		str string
+		key string
+	}{
+		{&SectionSpec{}, "BODY[]", "BODY[]"},
+		{BodySection(""), "BODY.PEEK[]", "BODY[]"},
+		{BodySection("1.2"), "BODY.PEEK[1.2]", "BODY[1.2]"},
+		{&SectionSpec{Part: "2", Text: SectionMIME}, "BODY[2.MIME]", "BODY[2.MIME]"},
+		{&SectionSpec{Text: SectionText, Partial: true, Offset: 100, Count: 50},
+			"BODY[TEXT]<100.50>", "BODY[TEXT]<100>"},
+		{HeaderSection(), "BODY.PEEK[HEADER]", "BODY[HEADER]"},
+		{HeaderSection("Subject", "From"),
+			"BODY.PEEK[HEADER.FIELDS (Subject From)]", "BODY[HEADER.FIELDS (SUBJECT FROM)]"},
+		{&SectionSpec{Part: "3", Text: SectionHeaderFieldsNot, Fields: []string{"X-A", "a b"}},
+			`BODY[3.HEADER.FIELDS.NOT (X-A "a b")]`, `BODY[3.HEADER.FIELDS.NOT (X-A "A B")]`},
+	}
+	for _, test := range tests {
+		if s := test.in.String(); s != test.str {
+			t.Errorf("String(%+v) expected %q; got %q", test.in, test.str, s)
+		}
+		if k := test.in.ResponseKey(); k != test.key {
+			t.Errorf("ResponseKey(%+v) expected %q; got %q", test.in, test.key, k)
+		}
+	}
+
+	msg := &MessageInfo{Attrs: FieldMap{
+		"BODY[HEADER.FIELDS (\"SUBJECT\" \"FROM\")]": lit("Subject: x\r\n\r\n"),
+		"BODY[1]":       lit("one"),
+		"BODY[TEXT]<0>": lit("partial"),
+	}}
+	values := []struct {
+		in  *SectionSpec
+		out string
+	}{
+		{HeaderSection("subject", "from"), "Subject: x\r\n\r\n"},
+		{BodySection("1"), "one"},
+		{&SectionSpec{Text: SectionText, Partial: true, Count: 7}, "partial"},
+		{BodySection("2"), ""},
+		{HeaderSection("To"), ""},
+	}
+	for _, test := range values {
+		if out := AsString(test.in.Value(msg)); out != test.out {
+			t.Errorf("Value(%v) expected %q; got %q", test.in, test.out, out)
+		}
+	}
+}
@@ -5,7 +5,9 @@
 package imap
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -107,17 +109,21 @@ func (s seq) Merge(t seq) (union seq, ok bool) {
 
 // String returns sequence value s as a seq-number or seq-range string.
 func (s seq) String() string {
-	if s.start == s.stop {
-		if s.start == 0 {
-			return "*"
-		}
-		return strconv.FormatUint(uint64(s.start), 10)
+	return string(s.appendTo(make([]byte, 0, 24)))
+}
+
+// appendTo appends the string representation of s to b.
+func (s seq) appendTo(b []byte) []byte {
+	if s.start == 0 {
+		return append(b, '*')
 	}
-	b := strconv.AppendUint(make([]byte, 0, 24), uint64(s.start), 10)
-	if s.stop == 0 {
-		return string(append(b, ':', '*'))
+	b = strconv.AppendUint(b, uint64(s.start), 10)
+	if s.start == s.stop {
+		return b
+	} else if s.stop == 0 {
+		return append(b, ':', '*')
 	}
-	return string(strconv.AppendUint(append(b, ':'), uint64(s.stop), 10))
+	return strconv.AppendUint(append(b, ':'), uint64(s.stop), 10)
 }
 
 // SeqSet is used to represent a set of message sequence numbers or UIDs (see
@@ -132,25 +138,61 @@ func NewSeqSet(set string) (s *SeqSet, err error) {
 	return s, s.Add(set)
 }
 
+// NewSeqSetNums returns a new SeqSet instance containing all numbers in q,
+// which do not need to be sorted. Consecutive numbers are compacted into
+// ranges. The value 0 represents "*".
+func NewSeqSetNums(q []uint32) *SeqSet {
+	nums := append([]uint32(nil), q...)
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	s, star := new(SeqSet), false
+	for _, v := range nums {
+		if v == 0 {
+			star = true
+		} else if n := len(s.set); n > 0 && (v <= s.set[n-1].stop || v == s.set[n-1].stop+1) {
+			s.set[n-1].stop = v
+		} else {
+			s.set = append(s.set, seq{v, v})
+		}
+	}
+	if star {
+		s.insert(seq{0, 0})
+	}
+	return s
+}
+
 // Add inserts new sequence values into the set. The string format is described
 // by RFC 3501 sequence-set ABNF rule. If an error is encountered, all values
 // inserted successfully prior to the error remain in the set.
 func (s *SeqSet) Add(set string) error {
-	for _, sv := range strings.Split(set, ",") {
+	parts := strings.Split(set, ",")
+	vs := make([]seq, 0, len(parts))
+	for _, sv := range parts {
 		v, err := parseSeq(sv)
 		if err != nil {
+			s.insertAll(vs)
 			return err
 		}
-		s.insert(v)
+		vs = append(vs, v)
 	}
+	s.insertAll(vs)
 	return nil
 }
 
 // AddNum inserts new sequence numbers into the set. The value 0 represents "*".
+// Adding many numbers with a single call is much faster than adding them one at
+// a time, unless they are added in ascending order.
 func (s *SeqSet) AddNum(q ...uint32) {
-	for _, v := range q {
-		s.insert(seq{v, v})
+	if len(q) < bulkInsertMin {
+		for _, v := range q {
+			s.insert(seq{v, v})
+		}
+		return
 	}
+	vs := make([]seq, len(q))
+	for i, v := range q {
+		vs[i] = seq{v, v}
+	}
+	s.insertAll(vs)
 }
 
 // AddRange inserts a new sequence range into the set.
@@ -164,9 +206,7 @@ func (s *SeqSet) AddRange(start, stop uint32) {
 
 // AddSet inserts all values from t into s.
 func (s *SeqSet) AddSet(t *SeqSet) {
-	for _, v := range t.set {
-		s.insert(v)
-	}
+	s.insertAll(t.set)
 }
 
 // Clear removes all values from the set.
@@ -196,28 +236,153 @@ func (s SeqSet) Contains(q uint32) bool {
 	return false
 }
 
+// Count returns the number of values in the set. For the purposes of counting,
+// "*" is treated as a single value larger than any UID, so "n:*" contains all
+// numbers >= n plus "*".
+func (s SeqSet) Count() (n uint64) {
+	for _, r := range s.ranges() {
+		n += r.stop - r.start + 1
+	}
+	return
+}
+
+// Union returns a new set containing all values that are in s or t.
+func (s SeqSet) Union(t *SeqSet) *SeqSet {
+	u := &SeqSet{append([]seq(nil), s.set...)}
+	u.AddSet(t)
+	return u
+}
+
+// Intersect returns a new set containing all values that are in both s and t.
+// Dynamic values are handled as described for Count.
+func (s SeqSet) Intersect(t *SeqSet) *SeqSet {
+	u := new(SeqSet)
+	a, b := s.ranges(), t.ranges()
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, stop := a[i].start, a[i].stop
+		if b[j].start > start {
+			start = b[j].start
+		}
+		if b[j].stop < stop {
+			stop = b[j].stop
+		}
+		if start <= stop {
+			u.insertRange(start, stop)
+		}
+		if a[i].stop < b[j].stop {
+			i++
+		} else {
+			j++
+		}
+	}
+	return u
+}
+
+// Subtract returns a new set containing all values that are in s, but not in
+// t. Dynamic values are handled as described for Count.
+func (s SeqSet) Subtract(t *SeqSet) *SeqSet {
+	u := new(SeqSet)
+	b, j := t.ranges(), 0
+	for _, r := range s.ranges() {
+		start := r.start
+		for j < len(b) && b[j].stop < start {
+			j++
+		}
+		for k := j; k < len(b) && b[k].start <= r.stop; k++ {
+			if b[k].start > start {
+				u.insertRange(start, b[k].start-1)
+			}
+			start = b[k].stop + 1
+		}
+		if start <= r.stop {
+			u.insertRange(start, r.stop)
+		}
+	}
+	return u
+}
+
+// Nums calls f for each value in the set in ascending order until f returns
+// false. The value 0 represents "*", which is visited last. Dynamic ranges
+// ("n:*") are expanded to all numbers from n through 4294967295, followed by
+// "*", so callers should check Dynamic before iterating over untrusted sets.
+func (s SeqSet) Nums(f func(q uint32) bool) {
+	for _, r := range s.ranges() {
+		for q := r.start; q <= r.stop; q++ {
+			if !f(uint32(q)) {
+				return
+			}
+		}
+	}
+}
+
+// Ranges calls f for each range of consecutive values in the set in ascending
+// order until f returns false. Single numbers are visited with start == stop.
+// The value 0 represents "*" (e.g. "5:*" is visited as start = 5, stop = 0).
+func (s SeqSet) Ranges(f func(start, stop uint32) bool) {
+	for _, v := range s.set {
+		if !f(v.start, v.stop) {
+			return
+		}
+	}
+}
+
+// Split divides the set into consecutive subsets whose string representations
+// are no longer than n bytes, which keeps commands operating on very large sets
+// under server line length limits. A single range that is longer than n is
+// returned in its own subset. The original set is returned if it is already
+// short enough.
+func (s SeqSet) Split(n int) []*SeqSet {
+	var out []*SeqSet
+	cur, size := new(SeqSet), 0
+	for _, v := range s.set {
+		vn := len(v.String())
+		if size > 0 && size+1+vn > n {
+			out = append(out, cur)
+			cur, size = new(SeqSet), 0
+		} else if size > 0 {
+			size++
+		}
+		cur.set = append(cur.set, v)
+		size += vn
+	}
+	if size > 0 {
+		if len(out) == 0 {
+			return []*SeqSet{&s}
+		}
+		out = append(out, cur)
+	}
+	return out
+}
+
 // String returns a sorted representation of all contained sequence values.
 func (s SeqSet) String() string {
 	if len(s.set) == 0 {
 		return ""
 	}
-	b := make([]byte, 0, 64)
-	for _, v := range s.set {
-		b = append(b, ',')
-		if v.start == 0 {
-			b = append(b, '*')
-			continue
+	return string(s.appendTo(make([]byte, 0, 12*len(s.set))))
+}
+
+// appendTo appends the string representation of s to b.
+func (s SeqSet) appendTo(b []byte) []byte {
+	for i, v := range s.set {
+		if i > 0 {
+			b = append(b, ',')
 		}
-		b = strconv.AppendUint(b, uint64(v.start), 10)
-		if v.start != v.stop {
-			if v.stop == 0 {
-				b = append(b, ':', '*')
-				continue
-			}
-			b = strconv.AppendUint(append(b, ':'), uint64(v.stop), 10)
+		b = v.appendTo(b)
+	}
+	return b
+}
+
+// writeTo writes the string representation of s to buf without creating an
+// intermediate string, which matters for sets with millions of values.
+func (s SeqSet) writeTo(buf *bytes.Buffer) {
+	var b [24]byte
+	for i, v := range s.set {
+		if i > 0 {
+			buf.WriteByte(',')
 		}
+		buf.Write(v.appendTo(b[:0]))
 	}
-	return string(b[1:])
 }
 
 // insert adds sequence value v to the set.
@@ -254,6 +419,84 @@ func (s *SeqSet) insert(v seq) {
 	s.set = s.set[:i+1]
 }
 
+// bulkInsertMin is the number of values at which insertAll switches from
+// inserting the values one at a time to sorting and merging the entire set.
+const bulkInsertMin = 16
+
+// insertAll adds sequence values vs to the set. Inserting n values one at a
+// time takes O(n^2) time in the worst case, because each insertion may shift
+// the rest of the set. Larger batches are combined with the existing values,
+// sorted, and merged in O(n log n) time instead.
+func (s *SeqSet) insertAll(vs []seq) {
+	if len(vs) < bulkInsertMin {
+		for _, v := range vs {
+			s.insert(v)
+		}
+		return
+	}
+	set := make([]seq, 0, len(s.set)+len(vs))
+	set = append(append(set, s.set...), vs...)
+	sort.Slice(set, func(i, j int) bool {
+		return seqStart(set[i]) < seqStart(set[j])
+	})
+	out := set[:0]
+	for _, v := range set {
+		if n := len(out); n > 0 {
+			var ok bool
+			if out[n-1], ok = out[n-1].Merge(v); ok {
+				continue
+			}
+		}
+		out = append(out, v)
+	}
+	s.set = out
+}
+
+// seqStart returns the start of v as a sort key, with "*" following all
+// numbers.
+func seqStart(v seq) uint64 {
+	if v.start == 0 {
+		return starInt
+	}
+	return uint64(v.start)
+}
+
+// seqRange is a sequence value with "*" represented by starInt, which allows
+// dynamic values to be compared with numbers.
+type seqRange struct {
+	start, stop uint64
+}
+
+// starInt is the value of "*" in a seqRange.
+const starInt = 1 << 32
+
+// ranges returns the set values as seqRange instances.
+func (s SeqSet) ranges() []seqRange {
+	r := make([]seqRange, len(s.set))
+	for i, v := range s.set {
+		r[i] = seqRange{uint64(v.start), uint64(v.stop)}
+		if v.start == 0 {
+			r[i].start = starInt
+		}
+		if v.stop == 0 {
+			r[i].stop = starInt
+		}
+	}
+	return r
+}
+
+// insertRange adds the values from start through stop to the set, where
+// starInt represents "*".
+func (s *SeqSet) insertRange(start, stop uint64) {
+	if start == starInt {
+		s.insert(seq{0, 0})
+	} else if stop == starInt {
+		s.insert(seq{uint32(start), 0})
+	} else {
+		s.insert(seq{uint32(start), uint32(stop)})
+	}
+}
+
 // insertAt inserts a new sequence value v at index i, resizing s.set as needed.
 func (s *SeqSet) insertAt(i int, v seq) {
 	if n := len(s.set); i == n {
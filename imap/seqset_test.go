@@ -5,7 +5,9 @@
 package imap
 
 import (
+	"bytes"
 	"math/rand"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -726,3 +728,166 @@ func TestSeqSetAddNumRangeSet(t *testing.T) {
 		}
 	}
 }
+
+func TestSeqSetAlgebra(t *testing.T) {
+	tests := []struct {
+		a, b             string
+		union, and, diff string
+	}{
+		{"", "", "", "", ""},
+		{"1:5", "", "1:5", "", "1:5"},
+		{"", "1:5", "1:5", "", ""},
+		{"1:5", "3:8", "1:8", "3:5", "1:2"},
+		{"1:10", "3,5:6", "1:10", "3,5:6", "1:2,4,7:10"},
+		{"1,3,5", "2,4,6", "1:6", "", "1,3,5"},
+		{"1:3,7:9", "2:8", "1:9", "2:3,7:8", "1,9"},
+		{"5:*", "1:10", "1:*", "5:10", "11:*"},
+		{"5:*", "*", "5:*", "*", "5:4294967295"},
+		{"1:3,*", "2:*", "1:*", "2:3,*", "1"},
+		{"4294967295", "*", "4294967295,*", "", "4294967295"},
+	}
+	for _, test := range tests {
+		a, _ := NewSeqSet(test.a)
+		b, _ := NewSeqSet(test.b)
+		for _, op := range []struct {
+			name string
+			s    *SeqSet
+			out  string
+		}{
+			{"Union", a.Union(b), test.union},
+			{"Intersect", a.Intersect(b), test.and},
+			{"Subtract", a.Subtract(b), test.diff},
+		} {
+			checkSeqSet(op.s, t)
+			if out := op.s.String(); out != op.out {
+				t.Errorf("%q.%s(%q) expected %q; got %q", test.a, op.name, test.b, op.out, out)
+			}
+		}
+		if a.String() != test.a || b.String() != test.b {
+			t.Errorf("%q, %q modified by set operations", test.a, test.b)
+		}
+	}
+}
+
+func TestSeqSetIteration(t *testing.T) {
+	s, _ := NewSeqSet("2,4:6,10:11")
+	if n := s.Count(); n != 6 {
+		t.Errorf("Count() expected 6; got %d", n)
+	}
+	var nums []uint32
+	s.Nums(func(q uint32) bool {
+		nums = append(nums, q)
+		return true
+	})
+	if want := []uint32{2, 4, 5, 6, 10, 11}; !reflect.DeepEqual(nums, want) {
+		t.Errorf("Nums() expected %v; got %v", want, nums)
+	}
+	var rngs []seq
+	s.Ranges(func(start, stop uint32) bool {
+		rngs = append(rngs, seq{start, stop})
+		return len(rngs) < 2
+	})
+	if want := []seq{{2, 2}, {4, 6}}; !reflect.DeepEqual(rngs, want) {
+		t.Errorf("Ranges() expected %v; got %v", want, rngs)
+	}
+
+	s, _ = NewSeqSet("4294967294:*")
+	nums = nums[:0]
+	s.Nums(func(q uint32) bool {
+		nums = append(nums, q)
+		return true
+	})
+	if want := []uint32{4294967294, 4294967295, 0}; !reflect.DeepEqual(nums, want) {
+		t.Errorf("Nums() expected %v; got %v", want, nums)
+	} else if n := s.Count(); n != 3 {
+		t.Errorf("Count() expected 3; got %d", n)
+	}
+}
+
+func TestNewSeqSetNums(t *testing.T) {
+	tests := []struct {
+		in  []uint32
+		out string
+	}{
+		{nil, ""},
+		{[]uint32{5}, "5"},
+		{[]uint32{9, 1, 3, 2, 7, 8, 2, 1}, "1:3,7:9"},
+		{[]uint32{0, 4294967295, 4294967294, 4294967295}, "4294967294:4294967295,*"},
+		{[]uint32{0, 10, 11}, "10:11,*"},
+	}
+	for _, test := range tests {
+		s := NewSeqSetNums(test.in)
+		checkSeqSet(s, t)
+		if out := s.String(); out != test.out {
+			t.Errorf("NewSeqSetNums(%v) expected %q; got %q", test.in, test.out, out)
+		}
+	}
+}
+
+func TestSeqSetBulkInsert(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		nums := make([]uint32, bulkInsertMin+r.Intn(200))
+		for j := range nums {
+			nums[j] = uint32(r.Intn(300))
+		}
+		base, _ := NewSeqSet("50:60,100:*")
+		if i%2 == 0 {
+			base, _ = NewSeqSet("1,4,250:260")
+		}
+
+		want := &SeqSet{append([]seq(nil), base.set...)}
+		for _, v := range nums {
+			want.insert(seq{v, v})
+		}
+		s := &SeqSet{append([]seq(nil), base.set...)}
+		s.AddNum(nums...)
+		checkSeqSet(s, t)
+		if !reflect.DeepEqual(s.set, want.set) {
+			t.Fatalf("AddNum(%v) expected %v; got %v", nums, want, s)
+		}
+
+		u := &SeqSet{append([]seq(nil), base.set...)}
+		u.AddSet(NewSeqSetNums(nums))
+		if !reflect.DeepEqual(u.set, want.set) {
+			t.Fatalf("AddSet(%v) expected %v; got %v", nums, want, u)
+		}
+		v := new(SeqSet)
+		if err := v.Add(base.String() + "," + u.String()); err != nil || !reflect.DeepEqual(v.set, want.set) {
+			t.Fatalf("Add(%q) expected %v; got %v (%v)", u.String(), want, v, err)
+		}
+	}
+
+	// Command text is written without creating a string
+	s := NewSeqSetNums([]uint32{1, 2, 3, 5, 0})
+	var buf bytes.Buffer
+	s.writeTo(&buf)
+	if out := buf.String(); out != s.String() || out != "1:3,5,*" {
+		t.Errorf("writeTo() expected \"1:3,5,*\"; got %q", out)
+	}
+}
+
+func TestSeqSetSplit(t *testing.T) {
+	tests := []struct {
+		in  string
+		n   int
+		out []string
+	}{
+		{"", 10, nil},
+		{"1:5,7", 10, []string{"1:5,7"}},
+		{"1,3,5,7,9,11", 5, []string{"1,3,5", "7,9", "11"}},
+		{"1:100000,200000,300000:*", 8, []string{"1:100000", "200000", "300000:*"}},
+		{"1,3,5", 1, []string{"1", "3", "5"}},
+	}
+	for _, test := range tests {
+		s, _ := NewSeqSet(test.in)
+		var out []string
+		for _, part := range s.Split(test.n) {
+			checkSeqSet(part, t)
+			out = append(out, part.String())
+		}
+		if !reflect.DeepEqual(out, test.out) {
+			t.Errorf("Split(%q, %d) expected %q; got %q", test.in, test.n, test.out, out)
+		}
+	}
+}
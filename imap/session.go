@@ -0,0 +1,549 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session provides a synchronous interface to the most common IMAP commands,
+// using typed arguments and results instead of raw Fields and Command
+// instances. It is a thin layer over Client, which remains available for
+// extensions and asynchronous use. Each method waits for command completion and
+// returns a ResponseError if the completion status is other than OK.
+type Session struct {
+	Client *Client // Underlying client
+	UID    bool    // Interpret message numbers as UIDs instead of sequence numbers
+	Trash  string  // Trash mailbox for DeleteMessages (detected if empty)
+	Drafts string  // Drafts mailbox for SaveDraft and UpdateDraft (detected if empty)
+}
+
+// NewSession returns a new Session for client c.
+func NewSession(c *Client) *Session {
+	return &Session{Client: c}
+}
+
+// StoreOp specifies how the flags in a StoreRequest are applied.
+type StoreOp string
+
+// Flag modification operations for StoreRequest.
+const (
+	StoreReplace StoreOp = "FLAGS"  // Replace existing flags
+	StoreAdd     StoreOp = "+FLAGS" // Add to existing flags
+	StoreRemove  StoreOp = "-FLAGS" // Remove from existing flags
+)
+
+// StoreRequest describes a change to the flags of one or more messages.
+type StoreRequest struct {
+	Seq    *SeqSet // Messages to modify
+	Op     StoreOp // Modification operation
+	Flags  []Flag  // Flags to replace, add, or remove
+	Silent bool    // Do not return the updated flags
+}
+
+// AppendRequest describes a message to be appended to a mailbox.
+type AppendRequest struct {
+	Mailbox string    // Destination mailbox
+	Flags   []Flag    // Initial message flags
+	Date    time.Time // Internal date (zero to let the server choose)
+	Message []byte    // Message header and body in RFC 5322 format
+}
+
+// AppendResult contains the UIDPLUS information returned for an appended
+// message. All fields are zero if the server does not support UIDPLUS.
+type AppendResult struct {
+	UIDValidity uint32 // Destination mailbox UIDVALIDITY
+	UID         uint32 // UID assigned to the new message
+}
+
+// CopyResult contains the UIDPLUS information returned for copied or moved
+// messages. All fields are zero if the server does not support UIDPLUS.
+type CopyResult struct {
+	UIDValidity uint32    // Destination mailbox UIDVALIDITY
+	SrcUIDs     *SeqSet   // UIDs of the source messages
+	DstUIDs     *SeqSet   // UIDs assigned to the copies, in the same order
+	Pairs       []UIDPair // Source and destination UIDs in COPYUID order
+}
+
+// UIDPair associates the UID of a source message with the UID of its copy.
+type UIDPair struct {
+	Src, Dst uint32
+}
+
+// maxCopyUIDs limits the number of UIDs expanded from a COPYUID response.
+const maxCopyUIDs = 1 << 20
+
+// Mapping returns the UIDs of the source messages mapped to the UIDs of their
+// copies. Nil is returned if the result does not contain COPYUID information.
+func (r *CopyResult) Mapping() map[uint32]uint32 {
+	if len(r.Pairs) == 0 {
+		return nil
+	}
+	m := make(map[uint32]uint32, len(r.Pairs))
+	for _, p := range r.Pairs {
+		m[p.Src] = p.Dst
+	}
+	return m
+}
+
+// ErrNotSelected is returned by Session.Select if the command succeeds, but the
+// client is no longer in the Selected state (e.g. because the connection was
+// closed).
+var ErrNotSelected = errors.New("imap: mailbox not selected")
+
+// Select opens a mailbox and returns a copy of its status. See Client.Select.
+func (s *Session) Select(mbox string, readonly bool) (*MailboxStatus, error) {
+	if _, err := s.Client.Select(mbox, readonly); err != nil {
+		return nil, err
+	} else if s.Client.Mailbox == nil {
+		return nil, ErrNotSelected
+	}
+	status := *s.Client.Mailbox
+	return &status, nil
+}
+
+// List returns the mailboxes that match the reference and pattern. See
+// Client.List.
+func (s *Session) List(ref, pattern string) ([]*MailboxInfo, error) {
+	cmd, err := Wait(s.Client.List(ref, pattern))
+	if err != nil {
+		return nil, err
+	}
+	var list []*MailboxInfo
+	for _, rsp := range cmd.Data {
+		if info := rsp.MailboxInfo(); info != nil {
+			list = append(list, info)
+		}
+	}
+	return list, nil
+}
+
+// Status returns the status of the specified mailbox. The MESSAGES, RECENT,
+// UIDNEXT, UIDVALIDITY, and UNSEEN items are requested if no items are
+// specified.
+func (s *Session) Status(mbox string, items ...string) (*MailboxStatus, error) {
+	if len(items) == 0 {
+		items = statusItems
+	}
+	cmd, err := Wait(s.Client.Status(mbox, items...))
+	if err != nil {
+		return nil, err
+	}
+	for _, rsp := range cmd.Data {
+		if status := rsp.MailboxStatus(); status != nil {
+			return status, nil
+		}
+	}
+	return nil, ResponseError{cmd.result, "missing STATUS response"}
+}
+
+// Search returns the numbers of the messages that match the criteria. See
+// Client.Search.
+func (s *Session) Search(spec ...Field) ([]uint32, error) {
+	search := s.Client.Search
+	if s.UID {
+		search = s.Client.UIDSearch
+	}
+	cmd, err := Wait(search(spec...))
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for _, rsp := range cmd.Data {
+		ids = append(ids, rsp.SearchResults()...)
+	}
+	return ids, nil
+}
+
+// Fetch returns the requested data items for the specified messages. Multiple
+// FETCH responses for the same message are merged. See Command.Messages.
+func (s *Session) Fetch(seq *SeqSet, items ...string) ([]*MessageInfo, error) {
+	fetch := s.Client.Fetch
+	if s.UID {
+		fetch = s.Client.UIDFetch
+	}
+	cmd, err := Wait(fetch(seq, items...))
+	if err != nil {
+		return nil, err
+	}
+	return cmd.Messages(), nil
+}
+
+// FetchHeaders fetches the specified header fields of the messages with the
+// given UIDs using BODY.PEEK[HEADER.FIELDS (...)], or the entire header if no
+// fields are specified, and returns the parsed headers keyed by UID. Folded
+// lines are joined, but encoded-words are not decoded (see AsHeader). Messages
+// without any of the requested fields are omitted. UIDs are used regardless of
+// s.UID.
+func (s *Session) FetchHeaders(uids *SeqSet, fields ...string) (map[uint32]textproto.MIMEHeader, error) {
+	spec := HeaderSection(fields...)
+	cmd, err := Wait(s.Client.UIDFetch(uids, spec.String()))
+	if err != nil {
+		return nil, err
+	}
+	msgs := cmd.MessagesByUID()
+	hdrs := make(map[uint32]textproto.MIMEHeader, len(msgs))
+	for uid, msg := range msgs {
+		if hdr := AsHeader(spec.Value(msg)); hdr != nil {
+			hdrs[uid] = hdr
+		}
+	}
+	return hdrs, nil
+}
+
+// envelopeItems are the data items requested by Session.FetchEnvelopes.
+var envelopeItems = mustFetchItems("FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE")
+
+// fetchWindow is the maximum number of FETCH commands that FetchEnvelopes keeps
+// in progress at the same time.
+const fetchWindow = 4
+
+// FetchEnvelopes fetches the flags, internal date, size, and envelope of the
+// messages with the specified UIDs in pages of up to pageSize messages, calling
+// f with the messages of each page in order. The UIDs of the existing messages
+// are found with UID SEARCH first, so gaps in the UID space of a sparse mailbox
+// do not cost any commands. Several UID FETCH commands are kept in progress at
+// the same time to hide the network latency, so enumerating a large mailbox
+// does not require one giant command or response. If f returns an error, no
+// more commands are issued and the error is returned after the commands in
+// progress are completed. UIDs are used regardless of s.UID.
+func (s *Session) FetchEnvelopes(uids *SeqSet, pageSize int, f func(page []*MessageInfo) error) error {
+	c := s.Client
+	var found []uint32
+	var err error
+	if uids.Dynamic() {
+		us := &Session{Client: c, UID: true}
+		found, err = us.Search("UID", uids)
+	} else if !uids.Empty() {
+		found, err = s.uidSearch(uids)
+	}
+	if err != nil {
+		return err
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+	if pageSize <= 0 {
+		pageSize = 1
+	}
+	var cmds []*Command
+	for len(found) > 0 || len(cmds) > 0 {
+		if len(found) > 0 && len(cmds) < fetchWindow && err == nil {
+			var page []uint32
+			for len(found) > 0 && len(page) < pageSize {
+				if uid := found[0]; uids.Dynamic() || uids.Contains(uid) {
+					page = append(page, uid)
+				}
+				found = found[1:]
+			}
+			if len(page) > 0 {
+				cmd, e := c.UIDFetchWith(NewSeqSetNums(page), envelopeItems)
+				if err = e; err == nil {
+					cmds = append(cmds, cmd)
+				}
+			}
+			continue
+		} else if len(cmds) == 0 {
+			break
+		}
+		cmd := cmds[0]
+		cmds = cmds[1:]
+		if _, e := cmd.Result(OK); err == nil {
+			if err = e; err == nil {
+				err = f(cmd.Messages())
+			}
+		}
+	}
+	return err
+}
+
+// Store changes the flags of the specified messages and returns their new
+// flags (unless req.Silent is set).
+func (s *Session) Store(req *StoreRequest) ([]*MessageInfo, error) {
+	item := string(req.Op)
+	if item == "" {
+		item = string(StoreReplace)
+	}
+	if req.Silent {
+		item += ".SILENT"
+	}
+	flags := make([]Field, len(req.Flags))
+	for i, f := range req.Flags {
+		flags[i] = f
+	}
+	store := s.Client.Store
+	if s.UID {
+		store = s.Client.UIDStore
+	}
+	cmd, err := Wait(store(req.Seq, item, flags))
+	if err != nil {
+		return nil, err
+	}
+	return cmd.Messages(), nil
+}
+
+// MaxStoreSetLen is the maximum length of the sequence set in each STORE
+// command issued by the Session flag helpers (MarkSeen, AddKeywords, etc.).
+// Larger sets are split into multiple commands. RFC 7162 recommends that
+// clients limit command lines to 8192 octets.
+var MaxStoreSetLen = 8000
+
+// MarkSeen adds the \Seen flag to the specified messages. See StoreBatch.
+func (s *Session) MarkSeen(seq *SeqSet, silent bool) ([]*MessageInfo, error) {
+	return s.StoreBatch(&StoreRequest{seq, StoreAdd, []Flag{FlagSeen}, silent})
+}
+
+// MarkUnseen removes the \Seen flag from the specified messages. See
+// StoreBatch.
+func (s *Session) MarkUnseen(seq *SeqSet, silent bool) ([]*MessageInfo, error) {
+	return s.StoreBatch(&StoreRequest{seq, StoreRemove, []Flag{FlagSeen}, silent})
+}
+
+// MarkDeleted adds the \Deleted flag to the specified messages. The messages
+// are not removed until the mailbox is expunged. See StoreBatch.
+func (s *Session) MarkDeleted(seq *SeqSet, silent bool) ([]*MessageInfo, error) {
+	return s.StoreBatch(&StoreRequest{seq, StoreAdd, []Flag{FlagDeleted}, silent})
+}
+
+// AddKeywords adds the keywords (or other flags) to the specified messages. See
+// StoreBatch.
+func (s *Session) AddKeywords(seq *SeqSet, silent bool, kw ...Flag) ([]*MessageInfo, error) {
+	return s.StoreBatch(&StoreRequest{seq, StoreAdd, kw, silent})
+}
+
+// RemoveKeywords removes the keywords (or other flags) from the specified
+// messages. See StoreBatch.
+func (s *Session) RemoveKeywords(seq *SeqSet, silent bool, kw ...Flag) ([]*MessageInfo, error) {
+	return s.StoreBatch(&StoreRequest{seq, StoreRemove, kw, silent})
+}
+
+// StoreBatch is like Store, but it splits req.Seq into multiple STORE commands
+// if its string representation is longer than MaxStoreSetLen. The new flags of
+// all messages are returned in the order received, unless req.Silent is set.
+// If a command fails, the results of the preceding commands are returned along
+// with the error.
+func (s *Session) StoreBatch(req *StoreRequest) (msgs []*MessageInfo, err error) {
+	for _, seq := range req.Seq.Split(MaxStoreSetLen) {
+		part := *req
+		part.Seq = seq
+		var m []*MessageInfo
+		if m, err = s.Store(&part); err != nil {
+			break
+		}
+		msgs = append(msgs, m...)
+	}
+	return
+}
+
+// Copy copies the specified messages to another mailbox.
+func (s *Session) Copy(seq *SeqSet, mbox string) (*CopyResult, error) {
+	cp := s.Client.Copy
+	if s.UID {
+		cp = s.Client.UIDCopy
+	}
+	cmd, err := Wait(cp(seq, mbox))
+	if err != nil {
+		return nil, err
+	}
+	return copyResult(cmd), nil
+}
+
+// CopyMessages copies the messages with the specified UIDs to another mailbox
+// and returns the UIDs assigned to the copies, if the server supports UIDPLUS.
+// UIDs are used regardless of s.UID.
+func (s *Session) CopyMessages(uids *SeqSet, mbox string) (*CopyResult, error) {
+	return (&Session{Client: s.Client, UID: true}).Copy(uids, mbox)
+}
+
+// Move moves the specified messages to another mailbox. The MOVE extension is
+// used if available. Otherwise, the messages are copied, marked as deleted, and
+// expunged with UID EXPUNGE, which requires UIDs and the UIDPLUS extension. A
+// NotAvailableError is returned if neither method can be used, because a plain
+// EXPUNGE could remove other messages that are marked as deleted.
+func (s *Session) Move(seq *SeqSet, mbox string) (*CopyResult, error) {
+	c := s.Client
+	if c.Caps["MOVE"] {
+		move := c.Move
+		if s.UID {
+			move = c.UIDMove
+		}
+		cmd, err := Wait(move(seq, mbox))
+		if err != nil {
+			return nil, err
+		}
+		return copyResult(cmd), nil
+	} else if !s.UID || !c.Caps["UIDPLUS"] {
+		return nil, NotAvailableError("MOVE")
+	}
+	res, err := s.Copy(seq, mbox)
+	if err == nil {
+		if _, err = s.Store(&StoreRequest{seq, StoreAdd, []Flag{FlagDeleted}, true}); err == nil {
+			_, err = Wait(c.Expunge(seq))
+		}
+	}
+	return res, err
+}
+
+// MoveMessages moves the messages with the specified UIDs to another mailbox
+// and returns the mapping of source UIDs to the UIDs assigned in the
+// destination mailbox, along with the destination UIDVALIDITY. The UID MOVE
+// command is used if available, followed by UID COPY, STORE, and UID EXPUNGE
+// (see Move). If the server supports neither MOVE nor UIDPLUS, the messages are
+// copied and marked as deleted, but they are not expunged, because a plain
+// EXPUNGE could remove other messages. The mapping is nil if the server does
+// not return COPYUID information.
+func (s *Session) MoveMessages(uids *SeqSet, mbox string) (m map[uint32]uint32, uidValidity uint32, err error) {
+	us := &Session{Client: s.Client, UID: true}
+	res, err := us.Move(uids, mbox)
+	if _, ok := err.(NotAvailableError); ok {
+		if res, err = us.Copy(uids, mbox); err == nil {
+			_, err = us.Store(&StoreRequest{uids, StoreAdd, []Flag{FlagDeleted}, true})
+		}
+	}
+	if res != nil {
+		m, uidValidity = res.Mapping(), res.UIDValidity
+	}
+	return
+}
+
+// Append adds a new message to the end of the specified mailbox.
+func (s *Session) Append(req *AppendRequest) (*AppendResult, error) {
+	var flags FlagSet
+	if len(req.Flags) > 0 {
+		flags = NewFlagSet(req.Flags...)
+	}
+	var date *time.Time
+	if !req.Date.IsZero() {
+		date = &req.Date
+	}
+	cmd, err := Wait(s.Client.Append(req.Mailbox, flags, date, NewLiteral(req.Message)))
+	if err != nil {
+		return nil, err
+	}
+	return appendResult(cmd), nil
+}
+
+// AppendMessage adds a message with header h and the specified body to the end
+// of the mailbox (see FormatMessage). Use msg.Header and msg.Body to append a
+// parsed *mail.Message. If date is zero, the internal date is taken from the
+// Date header field, if it is valid.
+func (s *Session) AppendMessage(mbox string, flags []Flag, date time.Time, h mail.Header, body io.Reader) (*AppendResult, error) {
+	b, err := FormatMessage(h, body)
+	if err != nil {
+		return nil, err
+	}
+	if date.IsZero() {
+		date, _ = h.Date()
+	}
+	return s.Append(&AppendRequest{Mailbox: mbox, Flags: flags, Date: date, Message: b})
+}
+
+// Expunge permanently removes messages that are marked as deleted and returns
+// the sequence numbers of the expunged messages, in the order reported by the
+// server. See Client.Expunge.
+func (s *Session) Expunge(uids *SeqSet) ([]uint32, error) {
+	cmd, err := Wait(s.Client.Expunge(uids))
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint32
+	for _, rsp := range cmd.Data {
+		if rsp.Label == "EXPUNGE" {
+			seqs = append(seqs, rsp.Value())
+		}
+	}
+	return seqs, nil
+}
+
+// ExpungeUIDs permanently removes the messages with the specified UIDs that are
+// marked as deleted, leaving all other deleted messages in place, and returns
+// the sequence numbers of the expunged messages. It requires UID EXPUNGE, which
+// is provided by the UIDPLUS extension. NotAvailableError("UIDPLUS") is
+// returned if the server does not support it, instead of falling back to a
+// plain EXPUNGE. An empty set is an error for the same reason.
+func (s *Session) ExpungeUIDs(uids *SeqSet) ([]uint32, error) {
+	if uids == nil || uids.Empty() {
+		return nil, SeqSetError("")
+	} else if !s.Client.Caps["UIDPLUS"] {
+		return nil, NotAvailableError("UIDPLUS")
+	}
+	return s.Expunge(uids)
+}
+
+// copyResult extracts the COPYUID response code from the data or completion
+// response of a COPY or MOVE command.
+func copyResult(cmd *Command) *CopyResult {
+	res := new(CopyResult)
+	for _, rsp := range append(cmd.Data, cmd.result) {
+		if rsp.Label == "COPYUID" && len(rsp.Fields) == 4 {
+			res.UIDValidity = AsNumber(rsp.Fields[1])
+			res.SrcUIDs = asSeqSet(rsp.Fields[2])
+			res.DstUIDs = asSeqSet(rsp.Fields[3])
+			res.Pairs = pairUIDs(rsp.Fields[2], rsp.Fields[3])
+		}
+	}
+	return res
+}
+
+// pairUIDs matches the UIDs of the source and destination sets of a COPYUID
+// response code. RFC 4315 specifies that the sets correspond positionally, so
+// each set is expanded in the order sent by the server, with ranges expanded in
+// ascending order (e.g. "5,1:2" becomes 5, 1, 2). Nil is returned if either set
+// is invalid or the sets have different sizes.
+func pairUIDs(src, dst Field) []UIDPair {
+	s, d := expandUIDSet(src), expandUIDSet(dst)
+	if len(s) == 0 || len(s) != len(d) {
+		return nil
+	}
+	pairs := make([]UIDPair, len(s))
+	for i := range s {
+		pairs[i] = UIDPair{s[i], d[i]}
+	}
+	return pairs
+}
+
+// expandUIDSet returns all UIDs in a uid-set field without sorting or removing
+// duplicates. Nil is returned if the set is invalid, contains "*", or has more
+// than maxCopyUIDs values.
+func expandUIDSet(f Field) []uint32 {
+	set := AsAtom(f)
+	if n, ok := f.(uint32); ok {
+		set = strconv.FormatUint(uint64(n), 10)
+	}
+	var uids []uint32
+	for _, v := range strings.Split(set, ",") {
+		r, err := parseSeq(v)
+		if err != nil || r.start == 0 || r.stop == 0 ||
+			len(uids)+int(r.stop-r.start) >= maxCopyUIDs {
+			return nil
+		}
+		for uid := r.start; ; uid++ {
+			uids = append(uids, uid)
+			if uid == r.stop {
+				break
+			}
+		}
+	}
+	return uids
+}
+
+// asSeqSet converts a sequence set field, which is either a number or an atom,
+// to a SeqSet. Nil is returned if the set is invalid.
+func asSeqSet(f Field) *SeqSet {
+	set := AsAtom(f)
+	if n, ok := f.(uint32); ok {
+		set = strconv.FormatUint(uint64(n), 10)
+	}
+	s, err := NewSeqSet(set)
+	if err != nil {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,425 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"net/mail"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionCommands(T *testing.T) {
+	//defer un(setLogMask(LogAll))
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 UIDPLUS] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	// LIST
+	go t.script(
+		`C: A1 LIST "" "%"`+CRLF,
+		`S: * LIST (\HasNoChildren) "/" INBOX`+CRLF,
+		`S: * LIST (\Noselect) "/" Archive`+CRLF,
+		`S: A1 OK LIST completed`+CRLF,
+	)
+	list, err := S.List("", "%")
+	t.join("LIST", err)
+	if len(list) != 2 || list[0].Name != "INBOX" || list[1].Name != "Archive" {
+		t.Errorf("List() unexpected result %v", list)
+	}
+
+	// STATUS
+	go t.script(
+		`C: A2 STATUS "Archive" (MESSAGES RECENT UIDNEXT UIDVALIDITY UNSEEN)`+CRLF,
+		`S: * STATUS Archive (MESSAGES 5 RECENT 0 UIDNEXT 10 UIDVALIDITY 1 UNSEEN 2)`+CRLF,
+		`S: A2 OK STATUS completed`+CRLF,
+	)
+	status, err := S.Status("Archive")
+	t.join("STATUS", err)
+	want := &MailboxStatus{Name: "Archive", Messages: 5, UIDNext: 10, UIDValidity: 1, Unseen: 2}
+	if !reflect.DeepEqual(status, want) {
+		t.Errorf("Status() expected %v; got %v", want, status)
+	}
+
+	// SELECT
+	go t.script(
+		`C: A3 SELECT "INBOX"`+CRLF,
+		`S: * FLAGS (\Seen \Deleted)`+CRLF,
+		`S: * 3 EXISTS`+CRLF,
+		`S: A3 OK [READ-WRITE] SELECT completed`+CRLF,
+	)
+	status, err = S.Select("INBOX", false)
+	t.join("SELECT", err)
+	if status == nil || status.Messages != 3 || status == C.Mailbox {
+		t.Errorf("Select() unexpected result %v", status)
+	}
+
+	// UID SEARCH
+	S.UID = true
+	go t.script(
+		`C: A4 UID SEARCH UNSEEN`+CRLF,
+		`S: * SEARCH 7 9`+CRLF,
+		`S: A4 OK SEARCH completed`+CRLF,
+	)
+	ids, err := S.Search("UNSEEN")
+	t.join("SEARCH", err)
+	if !reflect.DeepEqual(ids, []uint32{7, 9}) {
+		t.Errorf("Search() expected [7 9]; got %v", ids)
+	}
+
+	// UID FETCH
+	go t.script(
+		`C: A5 UID FETCH 7,9 (FLAGS)`+CRLF,
+		`S: * 2 FETCH (UID 7 FLAGS ())`+CRLF,
+		`S: * 3 FETCH (UID 9 FLAGS (\Seen))`+CRLF,
+		`S: A5 OK FETCH completed`+CRLF,
+	)
+	msgs, err := S.Fetch(newSeqSet("7,9"), "FLAGS")
+	t.join("FETCH", err)
+	if len(msgs) != 2 || msgs[1].UID != 9 || !msgs[1].Flags.Has(FlagSeen) {
+		t.Errorf("Fetch() unexpected result %v", msgs)
+	}
+
+	// UID STORE
+	go t.script(
+		`C: A6 UID STORE 7 +FLAGS (\Seen $Important)`+CRLF,
+		`S: * 2 FETCH (UID 7 FLAGS (\Seen $Important))`+CRLF,
+		`S: A6 OK STORE completed`+CRLF,
+	)
+	msgs, err = S.Store(&StoreRequest{Seq: newSeqSet("7"), Op: StoreAdd, Flags: []Flag{FlagSeen, "$Important"}})
+	t.join("STORE", err)
+	if len(msgs) != 1 || !msgs[0].Flags.Has("$Important") {
+		t.Errorf("Store() unexpected result %v", msgs)
+	}
+
+	// UID COPY
+	go t.script(
+		`C: A7 UID COPY 7,9 "Archive"`+CRLF,
+		`S: A7 OK [COPYUID 1 7,9 10:11] COPY completed`+CRLF,
+	)
+	res, err := S.Copy(newSeqSet("7,9"), "Archive")
+	t.join("COPY", err)
+	if res.UIDValidity != 1 || res.SrcUIDs.String() != "7,9" || res.DstUIDs.String() != "10:11" {
+		t.Errorf("Copy() unexpected result %+v", res)
+	}
+
+	// MOVE emulation with UIDPLUS
+	go t.script(
+		`C: A8 UID COPY 9 "Archive"`+CRLF,
+		`S: A8 OK [COPYUID 1 9 12] COPY completed`+CRLF,
+		`C: A9 UID STORE 9 +FLAGS.SILENT (\Deleted)`+CRLF,
+		`S: A9 OK STORE completed`+CRLF,
+		`C: A10 UID EXPUNGE 9`+CRLF,
+		`S: * 3 EXPUNGE`+CRLF,
+		`S: A10 OK EXPUNGE completed`+CRLF,
+	)
+	res, err = S.Move(newSeqSet("9"), "Archive")
+	t.join("MOVE", err)
+	if res == nil || res.DstUIDs.String() != "12" {
+		t.Errorf("Move() unexpected result %+v", res)
+	}
+
+	// APPEND
+	go t.script(
+		`C: A11 APPEND "Archive" (\Seen) " 1-Feb-2013 10:00:00 +0000" {5}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		`C: hello`+CRLF,
+		`S: A11 OK [APPENDUID 1 13] APPEND completed`+CRLF,
+		EOF,
+	)
+	ares, err := S.Append(&AppendRequest{
+		Mailbox: "Archive",
+		Flags:   []Flag{FlagSeen},
+		Date:    time.Date(2013, time.February, 1, 10, 0, 0, 0, time.UTC),
+		Message: []byte("hello"),
+	})
+	t.join("APPEND", err)
+	if !reflect.DeepEqual(ares, &AppendResult{1, 13}) {
+		t.Errorf("Append() unexpected result %+v", ares)
+	}
+	t.waitEOF()
+}
+
+func TestSessionAppendMessage(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 UIDPLUS] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	h := mail.Header{"Date": {"Fri, 1 Feb 2013 10:00:00 +0000"}, "Subject": {"Hi"}}
+	go t.script(
+		`C: A1 APPEND "Drafts" (\Draft) " 1-Feb-2013 10:00:00 +0000" {60}`+CRLF,
+		`S: + Ready for literal data`+CRLF,
+		`C: Date: Fri, 1 Feb 2013 10:00:00 +0000`+CRLF,
+		`C: Subject: Hi`+CRLF,
+		`C: `+CRLF,
+		`C: hello`+CRLF,
+		`C: `+CRLF,
+		`S: A1 OK [APPENDUID 1 14] APPEND completed`+CRLF,
+	)
+	res, err := S.AppendMessage("Drafts", []Flag{FlagDraft}, time.Time{}, h, strings.NewReader("hello\n"))
+	t.join("APPEND", err)
+	if !reflect.DeepEqual(res, &AppendResult{1, 14}) {
+		t.Errorf("AppendMessage() unexpected result %+v", res)
+	}
+}
+
+func TestSessionStoreBatch(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+	S.UID = true
+	defer func(n int) { MaxStoreSetLen = n }(MaxStoreSetLen)
+	MaxStoreSetLen = 5
+
+	go t.script(
+		`C: A1 UID STORE 1,3,5 +FLAGS (\Seen)`+CRLF,
+		`S: * 1 FETCH (UID 1 FLAGS (\Seen))`+CRLF,
+		`S: A1 OK STORE completed`+CRLF,
+		`C: A2 UID STORE 7:9 +FLAGS (\Seen)`+CRLF,
+		`S: * 4 FETCH (UID 7 FLAGS (\Seen))`+CRLF,
+		`S: A2 OK STORE completed`+CRLF,
+	)
+	msgs, err := S.MarkSeen(newSeqSet("1,3,5,7:9"), false)
+	t.join("STORE", err)
+	if len(msgs) != 2 || msgs[0].UID != 1 || msgs[1].UID != 7 {
+		t.Errorf("MarkSeen() unexpected result %v", msgs)
+	}
+
+	go t.script(
+		`C: A3 UID STORE 2 -FLAGS.SILENT ($Work)`+CRLF,
+		`S: A3 OK STORE completed`+CRLF,
+	)
+	_, err = S.RemoveKeywords(newSeqSet("2"), true, "$Work")
+	t.join("STORE", err)
+
+	go t.script(
+		`C: A4 UID STORE 1,3 +FLAGS.SILENT (\Deleted)`+CRLF,
+		`S: A4 NO Permission denied`+CRLF,
+	)
+	if _, err = S.MarkDeleted(newSeqSet("1,3,10"), true); err == nil {
+		t.Errorf("MarkDeleted() expected an error")
+	}
+	t.join("STORE", nil)
+}
+
+func TestSessionMoveMessages(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 MOVE UIDPLUS] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 UID MOVE 4:5,9 "Archive"`+CRLF,
+		`S: * OK [COPYUID 7 4:5,9 20:22] Moved`+CRLF,
+		`S: * 2 EXPUNGE`+CRLF,
+		`S: * 2 EXPUNGE`+CRLF,
+		`S: * 4 EXPUNGE`+CRLF,
+		`S: A1 OK MOVE completed`+CRLF,
+	)
+	m, uv, err := S.MoveMessages(newSeqSet("4:5,9"), "Archive")
+	t.join("MOVE", err)
+	if want := map[uint32]uint32{4: 20, 5: 21, 9: 22}; !reflect.DeepEqual(m, want) || uv != 7 {
+		t.Errorf("MoveMessages() expected %v (7); got %v (%d)", want, m, uv)
+	}
+
+	C.setCaps([]Field{"IMAP4rev1"})
+	go t.script(
+		`C: A2 UID COPY 3 "Archive"`+CRLF,
+		`S: A2 OK COPY completed`+CRLF,
+		`C: A3 UID STORE 3 +FLAGS.SILENT (\Deleted)`+CRLF,
+		`S: A3 OK STORE completed`+CRLF,
+	)
+	m, uv, err = S.MoveMessages(newSeqSet("3"), "Archive")
+	t.join("MOVE", err)
+	if m != nil || uv != 0 {
+		t.Errorf("MoveMessages() expected no mapping; got %v (%d)", m, uv)
+	}
+}
+
+func TestSessionCopyMessages(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 UIDPLUS] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 UID COPY 1:2,5 "Archive"`+CRLF,
+		`S: A1 OK [COPYUID 3 5,1:2 30,41:40] COPY completed`+CRLF,
+	)
+	res, err := S.CopyMessages(newSeqSet("1:2,5"), "Archive")
+	t.join("COPY", err)
+	want := []UIDPair{{5, 30}, {1, 40}, {2, 41}}
+	if res.UIDValidity != 3 || !reflect.DeepEqual(res.Pairs, want) {
+		t.Errorf("CopyMessages() expected pairs %v; got %+v", want, res)
+	}
+	if m := res.Mapping(); !reflect.DeepEqual(m, map[uint32]uint32{1: 40, 2: 41, 5: 30}) {
+		t.Errorf("Mapping() unexpected result %v", m)
+	}
+
+	tests := []struct {
+		src, dst Field
+		out      []UIDPair
+	}{
+		{uint32(7), uint32(9), []UIDPair{{7, 9}}},
+		{"1:3", "4,6", nil},
+		{"1:*", "4:6", nil},
+		{"", "", nil},
+		{"1:2000000", "1:2000000", nil},
+	}
+	for _, test := range tests {
+		if out := pairUIDs(test.src, test.dst); !reflect.DeepEqual(out, test.out) {
+			t.Errorf("pairUIDs(%v, %v) expected %v; got %v", test.src, test.dst, test.out, out)
+		}
+	}
+}
+
+func TestSessionExpungeUIDs(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 UIDPLUS] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 UID EXPUNGE 4,8`+CRLF,
+		`S: * 2 EXPUNGE`+CRLF,
+		`S: * 5 EXPUNGE`+CRLF,
+		`S: A1 OK EXPUNGE completed`+CRLF,
+	)
+	seqs, err := S.ExpungeUIDs(newSeqSet("4,8"))
+	t.join("EXPUNGE", err)
+	if !reflect.DeepEqual(seqs, []uint32{2, 5}) {
+		t.Errorf("ExpungeUIDs() unexpected result %v", seqs)
+	}
+
+	if _, err = S.ExpungeUIDs(nil); err == nil {
+		t.Errorf("ExpungeUIDs(nil) expected an error")
+	}
+	C.setCaps([]Field{"IMAP4rev1"})
+	if _, err = S.ExpungeUIDs(newSeqSet("4")); err != NotAvailableError("UIDPLUS") {
+		t.Errorf("ExpungeUIDs() expected NotAvailableError; got %v", err)
+	}
+}
+
+func TestSessionFetchHeaders(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 UID FETCH 1:3 (BODY.PEEK[HEADER.FIELDS (From Subject)])`+CRLF,
+		`S: * 1 FETCH (UID 1 BODY[HEADER.FIELDS ("FROM" "SUBJECT")] {44}`+CRLF,
+		`S: From: a@example.com`+CRLF,
+		`S: Subject: Hi`+CRLF,
+		`S:  there`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 2 FETCH (UID 3 BODY[HEADER.FIELDS (FROM SUBJECT)] {2}`+CRLF,
+		`S: `+CRLF,
+		`S: )`+CRLF,
+		`S: * 3 FETCH (FLAGS (\Seen))`+CRLF,
+		`S: A1 OK FETCH completed`+CRLF,
+	)
+	hdrs, err := S.FetchHeaders(newSeqSet("1:3"), "From", "Subject")
+	t.join("FETCH", err)
+	want := map[uint32]textproto.MIMEHeader{
+		1: {"From": {"a@example.com"}, "Subject": {"Hi there"}},
+	}
+	if !reflect.DeepEqual(hdrs, want) {
+		t.Errorf("FetchHeaders() expected %v; got %v", want, hdrs)
+	}
+}
+
+func TestSessionFetchEnvelopes(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 UID SEARCH UID 1:*`+CRLF,
+		`S: * SEARCH 5 1 4 2`+CRLF,
+		`S: A1 OK SEARCH completed`+CRLF,
+		`C: A2 UID FETCH 1:2 (FLAGS INTERNALDATE RFC822.SIZE ENVELOPE)`+CRLF,
+		`C: A3 UID FETCH 4:5 (FLAGS INTERNALDATE RFC822.SIZE ENVELOPE)`+CRLF,
+		`S: * 1 FETCH (UID 1 FLAGS ())`+CRLF,
+		`S: * 2 FETCH (UID 2 FLAGS ())`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+		`S: * 3 FETCH (UID 4 FLAGS ())`+CRLF,
+		`S: * 4 FETCH (UID 5 FLAGS ())`+CRLF,
+		`S: A3 OK FETCH completed`+CRLF,
+	)
+	var pages [][]uint32
+	err := S.FetchEnvelopes(newSeqSet("1:*"), 2, func(page []*MessageInfo) error {
+		var uids []uint32
+		for _, msg := range page {
+			uids = append(uids, msg.UID)
+		}
+		pages = append(pages, uids)
+		return nil
+	})
+	t.join("FETCH", err)
+	if want := [][]uint32{{1, 2}, {4, 5}}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("FetchEnvelopes() expected pages %v; got %v", want, pages)
+	}
+
+	// Gaps in a sparse mailbox are skipped
+	go t.script(
+		`C: A4 UID SEARCH UID 1:100000`+CRLF,
+		`S: * SEARCH 3 100000`+CRLF,
+		`S: A4 OK SEARCH completed`+CRLF,
+		`C: A5 UID FETCH 3,100000 (FLAGS INTERNALDATE RFC822.SIZE ENVELOPE)`+CRLF,
+		`S: A5 OK FETCH completed`+CRLF,
+	)
+	n := 0
+	err = S.FetchEnvelopes(newSeqSet("1:100000"), 10, func([]*MessageInfo) error {
+		n++
+		return nil
+	})
+	t.join("FETCH", err)
+	if n != 1 {
+		t.Errorf("FetchEnvelopes() expected 1 page; got %d", n)
+	}
+
+	stop := errors.New("stop")
+	go t.script(
+		`C: A6 UID SEARCH UID 7,9`+CRLF,
+		`S: * SEARCH 7 9`+CRLF,
+		`S: A6 OK SEARCH completed`+CRLF,
+		`C: A7 UID FETCH 7 (FLAGS INTERNALDATE RFC822.SIZE ENVELOPE)`+CRLF,
+		`C: A8 UID FETCH 9 (FLAGS INTERNALDATE RFC822.SIZE ENVELOPE)`+CRLF,
+		`S: A7 OK FETCH completed`+CRLF,
+		`S: A8 OK FETCH completed`+CRLF,
+	)
+	n = 0
+	err = S.FetchEnvelopes(newSeqSet("7,9"), 1, func([]*MessageInfo) error {
+		n++
+		return stop
+	})
+	t.join("FETCH", nil)
+	if err != stop || n != 1 {
+		t.Errorf("FetchEnvelopes() expected stop after 1 page; got %v (%d)", err, n)
+	}
+}
+
+func TestSessionSelectNotSelected(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	// Simulate a mailbox status reset during the command
+	C.SetHandler("EXISTS", func(*Response) { C.Mailbox = nil })
+	go t.script(
+		`C: A1 SELECT "INBOX"`+CRLF,
+		`S: * 3 EXISTS`+CRLF,
+		`S: A1 OK [READ-WRITE] SELECT completed`+CRLF,
+	)
+	status, err := S.Select("INBOX", false)
+	t.join("SELECT", nil)
+	if status != nil || err != ErrNotSelected {
+		t.Errorf("Select() expected ErrNotSelected; got %v (%v)", status, err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "strings"
+
+// SpecialUseMatch is the mailbox selected for a special-use role.
+type SpecialUseMatch struct {
+	Mailbox    *MailboxInfo         // Selected mailbox
+	Confidence SpecialUseConfidence // How the mailbox was selected
+}
+
+// SpecialUseNames contains the lower case mailbox names, in order of
+// preference, that identify special-use mailboxes when the server does not
+// advertise them with SPECIAL-USE (RFC 6154) or XLIST attributes. Applications
+// may add names for other languages or clients before calling
+// ResolveSpecialUse.
+var SpecialUseNames = map[MailboxAttr][]string{
+	AttrSent: {
+		"sent", "sent items", "sent mail", "sent messages",
+		"gesendet", "gesendete objekte", "gesendete elemente",
+		"envoyés", "éléments envoyés", "messages envoyés",
+		"enviados", "elementos enviados", "itens enviados",
+		"inviata", "posta inviata", "elementi inviati",
+		"verzonden", "verzonden items", "skickat", "skickade objekt",
+		"sendt", "sendte elementer", "lähetetyt", "wysłane", "odeslané",
+		"отправленные", "送信済み", "已发送", "已傳送", "보낸편지함",
+	},
+	AttrTrash: {
+		"trash", "deleted items", "deleted messages", "deleted", "bin",
+		"papierkorb", "gelöschte objekte", "gelöschte elemente",
+		"corbeille", "éléments supprimés",
+		"papelera", "elementos eliminados", "lixeira", "itens excluídos",
+		"cestino", "posta eliminata", "elementi eliminati",
+		"prullenbak", "verwijderde items", "papperskorgen", "borttaget",
+		"slettet", "slettede elementer", "roskakori", "kosz", "koš",
+		"корзина", "ゴミ箱", "已删除", "垃圾桶", "휴지통",
+	},
+	AttrDrafts: {
+		"drafts", "draft", "entwürfe", "brouillons", "borradores",
+		"rascunhos", "bozze", "concepten", "utkast", "kladder",
+		"luonnokset", "wersje robocze", "koncepty", "черновики",
+		"下書き", "草稿", "임시보관함",
+	},
+	AttrJunk: {
+		"junk", "junk e-mail", "junk email", "junk mail", "spam", "bulk mail",
+		"junk-e-mail", "spam-verdacht", "courrier indésirable", "indésirables",
+		"correo no deseado", "lixo eletrônico", "posta indesiderata",
+		"ongewenste e-mail", "skräppost", "søppelpost", "uønsket e-post",
+		"roskaposti", "nevyžádaná pošta", "спам", "迷惑メール", "垃圾邮件",
+		"스팸",
+	},
+	AttrArchive: {
+		"archive", "archives", "archived", "archiv", "archivo", "arquivo",
+		"archivio", "archief", "arkiv", "arkisto", "archiwum", "архив",
+		"アーカイブ", "归档", "보관함",
+	},
+}
+
+// specialUseParents are the lower case top-level mailbox names under which
+// some servers place special-use mailboxes (e.g. "INBOX.Sent" on Courier or
+// "[Gmail]/Sent Mail").
+var specialUseParents = map[string]bool{
+	"inbox": true, "[gmail]": true, "[google mail]": true,
+}
+
+// ResolveSpecialUse identifies the mailboxes in list that serve the special-use
+// roles AttrAll, AttrArchive, AttrDrafts, AttrFlagged, AttrJunk, AttrSent,
+// AttrTrash, and AttrImportant. Mailboxes with special-use attributes are
+// always preferred. Otherwise, the Sent, Trash, Drafts, Junk, and Archive roles
+// are assigned by matching the last component of each mailbox name against
+// SpecialUseNames without regard to case. Mailboxes at the top level of the
+// hierarchy, or directly under INBOX or "[Gmail]", are preferred to those that
+// are nested more deeply, followed by names that appear earlier in the table.
+// Mailboxes that cannot be selected are ignored. Roles without a match are
+// omitted from the returned map.
+func ResolveSpecialUse(list []*MailboxInfo) map[MailboxAttr]SpecialUseMatch {
+	type candidate struct {
+		SpecialUseMatch
+		rank int
+	}
+	best := make(map[MailboxAttr]candidate)
+	offer := func(role MailboxAttr, c candidate) {
+		if b, ok := best[role]; !ok || c.Confidence > b.Confidence ||
+			(c.Confidence == b.Confidence && c.rank < b.rank) {
+			best[role] = c
+		}
+	}
+	for _, info := range list {
+		if info.Attr&(AttrNoselect|AttrNonExistent) != 0 {
+			continue
+		}
+		for role := AttrAll; role&AttrSpecialUse != 0; role <<= 1 {
+			if info.Attr&role != 0 {
+				offer(role, candidate{SpecialUseMatch{info, GuessAttr}, 0})
+			}
+		}
+		parts := SplitMailboxPath(info.Name, info.Delim)
+		if len(parts) > 1 && specialUseParents[strings.ToLower(parts[0])] {
+			parts = parts[1:]
+		}
+		if len(parts) == 0 || parts[0] == "INBOX" {
+			continue
+		}
+		conf := GuessName
+		if len(parts) > 1 {
+			conf = GuessNested
+		}
+		name := strings.ToLower(strings.TrimSpace(parts[len(parts)-1]))
+		for role, names := range SpecialUseNames {
+			for i, n := range names {
+				if n == name {
+					offer(role, candidate{SpecialUseMatch{info, conf}, i})
+					break
+				}
+			}
+		}
+	}
+	out := make(map[MailboxAttr]SpecialUseMatch, len(best))
+	for role, c := range best {
+		out[role] = c.SpecialUseMatch
+	}
+	return out
+}
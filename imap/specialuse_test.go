@@ -0,0 +1,61 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "testing"
+
+func TestResolveSpecialUse(t *testing.T) {
+	mbox := func(name, delim string, attrs ...Flag) *MailboxInfo {
+		fs := NewFlagSet(attrs...)
+		return &MailboxInfo{Attrs: fs, Attr: MailboxAttrs(fs), Delim: delim, Name: name}
+	}
+	tests := []struct {
+		list []*MailboxInfo
+		want map[MailboxAttr]SpecialUseMatch
+	}{
+		// Localized names, INBOX namespace, nesting, and table order
+		{
+			[]*MailboxInfo{
+				mbox("INBOX", "."),
+				mbox("INBOX.Gesendete Objekte", "."),
+				mbox("INBOX.Gesendet", "."),
+				mbox("INBOX.Projekte.Papierkorb", "."),
+				mbox("INBOX.Entwürfe", ".", `\Noselect`),
+				mbox("Spam", "."),
+			},
+			map[MailboxAttr]SpecialUseMatch{},
+		},
+		// Attributes override names (XLIST and SPECIAL-USE)
+		{
+			[]*MailboxInfo{
+				mbox("Trash", "/"),
+				mbox("[Gmail]/Bin", "/", `\Trash`),
+				mbox("[Gmail]/Spam", "/", `\Spam`),
+				mbox("[Gmail]/All Mail", "/", `\Allmail`),
+				mbox("Sent", "/"),
+			},
+			map[MailboxAttr]SpecialUseMatch{},
+		},
+	}
+	tests[0].want[AttrSent] = SpecialUseMatch{tests[0].list[2], GuessName}
+	tests[0].want[AttrTrash] = SpecialUseMatch{tests[0].list[3], GuessNested}
+	tests[0].want[AttrJunk] = SpecialUseMatch{tests[0].list[5], GuessName}
+	tests[1].want[AttrTrash] = SpecialUseMatch{tests[1].list[1], GuessAttr}
+	tests[1].want[AttrJunk] = SpecialUseMatch{tests[1].list[2], GuessAttr}
+	tests[1].want[AttrAll] = SpecialUseMatch{tests[1].list[3], GuessAttr}
+	tests[1].want[AttrSent] = SpecialUseMatch{tests[1].list[4], GuessName}
+
+	for i, test := range tests {
+		out := ResolveSpecialUse(test.list)
+		if len(out) != len(test.want) {
+			t.Errorf("ResolveSpecialUse(%d) expected %d roles; got %v", i, len(test.want), out)
+		}
+		for role, want := range test.want {
+			if got := out[role]; got != want {
+				t.Errorf("ResolveSpecialUse(%d) %v expected %q (%v); got %+v", i, role, want.Mailbox.Name, want.Confidence, got)
+			}
+		}
+	}
+}
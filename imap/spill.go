@@ -0,0 +1,124 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+)
+
+// DefaultSpillThreshold is the size of the largest literal that SpillReader
+// keeps in memory if its Threshold is 0.
+const DefaultSpillThreshold = 1 << 20
+
+// SpillReader implements the LiteralReader interface by saving literals that
+// are larger than Threshold bytes to temporary files. Smaller literals are
+// saved to memory, as with MemoryReader. This limits the memory used by large
+// FETCH responses (e.g. a few messages with big attachments) without changing
+// how the responses are processed. Use Client.SetLiteralReader to install it.
+//
+// Large literals are returned as *FileLiteral values, which can be read with
+// FileLiteral.Reader without loading the file into memory. AsBytes and AsString
+// still work, but they read the entire file into memory. The files are removed
+// when the literals are released with ReleaseLiteral or
+// Response.ReleaseLiterals, or when they and all of their readers are garbage
+// collected.
+type SpillReader struct {
+	Threshold uint32 // Largest literal kept in memory (DefaultSpillThreshold if 0)
+	Dir       string // Directory for the files (os.TempDir if empty)
+}
+
+// ReadLiteral saves the literal to memory or to a new temporary file. If the
+// file cannot be written, the rest of the literal is discarded and the error is
+// returned.
+func (sr *SpillReader) ReadLiteral(r io.Reader, i LiteralInfo) (Literal, error) {
+	threshold := sr.Threshold
+	if threshold == 0 {
+		threshold = DefaultSpillThreshold
+	}
+	if i.Len <= threshold {
+		return MemoryReader{}.ReadLiteral(r, i)
+	}
+	f, err := ioutil.TempFile(sr.Dir, "imap-literal-")
+	if err == nil {
+		var n int64
+		if n, err = io.Copy(f, r); err == nil && n < int64(i.Len) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			return newFileLiteral(f, i), nil
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+	io.Copy(ioutil.Discard, r)
+	return &literal{info: i}, err
+}
+
+// FileLiteral is an incoming literal that was saved to a temporary file by
+// SpillReader. It has no read offset of its own, so all methods may be called
+// at any time.
+type FileLiteral struct {
+	f    *os.File
+	info LiteralInfo
+}
+
+// newFileLiteral returns a FileLiteral that reads the literal from f.
+func newFileLiteral(f *os.File, i LiteralInfo) *FileLiteral {
+	l := &FileLiteral{f, i}
+	runtime.SetFinalizer(l, (*FileLiteral).Close)
+	return l
+}
+
+// Reader returns a new reader for the literal data. Each reader has its own
+// offset, which is not shared with other readers or with WriteTo. The reader
+// refers to l, so the file is not removed by the finalizer while it is in use.
+func (l *FileLiteral) Reader() *io.SectionReader {
+	return io.NewSectionReader(l, 0, int64(l.info.Len))
+}
+
+// ReadAt implements the io.ReaderAt interface.
+func (l *FileLiteral) ReadAt(p []byte, off int64) (n int, err error) {
+	if off >= int64(l.info.Len) {
+		return 0, io.EOF
+	} else if max := int64(l.info.Len) - off; int64(len(p)) > max {
+		p = p[:max]
+		defer func() {
+			if err == nil {
+				err = io.EOF
+			}
+		}()
+	}
+	n, err = l.f.ReadAt(p, off)
+	runtime.KeepAlive(l)
+	return
+}
+
+// WriteTo writes the entire literal to w.
+func (l *FileLiteral) WriteTo(w io.Writer) (n int64, err error) {
+	return io.Copy(w, l.Reader())
+}
+
+func (l *FileLiteral) Info() LiteralInfo {
+	return l.info
+}
+
+// Name returns the name of the temporary file.
+func (l *FileLiteral) Name() string {
+	return l.f.Name()
+}
+
+// Close closes and removes the temporary file. The literal cannot be read
+// afterwards.
+func (l *FileLiteral) Close() error {
+	runtime.SetFinalizer(l, nil)
+	err := l.f.Close()
+	if rerr := os.Remove(l.f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
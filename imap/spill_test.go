@@ -0,0 +1,107 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSpillReader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "imap-spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sr := &SpillReader{Threshold: 4, Dir: dir}
+
+	c, s := newTestConn(1024)
+	r := newReader(newTransport(c, nil), sr, "A")
+	s.Write([]byte("* 1 FETCH (BODY[HEADER] {4}" + CRLF + "a\r\nb BODY[] {11}" + CRLF + "hello world)" + CRLF))
+	raw, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next() unexpected error; %v", err)
+	}
+	rsp, err := raw.Parse()
+	if err != nil {
+		t.Fatalf("Parse() unexpected error; %v", err)
+	}
+	kv := AsFieldMap(rsp.Fields[2])
+	if _, ok := kv["BODY[HEADER]"].(*FileLiteral); ok || AsString(kv["BODY[HEADER]"]) != "a\r\nb" {
+		t.Errorf("BODY[HEADER] expected a memory literal; got %#v", kv["BODY[HEADER]"])
+	}
+	l, ok := kv["BODY[]"].(*FileLiteral)
+	if !ok {
+		t.Fatalf("BODY[] expected *FileLiteral; got %#v", kv["BODY[]"])
+	}
+
+	// Read, seek, and copy the data
+	rs := l.Reader()
+	rs.Seek(6, io.SeekStart)
+	if b, err := ioutil.ReadAll(rs); string(b) != "world" || err != nil {
+		t.Errorf("ReadAll() expected \"world\"; got %q (%v)", b, err)
+	}
+	if b, err := ioutil.ReadAll(io.LimitReader(l.Reader(), 5)); string(b) != "hello" || err != nil {
+		t.Errorf("Reader() expected \"hello\"; got %q (%v)", b, err)
+	}
+	p := make([]byte, 3)
+	if n, err := l.ReadAt(p, 4); string(p[:n]) != "o w" || err != nil {
+		t.Errorf("ReadAt() expected \"o w\"; got %q (%v)", p[:n], err)
+	}
+	var buf bytes.Buffer
+	if n, err := l.WriteTo(&buf); n != 11 || buf.String() != "hello world" || err != nil {
+		t.Errorf("WriteTo() expected \"hello world\"; got %q (%v)", buf.String(), err)
+	}
+	if s := AsString(l); s != "hello world" {
+		t.Errorf("AsString() expected \"hello world\"; got %q", s)
+	}
+
+	// Release removes the file
+	name := l.Name()
+	if _, err := os.Stat(name); err != nil {
+		t.Fatalf("Stat(%q) unexpected error; %v", name, err)
+	}
+	rsp.ReleaseLiterals()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("ReleaseLiterals() did not remove %q", name)
+	}
+
+	// Readers keep the literal alive after all other references are dropped
+	l = newFileLiteral(mustTempFile(t, dir, "hello world"), LiteralInfo{Len: 11})
+	rs, name = l.Reader(), l.Name()
+	l = nil
+	runtime.GC()
+	runtime.GC()
+	if b, err := ioutil.ReadAll(rs); string(b) != "hello world" || err != nil {
+		t.Errorf("ReadAll() expected \"hello world\"; got %q (%v)", b, err)
+	}
+	os.Remove(name)
+
+	// Short read
+	lit, err := sr.ReadLiteral(strings.NewReader("abcdef"), LiteralInfo{Len: 10})
+	if lit == nil || err != io.ErrUnexpectedEOF {
+		t.Errorf("ReadLiteral() expected io.ErrUnexpectedEOF; got %v, %v", lit, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("ReadLiteral() left %d temporary files", len(files))
+	}
+}
+
+// mustTempFile returns a new temporary file in dir containing data.
+func mustTempFile(t *testing.T, dir, data string) *os.File {
+	f, err := ioutil.TempFile(dir, "imap-literal-")
+	if err == nil {
+		_, err = f.WriteString(data)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
@@ -0,0 +1,152 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "sync"
+
+// statusWindow is the maximum number of STATUS commands that StatusMany keeps
+// in progress on each connection.
+const statusWindow = 8
+
+// statusItems are the STATUS data items requested by default.
+var statusItems = []string{"MESSAGES", "RECENT", "UIDNEXT", "UIDVALIDITY", "UNSEEN"}
+
+// StatusMany returns the status of the specified mailboxes, keyed by name. The
+// MESSAGES, RECENT, UIDNEXT, UIDVALIDITY, and UNSEEN items are requested if no
+// items are specified. If the first client supports LIST-STATUS (RFC 5819), the
+// status of all mailboxes is requested with a single LIST command first.
+// Otherwise (and for any mailboxes missing from the LIST response), the
+// mailboxes are distributed among the clients, each of which is used by its
+// own goroutine and keeps up to 8 STATUS commands in progress at the same time.
+// The clients must be authenticated connections to the same account, and must
+// not be used by other goroutines until StatusMany returns.
+//
+// Mailboxes whose STATUS command fails (e.g. because they do not exist) are
+// omitted from the result. The first error encountered is returned along with
+// the status of all other mailboxes.
+func StatusMany(clients []*Client, names []string, items ...string) (map[string]*MailboxStatus, error) {
+	if len(items) == 0 {
+		items = statusItems
+	}
+	m := &statusMany{status: make(map[string]*MailboxStatus, len(names))}
+	if len(clients) == 0 || len(names) == 0 {
+		return m.status, nil
+	}
+	if c := clients[0]; c.Caps["LIST-STATUS"] {
+		m.listStatus(c, names, items)
+	}
+	queue := make(chan string, len(names))
+	for _, name := range names {
+		if m.status[name] == nil {
+			queue <- name
+		}
+	}
+	close(queue)
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			m.run(c, queue, items)
+		}(c)
+	}
+	wg.Wait()
+	return m.status, m.err
+}
+
+// StatusMany returns the status of the specified mailboxes using s.Client. See
+// the StatusMany function.
+func (s *Session) StatusMany(names []string, items ...string) (map[string]*MailboxStatus, error) {
+	return StatusMany([]*Client{s.Client}, names, items...)
+}
+
+// statusMany holds the results of StatusMany.
+type statusMany struct {
+	mu     sync.Mutex
+	status map[string]*MailboxStatus
+	err    error
+}
+
+// save records the status or error of one mailbox.
+func (m *statusMany) save(name string, status *MailboxStatus, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if status != nil {
+		m.status[name] = status
+	} else if m.err == nil {
+		m.err = err
+	}
+}
+
+// listStatus requests the status of all mailboxes with a LIST command using the
+// STATUS return option. Since the STATUS responses are not accepted by the LIST
+// command filter, they are removed from c.Data.
+func (m *statusMany) listStatus(c *Client, names, items []string) {
+	want := make(map[string]bool, len(names))
+	pats := make([]Field, len(names))
+	for i, name := range names {
+		want[name] = true
+		pats[i] = c.encodeMailbox(name)
+	}
+	ret := []Field{"STATUS", stringsToFields(items)}
+	if _, err := Wait(c.Send("LIST", c.encodeMailbox(""), pats, "RETURN", ret)); err != nil {
+		return
+	}
+	data := c.Data[:0]
+	for _, rsp := range c.Data {
+		if status := rsp.MailboxStatus(); status != nil && want[status.Name] {
+			m.save(status.Name, status, nil)
+			continue
+		}
+		data = append(data, rsp)
+	}
+	c.Data = data
+}
+
+// run issues STATUS commands on c for the mailboxes in queue until the queue is
+// empty or a connection error occurs.
+func (m *statusMany) run(c *Client, queue <-chan string, items []string) {
+	var cmds []*Command
+	var mboxes []string
+	for {
+		if len(cmds) < statusWindow {
+			if name, ok := <-queue; ok {
+				cmd, err := c.Status(name, items...)
+				if err != nil {
+					m.save(name, nil, err)
+					break
+				}
+				cmds, mboxes = append(cmds, cmd), append(mboxes, name)
+				continue
+			}
+		}
+		if len(cmds) == 0 {
+			return
+		}
+		cmd, name := cmds[0], mboxes[0]
+		cmds, mboxes = cmds[1:], mboxes[1:]
+		if _, err := cmd.Result(OK); err != nil {
+			if m.save(name, nil, err); !isResponseError(err) {
+				break
+			}
+			continue
+		}
+		for _, rsp := range cmd.Data {
+			if status := rsp.MailboxStatus(); status != nil {
+				m.save(name, status, nil)
+			}
+		}
+	}
+	for _, cmd := range cmds {
+		cmd.Result(OK)
+	}
+}
+
+// isResponseError returns true if err is a command completion with a status
+// other than OK, as opposed to a connection or protocol error.
+func isResponseError(err error) bool {
+	_, ok := err.(ResponseError)
+	return ok
+}
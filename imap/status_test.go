@@ -0,0 +1,55 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "testing"
+
+func TestSessionStatusMany(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 STATUS "INBOX" (MESSAGES UNSEEN)`+CRLF,
+		`C: A2 STATUS "Sent" (MESSAGES UNSEEN)`+CRLF,
+		`C: A3 STATUS "Missing" (MESSAGES UNSEEN)`+CRLF,
+		`S: * STATUS "INBOX" (MESSAGES 10 UNSEEN 2)`+CRLF,
+		`S: A1 OK STATUS completed`+CRLF,
+		`S: * STATUS "Sent" (MESSAGES 5 UNSEEN 0)`+CRLF,
+		`S: A2 OK STATUS completed`+CRLF,
+		`S: A3 NO Mailbox does not exist`+CRLF,
+	)
+	status, err := S.StatusMany([]string{"INBOX", "Sent", "Missing"}, "MESSAGES", "UNSEEN")
+	t.join("STATUS", nil)
+	if _, ok := err.(ResponseError); !ok {
+		t.Errorf("StatusMany() expected ResponseError; got %v", err)
+	}
+	if len(status) != 2 || status["INBOX"].Messages != 10 || status["INBOX"].Unseen != 2 ||
+		status["Sent"].Messages != 5 {
+		t.Errorf("StatusMany() unexpected result %v", status)
+	}
+
+	C.Caps["LIST-STATUS"] = true
+	C.Data = nil
+	go t.script(
+		`C: A4 LIST "" ("INBOX" "Sent" "Archive") RETURN (STATUS (MESSAGES))`+CRLF,
+		`S: * LIST () "/" "INBOX"`+CRLF,
+		`S: * STATUS "INBOX" (MESSAGES 11)`+CRLF,
+		`S: * LIST () "/" "Sent"`+CRLF,
+		`S: * STATUS "Sent" (MESSAGES 6)`+CRLF,
+		`S: * LIST (\NoSelect) "/" "Archive"`+CRLF,
+		`S: A4 OK LIST completed`+CRLF,
+		`C: A5 STATUS "Archive" (MESSAGES)`+CRLF,
+		`S: * STATUS "Archive" (MESSAGES 0)`+CRLF,
+		`S: A5 OK STATUS completed`+CRLF,
+	)
+	status, err = S.StatusMany([]string{"INBOX", "Sent", "Archive"}, "MESSAGES")
+	t.join("LIST", err)
+	if len(status) != 3 || status["INBOX"].Messages != 11 || status["Sent"].Messages != 6 {
+		t.Errorf("StatusMany(LIST-STATUS) unexpected result %v", status)
+	}
+	if len(C.Data) != 0 {
+		t.Errorf("StatusMany(LIST-STATUS) left %d unilateral responses", len(C.Data))
+	}
+}
@@ -5,7 +5,11 @@
 package imap
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"math"
 	"unicode/utf8"
 )
 
@@ -68,6 +72,62 @@ func QuoteBytes(s []byte, utf8quoted bool) []byte {
 	return append(q, '"')
 }
 
+// AString encodes v, which must be string, []byte, or fmt.Stringer, as an
+// astring command argument (e.g. a mailbox name, search string, or keyword).
+// The most compact valid representation is chosen automatically: an atom if v
+// contains only atom characters, a quoted string if v contains other printable
+// ASCII characters, or a literal if v contains CR, LF, or 8-bit data. Unlike a
+// raw string argument, the result can never be misinterpreted as multiple
+// arguments or as a command terminator. Nil is returned if v has an unsupported
+// type or contains NUL characters, which cannot be represented.
+func AString(v interface{}) Field {
+	return exported(encodeString(v, true))
+}
+
+// badArg is used in place of a command argument that cannot be encoded (e.g. a
+// string that contains NUL characters). It causes Client.Send to fail instead
+// of sending an invalid command.
+type badArg struct {
+	kind  string // Argument description
+	value string // Original value
+}
+
+// exported converts a badArg to nil for the callers of AString and
+// Client.Quote.
+func exported(f Field) Field {
+	if _, bad := f.(badArg); bad {
+		return nil
+	}
+	return f
+}
+
+// encodeString implements AString and Client.Quote. The atom form is only used
+// if atom is true. A badArg is returned if v contains NUL characters.
+func encodeString(v interface{}, atom bool) Field {
+	var b []byte
+	var cp bool
+	switch s := v.(type) {
+	case string:
+		b = []byte(s)
+	case []byte:
+		b, cp = s, true
+	case fmt.Stringer:
+		b = []byte(s.String())
+	default:
+		return nil
+	}
+	if atom && isAtom(string(b)) && !bytes.EqualFold(b, []byte("NIL")) {
+		return string(b)
+	} else if q := QuoteBytes(b, false); q != nil {
+		return string(q)
+	} else if bytes.IndexByte(b, nul) >= 0 {
+		return badArg{"string argument", string(b)}
+	} else if cp {
+		b = append([]byte(nil), b...)
+	}
+	return NewLiteral(b)
+}
+
 // Quoted returns true if a string or []byte appears to contain a quoted string,
 // based on the presence of surrounding double quotes. The string contents are
 // not checked, so it may still contain illegal characters or escape sequences.
@@ -75,9 +135,7 @@ func QuoteBytes(s []byte, utf8quoted bool) []byte {
 func Quoted(f Field) bool {
 	switch s := f.(type) {
 	case string:
-		if n := len(s); n >= 2 && s[n-1] == '"' {
-			return s[0] == '"' || (n >= 3 && s[0] == '*' && s[1] == '"')
-		}
+		return quoted(s)
 	case []byte:
 		if n := len(s); n >= 2 && s[n-1] == '"' {
 			return s[0] == '"' || (n >= 3 && s[0] == '*' && s[1] == '"')
@@ -86,6 +144,15 @@ func Quoted(f Field) bool {
 	return false
 }
 
+// quoted is the string-only version of Quoted, which is used by the Field
+// conversion functions after the type of the field is already known.
+func quoted(s string) bool {
+	if n := len(s); n >= 2 && s[n-1] == '"' {
+		return s[0] == '"' || (n >= 3 && s[0] == '*' && s[1] == '"')
+	}
+	return false
+}
+
 // QuotedUTF8 returns true if a string or []byte appears to contain a quoted
 // string encoded in utf8-quoted format.
 func QuotedUTF8(f Field) bool {
@@ -107,11 +174,8 @@ func QuotedUTF8(f Field) bool {
 // characters still apply. All (and only) double quote and backslash characters
 // must be escaped with a backslash.
 func Unquote(q string) (s string, ok bool) {
-	if Quoted(q) {
-		var b []byte
-		if b, ok = unquote([]byte(q)); len(b) > 0 {
-			s = string(b)
-		}
+	if quoted(q) {
+		s, ok = unquoteString(q)
 	}
 	return
 }
@@ -124,6 +188,31 @@ func UnquoteBytes(q []byte) (s []byte, ok bool) {
 	return
 }
 
+// unquoteString performs the actual unquote operation on a string. It assumes
+// that quoted(q) == true. Strings without escape sequences are returned as
+// substrings of q without allocating memory, which is the common case for
+// quoted strings received from the server.
+func unquoteString(q string) (s string, ok bool) {
+	if q[0] == '"' {
+		s = q[1 : len(q)-1] // "..."
+	} else {
+		s = q[2 : len(q)-1] // *"..."
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '\\' || c == '"' || c < ctl && (c == nul || c == cr || c == lf) {
+			var b []byte
+			if b, ok = unquote([]byte(q)); len(b) > 0 {
+				return string(b), ok
+			}
+			return "", ok
+		}
+	}
+	if !utf8.ValidString(s) {
+		return "", false
+	}
+	return s, true
+}
+
 // unquote performs the actual unquote operation on a byte slice. It assumes
 // that Quoted(q) == true.
 func unquote(q []byte) (s []byte, ok bool) {
@@ -193,20 +282,77 @@ type Literal interface {
 // to modify the array data until the literal has been sent in a command. It is
 // the caller's responsibility to create a copy of the data, if needed.
 func NewLiteral(b []byte) Literal {
-	return &literal{b, LiteralInfo{Len: uint32(len(b))}}
+	return &literal{data: b, info: LiteralInfo{Len: uint32(len(b))}}
 }
 
 // NewLiteral8 creates a new binary literal string from a byte slice. This
 // literal is sent using the literal8 syntax, as described in RFC 3516. The
 // server must advertise "BINARY" capability for such literals to be accepted.
 func NewLiteral8(b []byte) Literal {
-	return &literal{b, LiteralInfo{Len: uint32(len(b)), Bin: true}}
+	return &literal{data: b, info: LiteralInfo{Len: uint32(len(b)), Bin: true}}
+}
+
+// ErrLiteralSize is returned when the size of a literal read from an io.Reader
+// cannot be determined or exceeds the 4 GB protocol limit.
+var ErrLiteralSize = errors.New("imap: invalid literal size")
+
+// NewReaderLiteral creates a new literal string containing the next n bytes of
+// r. The data is copied directly from r to the connection when the command is
+// sent, so the message does not need to be buffered in memory. The literal
+// can only be sent once. If r returns fewer than n bytes, the command fails
+// with io.ErrUnexpectedEOF and the connection must be closed, because the
+// server is still expecting the remaining data.
+func NewReaderLiteral(r io.Reader, n uint32) Literal {
+	return &readerLiteral{r, LiteralInfo{Len: n}}
+}
+
+// NewSeekerLiteral creates a new literal string containing the remainder of r,
+// starting at its current offset (e.g. an open os.File). The size of the
+// literal is determined by seeking to the end of r and back. ErrLiteralSize is
+// returned if the size is greater than 4 GB.
+func NewSeekerLiteral(r io.ReadSeeker) (Literal, error) {
+	off, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	} else if _, err = r.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	} else if end < off || end-off > math.MaxUint32 {
+		return nil, ErrLiteralSize
+	}
+	return NewReaderLiteral(r, uint32(end-off)), nil
+}
+
+// readerLiteral copies a literal string from an io.Reader.
+type readerLiteral struct {
+	r    io.Reader
+	info LiteralInfo
+}
+
+// WriteTo copies the literal to w in chunks of at most LiteralChunkSize bytes,
+// so only one chunk of the message is held in memory at any time, regardless
+// of the literal size.
+func (l *readerLiteral) WriteTo(w io.Writer) (n int64, err error) {
+	size := int64(l.info.Len)
+	src := &io.LimitedReader{R: l.r, N: size}
+	if n, err = io.CopyBuffer(w, src, make([]byte, chunkSize(size))); err == nil && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+func (l *readerLiteral) Info() LiteralInfo {
+	return l.info
 }
 
 // literal stores a single literal string in a byte slice.
 type literal struct {
 	data []byte
 	info LiteralInfo
+	pool bool // data was obtained from literalPool (see PoolReader)
 }
 
 func (l *literal) WriteTo(w io.Writer) (n int64, err error) {
@@ -241,7 +387,74 @@ func (MemoryReader) ReadLiteral(r io.Reader, i LiteralInfo) (Literal, error) {
 	}
 	b := make([]byte, i.Len)
 	n, err := io.ReadFull(r, b)
-	return &literal{b[:n], i}, err
+	return &literal{data: b[:n], info: i}, err
+}
+
+// ErrStreamed is returned by the WriteTo method of a StreamedLiteral.
+var ErrStreamed = errors.New("imap: literal was streamed")
+
+// StreamReader implements the LiteralReader interface by copying incoming
+// literals to application-provided writers as the data arrives. This allows
+// large message bodies to be saved to files or processed incrementally without
+// buffering them in memory. Use Client.SetLiteralReader to install it.
+type StreamReader struct {
+	// Dest is called before each literal is received. The prefix argument
+	// contains the response text preceding the literal (e.g.
+	// "* 12 FETCH (UID 42 BODY[] "), which identifies the message and data
+	// item. The literal is saved to memory, as with MemoryReader, if Dest is
+	// nil or returns nil. The prefix is only valid for the duration of the
+	// call.
+	Dest func(prefix []byte, i LiteralInfo) io.Writer
+}
+
+func (sr *StreamReader) ReadLiteral(r io.Reader, i LiteralInfo) (Literal, error) {
+	return sr.readLiteral(nil, r, i)
+}
+
+// readLiteral reads a literal that is preceded by prefix in the response line.
+// All i.Len bytes are consumed even if the destination returns an error, which
+// keeps the connection synchronized.
+func (sr *StreamReader) readLiteral(prefix []byte, r io.Reader, i LiteralInfo) (Literal, error) {
+	var w io.Writer
+	if sr.Dest != nil {
+		w = sr.Dest(prefix, i)
+	}
+	if w == nil {
+		return MemoryReader{}.ReadLiteral(r, i)
+	}
+	l := &StreamedLiteral{Dest: w, info: i}
+	n, err := io.CopyBuffer(l, r, make([]byte, chunkSize(int64(i.Len))))
+	if err == nil && n < int64(i.Len) {
+		err = io.ErrUnexpectedEOF
+	}
+	return l, err
+}
+
+// StreamedLiteral is returned by StreamReader for literals that were copied to
+// an application-provided writer. The data is not retained, so AsBytes and
+// AsString return empty values for such literals.
+type StreamedLiteral struct {
+	Dest io.Writer // Writer that received the literal
+	Err  error     // First error returned by Dest, if any
+	info LiteralInfo
+}
+
+// Write passes p to l.Dest. After the first error, all subsequent data is
+// discarded and the error is saved in l.Err.
+func (l *StreamedLiteral) Write(p []byte) (int, error) {
+	if l.Err == nil {
+		_, l.Err = l.Dest.Write(p)
+	}
+	return len(p), nil
+}
+
+// WriteTo returns ErrStreamed, because the literal data is not retained.
+func (l *StreamedLiteral) WriteTo(w io.Writer) (n int64, err error) {
+	return 0, ErrStreamed
+}
+
+func (l *StreamedLiteral) Info() LiteralInfo {
+	return l.info
 }
 
 // toUpper returns a copy of s with all ASCII characters converted to upper
@@ -266,3 +479,26 @@ convert:
 	}
 	return string(u)
 }
+
+// toLower returns a copy of s with all ASCII characters converted to lower
+// case. This is a faster version of strings.ToLower for ASCII-only strings.
+func toLower(s string) string {
+	n := len(s)
+	for i := 0; i < n; i++ {
+		if c := s[i]; 'A' <= c && c <= 'Z' {
+			goto convert
+		}
+	}
+	return s
+
+convert:
+	l := make([]byte, n)
+	for i := 0; i < n; i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' {
+			c |= 0x20
+		}
+		l[i] = c
+	}
+	return string(l)
+}
@@ -5,6 +5,9 @@
 package imap
 
 import (
+	"io"
+	"io/ioutil"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -210,3 +213,66 @@ func TestStringsToUpper(t *testing.T) {
 		}
 	}
 }
+
+func TestStringsAString(t *testing.T) {
+	tests := []struct {
+		in  interface{}
+		out Field
+	}{
+		{"INBOX", "INBOX"},
+		{"$Forwarded", "$Forwarded"},
+		{"", `""`},
+		{"nil", `"nil"`},
+		{"Sent Items", `"Sent Items"`},
+		{`a"b\c`, `"a\"b\\c"`},
+		{"a)b", `"a)b"`},
+		{"a]b", `"a]b"`},
+		{"a\r\nb", lit("a\r\nb")},
+		{"caf\xc3\xa9", lit("caf\xc3\xa9")},
+		{[]byte("a\x00b"), nil},
+		{[]byte("abc"), "abc"},
+		{123, nil},
+	}
+	for _, test := range tests {
+		if out := AString(test.in); !reflect.DeepEqual(out, test.out) {
+			t.Errorf("AString(%q) expected %#v; got %#v", test.in, test.out, out)
+		}
+	}
+}
+
+// readSizes records the length of each Read call.
+type readSizes struct {
+	r     io.Reader
+	sizes []int
+}
+
+func (r *readSizes) Read(p []byte) (int, error) {
+	r.sizes = append(r.sizes, len(p))
+	return r.r.Read(p)
+}
+
+func TestStringsReaderLiteral(t *testing.T) {
+	defer func(n int) { LiteralChunkSize = n }(LiteralChunkSize)
+	LiteralChunkSize = 4
+
+	r := &readSizes{r: strings.NewReader("hello world")}
+	var out strings.Builder
+	w := struct{ io.Writer }{&out} // Hide io.ReaderFrom
+	if n, err := NewReaderLiteral(r, 11).WriteTo(w); n != 11 || err != nil {
+		t.Fatalf("WriteTo() expected 11 bytes; got %d (%v)", n, err)
+	}
+	if out.String() != "hello world" {
+		t.Errorf("WriteTo() expected \"hello world\"; got %q", out.String())
+	}
+	for _, n := range r.sizes {
+		if n > 4 {
+			t.Errorf("Read() expected at most 4 bytes; got %v", r.sizes)
+			break
+		}
+	}
+
+	l := NewReaderLiteral(strings.NewReader("short"), 11)
+	if n, err := l.WriteTo(ioutil.Discard); n != 5 || err != io.ErrUnexpectedEOF {
+		t.Errorf("WriteTo() expected 5 bytes and io.ErrUnexpectedEOF; got %d (%v)", n, err)
+	}
+}
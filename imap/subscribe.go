@@ -0,0 +1,84 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import "sort"
+
+// Subscribed returns the names of all subscribed mailboxes, sorted. If the
+// server supports LIST-EXTENDED (RFC 5258), the SUBSCRIBED selection option of
+// LIST is used, which also reports subscriptions to mailboxes that no longer
+// exist. Otherwise, the names are obtained with LSUB. The name INBOX is always
+// in upper case.
+func (s *Session) Subscribed() ([]string, error) {
+	c := s.Client
+	var cmd *Command
+	var err error
+	if c.Caps["LIST-EXTENDED"] {
+		cmd, err = Wait(c.Send("LIST", []Field{"SUBSCRIBED"}, c.encodeMailbox(""), c.encodeMailbox("*")))
+	} else {
+		cmd, err = Wait(c.LSub("", "*"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, rsp := range cmd.Data {
+		if info := rsp.MailboxInfo(); info != nil {
+			if rsp.Label == "LIST" && info.Attr&AttrSubscribed == 0 {
+				continue
+			}
+			names = append(names, info.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SyncSubscriptions makes the set of subscribed mailboxes equal to want. The
+// current subscriptions are obtained with Subscribed, then SUBSCRIBE is sent
+// only for the mailboxes that are missing from the set and UNSUBSCRIBE only for
+// the ones that are not in want. The mailboxes in want do not need to exist.
+// The names of the mailboxes that were subscribed and unsubscribed are
+// returned, even if an error is encountered, in which case the remaining
+// changes are not made.
+func (s *Session) SyncSubscriptions(want []string) (added, removed []string, err error) {
+	have, err := s.Subscribed()
+	if err != nil {
+		return nil, nil, err
+	}
+	wantSet := make(map[string]bool, len(want))
+	for _, name := range want {
+		if len(name) == 5 && toUpper(name) == "INBOX" {
+			name = "INBOX"
+		}
+		wantSet[name] = true
+	}
+	haveSet := make(map[string]bool, len(have))
+	for _, name := range have {
+		haveSet[name] = true
+	}
+	for _, name := range have {
+		if !wantSet[name] {
+			if _, err = Wait(s.Client.Unsubscribe(name)); err != nil {
+				return
+			}
+			removed = append(removed, name)
+		}
+	}
+	add := make([]string, 0, len(wantSet))
+	for name := range wantSet {
+		if !haveSet[name] {
+			add = append(add, name)
+		}
+	}
+	sort.Strings(add)
+	for _, name := range add {
+		if _, err = Wait(s.Client.Subscribe(name)); err != nil {
+			return
+		}
+		added = append(added, name)
+	}
+	return
+}
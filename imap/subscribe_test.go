@@ -0,0 +1,50 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSessionSyncSubscriptions(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 LSUB "" "*"`+CRLF,
+		`S: * LSUB () "/" "inbox"`+CRLF,
+		`S: * LSUB () "/" "Sent"`+CRLF,
+		`S: * LSUB () "/" "Old"`+CRLF,
+		`S: A1 OK LSUB completed`+CRLF,
+		`C: A2 UNSUBSCRIBE "Old"`+CRLF,
+		`S: A2 OK UNSUBSCRIBE completed`+CRLF,
+		`C: A3 SUBSCRIBE "Archive"`+CRLF,
+		`S: A3 OK SUBSCRIBE completed`+CRLF,
+		`C: A4 SUBSCRIBE "Work"`+CRLF,
+		`S: A4 NO Permission denied`+CRLF,
+	)
+	added, removed, err := S.SyncSubscriptions([]string{"Work", "Inbox", "Sent", "Archive"})
+	t.join("SUBSCRIBE", nil)
+	if err == nil || !reflect.DeepEqual(added, []string{"Archive"}) ||
+		!reflect.DeepEqual(removed, []string{"Old"}) {
+		t.Errorf("SyncSubscriptions() unexpected result %v, %v, %v", added, removed, err)
+	}
+
+	C.Caps["LIST-EXTENDED"] = true
+	go t.script(
+		`C: A5 LIST (SUBSCRIBED) "" "*"`+CRLF,
+		`S: * LIST (\Subscribed) "/" "INBOX"`+CRLF,
+		`S: * LIST (\Subscribed \NonExistent) "/" "Gone"`+CRLF,
+		`S: * LIST (\HasChildren) "/" "Work"`+CRLF,
+		`S: * LIST (\Subscribed) "/" "Work/Reports"`+CRLF,
+		`S: A5 OK LIST completed`+CRLF,
+	)
+	names, err := S.Subscribed()
+	t.join("LIST", err)
+	if want := []string{"Gone", "INBOX", "Work/Reports"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Subscribed() expected %v; got %v", want, names)
+	}
+}
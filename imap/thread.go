@@ -0,0 +1,444 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ThreadNode is a message in a conversation tree, as returned by the THREAD
+// command (RFC 5256) or built by ThreadMessages. Num is a message sequence
+// number or UID. A node with Num == 0 is a placeholder for a message that is
+// not available (e.g. a deleted message that others reply to), which only
+// groups its children.
+type ThreadNode struct {
+	Num      uint32        // Message number (0 for a placeholder)
+	Children []*ThreadNode // Replies, in order
+}
+
+// Thread issues a THREAD command using the specified algorithm (e.g.
+// "REFERENCES" or "ORDEREDSUBJECT") and search criteria (see Search). The
+// results are available through Response.ThreadResults. The THREAD=<algorithm>
+// capability must be advertised by the server. See Session.Thread for a
+// fallback when it is not.
+func (c *Client) Thread(algorithm string, spec ...Field) (cmd *Command, err error) {
+	return c.thread("THREAD", algorithm, spec)
+}
+
+// UIDThread is identical to Thread, but the numbers returned in the response
+// are unique identifiers instead of message sequence numbers.
+func (c *Client) UIDThread(algorithm string, spec ...Field) (cmd *Command, err error) {
+	return c.thread("UID THREAD", algorithm, spec)
+}
+
+// thread implements Thread and UIDThread.
+func (c *Client) thread(name, algorithm string, spec []Field) (*Command, error) {
+	algorithm = toUpper(algorithm)
+	if !c.Caps["THREAD="+algorithm] {
+		return nil, NotAvailableError("THREAD=" + algorithm)
+	}
+	charset := "US-ASCII"
+	if spec = searchDates(spec); hasNonASCII(spec) {
+		charset = "UTF-8"
+	}
+	return c.Send(name, append([]Field{algorithm, charset}, spec...)...)
+}
+
+// ThreadResults returns the conversation trees extracted from a THREAD
+// response, one per thread.
+func (rsp *Response) ThreadResults() []*ThreadNode {
+	v, ok := rsp.Decoded.([]*ThreadNode)
+	if !ok && rsp.Decoded == nil && rsp.Label == "THREAD" {
+		for _, f := range rsp.Fields[1:] {
+			if n := parseThread(AsList(f)); n != nil {
+				v = append(v, n)
+			}
+		}
+		rsp.Decoded = v
+	}
+	return v
+}
+
+// parseThread converts a parenthesized thread list into a tree. Consecutive
+// numbers form a chain of replies, and nested lists are the replies to the
+// last number before them. A list that starts with nested lists has a
+// placeholder root.
+func parseThread(list []Field) (root *ThreadNode) {
+	var last *ThreadNode
+	for _, f := range list {
+		switch TypeOf(f) {
+		case Number:
+			n := &ThreadNode{Num: AsNumber(f)}
+			if last == nil {
+				root = n
+			} else {
+				last.Children = append(last.Children, n)
+			}
+			last = n
+		case List:
+			if n := parseThread(AsList(f)); n != nil {
+				if last == nil {
+					root = &ThreadNode{}
+					last = root
+				}
+				last.Children = append(last.Children, n)
+			}
+		}
+	}
+	return
+}
+
+// BaseSubject returns the base subject of a message, as defined by RFC 5256
+// section 2.1: the subject with whitespace runs collapsed and reply and
+// forward markers ("Re:", "Fwd:", "(fwd)", "[Fwd: ...]") and leading
+// "[list-name]" tags removed. Subjects should be compared case-insensitively.
+func BaseSubject(subject string) string {
+	base, _ := baseSubject(subject)
+	return base
+}
+
+// baseSubject implements BaseSubject and also reports whether the subject
+// indicated a reply or forward.
+func baseSubject(s string) (base string, reply bool) {
+	s = strings.Join(strings.Fields(s), " ")
+	for {
+		for strings.HasSuffix(strings.ToLower(s), "(fwd)") {
+			s, reply = strings.TrimRight(s[:len(s)-5], " "), true
+		}
+		for {
+			if t, ok := trimSubjLeader(s); ok {
+				s, reply = t, true
+			} else if t, ok := trimSubjBlob(s); ok && t != "" {
+				s = t
+			} else {
+				break
+			}
+		}
+		if len(s) > 5 && strings.EqualFold(s[:5], "[fwd:") && s[len(s)-1] == ']' {
+			s, reply = strings.TrimSpace(s[5:len(s)-1]), true
+			continue
+		}
+		return s, reply
+	}
+}
+
+// trimSubjLeader removes a leading "Re:", "Fw:", or "Fwd:" marker from s,
+// including any "[blob]" tags before and inside of it.
+func trimSubjLeader(s string) (string, bool) {
+	t := s
+	for {
+		b, ok := trimSubjBlob(t)
+		if !ok {
+			break
+		}
+		t = b
+	}
+	for _, p := range []string{"re", "fwd", "fw"} {
+		if len(t) < len(p) || !strings.EqualFold(t[:len(p)], p) {
+			continue
+		}
+		r := strings.TrimLeft(t[len(p):], " ")
+		if b, ok := trimSubjBlob(r); ok {
+			r = b
+		}
+		if strings.HasPrefix(r, ":") {
+			return strings.TrimLeft(r[1:], " "), true
+		}
+	}
+	return s, false
+}
+
+// trimSubjBlob removes a leading "[...]" tag from s.
+func trimSubjBlob(s string) (string, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return s, false
+	}
+	i := strings.IndexAny(s[1:], "[]")
+	if i < 0 || s[1+i] != ']' {
+		return s, false
+	}
+	return strings.TrimLeft(s[i+2:], " "), true
+}
+
+// ThreadMessages builds conversation trees from the ENVELOPE and References
+// header (see FetchReferences) of the specified messages using the REFERENCES
+// algorithm of RFC 5256, which is based on the one by Jamie Zawinski. It
+// returns the same structure as the THREAD command, using UIDs or sequence
+// numbers depending on uid. Messages without an envelope are ignored. Threads
+// and replies are sorted by the Date header, falling back to INTERNALDATE.
+func ThreadMessages(msgs []*MessageInfo, uid bool) []*ThreadNode {
+	var t threader
+	t.ids = make(map[string]*threadContainer, len(msgs))
+	for _, msg := range msgs {
+		t.add(msg, uid)
+	}
+	var roots []*threadContainer
+	for _, c := range t.all {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+	roots = pruneThreads(roots, true)
+	sortThreads(roots)
+	roots = groupBySubject(roots)
+	sortThreads(roots)
+	nodes := make([]*ThreadNode, len(roots))
+	for i, c := range roots {
+		nodes[i] = c.node()
+	}
+	return nodes
+}
+
+// Thread returns the conversation trees of the messages that match the
+// criteria (all messages if none are specified). The server-side THREAD
+// command with the REFERENCES algorithm is used if it is available. Otherwise,
+// the matching messages are found with SEARCH, their envelopes and References
+// headers are fetched, and the trees are built by ThreadMessages. The numbers
+// are UIDs if s.UID is set.
+func (s *Session) Thread(spec ...Field) ([]*ThreadNode, error) {
+	if len(spec) == 0 {
+		spec = []Field{"ALL"}
+	}
+	c := s.Client
+	if c.Caps["THREAD=REFERENCES"] {
+		thread := c.Thread
+		if s.UID {
+			thread = c.UIDThread
+		}
+		cmd, err := Wait(thread("REFERENCES", spec...))
+		if err != nil {
+			return nil, err
+		}
+		var threads []*ThreadNode
+		for _, rsp := range cmd.Data {
+			threads = append(threads, rsp.ThreadResults()...)
+		}
+		return threads, nil
+	}
+	nums, err := s.Search(spec...)
+	if err != nil || len(nums) == 0 {
+		return nil, err
+	}
+	msgs, err := s.Fetch(NewSeqSetNums(nums), "ENVELOPE", "INTERNALDATE", FetchReferences)
+	if err != nil {
+		return nil, err
+	}
+	return ThreadMessages(msgs, s.UID), nil
+}
+
+// threadContainer is a message or placeholder in the threading algorithm.
+type threadContainer struct {
+	num      uint32
+	date     time.Time
+	subject  string // Base subject
+	reply    bool   // Subject indicates a reply or forward
+	dummy    bool
+	parent   *threadContainer
+	children []*threadContainer
+}
+
+// threader holds the state of ThreadMessages.
+type threader struct {
+	ids map[string]*threadContainer
+	all []*threadContainer
+}
+
+// get returns the container for the specified message ID, creating a
+// placeholder if necessary.
+func (t *threader) get(id string) *threadContainer {
+	c := t.ids[id]
+	if c == nil {
+		c = &threadContainer{dummy: true}
+		t.ids[id] = c
+		t.all = append(t.all, c)
+	}
+	return c
+}
+
+// add links msg into the tree using its Message-ID and References or
+// In-Reply-To headers (RFC 5256 REFERENCES steps 1A to 1C).
+func (t *threader) add(msg *MessageInfo, uid bool) {
+	env := msg.Envelope()
+	if env == nil {
+		return
+	}
+	var m *threadContainer
+	ids := ParseMessageIDs(env.MessageID)
+	if len(ids) > 0 && t.ids[ids[0]] != nil && t.ids[ids[0]].dummy {
+		m = t.ids[ids[0]]
+	} else {
+		m = &threadContainer{}
+		t.all = append(t.all, m)
+		if len(ids) > 0 && t.ids[ids[0]] == nil {
+			t.ids[ids[0]] = m
+		}
+	}
+	m.dummy = false
+	m.num = msg.Seq
+	if uid {
+		m.num = msg.UID
+	}
+	if m.date = env.Date; m.date.IsZero() {
+		m.date = msg.InternalDate
+	}
+	m.subject, m.reply = baseSubject(env.Subject)
+
+	refs := msg.References()
+	if len(refs) == 0 {
+		if irt := env.InReplyToIDs(); len(irt) > 0 {
+			refs = irt[:1]
+		}
+	}
+	var prev *threadContainer
+	for _, id := range refs {
+		c := t.get(id)
+		if c == m {
+			continue
+		}
+		if prev != nil && c.parent == nil && !prev.hasAncestor(c) {
+			c.setParent(prev)
+		}
+		prev = c
+	}
+	if prev != nil && prev.hasAncestor(m) {
+		prev = nil
+	}
+	if m.parent != prev {
+		m.setParent(prev)
+	}
+}
+
+// hasAncestor returns true if a is c or one of its ancestors.
+func (c *threadContainer) hasAncestor(a *threadContainer) bool {
+	for ; c != nil; c = c.parent {
+		if c == a {
+			return true
+		}
+	}
+	return false
+}
+
+// setParent moves c to the end of the children of p, or to the root set if p
+// is nil.
+func (c *threadContainer) setParent(p *threadContainer) {
+	if old := c.parent; old != nil {
+		for i, ch := range old.children {
+			if ch == c {
+				old.children = append(old.children[:i], old.children[i+1:]...)
+				break
+			}
+		}
+	}
+	if c.parent = p; p != nil {
+		p.children = append(p.children, c)
+	}
+}
+
+// first returns the first message container at or below c.
+func (c *threadContainer) first() *threadContainer {
+	for c.dummy && len(c.children) > 0 {
+		c = c.children[0]
+	}
+	return c
+}
+
+// node converts c and its descendants to ThreadNodes.
+func (c *threadContainer) node() *ThreadNode {
+	n := &ThreadNode{Num: c.num}
+	if c.dummy {
+		n.Num = 0
+	}
+	for _, ch := range c.children {
+		n.Children = append(n.Children, ch.node())
+	}
+	return n
+}
+
+// pruneThreads removes placeholders without children and replaces those with
+// children by the children themselves, unless doing so would promote more than
+// one child to the root set (RFC 5256 REFERENCES step 3).
+func pruneThreads(list []*threadContainer, root bool) []*threadContainer {
+	var out []*threadContainer
+	for _, c := range list {
+		c.children = pruneThreads(c.children, false)
+		if c.dummy && (len(c.children) == 0 || !root || len(c.children) == 1) {
+			for _, ch := range c.children {
+				ch.parent = c.parent
+			}
+			out = append(out, c.children...)
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// sortThreads sorts list and all descendants by date. Placeholders use the date
+// of their first child. Equal dates are ordered by message number.
+func sortThreads(list []*threadContainer) {
+	for _, c := range list {
+		sortThreads(c.children)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].first(), list[j].first()
+		if !a.date.Equal(b.date) {
+			return a.date.Before(b.date)
+		}
+		return a.num < b.num
+	})
+}
+
+// groupBySubject merges threads in the root set that have the same base subject
+// (RFC 5256 REFERENCES step 5).
+func groupBySubject(roots []*threadContainer) []*threadContainer {
+	table := make(map[string]*threadContainer)
+	for _, c := range roots {
+		subj := strings.ToLower(c.first().subject)
+		if subj == "" {
+			continue
+		}
+		e := table[subj]
+		if e == nil || (c.dummy && !e.dummy) ||
+			(!c.dummy && !e.dummy && e.reply && !c.reply) {
+			table[subj] = c
+		}
+	}
+	idx := make(map[*threadContainer]int, len(roots))
+	for i, c := range roots {
+		idx[c] = i
+	}
+	merged := make([]bool, len(roots))
+	for i, c := range roots {
+		subj := strings.ToLower(c.first().subject)
+		e := table[subj]
+		if subj == "" || e == c {
+			continue
+		}
+		switch merged[i] = true; {
+		case e.dummy && c.dummy:
+			for _, ch := range c.children {
+				ch.parent = e
+			}
+			e.children = append(e.children, c.children...)
+		case e.dummy || (c.reply && !e.reply):
+			c.setParent(e)
+		default:
+			d := &threadContainer{dummy: true}
+			roots[idx[e]], idx[d] = d, idx[e]
+			table[subj] = d
+			e.setParent(d)
+			c.setParent(d)
+		}
+	}
+	out := roots[:0]
+	for i, c := range roots {
+		if !merged[i] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// tn returns a ThreadNode for concise test tables.
+func tn(num uint32, children ...*ThreadNode) *ThreadNode {
+	return &ThreadNode{Num: num, Children: children}
+}
+
+func TestBaseSubject(t *testing.T) {
+	tests := []struct {
+		in, out string
+		reply   bool
+	}{
+		{"", "", false},
+		{"Hello", "Hello", false},
+		{"  Hello \t  world ", "Hello world", false},
+		{"Re: Hello", "Hello", true},
+		{"RE:Re:  Hello", "Hello", true},
+		{"Fwd: Hello (fwd)", "Hello", true},
+		{"Fw: Hello", "Hello", true},
+		{"[list] Re: Hello", "Hello", true},
+		{"Re[2]: Hello", "Hello", true},
+		{"[list] Hello", "Hello", false},
+		{"[list]", "[list]", false},
+		{"[Fwd: Re: Hello]", "Hello", true},
+		{"Reply: Hello", "Reply: Hello", false},
+	}
+	for _, test := range tests {
+		out, reply := baseSubject(test.in)
+		if out != test.out || reply != test.reply {
+			t.Errorf("baseSubject(%q) expected %q, %v; got %q, %v",
+				test.in, test.out, test.reply, out, reply)
+		}
+	}
+}
+
+func TestThreadMessages(t *testing.T) {
+	msg := func(seq uint32, date, subj, irt, id, refs string) *MessageInfo {
+		env := []Field{Quote(date, false), Quote(subj, false), nil, nil, nil,
+			nil, nil, nil, Quote(irt, false), Quote(id, false)}
+		attrs := []Field{"UID", seq * 10, "ENVELOPE", env}
+		if refs != "" {
+			attrs = append(attrs, "BODY[HEADER.FIELDS (REFERENCES)]",
+				lit("References: "+refs+"\r\n\r\n"))
+		}
+		return fetchRsp(seq, attrs...).MessageInfo()
+	}
+	msgs := []*MessageInfo{
+		msg(1, "1 Jan 2024 10:00:00 +0000", "Hello", "", "<a>", ""),
+		msg(2, "1 Jan 2024 11:00:00 +0000", "Re: Hello", "<a>", "<b>", ""),
+		msg(3, "1 Jan 2024 12:00:00 +0000", "Re: Hello", "<x>", "<c>", "<a> <x>"),
+		msg(4, "1 Jan 2024 13:00:00 +0000", "Re: Other", "<gone>", "<d>", ""),
+		msg(5, "1 Jan 2024 14:00:00 +0000", "Other", "", "<e>", ""),
+		msg(6, "1 Jan 2024 09:00:00 +0000", "", "", "", ""),
+		msg(7, "1 Jan 2024 15:00:00 +0000", "Same", "", "<f>", ""),
+		msg(8, "1 Jan 2024 16:00:00 +0000", "Same", "", "<g>", ""),
+	}
+	want := []*ThreadNode{
+		tn(6),
+		tn(1, tn(2), tn(3)),
+		tn(5, tn(4)),
+		tn(0, tn(7), tn(8)),
+	}
+	if got := ThreadMessages(msgs, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("ThreadMessages() expected\n%v; got\n%v", fmtThreads(want), fmtThreads(got))
+	}
+	want[1] = tn(10, tn(20), tn(30))
+	if got := ThreadMessages(msgs[:3], true); !reflect.DeepEqual(got, want[1:2]) {
+		t.Errorf("ThreadMessages(uid) expected\n%v; got\n%v", fmtThreads(want[1:2]), fmtThreads(got))
+	}
+}
+
+func TestSessionThread(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 THREAD=REFERENCES] Test server ready`+CRLF)
+	C.setState(Selected)
+	C.Mailbox = newMailboxStatus("INBOX")
+	S := NewSession(C)
+
+	go t.script(
+		`C: A1 THREAD REFERENCES US-ASCII ALL`+CRLF,
+		`S: * THREAD (2)(3 6 (4 23)(44 7 96))((5)(8))`+CRLF,
+		`S: A1 OK THREAD completed`+CRLF,
+	)
+	threads, err := S.Thread()
+	t.join("THREAD", err)
+	want := []*ThreadNode{
+		tn(2),
+		tn(3, tn(6, tn(4, tn(23)), tn(44, tn(7, tn(96))))),
+		tn(0, tn(5), tn(8)),
+	}
+	if !reflect.DeepEqual(threads, want) {
+		t.Errorf("Thread() expected\n%v; got\n%v", fmtThreads(want), fmtThreads(threads))
+	}
+
+	delete(C.Caps, "THREAD=REFERENCES")
+	S.UID = true
+	go t.script(
+		`C: A2 UID SEARCH FROM bob`+CRLF,
+		`S: * SEARCH 4 9`+CRLF,
+		`S: A2 OK SEARCH completed`+CRLF,
+		`C: A3 UID FETCH 4,9 (ENVELOPE INTERNALDATE BODY.PEEK[HEADER.FIELDS (REFERENCES)])`+CRLF,
+		`S: * 1 FETCH (UID 4 ENVELOPE ("1 Jan 2024 10:00:00 +0000" "Hi" NIL NIL NIL NIL NIL NIL NIL "<a>"))`+CRLF,
+		`S: * 2 FETCH (UID 9 ENVELOPE ("1 Jan 2024 11:00:00 +0000" "Re: Hi" NIL NIL NIL NIL NIL NIL "<a>" "<b>"))`+CRLF,
+		`S: A3 OK FETCH completed`+CRLF,
+	)
+	threads, err = S.Thread("FROM", "bob")
+	t.join("UID FETCH", err)
+	if want := []*ThreadNode{tn(4, tn(9))}; !reflect.DeepEqual(threads, want) {
+		t.Errorf("Thread() expected\n%v; got\n%v", fmtThreads(want), fmtThreads(threads))
+	}
+}
+
+// fmtThreads returns a THREAD-like representation of threads for error
+// messages.
+func fmtThreads(threads []*ThreadNode) string {
+	var s string
+	var f func(n *ThreadNode)
+	f = func(n *ThreadNode) {
+		s += "(" + strconv.FormatUint(uint64(n.Num), 10)
+		for _, ch := range n.Children {
+			f(ch)
+		}
+		s += ")"
+	}
+	for _, n := range threads {
+		f(n)
+	}
+	return s
+}
@@ -53,6 +53,48 @@ var (
 // restrict line length to approximately 1000 bytes, as described in RFC 2683.
 var BufferSize = 65536
 
+// ReadBufferSize and WriteBufferSize override BufferSize for the receive and
+// send buffers of new connections if they are positive. Embedded clients may
+// reduce them to save memory, as long as the receive buffer can hold the
+// longest response line (excluding literals) and the send buffer can hold the
+// longest command line. Clients that transfer large messages may increase them
+// to reduce the number of system calls.
+var (
+	ReadBufferSize  = 0
+	WriteBufferSize = 0
+)
+
+// LiteralChunkSize is the maximum number of bytes copied at a time when a
+// literal is passed to a StreamReader destination, and when AppendContext
+// sends the message (between cancellation checks and progress callbacks).
+var LiteralChunkSize = 32 * 1024
+
+// cmpBufferSize is the size of the buffers between the compression and
+// encryption layers, which matches the maximum TLS record size.
+const cmpBufferSize = 16384
+
+// bufferSize returns n if it is positive, or BufferSize otherwise.
+func bufferSize(n int) int {
+	if n > 0 {
+		return n
+	}
+	return BufferSize
+}
+
+// chunkSize returns the size of the buffer used to copy a literal of n bytes.
+func chunkSize(n int64) int {
+	size := LiteralChunkSize
+	if size <= 0 {
+		size = 32 * 1024
+	}
+	if n < int64(size) {
+		if size = int(n); size < 1 {
+			size = 1
+		}
+	}
+	return size
+}
+
 // Line termination.
 var crlf = []byte{cr, lf}
 
@@ -112,10 +154,17 @@ func (l *ioLink) Close() error {
 // any order. Buffering is provided for incoming and outgoing data. The complete
 // data flow is shown in the following diagram (bracketed stages are optional):
 //
-// 	transport <--> buffer <--> [compression] <--> [encryption] <--> network
+// 	transport <--> buffer <--> [compression <--> buffer] <--> [encryption] <--> network
+//
+// The second buffer is only used when compression is enabled. It provides the
+// io.ByteReader interface required by the decompressor, which would otherwise
+// add a buffer of its own, and combines the small blocks written by the
+// compressor into a single write to the encryption layer when the transport is
+// flushed. Without it, every block would be sent in a separate TLS record.
 type transport struct {
 	buf     *bufio.ReadWriter // I/O buffer
 	bufLink *ioLink           // Buffer Read/Write provider
+	cmpBuf  *bufio.ReadWriter // Compressed data buffer
 	cmpLink *ioLink           // Compression Read/Write provider
 	conn    net.Conn          // Network connection
 
@@ -128,8 +177,8 @@ type transport struct {
 func newTransport(conn net.Conn, log *debugLog) *transport {
 	lnk := &ioLink{Reader: conn, Writer: conn}
 	buf := bufio.NewReadWriter(
-		bufio.NewReaderSize(lnk, BufferSize),
-		bufio.NewWriterSize(lnk, BufferSize),
+		bufio.NewReaderSize(lnk, bufferSize(ReadBufferSize)),
+		bufio.NewWriterSize(lnk, bufferSize(WriteBufferSize)),
 	)
 	return &transport{buf: buf, bufLink: lnk, conn: conn, debugLog: log}
 }
@@ -156,7 +205,19 @@ func (t *transport) Closed() bool {
 // text. Otherwise, all bytes that have been read are returned unmodified along
 // with an error explaining the problem.
 func (t *transport) ReadLine() (line []byte, err error) {
-	line, err = t.buf.ReadSlice(lf)
+	return t.EndLine(t.buf.ReadSlice(lf))
+}
+
+// ReadPart returns the next part of a physical line, which either ends with LF
+// or fills the receive buffer (bufio.ErrBufferFull). This allows lines that are
+// longer than the buffer to be processed as they are received. The line format
+// is not checked, and the data is only valid until the next read.
+func (t *transport) ReadPart() (part []byte, err error) {
+	return t.buf.ReadSlice(lf)
+}
+
+// EndLine converts the return values of ReadPart to those of ReadLine.
+func (t *transport) EndLine(line []byte, err error) ([]byte, error) {
 	n := len(line)
 
 	// Copy bytes out of the read buffer
@@ -186,7 +247,7 @@ func (t *transport) ReadLine() (line []byte, err error) {
 		err = &ProtocolError{"line too long", line}
 	}
 	t.LogLine(server, line, err)
-	return
+	return line, err
 }
 
 // WriteLine writes a physical line to the internal buffer. The CRLF ending is
@@ -237,11 +298,15 @@ func (t *transport) Write(p []byte) (n int, err error) {
 	return
 }
 
-// Flush sends any buffered data to the server.
+// Flush sends any buffered data to the server. When compression is enabled,
+// the compressor is also flushed (Z_SYNC_FLUSH), so that the server can
+// decompress everything that was written so far without waiting for more data.
 func (t *transport) Flush() error {
 	err := t.buf.Flush()
 	if t.Compressed() && err == nil {
-		err = t.bufLink.Flush()
+		if err = t.bufLink.Flush(); err == nil {
+			err = t.cmpBuf.Flush()
+		}
 	}
 	return err
 }
@@ -253,10 +318,15 @@ func (t *transport) EnableDeflate(level int) error {
 		return ErrCompressionActive
 	}
 	conn := &ioLink{Reader: t.conn, Writer: t.conn}
-	inflater := flate.NewReader(conn)
-	deflater, err := flate.NewWriter(conn, level)
+	buf := bufio.NewReadWriter(
+		bufio.NewReaderSize(conn, cmpBufferSize),
+		bufio.NewWriterSize(conn, cmpBufferSize),
+	)
+	inflater := flate.NewReader(buf.Reader)
+	deflater, err := flate.NewWriter(buf.Writer, level)
 
 	if err == nil {
+		t.cmpBuf = buf
 		t.cmpLink = conn
 		t.bufLink.Attach(inflater, deflater)
 		t.Logf(LogConn, "DEFLATE compression enabled (level=%d)", level)
@@ -301,7 +371,9 @@ func (t *transport) Close(flush bool) error {
 	if flush {
 		err := t.buf.Flush()
 		if t.Compressed() && err == nil {
-			err = t.bufLink.Close()
+			if err = t.bufLink.Close(); err == nil {
+				err = t.cmpBuf.Flush()
+			}
 		}
 		if err != nil {
 			conn.Close()
@@ -340,6 +340,49 @@ func TestTransportDeflate(t *testing.T) {
 	tLOGOUT(t, C, S, "B004")
 }
 
+// countConn counts the number of Write calls.
+type countConn struct {
+	*testConn
+	writes int
+}
+
+func (c *countConn) Write(b []byte) (int, error) {
+	c.writes++
+	return c.testConn.Write(b)
+}
+
+func TestTransportDeflateFlush(t *testing.T) {
+	c, s := newTestConn(8192)
+	cc := &countConn{testConn: c}
+	C, S := newTransport(cc, nil), newTransport(s, nil)
+	if err := C.EnableDeflate(9); err != nil {
+		t.Fatalf("C.EnableDeflate(9) unexpected error; %v", err)
+	}
+	if err := S.EnableDeflate(0); err != nil {
+		t.Fatalf("S.EnableDeflate(0) unexpected error; %v", err)
+	}
+
+	// All compressed blocks are sent in a single write
+	for i := 0; i < 50; i++ {
+		if err := C.writeln("A001 NOOP"); err != nil {
+			t.Fatalf("C.writeln() unexpected error; %v", err)
+		}
+	}
+	if err := C.Flush(); err != nil {
+		t.Fatalf("C.Flush() unexpected error; %v", err)
+	}
+	if cc.writes != 1 {
+		t.Errorf("Flush() expected 1 write; got %d", cc.writes)
+	}
+
+	// Server receives everything without waiting for more data
+	for i := 0; i < 50; i++ {
+		if out, err := S.readln(); out != "A001 NOOP" || err != nil {
+			t.Fatalf("S.readln() expected \"A001 NOOP\"; got %q (%v)", out, err)
+		}
+	}
+}
+
 func TestTransportTLS(t *testing.T) {
 	c, s := newTestConn(1024)
 	C, S := newTransport(c, nil), newTransport(s, nil)
@@ -375,6 +418,51 @@ func TestTransportTLSDeflate(t *testing.T) {
 	tLOGOUT(t, C, S, "E005")
 }
 
+func TestBufferSizes(t *testing.T) {
+	defer func(r, w int) { ReadBufferSize, WriteBufferSize = r, w }(ReadBufferSize, WriteBufferSize)
+	ReadBufferSize, WriteBufferSize = 16, 32
+
+	c, s := newTestConn(1024)
+	C, S := newTransport(c, nil), newTransport(s, nil)
+	if n := C.buf.Reader.Size(); n != 16 {
+		t.Errorf("Reader.Size() expected 16; got %d", n)
+	}
+	if n := C.buf.Writer.Size(); n != 32 {
+		t.Errorf("Writer.Size() expected 32; got %d", n)
+	}
+
+	// Line fits into the send buffer, but not the receive buffer
+	in := "hello, world, hello"
+	if err := C.send(in); err != nil {
+		t.Fatalf("C.send(%q) unexpected error; %v", in, err)
+	}
+	if err := S.send(in); err != nil {
+		t.Fatalf("S.send(%q) unexpected error; %v", in, err)
+	}
+	if _, err := C.readln(); err == nil {
+		t.Fatalf("C.readln() expected error")
+	}
+
+	tests := []struct {
+		size int
+		n    int64
+		want int
+	}{
+		{0, 1 << 20, 32 * 1024},
+		{1024, 1 << 20, 1024},
+		{1024, 100, 100},
+		{1024, 0, 1},
+	}
+	defer func(n int) { LiteralChunkSize = n }(LiteralChunkSize)
+	for _, test := range tests {
+		LiteralChunkSize = test.size
+		if out := chunkSize(test.n); out != test.want {
+			t.Errorf("chunkSize(%d) with LiteralChunkSize=%d expected %d; got %d",
+				test.n, test.size, test.want, out)
+		}
+	}
+}
+
 func TestTransportErrors(t *testing.T) {
 	c, s := newTestConn(1024)
 
@@ -0,0 +1,286 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+// UIDMap tracks the mapping between message sequence numbers and UIDs in the
+// selected mailbox. It is maintained automatically by the Client: EXISTS
+// responses change the number of messages, EXPUNGE responses remove messages
+// and renumber all subsequent ones, and FETCH responses that include the UID
+// data item record the UID of the message. The UIDs of messages that have not
+// been fetched are unknown. Use a UID FETCH command (e.g. UID FETCH 1:* UID) to
+// populate the entire map.
+//
+// The map is stored as a balanced tree of runs, where each run is a range of
+// messages that either have consecutive UIDs or unknown UIDs. All operations,
+// including the removal of a message by EXPUNGE, take O(log n) expected time,
+// which keeps large mailboxes responsive when another client deletes thousands
+// of messages. A fully populated map of a mailbox without gaps in its UIDs is
+// stored as a single run.
+type UIDMap struct {
+	root     *uidRun // Tree of message runs ordered by sequence number
+	rnd      uint32  // Random number generator state for run priorities
+	expunged uint32  // UID removed by the most recent expunge (0 = unknown)
+}
+
+// newUIDMap returns a new empty UIDMap instance.
+func newUIDMap() *UIDMap {
+	return new(UIDMap)
+}
+
+// Len returns the number of messages in the mailbox.
+func (m *UIDMap) Len() uint32 {
+	return m.root.len()
+}
+
+// UID returns the UID of the message with sequence number seq, or 0 if the UID
+// is unknown.
+func (m *UIDMap) UID(seq uint32) uint32 {
+	if seq == 0 || seq > m.Len() {
+		return 0
+	}
+	i := seq - 1
+	for t := m.root; t != nil; {
+		if n := t.left.len(); i < n {
+			t = t.left
+		} else if i -= n; i < t.n {
+			if t.uid == 0 {
+				return 0
+			}
+			return t.uid + i
+		} else {
+			i -= t.n
+			t = t.right
+		}
+	}
+	return 0
+}
+
+// Seq returns the sequence number of the message with the specified UID, or 0
+// if the UID is unknown.
+func (m *UIDMap) Seq(uid uint32) uint32 {
+	if uid == 0 {
+		return 0
+	}
+	// UIDs are strictly ascending, so uid can only be in the left subtree if
+	// the subtree contains a larger or equal UID.
+	var seq uint32
+	for t := m.root; t != nil; {
+		if t.left != nil && t.left.max >= uid {
+			t = t.left
+			continue
+		}
+		seq += t.left.len()
+		if t.uid != 0 {
+			if uid < t.uid {
+				return 0
+			} else if uid-t.uid < t.n {
+				return seq + uid - t.uid + 1
+			}
+		}
+		seq += t.n
+		t = t.right
+	}
+	return 0
+}
+
+// Known returns the number of messages with known UIDs.
+func (m *UIDMap) Known() uint32 {
+	if m.root == nil {
+		return 0
+	}
+	return m.root.known
+}
+
+// exists changes the number of messages in the mailbox to n. The mutating
+// methods ignore calls on a nil map.
+func (m *UIDMap) exists(n uint32) {
+	if m == nil {
+		return
+	} else if cur := m.Len(); n <= cur {
+		m.root, _ = m.split(m.root, n)
+	} else if !m.root.extend(0, n-cur) {
+		m.root = m.merge(m.root, m.newRun(0, n-cur))
+	}
+}
+
+// expunge removes the message with sequence number seq.
+func (m *UIDMap) expunge(seq uint32) {
+	if m == nil {
+		return
+	} else if m.expunged = 0; seq != 0 && seq <= m.Len() {
+		left, right := m.split(m.root, seq-1)
+		msg, right := m.split(right, 1)
+		m.expunged = msg.uid
+		m.root = m.merge(left, right)
+	}
+}
+
+// fetch records the UID, if any, contained in a FETCH response.
+func (m *UIDMap) fetch(rsp *Response) {
+	if seq, uid := fetchUID(rsp); m != nil && uid != 0 {
+		m.setUID(seq, uid)
+	}
+}
+
+// setUID records the UID of the message with sequence number seq. Consecutive
+// UIDs are appended to the run of the preceding message, so fetching the UIDs
+// in ascending order does not create a run for each message.
+func (m *UIDMap) setUID(seq, uid uint32) {
+	if seq > m.Len() {
+		m.exists(seq)
+	} else if m.UID(seq) == uid {
+		return
+	}
+	left, right := m.split(m.root, seq-1)
+	msg, right := m.split(right, 1)
+	if !left.extend(uid, 1) {
+		msg.uid = uid
+		msg.update()
+		left = m.merge(left, msg)
+	}
+	m.root = m.merge(left, right)
+}
+
+// newRun returns a new run of n messages starting with the specified UID.
+func (m *UIDMap) newRun(uid, n uint32) *uidRun {
+	// xorshift32
+	if m.rnd == 0 {
+		m.rnd = 0x9E3779B9
+	}
+	m.rnd ^= m.rnd << 13
+	m.rnd ^= m.rnd >> 17
+	m.rnd ^= m.rnd << 5
+	t := &uidRun{prio: m.rnd, uid: uid, n: n}
+	t.update()
+	return t
+}
+
+// merge concatenates two trees, where all messages in a precede those in b.
+func (m *UIDMap) merge(a, b *uidRun) *uidRun {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.prio >= b.prio:
+		a.right = m.merge(a.right, b)
+		a.update()
+		return a
+	}
+	b.left = m.merge(a, b.left)
+	b.update()
+	return b
+}
+
+// uidRun is a node in the UIDMap tree (a treap ordered by sequence number and
+// heap-ordered by priority) representing n consecutive messages. The messages
+// have UIDs uid through uid+n-1, or unknown UIDs if uid is 0. The remaining
+// fields summarize the subtree rooted at the node.
+type uidRun struct {
+	left, right *uidRun
+	prio        uint32
+	uid, n      uint32
+
+	size  uint32 // Number of messages in the subtree
+	known uint32 // Number of messages with known UIDs in the subtree
+	max   uint32 // Largest UID in the subtree (0 = none)
+}
+
+// len returns the number of messages in the subtree rooted at t.
+func (t *uidRun) len() uint32 {
+	if t == nil {
+		return 0
+	}
+	return t.size
+}
+
+// update recalculates the summary fields of t from its children.
+func (t *uidRun) update() {
+	t.size, t.known, t.max = t.n, 0, 0
+	if t.uid != 0 {
+		t.known, t.max = t.n, t.uid+t.n-1
+	}
+	if l := t.left; l != nil {
+		t.size += l.size
+		t.known += l.known
+		if t.max == 0 {
+			t.max = l.max
+		}
+	}
+	if r := t.right; r != nil {
+		t.size += r.size
+		t.known += r.known
+		if r.max != 0 {
+			t.max = r.max
+		}
+	}
+}
+
+// split separates the first k messages of the tree from the rest. A run that
+// crosses the boundary is divided into two runs, and the second one is given a
+// new priority, which keeps the tree balanced when large runs are fragmented by
+// expunges.
+func (m *UIDMap) split(t *uidRun, k uint32) (first, rest *uidRun) {
+	if t == nil {
+		return nil, nil
+	}
+	n := t.left.len()
+	switch {
+	case k <= n:
+		first, t.left = m.split(t.left, k)
+		t.update()
+		return first, t
+	case k >= n+t.n:
+		t.right, rest = m.split(t.right, k-n-t.n)
+		t.update()
+		return t, rest
+	}
+	k -= n
+	if rest = m.newRun(0, t.n-k); t.uid != 0 {
+		rest.uid = t.uid + k
+		rest.update()
+	}
+	rest = m.merge(rest, t.right)
+	t.right, t.n = nil, k
+	t.update()
+	return t, rest
+}
+
+// extend appends n messages to the last run of the tree if they continue that
+// run (unknown UIDs following unknown UIDs, or the next consecutive UIDs). It
+// returns false if a new run is needed.
+func (t *uidRun) extend(uid, n uint32) bool {
+	if t == nil {
+		return false
+	} else if t.right != nil {
+		if !t.right.extend(uid, n) {
+			return false
+		}
+	} else if uid == 0 && t.uid == 0 || uid != 0 && t.uid != 0 && uid-t.uid == t.n {
+		t.n += n
+	} else {
+		return false
+	}
+	t.update()
+	return true
+}
+
+// fetchUID returns the sequence number and UID contained in a FETCH response.
+// Both values are 0 if the response does not contain a valid UID.
+func fetchUID(rsp *Response) (seq, uid uint32) {
+	if len(rsp.Fields) < 3 {
+		return
+	}
+	list := AsList(rsp.Fields[2])
+	for i := 0; i+1 < len(list); i += 2 {
+		if toUpper(AsAtom(list[i])) == "UID" {
+			if seq, uid = AsNumber(rsp.Fields[0]), AsNumber(list[i+1]); seq == 0 || uid == 0 {
+				return 0, 0
+			}
+			return
+		}
+	}
+	return
+}
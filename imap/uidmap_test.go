@@ -0,0 +1,164 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestClientUIDMap(T *testing.T) {
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	if C.UIDs != nil {
+		t.Errorf("C.UIDs expected nil before SELECT")
+	}
+
+	go t.script(
+		`C: A1 SELECT "INBOX"`+CRLF,
+		`S: * OK [UIDVALIDITY 1] UIDs valid.`+CRLF,
+		`S: * 5 EXISTS`+CRLF,
+		`S: A1 OK [READ-WRITE] INBOX selected.`+CRLF,
+	)
+	_, err := C.Select("INBOX", false)
+	t.join("SELECT", err)
+	if n := C.UIDs.Len(); n != 5 {
+		t.Errorf("C.UIDs.Len() expected 5; got %d", n)
+	}
+
+	go t.script(
+		`C: A2 UID FETCH 1:* (UID)`+CRLF,
+		`S: * 1 FETCH (UID 10)`+CRLF,
+		`S: * 2 FETCH (UID 20)`+CRLF,
+		`S: * 3 FETCH (FLAGS () UID 30)`+CRLF,
+		`S: * 5 FETCH (UID 50)`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+	)
+	all, _ := NewSeqSet("1:*")
+	_, err = Wait(C.UIDFetch(all, "UID"))
+	t.join("UID FETCH", err)
+	check := func(name string, want []uint32) {
+		var got []uint32
+		for seq := uint32(1); seq <= C.UIDs.Len(); seq++ {
+			uid := C.UIDs.UID(seq)
+			got = append(got, uid)
+			if uid != 0 && C.UIDs.Seq(uid) != seq {
+				t.Errorf("%s: C.UIDs.Seq(%d) expected %d; got %d", name, uid, seq, C.UIDs.Seq(uid))
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: UIDs expected %v; got %v", name, want, got)
+		}
+	}
+	check("FETCH", []uint32{10, 20, 30, 0, 50})
+	if seq := C.UIDs.Seq(40); seq != 0 {
+		t.Errorf("C.UIDs.Seq(40) expected 0; got %d", seq)
+	}
+
+	go t.script(
+		`C: A3 EXPUNGE`+CRLF,
+		`S: * 2 EXPUNGE`+CRLF,
+		`S: * 2 EXPUNGE`+CRLF,
+		`S: * 4 EXISTS`+CRLF,
+		`S: * 4 FETCH (UID 60 FLAGS (\Recent))`+CRLF,
+		`S: A3 OK EXPUNGE completed`+CRLF,
+	)
+	_, err = Wait(C.Expunge(nil))
+	t.join("EXPUNGE", err)
+	check("EXPUNGE", []uint32{10, 0, 50, 60})
+	if n := C.UIDs.Known(); n != 3 {
+		t.Errorf("C.UIDs.Known() expected 3; got %d", n)
+	}
+
+	go t.script(
+		`C: A4 CLOSE`+CRLF,
+		`S: A4 OK CLOSE completed`+CRLF,
+	)
+	_, err = C.Close(true)
+	t.join("CLOSE", err)
+	if C.UIDs != nil {
+		t.Errorf("C.UIDs expected nil after CLOSE")
+	}
+}
+
+func TestUIDMapRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	m := newUIDMap()
+	var uids []uint32 // Actual UIDs by sequence number - 1
+	var known []bool
+	next := uint32(1)
+	for i := 0; i < 2000; i++ {
+		switch op := r.Intn(10); {
+		case op < 2 || len(uids) == 0: // New messages
+			n := 1 + r.Intn(20)
+			for j := 0; j < n; j++ {
+				next += uint32(1 + r.Intn(2))
+				uids, known = append(uids, next), append(known, false)
+			}
+			m.exists(uint32(len(uids)))
+		case op < 4: // Expunge
+			seq := 1 + r.Intn(len(uids))
+			want := uids[seq-1]
+			if !known[seq-1] {
+				want = 0
+			}
+			m.expunge(uint32(seq))
+			if m.expunged != want {
+				t.Fatalf("expunge(%d) expected UID %d; got %d", seq, want, m.expunged)
+			}
+			uids = append(uids[:seq-1], uids[seq:]...)
+			known = append(known[:seq-1], known[seq:]...)
+		default: // Fetch, sometimes in ascending order
+			seq := 1 + r.Intn(len(uids))
+			for n := 1 + r.Intn(10); n > 0 && seq <= len(uids); n-- {
+				m.setUID(uint32(seq), uids[seq-1])
+				known[seq-1] = true
+				seq++
+			}
+		}
+
+		if m.Len() != uint32(len(uids)) {
+			t.Fatalf("Len() expected %d; got %d", len(uids), m.Len())
+		}
+		var nKnown uint32
+		for j, uid := range uids {
+			seq, want := uint32(j+1), uid
+			if !known[j] {
+				seq, want = 0, 0
+			} else {
+				nKnown++
+			}
+			if out := m.UID(uint32(j + 1)); out != want {
+				t.Fatalf("UID(%d) expected %d; got %d", j+1, want, out)
+			}
+			if out := m.Seq(uid); out != seq {
+				t.Fatalf("Seq(%d) expected %d; got %d", uid, seq, out)
+			}
+		}
+		if out := m.Known(); out != nKnown {
+			t.Fatalf("Known() expected %d; got %d", nKnown, out)
+		}
+	}
+}
+
+func TestUIDMapRuns(t *testing.T) {
+	m := newUIDMap()
+	m.exists(100000)
+	for seq := uint32(1); seq <= 100000; seq++ {
+		m.setUID(seq, seq+1000)
+	}
+	if m.root.left != nil || m.root.right != nil || m.Known() != 100000 {
+		t.Errorf("consecutive UIDs expected a single run")
+	}
+	for i := 0; i < 50000; i++ {
+		m.expunge(1)
+	}
+	if uid := m.UID(1); uid != 51001 {
+		t.Errorf("UID(1) expected 51001; got %d", uid)
+	}
+	if seq := m.Seq(100000); seq != 49000 {
+		t.Errorf("Seq(100000) expected 49000; got %d", seq)
+	}
+}
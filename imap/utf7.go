@@ -86,6 +86,29 @@ func utf7enc(s []byte) []byte {
 	return b64
 }
 
+// EncodeMailboxName converts a mailbox name from UTF-8 to modified UTF-7 for use
+// in a command argument. The special case-insensitive name "INBOX" is always
+// converted to upper case.
+func EncodeMailboxName(name string) string {
+	if len(name) == 5 && toUpper(name) == "INBOX" {
+		return "INBOX"
+	}
+	return UTF7Encode(name)
+}
+
+// DecodeMailboxName is the reverse of EncodeMailboxName. The original name and
+// ErrBadUTF7 are returned if name is not a valid modified UTF-7 string.
+func DecodeMailboxName(name string) (string, error) {
+	if len(name) == 5 && toUpper(name) == "INBOX" {
+		return "INBOX", nil
+	}
+	s, err := UTF7Decode(name)
+	if err != nil {
+		return name, err
+	}
+	return s, nil
+}
+
 // UTF7Decode converts a string from modified UTF-7 encoding to UTF-8.
 func UTF7Decode(u string) (s string, err error) {
 	b, err := UTF7DecodeBytes([]byte(u))
@@ -239,3 +239,32 @@ func TestUTF7Inverse(t *testing.T) {
 		}
 	}
 }
+
+func TestMailboxName(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"inbox", "INBOX"},
+		{"InBoX", "INBOX"},
+		{"INBOX/Sub", "INBOX/Sub"},
+		{"Entwürfe", "Entw&APw-rfe"},
+		{"A&B", "A&-B"},
+		{"~peter/mail/台北/日本語", "~peter/mail/&U,BTFw-/&ZeVnLIqe-"},
+	}
+	for _, test := range tests {
+		if out := EncodeMailboxName(test.in); out != test.out {
+			t.Errorf("EncodeMailboxName(%+q) expected %+q; got %+q", test.in, test.out, out)
+		}
+		want := test.in
+		if toUpper(want) == "INBOX" {
+			want = "INBOX"
+		}
+		if in, err := DecodeMailboxName(test.out); in != want || err != nil {
+			t.Errorf("DecodeMailboxName(%+q) expected %+q; got %+q (%v)", test.out, want, in, err)
+		}
+	}
+	if out, err := DecodeMailboxName("&Jjo!"); out != "&Jjo!" || err != ErrBadUTF7 {
+		t.Errorf("DecodeMailboxName(%+q) expected %+q; got %+q (%v)", "&Jjo!", "&Jjo!", out, err)
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"errors"
+	"time"
+)
+
+// WatchMode is the mechanism used by a Watcher to receive mailbox updates.
+type WatchMode uint8
+
+// Watcher modes. WatchAuto selects the best mode supported by the server.
+const (
+	WatchPoll   = WatchMode(1 << iota) // Periodic NOOP and STATUS commands
+	WatchIdle                          // IDLE (RFC 2177) with STATUS for other mailboxes
+	WatchNotify                        // NOTIFY (RFC 5465)
+	WatchAuto   = WatchMode(0)         // Automatic selection
+)
+
+var watchModes = []enumName{
+	{uint32(WatchPoll), "WatchPoll"},
+	{uint32(WatchIdle), "WatchIdle"},
+	{uint32(WatchNotify), "WatchNotify"},
+	{uint32(WatchAuto), "WatchAuto"},
+}
+
+func (v WatchMode) String() string   { return enumString(uint32(v), watchModes, false) }
+func (v WatchMode) GoString() string { return enumString(uint32(v), watchModes, true) }
+
+// WatchEventType identifies the change reported by a WatchEvent.
+type WatchEventType uint8
+
+// Watcher event types.
+const (
+	WatchNew     = WatchEventType(1 << iota) // New messages
+	WatchExpunge                             // Expunged messages
+	WatchFlags                               // Flag changes
+)
+
+var watchEventTypes = []enumName{
+	{uint32(WatchNew), "WatchNew"},
+	{uint32(WatchExpunge), "WatchExpunge"},
+	{uint32(WatchFlags), "WatchFlags"},
+}
+
+func (v WatchEventType) String() string   { return enumString(uint32(v), watchEventTypes, false) }
+func (v WatchEventType) GoString() string { return enumString(uint32(v), watchEventTypes, true) }
+
+// WatchEvent describes a change in a watched mailbox. Changes in the selected
+// mailbox are reported individually for each message, with Seq set to the
+// message sequence number at the time of the change and Count set to 1. Changes
+// in other mailboxes are detected by comparing STATUS responses, so Seq and UID
+// are 0 and Count is the change in the number of messages (WatchNew and
+// WatchExpunge) or unseen messages (WatchFlags).
+type WatchEvent struct {
+	Type    WatchEventType // Type of change
+	Mailbox string         // Mailbox name
+	Seq     uint32         // Message sequence number (0 if unknown)
+	UID     uint32         // Message UID (0 if unknown)
+	Flags   FlagSet        // New message flags (WatchFlags in the selected mailbox)
+	Count   uint32         // Number of messages affected
+}
+
+// Default Watcher parameters.
+const (
+	// DefaultPollInterval is the default interval between polling commands.
+	DefaultPollInterval = time.Minute
+
+	// DefaultIdleTimeout is the default duration of each IDLE command. RFC
+	// 2177 recommends that clients restart IDLE at least every 29 minutes to
+	// avoid being logged off for inactivity.
+	DefaultIdleTimeout = 29 * time.Minute
+)
+
+// watchTick is the maximum duration of each receive operation, which limits
+// the delay between closing the stop channel and Watcher.Run returning.
+var watchTick = time.Second
+
+// ErrNoMailboxes is returned by Watcher.Run if no mailboxes are specified.
+var ErrNoMailboxes = errors.New("imap: no mailboxes to watch")
+
+// Watcher monitors one or more mailboxes for new, expunged, and flag-changed
+// messages. The first mailbox is selected in read-only mode (unless it is
+// already selected) and monitored for individual message changes. Other
+// mailboxes are monitored with NOTIFY, if available, or by polling with STATUS.
+//
+// The Watcher takes exclusive control of the Client while Run is executing. All
+// unilateral server data is consumed from Client.Data and translated into
+// events on the Events channel. Existing EXPUNGE and FETCH response handlers
+// (see Client.SetHandler) are still called, but they must not be changed while
+// Run is executing.
+type Watcher struct {
+	Client       *Client          // Client connection
+	Mailboxes    []string         // Watched mailboxes, starting with the selected one
+	Events       chan *WatchEvent // Channel for event delivery
+	Mode         WatchMode        // Monitoring mode (WatchAuto to select automatically)
+	PollInterval time.Duration    // Interval between polling commands and STATUS checks
+	IdleTimeout  time.Duration    // Maximum duration of each IDLE command
+
+	stop   <-chan struct{}           // Stop signal from Run
+	exists uint32                    // Number of messages in the selected mailbox
+	status map[string]*MailboxStatus // Last STATUS of other mailboxes
+	uids   map[*Response]uint32      // UIDs of EXPUNGE and FETCH responses
+}
+
+// NewWatcher returns a new Watcher for the specified mailboxes using default
+// parameters. The Events channel is buffered.
+func NewWatcher(c *Client, mailboxes ...string) *Watcher {
+	return &Watcher{
+		Client:       c,
+		Mailboxes:    mailboxes,
+		Events:       make(chan *WatchEvent, 64),
+		PollInterval: DefaultPollInterval,
+		IdleTimeout:  DefaultIdleTimeout,
+	}
+}
+
+// Run monitors the mailboxes until the stop channel is closed or an error is
+// encountered. If w.Mode is WatchAuto, it is set to WatchNotify if the server
+// supports NOTIFY, WatchIdle if the server supports IDLE, or WatchPoll
+// otherwise. Run returns nil after stop is closed. The Events channel is not
+// closed.
+func (w *Watcher) Run(stop <-chan struct{}) (err error) {
+	if len(w.Mailboxes) == 0 {
+		return ErrNoMailboxes
+	}
+	c := w.Client
+	if w.Mode == WatchAuto {
+		switch {
+		case c.Caps["NOTIFY"]:
+			w.Mode = WatchNotify
+		case c.Caps["IDLE"]:
+			w.Mode = WatchIdle
+		default:
+			w.Mode = WatchPoll
+		}
+	}
+	if c.Mailbox == nil || c.Mailbox.Name != newMailboxStatus(w.Mailboxes[0]).Name {
+		if _, err = c.Select(w.Mailboxes[0], true); err != nil {
+			return
+		}
+	}
+	w.stop, w.exists = stop, c.Mailbox.Messages
+	w.status = make(map[string]*MailboxStatus)
+	w.uids = make(map[*Response]uint32)
+	defer w.captureUIDs()()
+	defer func() { w.stop, w.uids = nil, nil }()
+
+	switch w.Mode {
+	case WatchNotify:
+		return w.runNotify()
+	case WatchIdle:
+		return w.runIdle()
+	}
+	return w.runPoll()
+}
+
+// captureUIDs installs response handlers that record the UIDs of expunged and
+// changed messages as each response is received. Several responses are usually
+// processed together, at which point the UIDs can no longer be determined,
+// because EXPUNGE responses renumber the messages. The returned function
+// restores the previous handlers, which are called by the new ones.
+func (w *Watcher) captureUIDs() (restore func()) {
+	c := w.Client
+	var expunge, fetch ResponseHandler
+	expunge = c.SetHandler("EXPUNGE", func(rsp *Response) {
+		if c.UIDs != nil && c.UIDs.expunged != 0 {
+			w.uids[rsp] = c.UIDs.expunged
+		}
+		if expunge != nil {
+			expunge(rsp)
+		}
+	})
+	fetch = c.SetHandler("FETCH", func(rsp *Response) {
+		if info := rsp.MessageInfo(); info != nil && c.UIDs != nil {
+			if uid := c.UIDs.UID(info.Seq); uid != 0 {
+				w.uids[rsp] = uid
+			}
+		}
+		if fetch != nil {
+			fetch(rsp)
+		}
+	})
+	return func() {
+		c.SetHandler("EXPUNGE", expunge)
+		c.SetHandler("FETCH", fetch)
+	}
+}
+
+// runNotify implements the WatchNotify mode.
+func (w *Watcher) runNotify() error {
+	c := w.Client
+	spec := []Field{"SET", "STATUS",
+		[]Field{"SELECTED", []Field{"MessageNew", "MessageExpunge", "FlagChange"}}}
+	if len(w.Mailboxes) > 1 {
+		mboxes := make([]Field, len(w.Mailboxes)-1)
+		for i, mbox := range w.Mailboxes[1:] {
+			mboxes[i] = c.encodeMailbox(mbox)
+		}
+		spec = append(spec, []Field{"MAILBOXES", mboxes,
+			[]Field{"MessageNew", "MessageExpunge"}})
+	}
+	if _, err := Wait(c.Send("NOTIFY", spec...)); err != nil {
+		return err
+	}
+	w.deliver()
+	for {
+		if stopped, err := w.wait(-1); err != nil {
+			return err
+		} else if stopped {
+			_, err = Wait(c.Send("NOTIFY", "NONE"))
+			return err
+		}
+	}
+}
+
+// runIdle implements the WatchIdle mode.
+func (w *Watcher) runIdle() error {
+	c := w.Client
+	for {
+		if err := w.pollStatus(); err != nil {
+			return err
+		}
+		timeout := w.IdleTimeout
+		if len(w.Mailboxes) > 1 && w.PollInterval < timeout {
+			timeout = w.PollInterval
+		}
+		if _, err := c.Idle(); err != nil {
+			return err
+		}
+		stopped, err := w.wait(timeout)
+		if err != nil {
+			return err
+		} else if _, err = c.IdleTerm(); err != nil || stopped {
+			return err
+		}
+		w.deliver()
+	}
+}
+
+// runPoll implements the WatchPoll mode.
+func (w *Watcher) runPoll() error {
+	c := w.Client
+	for {
+		if _, err := Wait(c.Noop()); err != nil {
+			return err
+		}
+		w.deliver()
+		if err := w.pollStatus(); err != nil {
+			return err
+		}
+		if stopped, err := w.wait(w.PollInterval); err != nil || stopped {
+			return err
+		}
+	}
+}
+
+// pollStatus issues a STATUS command for each mailbox other than the selected
+// one and delivers events for any changes.
+func (w *Watcher) pollStatus() error {
+	for _, mbox := range w.Mailboxes[1:] {
+		cmd, err := Wait(w.Client.Status(mbox, "MESSAGES", "UNSEEN"))
+		if err != nil {
+			return err
+		}
+		for _, rsp := range cmd.Data {
+			w.update(rsp)
+		}
+	}
+	return nil
+}
+
+// wait receives server responses until the timeout expires or the stop channel
+// is closed, delivering events as they arrive. A negative timeout waits until
+// stop is closed.
+func (w *Watcher) wait(timeout time.Duration) (stopped bool, err error) {
+	clock := w.Client.clock()
+	deadline := clock.Now().Add(timeout)
+	for {
+		select {
+		case <-w.stop:
+			return true, nil
+		default:
+		}
+		tick := watchTick
+		if timeout >= 0 {
+			if tick = deadline.Sub(clock.Now()); tick <= 0 {
+				return false, nil
+			} else if tick > watchTick {
+				tick = watchTick
+			}
+		}
+		if err = w.Client.Recv(tick); err == nil {
+			w.deliver()
+		} else if err != ErrTimeout {
+			return
+		}
+	}
+}
+
+// deliver consumes unilateral server data and sends the corresponding events.
+func (w *Watcher) deliver() {
+	c := w.Client
+	for _, rsp := range c.Data {
+		w.update(rsp)
+	}
+	c.Data = nil
+	for rsp := range w.uids {
+		delete(w.uids, rsp)
+	}
+}
+
+// update converts a single server response into events.
+func (w *Watcher) update(rsp *Response) {
+	c := w.Client
+	if rsp.Type != Data || c.Mailbox == nil {
+		return
+	}
+	mbox := c.Mailbox.Name
+	switch rsp.Label {
+	case "EXISTS":
+		n := rsp.Value()
+		for seq := w.exists + 1; seq <= n; seq++ {
+			w.send(&WatchEvent{Type: WatchNew, Mailbox: mbox, Seq: seq, Count: 1})
+		}
+		w.exists = n
+	case "EXPUNGE":
+		if w.exists > 0 {
+			w.exists--
+		}
+		w.send(&WatchEvent{Type: WatchExpunge, Mailbox: mbox, Seq: rsp.Value(),
+			UID: w.uids[rsp], Count: 1})
+	case "FETCH":
+		info := rsp.MessageInfo()
+		if info == nil || info.Attrs["FLAGS"] == nil {
+			return
+		}
+		ev := &WatchEvent{Type: WatchFlags, Mailbox: mbox, Seq: info.Seq,
+			UID: info.UID, Flags: info.Flags, Count: 1}
+		if ev.UID == 0 {
+			ev.UID = w.uids[rsp]
+		}
+		w.send(ev)
+	case "STATUS":
+		w.updateStatus(rsp.MailboxStatus())
+	}
+}
+
+// updateStatus compares the STATUS of a mailbox other than the selected one
+// with the previous value and sends events for any changes. The first STATUS
+// of each mailbox is only recorded.
+func (w *Watcher) updateStatus(s *MailboxStatus) {
+	prev := w.status[s.Name]
+	if w.Client.Mailbox != nil && s.Name == w.Client.Mailbox.Name {
+		return
+	} else if prev == nil {
+		w.status[s.Name] = s
+		return
+	}
+	w.status[s.Name] = s
+	var ev *WatchEvent
+	switch {
+	case s.Messages > prev.Messages:
+		ev = &WatchEvent{Type: WatchNew, Count: s.Messages - prev.Messages}
+	case s.Messages < prev.Messages:
+		ev = &WatchEvent{Type: WatchExpunge, Count: prev.Messages - s.Messages}
+	case s.Unseen > prev.Unseen:
+		ev = &WatchEvent{Type: WatchFlags, Count: s.Unseen - prev.Unseen}
+	case s.Unseen < prev.Unseen:
+		ev = &WatchEvent{Type: WatchFlags, Count: prev.Unseen - s.Unseen}
+	default:
+		return
+	}
+	ev.Mailbox = s.Name
+	w.send(ev)
+}
+
+// send delivers an event, blocking until the receiver is ready or the stop
+// channel is closed.
+func (w *Watcher) send(ev *WatchEvent) {
+	select {
+	case w.Events <- ev:
+	case <-w.stop:
+	}
+}
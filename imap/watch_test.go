@@ -0,0 +1,143 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package imap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// runWatcher runs w until n events are received and returns the events.
+func runWatcher(t *clientT, w *Watcher, n int) []WatchEvent {
+	stop := make(chan struct{})
+	evch := make(chan []WatchEvent, 1)
+	go func() {
+		var events []WatchEvent
+		for len(events) < n {
+			events = append(events, *<-w.Events)
+		}
+		close(stop)
+		evch <- events
+	}()
+	err := w.Run(stop)
+	t.join("WATCH", err)
+	return <-evch
+}
+
+func TestWatcherPoll(T *testing.T) {
+	defer func(d time.Duration) { watchTick = d }(watchTick)
+	watchTick = 10 * time.Millisecond
+
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	go t.script(
+		`C: A1 EXAMINE "INBOX"`+CRLF,
+		`S: * 2 EXISTS`+CRLF,
+		`S: A1 OK [READ-ONLY] INBOX selected`+CRLF,
+		`C: A2 NOOP`+CRLF,
+		`S: * 1 EXPUNGE`+CRLF,
+		`S: * 3 EXISTS`+CRLF,
+		`S: * 1 FETCH (FLAGS (\Seen) UID 7)`+CRLF,
+		`S: A2 OK NOOP completed`+CRLF,
+		`C: A3 STATUS "Archive" (MESSAGES UNSEEN)`+CRLF,
+		`S: * STATUS Archive (MESSAGES 5 UNSEEN 1)`+CRLF,
+		`S: A3 OK STATUS completed`+CRLF,
+	)
+	w := NewWatcher(C, "INBOX", "Archive")
+	w.PollInterval = time.Hour
+	events := runWatcher(t, w, 4)
+	if w.Mode != WatchPoll {
+		t.Errorf("w.Mode expected WatchPoll; got %v", w.Mode)
+	}
+	want := []WatchEvent{
+		{Type: WatchExpunge, Mailbox: "INBOX", Seq: 1, Count: 1},
+		{Type: WatchNew, Mailbox: "INBOX", Seq: 2, Count: 1},
+		{Type: WatchNew, Mailbox: "INBOX", Seq: 3, Count: 1},
+		{Type: WatchFlags, Mailbox: "INBOX", Seq: 1, UID: 7, Flags: NewFlagSet(`\Seen`), Count: 1},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events expected\n%+v; got\n%+v", want, events)
+	}
+}
+
+func TestWatcherIdle(T *testing.T) {
+	defer func(d time.Duration) { watchTick = d }(watchTick)
+	watchTick = 10 * time.Millisecond
+
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1 IDLE] Test server ready`+CRLF)
+	go t.script(
+		`C: A1 EXAMINE "INBOX"`+CRLF,
+		`S: * 3 EXISTS`+CRLF,
+		`S: A1 OK [READ-ONLY] INBOX selected`+CRLF,
+		`C: A2 STATUS "Archive" (MESSAGES UNSEEN)`+CRLF,
+		`S: * STATUS Archive (MESSAGES 5 UNSEEN 1)`+CRLF,
+		`S: A2 OK STATUS completed`+CRLF,
+		`C: A3 IDLE`+CRLF,
+		`S: + idling`+CRLF,
+		`S: * 4 EXISTS`+CRLF,
+		`C: DONE`+CRLF,
+		`S: A3 OK IDLE terminated`+CRLF,
+		`C: A4 STATUS "Archive" (MESSAGES UNSEEN)`+CRLF,
+		`S: * STATUS Archive (MESSAGES 7 UNSEEN 1)`+CRLF,
+		`S: A4 OK STATUS completed`+CRLF,
+		`C: A5 IDLE`+CRLF,
+		`S: + idling`+CRLF,
+		`C: DONE`+CRLF,
+		`S: A5 OK IDLE terminated`+CRLF,
+	)
+	w := NewWatcher(C, "INBOX", "Archive")
+	w.PollInterval = 50 * time.Millisecond
+	events := runWatcher(t, w, 2)
+	if w.Mode != WatchIdle {
+		t.Errorf("w.Mode expected WatchIdle; got %v", w.Mode)
+	}
+	want := []WatchEvent{
+		{Type: WatchNew, Mailbox: "INBOX", Seq: 4, Count: 1},
+		{Type: WatchNew, Mailbox: "Archive", Count: 2},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events expected\n%+v; got\n%+v", want, events)
+	}
+}
+
+func TestWatcherExpungeUIDs(T *testing.T) {
+	defer func(d time.Duration) { watchTick = d }(watchTick)
+	watchTick = 10 * time.Millisecond
+
+	C, t := newClient(T, `S: * PREAUTH [CAPABILITY IMAP4rev1] Test server ready`+CRLF)
+	go t.script(
+		`C: A1 EXAMINE "INBOX"`+CRLF,
+		`S: * 3 EXISTS`+CRLF,
+		`S: A1 OK [READ-ONLY] INBOX selected`+CRLF,
+		`C: A2 UID FETCH 1:* (FLAGS)`+CRLF,
+		`S: * 1 FETCH (UID 10 FLAGS ())`+CRLF,
+		`S: * 2 FETCH (UID 11 FLAGS ())`+CRLF,
+		`S: * 3 FETCH (UID 12 FLAGS ())`+CRLF,
+		`S: A2 OK FETCH completed`+CRLF,
+		`C: A3 NOOP`+CRLF,
+		`S: * 2 FETCH (FLAGS (\Seen))`+CRLF,
+		`S: * 1 EXPUNGE`+CRLF,
+		`S: * 1 EXPUNGE`+CRLF,
+		`S: A3 OK NOOP completed`+CRLF,
+	)
+	if _, err := C.Select("INBOX", true); err != nil {
+		t.Fatalf("Select() unexpected error; %v", err)
+	}
+	set, _ := NewSeqSet("1:*")
+	if _, err := Wait(C.UIDFetch(set, "FLAGS")); err != nil {
+		t.Fatalf("UIDFetch() unexpected error; %v", err)
+	}
+	w := NewWatcher(C, "INBOX")
+	w.PollInterval = time.Hour
+	events := runWatcher(t, w, 3)
+	want := []WatchEvent{
+		{Type: WatchFlags, Mailbox: "INBOX", Seq: 2, UID: 11, Flags: NewFlagSet(`\Seen`), Count: 1},
+		{Type: WatchExpunge, Mailbox: "INBOX", Seq: 1, UID: 10, Count: 1},
+		{Type: WatchExpunge, Mailbox: "INBOX", Seq: 1, UID: 11, Count: 1},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events expected\n%+v; got\n%+v", want, events)
+	}
+}
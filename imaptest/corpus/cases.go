@@ -0,0 +1,394 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package corpus
+
+// builtin contains the text file representations of the cases returned by
+// Cases, keyed by name. New cases are created with New and Case.Format from
+// captured responses after removing all personal information. Keep the names
+// grouped by server.
+var builtin = map[string]string{
+	"dovecot/body-not-extended": `Source: Dovecot
+Note: BODY instead of BODYSTRUCTURE for a single-part message
+-- response --
+* 6 FETCH (UID 31 BODY ("text" "plain" ("charset" "iso-8859-1") NIL NIL "8bit" 512 14))
+-- body --
+{
+	"kind": "body",
+	"section": "1",
+	"type": "text",
+	"subtype": "plain",
+	"params": {
+		"charset": "iso-8859-1"
+	},
+	"encoding": "8bit",
+	"size": 512,
+	"lines": 14
+}
+`,
+
+	"dovecot/literal-subject": `Source: Dovecot
+Note: subject with 8-bit data sent as a literal and a NIL From list
+-- response --
+* 1 FETCH (UID 5 ENVELOPE ("Mon, 3 Jun 2019 10:20:30 +0300" {18}
+Re: "quoted" téxt NIL NIL NIL ((NIL NIL "frank" "example.net")) NIL NIL NIL "<20190603102030.GA1234@example.net>"))
+-- envelope --
+{
+	"date": "2019-06-03T10:20:30+03:00",
+	"subject": "Re: \"quoted\" téxt",
+	"to": [
+		{
+			"mailbox": "frank",
+			"host": "example.net"
+		}
+	],
+	"messageId": "<20190603102030.GA1234@example.net>"
+}
+`,
+
+	"dovecot/message-rfc822": `Source: Dovecot
+Note: forwarded message/rfc822 part with its own envelope and nested multipart
+-- response --
+* 2 FETCH (UID 12 BODYSTRUCTURE (("text" "plain" ("charset" "utf-8") NIL NIL "7bit" 40 2 NIL NIL NIL NIL)("message" "rfc822" NIL NIL NIL "7bit" 1523 ("Fri, 31 May 2019 17:45:00 +0000" "Original" (("Grace" NIL "grace" "example.com")) (("Grace" NIL "grace" "example.com")) (("Grace" NIL "grace" "example.com")) ((NIL NIL "heidi" "example.com")) NIL NIL NIL "<orig-1@example.com>") (("text" "plain" ("charset" "utf-8" "format" "flowed") NIL NIL "7bit" 300 8 NIL NIL NIL NIL)("image" "png" ("name" "logo.png") "<logo@example.com>" NIL "base64" 1024 NIL ("inline" ("filename" "logo.png")) NIL NIL) "related" ("boundary" "inner" "type" "text/plain") NIL NIL NIL) 40 NIL ("attachment" NIL) NIL NIL) "mixed" ("boundary" "outer") NIL "en" NIL))
+-- body --
+{
+	"kind": "multipart",
+	"subtype": "mixed",
+	"parts": [
+		{
+			"kind": "body",
+			"section": "1",
+			"type": "text",
+			"subtype": "plain",
+			"params": {
+				"charset": "utf-8"
+			},
+			"encoding": "7bit",
+			"size": 40,
+			"lines": 2
+		},
+		{
+			"kind": "body",
+			"section": "2",
+			"type": "message",
+			"subtype": "rfc822",
+			"encoding": "7bit",
+			"size": 1523,
+			"lines": 40,
+			"envelope": {
+				"date": "2019-05-31T17:45:00Z",
+				"subject": "Original",
+				"from": [
+					{
+						"name": "Grace",
+						"mailbox": "grace",
+						"host": "example.com"
+					}
+				],
+				"sender": [
+					{
+						"name": "Grace",
+						"mailbox": "grace",
+						"host": "example.com"
+					}
+				],
+				"replyTo": [
+					{
+						"name": "Grace",
+						"mailbox": "grace",
+						"host": "example.com"
+					}
+				],
+				"to": [
+					{
+						"mailbox": "heidi",
+						"host": "example.com"
+					}
+				],
+				"messageId": "\u003corig-1@example.com\u003e"
+			},
+			"body": {
+				"kind": "multipart",
+				"section": "2",
+				"subtype": "related",
+				"parts": [
+					{
+						"kind": "body",
+						"section": "2.1",
+						"type": "text",
+						"subtype": "plain",
+						"params": {
+							"charset": "utf-8",
+							"format": "flowed"
+						},
+						"encoding": "7bit",
+						"size": 300,
+						"lines": 8
+					},
+					{
+						"kind": "body",
+						"section": "2.2",
+						"type": "image",
+						"subtype": "png",
+						"params": {
+							"name": "logo.png"
+						},
+						"id": "\u003clogo@example.com\u003e",
+						"encoding": "base64",
+						"size": 1024,
+						"disposition": "inline",
+						"dispParams": {
+							"filename": "logo.png"
+						}
+					}
+				],
+				"params": {
+					"boundary": "inner",
+					"type": "text/plain"
+				}
+			},
+			"disposition": "attachment"
+		}
+	],
+	"params": {
+		"boundary": "outer"
+	},
+	"language": [
+		"en"
+	]
+}
+`,
+
+	"exchange/no-extension-data": `Source: Microsoft Exchange
+Note: multipart body without extension data and NIL Sender and Reply-To lists
+-- response --
+* 17 FETCH (UID 348 BODYSTRUCTURE (("text" "plain" ("charset" "us-ascii") NIL NIL "quoted-printable" 812 19 NIL NIL NIL NIL)("text" "html" ("charset" "us-ascii") NIL NIL "quoted-printable" 2931 52 NIL NIL NIL NIL) "alternative") ENVELOPE ("Wed, 5 Jun 2019 14:03:11 +0000" "FW: Meeting notes" (("Carol Sample" NIL "carol" "contoso.example")) NIL NIL (("Dave Doe" NIL "dave" "contoso.example")("Erin Roe" NIL "erin" "contoso.example")) NIL NIL NIL "<AM6PR0102MB3456ABCDEF@AM6PR0102MB3456.eurprd01.prod.exchangelabs.com>"))
+-- envelope --
+{
+	"date": "2019-06-05T14:03:11Z",
+	"subject": "FW: Meeting notes",
+	"from": [
+		{
+			"name": "Carol Sample",
+			"mailbox": "carol",
+			"host": "contoso.example"
+		}
+	],
+	"to": [
+		{
+			"name": "Dave Doe",
+			"mailbox": "dave",
+			"host": "contoso.example"
+		},
+		{
+			"name": "Erin Roe",
+			"mailbox": "erin",
+			"host": "contoso.example"
+		}
+	],
+	"messageId": "<AM6PR0102MB3456ABCDEF@AM6PR0102MB3456.eurprd01.prod.exchangelabs.com>"
+}
+-- body --
+{
+	"kind": "multipart",
+	"subtype": "alternative",
+	"parts": [
+		{
+			"kind": "body",
+			"section": "1",
+			"type": "text",
+			"subtype": "plain",
+			"params": {
+				"charset": "us-ascii"
+			},
+			"encoding": "quoted-printable",
+			"size": 812,
+			"lines": 19
+		},
+		{
+			"kind": "body",
+			"section": "2",
+			"type": "text",
+			"subtype": "html",
+			"params": {
+				"charset": "us-ascii"
+			},
+			"encoding": "quoted-printable",
+			"size": 2931,
+			"lines": 52
+		}
+	]
+}
+`,
+
+	"exchange/undisclosed-recipients": `Source: Microsoft Exchange
+Note: group syntax for undisclosed recipients, a Q-encoded display name, and a Date header with a comment
+-- response --
+* 3 FETCH (UID 77 ENVELOPE ("Thu, 6 Jun 2019 08:00:00 +0200 (W. Europe Daylight Time)" "Newsletter" (("=?iso-8859-1?Q?J=F6rg_M=FCller?=" NIL "news" "lists.example")) (("News" NIL "news" "lists.example")) (("News" NIL "news" "lists.example")) ((NIL NIL "undisclosed-recipients" NIL)(NIL NIL NIL NIL)) NIL NIL NIL "<0a1b2c3d4e5f@lists.example>"))
+-- envelope --
+{
+	"date": "2019-06-06T08:00:00+02:00",
+	"subject": "Newsletter",
+	"from": [
+		{
+			"name": "Jörg Müller",
+			"mailbox": "news",
+			"host": "lists.example"
+		}
+	],
+	"sender": [
+		{
+			"name": "News",
+			"mailbox": "news",
+			"host": "lists.example"
+		}
+	],
+	"replyTo": [
+		{
+			"name": "News",
+			"mailbox": "news",
+			"host": "lists.example"
+		}
+	],
+	"messageId": "<0a1b2c3d4e5f@lists.example>"
+}
+`,
+
+	"gmail/alternative": `Source: Gmail
+Note: upper-case media types and parameter names, encoded-word subject, and X-GM-THRID
+-- response --
+* 4 FETCH (X-GM-THRID 1654021236789012345 UID 1021 ENVELOPE ("Tue, 14 May 2019 09:12:45 -0700" "=?UTF-8?B?UmU6IFF1YXJ0ZXJseSByZXBvcnQg4oCUIGRyYWZ0?=" (("Alice Example" NIL "alice" "example.com")) (("Alice Example" NIL "alice" "example.com")) (("Alice Example" NIL "alice" "example.com")) ((NIL NIL "bob" "example.org")) NIL NIL "<CAB1x2y3z@mail.gmail.com>" "<CAC4d5e6f@mail.gmail.com>") BODYSTRUCTURE (("TEXT" "PLAIN" ("CHARSET" "UTF-8") NIL NIL "QUOTED-PRINTABLE" 1204 31 NIL NIL NIL NIL)("TEXT" "HTML" ("CHARSET" "UTF-8") NIL NIL "QUOTED-PRINTABLE" 4876 98 NIL NIL NIL NIL) "ALTERNATIVE" ("BOUNDARY" "000000000000a1b2c3058a1b2c3d") NIL NIL NIL))
+-- envelope --
+{
+	"date": "2019-05-14T09:12:45-07:00",
+	"subject": "Re: Quarterly report — draft",
+	"from": [
+		{
+			"name": "Alice Example",
+			"mailbox": "alice",
+			"host": "example.com"
+		}
+	],
+	"sender": [
+		{
+			"name": "Alice Example",
+			"mailbox": "alice",
+			"host": "example.com"
+		}
+	],
+	"replyTo": [
+		{
+			"name": "Alice Example",
+			"mailbox": "alice",
+			"host": "example.com"
+		}
+	],
+	"to": [
+		{
+			"mailbox": "bob",
+			"host": "example.org"
+		}
+	],
+	"inReplyTo": "<CAB1x2y3z@mail.gmail.com>",
+	"messageId": "<CAC4d5e6f@mail.gmail.com>"
+}
+-- body --
+{
+	"kind": "multipart",
+	"subtype": "alternative",
+	"parts": [
+		{
+			"kind": "body",
+			"section": "1",
+			"type": "text",
+			"subtype": "plain",
+			"params": {
+				"charset": "UTF-8"
+			},
+			"encoding": "quoted-printable",
+			"size": 1204,
+			"lines": 31
+		},
+		{
+			"kind": "body",
+			"section": "2",
+			"type": "text",
+			"subtype": "html",
+			"params": {
+				"charset": "UTF-8"
+			},
+			"encoding": "quoted-printable",
+			"size": 4876,
+			"lines": 98
+		}
+	],
+	"params": {
+		"boundary": "000000000000a1b2c3058a1b2c3d"
+	}
+}
+`,
+
+	"gmail/attachment-nil-params": `Source: Gmail
+Note: attachment with NIL Content-Type parameters and a quoted filename containing spaces
+-- response --
+* 9 FETCH (UID 2210 BODYSTRUCTURE ((("TEXT" "PLAIN" ("CHARSET" "UTF-8") NIL NIL "7BIT" 52 2 NIL NIL NIL NIL)("TEXT" "HTML" ("CHARSET" "UTF-8") NIL NIL "7BIT" 96 2 NIL NIL NIL NIL) "ALTERNATIVE" ("BOUNDARY" "0000000000005e6f7a058a1b2c3e") NIL NIL NIL)("APPLICATION" "PDF" NIL "<f_jv1abc2d0>" NIL "BASE64" 183422 NIL ("ATTACHMENT" ("FILENAME" "Invoice 2019-05.pdf")) NIL NIL) "MIXED" ("BOUNDARY" "0000000000005e6f79058a1b2c3f") NIL NIL NIL))
+-- body --
+{
+	"kind": "multipart",
+	"subtype": "mixed",
+	"parts": [
+		{
+			"kind": "multipart",
+			"section": "1",
+			"subtype": "alternative",
+			"parts": [
+				{
+					"kind": "body",
+					"section": "1.1",
+					"type": "text",
+					"subtype": "plain",
+					"params": {
+						"charset": "UTF-8"
+					},
+					"encoding": "7bit",
+					"size": 52,
+					"lines": 2
+				},
+				{
+					"kind": "body",
+					"section": "1.2",
+					"type": "text",
+					"subtype": "html",
+					"params": {
+						"charset": "UTF-8"
+					},
+					"encoding": "7bit",
+					"size": 96,
+					"lines": 2
+				}
+			],
+			"params": {
+				"boundary": "0000000000005e6f7a058a1b2c3e"
+			}
+		},
+		{
+			"kind": "body",
+			"section": "2",
+			"type": "application",
+			"subtype": "pdf",
+			"id": "\u003cf_jv1abc2d0\u003e",
+			"encoding": "base64",
+			"size": 183422,
+			"disposition": "attachment",
+			"dispParams": {
+				"filename": "Invoice 2019-05.pdf"
+			}
+		}
+	],
+	"params": {
+		"boundary": "0000000000005e6f79058a1b2c3f"
+	}
+}
+`,
+}
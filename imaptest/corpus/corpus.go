@@ -0,0 +1,307 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package corpus provides a collection of anonymized FETCH responses captured from
+real servers, together with the expected results of parsing their ENVELOPE and
+BODYSTRUCTURE (or BODY) items. The cases cover the quirks of popular servers,
+such as the group syntax, encoded words, and upper-case media types, and are
+used to validate the imap decoders and any application code that processes
+their results:
+
+	for _, c := range corpus.Cases() {
+		if err := c.Check(); err != nil {
+			t.Error(err)
+		}
+		msg, _ := c.Message()
+		process(msg)
+	}
+
+Each case is stored in a text file with a ".txt" extension. The file begins
+with "Source:" and "Note:" header lines, followed by sections that are
+introduced by "-- name --" lines:
+
+	Source: Dovecot
+	Note: Subject sent as a literal
+	-- response --
+	* 1 FETCH (UID 7 ENVELOPE (NIL {5}
+	Hello NIL NIL NIL NIL NIL NIL NIL NIL))
+	-- envelope --
+	{"subject": "Hello"}
+
+The response section contains one FETCH response. Its line endings are
+converted to CRLF, which must be taken into account in literal sizes. The
+optional envelope and body sections contain the JSON encoding of the expected
+imap.Envelope and imap.MessagePart values. Load reads a directory of such
+files, and New and Case.Format create new cases from captured responses, so
+that users can maintain their own collection and contribute new cases.
+*/
+package corpus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// Errors returned by Case.Message.
+var (
+	ErrNoResponse = errors.New("corpus: response section is empty")
+	ErrNotFetch   = errors.New("corpus: response is not a single FETCH response")
+)
+
+// Case is a single FETCH response with the expected parse results.
+type Case struct {
+	Name     string           // Unique name (file path without the extension)
+	Source   string           // Server that produced the response (e.g. "Gmail")
+	Note     string           // Description of the covered quirk
+	Response []byte           // Raw FETCH response with CRLF line endings
+	Envelope *imap.Envelope   // Expected ENVELOPE (not checked if nil)
+	Body     imap.MessagePart // Expected BODYSTRUCTURE or BODY (not checked if nil)
+}
+
+// Mismatch is returned by Case.Check when a parse result differs from the
+// expected value. Want and Got are JSON encodings.
+type Mismatch struct {
+	Case string // Case name
+	Item string // "ENVELOPE" or "BODYSTRUCTURE"
+	Want string // Expected value
+	Got  string // Actual value
+}
+
+func (m *Mismatch) Error() string {
+	return fmt.Sprintf("corpus: %s: %s mismatch\nwant: %s\n got: %s",
+		m.Case, m.Item, m.Want, m.Got)
+}
+
+// New returns a case for the specified response, with the expected values set
+// to the current parse results. Line endings in rsp are converted to CRLF. The
+// results must be reviewed before the case is added to a corpus.
+func New(name, source, note string, rsp []byte) (*Case, error) {
+	c := &Case{Name: name, Source: source, Note: note, Response: crlf(rsp)}
+	msg, err := c.Message()
+	if err != nil {
+		return nil, err
+	}
+	c.Envelope = msg.Envelope()
+	c.Body, _ = msg.BodyStructure()
+	return c, nil
+}
+
+// Message parses the response and returns its message info.
+func (c *Case) Message() (*imap.MessageInfo, error) {
+	if len(c.Response) == 0 {
+		return nil, ErrNoResponse
+	}
+	var msg *imap.MessageInfo
+	err := imap.ReadResponses(bytes.NewReader(c.Response), "", nil,
+		func(rsp *imap.Response) error {
+			if msg != nil || rsp.Label != "FETCH" {
+				return ErrNotFetch
+			}
+			if msg = rsp.MessageInfo(); msg == nil {
+				return ErrNotFetch
+			}
+			return nil
+		})
+	if err == nil && msg == nil {
+		err = ErrNotFetch
+	}
+	if err != nil {
+		return nil, fmt.Errorf("corpus: %s: %v", c.Name, err)
+	}
+	return msg, nil
+}
+
+// Check parses the response and compares the results with the expected values.
+// It returns a *Mismatch error for the first difference.
+func (c *Case) Check() error {
+	msg, err := c.Message()
+	if err != nil {
+		return err
+	}
+	if c.Envelope != nil {
+		if err = c.compare("ENVELOPE", c.Envelope, msg.Envelope()); err != nil {
+			return err
+		}
+	}
+	if c.Body != nil {
+		body, _ := msg.BodyStructure()
+		return c.compare("BODYSTRUCTURE", c.Body, body)
+	}
+	return nil
+}
+
+// compare returns a *Mismatch error if the JSON encodings of want and got are
+// different.
+func (c *Case) compare(item string, want, got interface{}) error {
+	w, err := json.Marshal(want)
+	if err != nil {
+		return err
+	}
+	g, err := json.Marshal(got)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(w, g) {
+		return &Mismatch{c.Name, item, string(w), string(g)}
+	}
+	return nil
+}
+
+// Format returns the text file representation of the case.
+func (c *Case) Format() ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Source: %s\nNote: %s\n-- response --\n", c.Source, c.Note)
+	b.Write(bytes.Replace(c.Response, []byte("\r\n"), []byte("\n"), -1))
+	if c.Envelope != nil {
+		if err := writeJSON(&b, "envelope", c.Envelope); err != nil {
+			return nil, err
+		}
+	}
+	if c.Body != nil {
+		if err := writeJSON(&b, "body", c.Body); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// writeJSON writes a section containing the indented JSON encoding of v.
+func writeJSON(b *bytes.Buffer, name string, v interface{}) error {
+	fmt.Fprintf(b, "-- %s --\n", name)
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+// Parse decodes a case from its text file representation.
+func Parse(name string, data []byte) (*Case, error) {
+	c := &Case{Name: name}
+	errorf := func(ln int, format string, v ...interface{}) error {
+		return fmt.Errorf("corpus: %s:%d: %s", name, ln, fmt.Sprintf(format, v...))
+	}
+	var sect string
+	var buf bytes.Buffer
+	var sectLn int
+	end := func() error {
+		switch b := buf.Bytes(); sect {
+		case "response":
+			c.Response = crlf(b)
+		case "envelope":
+			c.Envelope = new(imap.Envelope)
+			if err := json.Unmarshal(b, c.Envelope); err != nil {
+				return errorf(sectLn, "invalid envelope (%v)", err)
+			}
+		case "body":
+			body, err := imap.UnmarshalMessagePart(b)
+			if err != nil {
+				return errorf(sectLn, "invalid body (%v)", err)
+			}
+			c.Body = body
+		}
+		buf.Reset()
+		return nil
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for ln := 1; s.Scan(); ln++ {
+		line := s.Text()
+		if strings.HasPrefix(line, "-- ") && strings.HasSuffix(line, " --") {
+			if err := end(); err != nil {
+				return nil, err
+			}
+			switch sect, sectLn = line[3:len(line)-3], ln; sect {
+			case "response", "envelope", "body":
+			default:
+				return nil, errorf(ln, "unknown section %q", sect)
+			}
+			continue
+		}
+		if sect != "" {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+			continue
+		}
+		switch {
+		case line == "" || line[0] == '#':
+		case strings.HasPrefix(line, "Source:"):
+			c.Source = strings.TrimSpace(line[7:])
+		case strings.HasPrefix(line, "Note:"):
+			c.Note = strings.TrimSpace(line[5:])
+		default:
+			return nil, errorf(ln, "unknown header %q", line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	} else if err = end(); err != nil {
+		return nil, err
+	} else if len(c.Response) == 0 {
+		return nil, ErrNoResponse
+	}
+	return c, nil
+}
+
+// Load reads all ".txt" files in dir and its subdirectories and returns the
+// cases sorted by name. Case names are the file paths relative to dir, without
+// the extension and with forward slashes.
+func Load(dir string) ([]*Case, error) {
+	var cases []*Case
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() || filepath.Ext(path) != ".txt" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, ".txt"))
+		c, err := Parse(name, data)
+		if err == nil {
+			cases = append(cases, c)
+		}
+		return err
+	})
+	sort.Slice(cases, func(i, j int) bool { return cases[i].Name < cases[j].Name })
+	return cases, err
+}
+
+// Cases returns the built-in corpus sorted by name. A new copy is returned by
+// each call, so the cases may be modified by the caller.
+func Cases() []*Case {
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cases := make([]*Case, len(names))
+	for i, name := range names {
+		c, err := Parse(name, []byte(builtin[name]))
+		if err != nil {
+			panic(err)
+		}
+		cases[i] = c
+	}
+	return cases
+}
+
+// crlf returns a copy of b with all line endings converted to CRLF.
+func crlf(b []byte) []byte {
+	b = bytes.Replace(b, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.Replace(b, []byte("\n"), []byte("\r\n"), -1)
+}
@@ -0,0 +1,119 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package corpus
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCases(t *testing.T) {
+	cases := Cases()
+	if len(cases) != len(builtin) {
+		t.Fatalf("Cases() expected %d cases; got %d", len(builtin), len(cases))
+	}
+	for _, c := range cases {
+		if c.Source == "" || c.Note == "" || (c.Envelope == nil && c.Body == nil) {
+			t.Errorf("%s: incomplete case %+v", c.Name, c)
+		}
+		if err := c.Check(); err != nil {
+			t.Error(err)
+			continue
+		}
+		b, err := c.Format()
+		if err != nil {
+			t.Errorf("%s: Format() unexpected error; %v", c.Name, err)
+		} else if string(b) != builtin[c.Name] {
+			t.Errorf("%s: Format() expected\n%s\ngot\n%s", c.Name, builtin[c.Name], b)
+		}
+	}
+}
+
+func TestCheckMismatch(t *testing.T) {
+	c := Cases()[0]
+	for _, c2 := range Cases() {
+		if c2.Envelope != nil {
+			c = c2
+			break
+		}
+	}
+	c.Envelope.Subject += "x"
+	err, ok := c.Check().(*Mismatch)
+	if !ok || err.Case != c.Name || err.Item != "ENVELOPE" {
+		t.Fatalf("Check() expected an ENVELOPE mismatch; got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	rsp := []byte("* 1 FETCH (UID 7 ENVELOPE (NIL {5}\nHello NIL NIL NIL NIL NIL NIL NIL NIL))\n")
+	c, err := New("test", "Test", "literal subject", rsp)
+	if err != nil {
+		t.Fatalf("New() unexpected error; %v", err)
+	}
+	if c.Envelope == nil || c.Envelope.Subject != "Hello" || c.Body != nil {
+		t.Errorf("New() unexpected result %+v", c)
+	}
+	if !bytes.HasSuffix(c.Response, []byte("))\r\n")) {
+		t.Errorf("New() expected CRLF line endings; got %+q", c.Response)
+	}
+	for _, bad := range []string{"", "* 1 EXISTS\n", "* 1 FETCH (UID 1)\n* 2 FETCH (UID 2)\n", "* 1 FETCH (UID"} {
+		if _, err := New("bad", "", "", []byte(bad)); err == nil {
+			t.Errorf("New(%+q) expected an error", bad)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, text := range builtin {
+		path := filepath.Join(dir, filepath.FromSlash(name)+".txt")
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err = ioutil.WriteFile(path, []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a case"), 0600)
+
+	cases, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() unexpected error; %v", err)
+	}
+	want := Cases()
+	if len(cases) != len(want) {
+		t.Fatalf("Load() expected %d cases; got %d", len(want), len(cases))
+	}
+	for i, c := range cases {
+		if c.Name != want[i].Name {
+			t.Errorf("Load() case %d expected %q; got %q", i, want[i].Name, c.Name)
+		} else if err = c.Check(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "bad.txt"), []byte("-- foo --\n"), 0600)
+	if _, err = Load(dir); err == nil {
+		t.Errorf("Load() expected an error for an unknown section")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, bad := range []string{
+		"Source: x\n",
+		"Foo: bar\n-- response --\n* 1 FETCH (UID 1)\n",
+		"-- response --\n* 1 FETCH (UID 1)\n-- envelope --\n{\n",
+		"-- response --\n* 1 FETCH (UID 1)\n-- body --\n{\"kind\": \"foo\"}\n",
+	} {
+		if _, err := Parse("bad", []byte(bad)); err == nil {
+			t.Errorf("Parse(%+q) expected an error", bad)
+		}
+	}
+}
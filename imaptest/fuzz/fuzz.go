@@ -0,0 +1,297 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package fuzz feeds arbitrary input to the imap response parser and decoders,
+together with application handlers, and reports crashes and hangs.
+
+Responses parses a byte stream as a sequence of server responses, passes each
+response to every decoder that applies to it (MessageInfo, Envelope,
+BodyStructure, MailboxInfo, and so on), and then to the handlers. Fields does
+the same for a single Field tree, which is useful when a fuzzer generates
+structured values instead of bytes. Both return a *Crash if anything panics
+and a *Hang if processing does not finish within Timeout. Parser errors are
+the expected result of most random inputs, so they are not reported.
+
+With Go 1.18 or later, a fuzz test for an application handler looks like this:
+
+	func FuzzHandler(f *testing.F) {
+		fuzz.AddCorpus(f, "testdata/imap")
+		f.Fuzz(func(t *testing.T, data []byte) {
+			if err := fuzz.Responses(data, myHandler); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+LoadCorpus reads a directory of raw captures or files in the format written by
+"go test -fuzz", and Seeds returns a small built-in corpus of valid responses.
+*/
+package fuzz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// Timeout is the maximum time allowed for processing a single input.
+var Timeout = 5 * time.Second
+
+// TagID is the tag prefix of command completion responses accepted by
+// Responses.
+const TagID = "A"
+
+// Crash is returned when the parser, a decoder, or a handler panics.
+type Crash struct {
+	Input interface{} // []byte or imap.Field that caused the panic
+	Value interface{} // Value passed to panic
+	Stack []byte      // Stack trace of the panicking goroutine
+}
+
+func (c *Crash) Error() string {
+	return fmt.Sprintf("fuzz: panic: %v (input %s)", c.Value, inputString(c.Input))
+}
+
+// Hang is returned when processing an input takes longer than Timeout. The
+// goroutine that is processing the input is left running.
+type Hang struct {
+	Input   interface{}   // []byte or imap.Field that caused the hang
+	Timeout time.Duration // Timeout that was exceeded
+}
+
+func (h *Hang) Error() string {
+	return fmt.Sprintf("fuzz: no result after %v (input %s)", h.Timeout, inputString(h.Input))
+}
+
+// inputString returns a short description of an input for error messages.
+func inputString(v interface{}) string {
+	const max = 256
+	var s string
+	if b, ok := v.([]byte); ok {
+		s = strconv.Quote(string(b))
+	} else {
+		s = fmt.Sprintf("%#v", v)
+	}
+	if len(s) > max {
+		s = s[:max] + "..."
+	}
+	return s
+}
+
+// errLiteralSize is returned by inputReader for literals that exceed the input.
+var errLiteralSize = errors.New("fuzz: literal is larger than the input")
+
+// inputReader is a LiteralReader that rejects literals that are longer than the
+// input, and therefore cannot be complete, before allocating any memory for
+// them. This prevents a few bytes of input from allocating gigabytes.
+type inputReader int
+
+func (n inputReader) ReadLiteral(r io.Reader, i imap.LiteralInfo) (imap.Literal, error) {
+	if int64(i.Len) > int64(n) {
+		return nil, errLiteralSize
+	}
+	return imap.MemoryReader{}.ReadLiteral(r, i)
+}
+
+// Responses parses data as a stream of server responses, passes each response
+// to the decoders in the imap package, and then calls the handlers. Command
+// completion responses must use tags that begin with TagID. It returns a
+// *Crash or *Hang error if processing fails. Parser errors are not reported.
+// Literals that are longer than data are treated as parser errors.
+func Responses(data []byte, handlers ...func(rsp *imap.Response)) error {
+	lr := inputReader(len(data))
+	return run(data, func() {
+		imap.ReadResponses(bytes.NewReader(data), TagID, lr, func(rsp *imap.Response) error {
+			Decode(rsp)
+			for _, f := range rsp.Fields {
+				decodeField(f, 0)
+			}
+			for _, h := range handlers {
+				h(rsp)
+			}
+			return nil
+		})
+	})
+}
+
+// Fields passes every node of a Field tree to the field decoders in the imap
+// package (AsEnvelope, AsBodyStructure, AsAddressList, and so on), and then
+// calls the handlers with the root. It returns a *Crash or *Hang error if
+// processing fails.
+func Fields(f imap.Field, handlers ...func(f imap.Field)) error {
+	return run(f, func() {
+		decodeField(f, 0)
+		for _, h := range handlers {
+			h(f)
+		}
+	})
+}
+
+// Decode calls the Response decoders that apply to rsp according to its label.
+// The results are discarded.
+func Decode(rsp *imap.Response) {
+	rsp.Value()
+	switch rsp.Label {
+	case "BASE64":
+		rsp.Challenge()
+	case "LIST", "LSUB", "XLIST":
+		rsp.MailboxInfo()
+	case "STATUS":
+		rsp.MailboxStatus()
+	case "SEARCH":
+		rsp.SearchResults()
+	case "FLAGS", "PERMANENTFLAGS":
+		rsp.MailboxFlags()
+	case "VANISHED":
+		rsp.Vanished()
+	case "QUOTA":
+		rsp.Quota()
+	case "QUOTAROOT":
+		rsp.QuotaRoot()
+	case "THREAD":
+		rsp.ThreadResults()
+	case "FETCH":
+		if msg := rsp.MessageInfo(); msg != nil {
+			msg.Envelope()
+			msg.BodyStructure()
+		}
+	}
+}
+
+// decodeField calls the field decoders for f and all of its descendants.
+func decodeField(f imap.Field, depth int) {
+	imap.AsAtom(f)
+	imap.AsNumber64(f)
+	imap.AsString(f)
+	imap.AsBytes(f)
+	imap.AsDateTime(f)
+	imap.AsMailbox(f)
+	imap.AsFlagSet(f)
+	imap.AsFieldMap(f)
+	imap.AsAddressList(f)
+	imap.AsEnvelope(f)
+	imap.AsBodyStructure(f)
+	imap.AsBody(f)
+	if list, ok := f.([]imap.Field); ok && depth < imap.MaxListDepth {
+		for _, v := range list {
+			decodeField(v, depth+1)
+		}
+	}
+}
+
+// run calls f in a new goroutine and converts a panic or timeout into an error.
+func run(input interface{}, f func()) error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				buf := make([]byte, 64<<10)
+				buf = buf[:runtime.Stack(buf, false)]
+				done <- &Crash{input, v, buf}
+			}
+		}()
+		f()
+		done <- nil
+	}()
+	t := time.NewTimer(Timeout)
+	defer t.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-t.C:
+		return &Hang{input, Timeout}
+	}
+}
+
+// goFuzzHeader is the first line of a corpus file written by "go test -fuzz".
+const goFuzzHeader = "go test fuzz v1"
+
+// LoadCorpus returns the contents of all regular files in dir, sorted by name.
+// Files written by "go test -fuzz" with a single []byte or string value are
+// decoded.
+func LoadCorpus(dir string) ([][]byte, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var corpus [][]byte
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(b, []byte(goFuzzHeader+"\n")) {
+			if b, err = decodeGoFuzz(string(b[len(goFuzzHeader)+1:])); err != nil {
+				return nil, fmt.Errorf("fuzz: %s: %v", path, err)
+			}
+		}
+		corpus = append(corpus, b)
+	}
+	return corpus, nil
+}
+
+// decodeGoFuzz decodes the value in a "go test -fuzz" corpus file.
+func decodeGoFuzz(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, typ := range []string{"[]byte(", "string("} {
+		if strings.HasPrefix(s, typ) && strings.HasSuffix(s, ")") {
+			v, err := strconv.Unquote(s[len(typ) : len(s)-1])
+			if err != nil {
+				return nil, err
+			}
+			return []byte(v), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported corpus value %.40q", s)
+}
+
+// seeds are valid server responses that exercise most of the parser.
+var seeds = []string{
+	"* OK [CAPABILITY IMAP4rev1 LITERAL+ UIDPLUS] Server ready\r\n",
+	"* 3 EXISTS\r\n* 0 RECENT\r\n* OK [UIDVALIDITY 1367409600] UIDs valid\r\n" +
+		"* FLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft)\r\n" +
+		"* OK [PERMANENTFLAGS (\\Deleted \\Seen \\*)] Limited\r\n" +
+		"A1 OK [READ-WRITE] SELECT completed\r\n",
+	"* LIST (\\HasNoChildren) \"/\" \"INBOX\"\r\n" +
+		"* LIST (\\Noselect) \"/\" \"&AMk-t&AOk-\"\r\n" +
+		"* LSUB () \".\" {5}\r\nWork.\r\n",
+	"* STATUS \"INBOX\" (MESSAGES 12 UIDNEXT 44 UIDVALIDITY 1 UNSEEN 2 HIGHESTMODSEQ 90000000000)\r\n",
+	"* SEARCH 2 3 6\r\n* SEARCH\r\n* VANISHED (EARLIER) 41,43:116\r\n* THREAD (2)(3 6 (4 23)(44 7 96))\r\n",
+	"* QUOTAROOT INBOX \"\"\r\n* QUOTA \"\" (STORAGE 10 512)\r\n+ dGVzdA==\r\n",
+	"* 12 FETCH (FLAGS (\\Seen) UID 44 INTERNALDATE \"17-Jul-1996 02:44:25 -0700\" RFC822.SIZE 4286 " +
+		"ENVELOPE (\"Wed, 17 Jul 1996 02:23:25 -0700 (PDT)\" \"IMAP4rev1 WG mtg summary and minutes\" " +
+		"((\"Terry Gray\" NIL \"gray\" \"cac.washington.edu\")) ((\"Terry Gray\" NIL \"gray\" \"cac.washington.edu\")) " +
+		"((\"Terry Gray\" NIL \"gray\" \"cac.washington.edu\")) ((NIL NIL \"imap\" \"cac.washington.edu\")) " +
+		"((NIL NIL \"minutes\" \"CNRI.Reston.VA.US\")(\"John Klensin\" NIL \"KLENSIN\" \"MIT.EDU\")) NIL NIL " +
+		"\"<B27397-0100000@cac.washington.edu>\") " +
+		"BODYSTRUCTURE ((\"TEXT\" \"PLAIN\" (\"CHARSET\" \"US-ASCII\") NIL NIL \"7BIT\" 1152 23 NIL NIL NIL)" +
+		"(\"MESSAGE\" \"RFC822\" NIL NIL NIL \"7BIT\" 342 (NIL \"Hi\" NIL NIL NIL NIL NIL NIL NIL NIL) " +
+		"(\"TEXT\" \"PLAIN\" NIL NIL NIL \"7BIT\" 10 1) 12) \"MIXED\" (\"BOUNDARY\" \"x\") NIL NIL))\r\n",
+	"* 1 FETCH (BODY[HEADER.FIELDS (SUBJECT)] {15}\r\nSubject: Hi\r\n\r\n BODY (\"TEXT\" \"PLAIN\" NIL NIL NIL \"7BIT\" 3 1))\r\n",
+	"* BYE Logging out\r\nA2 OK LOGOUT completed\r\nA3 NO [TRYCREATE] No such mailbox\r\nA4 BAD Syntax error\r\n",
+}
+
+// Seeds returns a small corpus of valid server responses, which can be used as
+// the starting point for fuzzing.
+func Seeds() [][]byte {
+	corpus := make([][]byte, len(seeds))
+	for i, s := range seeds {
+		corpus[i] = []byte(s)
+	}
+	return corpus
+}
@@ -0,0 +1,28 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package fuzz
+
+import "testing"
+
+// AddCorpus adds the built-in seeds and, if dir is not empty, the corpus in dir
+// (see LoadCorpus) to the seed corpus of a fuzz test. The test fails if the
+// corpus cannot be read.
+func AddCorpus(f *testing.F, dir string) {
+	f.Helper()
+	corpus := Seeds()
+	if dir != "" {
+		more, err := LoadCorpus(dir)
+		if err != nil {
+			f.Fatal(err)
+		}
+		corpus = append(corpus, more...)
+	}
+	for _, b := range corpus {
+		f.Add(b)
+	}
+}
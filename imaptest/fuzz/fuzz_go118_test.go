@@ -0,0 +1,19 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package fuzz
+
+import "testing"
+
+func FuzzResponses(f *testing.F) {
+	AddCorpus(f, "")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := Responses(data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
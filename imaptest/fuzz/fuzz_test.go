@@ -0,0 +1,111 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fuzz
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+func TestSeeds(t *testing.T) {
+	for _, b := range Seeds() {
+		n := 0
+		err := imap.ReadResponses(bytes.NewReader(b), TagID, nil, func(rsp *imap.Response) error {
+			n++
+			return nil
+		})
+		if err != nil || n == 0 {
+			t.Errorf("ReadResponses(%q) unexpected result %d, %v", b, n, err)
+		}
+		if err = Responses(b); err != nil {
+			t.Errorf("Responses(%q) unexpected error; %v", b, err)
+		}
+	}
+}
+
+func TestLargeLiteral(t *testing.T) {
+	in := []byte("* 1 FETCH (BODY[] {2000000000}\r\nabc")
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if err := Responses(in); err != nil {
+		t.Errorf("Responses() unexpected error; %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("Responses() allocated %d bytes", n)
+	}
+	if _, err := inputReader(3).ReadLiteral(bytes.NewReader(in), imap.LiteralInfo{Len: 4}); err != errLiteralSize {
+		t.Errorf("ReadLiteral() expected errLiteralSize; got %v", err)
+	}
+}
+
+func TestCrash(t *testing.T) {
+	var labels []string
+	err := Responses(Seeds()[1], func(rsp *imap.Response) {
+		if labels = append(labels, rsp.Label); rsp.Label == "FLAGS" {
+			panic("bad flags")
+		}
+	})
+	if c, ok := err.(*Crash); !ok || c.Value != "bad flags" || len(c.Stack) == 0 {
+		t.Fatalf("Responses() expected a crash; got %v", err)
+	}
+	if want := []string{"EXISTS", "RECENT", "UIDVALIDITY", "FLAGS"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("Responses() expected labels %q; got %q", want, labels)
+	}
+	err = Fields([]imap.Field{"x"}, func(f imap.Field) { _ = f.([]imap.Field)[1] })
+	if _, ok := err.(*Crash); !ok {
+		t.Errorf("Fields() expected a crash; got %v", err)
+	}
+}
+
+func TestHang(t *testing.T) {
+	defer func(d time.Duration) { Timeout = d }(Timeout)
+	Timeout = 10 * time.Millisecond
+	block := make(chan struct{})
+	defer close(block)
+	err := Responses([]byte("* 1 EXISTS\r\n"), func(*imap.Response) { <-block })
+	if h, ok := err.(*Hang); !ok || h.Timeout != Timeout {
+		t.Errorf("Responses() expected a hang; got %v", err)
+	}
+}
+
+func TestLoadCorpus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a": "* 1 EXISTS\r\n",
+		"b": "go test fuzz v1\n[]byte(\"* OK \\x00\\r\\n\")\n",
+		"c": "go test fuzz v1\nstring(\"A1 OK done\\r\\n\")\n",
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Mkdir(filepath.Join(dir, "sub"), 0700)
+	corpus, err := LoadCorpus(dir)
+	if err != nil {
+		t.Fatalf("LoadCorpus() unexpected error; %v", err)
+	}
+	want := [][]byte{[]byte("* 1 EXISTS\r\n"), []byte("* OK \x00\r\n"), []byte("A1 OK done\r\n")}
+	if !reflect.DeepEqual(corpus, want) {
+		t.Errorf("LoadCorpus() expected %q; got %q", want, corpus)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "d"), []byte("go test fuzz v1\nint(1)\n"), 0600)
+	if _, err = LoadCorpus(dir); err == nil {
+		t.Errorf("LoadCorpus() expected an error for an unsupported value")
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package memserver implements an in-memory IMAP server for unit tests.
+
+Unlike the scripted server in the mock package, which checks the exact bytes
+exchanged with the client, memserver understands enough of RFC 3501 to let an
+application run its normal code against a real (if small) server: LOGIN, LIST,
+CREATE, DELETE, STATUS, SELECT, EXAMINE, APPEND, FETCH, STORE, SEARCH, COPY,
+EXPUNGE, CLOSE, and the UID variants of these commands, as well as the
+LITERAL+ and UIDPLUS extensions. Users, mailboxes, and messages are kept in
+memory, so tests are fast and do not require Docker or network access.
+
+A typical test creates a server, adds a user and some messages, and connects a
+client:
+
+	s := memserver.New()
+	s.AddUser("joe", "secret")
+	s.AddMessage("joe", "INBOX", []byte("Subject: hi\r\n\r\nHello"), time.Now())
+	c, err := s.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = imap.Wait(c.Login("joe", "secret"))
+
+The protocol is implemented by the server package, with memserver providing
+the Backend, so the limitations listed there apply: message structure is not
+parsed beyond the header, there is no \Recent flag, and flag changes made by
+one connection are not reported to other connections that have the same
+mailbox selected.
+*/
+package memserver
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+	"github.com/mxk/go-imap/server"
+)
+
+// Errors returned by the Server methods that manage its contents.
+var (
+	ErrNoUser        = errors.New("memserver: user does not exist")
+	ErrNoMailbox     = server.ErrNoMailbox
+	ErrMailboxExists = server.ErrMailboxExists
+)
+
+// Delim is the hierarchy delimiter used for mailbox names.
+const Delim = server.Delim
+
+// Message is a snapshot of a message stored on the server, as returned by
+// Server.Messages.
+type Message struct {
+	UID   uint32    // Unique identifier
+	Flags []string  // Sorted flags (e.g. `\Seen`)
+	Date  time.Time // Internal date
+	Body  []byte    // Full RFC 2822 message
+}
+
+// Server is an in-memory IMAP server. Its methods may be called concurrently,
+// including while clients are connected.
+type Server struct {
+	mu    sync.Mutex
+	users map[string]*user
+}
+
+// user is a server account.
+type user struct {
+	password string
+	mboxes   map[string]*mailbox // Keyed by UTF-8 name
+}
+
+// mailbox is a list of messages in UID order.
+type mailbox struct {
+	name        string
+	uidValidity uint32
+	uidNext     uint32
+	msgs        []*message
+}
+
+// message is a single message in a mailbox.
+type message struct {
+	uid   uint32
+	flags map[string]bool
+	date  time.Time
+	body  []byte
+}
+
+// New returns a server without any users.
+func New() *Server {
+	return &Server{users: make(map[string]*user)}
+}
+
+// AddUser creates a new user with an empty INBOX. If the user already exists,
+// only the password is changed.
+func (s *Server) AddUser(name, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u := s.users[name]; u != nil {
+		u.password = password
+		return
+	}
+	u := &user{password: password, mboxes: make(map[string]*mailbox)}
+	u.create("INBOX")
+	s.users[name] = u
+}
+
+// AddMailbox creates a new mailbox for the specified user.
+func (s *Server) AddMailbox(user, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.users[user]
+	if u == nil {
+		return ErrNoUser
+	} else if u.mailbox(name) != nil {
+		return ErrMailboxExists
+	}
+	u.create(name)
+	return nil
+}
+
+// AddMessage appends a message to a mailbox of the specified user and returns
+// its UID.
+func (s *Server) AddMessage(user, mbox string, body []byte, date time.Time, flags ...string) (uid uint32, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.mailbox(user, mbox)
+	if err != nil {
+		return 0, err
+	}
+	return m.append(body, date, flags).uid, nil
+}
+
+// Messages returns a snapshot of all messages in a mailbox of the specified
+// user, which tests can use to verify the changes made by the client.
+func (s *Server) Messages(user, mbox string) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, err := s.mailbox(user, mbox)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]Message, len(m.msgs))
+	for i, msg := range m.msgs {
+		msgs[i] = Message{msg.uid, msg.flagList(), msg.date, append([]byte(nil), msg.body...)}
+	}
+	return msgs, nil
+}
+
+// Dial returns a new Client connected to the server via an in-memory
+// connection. The server goroutine exits when the connection is closed.
+func (s *Server) Dial() (*imap.Client, error) {
+	c, sc := net.Pipe()
+	go s.Serve(sc)
+	cl, err := imap.NewClient(c, "memserver", 0)
+	if err != nil {
+		c.Close()
+	}
+	return cl, err
+}
+
+// Serve handles a single client connection until the client logs out or the
+// connection is closed, which is done before Serve returns. Connections may be
+// served concurrently.
+func (s *Server) Serve(conn net.Conn) error {
+	srv := &server.Server{Backend: (*backend)(s), Greeting: "memserver ready"}
+	return srv.ServeConn(conn)
+}
+
+// mailbox returns the specified mailbox. s.mu must be held.
+func (s *Server) mailbox(user, name string) (*mailbox, error) {
+	u := s.users[user]
+	if u == nil {
+		return nil, ErrNoUser
+	}
+	if m := u.mailbox(name); m != nil {
+		return m, nil
+	}
+	return nil, ErrNoMailbox
+}
+
+// mailbox returns the mailbox with the specified name, or nil if it does not
+// exist. INBOX is case-insensitive.
+func (u *user) mailbox(name string) *mailbox {
+	return u.mboxes[normName(name)]
+}
+
+// create adds a new mailbox.
+func (u *user) create(name string) *mailbox {
+	name = normName(name)
+	m := &mailbox{name: name, uidValidity: uint32(time.Now().Unix()), uidNext: 1}
+	u.mboxes[name] = m
+	return m
+}
+
+// names returns the sorted names of all mailboxes.
+func (u *user) names() []string {
+	names := make([]string, 0, len(u.mboxes))
+	for name := range u.mboxes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// normName converts INBOX to upper case.
+func normName(name string) string {
+	if strings.EqualFold(name, "INBOX") {
+		return "INBOX"
+	}
+	return name
+}
+
+// append adds a new message to the mailbox.
+func (m *mailbox) append(body []byte, date time.Time, flags []string) *message {
+	msg := &message{
+		uid:   m.uidNext,
+		flags: make(map[string]bool),
+		date:  date,
+		body:  append([]byte(nil), body...),
+	}
+	for _, f := range flags {
+		msg.flags[f] = true
+	}
+	m.uidNext++
+	m.msgs = append(m.msgs, msg)
+	return msg
+}
+
+// find returns the message with the specified UID or nil.
+func (m *mailbox) find(uid uint32) *message {
+	i := sort.Search(len(m.msgs), func(i int) bool { return m.msgs[i].uid >= uid })
+	if i < len(m.msgs) && m.msgs[i].uid == uid {
+		return m.msgs[i]
+	}
+	return nil
+}
+
+// remove deletes the messages for which f returns true and returns their UIDs.
+func (m *mailbox) remove(f func(msg *message) bool) (uids []uint32) {
+	msgs := m.msgs[:0]
+	for _, msg := range m.msgs {
+		if f(msg) {
+			uids = append(uids, msg.uid)
+		} else {
+			msgs = append(msgs, msg)
+		}
+	}
+	for i := len(msgs); i < len(m.msgs); i++ {
+		m.msgs[i] = nil
+	}
+	m.msgs = msgs
+	return
+}
+
+// unseen returns the number of messages without the \Seen flag.
+func (m *mailbox) unseen() (n uint32) {
+	for _, msg := range m.msgs {
+		if !msg.flags[`\Seen`] {
+			n++
+		}
+	}
+	return
+}
+
+// flagList returns the sorted message flags.
+func (msg *message) flagList() []string {
+	flags := make([]string, 0, len(msg.flags))
+	for f := range msg.flags {
+		flags = append(flags, f)
+	}
+	sort.Strings(flags)
+	return flags
+}
+
+// message returns a copy of msg for the server package.
+func (msg *message) message() *server.Message {
+	return &server.Message{UID: msg.uid, Flags: msg.flagList(), Date: msg.date, Body: msg.body}
+}
+
+// backend implements server.Backend. All methods acquire the Server lock.
+type backend Server
+
+// userBackend implements server.User.
+type userBackend struct {
+	s *Server
+	u *user
+}
+
+// mailboxBackend implements server.Mailbox.
+type mailboxBackend struct {
+	s *Server
+	m *mailbox
+}
+
+func (b *backend) Login(username, password string) (server.User, error) {
+	s := (*Server)(b)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.users[username]
+	if u == nil || u.password != password {
+		return nil, server.ErrInvalidCredentials
+	}
+	return &userBackend{s, u}, nil
+}
+
+func (b *userBackend) Mailboxes() ([]string, error) {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	return b.u.names(), nil
+}
+
+func (b *userBackend) Mailbox(name string) (server.Mailbox, error) {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	if m := b.u.mailbox(name); m != nil {
+		return &mailboxBackend{b.s, m}, nil
+	}
+	return nil, ErrNoMailbox
+}
+
+func (b *userBackend) CreateMailbox(name string) error {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	if b.u.mailbox(name) != nil {
+		return ErrMailboxExists
+	}
+	b.u.create(name)
+	return nil
+}
+
+func (b *userBackend) DeleteMailbox(name string) error {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	if b.u.mailbox(name) == nil {
+		return ErrNoMailbox
+	}
+	delete(b.u.mboxes, normName(name))
+	return nil
+}
+
+func (b *mailboxBackend) Status() (*server.MailboxStatus, error) {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	m := b.m
+	st := &server.MailboxStatus{
+		Messages:    uint32(len(m.msgs)),
+		Unseen:      m.unseen(),
+		UIDNext:     m.uidNext,
+		UIDValidity: m.uidValidity,
+	}
+	for i, msg := range m.msgs {
+		if !msg.flags[`\Seen`] {
+			st.FirstUnseen = uint32(i + 1)
+			break
+		}
+	}
+	return st, nil
+}
+
+func (b *mailboxBackend) UIDs() ([]uint32, error) {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	uids := make([]uint32, len(b.m.msgs))
+	for i, msg := range b.m.msgs {
+		uids[i] = msg.uid
+	}
+	return uids, nil
+}
+
+func (b *mailboxBackend) Fetch(uids []uint32) ([]*server.Message, error) {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	msgs := make([]*server.Message, 0, len(uids))
+	for _, uid := range uids {
+		if msg := b.m.find(uid); msg != nil {
+			msgs = append(msgs, msg.message())
+		}
+	}
+	return msgs, nil
+}
+
+func (b *mailboxBackend) Append(body []byte, date time.Time, flags []string) (uint32, error) {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	return b.m.append(body, date, flags).uid, nil
+}
+
+func (b *mailboxBackend) SetFlags(uids []uint32, op server.FlagOp, flags []string) error {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	for _, uid := range uids {
+		msg := b.m.find(uid)
+		if msg == nil {
+			continue
+		} else if op == server.ReplaceFlags {
+			msg.flags = make(map[string]bool, len(flags))
+		}
+		for _, f := range flags {
+			if op == server.RemoveFlags {
+				delete(msg.flags, f)
+			} else {
+				msg.flags[f] = true
+			}
+		}
+	}
+	return nil
+}
+
+func (b *mailboxBackend) Expunge(uids []uint32) error {
+	b.s.mu.Lock()
+	defer b.s.mu.Unlock()
+	var set map[uint32]bool
+	if uids != nil {
+		set = make(map[uint32]bool, len(uids))
+		for _, uid := range uids {
+			set[uid] = true
+		}
+	}
+	b.m.remove(func(msg *message) bool {
+		return msg.flags[`\Deleted`] && (set == nil || set[msg.uid])
+	})
+	return nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memserver_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+	"github.com/mxk/go-imap/imaptest/memserver"
+)
+
+const testMsg = "From: Joe <joe@example.com>\r\n" +
+	"To: Ann <ann@example.org>\r\n" +
+	"Subject: Lunch\r\n" +
+	"\r\n" +
+	"Pizza at noon?\r\n"
+
+// dial returns a client logged in to s as joe.
+func dial(t *testing.T, s *memserver.Server) *imap.Client {
+	c, err := s.Dial()
+	if err != nil {
+		t.Fatalf("Dial() unexpected error; %v", err)
+	}
+	if _, err = imap.Wait(c.Login("joe", "secret")); err != nil {
+		t.Fatalf("Login() unexpected error; %v", err)
+	}
+	return c
+}
+
+// fetch returns the MessageInfo of all FETCH responses.
+func fetch(cmd *imap.Command, err error) (info []*imap.MessageInfo, _ error) {
+	if cmd, err = imap.Wait(cmd, err); err != nil {
+		return nil, err
+	}
+	for _, rsp := range cmd.Data {
+		info = append(info, rsp.MessageInfo())
+	}
+	return info, nil
+}
+
+// search returns the results of a SEARCH command.
+func search(cmd *imap.Command, err error) (nums []uint32, _ error) {
+	if cmd, err = imap.Wait(cmd, err); err != nil {
+		return nil, err
+	}
+	for _, rsp := range cmd.Data {
+		nums = append(nums, rsp.SearchResults()...)
+	}
+	return nums, nil
+}
+
+func TestServer(t *testing.T) {
+	s := memserver.New()
+	s.AddUser("joe", "secret")
+	date := time.Date(2013, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if _, err := s.AddMessage("joe", "INBOX", []byte(testMsg), date, `\Seen`); err != nil {
+			t.Fatalf("AddMessage() unexpected error; %v", err)
+		}
+	}
+	if err := s.AddMailbox("joe", "Archive"); err != nil {
+		t.Fatalf("AddMailbox() unexpected error; %v", err)
+	}
+
+	c, err := s.Dial()
+	if err != nil {
+		t.Fatalf("Dial() unexpected error; %v", err)
+	}
+	if _, err = imap.Wait(c.Login("joe", "wrong")); err == nil {
+		t.Fatalf("Login(wrong password) expected an error")
+	}
+	if _, err = imap.Wait(c.Login("joe", "secret")); err != nil {
+		t.Fatalf("Login() unexpected error; %v", err)
+	}
+	if !c.Caps["UIDPLUS"] {
+		t.Errorf("c.Caps missing UIDPLUS; got %v", c.Caps)
+	}
+
+	// LIST
+	cmd, err := imap.Wait(c.List("", "*"))
+	if err != nil {
+		t.Fatalf("List() unexpected error; %v", err)
+	}
+	var names []string
+	for _, rsp := range cmd.Data {
+		names = append(names, rsp.MailboxInfo().Name)
+	}
+	if want := []string{"Archive", "INBOX"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() expected %q; got %q", want, names)
+	}
+
+	// SELECT and APPEND
+	if _, err = imap.Wait(c.Select("INBOX", false)); err != nil {
+		t.Fatalf("Select() unexpected error; %v", err)
+	} else if c.Mailbox.Messages != 3 {
+		t.Errorf("c.Mailbox.Messages expected 3; got %d", c.Mailbox.Messages)
+	}
+	body := strings.Replace(testMsg, "Lunch", "Dinner", 1)
+	if _, err = imap.Wait(c.Append("INBOX", nil, &date, imap.NewLiteral([]byte(body)))); err != nil {
+		t.Fatalf("Append() unexpected error; %v", err)
+	} else if c.Mailbox.Messages != 4 {
+		t.Errorf("c.Mailbox.Messages after APPEND expected 4; got %d", c.Mailbox.Messages)
+	}
+
+	// FETCH
+	info, err := fetch(c.Fetch(newSeqSet(t, "4"), "FLAGS", "UID", "RFC822.SIZE", "INTERNALDATE", "BODY[HEADER.FIELDS (SUBJECT)]", "BODY[TEXT]"))
+	if err != nil || len(info) != 1 {
+		t.Fatalf("Fetch() unexpected result %v, %v", info, err)
+	}
+	mi := info[0]
+	if mi.Seq != 4 || mi.UID != 4 || mi.Size != uint32(len(body)) || !mi.InternalDate.Equal(date) {
+		t.Errorf("Fetch() unexpected message info %+v", mi)
+	}
+	if hdr := string(imap.AsBytes(mi.Attrs["BODY[HEADER.FIELDS (SUBJECT)]"])); hdr != "Subject: Dinner\r\n\r\n" {
+		t.Errorf("Fetch() unexpected header %q", hdr)
+	}
+	if text := string(imap.AsBytes(mi.Attrs["BODY[TEXT]"])); text != "Pizza at noon?\r\n" {
+		t.Errorf("Fetch() unexpected text %q", text)
+	}
+	if !mi.Flags[`\Seen`] {
+		t.Errorf("Fetch(BODY[TEXT]) did not set \\Seen; got %v", mi.Flags)
+	}
+	info, err = fetch(c.UIDFetch(newSeqSet(t, "1"), "ENVELOPE", "BODY.PEEK[]<0.4>"))
+	if err != nil || len(info) != 1 || info[0].UID != 1 {
+		t.Fatalf("UIDFetch() unexpected result %v, %v", info, err)
+	}
+	if env := info[0].Attrs["ENVELOPE"]; imap.AsString(imap.AsList(env)[1]) != "Lunch" {
+		t.Errorf("UIDFetch() unexpected envelope %v", env)
+	}
+	if b := string(imap.AsBytes(info[0].Attrs["BODY[]<0>"])); b != "From" {
+		t.Errorf("UIDFetch() unexpected partial body %q", b)
+	}
+
+	// STORE and SEARCH
+	if _, err = imap.Wait(c.Store(newSeqSet(t, "1:2"), "-FLAGS.SILENT", imap.NewFlagSet(`\Seen`))); err != nil {
+		t.Fatalf("Store() unexpected error; %v", err)
+	}
+	if nums, err := search(c.Search("UNSEEN")); !reflect.DeepEqual(nums, []uint32{1, 2}) {
+		t.Errorf("Search(UNSEEN) expected [1 2]; got %v, %v", nums, err)
+	}
+	if nums, err := search(c.UIDSearch("SUBJECT", "dinner")); !reflect.DeepEqual(nums, []uint32{4}) {
+		t.Errorf("UIDSearch(SUBJECT) expected [4]; got %v, %v", nums, err)
+	}
+	if nums, err := search(c.Search("OR", "2", "NOT", "SEEN", "SINCE", "1-May-2013")); !reflect.DeepEqual(nums, []uint32{1, 2}) {
+		t.Errorf("Search(OR) expected [1 2]; got %v, %v", nums, err)
+	}
+
+	// COPY, a second session, and EXPUNGE
+	if cmd, err = imap.Wait(c.Copy(newSeqSet(t, "1"), "Archive")); err != nil {
+		t.Fatalf("Copy() unexpected error; %v", err)
+	} else if rsp, _ := cmd.Result(imap.OK); rsp.Label != "COPYUID" {
+		t.Errorf("Copy() expected COPYUID; got %q", rsp.Label)
+	}
+	c2 := dial(t, s)
+	if _, err = imap.Wait(c2.Select("INBOX", false)); err != nil {
+		t.Fatalf("Select() unexpected error; %v", err)
+	}
+	if _, err = imap.Wait(c.Store(newSeqSet(t, "2:3"), "+FLAGS", imap.NewFlagSet(`\Deleted`))); err != nil {
+		t.Fatalf("Store() unexpected error; %v", err)
+	}
+	if _, err = imap.Wait(c.Expunge(nil)); err != nil {
+		t.Fatalf("Expunge() unexpected error; %v", err)
+	} else if c.Mailbox.Messages != 2 {
+		t.Errorf("c.Mailbox.Messages after EXPUNGE expected 2; got %d", c.Mailbox.Messages)
+	}
+	if _, err = s.AddMessage("joe", "INBOX", []byte(testMsg), date); err != nil {
+		t.Fatalf("AddMessage() unexpected error; %v", err)
+	}
+	if _, err = imap.Wait(c2.Noop()); err != nil {
+		t.Fatalf("Noop() unexpected error; %v", err)
+	} else if c2.Mailbox.Messages != 3 {
+		t.Errorf("c2.Mailbox.Messages after NOOP expected 3; got %d", c2.Mailbox.Messages)
+	}
+	var uids []uint32
+	msgs, _ := s.Messages("joe", "INBOX")
+	for _, m := range msgs {
+		uids = append(uids, m.UID)
+	}
+	if want := []uint32{1, 4, 5}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("Messages() expected UIDs %v; got %v", want, uids)
+	}
+
+	// STATUS
+	cmd, err = imap.Wait(c.Status("Archive", "MESSAGES", "UIDNEXT"))
+	if err != nil {
+		t.Fatalf("Status() unexpected error; %v", err)
+	} else if st := cmd.Data[0].MailboxStatus(); st.Messages != 1 || st.UIDNext != 2 {
+		t.Errorf("Status() unexpected result %+v", st)
+	}
+	if _, err = imap.Wait(c.Logout(time.Second)); err != nil {
+		t.Errorf("Logout() unexpected error; %v", err)
+	}
+	c2.Logout(time.Second)
+}
+
+func newSeqSet(t *testing.T, set string) *imap.SeqSet {
+	s, err := imap.NewSeqSet(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
@@ -0,0 +1,474 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package probe runs a series of conformance checks against an IMAP server and
+reports which features work and which quirks were observed.
+
+Run logs in, creates a scratch mailbox, and exercises the server with commands
+that are known to expose implementation differences: mailbox names with
+non-ASCII characters, a large literal, APPENDUID responses, FETCH of the
+envelope and body structure, SEARCH, and the IDLE, MOVE, and ID extensions if
+they are advertised. The scratch mailbox is deleted at the end. Each check
+produces a Result, and the Report can be encoded as JSON:
+
+	c, err := imap.DialTLS("imap.example.com", nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rep, err := probe.Run(c, probe.Config{Username: "joe", Password: "secret"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	json.NewEncoder(os.Stdout).Encode(rep)
+
+Capabilities that are advertised but fail their checks are listed in
+Report.Broken. Report.Apply passes them to Client.DisableCaps, so a report saved
+for a particular server can be used to avoid its broken extensions later.
+*/
+package probe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// Status is the outcome of a check.
+type Status int
+
+// Check outcomes.
+const (
+	Pass Status = iota // Feature works as specified
+	Fail               // Feature is broken or missing
+	Skip               // Check does not apply to the server
+)
+
+var statusNames = []string{"pass", "fail", "skip"}
+
+func (s Status) String() string {
+	if int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Config specifies the account and the parameters of the checks.
+type Config struct {
+	Username string
+	Password string
+
+	// Mailbox is the name of the scratch mailbox, which must not exist
+	// ("go-imap-probe" if empty). It is deleted when the checks are done.
+	Mailbox string
+
+	// LiteralSize is the size of the message used by the long literal check
+	// (1 MiB if zero).
+	LiteralSize int
+}
+
+// Result is the outcome of a single check.
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Report contains the results of all checks.
+type Report struct {
+	Caps    []string  `json:"caps"`             // Capabilities after login
+	Results []*Result `json:"results"`          // Results in the order of execution
+	Quirks  []string  `json:"quirks,omitempty"` // Deviations from the specification
+	Broken  []string  `json:"broken,omitempty"` // Advertised capabilities that failed
+}
+
+// Result returns the result of the named check or nil if it was not run.
+func (rep *Report) Result(name string) *Result {
+	for _, r := range rep.Results {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// Apply disables the broken capabilities in c.
+func (rep *Report) Apply(c *imap.Client) {
+	if len(rep.Broken) > 0 {
+		c.DisableCaps(rep.Broken...)
+	}
+}
+
+// skipError is returned by checks that do not apply.
+type skipError string
+
+func (err skipError) Error() string { return string(err) }
+
+// errClosed stops the remaining checks after the connection is lost.
+var errClosed = errors.New("probe: connection closed")
+
+// runner holds the state shared by the checks.
+type runner struct {
+	c      *imap.Client
+	cfg    Config
+	rep    *Report
+	delim  string
+	mbox   string // Scratch mailbox
+	utf8   string // Child of mbox with a non-ASCII name
+	marker string // Subject of the small test message
+	uid    uint32 // UID of the small test message
+}
+
+// Run executes all checks using c, which must be in the not authenticated or
+// authenticated state. An error is returned if login fails or the connection
+// is lost. In the latter case, the report contains the results up to that
+// point.
+func Run(c *imap.Client, cfg Config) (*Report, error) {
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "go-imap-probe"
+	}
+	if cfg.LiteralSize <= 0 {
+		cfg.LiteralSize = 1 << 20
+	}
+	r := &runner{c: c, cfg: cfg, rep: new(Report), mbox: cfg.Mailbox}
+	r.marker = fmt.Sprintf("go-imap probe %d", time.Now().UnixNano())
+	if c.State() == imap.Login {
+		if _, err := c.Login(cfg.Username, cfg.Password); err != nil {
+			return r.rep, err
+		}
+	}
+	r.rep.Caps = strings.Fields(c.Caps.String())
+	checks := []struct {
+		name string
+		f    func() (string, error)
+	}{
+		{"imap4rev1", r.imap4rev1},
+		{"id", r.id},
+		{"create", r.create},
+		{"utf8-mailbox", r.utf8Mailbox},
+		{"append", r.append},
+		{"long-literal", r.longLiteral},
+		{"fetch", r.fetch},
+		{"bodystructure", r.bodyStructure},
+		{"search", r.search},
+		{"idle", r.idle},
+		{"move", r.move},
+	}
+	var err error
+	for _, chk := range checks {
+		if err = r.run(chk.name, chk.f); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = r.run("cleanup", r.cleanup)
+	}
+	return r.rep, err
+}
+
+// run executes a single check and records the result.
+func (r *runner) run(name string, f func() (string, error)) error {
+	start := time.Now()
+	detail, err := f()
+	res := &Result{Name: name, Detail: detail, Duration: time.Since(start)}
+	if err != nil {
+		res.Status, res.Detail = Fail, err.Error()
+		if s, ok := err.(skipError); ok {
+			res.Status, res.Detail = Skip, string(s)
+		}
+	}
+	r.rep.Results = append(r.rep.Results, res)
+	if r.c.State() == imap.Closed {
+		return errClosed
+	}
+	return nil
+}
+
+// quirk records a deviation from the specification.
+func (r *runner) quirk(format string, v ...interface{}) {
+	r.rep.Quirks = append(r.rep.Quirks, fmt.Sprintf(format, v...))
+}
+
+// broken records a capability that was advertised but does not work.
+func (r *runner) broken(name string) {
+	r.rep.Broken = append(r.rep.Broken, name)
+}
+
+// need returns a skipError if the server does not advertise a capability.
+func (r *runner) need(name string) error {
+	if !r.c.Caps.Has(name) {
+		return skipError(name + " not advertised")
+	}
+	return nil
+}
+
+// message returns a test message with the specified subject and a body of at
+// least n bytes.
+func message(subject string, n int) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: Probe <probe@example.com>\r\n"+
+		"To: Probe <probe@example.com>\r\n"+
+		"Subject: %s\r\n"+
+		"Date: %s\r\n"+
+		"Message-ID: <%d@probe.example.com>\r\n"+
+		"Content-Type: text/plain; charset=us-ascii\r\n"+
+		"\r\n", subject, time.Now().Format(time.RFC1123Z), time.Now().UnixNano())
+	line := strings.Repeat("x", 76) + "\r\n"
+	for b.Len() < n {
+		b.WriteString(line)
+	}
+	if n == 0 {
+		b.WriteString("Hello\r\n")
+	}
+	return b.Bytes()
+}
+
+func (r *runner) imap4rev1() (string, error) {
+	if !r.c.Caps.Has("IMAP4rev1") {
+		r.quirk("IMAP4rev1 capability not advertised")
+		return "", errors.New("IMAP4rev1 not advertised")
+	}
+	return "", nil
+}
+
+func (r *runner) id() (string, error) {
+	if err := r.need("ID"); err != nil {
+		return "", err
+	}
+	cmd, err := imap.Wait(r.c.ID("name", "go-imap probe"))
+	if err != nil {
+		r.broken("ID")
+		return "", err
+	}
+	for _, rsp := range cmd.Data {
+		if rsp.Label == "ID" {
+			return rsp.String(), nil
+		}
+	}
+	return "", nil
+}
+
+func (r *runner) create() (string, error) {
+	cmd, err := imap.Wait(r.c.List("", ""))
+	if err != nil {
+		return "", err
+	}
+	for _, rsp := range cmd.Data {
+		if info := rsp.MailboxInfo(); info != nil {
+			r.delim = info.Delim
+		}
+	}
+	if _, err = imap.Wait(r.c.Create(r.mbox)); err != nil {
+		r.mbox = ""
+		return "", err
+	}
+	return "hierarchy delimiter " + fmt.Sprintf("%q", r.delim), nil
+}
+
+func (r *runner) utf8Mailbox() (string, error) {
+	if r.mbox == "" {
+		return "", skipError("no scratch mailbox")
+	} else if r.delim == "" {
+		return "", skipError("server does not support hierarchy")
+	}
+	name := r.mbox + r.delim + "Prüfung ✓ 日本"
+	if _, err := imap.Wait(r.c.Create(name)); err != nil {
+		return "", err
+	}
+	r.utf8 = name
+	cmd, err := imap.Wait(r.c.List("", r.mbox+r.delim+"*"))
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, rsp := range cmd.Data {
+		if info := rsp.MailboxInfo(); info != nil {
+			if info.Name == name {
+				return "", nil
+			}
+			names = append(names, info.Name)
+		}
+	}
+	r.quirk("mailbox %q listed as %q", name, names)
+	return "", fmt.Errorf("created mailbox not listed (got %q)", names)
+}
+
+func (r *runner) append() (string, error) {
+	if r.mbox == "" {
+		return "", skipError("no scratch mailbox")
+	}
+	cmd, err := imap.Wait(r.c.Append(r.mbox, nil, nil, imap.NewLiteral(message(r.marker, 0))))
+	if err != nil {
+		return "", err
+	}
+	rsp, _ := cmd.Result(imap.OK)
+	if rsp.Label == "APPENDUID" && len(rsp.Fields) == 3 {
+		r.uid = imap.AsNumber(rsp.Fields[2])
+		return fmt.Sprintf("APPENDUID %d", r.uid), nil
+	} else if r.c.Caps.Has("UIDPLUS") {
+		r.quirk("APPEND completed without APPENDUID despite UIDPLUS")
+		r.broken("UIDPLUS")
+		return "", errors.New("missing APPENDUID")
+	}
+	return "", nil
+}
+
+func (r *runner) longLiteral() (string, error) {
+	if r.mbox == "" {
+		return "", skipError("no scratch mailbox")
+	}
+	n := r.cfg.LiteralSize
+	if limit, ok := r.c.Caps.Uint("APPENDLIMIT"); ok && uint64(n) > limit {
+		return "", skipError(fmt.Sprintf("APPENDLIMIT=%d", limit))
+	}
+	msg := message(r.marker+" (long)", n)
+	if _, err := imap.Wait(r.c.Append(r.mbox, nil, nil, imap.NewLiteral(msg))); err != nil {
+		return "", err
+	}
+	if _, err := r.c.Select(r.mbox, true); err != nil {
+		return "", err
+	}
+	seq, _ := imap.NewSeqSet("*")
+	cmd, err := imap.Wait(r.c.Fetch(seq, "RFC822.SIZE"))
+	if err != nil {
+		return "", err
+	}
+	for _, rsp := range cmd.Data {
+		if info := rsp.MessageInfo(); info != nil && info.Size != uint32(len(msg)) {
+			r.quirk("RFC822.SIZE of a %d-byte message reported as %d", len(msg), info.Size)
+			return "", fmt.Errorf("RFC822.SIZE %d; expected %d", info.Size, len(msg))
+		}
+	}
+	return fmt.Sprintf("%d bytes", len(msg)), nil
+}
+
+func (r *runner) fetch() (string, error) {
+	if r.mbox == "" {
+		return "", skipError("no scratch mailbox")
+	}
+	if _, err := r.c.Select(r.mbox, false); err != nil {
+		return "", err
+	}
+	seq, _ := imap.NewSeqSet("1")
+	cmd, err := imap.Wait(r.c.Fetch(seq, "UID", "FLAGS", "ENVELOPE"))
+	if err != nil {
+		return "", err
+	} else if len(cmd.Data) == 0 {
+		return "", errors.New("no FETCH response")
+	}
+	info := cmd.Data[0].MessageInfo()
+	if r.uid != 0 && info.UID != r.uid {
+		r.quirk("APPENDUID %d does not match UID %d", r.uid, info.UID)
+	}
+	r.uid = info.UID
+	if env := info.Envelope(); env == nil || env.Subject != r.marker {
+		return "", fmt.Errorf("invalid ENVELOPE %v", info.Attrs["ENVELOPE"])
+	}
+	return "", nil
+}
+
+func (r *runner) bodyStructure() (string, error) {
+	if r.uid == 0 {
+		return "", skipError("no test message")
+	}
+	seq, _ := imap.NewSeqSet("")
+	seq.AddNum(r.uid)
+	cmd, err := imap.Wait(r.c.UIDFetch(seq, "BODYSTRUCTURE"))
+	if err != nil {
+		return "", err
+	} else if len(cmd.Data) == 0 {
+		return "", errors.New("no FETCH response")
+	}
+	info := cmd.Data[0].MessageInfo()
+	root, _ := info.BodyStructure()
+	if root == nil {
+		return "", fmt.Errorf("invalid BODYSTRUCTURE %v", info.Attrs["BODYSTRUCTURE"])
+	}
+	return root.MIMEType(), nil
+}
+
+func (r *runner) search() (string, error) {
+	if r.uid == 0 {
+		return "", skipError("no test message")
+	}
+	cmd, err := imap.Wait(r.c.UIDSearch("SUBJECT", r.c.Quote(r.marker)))
+	if err != nil {
+		return "", err
+	}
+	var uids []uint32
+	for _, rsp := range cmd.Data {
+		uids = append(uids, rsp.SearchResults()...)
+	}
+	for _, uid := range uids {
+		if uid == r.uid {
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("UID %d not found (got %v)", r.uid, uids)
+}
+
+func (r *runner) idle() (string, error) {
+	if err := r.need("IDLE"); err != nil {
+		return "", err
+	}
+	if _, err := r.c.Idle(); err != nil {
+		r.broken("IDLE")
+		return "", err
+	}
+	if _, err := imap.Wait(r.c.IdleTerm()); err != nil {
+		r.broken("IDLE")
+		return "", err
+	}
+	return "", nil
+}
+
+func (r *runner) move() (string, error) {
+	if err := r.need("MOVE"); err != nil {
+		return "", err
+	} else if r.uid == 0 || r.utf8 == "" {
+		return "", skipError("no test message or destination")
+	}
+	seq, _ := imap.NewSeqSet("")
+	seq.AddNum(r.uid)
+	if _, err := imap.Wait(r.c.UIDMove(seq, r.utf8)); err != nil {
+		r.broken("MOVE")
+		return "", err
+	}
+	cmd, err := imap.Wait(r.c.Status(r.utf8, "MESSAGES"))
+	if err != nil {
+		return "", err
+	} else if len(cmd.Data) == 0 || cmd.Data[0].MailboxStatus().Messages != 1 {
+		r.broken("MOVE")
+		return "", errors.New("message not found in the destination")
+	}
+	return "", nil
+}
+
+func (r *runner) cleanup() (string, error) {
+	if r.mbox == "" {
+		return "", skipError("no scratch mailbox")
+	}
+	if r.c.State() == imap.Selected {
+		if _, err := r.c.Close(true); err != nil {
+			return "", err
+		}
+	}
+	if r.utf8 != "" {
+		if _, err := imap.Wait(r.c.Delete(r.utf8)); err != nil {
+			return "", err
+		}
+	}
+	_, err := imap.Wait(r.c.Delete(r.mbox))
+	return "", err
+}
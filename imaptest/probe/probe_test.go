@@ -0,0 +1,67 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package probe_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-imap/imaptest/memserver"
+	"github.com/mxk/go-imap/imaptest/probe"
+)
+
+func TestRun(t *testing.T) {
+	s := memserver.New()
+	s.AddUser("joe", "secret")
+	c, err := s.Dial()
+	if err != nil {
+		t.Fatalf("Dial() unexpected error; %v", err)
+	}
+	defer c.Logout(time.Second)
+	rep, err := probe.Run(c, probe.Config{Username: "joe", Password: "secret", LiteralSize: 100000})
+	if err != nil {
+		t.Fatalf("Run() unexpected error; %v", err)
+	}
+	want := map[string]probe.Status{
+		"imap4rev1":     probe.Pass,
+		"id":            probe.Skip,
+		"create":        probe.Pass,
+		"utf8-mailbox":  probe.Pass,
+		"append":        probe.Pass,
+		"long-literal":  probe.Pass,
+		"fetch":         probe.Pass,
+		"bodystructure": probe.Fail, // Not supported by memserver
+		"search":        probe.Pass,
+		"idle":          probe.Skip,
+		"move":          probe.Skip,
+		"cleanup":       probe.Pass,
+	}
+	if len(rep.Results) != len(want) {
+		t.Errorf("Run() expected %d results; got %d", len(want), len(rep.Results))
+	}
+	for name, status := range want {
+		if r := rep.Result(name); r == nil || r.Status != status {
+			t.Errorf("Result(%q) expected %v; got %+v", name, status, r)
+		}
+	}
+	if len(rep.Quirks) != 0 || len(rep.Broken) != 0 {
+		t.Errorf("Run() unexpected quirks %q or broken caps %q", rep.Quirks, rep.Broken)
+	}
+	if _, err = s.Messages("joe", "go-imap-probe"); err != memserver.ErrNoMailbox {
+		t.Errorf("scratch mailbox was not deleted; %v", err)
+	}
+	b, err := json.Marshal(rep)
+	if err != nil || !strings.Contains(string(b), `"name":"append","status":"pass"`) {
+		t.Errorf("json.Marshal() unexpected result %s, %v", b, err)
+	}
+
+	rep.Broken = []string{"UIDPLUS"}
+	rep.Apply(c)
+	if c.Caps.Has("UIDPLUS") {
+		t.Errorf("Apply() did not disable UIDPLUS")
+	}
+}
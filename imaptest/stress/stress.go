@@ -0,0 +1,598 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package stress generates load on an IMAP server with many concurrent
+connections and checks that the responses are consistent with each other.
+
+Run creates a scratch mailbox, fills it with a few messages, and starts
+Config.Clients workers. Each worker opens its own connection, selects the
+mailbox, and executes a random mix of SELECT, FETCH, STORE, and APPEND commands
+until Config.Duration elapses or Config.Ops commands have been executed. Since
+no messages are expunged, all connections must agree on the UID and the
+X-Stress-ID header of the message at each sequence number, the UIDVALIDITY
+value, and the fact that the number of messages never decreases. Each worker
+also sets and clears its own keyword with STORE and checks that the flags
+returned by the server reflect its changes. Any violation is reported as an
+inconsistency.
+
+The package is used to test the imap client (and the server package) under the
+race detector, and to benchmark servers:
+
+	rep, err := stress.Run(stress.Config{
+		Dial: func() (*imap.Client, error) {
+			return imap.DialTLS("imap.example.com", nil)
+		},
+		Username: "joe",
+		Password: "secret",
+		Clients:  50,
+		Duration: time.Minute,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	json.NewEncoder(os.Stdout).Encode(rep)
+*/
+package stress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// Op is a command executed by the workers.
+type Op int
+
+// Operations.
+const (
+	Select Op = iota // SELECT the scratch mailbox
+	Fetch            // FETCH the UID, flags, and X-Stress-ID of up to 10 messages
+	Store            // UID STORE +FLAGS or -FLAGS with the worker's keyword
+	Append           // APPEND a new message
+	numOps
+)
+
+var opNames = []string{"select", "fetch", "store", "append"}
+
+func (op Op) String() string {
+	if op >= 0 && op < numOps {
+		return opNames[op]
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// Mix specifies the relative frequencies of the operations.
+type Mix struct {
+	Select int
+	Fetch  int
+	Store  int
+	Append int
+}
+
+// DefaultMix is the operation mix used if Config.Mix is zero.
+var DefaultMix = Mix{Select: 1, Fetch: 6, Store: 2, Append: 1}
+
+// Config specifies the server and the load.
+type Config struct {
+	// Dial opens a new connection, which must be in the not authenticated or
+	// authenticated state. It is called once for the setup and once by each
+	// worker, possibly concurrently.
+	Dial func() (*imap.Client, error)
+
+	Username string
+	Password string
+
+	// Mailbox is the name of the scratch mailbox, which must not exist
+	// ("go-imap-stress" if empty). It is deleted at the end unless Keep is
+	// true.
+	Mailbox string
+	Keep    bool
+
+	// Clients is the number of concurrent connections (10 if zero).
+	Clients int
+
+	// Duration and Ops limit the run time and the number of operations
+	// executed by each worker. If both are zero, Duration is 10 seconds.
+	Duration time.Duration
+	Ops      int
+
+	// Mix is the operation mix (DefaultMix if zero).
+	Mix Mix
+
+	// Messages is the number of messages appended before the workers are
+	// started (10 if zero), and MessageSize is the approximate size of each
+	// message body (1 KiB if zero).
+	Messages    int
+	MessageSize int
+
+	// Seed initializes the random number generator of each worker, which is
+	// seeded with Seed plus the worker index.
+	Seed int64
+
+	// MaxErrors is the maximum number of command errors and inconsistencies
+	// that are recorded in the report (100 if zero). Further problems are only
+	// counted.
+	MaxErrors int
+}
+
+// Stats contains the results of one operation.
+type Stats struct {
+	Count  int           `json:"count"`  // Number of commands executed
+	Errors int           `json:"errors"` // Number of commands that failed
+	Total  time.Duration `json:"total"`  // Sum of command latencies
+	Min    time.Duration `json:"min"`    // Minimum latency
+	Max    time.Duration `json:"max"`    // Maximum latency
+}
+
+// Mean returns the mean latency.
+func (s *Stats) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// add records a single command.
+func (s *Stats) add(d time.Duration, err error) {
+	if s.Count++; s.Count == 1 || d < s.Min {
+		s.Min = d
+	}
+	if d > s.Max {
+		s.Max = d
+	}
+	s.Total += d
+	if err != nil {
+		s.Errors++
+	}
+}
+
+// merge adds the results of t to s.
+func (s *Stats) merge(t *Stats) {
+	if t.Count == 0 {
+		return
+	}
+	if s.Count == 0 || t.Min < s.Min {
+		s.Min = t.Min
+	}
+	if t.Max > s.Max {
+		s.Max = t.Max
+	}
+	s.Count += t.Count
+	s.Errors += t.Errors
+	s.Total += t.Total
+}
+
+// Report contains the results of a run.
+type Report struct {
+	Duration        time.Duration     `json:"duration"`                  // Time spent by the workers
+	Ops             map[string]*Stats `json:"ops"`                       // Results keyed by operation name
+	Errors          []string          `json:"errors,omitempty"`          // Command and connection errors
+	Inconsistencies []string          `json:"inconsistencies,omitempty"` // Consistency violations
+	Dropped         int               `json:"dropped,omitempty"`         // Problems beyond Config.MaxErrors
+}
+
+// Total returns the combined results of all operations.
+func (rep *Report) Total() *Stats {
+	total := new(Stats)
+	for _, s := range rep.Ops {
+		total.merge(s)
+	}
+	return total
+}
+
+// Rate returns the number of commands executed per second.
+func (rep *Report) Rate() float64 {
+	if rep.Duration <= 0 {
+		return 0
+	}
+	return float64(rep.Total().Count) / rep.Duration.Seconds()
+}
+
+// ErrNoDial is returned by Run if Config.Dial is nil.
+var ErrNoDial = errors.New("stress: Config.Dial is nil")
+
+// stressID is the header that identifies each message.
+const stressID = "X-Stress-Id"
+
+// state is the view of the mailbox shared by all workers.
+type state struct {
+	mu       sync.Mutex
+	rep      *Report
+	max      int               // Config.MaxErrors
+	validity uint32            // UIDVALIDITY
+	uids     map[uint32]uint32 // Sequence number -> UID
+	ids      map[uint32]string // UID -> X-Stress-ID
+}
+
+// Run creates the scratch mailbox and runs the workers. An error is returned if
+// the setup fails. Problems encountered by the workers, including failed
+// connections, are recorded in the report.
+func Run(cfg Config) (*Report, error) {
+	if cfg.Dial == nil {
+		return nil, ErrNoDial
+	}
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "go-imap-stress"
+	}
+	if cfg.Clients <= 0 {
+		cfg.Clients = 10
+	}
+	if cfg.Duration <= 0 && cfg.Ops <= 0 {
+		cfg.Duration = 10 * time.Second
+	}
+	if cfg.Mix == (Mix{}) {
+		cfg.Mix = DefaultMix
+	}
+	if cfg.Messages <= 0 {
+		cfg.Messages = 10
+	}
+	if cfg.MessageSize <= 0 {
+		cfg.MessageSize = 1024
+	}
+	if cfg.MaxErrors <= 0 {
+		cfg.MaxErrors = 100
+	}
+	st := &state{
+		rep:  &Report{Ops: make(map[string]*Stats)},
+		max:  cfg.MaxErrors,
+		uids: make(map[uint32]uint32),
+		ids:  make(map[uint32]string),
+	}
+	c, err := login(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout(time.Second)
+	if _, err = imap.Wait(c.Create(cfg.Mailbox)); err != nil {
+		return nil, err
+	}
+	for i := 0; i < cfg.Messages; i++ {
+		msg := message(fmt.Sprintf("setup-%d", i), cfg.MessageSize)
+		if _, err = imap.Wait(c.Append(cfg.Mailbox, nil, nil, imap.NewLiteral(msg))); err != nil {
+			return nil, err
+		}
+	}
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < cfg.Clients; i++ {
+		w := &worker{cfg: &cfg, st: st, id: i, keyword: imap.Flag(fmt.Sprintf("$Stress%d", i)),
+			rnd:   rand.New(rand.NewSource(cfg.Seed + int64(i))),
+			flags: make(map[uint32]bool),
+			ops:   make([]Stats, numOps)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run()
+		}()
+	}
+	wg.Wait()
+	st.rep.Duration = time.Since(start)
+
+	if !cfg.Keep {
+		if _, err = imap.Wait(c.Delete(cfg.Mailbox)); err != nil {
+			st.error("cleanup: %v", err)
+		}
+	}
+	return st.rep, nil
+}
+
+// login returns a new authenticated connection.
+func login(cfg Config) (*imap.Client, error) {
+	c, err := cfg.Dial()
+	if err != nil {
+		return nil, err
+	}
+	if c.State() == imap.Login {
+		if _, err = c.Login(cfg.Username, cfg.Password); err != nil {
+			c.Logout(time.Second)
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// message returns a message with the specified X-Stress-ID and a body of
+// approximately size bytes.
+func message(id string, size int) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: stress@example.com\r\nSubject: go-imap stress\r\n%s: %s\r\n\r\n",
+		stressID, id)
+	line := strings.Repeat("x", 76) + "\r\n"
+	for b.Len() < size {
+		b.WriteString(line)
+	}
+	return b.Bytes()
+}
+
+// error records a command or connection error.
+func (st *state) error(format string, v ...interface{}) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.rep.Errors) < st.max {
+		st.rep.Errors = append(st.rep.Errors, fmt.Sprintf(format, v...))
+	} else {
+		st.rep.Dropped++
+	}
+}
+
+// inconsistent records a consistency violation. st.mu must be held.
+func (st *state) inconsistent(format string, v ...interface{}) {
+	if len(st.rep.Inconsistencies) < st.max {
+		st.rep.Inconsistencies = append(st.rep.Inconsistencies, fmt.Sprintf(format, v...))
+	} else {
+		st.rep.Dropped++
+	}
+}
+
+// checkValidity verifies that all connections see the same UIDVALIDITY.
+func (st *state) checkValidity(w int, v uint32) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.validity == 0 {
+		st.validity = v
+	} else if v != st.validity {
+		st.inconsistent("client %d: UIDVALIDITY %d; expected %d", w, v, st.validity)
+	}
+}
+
+// checkMessage verifies that the sequence number, UID, and X-Stress-ID of a
+// message agree with those seen by other connections. An empty id is not
+// checked.
+func (st *state) checkMessage(w int, seq, uid uint32, id string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if seq != 0 && uid != 0 {
+		if prev, ok := st.uids[seq]; !ok {
+			st.uids[seq] = uid
+		} else if prev != uid {
+			st.inconsistent("client %d: message %d has UID %d; expected %d", w, seq, uid, prev)
+		}
+	}
+	if uid != 0 && id != "" {
+		if prev, ok := st.ids[uid]; !ok {
+			st.ids[uid] = id
+		} else if prev != id {
+			st.inconsistent("client %d: UID %d has %s %q; expected %q", w, uid, stressID, id, prev)
+		}
+	}
+}
+
+// worker executes commands over a single connection.
+type worker struct {
+	cfg     *Config
+	st      *state
+	c       *imap.Client
+	id      int
+	keyword imap.Flag       // Keyword changed by this worker
+	rnd     *rand.Rand      // Operation and message selection
+	flags   map[uint32]bool // UIDs that have the keyword
+	exists  uint32          // Largest number of messages seen
+	uidNext uint32          // Largest UIDNEXT seen
+	seq     int             // Number of appended messages
+	ops     []Stats
+}
+
+// run executes commands until the configured limit is reached and merges the
+// results into the report.
+func (w *worker) run() {
+	defer w.merge()
+	var err error
+	if w.c, err = login(*w.cfg); err != nil {
+		w.st.error("client %d: %v", w.id, err)
+		return
+	}
+	defer w.c.Logout(time.Second)
+	if err = w.exec(Select); err != nil {
+		return
+	}
+	mix := w.cfg.Mix
+	weights := []int{mix.Select, mix.Fetch, mix.Store, mix.Append}
+	sum := 0
+	for _, n := range weights {
+		sum += n
+	}
+	var deadline time.Time
+	if w.cfg.Duration > 0 {
+		deadline = time.Now().Add(w.cfg.Duration)
+	}
+	for n := 0; w.cfg.Ops <= 0 || n < w.cfg.Ops; n++ {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+		op, r := Op(0), w.rnd.Intn(sum)
+		for r >= weights[op] {
+			r -= weights[op]
+			op++
+		}
+		if err = w.exec(op); err != nil && w.c.State() == imap.Closed {
+			break
+		}
+	}
+}
+
+// exec executes a single operation and records the result.
+func (w *worker) exec(op Op) error {
+	var err error
+	start := time.Now()
+	switch op {
+	case Select:
+		err = w.selectMailbox()
+	case Fetch:
+		err = w.fetch()
+	case Store:
+		err = w.store()
+	case Append:
+		err = w.append()
+	}
+	w.ops[op].add(time.Since(start), err)
+	if err != nil {
+		w.st.error("client %d: %v: %v", w.id, op, err)
+	}
+	return err
+}
+
+// merge adds the worker results to the report.
+func (w *worker) merge() {
+	w.st.mu.Lock()
+	defer w.st.mu.Unlock()
+	for op := range w.ops {
+		if w.ops[op].Count == 0 {
+			continue
+		}
+		name := Op(op).String()
+		if w.st.rep.Ops[name] == nil {
+			w.st.rep.Ops[name] = new(Stats)
+		}
+		w.st.rep.Ops[name].merge(&w.ops[op])
+	}
+}
+
+// inconsistent records a consistency violation.
+func (w *worker) inconsistent(format string, v ...interface{}) {
+	w.st.mu.Lock()
+	defer w.st.mu.Unlock()
+	w.st.inconsistent("client %d: %s", w.id, fmt.Sprintf(format, v...))
+}
+
+func (w *worker) selectMailbox() error {
+	if _, err := w.c.Select(w.cfg.Mailbox, false); err != nil {
+		return err
+	}
+	mbox := w.c.Mailbox
+	w.st.checkValidity(w.id, mbox.UIDValidity)
+	if mbox.Messages < w.exists {
+		w.inconsistent("SELECT returned %d messages; %d seen before", mbox.Messages, w.exists)
+	}
+	if mbox.UIDNext != 0 && mbox.UIDNext < w.uidNext {
+		w.inconsistent("UIDNEXT decreased from %d to %d", w.uidNext, mbox.UIDNext)
+	}
+	w.exists, w.uidNext = mbox.Messages, mbox.UIDNext
+	return nil
+}
+
+func (w *worker) fetch() error {
+	n := w.c.Mailbox.Messages
+	if n == 0 {
+		return nil
+	}
+	first := uint32(w.rnd.Intn(int(n))) + 1
+	last := first + uint32(w.rnd.Intn(10))
+	if last > n {
+		last = n
+	}
+	var seq imap.SeqSet
+	seq.AddRange(first, last)
+	cmd, err := imap.Wait(w.c.Fetch(&seq, "UID", "FLAGS",
+		"BODY.PEEK[HEADER.FIELDS ("+strings.ToUpper(stressID)+")]"))
+	if err != nil {
+		return err
+	}
+	// Changes made by other connections cause unsolicited FETCH responses with
+	// the FLAGS of messages that may be outside of the requested range.
+	var count uint32
+	for _, msg := range cmd.Messages() {
+		if msg.Seq < first || last < msg.Seq || !hasHeader(msg) {
+			continue
+		}
+		count++
+		id := msg.Header().Get(stressID)
+		if msg.UID == 0 || id == "" {
+			w.inconsistent("FETCH message %d without UID or %s", msg.Seq, stressID)
+		}
+		w.st.checkMessage(w.id, msg.Seq, msg.UID, id)
+		if msg.Flags != nil && msg.Flags.Has(w.keyword) != w.flags[msg.UID] {
+			w.inconsistent("UID %d has keyword %s=%v; expected %v",
+				msg.UID, w.keyword, !w.flags[msg.UID], w.flags[msg.UID])
+		}
+	}
+	if count != last-first+1 {
+		w.inconsistent("FETCH %d:%d returned %d messages", first, last, count)
+	}
+	if n := w.c.Mailbox.Messages; n > w.exists {
+		w.exists = n
+	}
+	return nil
+}
+
+// hasHeader returns true if msg contains the header data item requested by the
+// fetch operation. Unsolicited FETCH responses may contain the UID, but not the
+// header.
+func hasHeader(msg *imap.MessageInfo) bool {
+	for name := range msg.Attrs {
+		if strings.HasPrefix(name, "BODY[HEADER.FIELDS") {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *worker) store() error {
+	n := w.c.Mailbox.Messages
+	if n == 0 {
+		return nil
+	}
+	seq := uint32(w.rnd.Intn(int(n))) + 1
+	var uid uint32
+	if w.c.UIDs != nil {
+		uid = w.c.UIDs.UID(seq)
+	}
+	if uid == 0 {
+		// The UID of this message is not known yet
+		var set imap.SeqSet
+		set.AddNum(seq)
+		cmd, err := imap.Wait(w.c.Fetch(&set, "UID"))
+		if err != nil {
+			return err
+		}
+		for _, msg := range cmd.Messages() {
+			if msg.Seq == seq {
+				uid = msg.UID
+			}
+		}
+		if uid == 0 {
+			return fmt.Errorf("UID of message %d not returned", seq)
+		}
+	}
+	set := imap.NewSeqSetNums([]uint32{uid})
+	item, on := "+FLAGS", !w.flags[uid]
+	if !on {
+		item = "-FLAGS"
+	}
+	cmd, err := imap.Wait(w.c.UIDStore(set, item, imap.NewFlagSet(w.keyword)))
+	if err != nil {
+		return err
+	}
+	w.flags[uid] = on
+	for _, msg := range cmd.Messages() {
+		if msg.UID == uid && msg.Flags != nil && msg.Flags.Has(w.keyword) != on {
+			w.inconsistent("UID STORE %d %s returned flags %v", uid, item, msg.Flags)
+		}
+	}
+	return nil
+}
+
+func (w *worker) append() error {
+	w.seq++
+	id := fmt.Sprintf("client%d-%d", w.id, w.seq)
+	msg := imap.NewLiteral(message(id, w.cfg.MessageSize))
+	cmd, err := imap.Wait(w.c.Append(w.cfg.Mailbox, nil, nil, msg))
+	if err != nil {
+		return err
+	}
+	if rsp, _ := cmd.Result(imap.OK); rsp != nil && rsp.Label == "APPENDUID" && len(rsp.Fields) == 3 {
+		if imap.AsNumber(rsp.Fields[1]) != w.c.Mailbox.UIDValidity {
+			w.inconsistent("APPENDUID validity %v; expected %d", rsp.Fields[1], w.c.Mailbox.UIDValidity)
+		}
+		w.st.checkMessage(w.id, 0, imap.AsNumber(rsp.Fields[2]), id)
+	}
+	return nil
+}
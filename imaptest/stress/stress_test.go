@@ -0,0 +1,173 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stress_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mxk/go-imap/imap"
+	"github.com/mxk/go-imap/imaptest/memserver"
+	"github.com/mxk/go-imap/imaptest/stress"
+)
+
+func TestRun(t *testing.T) {
+	s := memserver.New()
+	s.AddUser("joe", "secret")
+	cfg := stress.Config{
+		Dial:     s.Dial,
+		Username: "joe",
+		Password: "secret",
+		Clients:  8,
+		Ops:      50,
+		Messages: 5,
+		Seed:     1,
+	}
+	rep, err := stress.Run(cfg)
+	if err != nil {
+		t.Fatalf("Run() unexpected error; %v", err)
+	}
+	if len(rep.Errors) != 0 || len(rep.Inconsistencies) != 0 || rep.Dropped != 0 {
+		t.Errorf("Run() unexpected problems:\nerrors: %q\ninconsistencies: %q",
+			rep.Errors, rep.Inconsistencies)
+	}
+	total := rep.Total()
+	if want := cfg.Clients * (cfg.Ops + 1); total.Count != want {
+		t.Errorf("Total().Count expected %d; got %d", want, total.Count)
+	}
+	for _, op := range []stress.Op{stress.Select, stress.Fetch, stress.Store, stress.Append} {
+		if st := rep.Ops[op.String()]; st == nil || st.Count == 0 || st.Mean() > st.Max {
+			t.Errorf("Ops[%q] unexpected stats %+v", op, st)
+		}
+	}
+	if rep.Rate() <= 0 {
+		t.Errorf("Rate() expected > 0")
+	}
+	if _, err = s.Messages("joe", "go-imap-stress"); err != memserver.ErrNoMailbox {
+		t.Errorf("scratch mailbox was not deleted; %v", err)
+	}
+
+	// Setup errors are returned
+	cfg.Password = "wrong"
+	if _, err = stress.Run(cfg); err == nil {
+		t.Errorf("Run() expected a login error")
+	}
+	cfg.Dial = nil
+	if _, err = stress.Run(cfg); err != stress.ErrNoDial {
+		t.Errorf("Run() expected ErrNoDial; got %v", err)
+	}
+}
+
+func TestRunKeep(t *testing.T) {
+	s := memserver.New()
+	s.AddUser("joe", "secret")
+	rep, err := stress.Run(stress.Config{
+		Dial:     s.Dial,
+		Username: "joe",
+		Password: "secret",
+		Mailbox:  "Load",
+		Keep:     true,
+		Clients:  3,
+		Ops:      20,
+		Mix:      stress.Mix{Append: 1},
+	})
+	if err != nil {
+		t.Fatalf("Run() unexpected error; %v", err)
+	}
+	msgs, err := s.Messages("joe", "Load")
+	if want := 10 + 3*20; len(msgs) != want || err != nil {
+		t.Errorf("Messages() expected %d; got %d (%v)", want, len(msgs), err)
+	}
+	if st := rep.Ops["fetch"]; st != nil {
+		t.Errorf("Ops[fetch] expected nil; got %+v", st)
+	}
+}
+
+// unsolicitedConn inserts an unsolicited FETCH response for a message that was
+// not requested before each FETCH response written by the server.
+type unsolicitedConn struct {
+	net.Conn
+	n int32
+}
+
+func (c *unsolicitedConn) Write(b []byte) (int, error) {
+	if bytes.HasPrefix(b, []byte("* ")) && bytes.Contains(b, []byte(" FETCH (")) {
+		atomic.AddInt32(&c.n, 1)
+		if _, err := c.Conn.Write([]byte("* 1000 FETCH (FLAGS (\\Seen))\r\n")); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
+
+func TestRunUnsolicited(t *testing.T) {
+	s := memserver.New()
+	s.AddUser("joe", "secret")
+	var conns []*unsolicitedConn
+	var mu sync.Mutex
+	rep, err := stress.Run(stress.Config{
+		Dial: func() (*imap.Client, error) {
+			c, sc := net.Pipe()
+			uc := &unsolicitedConn{Conn: sc}
+			mu.Lock()
+			conns = append(conns, uc)
+			mu.Unlock()
+			go s.Serve(uc)
+			return imap.NewClient(c, "memserver", 0)
+		},
+		Username: "joe",
+		Password: "secret",
+		Clients:  2,
+		Ops:      30,
+		Mix:      stress.Mix{Fetch: 3, Store: 1},
+		Seed:     1,
+	})
+	if err != nil {
+		t.Fatalf("Run() unexpected error; %v", err)
+	}
+	if len(rep.Errors) != 0 || len(rep.Inconsistencies) != 0 {
+		t.Errorf("Run() unexpected problems:\nerrors: %q\ninconsistencies: %q",
+			rep.Errors, rep.Inconsistencies)
+	}
+	n := int32(0)
+	for _, c := range conns {
+		n += atomic.LoadInt32(&c.n)
+	}
+	if n == 0 {
+		t.Errorf("no unsolicited FETCH responses were sent")
+	}
+}
+
+func TestRunMaxErrors(t *testing.T) {
+	s := memserver.New()
+	s.AddUser("joe", "secret")
+	var mu sync.Mutex
+	n := 0
+	rep, err := stress.Run(stress.Config{
+		Dial: func() (*imap.Client, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if n++; n > 1 {
+				return nil, errors.New("dial failed")
+			}
+			return s.Dial()
+		},
+		Username:  "joe",
+		Password:  "secret",
+		Clients:   3,
+		Ops:       1,
+		MaxErrors: 1,
+	})
+	if err != nil {
+		t.Fatalf("Run() unexpected error; %v", err)
+	}
+	if len(rep.Errors) != 1 || rep.Dropped != 2 {
+		t.Errorf("Run() expected 1 error and 2 dropped; got %q and %d", rep.Errors, rep.Dropped)
+	}
+}
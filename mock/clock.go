@@ -0,0 +1,153 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// Clock is a fake imap.Clock that only moves forward when Advance is called. It
+// allows tests to cover IDLE renewal, polling, timeouts, and retry delays
+// without waiting for real time to pass:
+//
+//	clock := mock.NewClock(time.Time{})
+//	c.Clock = clock
+//	go w.Run(stop)
+//	clock.BlockUntil(1)              // Watcher is waiting for a response
+//	clock.Advance(29 * time.Minute) // IDLE is renewed
+type Clock struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	now     time.Time
+	pending []*clockTimer // Sorted by expiration time
+}
+
+// clockTimer is a pending After, Sleep, or AfterFunc call.
+type clockTimer struct {
+	clock *Clock
+	when  time.Time
+	ch    chan time.Time // Channel returned by After
+	f     func()         // Function passed to AfterFunc
+}
+
+// NewClock returns a Clock set to t. If t is the zero time, the clock starts at
+// 2013-01-01 00:00:00 UTC.
+func NewClock(t time.Time) *Clock {
+	if t.IsZero() {
+		t = time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	c := &Clock{now: t}
+	c.cond.L = &c.mu
+	return c
+}
+
+// Now returns the current time of the fake clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the fake time once the clock has been
+// advanced by d.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	t := &clockTimer{ch: make(chan time.Time, 1)}
+	c.add(t, d)
+	return t.ch
+}
+
+// Sleep blocks until the clock has been advanced by d.
+func (c *Clock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// AfterFunc calls f in its own goroutine once the clock has been advanced by d.
+func (c *Clock) AfterFunc(d time.Duration, f func()) imap.Timer {
+	t := &clockTimer{f: f}
+	c.add(t, d)
+	return t
+}
+
+// Advance moves the clock forward by d and fires all timers that expire by the
+// new time in the order of their expiration times.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	i := sort.Search(len(c.pending), func(i int) bool {
+		return c.pending[i].when.After(c.now)
+	})
+	due := append([]*clockTimer(nil), c.pending[:i]...)
+	c.pending = append(c.pending[:0], c.pending[i:]...)
+	now := c.now
+	c.mu.Unlock()
+	for _, t := range due {
+		t.fire(now)
+	}
+}
+
+// Pending returns the number of timers that have not expired or been stopped.
+func (c *Clock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// BlockUntil blocks until at least n timers are pending. It is used to wait for
+// the code under test to start a timer before calling Advance.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.pending) < n {
+		c.cond.Wait()
+	}
+}
+
+// add starts timer t, which expires after d. Timers with d <= 0 fire
+// immediately.
+func (c *Clock) add(t *clockTimer, d time.Duration) {
+	c.mu.Lock()
+	t.clock, t.when = c, c.now.Add(d)
+	if d <= 0 {
+		now := c.now
+		c.mu.Unlock()
+		t.fire(now)
+		return
+	}
+	i := sort.Search(len(c.pending), func(i int) bool {
+		return c.pending[i].when.After(t.when)
+	})
+	c.pending = append(c.pending, nil)
+	copy(c.pending[i+1:], c.pending[i:])
+	c.pending[i] = t
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// fire delivers the time to the After channel or calls the AfterFunc function.
+func (t *clockTimer) fire(now time.Time) {
+	if t.f != nil {
+		go t.f()
+	} else {
+		t.ch <- now
+	}
+}
+
+// Stop removes the timer from the clock.
+func (t *clockTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.pending {
+		if p == t {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
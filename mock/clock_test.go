@@ -0,0 +1,157 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+	"github.com/mxk/go-imap/mock"
+)
+
+func TestClock(t *testing.T) {
+	clock := mock.NewClock(time.Time{})
+	start := clock.Now()
+	a := clock.After(2 * time.Minute)
+	b := clock.After(time.Minute)
+	called := make(chan struct{})
+	clock.AfterFunc(time.Minute, func() { close(called) })
+	stopped := clock.AfterFunc(time.Minute, func() { t.Errorf("stopped timer fired") })
+	if !stopped.Stop() || stopped.Stop() {
+		t.Errorf("Stop() expected true, then false")
+	}
+	if n := clock.Pending(); n != 3 {
+		t.Fatalf("Pending() expected 3; got %d", n)
+	}
+
+	clock.Advance(time.Minute)
+	if now := <-b; !now.Equal(start.Add(time.Minute)) {
+		t.Errorf("After(1m) expected %v; got %v", start.Add(time.Minute), now)
+	}
+	<-called
+	select {
+	case <-a:
+		t.Fatalf("After(2m) fired after 1m")
+	default:
+	}
+	clock.Advance(time.Hour)
+	<-a
+	if n := clock.Pending(); n != 0 {
+		t.Errorf("Pending() expected 0; got %d", n)
+	}
+	if now := clock.Now(); !now.Equal(start.Add(61 * time.Minute)) {
+		t.Errorf("Now() expected %v; got %v", start.Add(61*time.Minute), now)
+	}
+}
+
+func TestClockIdleRenewal(T *testing.T) {
+	t := mock.Server(T,
+		`S: * PREAUTH [CAPABILITY IMAP4rev1 IDLE] Server ready`,
+		`C: A1 EXAMINE "INBOX"`,
+		`S: * 1 EXISTS`,
+		`S: A1 OK [READ-ONLY] EXAMINE completed`,
+		`C: A2 IDLE`,
+		`S: + idling`,
+		`C: DONE`,
+		`S: A2 OK IDLE terminated`,
+		`C: A3 IDLE`,
+		`S: + idling`,
+		`S: * 2 EXISTS`,
+		`C: DONE`,
+		`S: A3 OK IDLE terminated`,
+	)
+	c, err := t.Dial()
+	if err != nil {
+		t.Join(err)
+	}
+	clock := mock.NewClock(time.Time{})
+	c.Clock = clock
+
+	w := imap.NewWatcher(c, "INBOX")
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() { done <- w.Run(stop) }()
+
+	// The first IDLE command is renewed without waiting 29 minutes
+	clock.BlockUntil(1)
+	clock.Advance(imap.DefaultIdleTimeout)
+	if ev := <-w.Events; ev.Type != imap.WatchNew || ev.Seq != 2 {
+		t.Errorf("Events expected new message 2; got %+v", ev)
+	}
+	close(stop)
+	for {
+		select {
+		case err = <-done:
+			t.Join(err)
+			return
+		case <-time.After(time.Millisecond):
+			clock.Advance(time.Second)
+		}
+	}
+}
+
+func TestClockRetryDelay(T *testing.T) {
+	t := mock.Server(T,
+		`S: * PREAUTH [CAPABILITY IMAP4rev1] Server ready`,
+		`C: A1 EXAMINE "INBOX"`,
+		`S: * 1 EXISTS`,
+		`S: A1 OK [READ-ONLY] EXAMINE completed`,
+		`C: A2 UID FETCH 42 (BODY.PEEK[]<0.16>)`,
+		`S: A2 NO Temporary failure`,
+		`C: A3 UID FETCH 42 (BODY.PEEK[]<0.16>)`,
+		`S: * 1 FETCH (UID 42 BODY[]<0> "hello")`,
+		`S: A3 OK FETCH completed`,
+	)
+	c, err := t.Dial()
+	if err == nil {
+		_, err = c.Select("INBOX", true)
+	}
+	if err != nil {
+		t.Join(err)
+	}
+	clock := mock.NewClock(time.Time{})
+	c.Clock = clock
+
+	f := imap.NewChunkedFetch(42, nil)
+	f.ChunkSize, f.RetryDelay = 16, time.Hour
+	var buf bytes.Buffer
+	done := make(chan error, 1)
+	go func() { done <- f.Run(c, &buf) }()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	t.Join(<-done)
+	if buf.String() != "hello" || !f.Done {
+		t.Errorf("Run() unexpected result %q (Done=%v)", buf.String(), f.Done)
+	}
+}
+
+func TestClockRecvTimeout(T *testing.T) {
+	clock := mock.NewClock(time.Time{})
+	t := mock.Server(T,
+		`S: * PREAUTH [CAPABILITY IMAP4rev1] Server ready`,
+		mock.ScriptFunc(func(imap.MockServer) error {
+			clock.BlockUntil(1)
+			return nil
+		}),
+		`S: * 1 EXISTS`,
+	)
+	c, err := t.Dial()
+	if err != nil {
+		t.Join(err)
+	}
+	c.Clock = clock
+
+	// The timer is stopped once the response is received
+	if err = c.Recv(time.Hour); err != nil {
+		t.Fatalf("c.Recv() unexpected error; %v", err)
+	}
+	if n := clock.Pending(); n != 0 {
+		t.Errorf("Pending() expected 0; got %d", n)
+	}
+	t.Join(nil)
+}
@@ -0,0 +1,297 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrInjected is returned by FaultConn.Write when the connection is closed by a
+// Disconnect fault.
+var ErrInjected = errors.New("mock: connection closed by fault injection")
+
+// FaultOp identifies the direction of the data that a fault applies to.
+type FaultOp int
+
+// Fault directions.
+const (
+	OnRead  FaultOp = iota // Data received by the wrapped side (Read)
+	OnWrite                // Data sent by the wrapped side (Write)
+)
+
+// FaultKind specifies what happens when a fault is triggered.
+type FaultKind int
+
+// Fault kinds.
+const (
+	// Latency delays the transfer of the data that contains the trigger
+	// point by Fault.Delay.
+	Latency FaultKind = iota
+
+	// Disconnect closes the connection at the trigger point. The data before
+	// it is delivered, after which Read returns io.EOF and Write returns
+	// ErrInjected.
+	Disconnect
+
+	// Corrupt XORs the byte at the trigger point with Fault.Mask.
+	Corrupt
+
+	// ShortWrite makes Write return io.ErrShortWrite after writing the data
+	// before the trigger point. The caller is responsible for the remaining
+	// data. ShortWrite is ignored for OnRead faults.
+	ShortWrite
+)
+
+// Fault describes a single fault that is injected by a FaultConn. The trigger
+// point is a byte offset in the stream of data sent in the direction specified
+// by Op. If After is empty, the offset is Offset bytes from the start of the
+// stream. Otherwise, it is Offset bytes past the end of the first occurrence of
+// After in the stream. For example, a disconnect 10 bytes into the first 32-byte
+// literal received from the server is specified as:
+//
+//	mock.Fault{Op: mock.OnRead, Kind: mock.Disconnect, After: "{32}\r\n", Offset: 10}
+//
+// Each fault is triggered at most once.
+type Fault struct {
+	Op     FaultOp
+	Kind   FaultKind
+	After  string        // Pattern that starts the offset count
+	Offset int64         // Offset of the trigger point
+	Delay  time.Duration // Latency delay
+	Mask   byte          // Corrupt XOR mask (0xFF if 0)
+}
+
+// String returns a description of the fault.
+func (f Fault) String() string {
+	var op, kind string
+	if op = "read"; f.Op == OnWrite {
+		op = "write"
+	}
+	switch f.Kind {
+	case Latency:
+		kind = "Latency(" + f.Delay.String() + ")"
+	case Disconnect:
+		kind = "Disconnect"
+	case Corrupt:
+		kind = "Corrupt"
+	case ShortWrite:
+		kind = "ShortWrite"
+	default:
+		kind = fmt.Sprintf("FaultKind(%d)", int(f.Kind))
+	}
+	if f.After != "" {
+		return fmt.Sprintf("%s on %s at %+q%+d", kind, op, f.After, f.Offset)
+	}
+	return fmt.Sprintf("%s on %s at %d", kind, op, f.Offset)
+}
+
+// FaultConn is a net.Conn that injects faults into the data passing through
+// it. It is used to exercise the error handling and reconnect logic of a client
+// deterministically, since faults are triggered at fixed points in the data
+// rather than at random times. The client must be created on top of the
+// FaultConn:
+//
+//	fc := mock.NewFaultConn(conn,
+//		mock.Fault{Op: mock.OnRead, Kind: mock.Latency, Delay: time.Second},
+//		mock.Fault{Op: mock.OnWrite, Kind: mock.Corrupt, After: "LOGIN "},
+//	)
+//	c, err := imap.NewClient(fc, "imap.example.com", 30*time.Second)
+type FaultConn struct {
+	net.Conn
+
+	mu     sync.Mutex
+	r, w   faultStream
+	fired  []Fault
+	closed bool // Connection was closed by a Disconnect fault
+}
+
+// faultStream is the state of the data sent in one direction.
+type faultStream struct {
+	off    int64         // Number of bytes transferred
+	tail   []byte        // End of the transferred data for pattern matching
+	faults []*faultState // Faults that have not been triggered
+}
+
+// faultState tracks the trigger point of a fault.
+type faultState struct {
+	Fault
+	at int64 // Trigger point or -1 if After has not been seen
+}
+
+// NewFaultConn returns a FaultConn that injects the specified faults into the
+// data transferred over conn.
+func NewFaultConn(conn net.Conn, faults ...Fault) *FaultConn {
+	c := &FaultConn{Conn: conn}
+	for _, f := range faults {
+		fs := &faultState{Fault: f, at: f.Offset}
+		if f.After != "" {
+			fs.at = -1
+		}
+		if f.Kind == Corrupt && fs.Mask == 0 {
+			fs.Mask = 0xFF
+		}
+		if f.Op == OnWrite {
+			c.w.faults = append(c.w.faults, fs)
+		} else if f.Kind != ShortWrite {
+			c.r.faults = append(c.r.faults, fs)
+		}
+	}
+	return c
+}
+
+// Read reads data from the connection and applies OnRead faults to it.
+func (c *FaultConn) Read(b []byte) (n int, err error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return 0, io.EOF
+	}
+	if n, err = c.Conn.Read(b); n == 0 {
+		return
+	}
+	c.mu.Lock()
+	b, delay, end := c.apply(&c.r, b[:n], b[:n])
+	c.mu.Unlock()
+	if n = len(b); end != nil {
+		c.Conn.Close()
+		if err = nil; n == 0 {
+			err = io.EOF
+		}
+	}
+	time.Sleep(delay)
+	return
+}
+
+// Write applies OnWrite faults to a copy of b and writes it to the connection.
+func (c *FaultConn) Write(b []byte) (n int, err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, ErrInjected
+	}
+	data, delay, end := c.apply(&c.w, b, nil)
+	c.mu.Unlock()
+	time.Sleep(delay)
+	if len(data) > 0 {
+		if n, err = c.Conn.Write(data); err != nil {
+			return
+		}
+	}
+	if end == ErrInjected {
+		c.Conn.Close()
+	}
+	return n, end
+}
+
+// apply triggers the faults of stream s for the transfer of b. It returns the
+// data that should be transferred, the total latency, and ErrInjected or
+// io.ErrShortWrite if the transfer is cut short. Corrupted bytes are written to
+// buf, or to a copy of b if buf is nil. Faults with trigger points that are cut
+// off by a Disconnect or ShortWrite remain pending. c.mu must be held by the
+// caller.
+func (c *FaultConn) apply(s *faultStream, b, buf []byte) (data []byte, delay time.Duration, end error) {
+	fired := s.trigger(b)
+	lim := len(b)
+	for _, f := range fired {
+		if i := int(f.at - s.off); (f.Kind == Disconnect || f.Kind == ShortWrite) && i < lim {
+			lim = i
+			if end = io.ErrShortWrite; f.Kind == Disconnect {
+				end = ErrInjected
+			}
+		}
+	}
+	data = b[:lim]
+	for _, f := range fired {
+		i := int(f.at - s.off)
+		switch {
+		case f.Kind == Disconnect || f.Kind == ShortWrite:
+			if i > lim || (i == lim && end == nil) {
+				s.faults = append(s.faults, f)
+				continue
+			}
+		case i >= lim:
+			s.faults = append(s.faults, f)
+			continue
+		case f.Kind == Latency:
+			delay += f.Delay
+		case f.Kind == Corrupt:
+			if buf == nil {
+				buf = append([]byte(nil), b...)
+			}
+			data = buf[:lim]
+			data[i] ^= f.Mask
+		}
+		c.fired = append(c.fired, f.Fault)
+	}
+	s.advance(data)
+	if end == ErrInjected {
+		c.closed = true
+	}
+	return
+}
+
+// Fired returns the faults that have been triggered so far in the order in
+// which they were triggered.
+func (c *FaultConn) Fired() []Fault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Fault(nil), c.fired...)
+}
+
+// trigger returns the faults with trigger points in b and removes them from
+// the stream. Faults that follow a pattern are armed when the pattern is found.
+func (s *faultStream) trigger(b []byte) (fired []*faultState) {
+	end := s.off + int64(len(b))
+	keep := s.faults[:0]
+	for _, f := range s.faults {
+		if f.at < 0 {
+			buf := append(append([]byte(nil), s.tail...), b...)
+			if i := bytes.Index(buf, []byte(f.After)); i >= 0 {
+				base := s.off - int64(len(s.tail))
+				f.at = base + int64(i+len(f.After)) + f.Offset
+			}
+		}
+		if f.at >= 0 && f.at < end {
+			if f.at < s.off {
+				f.at = s.off
+			}
+			fired = append(fired, f)
+		} else {
+			keep = append(keep, f)
+		}
+	}
+	for i := len(keep); i < len(s.faults); i++ {
+		s.faults[i] = nil
+	}
+	s.faults = keep
+	return
+}
+
+// advance updates the stream offset and pattern matching state after b has
+// been transferred.
+func (s *faultStream) advance(b []byte) {
+	s.off += int64(len(b))
+	max := 0
+	for _, f := range s.faults {
+		if f.at < 0 && len(f.After) > max {
+			max = len(f.After)
+		}
+	}
+	if max--; max <= 0 {
+		s.tail = s.tail[:0]
+		return
+	}
+	s.tail = append(s.tail, b...)
+	if len(s.tail) > max {
+		s.tail = append(s.tail[:0], s.tail[len(s.tail)-max:]...)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+func TestFaultConnRead(t *testing.T) {
+	a, b := NewConn("a", "b", 0)
+	fc := NewFaultConn(a,
+		Fault{Op: OnRead, Kind: Corrupt, After: "abc", Offset: 1},
+		Fault{Op: OnRead, Kind: Latency, Offset: 2, Delay: 20 * time.Millisecond},
+		Fault{Op: OnRead, Kind: Disconnect, After: "{4}\r\n", Offset: 2},
+		Fault{Op: OnRead, Kind: Corrupt, After: "never"},
+	)
+	go func() {
+		b.Write([]byte("xxab"))
+		time.Sleep(10 * time.Millisecond)
+		b.Write([]byte("cdef {4}\r\n1234 more"))
+	}()
+
+	buf := make([]byte, 4)
+	start := time.Now()
+	if n, err := io.ReadFull(fc, buf); n != 4 || err != nil {
+		t.Fatalf("ReadFull() expected 4 bytes; got %d (%v)", n, err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("Read() expected latency >= 20ms; got %v", d)
+	}
+	rest, err := ioutil.ReadAll(fc)
+	if want := "cd" + string([]byte{'e' ^ 0xFF}) + "f {4}\r\n12"; string(rest) != want || err != nil {
+		t.Errorf("ReadAll() expected %+q; got %+q (%v)", want, rest, err)
+	}
+	if n, err := fc.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("Read() after disconnect expected io.EOF; got %d (%v)", n, err)
+	}
+	if n, err := b.Write([]byte("x")); err == nil {
+		t.Errorf("remote Write() after disconnect expected an error; got %d", n)
+	}
+	if fired := fc.Fired(); len(fired) != 3 {
+		t.Errorf("Fired() expected 3 faults; got %v", fired)
+	}
+}
+
+func TestFaultConnWrite(t *testing.T) {
+	a, b := NewConn("a", "b", 0)
+	fc := NewFaultConn(a,
+		Fault{Op: OnWrite, Kind: ShortWrite, Offset: 3},
+		Fault{Op: OnWrite, Kind: Corrupt, After: "LOGIN ", Mask: 0x20},
+		Fault{Op: OnWrite, Kind: Disconnect, After: "\r\n"},
+	)
+	in := []byte("A1 LOGIN joe pass\r\nA2 NOOP\r\n")
+	n, err := fc.Write(in)
+	if n != 3 || err != io.ErrShortWrite {
+		t.Fatalf("Write() expected io.ErrShortWrite after 3 bytes; got %d (%v)", n, err)
+	}
+	if n, err = fc.Write(in[n:]); n != 16 || err != ErrInjected {
+		t.Fatalf("Write() expected ErrInjected after 16 bytes; got %d (%v)", n, err)
+	}
+	if string(in) != "A1 LOGIN joe pass\r\nA2 NOOP\r\n" {
+		t.Errorf("Write() modified the caller's buffer: %+q", in)
+	}
+	out, err := ioutil.ReadAll(b)
+	if want := "A1 LOGIN Joe pass\r\n"; string(out) != want || err != nil {
+		t.Errorf("remote ReadAll() expected %+q; got %+q (%v)", want, out, err)
+	}
+	if _, err = fc.Write([]byte("A2 NOOP\r\n")); err != ErrInjected {
+		t.Errorf("Write() after disconnect expected ErrInjected; got %v", err)
+	}
+	if fired := fc.Fired(); len(fired) != 3 {
+		t.Errorf("Fired() expected 3 faults; got %v", fired)
+	}
+}
+
+func TestFaultConnLiteral(T *testing.T) {
+	msg := "Subject: test\r\n\r\nHello, World!\r\n"
+	t := Server(T,
+		`S: * PREAUTH [CAPABILITY IMAP4rev1] Server ready`,
+		Expect(`A1 SELECT "INBOX"`),
+		`S: * 1 EXISTS`,
+		Respond(`{tag} OK [READ-WRITE] SELECT completed`),
+		Expect(`A2 FETCH 1 (BODY[])`),
+		Send("* 1 FETCH (BODY[] {32}\r\n"+msg+")\r\n"),
+	)
+	fc := NewFaultConn(t.cn, Fault{Op: OnRead, Kind: Disconnect, After: "{32}\r\n", Offset: 10})
+	t.cn = nil
+	c, err := imap.NewClient(fc, ServerName, Timeout)
+	if err == nil {
+		_, err = imap.Wait(c.Select("INBOX", false))
+	}
+	if err != nil {
+		t.Join(err)
+	}
+	set, _ := imap.NewSeqSet("1")
+	if _, err = imap.Wait(c.Fetch(set, "BODY[]")); err == nil {
+		t.Fatalf("Fetch() expected an error")
+	}
+	t.Join(nil)
+	if _, err = imap.Wait(c.Noop()); err == nil {
+		t.Errorf("Noop() after disconnect expected an error")
+	}
+	if fired := fc.Fired(); len(fired) != 1 || fired[0].Kind != Disconnect {
+		t.Errorf("Fired() expected a disconnect; got %v", fired)
+	}
+}
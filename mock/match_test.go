@@ -0,0 +1,34 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		ok         bool
+	}{
+		{``, ``, true},
+		{``, `A1 NOOP`, false},
+		{`A1 NOOP`, `A1 NOOP`, true},
+		{`A? NOOP`, `A1 NOOP`, true},
+		{`A? NOOP`, `A12 NOOP`, false},
+		{`* NOOP`, `A12 NOOP`, true},
+		{`* NOOP`, `A12 NOOPS`, false},
+		{`*`, ``, true},
+		{`* FETCH 1:\* (*)`, `A3 FETCH 1:* (FLAGS UID)`, true},
+		{`* FETCH 1:\* (*)`, `A3 FETCH 1:5 (FLAGS UID)`, false},
+		{`* LIST "" *`, `A4 LIST "" "*"`, true},
+		{`\\?`, `\x`, true},
+		{`\\?`, `x`, false},
+		{`a\`, `a\`, true},
+	}
+	for _, test := range tests {
+		if ok := match(test.pattern, test.s); ok != test.ok {
+			t.Errorf("match(%+q, %+q) expected %v; got %v", test.pattern, test.s, test.ok, ok)
+		}
+	}
+}
@@ -12,6 +12,20 @@ server follows a script that tells it what to send/receive and when. Everything
 received from the client is checked against the script and an error is returned
 if there is a mismatch.
 
+Scripts that should not depend on exact command tags or arguments can use the
+Expect and Respond actions. Expect matches the next line from the client against
+a pattern with wildcards, and Respond sends a line containing the tag of the
+last command received:
+
+	t.Script(
+		mock.Expect(`* FETCH 1:\* (FLAGS*)`),
+		`S: * 1 FETCH (FLAGS (\Seen))`,
+		mock.Respond(`{tag} OK FETCH completed`),
+	)
+
+A session with a real server can be captured by a Recorder and played back by
+Replay, which turns server quirks observed in the field into regression tests.
+
 See mock_test.go for examples of how to use this package in your unit tests.
 */
 package mock
@@ -20,8 +34,10 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -45,6 +61,19 @@ type (
 	Recv []byte
 )
 
+// Expect is a script action that reads one line from the client and compares it
+// with a pattern. In the pattern, '*' matches any sequence of characters, '?'
+// matches any single character, and '\\' causes the next character to be
+// matched literally (e.g. `\*` for the "*" in a sequence set). The script fails
+// with an error that shows the pattern and the received line if they do not
+// match.
+type Expect string
+
+// Respond is a script action that sends one line to the client. Each occurrence
+// of "{tag}" is replaced with the tag of the last line received from the client
+// by a "C: " or Expect action.
+type Respond string
+
 // ScriptFunc is function type called during script execution to control the
 // server state. STARTTLS, DEFLATE, and CLOSE are predefined script actions for
 // the most common operations.
@@ -67,6 +96,11 @@ type T struct {
 
 	c  *imap.Client // Client instance
 	cn net.Conn     // Client connection used by Dial and DialTLS
+
+	// Command state tracked by the script for Respond actions
+	tag  string // Tag of the last command received
+	lit  int    // Number of literal bytes that the client has yet to send
+	cont bool   // Next line continues a command after a literal
 }
 
 // Server launches a new scripted server that can handle one client connection.
@@ -122,6 +156,9 @@ func (t *T) DialTLS(config *tls.Config) (*imap.Client, error) {
 // implicit CRLF at the end of each line. Send and Recv allow the server to send
 // and receive raw bytes (usually literal strings). ScriptFunc allows server
 // state changes by calling methods on the provided imap.MockServer instance.
+// Expect and Respond are like "C: " and "S: " lines, but allow wildcards in
+// client lines and the command tag in server lines. A []interface{} action is
+// replaced with the actions that it contains (see StartTLSScript).
 func (t *T) Script(script ...interface{}) {
 	select {
 	case <-t.ch:
@@ -132,7 +169,20 @@ func (t *T) Script(script ...interface{}) {
 	}
 	ch := make(chan interface{}, 1)
 	t.ch = ch
-	go t.script(script, ch)
+	go t.script(flatten(nil, script), ch)
+}
+
+// flatten appends the actions in script to dst, replacing each []interface{}
+// action with its contents.
+func flatten(dst, script []interface{}) []interface{} {
+	for _, v := range script {
+		if group, ok := v.([]interface{}); ok {
+			dst = flatten(dst, group)
+		} else {
+			dst = append(dst, v)
+		}
+	}
+	return dst
 }
 
 // Join waits for script completion and reports any errors encountered by the
@@ -176,9 +226,19 @@ func (t *T) script(script []interface{}, ch chan<- interface{}) {
 			} else if strings.HasPrefix(v, "C: ") {
 				b, err := t.s.ReadLine()
 				t.compare(ln, v[3:], string(b), err)
+				t.setTag(b)
 			} else {
 				panicf(`[#%d] %+q must be prefixed with "S: " or "C: "`, ln, v)
 			}
+		case Expect:
+			b, err := t.s.ReadLine()
+			if err != nil || !match(string(v), string(b)) {
+				panicf("[#%d] expected line matching %+q; got %+q (%v)", ln, string(v), b, err)
+			}
+			t.setTag(b)
+		case Respond:
+			err := t.s.WriteLine([]byte(strings.Replace(string(v), "{tag}", t.tag, -1)))
+			t.flush(ln, v, err)
 		case Send:
 			_, err := t.s.Write(v)
 			t.flush(ln, v, err)
@@ -186,6 +246,17 @@ func (t *T) script(script []interface{}, ch chan<- interface{}) {
 			b := make([]byte, len(v))
 			_, err := io.ReadFull(t.s, b)
 			t.compare(ln, string(v), string(b), err)
+			if t.lit > 0 {
+				if t.lit -= len(b); t.lit <= 0 {
+					t.lit, t.cont = 0, true
+				}
+			}
+		case skipLiteral:
+			_, err := io.CopyN(ioutil.Discard, t.s, int64(t.lit))
+			if err != nil {
+				panicf("[#%d] error skipping %d-byte literal: %v", ln, t.lit, err)
+			}
+			t.lit, t.cont = 0, true
 		case ScriptFunc:
 			t.run(ln, v)
 		case func(s imap.MockServer) error:
@@ -213,6 +284,65 @@ func (t *T) compare(ln int, v, b string, err error) {
 	}
 }
 
+// setTag saves the tag of a line received from the client. Literals and the
+// parts of a command that follow them are skipped.
+func (t *T) setTag(line []byte) {
+	if n := len(line) + 2; t.lit >= n {
+		t.lit -= n
+		t.cont = t.lit == 0
+		return
+	} else if t.lit > 0 {
+		if t.lit < len(line) {
+			line = line[t.lit:]
+		} else {
+			line = nil
+		}
+		t.lit = 0
+	} else if i := strings.IndexByte(string(line), ' '); i > 0 && !t.cont {
+		t.tag = string(line[:i])
+	}
+	t.cont = false
+	if n := len(line); n > 0 && line[n-1] == '}' {
+		if i := strings.LastIndexByte(string(line), '{'); i >= 0 {
+			size := strings.TrimSuffix(string(line[i+1:n-1]), "+")
+			if v, err := strconv.Atoi(size); err == nil {
+				t.lit, t.cont = v, v == 0
+			}
+		}
+	}
+}
+
+// match returns true if s matches the Expect pattern.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch c := pattern[0]; c {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+			s = s[1:]
+		default:
+			if c == '\\' && len(pattern) > 1 {
+				pattern = pattern[1:]
+				c = pattern[0]
+			}
+			if s == "" || s[0] != c {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return s == ""
+}
+
 // run calls v and panics if it returns an error.
 func (t *T) run(ln int, v ScriptFunc) {
 	if err := v(t.s); err != nil {
@@ -174,3 +174,48 @@ func TestLiteral(T *testing.T) {
 	_, err = imap.Wait(c.List("", "*"))
 	t.Join(err)
 }
+
+func TestExpect(T *testing.T) {
+	t := mock.Server(T,
+		`S: * PREAUTH [CAPABILITY IMAP4rev1] Server ready`,
+	)
+	c, err := t.Dial()
+	t.Join(err)
+
+	// Wildcards and tag substitution
+	t.Script(
+		mock.Expect(`* SELECT "INBOX"`),
+		`S: * 1 EXISTS`,
+		mock.Respond(`{tag} OK [READ-WRITE] SELECT completed`),
+		mock.Expect(`* FETCH 1:\* (FLAGS*)`),
+		`S: * 1 FETCH (FLAGS (\Seen))`,
+		mock.Respond(`{tag} OK FETCH completed`),
+		mock.Expect(`A? NOOP`),
+		mock.Respond(`{tag} OK NOOP completed`),
+	)
+	set, _ := imap.NewSeqSet("1:*")
+	var cmd *imap.Command
+	if _, err = imap.Wait(c.Select("INBOX", false)); err == nil {
+		if cmd, err = imap.Wait(c.Fetch(set, "FLAGS", "UID")); err == nil {
+			_, err = imap.Wait(c.Noop())
+		}
+	}
+	t.Join(err)
+	if len(cmd.Data) != 1 {
+		t.Errorf("cmd.Data expected 1 response; got %d", len(cmd.Data))
+	}
+
+	// The tag is not taken from literal data
+	msg := []byte("From: joe\r\n\r\nHi\r\n")
+	t.Script(
+		mock.Expect(`* APPEND "INBOX" {17}`),
+		`S: + Ready for literal data`,
+		`C: From: joe`,
+		`C: `,
+		`C: Hi`,
+		`C: `,
+		mock.Respond(`{tag} OK APPEND completed`),
+	)
+	_, err = imap.Wait(c.Append("INBOX", nil, nil, imap.NewLiteral(msg)))
+	t.Join(err)
+}
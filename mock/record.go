@@ -0,0 +1,337 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// RecordOptions control what a Recorder writes to the transcript.
+type RecordOptions struct {
+	// RedactAuth replaces the arguments of LOGIN commands, the initial response
+	// of AUTHENTICATE commands, and the client side of the SASL exchange with
+	// wildcards, which match any credentials during replay.
+	RedactAuth bool
+
+	// RedactLiterals replaces the contents of server literals with 'x'
+	// characters, keeping only the line breaks. Client literals are not
+	// recorded, and are skipped during replay.
+	RedactLiterals bool
+
+	// MaxLiteral is the maximum number of bytes recorded for each literal. Longer
+	// server literals are truncated, and their size is changed to match. Longer
+	// client literals are not recorded, and are skipped during replay. A value
+	// <= 0 means no limit.
+	MaxLiteral int
+}
+
+// Recorder is a net.Conn that writes everything sent and received by an IMAP
+// client to a transcript, which can be replayed by the scripted server to test
+// the client against the behavior of a real server (see Replay). The client
+// must be created on top of the Recorder:
+//
+//	conn, err := tls.Dial("tcp", "imap.example.com:993", nil)
+//	...
+//	rec := mock.NewRecorder(conn, f, mock.RecordOptions{RedactAuth: true})
+//	c, err := imap.NewClient(rec, "imap.example.com", 30*time.Second)
+//
+// The recorder only sees the data passed through it, so STARTTLS and COMPRESS
+// must not be used after the client is created.
+//
+// Each line of the transcript is a record that begins with "S" (server) or "C"
+// (client) followed by a type character and a space:
+//
+//	S: / C:  a line of text without the CRLF
+//	S+ / C+  raw data (e.g. a literal) as a Go-quoted string
+//	C?       a line pattern for the Expect action
+//	C-       a client literal that is skipped during replay
+//	S-       the server closed the connection
+//
+// Empty lines and lines that begin with '#' are ignored by ReadTranscript, so
+// transcripts may be edited by hand.
+type Recorder struct {
+	net.Conn
+
+	mu   sync.Mutex
+	w    io.Writer
+	opts RecordOptions
+	c, s recStream
+	auth string // Tag of the AUTHENTICATE command in progress
+	eof  bool   // Server closed the connection
+	err  error  // First transcript write error
+}
+
+// recStream is the parser state for data sent in one direction.
+type recStream struct {
+	client bool
+	line   []byte // Incomplete line
+	lit    int    // Remaining literal bytes
+	keep   int    // Number of literal bytes to record
+	data   []byte // Recorded literal bytes
+	cont   bool   // Next line continues a command after a literal
+	redact bool   // Current command is redacted
+}
+
+// NewRecorder returns a Recorder that writes the transcript of conn to w.
+func NewRecorder(conn net.Conn, w io.Writer, opts RecordOptions) *Recorder {
+	return &Recorder{Conn: conn, w: w, opts: opts, c: recStream{client: true}}
+}
+
+// Read reads server data from the connection and records it.
+func (r *Recorder) Read(b []byte) (n int, err error) {
+	n, err = r.Conn.Read(b)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.feed(&r.s, b[:n])
+	if err == io.EOF && !r.eof {
+		r.eof = true
+		r.printf("S-")
+	}
+	return
+}
+
+// Write records client data and writes it to the connection. The data is
+// recorded first to ensure that commands appear in the transcript before the
+// responses.
+func (r *Recorder) Write(b []byte) (n int, err error) {
+	r.mu.Lock()
+	r.feed(&r.c, b)
+	r.mu.Unlock()
+	return r.Conn.Write(b)
+}
+
+// Err returns the first error encountered while writing the transcript.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// feed splits data into lines and literals.
+func (r *Recorder) feed(s *recStream, b []byte) {
+	for len(b) > 0 {
+		if s.lit > 0 {
+			n := s.lit
+			if n > len(b) {
+				n = len(b)
+			}
+			if k := s.keep - len(s.data); k > 0 {
+				if k > n {
+					k = n
+				}
+				s.data = append(s.data, b[:k]...)
+			}
+			if s.lit -= n; s.lit == 0 {
+				r.literal(s)
+			}
+			b = b[n:]
+			continue
+		}
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			s.line = append(s.line, b...)
+			return
+		}
+		line := append(s.line, b[:i+1]...)
+		s.line, b = nil, b[i+1:]
+		r.line(s, line)
+	}
+}
+
+// line records a complete line, which may end with a literal size.
+func (r *Recorder) line(s *recStream, line []byte) {
+	cont := s.cont
+	s.cont = false
+	text, ok := lineText(line)
+	size, lit := -1, false
+	if ok {
+		size, lit = literalSize(text)
+	}
+	if !s.client {
+		if !cont && r.auth != "" && strings.HasPrefix(text, r.auth+" ") {
+			r.auth = ""
+		}
+		s.keep = size
+		if max := r.opts.MaxLiteral; lit && max > 0 && size > max {
+			s.keep = max
+			text = text[:strings.LastIndexByte(text, '{')] + "{" + strconv.Itoa(max) + "}"
+		}
+		if ok {
+			r.printf("S: %s", text)
+		} else {
+			r.printf("S+ %s", strconv.Quote(string(line)))
+		}
+	} else {
+		pattern := "*"
+		if !cont {
+			s.redact = r.auth != ""
+			if f := strings.Fields(text); r.opts.RedactAuth && len(f) >= 2 {
+				switch cmd := strings.ToUpper(f[1]); {
+				case cmd == "LOGIN":
+					s.redact = true
+					pattern = escapePattern(f[0]+" "+f[1]) + " *"
+				case cmd == "AUTHENTICATE" && len(f) >= 3:
+					s.redact, r.auth = true, f[0]
+					pattern = escapePattern(f[0]+" "+f[1]+" "+f[2]) + "*"
+				}
+			}
+		}
+		s.keep = size
+		if lit && (s.redact || r.opts.RedactLiterals || (r.opts.MaxLiteral > 0 && size > r.opts.MaxLiteral)) {
+			s.keep = -1
+		}
+		if s.redact && ok {
+			r.printf("C? %s", pattern)
+		} else if ok {
+			r.printf("C: %s", text)
+		} else {
+			r.printf("C+ %s", strconv.Quote(string(line)))
+		}
+	}
+	if lit {
+		if s.lit, s.data = size, nil; size == 0 {
+			s.cont = true
+		}
+	}
+}
+
+// literal records the contents of a literal.
+func (r *Recorder) literal(s *recStream) {
+	s.cont = true
+	switch {
+	case s.client && s.keep < 0:
+		r.printf("C-")
+	case s.client:
+		r.printf("C+ %s", strconv.Quote(string(s.data)))
+	default:
+		if r.opts.RedactLiterals {
+			for i, c := range s.data {
+				if c != '\r' && c != '\n' {
+					s.data[i] = 'x'
+				}
+			}
+		}
+		r.printf("S+ %s", strconv.Quote(string(s.data)))
+	}
+	s.data = nil
+}
+
+// printf writes one record to the transcript.
+func (r *Recorder) printf(format string, v ...interface{}) {
+	if r.err == nil {
+		_, r.err = fmt.Fprintf(r.w, format+"\n", v...)
+	}
+}
+
+// lineText returns the line without the CRLF. It returns false if the line
+// must be recorded as raw data, because it does not end with CRLF or contains
+// other CR or NUL characters.
+func lineText(line []byte) (string, bool) {
+	n := len(line)
+	if n < 2 || line[n-2] != '\r' || bytes.IndexByte(line[:n-2], '\r') >= 0 ||
+		bytes.IndexByte(line, 0) >= 0 {
+		return "", false
+	}
+	return string(line[:n-2]), true
+}
+
+// literalSize returns the size of the literal at the end of a line.
+func literalSize(text string) (int, bool) {
+	n := len(text)
+	if n == 0 || text[n-1] != '}' {
+		return -1, false
+	}
+	i := strings.LastIndexByte(text, '{')
+	if i < 0 {
+		return -1, false
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(text[i+1:n-1], "+"))
+	if err != nil || size < 0 {
+		return -1, false
+	}
+	return size, true
+}
+
+// escapePattern escapes the characters that have a special meaning in Expect
+// patterns.
+func escapePattern(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '*' || c == '?' || c == '\\' {
+			b = append(b, '\\')
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+// skipLiteral is a script action that discards the literal that was announced
+// by the last line received from the client.
+type skipLiteral struct{}
+
+// ReadTranscript parses a transcript written by Recorder and returns the
+// equivalent script actions.
+func ReadTranscript(r io.Reader) ([]interface{}, error) {
+	var script []interface{}
+	br := bufio.NewReader(r)
+	for ln := 1; ; ln++ {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return script, nil
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		typ, arg := line, ""
+		if len(line) >= 3 && line[2] == ' ' {
+			typ, arg = line[:2], line[3:]
+		}
+		var v interface{}
+		switch typ {
+		case "S:", "C:":
+			v = typ + " " + arg
+		case "C?":
+			v = Expect(arg)
+		case "S+", "C+":
+			s, err := strconv.Unquote(arg)
+			if err != nil {
+				return nil, fmt.Errorf("mock: transcript line %d: invalid data (%v)", ln, err)
+			} else if typ == "S+" {
+				v = Send(s)
+			} else {
+				v = Recv(s)
+			}
+		case "C-":
+			v = skipLiteral{}
+		case "S-":
+			v = CLOSE
+		default:
+			return nil, fmt.Errorf("mock: transcript line %d: invalid record %+q", ln, line)
+		}
+		script = append(script, v)
+	}
+}
+
+// Replay launches a scripted server that plays back a transcript written by
+// Recorder. It is equivalent to calling Server with the result of
+// ReadTranscript. The test fails if the transcript cannot be read.
+func Replay(t *testing.T, r io.Reader) *T {
+	script, err := ReadTranscript(r)
+	if err != nil {
+		t.Fatalf(cl("mock.Replay() %v"), err)
+	}
+	return Server(t, script...)
+}
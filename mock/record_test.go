@@ -0,0 +1,154 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// recordSession runs a short session with a client that logs in with the given
+// password.
+func recordSession(c *imap.Client, pass string) (body []byte, err error) {
+	if _, err = imap.Wait(c.Login("joe", pass)); err != nil {
+		return
+	}
+	if _, err = imap.Wait(c.Select("INBOX", false)); err != nil {
+		return
+	}
+	set, _ := imap.NewSeqSet("1")
+	cmd, err := imap.Wait(c.Fetch(set, "BODY[]"))
+	if err != nil {
+		return
+	}
+	body = imap.AsBytes(cmd.Data[0].MessageInfo().Attrs["BODY[]"])
+	msg := imap.NewLiteral([]byte("Subject: test\r\n\r\nHello, World!\r\n"))
+	if _, err = imap.Wait(c.Append("INBOX", nil, nil, msg)); err != nil {
+		return
+	}
+	_, err = imap.Wait(c.Logout(Timeout))
+	return
+}
+
+func TestRecordReplay(T *testing.T) {
+	msg := "Subject: test\r\n\r\nHello, World!\r\n"
+	t := Server(T,
+		`S: * OK [CAPABILITY IMAP4rev1] Server ready`,
+		Expect(`A1 LOGIN *`),
+		Respond(`{tag} OK [CAPABILITY IMAP4rev1] LOGIN completed`),
+		Expect(`A2 SELECT "INBOX"`),
+		`S: * 1 EXISTS`,
+		Respond(`{tag} OK [READ-WRITE] SELECT completed`),
+		Expect(`A3 FETCH 1 (BODY[])`),
+		`S: * 1 FETCH (BODY[] {32}`,
+		Send(msg+")\r\n"),
+		Respond(`{tag} OK FETCH completed`),
+		Expect(`A4 APPEND "INBOX" {32}`),
+		`S: + Ready for literal data`,
+		Recv(msg),
+		`C: `,
+		Respond(`{tag} OK APPEND completed`),
+		Expect(`A5 LOGOUT`),
+		`S: * BYE Bye`,
+		Respond(`{tag} OK LOGOUT completed`),
+		CLOSE,
+	)
+	var buf bytes.Buffer
+	rec := NewRecorder(t.cn, &buf, RecordOptions{RedactAuth: true, MaxLiteral: 10})
+	t.cn = nil
+	c, err := imap.NewClient(rec, ServerName, Timeout)
+	if err == nil {
+		_, err = recordSession(c, "secret")
+	}
+	t.Join(err)
+	if rec.Err() != nil {
+		t.Fatalf("rec.Err() unexpected error; %v", rec.Err())
+	}
+
+	transcript := buf.String()
+	for _, want := range []string{
+		"C? A1 LOGIN *\n",
+		"S: * 1 FETCH (BODY[] {10}\n",
+		`S+ "Subject: t"` + "\n",
+		`S: )` + "\n",
+		`C: A4 APPEND "INBOX" {32}` + "\n",
+		"C-\n",
+		"S-\n",
+	} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("transcript does not contain %+q:\n%s", want, transcript)
+		}
+	}
+	if strings.Contains(transcript, "secret") {
+		t.Errorf("transcript contains the password:\n%s", transcript)
+	}
+
+	// Replay with a different password
+	t = Replay(T, strings.NewReader(transcript))
+	if c, err = t.Dial(); err == nil {
+		var body []byte
+		if body, err = recordSession(c, "other"); string(body) != "Subject: t" {
+			t.Errorf("replayed BODY[] expected %+q; got %+q", "Subject: t", body)
+		}
+	}
+	t.Join(err)
+}
+
+func TestReadTranscript(t *testing.T) {
+	script, err := ReadTranscript(strings.NewReader(
+		"# comment\n" +
+			"S: * OK ready\r\n" +
+			"\n" +
+			"C: A1 NOOP\n" +
+			"C? A2 LOGIN *\n" +
+			"S+ \"abc\\r\\n\"\n" +
+			"C+ \"xyz\"\n" +
+			"C-\n" +
+			"S-\n"))
+	if err != nil {
+		t.Fatalf("ReadTranscript() unexpected error; %v", err)
+	}
+	want := []interface{}{
+		"S: * OK ready",
+		"C: A1 NOOP",
+		Expect("A2 LOGIN *"),
+		Send("abc\r\n"),
+		Recv("xyz"),
+		skipLiteral{},
+		CLOSE,
+	}
+	if len(script) != len(want) {
+		t.Fatalf("ReadTranscript() expected %d actions; got %d", len(want), len(script))
+	}
+	for i := range want {
+		if s, w := toString(script[i]), toString(want[i]); s != w {
+			t.Errorf("ReadTranscript() action %d expected %s; got %s", i, w, s)
+		}
+	}
+	for _, bad := range []string{"X: foo\n", "S+ unquoted\n", "S:no space\n"} {
+		if _, err := ReadTranscript(strings.NewReader(bad)); err == nil {
+			t.Errorf("ReadTranscript(%+q) expected an error", bad)
+		}
+	}
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case Send:
+		return "Send(" + string(v) + ")"
+	case Recv:
+		return "Recv(" + string(v) + ")"
+	case Expect:
+		return "Expect(" + string(v) + ")"
+	case skipLiteral:
+		return "skipLiteral"
+	case func(s imap.MockServer) error:
+		return "ScriptFunc"
+	}
+	return v.(string)
+}
@@ -5,15 +5,22 @@
 package mock
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"math/big"
+	"net"
 	"sync"
+	"testing"
 	"time"
+
+	"github.com/mxk/go-imap/imap"
 )
 
 var tlsCfg = struct {
@@ -40,37 +47,202 @@ func serverTLS() *tls.Config {
 }
 
 func newConfig() (client, server *tls.Config) {
+	crt, err := NewCert(CertOptions{})
+	if err != nil {
+		panic(err)
+	}
+	return crt.ClientConfig(), crt.ServerConfig()
+}
+
+// CertOptions control the certificate generated by NewCert.
+type CertOptions struct {
+	// Hosts are the DNS names and IP addresses for which the certificate is
+	// valid (ServerName if empty).
+	Hosts []string
+
+	// NotBefore and NotAfter specify the validity period (2 hours before and
+	// after the current time if zero).
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// Cert is a self-signed certificate for the scripted server. The client must
+// trust the certificate itself, since there is no separate CA.
+type Cert struct {
+	tls.Certificate
+	Leaf    *x509.Certificate // Parsed certificate
+	CertPEM []byte            // PEM-encoded certificate
+	KeyPEM  []byte            // PEM-encoded private key
+}
+
+// NewCert generates a new self-signed certificate with an ECDSA P-256 key.
+func NewCert(opts CertOptions) (*Cert, error) {
 	now := time.Now()
+	if opts.NotBefore.IsZero() {
+		opts.NotBefore = now.Add(-2 * time.Hour)
+	}
+	if opts.NotAfter.IsZero() {
+		opts.NotAfter = now.Add(2 * time.Hour)
+	}
+	if len(opts.Hosts) == 0 {
+		opts.Hosts = []string{ServerName}
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 63))
+	if err != nil {
+		return nil, err
+	}
 	tpl := x509.Certificate{
-		SerialNumber:          new(big.Int).SetInt64(42),
-		Subject:               pkix.Name{CommonName: ServerName},
-		NotBefore:             now.Add(-2 * time.Hour).UTC(),
-		NotAfter:              now.Add(2 * time.Hour).UTC(),
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: opts.Hosts[0]},
+		NotBefore:             opts.NotBefore.UTC(),
+		NotAfter:              opts.NotAfter.UTC(),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
-		IsCA: true,
+		IsCA:                  true,
 	}
-	priv, err := rsa.GenerateKey(rand.Reader, 512)
+	for _, h := range opts.Hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tpl.IPAddresses = append(tpl.IPAddresses, ip)
+		} else {
+			tpl.DNSNames = append(tpl.DNSNames, h)
+		}
+	}
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	crt, err := x509.CreateCertificate(rand.Reader, &tpl, &tpl, &priv.PublicKey, priv)
+	der, err := x509.CreateCertificate(rand.Reader, &tpl, &tpl, &priv.PublicKey, priv)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	key := x509.MarshalPKCS1PrivateKey(priv)
-	pair, err := tls.X509KeyPair(
-		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt}),
-		pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: key}),
-	)
+	key, err := x509.MarshalECPrivateKey(priv)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	c := &Cert{
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}),
+	}
+	if c.Certificate, err = tls.X509KeyPair(c.CertPEM, c.KeyPEM); err != nil {
+		return nil, err
+	}
+	if c.Leaf, err = x509.ParseCertificate(der); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ServerConfig returns a server configuration that uses the certificate.
+func (c *Cert) ServerConfig() *tls.Config {
+	return &tls.Config{Certificates: []tls.Certificate{c.Certificate}}
+}
+
+// ClientConfig returns a client configuration that trusts the certificate and
+// expects ServerName.
+func (c *Cert) ClientConfig() *tls.Config {
+	config := &tls.Config{RootCAs: x509.NewCertPool(), ServerName: ServerName}
+	config.RootCAs.AddCert(c.Leaf)
+	return config
+}
+
+// TLSFault identifies a broken TLS configuration returned by BrokenTLS.
+type TLSFault int
+
+// TLS configuration faults.
+const (
+	ExpiredCert   TLSFault = iota // Server certificate has expired
+	WrongHost                     // Server certificate is for a different host
+	UntrustedCert                 // Client does not trust the server certificate
+	OldProtocol                   // Server only supports TLS 1.0
+)
+
+var tlsFaultNames = []string{"ExpiredCert", "WrongHost", "UntrustedCert", "OldProtocol"}
+
+func (f TLSFault) String() string {
+	if f >= 0 && int(f) < len(tlsFaultNames) {
+		return tlsFaultNames[f]
+	}
+	return fmt.Sprintf("TLSFault(%d)", int(f))
+}
+
+// BrokenTLS returns client and server configurations that cause the TLS
+// handshake to fail for the specified reason. The client configuration is
+// otherwise valid, so the same handshake succeeds with a correct server, and
+// client code can be tested for the way it reports or tolerates the error
+// (e.g. with InsecureSkipVerify).
+func BrokenTLS(f TLSFault) (client, server *tls.Config) {
+	opts := CertOptions{}
+	switch f {
+	case ExpiredCert:
+		opts.NotBefore = time.Now().Add(-48 * time.Hour)
+		opts.NotAfter = time.Now().Add(-24 * time.Hour)
+	case WrongHost:
+		opts.Hosts = []string{"wrong." + ServerName}
 	}
-	root, err := x509.ParseCertificate(crt)
+	crt, err := NewCert(opts)
 	if err != nil {
 		panic(err)
 	}
-	server = &tls.Config{Certificates: []tls.Certificate{pair}}
-	client = &tls.Config{RootCAs: x509.NewCertPool(), ServerName: ServerName}
-	client.RootCAs.AddCert(root)
+	client, server = crt.ClientConfig(), crt.ServerConfig()
+	switch f {
+	case UntrustedCert:
+		client.RootCAs = x509.NewCertPool()
+	case OldProtocol:
+		server.MinVersion = tls.VersionTLS10
+		server.MaxVersion = tls.VersionTLS10
+		client.MinVersion = tls.VersionTLS12
+	}
 	return
 }
+
+// errTLSSucceeded is returned by the FailTLS action if the handshake succeeds.
+var errTLSSucceeded = errors.New("mock: TLS handshake succeeded")
+
+// EnableTLS returns a script action that performs the server side of the TLS
+// handshake with config. The STARTTLS action is equivalent to EnableTLS(nil),
+// which uses the same configuration as the default client configuration of
+// DialTLS and StartTLS.
+func EnableTLS(config *tls.Config) ScriptFunc {
+	return func(s imap.MockServer) error {
+		if config == nil {
+			config = serverTLS()
+		}
+		return s.EnableTLS(config)
+	}
+}
+
+// FailTLS returns a script action that performs the server side of a TLS
+// handshake that is expected to fail (see BrokenTLS). The connection is closed
+// after the failure. The action returns an error if the handshake succeeds.
+func FailTLS(config *tls.Config) ScriptFunc {
+	return func(s imap.MockServer) error {
+		if config == nil {
+			config = serverTLS()
+		}
+		if err := s.EnableTLS(config); err == nil {
+			return errTLSSucceeded
+		}
+		s.Close(false)
+		return nil
+	}
+}
+
+// StartTLSScript returns the script actions that accept a STARTTLS command and
+// perform the handshake with config (the default configuration if nil). The
+// returned slice may be used as a single action in a script.
+func StartTLSScript(config *tls.Config) []interface{} {
+	return []interface{}{
+		Expect(`* STARTTLS`),
+		Respond(`{tag} OK Begin TLS negotiation now`),
+		EnableTLS(config),
+	}
+}
+
+// ServerTLS launches a scripted server that performs the TLS handshake with
+// config (the default configuration if nil) before running the script, which
+// simulates a server that uses implicit TLS (port 993). The client must connect
+// with DialTLS.
+func ServerTLS(t *testing.T, config *tls.Config, script ...interface{}) *T {
+	return Server(t, append([]interface{}{EnableTLS(config)}, script...)...)
+}
@@ -0,0 +1,101 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mock_test
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/mxk/go-imap/imap"
+	"github.com/mxk/go-imap/mock"
+)
+
+func TestNewCert(t *testing.T) {
+	crt, err := mock.NewCert(mock.CertOptions{Hosts: []string{"a.example", "127.0.0.1"}})
+	if err != nil {
+		t.Fatalf("NewCert() unexpected error; %v", err)
+	}
+	if err = crt.Leaf.VerifyHostname("a.example"); err != nil {
+		t.Errorf("VerifyHostname(a.example) unexpected error; %v", err)
+	}
+	if err = crt.Leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("VerifyHostname(127.0.0.1) unexpected error; %v", err)
+	}
+	if _, err = tls.X509KeyPair(crt.CertPEM, crt.KeyPEM); err != nil {
+		t.Errorf("X509KeyPair() unexpected error; %v", err)
+	}
+}
+
+func TestServerTLS(T *testing.T) {
+	crt, err := mock.NewCert(mock.CertOptions{})
+	if err != nil {
+		T.Fatalf("NewCert() unexpected error; %v", err)
+	}
+	t := mock.ServerTLS(T, crt.ServerConfig(),
+		`S: * PREAUTH [CAPABILITY IMAP4rev1] Server ready`,
+	)
+	c, err := t.DialTLS(crt.ClientConfig())
+	t.Join(err)
+	if c.State() != imap.Auth {
+		t.Errorf("c.State() expected Auth; got %v", c.State())
+	}
+}
+
+func TestStartTLSScript(T *testing.T) {
+	t := mock.Server(T,
+		`S: * OK [CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED] Server ready`,
+		mock.StartTLSScript(nil),
+		`C: A2 CAPABILITY`,
+		`S: * CAPABILITY IMAP4rev1`,
+		`S: A2 OK CAPABILITY completed`,
+	)
+	c, err := t.Dial()
+	if err == nil {
+		err = t.StartTLS(nil)
+	}
+	t.Join(err)
+	if c.Caps["LOGINDISABLED"] {
+		t.Errorf("LOGINDISABLED advertised after STARTTLS")
+	}
+}
+
+func TestBrokenTLS(T *testing.T) {
+	for _, f := range []mock.TLSFault{mock.ExpiredCert, mock.WrongHost, mock.UntrustedCert, mock.OldProtocol} {
+		client, server := mock.BrokenTLS(f)
+
+		// Implicit TLS
+		t := mock.Server(T, mock.FailTLS(server))
+		if _, err := t.DialTLS(client); err == nil {
+			t.Errorf("%v: t.DialTLS() expected an error", f)
+		}
+		t.Join(nil)
+
+		// STARTTLS
+		t = mock.Server(T,
+			`S: * OK [CAPABILITY IMAP4rev1 STARTTLS] Server ready`,
+			`C: A1 STARTTLS`,
+			`S: A1 OK Begin TLS negotiation now`,
+			mock.FailTLS(server),
+		)
+		_, err := t.Dial()
+		if err != nil {
+			t.Join(err)
+		}
+		if err = t.StartTLS(client); err == nil {
+			t.Errorf("%v: t.StartTLS() expected an error", f)
+		}
+		t.Join(nil)
+
+		// The client accepts the connection if verification is disabled
+		if f != mock.OldProtocol {
+			client.InsecureSkipVerify = true
+			t = mock.ServerTLS(T, server,
+				`S: * PREAUTH [CAPABILITY IMAP4rev1] Server ready`,
+			)
+			_, err = t.DialTLS(client)
+			t.Join(err)
+		}
+	}
+}
@@ -0,0 +1,501 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// systemFlags maps the upper-case names of system flags to their canonical
+// form, since flag names are case-insensitive.
+var systemFlags = map[string]string{
+	`\ANSWERED`: `\Answered`,
+	`\FLAGGED`:  `\Flagged`,
+	`\DELETED`:  `\Deleted`,
+	`\SEEN`:     `\Seen`,
+	`\DRAFT`:    `\Draft`,
+}
+
+// seqMessage is a message and its sequence number in the session view.
+type seqMessage struct {
+	seq uint32
+	*Message
+}
+
+// seqRange is an inclusive range of sequence numbers or UIDs.
+type seqRange struct{ start, stop uint32 }
+
+// parseSeqSet parses a sequence set in which "*" stands for max. If strict is
+// true, numbers greater than max are not allowed.
+func parseSeqSet(s string, max uint32, strict bool) ([]seqRange, error) {
+	var set []seqRange
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(part, ":", 2)
+		var r [2]uint32
+		for i, b := range bounds {
+			if b == "*" {
+				r[i] = max
+				continue
+			}
+			n, err := strconv.ParseUint(b, 10, 32)
+			if err != nil || n == 0 || (strict && n > uint64(max)) {
+				return nil, errSeqSet
+			}
+			r[i] = uint32(n)
+		}
+		if len(bounds) == 1 {
+			r[1] = r[0]
+		} else if r[0] > r[1] {
+			r[0], r[1] = r[1], r[0]
+		}
+		set = append(set, seqRange{r[0], r[1]})
+	}
+	return set, nil
+}
+
+// uids returns the UIDs of the messages in a sequence set argument, which
+// contains UIDs if uid is true. Only the messages in the session view are
+// included.
+func (s *session) uids(v interface{}, uid bool) ([]uint32, error) {
+	a, ok := v.(atom)
+	if !ok {
+		return nil, errSeqSet
+	}
+	max := uint32(len(s.view))
+	if uid && max > 0 {
+		max = s.view[max-1]
+	}
+	set, err := parseSeqSet(string(a), max, !uid)
+	if err != nil {
+		return nil, err
+	}
+	var uids []uint32
+	for i, u := range s.view {
+		q := uint32(i + 1)
+		if uid {
+			q = u
+		}
+		for _, r := range set {
+			if r.start <= q && q <= r.stop {
+				uids = append(uids, u)
+				break
+			}
+		}
+	}
+	return uids, nil
+}
+
+// messages returns the messages in a sequence set argument, which contains
+// UIDs if uid is true. Messages that were expunged by another session, but are
+// still in the session view, are skipped.
+func (s *session) messages(v interface{}, uid bool) ([]seqMessage, error) {
+	uids, err := s.uids(v, uid)
+	if err != nil {
+		return nil, err
+	}
+	return s.fetchUIDs(uids)
+}
+
+// fetchUIDs returns the messages with the specified UIDs from the backend.
+func (s *session) fetchUIDs(uids []uint32) ([]seqMessage, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+	fetched, err := s.mbox.Fetch(uids)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]seqMessage, 0, len(fetched))
+	for _, msg := range fetched {
+		i := sort.Search(len(s.view), func(i int) bool { return s.view[i] >= msg.UID })
+		if i < len(s.view) && s.view[i] == msg.UID {
+			msgs = append(msgs, seqMessage{uint32(i + 1), msg})
+		}
+	}
+	return msgs, nil
+}
+
+// hasFlag returns true if flags contains flag.
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchItem is a parsed FETCH data item.
+type fetchItem struct {
+	name    string   // Name of the item in the response
+	body    bool     // Item returns message contents
+	peek    bool     // \Seen flag is not set
+	section string   // "", HEADER, TEXT, HEADER.FIELDS, or HEADER.FIELDS.NOT
+	fields  []string // Header field names
+	start   int      // Partial origin
+	count   int      // Partial length or -1
+}
+
+// fetchMacros are the items requested by the ALL and FAST macros. FULL is not
+// supported, because it includes the body structure.
+var fetchMacros = map[string][]string{
+	"ALL":  {"FLAGS", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE"},
+	"FAST": {"FLAGS", "INTERNALDATE", "RFC822.SIZE"},
+}
+
+// parseFetchItem parses a single FETCH data item.
+func parseFetchItem(s string) (*fetchItem, error) {
+	u := strings.ToUpper(s)
+	switch u {
+	case "FLAGS", "UID", "INTERNALDATE", "RFC822.SIZE", "ENVELOPE":
+		return &fetchItem{name: u}, nil
+	case "RFC822":
+		return &fetchItem{name: u, body: true, count: -1}, nil
+	case "RFC822.HEADER":
+		return &fetchItem{name: u, body: true, peek: true, section: "HEADER", count: -1}, nil
+	case "RFC822.TEXT":
+		return &fetchItem{name: u, body: true, section: "TEXT", count: -1}, nil
+	}
+	it := &fetchItem{body: true, count: -1}
+	if strings.HasPrefix(u, "BODY.PEEK[") {
+		it.peek, u = true, u[len("BODY.PEEK"):]
+	} else if strings.HasPrefix(u, "BODY[") {
+		u = u[len("BODY"):]
+	} else {
+		return nil, bad("Unsupported FETCH item " + s)
+	}
+	end := strings.IndexByte(u, ']')
+	if end < 0 {
+		return nil, bad("Invalid body section")
+	}
+	sec, partial := u[1:end], u[end+1:]
+	switch it.section = sec; {
+	case sec == "" || sec == "HEADER" || sec == "TEXT":
+	case strings.HasPrefix(sec, "HEADER.FIELDS"):
+		i := strings.Index(sec, " (")
+		if i < 0 || !strings.HasSuffix(sec, ")") {
+			return nil, bad("Invalid body section")
+		}
+		it.section, it.fields = sec[:i], strings.Fields(sec[i+2:len(sec)-1])
+		if it.section != "HEADER.FIELDS" && it.section != "HEADER.FIELDS.NOT" || len(it.fields) == 0 {
+			return nil, bad("Invalid body section")
+		}
+	default:
+		return nil, bad("Unsupported body section " + sec)
+	}
+	it.name = "BODY[" + sec + "]"
+	if partial != "" {
+		var err error
+		i := strings.IndexByte(partial, '.')
+		if i < 0 || partial[0] != '<' || !strings.HasSuffix(partial, ">") {
+			return nil, bad("Invalid partial")
+		} else if it.start, err = strconv.Atoi(partial[1:i]); err != nil || it.start < 0 {
+			return nil, bad("Invalid partial")
+		} else if it.count, err = strconv.Atoi(partial[i+1 : len(partial)-1]); err != nil || it.count <= 0 {
+			return nil, bad("Invalid partial")
+		}
+		it.name += "<" + strconv.Itoa(it.start) + ">"
+	}
+	return it, nil
+}
+
+// data returns the part of the message requested by a body item.
+func (it *fetchItem) data(msg []byte) []byte {
+	hdr, text := splitMessage(msg)
+	var b []byte
+	switch it.section {
+	case "":
+		b = msg
+	case "HEADER":
+		b = hdr
+	case "TEXT":
+		b = text
+	default:
+		b = headerFields(hdr, it.fields, it.section == "HEADER.FIELDS.NOT")
+	}
+	if it.count >= 0 {
+		if it.start >= len(b) {
+			return nil
+		} else if b = b[it.start:]; len(b) > it.count {
+			b = b[:it.count]
+		}
+	}
+	return b
+}
+
+// splitMessage returns the header, including the blank line that ends it, and
+// the text of a message.
+func splitMessage(msg []byte) (hdr, text []byte) {
+	if bytes.HasPrefix(msg, []byte("\r\n")) {
+		return msg[:2], msg[2:]
+	} else if i := bytes.Index(msg, []byte("\r\n\r\n")); i >= 0 {
+		return msg[:i+4], msg[i+4:]
+	}
+	return msg, nil
+}
+
+// headerFields returns the header fields whose names are (or, if not is true,
+// are not) in names, followed by a blank line.
+func headerFields(hdr []byte, names []string, not bool) []byte {
+	var b []byte
+	keep := false
+	for len(hdr) > 0 {
+		ln := hdr
+		if i := bytes.IndexByte(hdr, '\n'); i >= 0 {
+			ln = hdr[:i+1]
+		}
+		hdr = hdr[len(ln):]
+		if len(bytes.TrimSpace(ln)) == 0 {
+			break
+		} else if ln[0] != ' ' && ln[0] != '\t' {
+			keep = not
+			if i := bytes.IndexByte(ln, ':'); i > 0 {
+				name := string(bytes.TrimSpace(ln[:i]))
+				for _, n := range names {
+					if strings.EqualFold(name, n) {
+						keep = !not
+						break
+					}
+				}
+			}
+		}
+		if keep {
+			b = append(b, ln...)
+		}
+	}
+	return append(b, "\r\n"...)
+}
+
+// parseHeader returns the parsed message header or an empty header if the
+// message is malformed.
+func parseHeader(msg []byte) mail.Header {
+	hdr, _ := splitMessage(msg)
+	m, err := mail.ReadMessage(io.MultiReader(bytes.NewReader(hdr), strings.NewReader("\r\n\r\n")))
+	if err != nil {
+		return mail.Header{}
+	}
+	return m.Header
+}
+
+// envelope returns the ENVELOPE structure of a message.
+func envelope(msg []byte) string {
+	h := parseHeader(msg)
+	from := addressList(h, "From")
+	sender, replyTo := addressList(h, "Sender"), addressList(h, "Reply-To")
+	if sender == "NIL" {
+		sender = from
+	}
+	if replyTo == "NIL" {
+		replyTo = from
+	}
+	return "(" + strings.Join([]string{
+		nstring(h.Get("Date")),
+		nstring(h.Get("Subject")),
+		from, sender, replyTo,
+		addressList(h, "To"),
+		addressList(h, "Cc"),
+		addressList(h, "Bcc"),
+		nstring(h.Get("In-Reply-To")),
+		nstring(h.Get("Message-Id")),
+	}, " ") + ")"
+}
+
+// addressList returns the addresses in a header field for an ENVELOPE.
+func addressList(h mail.Header, key string) string {
+	addrs, err := h.AddressList(key)
+	if err != nil || len(addrs) == 0 {
+		return "NIL"
+	}
+	b := []byte{'('}
+	for _, a := range addrs {
+		mbox, host := a.Address, ""
+		if i := strings.LastIndexByte(mbox, '@'); i >= 0 {
+			mbox, host = mbox[:i], mbox[i+1:]
+		}
+		name := a.Name
+		for i := 0; i < len(name); i++ {
+			if name[i] >= 0x80 {
+				name = mime.QEncoding.Encode("utf-8", name)
+				break
+			}
+		}
+		b = append(b, fmt.Sprintf("(%s NIL %s %s)", nstring(name), nstring(mbox), nstring(host))...)
+	}
+	return string(append(b, ')'))
+}
+
+func (s *session) fetch(uid bool, args []interface{}) (string, error) {
+	if len(args) != 2 {
+		return "", errArgs
+	}
+	msgs, err := s.messages(args[0], uid)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	switch v := args[1].(type) {
+	case atom:
+		names = []string{string(v)}
+		if m, ok := fetchMacros[strings.ToUpper(string(v))]; ok {
+			names = m
+		}
+	case []interface{}:
+		for _, v := range v {
+			a, ok := v.(atom)
+			if !ok {
+				return "", errArgs
+			}
+			names = append(names, string(a))
+		}
+	}
+	if uid {
+		names = append([]string{"UID"}, names...)
+	}
+	var items []*fetchItem
+	seen := make(map[string]bool)
+	for _, name := range names {
+		it, err := parseFetchItem(name)
+		if err != nil {
+			return "", err
+		} else if !seen[it.name] {
+			items = append(items, it)
+			seen[it.name] = true
+		}
+	}
+	if len(items) == 0 {
+		return "", errArgs
+	}
+	for _, msg := range msgs {
+		setSeen := false
+		for _, it := range items {
+			if it.body && !it.peek && !s.readOnly && !hasFlag(msg.Flags, `\Seen`) {
+				setSeen = true
+			}
+		}
+		if setSeen {
+			if err := s.mbox.SetFlags([]uint32{msg.UID}, AddFlags, []string{`\Seen`}); err != nil {
+				return "", err
+			}
+			m := *msg.Message
+			m.Flags = append(m.Flags[:len(m.Flags):len(m.Flags)], `\Seen`)
+			msg.Message = &m
+		}
+		var b []string
+		for _, it := range items {
+			b = append(b, it.name+" "+it.value(msg.Message))
+		}
+		if setSeen && !seen["FLAGS"] {
+			b = append(b, "FLAGS "+flagString(msg.Flags))
+		}
+		s.printf("* %d FETCH (%s)", msg.seq, strings.Join(b, " "))
+	}
+	return "", nil
+}
+
+// value returns the value of the item for msg.
+func (it *fetchItem) value(msg *Message) string {
+	switch it.name {
+	case "FLAGS":
+		return flagString(msg.Flags)
+	case "UID":
+		return strconv.FormatUint(uint64(msg.UID), 10)
+	case "INTERNALDATE":
+		return imap.FormatDateTime(msg.Date)
+	case "RFC822.SIZE":
+		return strconv.Itoa(len(msg.Body))
+	case "ENVELOPE":
+		return envelope(msg.Body)
+	}
+	return literal(it.data(msg.Body))
+}
+
+func (s *session) store(uid bool, args []interface{}) (string, error) {
+	if len(args) < 3 {
+		return "", errArgs
+	}
+	uids, err := s.uids(args[0], uid)
+	if err != nil {
+		return "", err
+	}
+	item, _ := args[1].(atom)
+	var op FlagOp
+	name := strings.ToUpper(string(item))
+	silent := strings.HasSuffix(name, ".SILENT")
+	switch strings.TrimSuffix(name, ".SILENT") {
+	case "FLAGS":
+		op = ReplaceFlags
+	case "+FLAGS":
+		op = AddFlags
+	case "-FLAGS":
+		op = RemoveFlags
+	default:
+		return "", bad("Invalid STORE item")
+	}
+	flags, err := flagArgs(args[2:])
+	if err != nil {
+		return "", err
+	} else if s.readOnly {
+		return "", errReadOnly
+	} else if len(uids) == 0 {
+		return "", nil
+	}
+	if err = s.mbox.SetFlags(uids, op, flags); err != nil || silent {
+		return "", err
+	}
+	msgs, err := s.fetchUIDs(uids)
+	if err != nil {
+		return "", err
+	}
+	for _, msg := range msgs {
+		if uid {
+			s.printf("* %d FETCH (UID %d FLAGS %s)", msg.seq, msg.UID, flagString(msg.Flags))
+		} else {
+			s.printf("* %d FETCH (FLAGS %s)", msg.seq, flagString(msg.Flags))
+		}
+	}
+	return "", nil
+}
+
+func (s *session) copy(uid bool, args []interface{}) (string, error) {
+	if len(args) != 2 {
+		return "", errArgs
+	}
+	msgs, err := s.messages(args[0], uid)
+	if err != nil {
+		return "", err
+	}
+	name, err := mailboxArg(args[1])
+	if err != nil {
+		return "", err
+	}
+	dst, err := s.user.Mailbox(name)
+	if err == ErrNoMailbox {
+		return "", errTryCreate
+	} else if err != nil || len(msgs) == 0 {
+		return "", err
+	}
+	src, dstUIDs := make([]uint32, len(msgs)), make([]uint32, len(msgs))
+	for i, msg := range msgs {
+		src[i] = msg.UID
+		if dstUIDs[i], err = dst.Append(msg.Body, msg.Date, msg.Flags); err != nil {
+			return "", err
+		}
+	}
+	st, err := dst.Status()
+	if err != nil {
+		return "", nil
+	}
+	return fmt.Sprintf("[COPYUID %d %s %s] COPY completed", st.UIDValidity,
+		imap.NewSeqSetNums(src), imap.NewSeqSetNums(dstUIDs)), nil
+}
@@ -0,0 +1,652 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package maildir implements a server.Backend that serves messages stored on disk
+in Maildir or mbox format. It is meant for integration tests and small tools
+that need to make an existing message corpus available over IMAP.
+
+A Backend serves a single user. New opens a Maildir++ directory, in which the
+top-level Maildir is INBOX and other mailboxes are subdirectories whose names
+begin with a dot and use '.' as the hierarchy separator (".Work.Projects" is
+the mailbox "Work/Projects"). Changes made by the client are written to disk,
+and messages added or removed by other programs are picked up by the next
+command. The system flags are stored in the info part of the file names:
+
+	\Answered  R
+	\Deleted   T
+	\Draft     D
+	\Flagged   F
+	\Seen      S
+
+Other info letters (e.g. 'P' for passed) are preserved, but keywords are not
+supported. Maildir has no UIDs, so they are assigned in the order of the unique
+file names when a mailbox is first opened, and the UID validity value changes
+every time the Backend is created.
+
+NewMbox reads a single mbox file, which becomes INBOX, or a directory of mbox
+files, in which each file is a mailbox named by its relative path. Messages are
+separated by "From " lines, which also provide the internal date, and lines
+that begin with ">From " are unescaped as in the mboxrd format. Flags are taken
+from the Status and X-Status header fields. The files are read only once, and
+all changes are kept in memory.
+
+A server for a Maildir looks like this:
+
+	b, err := maildir.New("/home/joe/Maildir", "joe", "secret")
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := &server.Server{Backend: b}
+*/
+package maildir
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxk/go-imap/server"
+)
+
+// ErrInvalidName is returned when a mailbox name cannot be mapped to a Maildir
+// directory.
+var ErrInvalidName = errors.New("maildir: invalid mailbox name")
+
+// infoFlags maps Maildir info letters to IMAP system flags.
+var infoFlags = map[byte]string{
+	'D': `\Draft`,
+	'F': `\Flagged`,
+	'R': `\Answered`,
+	'S': `\Seen`,
+	'T': `\Deleted`,
+}
+
+// Backend is a server.Backend for a single user. Its methods may be called
+// concurrently.
+type Backend struct {
+	username string
+	password string
+	dir      string // Maildir++ root, or "" for mbox
+	validity uint32 // Last UID validity value
+
+	mu     sync.Mutex
+	mboxes map[string]*mailbox // Open (Maildir) or all (mbox) mailboxes
+}
+
+// user implements server.User.
+type user Backend
+
+// mailbox is a list of messages in UID order. It implements server.Mailbox.
+type mailbox struct {
+	b           *Backend
+	dir         string // Maildir directory, or "" for mbox
+	uidValidity uint32
+	uidNext     uint32
+	msgs        []*message
+}
+
+// message is a single message in a mailbox. Maildir messages are read from
+// disk when fetched.
+type message struct {
+	uid   uint32
+	key   string // Maildir unique name
+	path  string // Maildir file path
+	flags map[string]bool
+	date  time.Time
+	body  []byte // mbox message
+}
+
+// New returns a Backend that serves the Maildir++ directory dir to the user
+// with the specified credentials.
+func New(dir, username, password string) (*Backend, error) {
+	if _, err := os.Stat(filepath.Join(dir, "cur")); err != nil {
+		return nil, err
+	}
+	return newBackend(dir, username, password), nil
+}
+
+// NewMbox returns a Backend that serves the messages in an mbox file or a
+// directory of mbox files to the user with the specified credentials.
+func NewMbox(path, username, password string) (*Backend, error) {
+	b := newBackend("", username, password)
+	err := filepath.Walk(path, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		} else if p != path && strings.HasPrefix(fi.Name(), ".") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if !fi.Mode().IsRegular() {
+			return nil
+		}
+		name := "INBOX"
+		if p != path {
+			rel, err := filepath.Rel(path, p)
+			if err != nil {
+				return err
+			}
+			name = normName(filepath.ToSlash(rel))
+		}
+		m := b.newMailbox("")
+		b.mboxes[name] = m
+		return m.load(p, fi.ModTime())
+	})
+	if err != nil {
+		return nil, err
+	}
+	if b.mboxes["INBOX"] == nil {
+		b.mboxes["INBOX"] = b.newMailbox("")
+	}
+	return b, nil
+}
+
+// newBackend returns a new Backend without any mailboxes.
+func newBackend(dir, username, password string) *Backend {
+	return &Backend{
+		username: username,
+		password: password,
+		dir:      dir,
+		validity: uint32(time.Now().Unix()),
+		mboxes:   make(map[string]*mailbox),
+	}
+}
+
+// Login implements server.Backend.
+func (b *Backend) Login(username, password string) (server.User, error) {
+	if username != b.username || password != b.password {
+		return nil, server.ErrInvalidCredentials
+	}
+	return (*user)(b), nil
+}
+
+// newMailbox returns a new mailbox with the next UID validity value. b.mu must
+// be held or the Backend must not be in use yet.
+func (b *Backend) newMailbox(dir string) *mailbox {
+	b.validity++
+	return &mailbox{b: b, dir: dir, uidValidity: b.validity, uidNext: 1}
+}
+
+// path returns the Maildir directory of a mailbox.
+func (b *Backend) path(name string) (string, error) {
+	if name == "INBOX" {
+		return b.dir, nil
+	} else if name == "" || strings.ContainsAny(name, `.\`) ||
+		strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") {
+		return "", ErrInvalidName
+	}
+	return filepath.Join(b.dir, "."+strings.Replace(name, "/", ".", -1)), nil
+}
+
+// normName converts INBOX to upper case.
+func normName(name string) string {
+	if strings.EqualFold(name, "INBOX") {
+		return "INBOX"
+	}
+	return name
+}
+
+func (u *user) Mailboxes() ([]string, error) {
+	b := (*Backend)(u)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var names []string
+	if b.dir == "" {
+		for name := range b.mboxes {
+			names = append(names, name)
+		}
+		return names, nil
+	}
+	fis, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	names = append(names, "INBOX")
+	for _, fi := range fis {
+		name := fi.Name()
+		if len(name) < 2 || name[0] != '.' || name == ".." || !fi.IsDir() {
+			continue
+		} else if _, err := os.Stat(filepath.Join(b.dir, name, "cur")); err == nil {
+			names = append(names, strings.Replace(name[1:], ".", "/", -1))
+		}
+	}
+	return names, nil
+}
+
+func (u *user) Mailbox(name string) (server.Mailbox, error) {
+	b := (*Backend)(u)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dir == "" {
+		if m := b.mboxes[name]; m != nil {
+			return m, nil
+		}
+		return nil, server.ErrNoMailbox
+	}
+	dir, err := b.path(name)
+	if err != nil {
+		return nil, server.ErrNoMailbox
+	} else if _, err = os.Stat(filepath.Join(dir, "cur")); err != nil {
+		delete(b.mboxes, name)
+		return nil, server.ErrNoMailbox
+	}
+	m := b.mboxes[name]
+	if m == nil {
+		m = b.newMailbox(dir)
+		b.mboxes[name] = m
+	}
+	return m, nil
+}
+
+func (u *user) CreateMailbox(name string) error {
+	b := (*Backend)(u)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dir == "" {
+		if b.mboxes[name] != nil {
+			return server.ErrMailboxExists
+		}
+		b.mboxes[name] = b.newMailbox("")
+		return nil
+	}
+	dir, err := b.path(name)
+	if err != nil {
+		return err
+	} else if _, err = os.Stat(dir); err == nil {
+		return server.ErrMailboxExists
+	}
+	for _, sub := range []string{"cur", "new", "tmp"} {
+		if err = os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return err
+		}
+	}
+	delete(b.mboxes, name)
+	return nil
+}
+
+func (u *user) DeleteMailbox(name string) error {
+	b := (*Backend)(u)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dir == "" {
+		if b.mboxes[name] == nil {
+			return server.ErrNoMailbox
+		}
+		delete(b.mboxes, name)
+		return nil
+	}
+	dir, err := b.path(name)
+	if err != nil || name == "INBOX" {
+		return server.ErrNoMailbox
+	} else if _, err = os.Stat(dir); err != nil {
+		return server.ErrNoMailbox
+	}
+	delete(b.mboxes, name)
+	return os.RemoveAll(dir)
+}
+
+func (m *mailbox) Status() (*server.MailboxStatus, error) {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	if err := m.scan(); err != nil {
+		return nil, err
+	}
+	st := &server.MailboxStatus{
+		Messages:    uint32(len(m.msgs)),
+		UIDNext:     m.uidNext,
+		UIDValidity: m.uidValidity,
+	}
+	for i, msg := range m.msgs {
+		if !msg.flags[`\Seen`] {
+			if st.Unseen++; st.FirstUnseen == 0 {
+				st.FirstUnseen = uint32(i + 1)
+			}
+		}
+	}
+	return st, nil
+}
+
+func (m *mailbox) UIDs() ([]uint32, error) {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	if err := m.scan(); err != nil {
+		return nil, err
+	}
+	uids := make([]uint32, len(m.msgs))
+	for i, msg := range m.msgs {
+		uids[i] = msg.uid
+	}
+	return uids, nil
+}
+
+func (m *mailbox) Fetch(uids []uint32) ([]*server.Message, error) {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	msgs := make([]*server.Message, 0, len(uids))
+	for _, uid := range uids {
+		msg := m.find(uid)
+		if msg == nil {
+			continue
+		}
+		body := msg.body
+		if m.dir != "" {
+			var err error
+			if body, err = ioutil.ReadFile(msg.path); os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		msgs = append(msgs, &server.Message{UID: msg.uid, Flags: flagList(msg.flags), Date: msg.date, Body: body})
+	}
+	return msgs, nil
+}
+
+func (m *mailbox) Append(body []byte, date time.Time, flags []string) (uint32, error) {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	msg := &message{uid: m.uidNext, flags: make(map[string]bool), date: date}
+	for _, f := range flags {
+		msg.flags[f] = true
+	}
+	if m.dir == "" {
+		msg.body = append([]byte(nil), body...)
+	} else {
+		msg.key = uniqueName()
+		tmp := filepath.Join(m.dir, "tmp", msg.key)
+		if err := ioutil.WriteFile(tmp, body, 0600); err != nil {
+			return 0, err
+		}
+		msg.path = filepath.Join(m.dir, "cur", msg.key+":2,"+infoString("", msg.flags))
+		os.Chtimes(tmp, date, date)
+		if err := os.Rename(tmp, msg.path); err != nil {
+			os.Remove(tmp)
+			return 0, err
+		}
+		msg.flags = infoSet(msg.path)
+	}
+	m.uidNext++
+	m.msgs = append(m.msgs, msg)
+	return msg.uid, nil
+}
+
+func (m *mailbox) SetFlags(uids []uint32, op server.FlagOp, flags []string) error {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	for _, uid := range uids {
+		msg := m.find(uid)
+		if msg == nil {
+			continue
+		}
+		set := make(map[string]bool, len(msg.flags)+len(flags))
+		if op != server.ReplaceFlags {
+			for f := range msg.flags {
+				set[f] = true
+			}
+		}
+		for _, f := range flags {
+			if op == server.RemoveFlags {
+				delete(set, f)
+			} else {
+				set[f] = true
+			}
+		}
+		if m.dir != "" {
+			name := filepath.Base(msg.path)
+			info := ""
+			if i := strings.Index(name, ":2,"); i >= 0 {
+				info = name[i+3:]
+			}
+			path := filepath.Join(m.dir, "cur", msg.key+":2,"+infoString(info, set))
+			if path != msg.path {
+				if err := os.Rename(msg.path, path); err != nil {
+					return err
+				}
+				msg.path = path
+			}
+			set = infoSet(path)
+		}
+		msg.flags = set
+	}
+	return nil
+}
+
+func (m *mailbox) Expunge(uids []uint32) error {
+	m.b.mu.Lock()
+	defer m.b.mu.Unlock()
+	var set map[uint32]bool
+	if uids != nil {
+		set = make(map[uint32]bool, len(uids))
+		for _, uid := range uids {
+			set[uid] = true
+		}
+	}
+	var msgs []*message
+	for _, msg := range m.msgs {
+		if !msg.flags[`\Deleted`] || (set != nil && !set[msg.uid]) {
+			msgs = append(msgs, msg)
+		} else if m.dir != "" {
+			if err := os.Remove(msg.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	m.msgs = msgs
+	return nil
+}
+
+// find returns the message with the specified UID or nil.
+func (m *mailbox) find(uid uint32) *message {
+	i := sort.Search(len(m.msgs), func(i int) bool { return m.msgs[i].uid >= uid })
+	if i < len(m.msgs) && m.msgs[i].uid == uid {
+		return m.msgs[i]
+	}
+	return nil
+}
+
+// scan updates a Maildir mailbox with the contents of its cur and new
+// directories. New messages are assigned UIDs in the order of their unique
+// names. m.b.mu must be held.
+func (m *mailbox) scan() error {
+	if m.dir == "" {
+		return nil
+	}
+	files := make(map[string]os.FileInfo)
+	paths := make(map[string]string)
+	for _, sub := range []string{"cur", "new"} {
+		fis, err := ioutil.ReadDir(filepath.Join(m.dir, sub))
+		if err != nil {
+			return err
+		}
+		for _, fi := range fis {
+			name := fi.Name()
+			if strings.HasPrefix(name, ".") || !fi.Mode().IsRegular() {
+				continue
+			}
+			key := name
+			if i := strings.IndexByte(name, ':'); i >= 0 {
+				key = name[:i]
+			}
+			files[key], paths[key] = fi, filepath.Join(m.dir, sub, name)
+		}
+	}
+	var msgs []*message
+	for _, msg := range m.msgs {
+		if path, ok := paths[msg.key]; ok {
+			if path != msg.path {
+				msg.path, msg.flags = path, infoSet(path)
+			}
+			msgs = append(msgs, msg)
+			delete(files, msg.key)
+		}
+	}
+	keys := make([]string, 0, len(files))
+	for key := range files {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := paths[key]
+		msgs = append(msgs, &message{uid: m.uidNext, key: key, path: path, flags: infoSet(path), date: files[key].ModTime()})
+		m.uidNext++
+	}
+	m.msgs = msgs
+	return nil
+}
+
+// infoSet returns the flags encoded in the info part of a Maildir file name.
+func infoSet(path string) map[string]bool {
+	flags := make(map[string]bool)
+	name := filepath.Base(path)
+	if i := strings.Index(name, ":2,"); i >= 0 {
+		for _, c := range []byte(name[i+3:]) {
+			if f, ok := infoFlags[c]; ok {
+				flags[f] = true
+			}
+		}
+	}
+	return flags
+}
+
+// infoString returns the info letters for flags, keeping the letters in info
+// that do not represent IMAP flags. The letters are sorted.
+func infoString(info string, flags map[string]bool) string {
+	var set [128]bool
+	for _, c := range []byte(info) {
+		if _, ok := infoFlags[c]; !ok && c < 128 {
+			set[c] = true
+		}
+	}
+	for c, f := range infoFlags {
+		set[c] = flags[f]
+	}
+	var b []byte
+	for c := range set {
+		if set[c] {
+			b = append(b, byte(c))
+		}
+	}
+	return string(b)
+}
+
+// uniqueCount distinguishes the files created in the same microsecond.
+var (
+	uniqueMu    sync.Mutex
+	uniqueCount uint32
+)
+
+// uniqueName returns a new Maildir unique name. It is called with a Backend
+// lock held, but different Backends may use the same directory, so the process
+// ID and a counter are also included.
+func uniqueName() string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "localhost"
+	}
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+	now := time.Now()
+	uniqueMu.Lock()
+	uniqueCount++
+	n := uniqueCount
+	uniqueMu.Unlock()
+	return fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), n, host)
+}
+
+// flagList returns the sorted flags.
+func flagList(flags map[string]bool) []string {
+	list := make([]string, 0, len(flags))
+	for f := range flags {
+		list = append(list, f)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// load reads the messages in an mbox file. mtime is used as the internal date
+// of messages without a valid "From " line.
+func (m *mailbox) load(path string, mtime time.Time) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var msg *message
+	var body bytes.Buffer
+	flush := func() {
+		if msg != nil {
+			b := bytes.TrimSuffix(body.Bytes(), []byte("\r\n"))
+			msg.body = append([]byte(nil), b...)
+			msg.flags = statusFlags(msg.body)
+			m.msgs = append(m.msgs, msg)
+			m.uidNext++
+		}
+		body.Reset()
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, len(data)+1)
+	for sc.Scan() {
+		ln := strings.TrimSuffix(sc.Text(), "\r")
+		if strings.HasPrefix(ln, "From ") {
+			flush()
+			msg = &message{uid: m.uidNext, date: fromDate(ln, mtime)}
+			continue
+		} else if msg == nil {
+			continue
+		}
+		if s := strings.TrimLeft(ln, ">"); len(s) < len(ln) && strings.HasPrefix(s, "From ") {
+			ln = ln[1:]
+		}
+		body.WriteString(ln)
+		body.WriteString("\r\n")
+	}
+	flush()
+	return sc.Err()
+}
+
+// fromDate returns the date in an mbox "From " line.
+func fromDate(ln string, def time.Time) time.Time {
+	if f := strings.Fields(ln); len(f) >= 7 {
+		if t, err := time.Parse(time.ANSIC, strings.Join(f[2:7], " ")); err == nil {
+			return t
+		}
+	}
+	return def
+}
+
+// statusFlags returns the flags in the Status and X-Status header fields of an
+// mbox message.
+func statusFlags(msg []byte) map[string]bool {
+	flags := make(map[string]bool)
+	for _, ln := range strings.Split(string(msg), "\r\n") {
+		if ln == "" {
+			break
+		}
+		i := strings.IndexByte(ln, ':')
+		if i < 0 {
+			continue
+		}
+		name, v := strings.ToLower(ln[:i]), ln[i+1:]
+		switch name {
+		case "status":
+			if strings.ContainsRune(v, 'R') {
+				flags[`\Seen`] = true
+			}
+		case "x-status":
+			for c, f := range map[rune]string{'A': `\Answered`, 'F': `\Flagged`, 'T': `\Draft`, 'D': `\Deleted`} {
+				if strings.ContainsRune(v, c) {
+					flags[f] = true
+				}
+			}
+		}
+	}
+	return flags
+}
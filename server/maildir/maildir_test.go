@@ -0,0 +1,207 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package maildir_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+	"github.com/mxk/go-imap/server"
+	"github.com/mxk/go-imap/server/maildir"
+)
+
+const testMsg = "From: Joe <joe@example.com>\r\n" +
+	"Subject: Lunch\r\n" +
+	"\r\n" +
+	"Pizza at noon?\r\n"
+
+// dial returns a client that is logged in to a server for b.
+func dial(t *testing.T, b server.Backend) *imap.Client {
+	c, sc := net.Pipe()
+	go (&server.Server{Backend: b}).ServeConn(sc)
+	cl, err := imap.NewClient(c, "localhost", 0)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error; %v", err)
+	}
+	if _, err = imap.Wait(cl.Login("joe", "secret")); err != nil {
+		t.Fatalf("Login() unexpected error; %v", err)
+	}
+	return cl
+}
+
+// flags returns the flags of all messages in the selected mailbox.
+func flags(t *testing.T, c *imap.Client) (all []imap.FlagSet) {
+	set, _ := imap.NewSeqSet("1:*")
+	cmd, err := imap.Wait(c.Fetch(set, "FLAGS"))
+	if err != nil {
+		t.Fatalf("Fetch() unexpected error; %v", err)
+	}
+	for _, rsp := range cmd.Data {
+		all = append(all, rsp.MessageInfo().Flags)
+	}
+	return
+}
+
+// files returns the sorted names of the files in dir.
+func files(t *testing.T, dir string) []string {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestMaildir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maildir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, sub := range []string{"cur", "new", "tmp", ".Work.Projects/cur", ".Work.Projects/new", ".Work.Projects/tmp"} {
+		if err = os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, sub := range map[string]string{"1.A.host": "new", "2.B.host:2,PS": "cur"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, sub, name), []byte(testMsg), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := maildir.New(dir, "joe", "secret")
+	if err != nil {
+		t.Fatalf("New() unexpected error; %v", err)
+	}
+	c := dial(t, b)
+
+	cmd, err := imap.Wait(c.List("", "*"))
+	if err != nil {
+		t.Fatalf("List() unexpected error; %v", err)
+	}
+	var names []string
+	for _, rsp := range cmd.Data {
+		names = append(names, rsp.MailboxInfo().Name)
+	}
+	if want := []string{"INBOX", "Work/Projects"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("List() expected %q; got %q", want, names)
+	}
+
+	if _, err = imap.Wait(c.Select("INBOX", false)); err != nil {
+		t.Fatalf("Select() unexpected error; %v", err)
+	} else if c.Mailbox.Messages != 2 {
+		t.Errorf("c.Mailbox.Messages expected 2; got %d", c.Mailbox.Messages)
+	}
+	if f := flags(t, c); len(f) != 2 || len(f[0]) != 0 || !f[1][`\Seen`] {
+		t.Errorf("Fetch(FLAGS) unexpected flags %v", f)
+	}
+
+	// Flag changes rename the files
+	set, _ := imap.NewSeqSet("1:2")
+	if _, err = imap.Wait(c.Store(set, "+FLAGS", imap.NewFlagSet(`\Flagged`, "$Label"))); err != nil {
+		t.Fatalf("Store() unexpected error; %v", err)
+	}
+	if want := []string{"1.A.host:2,F", "2.B.host:2,FPS"}; !reflect.DeepEqual(files(t, filepath.Join(dir, "cur")), want) {
+		t.Errorf("cur expected %q; got %q", want, files(t, filepath.Join(dir, "cur")))
+	}
+	if len(files(t, filepath.Join(dir, "new"))) != 0 {
+		t.Errorf("new is not empty")
+	}
+
+	// APPEND and EXPUNGE
+	date := time.Date(2013, 5, 1, 12, 0, 0, 0, time.UTC)
+	flagSet := imap.NewFlagSet(`\Seen`, `\Draft`)
+	if _, err = imap.Wait(c.Append("Work/Projects", flagSet, &date, imap.NewLiteral([]byte(testMsg)))); err != nil {
+		t.Fatalf("Append() unexpected error; %v", err)
+	}
+	cur := files(t, filepath.Join(dir, ".Work.Projects", "cur"))
+	if len(cur) != 1 || !strings.HasSuffix(cur[0], ":2,DS") {
+		t.Errorf("Append() unexpected files %q", cur)
+	}
+	set, _ = imap.NewSeqSet("1")
+	if _, err = imap.Wait(c.Store(set, "+FLAGS.SILENT", imap.NewFlagSet(`\Deleted`))); err != nil {
+		t.Fatalf("Store() unexpected error; %v", err)
+	}
+	if _, err = imap.Wait(c.Expunge(nil)); err != nil {
+		t.Fatalf("Expunge() unexpected error; %v", err)
+	}
+	if want := []string{"2.B.host:2,FPS"}; !reflect.DeepEqual(files(t, filepath.Join(dir, "cur")), want) {
+		t.Errorf("cur after EXPUNGE expected %q; got %q", want, files(t, filepath.Join(dir, "cur")))
+	}
+
+	// Messages delivered by other programs
+	if err = ioutil.WriteFile(filepath.Join(dir, "new", "3.C.host"), []byte(testMsg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = imap.Wait(c.Noop()); err != nil {
+		t.Fatalf("Noop() unexpected error; %v", err)
+	} else if c.Mailbox.Messages != 2 {
+		t.Errorf("c.Mailbox.Messages after delivery expected 2; got %d", c.Mailbox.Messages)
+	}
+	if _, err = imap.Wait(c.Create("Archive")); err != nil {
+		t.Fatalf("Create() unexpected error; %v", err)
+	} else if _, err = os.Stat(filepath.Join(dir, ".Archive", "tmp")); err != nil {
+		t.Errorf("Create() did not create the Maildir; %v", err)
+	}
+	c.Logout(time.Second)
+}
+
+func TestMbox(t *testing.T) {
+	f, err := ioutil.TempFile("", "mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("From joe@example.com Wed May  1 12:00:00 2013\n" +
+		"Subject: One\n" +
+		"Status: RO\n" +
+		"X-Status: F\n" +
+		"\n" +
+		">From the start\n" +
+		"\n" +
+		"From ann@example.org Thu May  2 08:30:00 2013\n" +
+		"Subject: Two\n" +
+		"\n" +
+		"Second\n")
+	f.Close()
+
+	b, err := maildir.NewMbox(f.Name(), "joe", "secret")
+	if err != nil {
+		t.Fatalf("NewMbox() unexpected error; %v", err)
+	}
+	c := dial(t, b)
+	if _, err = imap.Wait(c.Select("INBOX", true)); err != nil {
+		t.Fatalf("Select() unexpected error; %v", err)
+	} else if c.Mailbox.Messages != 2 {
+		t.Errorf("c.Mailbox.Messages expected 2; got %d", c.Mailbox.Messages)
+	}
+	if f := flags(t, c); len(f) != 2 || !f[0][`\Seen`] || !f[0][`\Flagged`] || len(f[1]) != 0 {
+		t.Errorf("Fetch(FLAGS) unexpected flags %v", f)
+	}
+	set, _ := imap.NewSeqSet("1:2")
+	cmd, err := imap.Wait(c.Fetch(set, "INTERNALDATE", "BODY.PEEK[TEXT]"))
+	if err != nil || len(cmd.Data) != 2 {
+		t.Fatalf("Fetch() unexpected result %v, %v", cmd, err)
+	}
+	mi := cmd.Data[0].MessageInfo()
+	if want := time.Date(2013, 5, 1, 12, 0, 0, 0, time.UTC); !mi.InternalDate.Equal(want) {
+		t.Errorf("INTERNALDATE expected %v; got %v", want, mi.InternalDate)
+	}
+	if text := string(imap.AsBytes(mi.Attrs["BODY[TEXT]"])); text != "From the start\r\n" {
+		t.Errorf("BODY[TEXT] expected %q; got %q", "From the start\r\n", text)
+	}
+	c.Logout(time.Second)
+}
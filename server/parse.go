@@ -0,0 +1,247 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// Command size limits. The literal limits apply to the total size of all
+// literals in one command, so that a client cannot allocate more memory by
+// sending several literals.
+const (
+	maxLine        = 64 << 10 // Longest command, excluding literal data
+	maxLiteral     = 64 << 20 // Literal budget of an authenticated client
+	maxAuthLiteral = 64 << 10 // Literal budget before LOGIN
+)
+
+// Parser errors. After errSyntax, the parser is ready to read the next command.
+// errLine and errLiteral mean that the connection cannot be used any further.
+var (
+	errSyntax  = errors.New("syntax error")
+	errLine    = errors.New("command line too long")
+	errLiteral = errors.New("invalid literal")
+)
+
+// atom is a command argument that was sent without quotes. Quoted strings and
+// literals are represented by string, and parenthesized lists by []interface{}.
+type atom string
+
+// parser reads commands from the client.
+type parser struct {
+	r     *bufio.Reader
+	cont  func() // Called before reading a synchronizing literal
+	limit int    // Literal budget of each command
+
+	n      int // Bytes of the current command read so far
+	budget int // Remaining literal budget of the current command
+}
+
+// readCommand reads the next command and returns its tag and arguments. If the
+// command is malformed, the rest of the line is discarded and errSyntax is
+// returned along with the tag, if one was read. Other errors are returned from
+// the connection.
+func (p *parser) readCommand() (tag string, args []interface{}, err error) {
+	p.n, p.budget = 0, p.limit
+	if tag, err = p.readAtom(); err != nil {
+		return
+	} else if tag == "" {
+		err = errSyntax
+	} else if args, err = p.readList(0); err == nil && len(args) == 0 {
+		err = errSyntax
+	}
+	if err == errSyntax {
+		if rerr := p.skipLine(); rerr != nil {
+			err = rerr
+		}
+	}
+	return
+}
+
+// readByte reads the next byte of the command, returning errLine if the command
+// is longer than maxLine.
+func (p *parser) readByte() (byte, error) {
+	if p.n++; p.n > maxLine {
+		return 0, errLine
+	}
+	return p.r.ReadByte()
+}
+
+// unreadByte returns the last byte to the reader.
+func (p *parser) unreadByte() {
+	p.n--
+	p.r.UnreadByte()
+}
+
+// skipLine discards the rest of the current line.
+func (p *parser) skipLine() error {
+	for {
+		if c, err := p.readByte(); err != nil || c == '\n' {
+			return err
+		}
+	}
+}
+
+// readList reads space-separated arguments until CRLF or, if depth is greater
+// than 0, until the closing parenthesis of a list. Lists may be nested up to
+// imap.MaxListDepth levels.
+func (p *parser) readList(depth int) (args []interface{}, err error) {
+	nested := depth > 0
+	args = []interface{}{}
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			return nil, err
+		}
+		switch c {
+		case ' ':
+			continue
+		case '\r':
+			if c, err = p.readByte(); err != nil {
+				return nil, err
+			} else if c != '\n' {
+				return nil, errSyntax
+			}
+			p.unreadByte()
+			if nested {
+				return nil, errSyntax
+			}
+			p.readByte()
+			return args, nil
+		case '\n':
+			p.unreadByte()
+			return nil, errSyntax
+		case ')':
+			if !nested {
+				return nil, errSyntax
+			}
+			return args, nil
+		case '(':
+			if depth >= imap.MaxListDepth {
+				return nil, errSyntax
+			}
+			list, err := p.readList(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, list)
+		case '"':
+			s, err := p.readQuoted()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, s)
+		case '{':
+			s, err := p.readLiteral()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, s)
+		default:
+			p.unreadByte()
+			a, err := p.readAtom()
+			if err != nil {
+				return nil, err
+			} else if a == "" {
+				return nil, errSyntax
+			}
+			args = append(args, atom(a))
+		}
+	}
+}
+
+// readAtom reads an atom, which ends at a space, CRLF, or parenthesis.
+// Spaces and parentheses within brackets are part of the atom, as in
+// BODY[HEADER.FIELDS (FROM TO)].
+func (p *parser) readAtom() (string, error) {
+	var b []byte
+	brackets := 0
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case c == '[':
+			brackets++
+		case c == ']' && brackets > 0:
+			brackets--
+		case c == '\r' || c == '\n':
+			p.unreadByte()
+			if brackets > 0 {
+				return "", errSyntax
+			}
+			return string(b), nil
+		case brackets > 0:
+		case c == ' ' || c == '(' || c == ')':
+			p.unreadByte()
+			return string(b), nil
+		case c < ' ' || c == '"' || c == '{' || c == 0x7f:
+			p.unreadByte()
+			return "", errSyntax
+		}
+		b = append(b, c)
+	}
+}
+
+// readQuoted reads the rest of a quoted string after the opening quote.
+func (p *parser) readQuoted() (string, error) {
+	var b []byte
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			return "", err
+		}
+		switch c {
+		case '"':
+			return string(b), nil
+		case '\\':
+			if c, err = p.readByte(); err != nil {
+				return "", err
+			} else if c != '\\' && c != '"' {
+				return "", errSyntax
+			}
+		case '\r', '\n':
+			p.unreadByte()
+			return "", errSyntax
+		}
+		b = append(b, c)
+	}
+}
+
+// readLiteral reads the rest of a literal after the opening brace. The client
+// is asked to continue unless the literal is non-synchronizing (LITERAL+). The
+// literal size is deducted from the budget of the current command.
+func (p *parser) readLiteral() (string, error) {
+	var spec []byte
+	for {
+		c, err := p.readByte()
+		if err != nil {
+			return "", err
+		} else if c == '\n' {
+			break
+		}
+		spec = append(spec, c)
+	}
+	size := strings.TrimSuffix(string(spec), "}\r")
+	sync := !strings.HasSuffix(size, "+")
+	n, err := strconv.ParseUint(strings.TrimSuffix(size, "+"), 10, 32)
+	if err != nil || n > uint64(p.budget) {
+		return "", errLiteral
+	} else if p.budget -= int(n); sync {
+		p.cont()
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(p.r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
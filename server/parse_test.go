@@ -0,0 +1,83 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+func newParser(in string, limit int) *parser {
+	return &parser{r: bufio.NewReader(strings.NewReader(in)), cont: func() {}, limit: limit}
+}
+
+func TestParserLimits(t *testing.T) {
+	deep := func(n int) string {
+		return strings.Repeat("(", n) + strings.Repeat(")", n)
+	}
+	tests := []struct {
+		in    string
+		limit int
+		err   error
+	}{
+		{"A1 X " + deep(imap.MaxListDepth) + "\r\n", 0, nil},
+		{"A1 X " + deep(imap.MaxListDepth+1) + "\r\n", 0, errSyntax},
+		{"A1 X " + strings.Repeat("a", maxLine-7) + "\r\n", 0, nil},
+		{"A1 X " + strings.Repeat("a", maxLine) + "\r\n", 0, errLine},
+		{"A1 X {6+}\r\nabcdef {4+}\r\nabcd\r\n", 10, nil},
+		{"A1 X {6+}\r\nabcdef {5+}\r\nabcde\r\n", 10, errLiteral},
+		{"A1 X {11}\r\nhello world\r\n", 10, errLiteral},
+	}
+	for _, test := range tests {
+		p := newParser(test.in+"A2 NOOP\r\n", test.limit)
+		if _, _, err := p.readCommand(); err != test.err {
+			t.Errorf("readCommand(%.20q) expected %v; got %v", test.in, test.err, err)
+		} else if err == errSyntax || err == nil {
+			// The budget is reset and the next command is readable
+			if tag, args, err := p.readCommand(); tag != "A2" || len(args) != 1 || err != nil {
+				t.Errorf("readCommand(%.20q) next command %q %v (%v)", test.in, tag, args, err)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name, pattern string
+		want          bool
+	}{
+		{"INBOX", "INBOX", true},
+		{"INBOX", "*", true},
+		{"INBOX", "%", true},
+		{"a/b", "%", false},
+		{"a/b", "*", true},
+		{"a/b", "a/%", true},
+		{"a/b/c", "a/%", false},
+		{"a/b/c", "a/*", true},
+		{"a/b/c", "%/%/c", true},
+		{"a/b/c", "a*c", true},
+		{"a/b/c", "a%c", false},
+		{"abc", "a%%c", true},
+		{"abc", "a*b*c*", true},
+		{"abc", "abcd", false},
+		{"", "*", true},
+		{"", "", true},
+		{"a", "", false},
+	}
+	for _, test := range tests {
+		if got := match(test.name, test.pattern); got != test.want {
+			t.Errorf("match(%q, %q) expected %v", test.name, test.pattern, test.want)
+		}
+	}
+
+	// Patterns with many wildcards do not take exponential time
+	name := strings.Repeat("a", 1000)
+	if match(name, strings.Repeat("*a", 100)+"%b") {
+		t.Errorf("match() expected false for a long pattern")
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// searchFunc returns true if a message matches a search key.
+type searchFunc func(msg seqMessage) bool
+
+// searchFlags maps flag search keys to the flag and whether it must be set.
+var searchFlags = map[string]struct {
+	flag string
+	set  bool
+}{
+	"ANSWERED":   {`\Answered`, true},
+	"DELETED":    {`\Deleted`, true},
+	"DRAFT":      {`\Draft`, true},
+	"FLAGGED":    {`\Flagged`, true},
+	"SEEN":       {`\Seen`, true},
+	"UNANSWERED": {`\Answered`, false},
+	"UNDELETED":  {`\Deleted`, false},
+	"UNDRAFT":    {`\Draft`, false},
+	"UNFLAGGED":  {`\Flagged`, false},
+	"UNSEEN":     {`\Seen`, false},
+}
+
+func (s *session) search(uid bool, args []interface{}) (string, error) {
+	if len(args) >= 2 {
+		if a, ok := args[0].(atom); ok && strings.EqualFold(string(a), "CHARSET") {
+			if cs, _ := astring(args[1]); !strings.EqualFold(cs, "US-ASCII") && !strings.EqualFold(cs, "UTF-8") {
+				return "", no("[BADCHARSET (US-ASCII UTF-8)] Unsupported charset")
+			}
+			args = args[2:]
+		}
+	}
+	if len(args) == 0 {
+		return "", errArgs
+	}
+	f, err := s.searchAll(args)
+	if err != nil {
+		return "", err
+	}
+	msgs, err := s.fetchUIDs(s.view)
+	if err != nil {
+		return "", err
+	}
+	b := []byte("* SEARCH")
+	for _, msg := range msgs {
+		if f(msg) {
+			n := msg.seq
+			if uid {
+				n = msg.UID
+			}
+			b = strconv.AppendUint(append(b, ' '), uint64(n), 10)
+		}
+	}
+	s.printf("%s", b)
+	return "", nil
+}
+
+// searchAll returns a function that matches all keys in args.
+func (s *session) searchAll(args []interface{}) (searchFunc, error) {
+	var fs []searchFunc
+	for len(args) > 0 {
+		f, rest, err := s.searchKey(args)
+		if err != nil {
+			return nil, err
+		}
+		fs, args = append(fs, f), rest
+	}
+	return func(msg seqMessage) bool {
+		for _, f := range fs {
+			if !f(msg) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// searchKey parses the first search key in args and returns the remaining
+// arguments.
+func (s *session) searchKey(args []interface{}) (f searchFunc, rest []interface{}, err error) {
+	if list, ok := args[0].([]interface{}); ok {
+		f, err = s.searchAll(list)
+		return f, args[1:], err
+	}
+	a, ok := args[0].(atom)
+	if !ok {
+		return nil, nil, bad("Invalid search key")
+	}
+	key, args := strings.ToUpper(string(a)), args[1:]
+
+	// arg returns the next argument of the key
+	arg := func() (string, bool) {
+		if len(args) == 0 {
+			return "", false
+		}
+		v, ok := astring(args[0])
+		args = args[1:]
+		return v, ok
+	}
+	if sf, ok := searchFlags[key]; ok {
+		return func(msg seqMessage) bool { return hasFlag(msg.Flags, sf.flag) == sf.set }, args, nil
+	}
+	switch key {
+	case "ALL", "OLD":
+		f = func(seqMessage) bool { return true }
+	case "NEW", "RECENT":
+		f = func(seqMessage) bool { return false }
+	case "NOT":
+		if len(args) == 0 {
+			return nil, nil, errArgs
+		}
+		var g searchFunc
+		if g, args, err = s.searchKey(args); err != nil {
+			return
+		}
+		f = func(msg seqMessage) bool { return !g(msg) }
+	case "OR":
+		var g, h searchFunc
+		if len(args) == 0 {
+			return nil, nil, errArgs
+		} else if g, args, err = s.searchKey(args); err != nil {
+			return
+		} else if len(args) == 0 {
+			return nil, nil, errArgs
+		} else if h, args, err = s.searchKey(args); err != nil {
+			return
+		}
+		f = func(msg seqMessage) bool { return g(msg) || h(msg) }
+	case "KEYWORD", "UNKEYWORD":
+		kw, ok := arg()
+		if !ok {
+			return nil, nil, errArgs
+		}
+		set := key == "KEYWORD"
+		f = func(msg seqMessage) bool { return hasFlag(msg.Flags, kw) == set }
+	case "BCC", "CC", "FROM", "SUBJECT", "TO":
+		v, ok := arg()
+		if !ok {
+			return nil, nil, errArgs
+		}
+		f = headerSearch(key, v)
+	case "HEADER":
+		name, ok1 := arg()
+		v, ok2 := arg()
+		if !ok1 || !ok2 {
+			return nil, nil, errArgs
+		}
+		f = headerSearch(name, v)
+	case "BODY", "TEXT":
+		v, ok := arg()
+		if !ok {
+			return nil, nil, errArgs
+		}
+		v = strings.ToLower(v)
+		f = func(msg seqMessage) bool {
+			b := msg.Body
+			if key == "BODY" {
+				_, b = splitMessage(b)
+			}
+			return strings.Contains(strings.ToLower(string(b)), v)
+		}
+	case "LARGER", "SMALLER":
+		v, _ := arg()
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, nil, errArgs
+		}
+		f = func(msg seqMessage) bool {
+			if key == "LARGER" {
+				return uint64(len(msg.Body)) > n
+			}
+			return uint64(len(msg.Body)) < n
+		}
+	case "BEFORE", "ON", "SINCE", "SENTBEFORE", "SENTON", "SENTSINCE":
+		v, _ := arg()
+		d, err := time.Parse(imap.SEARCHDATE, v)
+		if err != nil {
+			return nil, nil, bad("Invalid date")
+		}
+		sent := strings.HasPrefix(key, "SENT")
+		cmp := strings.TrimPrefix(key, "SENT")
+		f = func(msg seqMessage) bool {
+			t := msg.Date
+			if sent {
+				var err error
+				if t, _, err = imap.ParseMessageDate(parseHeader(msg.Body).Get("Date")); err != nil {
+					return false
+				}
+			}
+			y, m, dd := t.Date()
+			t = time.Date(y, m, dd, 0, 0, 0, 0, time.UTC)
+			switch cmp {
+			case "BEFORE":
+				return t.Before(d)
+			case "ON":
+				return t.Equal(d)
+			}
+			return !t.Before(d)
+		}
+	case "UID":
+		if len(args) == 0 {
+			return nil, nil, errArgs
+		}
+		var uids []uint32
+		if uids, err = s.uids(args[0], true); err != nil {
+			return
+		}
+		f, args = seqSearch(uids), args[1:]
+	default:
+		if c := key[0]; c != '*' && (c < '0' || c > '9') {
+			return nil, nil, bad("Unsupported search key " + key)
+		}
+		var uids []uint32
+		if uids, err = s.uids(a, false); err != nil {
+			return
+		}
+		f = seqSearch(uids)
+	}
+	return f, args, nil
+}
+
+// headerSearch returns a function that matches messages with a header field
+// that contains v (case-insensitive). An empty v matches all messages that
+// have the field.
+func headerSearch(name, v string) searchFunc {
+	v = strings.ToLower(v)
+	return func(msg seqMessage) bool {
+		for _, hv := range parseHeader(msg.Body)[textproto.CanonicalMIMEHeaderKey(name)] {
+			if strings.Contains(strings.ToLower(hv), v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// seqSearch returns a function that matches the messages with the specified
+// UIDs.
+func seqSearch(uids []uint32) searchFunc {
+	set := make(map[uint32]bool, len(uids))
+	for _, uid := range uids {
+		set[uid] = true
+	}
+	return func(msg seqMessage) bool { return set[msg.UID] }
+}
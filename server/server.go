@@ -0,0 +1,189 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package server implements the protocol side of a small IMAP4rev1 server.
+
+The server reads commands, handles literals and tags, and writes tagged and
+untagged responses, while a Backend provides the users, mailboxes, and
+messages. This makes it possible to embed an IMAP server in an application or
+to build a gateway to another message store without dealing with the wire
+format. Strings are quoted and mailbox names are encoded by the same code that
+the imap package uses for the client.
+
+The following commands are supported: CAPABILITY, NOOP, LOGOUT, LOGIN, SELECT,
+EXAMINE, CREATE, DELETE, LIST, STATUS, APPEND, CHECK, CLOSE, EXPUNGE, SEARCH,
+FETCH, STORE, COPY, and the UID variants of the last four. The LITERAL+ and
+UIDPLUS extensions are also supported. The hierarchy delimiter is "/".
+
+FETCH supports the FLAGS, UID, INTERNALDATE, RFC822.SIZE, ENVELOPE, RFC822,
+RFC822.HEADER, and RFC822.TEXT items, the ALL and FAST macros, and BODY[] and
+BODY.PEEK[] with the HEADER, TEXT, HEADER.FIELDS, and HEADER.FIELDS.NOT
+sections and partial ranges. Message structure is not parsed beyond the header,
+so BODYSTRUCTURE and numeric body sections are not supported. There is no
+\Recent flag. Flag changes made by one connection are not reported to other
+connections that have the same mailbox selected, but new and expunged messages
+are.
+
+A minimal server looks like this:
+
+	l, err := net.Listen("tcp", "localhost:1143")
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := &server.Server{Backend: backend}
+	log.Fatal(srv.Serve(l))
+
+The server does not implement STARTTLS. Use a tls.Listener to accept encrypted
+connections.
+*/
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// Errors that a Backend may return to produce specific response codes.
+// Other errors are sent to the client as NO responses with the error text.
+var (
+	ErrInvalidCredentials = errors.New("server: invalid credentials")
+	ErrNoMailbox          = errors.New("server: mailbox does not exist")
+	ErrMailboxExists      = errors.New("server: mailbox already exists")
+)
+
+// DefaultCapabilities are the capabilities advertised by a Server that does
+// not specify its own.
+const DefaultCapabilities = "IMAP4rev1 LITERAL+ UIDPLUS"
+
+// Delim is the hierarchy delimiter used for mailbox names.
+const Delim = "/"
+
+// Backend authenticates users.
+type Backend interface {
+	// Login returns the user with the specified credentials or
+	// ErrInvalidCredentials.
+	Login(username, password string) (User, error)
+}
+
+// User provides access to the mailboxes of an authenticated user. Mailbox names
+// are UTF-8 strings that use Delim as the hierarchy delimiter. "INBOX" is always
+// passed in upper case.
+type User interface {
+	// Mailboxes returns the names of all mailboxes.
+	Mailboxes() ([]string, error)
+
+	// Mailbox returns the specified mailbox or ErrNoMailbox.
+	Mailbox(name string) (Mailbox, error)
+
+	// CreateMailbox creates a new mailbox or returns ErrMailboxExists.
+	CreateMailbox(name string) error
+
+	// DeleteMailbox deletes a mailbox or returns ErrNoMailbox.
+	DeleteMailbox(name string) error
+}
+
+// Mailbox provides access to the messages in a mailbox. Its methods may be
+// called concurrently by multiple connections.
+type Mailbox interface {
+	// Status returns the current status of the mailbox.
+	Status() (*MailboxStatus, error)
+
+	// UIDs returns the UIDs of all messages in ascending order. The server
+	// assigns message sequence numbers and detects new and expunged messages
+	// by comparing the result with the UIDs known to the client.
+	UIDs() ([]uint32, error)
+
+	// Fetch returns the messages with the specified UIDs in ascending UID order.
+	// UIDs that no longer exist are skipped. The server does not modify the
+	// returned messages.
+	Fetch(uids []uint32) ([]*Message, error)
+
+	// Append adds a new message and returns its UID.
+	Append(body []byte, date time.Time, flags []string) (uint32, error)
+
+	// SetFlags changes the flags of the messages with the specified UIDs.
+	SetFlags(uids []uint32, op FlagOp, flags []string) error
+
+	// Expunge removes the messages that have the \Deleted flag. If uids is not
+	// nil, only those messages are considered.
+	Expunge(uids []uint32) error
+}
+
+// MailboxStatus contains the information about a mailbox that is sent in
+// response to SELECT, EXAMINE, and STATUS commands.
+type MailboxStatus struct {
+	Messages    uint32 // Number of messages
+	Unseen      uint32 // Number of messages without the \Seen flag
+	FirstUnseen uint32 // Position of the first message without \Seen (1-based), or 0
+	UIDNext     uint32 // Predicted next UID
+	UIDValidity uint32 // UID validity value
+}
+
+// Message is a message stored in a mailbox.
+type Message struct {
+	UID   uint32    // Unique identifier
+	Flags []string  // System flags (e.g. `\Seen`) and keywords
+	Date  time.Time // Internal date
+	Body  []byte    // Full RFC 2822 message
+}
+
+// FlagOp specifies how Mailbox.SetFlags changes message flags.
+type FlagOp int
+
+// Flag operations.
+const (
+	ReplaceFlags FlagOp = iota // Replace all flags
+	AddFlags                   // Add the flags
+	RemoveFlags                // Remove the flags
+)
+
+// Server is an IMAP server that uses Backend to access user data.
+type Server struct {
+	// Backend provides users, mailboxes, and messages.
+	Backend Backend
+
+	// Capabilities are advertised in the greeting and in response to the
+	// CAPABILITY command (DefaultCapabilities if empty). Extensions beyond
+	// those that are supported by default must be implemented elsewhere.
+	Capabilities string
+
+	// Greeting is the text of the initial server greeting.
+	Greeting string
+}
+
+// Serve accepts connections from l and serves each one in a new goroutine. It
+// returns when l.Accept returns an error.
+func (srv *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go srv.ServeConn(conn)
+	}
+}
+
+// ServeConn handles a single client connection until the client logs out or the
+// connection is closed, which is done before ServeConn returns.
+func (srv *Server) ServeConn(conn net.Conn) error {
+	return newSession(srv, conn).serve()
+}
+
+// caps returns the advertised capabilities.
+func (srv *Server) caps() string {
+	if srv.Capabilities != "" {
+		return srv.Capabilities
+	}
+	return DefaultCapabilities
+}
+
+// greeting returns the text of the greeting.
+func (srv *Server) greeting() string {
+	if srv.Greeting != "" {
+		return srv.Greeting
+	}
+	return "Server ready"
+}
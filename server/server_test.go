@@ -0,0 +1,55 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+	"github.com/mxk/go-imap/server"
+)
+
+// errBackend is a Backend that fails to authenticate any user.
+type errBackend struct{ err error }
+
+func (b errBackend) Login(username, password string) (server.User, error) {
+	return nil, b.err
+}
+
+// dial connects a client to srv via an in-memory connection.
+func dial(t *testing.T, srv *server.Server) *imap.Client {
+	c, sc := net.Pipe()
+	go srv.ServeConn(sc)
+	cl, err := imap.NewClient(c, "localhost", 0)
+	if err != nil {
+		t.Fatalf("NewClient() unexpected error; %v", err)
+	}
+	return cl
+}
+
+func TestServerErrors(t *testing.T) {
+	tests := []struct {
+		err   error
+		label string
+		info  string
+	}{
+		{server.ErrInvalidCredentials, "AUTHENTICATIONFAILED", "Invalid credentials"},
+		{errors.New("backend unavailable"), "", "backend unavailable"},
+	}
+	for _, test := range tests {
+		srv := &server.Server{Backend: errBackend{test.err}, Greeting: "Test server"}
+		c := dial(t, srv)
+		_, err := imap.Wait(c.Login("joe", "secret"))
+		if rsp, ok := err.(imap.ResponseError); !ok || rsp.Status != imap.NO {
+			t.Errorf("Login() expected NO; got %v", err)
+		} else if rsp.Label != test.label || rsp.Info != test.info {
+			t.Errorf("Login() expected [%s] %q; got [%s] %q", test.label, test.info, rsp.Label, rsp.Info)
+		}
+		c.Logout(time.Second)
+	}
+}
@@ -0,0 +1,684 @@
+// Copyright 2013 The Go-IMAP Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mxk/go-imap/imap"
+)
+
+// Session states, in the order in which they are entered.
+const (
+	notAuthenticated = iota
+	authenticated
+	selected
+)
+
+// command describes how a command is executed.
+type command struct {
+	exec  func(s *session, uid bool, args []interface{}) (string, error)
+	state int  // Minimum state in which the command is allowed
+	uid   bool // Command may follow the UID prefix
+
+	// EXPUNGE responses are not allowed after FETCH, STORE, and SEARCH,
+	// because the client cannot know which messages were meant by the
+	// sequence numbers (RFC 3501 section 7.4.1). UID commands are exempt.
+	noExpunge bool
+}
+
+// commands maps command names to their implementations.
+var commands map[string]*command
+
+func init() {
+	commands = map[string]*command{
+		"CAPABILITY": {exec: (*session).capability},
+		"NOOP":       {exec: (*session).noop},
+		"LOGOUT":     {exec: (*session).logout},
+		"LOGIN":      {exec: (*session).login},
+		"SELECT":     {exec: (*session).selectCmd, state: authenticated},
+		"EXAMINE":    {exec: (*session).examine, state: authenticated},
+		"CREATE":     {exec: (*session).create, state: authenticated},
+		"DELETE":     {exec: (*session).delete, state: authenticated},
+		"LIST":       {exec: (*session).list, state: authenticated},
+		"STATUS":     {exec: (*session).status, state: authenticated},
+		"APPEND":     {exec: (*session).append, state: authenticated},
+		"CHECK":      {exec: (*session).noop, state: selected},
+		"CLOSE":      {exec: (*session).close, state: selected},
+		"EXPUNGE":    {exec: (*session).expunge, state: selected, uid: true},
+		"SEARCH":     {exec: (*session).search, state: selected, uid: true, noExpunge: true},
+		"FETCH":      {exec: (*session).fetch, state: selected, uid: true, noExpunge: true},
+		"STORE":      {exec: (*session).store, state: selected, uid: true, noExpunge: true},
+		"COPY":       {exec: (*session).copy, state: selected, uid: true},
+	}
+}
+
+// statusError is a NO or BAD command completion result. Other errors returned
+// by command implementations are sent as NO responses.
+type statusError struct {
+	status string
+	text   string
+}
+
+func (err *statusError) Error() string {
+	return err.status + " " + err.text
+}
+
+// no returns a NO completion result.
+func no(text string) error {
+	return &statusError{"NO", text}
+}
+
+// bad returns a BAD completion result.
+func bad(text string) error {
+	return &statusError{"BAD", text}
+}
+
+// Common completion results.
+var (
+	errArgs      = bad("Invalid arguments")
+	errSeqSet    = bad("Invalid sequence set")
+	errNoMailbox = no("[NONEXISTENT] Mailbox does not exist")
+	errTryCreate = no("[TRYCREATE] Mailbox does not exist")
+	errReadOnly  = no("Mailbox is read-only")
+)
+
+// backendErrors maps Backend errors to completion results.
+var backendErrors = map[error]error{
+	ErrInvalidCredentials: no("[AUTHENTICATIONFAILED] Invalid credentials"),
+	ErrNoMailbox:          errNoMailbox,
+	ErrMailboxExists:      no("[ALREADYEXISTS] Mailbox already exists"),
+}
+
+// session is the state of a single client connection. Commands are read and
+// executed by the goroutine that called Server.ServeConn. Responses are queued and
+// written by another goroutine, so the server never blocks on a client that is
+// busy sending more commands.
+type session struct {
+	srv  *Server
+	conn net.Conn
+	p    parser
+	out  bytes.Buffer // Responses to the current command
+
+	user     User
+	mbox     Mailbox
+	readOnly bool
+	view     []uint32 // UIDs of the messages known to the client
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  [][]byte // Responses waiting to be written
+	closed bool
+	done   chan struct{}
+}
+
+// newSession returns a new session for conn.
+func newSession(srv *Server, conn net.Conn) *session {
+	s := &session{srv: srv, conn: conn, done: make(chan struct{})}
+	s.cond = sync.NewCond(&s.mu)
+	s.p = parser{r: bufio.NewReader(conn), limit: maxAuthLiteral, cont: func() {
+		s.send([]byte("+ Ready for literal data\r\n"))
+	}}
+	return s
+}
+
+// serve executes commands until the client logs out or the connection is
+// closed.
+func (s *session) serve() error {
+	go s.writer()
+	defer s.shutdown()
+	s.send([]byte("* OK [CAPABILITY " + s.srv.caps() + "] " + s.srv.greeting() + "\r\n"))
+	for {
+		tag, args, err := s.p.readCommand()
+		switch err {
+		case nil:
+			if !s.exec(tag, args) {
+				return nil
+			}
+		case errSyntax:
+			if tag == "" {
+				tag = "*"
+			}
+			s.send([]byte(tag + " BAD Syntax error\r\n"))
+		case errLine:
+			s.send([]byte("* BYE Command line too long\r\n"))
+			return err
+		case errLiteral:
+			s.send([]byte("* BYE Invalid literal\r\n"))
+			return err
+		case io.EOF:
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// exec executes a command and queues its responses. It returns false after
+// LOGOUT.
+func (s *session) exec(tag string, args []interface{}) bool {
+	var name string
+	uid := false
+	if a, ok := args[0].(atom); ok {
+		name, args = strings.ToUpper(string(a)), args[1:]
+	}
+	if name == "UID" && len(args) > 0 {
+		if a, ok := args[0].(atom); ok {
+			name, args, uid = strings.ToUpper(string(a)), args[1:], true
+		}
+	}
+	cmd := commands[name]
+	if name == "UID" {
+		cmd = nil
+	}
+	var text string
+	var err error
+	switch {
+	case cmd == nil || (uid && !cmd.uid):
+		err = bad("Unknown command")
+	case cmd.state == authenticated && s.user == nil:
+		err = bad("Not authenticated")
+	case cmd.state == selected && s.mbox == nil:
+		err = bad("No mailbox selected")
+	default:
+		if s.mbox != nil {
+			s.sync(false)
+		}
+		text, err = cmd.exec(s, uid, args)
+		if s.mbox != nil {
+			s.sync(uid || !cmd.noExpunge)
+		}
+	}
+	status := "OK"
+	if err != nil {
+		if e, ok := backendErrors[err]; ok {
+			err = e
+		}
+		status, text = "NO", err.Error()
+		if e, ok := err.(*statusError); ok {
+			status, text = e.status, e.text
+		}
+	}
+	if text == "" {
+		text = name + " completed"
+	}
+	fmt.Fprintf(&s.out, "%s %s %s\r\n", tag, status, text)
+	s.send(append([]byte(nil), s.out.Bytes()...))
+	s.out.Reset()
+	return name != "LOGOUT"
+}
+
+// sync reports messages that were added to the selected mailbox by APPEND,
+// COPY, or other sessions. If expunge is true, messages that were removed are
+// also reported. Backend errors are ignored, because they will be reported by
+// the next command that accesses the mailbox.
+func (s *session) sync(expunge bool) {
+	uids, err := s.mbox.UIDs()
+	if err != nil {
+		return
+	}
+	if expunge {
+		for i := len(s.view) - 1; i >= 0; i-- {
+			if !containsUID(uids, s.view[i]) {
+				s.printf("* %d EXPUNGE", i+1)
+				s.view = append(s.view[:i], s.view[i+1:]...)
+			}
+		}
+	}
+	n := len(s.view)
+	var last uint32
+	if n > 0 {
+		last = s.view[n-1]
+	}
+	i := sort.Search(len(uids), func(i int) bool { return uids[i] > last })
+	s.view = append(s.view, uids[i:]...)
+	if len(s.view) != n {
+		s.printf("* %d EXISTS", len(s.view))
+	}
+}
+
+// containsUID returns true if the sorted uids contain uid.
+func containsUID(uids []uint32, uid uint32) bool {
+	i := sort.Search(len(uids), func(i int) bool { return uids[i] >= uid })
+	return i < len(uids) && uids[i] == uid
+}
+
+// printf adds a response line to the output of the current command.
+func (s *session) printf(format string, v ...interface{}) {
+	fmt.Fprintf(&s.out, format, v...)
+	s.out.WriteString("\r\n")
+}
+
+// send queues data for the writer goroutine.
+func (s *session) send(b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, b)
+	s.cond.Signal()
+}
+
+// writer writes queued data to the connection until the session is shut down.
+func (s *session) writer() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		queue, closed := s.queue, s.closed
+		s.queue = nil
+		s.mu.Unlock()
+		for _, b := range queue {
+			if _, err := s.conn.Write(b); err != nil {
+				s.conn.Close()
+				return
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// shutdown writes the remaining responses and closes the connection.
+func (s *session) shutdown() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Signal()
+	s.mu.Unlock()
+	<-s.done
+	s.conn.Close()
+}
+
+// quote returns s as a quoted string or, if that is not possible, a literal.
+func quote(s string) string {
+	if q := imap.Quote(s, false); q != "" {
+		return q
+	}
+	return "{" + strconv.Itoa(len(s)) + "}\r\n" + s
+}
+
+// nstring is like quote, but returns NIL for an empty string.
+func nstring(s string) string {
+	if s == "" {
+		return "NIL"
+	}
+	return quote(s)
+}
+
+// literal returns b as a literal.
+func literal(b []byte) string {
+	return "{" + strconv.Itoa(len(b)) + "}\r\n" + string(b)
+}
+
+// astring returns the value of an atom or string argument.
+func astring(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case atom:
+		return string(v), true
+	case string:
+		return v, true
+	}
+	return "", false
+}
+
+// mailboxArg returns the decoded value of a mailbox name argument.
+func mailboxArg(v interface{}) (string, error) {
+	s, ok := astring(v)
+	if !ok {
+		return "", errArgs
+	}
+	name, err := imap.DecodeMailboxName(s)
+	if err != nil {
+		return "", bad("Invalid mailbox name")
+	}
+	if strings.EqualFold(name, "INBOX") {
+		name = "INBOX"
+	}
+	return name, nil
+}
+
+// mailboxName returns the encoded form of a mailbox name for a response.
+func mailboxName(name string) string {
+	return quote(imap.EncodeMailboxName(name))
+}
+
+// flagArgs returns the flags in a parenthesized list or a sequence of atoms.
+func flagArgs(args []interface{}) ([]string, error) {
+	if len(args) == 1 {
+		if list, ok := args[0].([]interface{}); ok {
+			args = list
+		}
+	}
+	flags := make([]string, 0, len(args))
+	for _, v := range args {
+		f, ok := v.(atom)
+		if !ok || f == "" {
+			return nil, bad("Invalid flag")
+		}
+		flag := string(f)
+		if c, ok := systemFlags[strings.ToUpper(flag)]; ok {
+			flag = c
+		} else if strings.EqualFold(flag, `\Recent`) {
+			continue
+		}
+		flags = append(flags, flag)
+	}
+	return flags, nil
+}
+
+// flagString returns the flags as a parenthesized list.
+func flagString(flags []string) string {
+	return "(" + strings.Join(flags, " ") + ")"
+}
+
+func (s *session) capability(uid bool, args []interface{}) (string, error) {
+	s.printf("* CAPABILITY %s", s.srv.caps())
+	return "", nil
+}
+
+func (s *session) noop(uid bool, args []interface{}) (string, error) {
+	return "", nil
+}
+
+func (s *session) logout(uid bool, args []interface{}) (string, error) {
+	s.printf("* BYE Logging out")
+	return "", nil
+}
+
+func (s *session) login(uid bool, args []interface{}) (string, error) {
+	if s.user != nil {
+		return "", bad("Already authenticated")
+	} else if len(args) != 2 {
+		return "", errArgs
+	}
+	name, ok1 := astring(args[0])
+	pass, ok2 := astring(args[1])
+	if !ok1 || !ok2 {
+		return "", errArgs
+	}
+	u, err := s.srv.Backend.Login(name, pass)
+	if err != nil {
+		return "", err
+	}
+	s.user, s.p.limit = u, maxLiteral
+	return "[CAPABILITY " + s.srv.caps() + "] LOGIN completed", nil
+}
+
+func (s *session) selectCmd(uid bool, args []interface{}) (string, error) {
+	if err := s.selectMailbox(args, false); err != nil {
+		return "", err
+	}
+	return "[READ-WRITE] SELECT completed", nil
+}
+
+func (s *session) examine(uid bool, args []interface{}) (string, error) {
+	if err := s.selectMailbox(args, true); err != nil {
+		return "", err
+	}
+	return "[READ-ONLY] EXAMINE completed", nil
+}
+
+// selectMailbox implements SELECT and EXAMINE, which differ only in the
+// read-only status of the mailbox.
+func (s *session) selectMailbox(args []interface{}, readOnly bool) error {
+	s.mbox, s.view = nil, nil
+	if len(args) != 1 {
+		return errArgs
+	}
+	name, err := mailboxArg(args[0])
+	if err != nil {
+		return err
+	}
+	m, err := s.user.Mailbox(name)
+	if err != nil {
+		return err
+	}
+	st, err := m.Status()
+	if err != nil {
+		return err
+	}
+	uids, err := m.UIDs()
+	if err != nil {
+		return err
+	}
+	s.printf(`* FLAGS (\Answered \Flagged \Deleted \Seen \Draft)`)
+	s.printf(`* OK [PERMANENTFLAGS (\Answered \Flagged \Deleted \Seen \Draft \*)] Flags permitted`)
+	s.printf("* %d EXISTS", len(uids))
+	s.printf("* 0 RECENT")
+	if st.FirstUnseen > 0 {
+		s.printf("* OK [UNSEEN %d] First unseen message", st.FirstUnseen)
+	}
+	s.printf("* OK [UIDVALIDITY %d] UIDs valid", st.UIDValidity)
+	s.printf("* OK [UIDNEXT %d] Predicted next UID", st.UIDNext)
+	s.mbox, s.view, s.readOnly = m, uids, readOnly
+	return nil
+}
+
+func (s *session) create(uid bool, args []interface{}) (string, error) {
+	if len(args) != 1 {
+		return "", errArgs
+	}
+	name, err := mailboxArg(args[0])
+	if err != nil {
+		return "", err
+	} else if name = strings.TrimSuffix(name, Delim); name == "" {
+		return "", bad("Invalid mailbox name")
+	} else if _, err = s.user.Mailbox(name); err == nil {
+		return "", ErrMailboxExists
+	}
+	// Create any missing superior mailboxes (RFC 3501 section 6.3.3)
+	for i := 1; i < len(name); i++ {
+		if name[i] == Delim[0] {
+			if _, err := s.user.Mailbox(name[:i]); err == ErrNoMailbox {
+				if err = s.user.CreateMailbox(name[:i]); err != nil {
+					return "", err
+				}
+			}
+		}
+	}
+	return "", s.user.CreateMailbox(name)
+}
+
+func (s *session) delete(uid bool, args []interface{}) (string, error) {
+	if len(args) != 1 {
+		return "", errArgs
+	}
+	name, err := mailboxArg(args[0])
+	if err != nil {
+		return "", err
+	} else if name == "INBOX" {
+		return "", no("Cannot delete INBOX")
+	}
+	return "", s.user.DeleteMailbox(name)
+}
+
+func (s *session) list(uid bool, args []interface{}) (string, error) {
+	if len(args) != 2 {
+		return "", errArgs
+	}
+	ref, err := mailboxArg(args[0])
+	if err != nil {
+		return "", err
+	}
+	pattern, err := mailboxArg(args[1])
+	if err != nil {
+		return "", err
+	}
+	if pattern == "" {
+		s.printf(`* LIST (\Noselect) %q ""`, Delim)
+		return "", nil
+	}
+	if pattern = ref + pattern; strings.EqualFold(pattern, "INBOX") {
+		pattern = "INBOX"
+	}
+	names, err := s.user.Mailboxes()
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if match(name, pattern) {
+			s.printf("* LIST () %q %s", Delim, mailboxName(name))
+		}
+	}
+	return "", nil
+}
+
+// match returns true if name matches a LIST pattern, in which '*' matches any
+// characters, and '%' matches any characters other than the delimiter. The
+// pattern is applied one character at a time to the set of name positions that
+// can be reached so far, which takes O(len(name)*len(pattern)) time for any
+// combination of wildcards.
+func match(name, pattern string) bool {
+	cur := make([]bool, len(name)+1)
+	next := make([]bool, len(name)+1)
+	cur[0] = true
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*', '%':
+			ok := false
+			for j := range next {
+				if c == '%' && j > 0 && name[j-1] == Delim[0] {
+					ok = false
+				}
+				ok = ok || cur[j]
+				next[j] = ok
+			}
+		default:
+			next[0] = false
+			for j := 0; j < len(name); j++ {
+				next[j+1] = cur[j] && name[j] == c
+			}
+		}
+		cur, next = next, cur
+	}
+	return cur[len(name)]
+}
+
+func (s *session) status(uid bool, args []interface{}) (string, error) {
+	if len(args) != 2 {
+		return "", errArgs
+	}
+	name, err := mailboxArg(args[0])
+	if err != nil {
+		return "", err
+	}
+	items, ok := args[1].([]interface{})
+	if !ok || len(items) == 0 {
+		return "", errArgs
+	}
+	m, err := s.user.Mailbox(name)
+	if err != nil {
+		return "", err
+	}
+	st, err := m.Status()
+	if err != nil {
+		return "", err
+	}
+	var b []string
+	for _, v := range items {
+		item, _ := v.(atom)
+		var n uint32
+		switch strings.ToUpper(string(item)) {
+		case "MESSAGES":
+			n = st.Messages
+		case "RECENT":
+		case "UIDNEXT":
+			n = st.UIDNext
+		case "UIDVALIDITY":
+			n = st.UIDValidity
+		case "UNSEEN":
+			n = st.Unseen
+		default:
+			return "", bad("Invalid status item")
+		}
+		b = append(b, strings.ToUpper(string(item))+" "+strconv.FormatUint(uint64(n), 10))
+	}
+	s.printf("* STATUS %s (%s)", mailboxName(name), strings.Join(b, " "))
+	return "", nil
+}
+
+func (s *session) append(uid bool, args []interface{}) (string, error) {
+	if len(args) < 2 || len(args) > 4 {
+		return "", errArgs
+	}
+	name, err := mailboxArg(args[0])
+	if err != nil {
+		return "", err
+	}
+	body, ok := args[len(args)-1].(string)
+	if !ok {
+		return "", errArgs
+	}
+	var flags []string
+	date := time.Now()
+	for _, v := range args[1 : len(args)-1] {
+		switch v := v.(type) {
+		case []interface{}:
+			if flags, err = flagArgs([]interface{}{v}); err != nil {
+				return "", err
+			}
+		case string:
+			if date, err = imap.ParseDateTime(v); err != nil {
+				return "", bad("Invalid date-time")
+			}
+		default:
+			return "", errArgs
+		}
+	}
+	m, err := s.user.Mailbox(name)
+	if err == ErrNoMailbox {
+		return "", errTryCreate
+	} else if err != nil {
+		return "", err
+	}
+	id, err := m.Append([]byte(body), date, flags)
+	if err != nil {
+		return "", err
+	}
+	st, err := m.Status()
+	if err != nil {
+		return "", nil
+	}
+	return fmt.Sprintf("[APPENDUID %d %d] APPEND completed", st.UIDValidity, id), nil
+}
+
+func (s *session) close(uid bool, args []interface{}) (string, error) {
+	var err error
+	if !s.readOnly {
+		err = s.mbox.Expunge(nil)
+	}
+	s.mbox, s.view = nil, nil
+	return "", err
+}
+
+func (s *session) expunge(uid bool, args []interface{}) (string, error) {
+	var uids []uint32
+	if uid {
+		if len(args) != 1 {
+			return "", errArgs
+		}
+		var err error
+		if uids, err = s.uids(args[0], true); err != nil {
+			return "", err
+		} else if uids == nil {
+			uids = []uint32{}
+		}
+	}
+	if s.readOnly {
+		return "", errReadOnly
+	}
+	return "", s.mbox.Expunge(uids)
+}